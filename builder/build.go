@@ -27,6 +27,7 @@ import (
 	"github.com/gofrs/flock"
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/compiler"
+	"github.com/tinygo-org/tinygo/diagnostics"
 	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/interp"
 	"github.com/tinygo-org/tinygo/loader"
@@ -61,6 +62,20 @@ type BuildResult struct {
 	// correctly printing test results: the import path isn't always the same as
 	// the path listed on the command line.
 	ImportPath string
+
+	// The C header declaring the exported functions of a library built with
+	// -buildmode=c-archive or -buildmode=c-shared. Like Binary, it is stored
+	// in the tmpdir directory.
+	Header string
+
+	// The ES module and TypeScript declarations wrapping the exported
+	// functions, generated with -wasm-bindings. Also stored in tmpdir.
+	JSBindings string
+	TSBindings string
+
+	// The size of the program, only calculated with -json (and only for
+	// supported file formats).
+	Sizes *diagnostics.Sizes
 }
 
 // packageAction is the struct that is serialized to JSON and hashed, to work as
@@ -103,7 +118,12 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 	}
 
 	if config.Options.Work {
-		fmt.Printf("WORK=%s\n", tmpdir)
+		if config.Options.Events != nil {
+			// Keep stdout valid JSON.
+			fmt.Fprintf(os.Stderr, "WORK=%s\n", tmpdir)
+		} else {
+			fmt.Printf("WORK=%s\n", tmpdir)
+		}
 	}
 
 	// Look up the build cache directory, which is used to speed up incremental
@@ -175,7 +195,10 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 		AutomaticStackSize: config.AutomaticStackSize(),
 		DefaultStackSize:   config.StackSize(),
 		NeedsStackObjects:  config.NeedsStackObjects(),
+		NeedsWriteBarriers: config.NeedsWriteBarriers(),
 		Debug:              !config.Options.SkipDWARF, // emit DWARF except when -internal-nodwarf is passed
+		BuildMode:          config.BuildMode(),
+		PackagePaths:       config.Options.AllocReport != "" || len(config.Options.MaxAllocs) != 0,
 	}
 
 	// Load the target machine, which is the LLVM object that contains all
@@ -580,7 +603,7 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 	outext := filepath.Ext(outpath)
 	if outext == ".o" || outext == ".bc" || outext == ".ll" {
 		// Run jobs to produce the LLVM module.
-		err := runJobs(programJob, config.Options.Semaphore)
+		err := runJobs(programJob, config.Options.Semaphore, config.Options.Events)
 		if err != nil {
 			return result, err
 		}
@@ -630,10 +653,74 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 	}
 	result.Binary = result.Executable // final file
 	ldflags := append(config.LDFlags(), "-o", result.Executable)
+	switch config.BuildMode() {
+	case "c-archive":
+		// Link everything into a single relocatable object file, which is
+		// then put in the archive.
+		result.Executable = filepath.Join(tmpdir, "main.lib.o")
+		result.Binary = filepath.Join(tmpdir, "main.a")
+		ldflags = []string{"-r", "-o", result.Executable}
+	case "c-shared":
+		if config.IsWasmReactor() {
+			// A reactor has no _start function, only _initialize.
+			ldflags = append(ldflags, "--no-entry")
+			break
+		}
+		result.Executable = filepath.Join(tmpdir, "main.so")
+		result.Binary = result.Executable
+		ldflags = append(config.LDFlags(), "-shared", "-o", result.Executable)
+	}
+	if len(config.Target.Memory) != 0 && config.BuildMode() != "c-archive" {
+		targetName := config.Options.Target
+		if targetName == "" {
+			targetName = config.Triple()
+		}
+		script, err := generateLinkerScript(config.Target, targetName, goenv.Get("TINYGOROOT"))
+		if err != nil {
+			return result, err
+		}
+		scriptPath := filepath.Join(tmpdir, "memory.ld")
+		err = os.WriteFile(scriptPath, script, 0666)
+		if err != nil {
+			return result, err
+		}
+		ldflags = append(ldflags, "-T", scriptPath)
+	}
+	if config.IsLibrary() {
+		mainPkg := lprogram.MainPkg()
+		header, err := generateCHeader(mainPkg.Pkg, mainPkg.Files, mainPkg.CGoHeaders)
+		if err != nil {
+			return result, err
+		}
+		result.Header = filepath.Join(tmpdir, "main.h")
+		err = os.WriteFile(result.Header, header, 0666)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if config.Options.WasmBindings {
+		mainPkg := lprogram.MainPkg()
+		js, dts, err := generateWasmBindings(mainPkg.Pkg, mainPkg.Files, config.WasmAbi() == "js")
+		if err != nil {
+			return result, err
+		}
+		result.JSBindings = filepath.Join(tmpdir, "main.js")
+		result.TSBindings = filepath.Join(tmpdir, "main.d.ts")
+		err = os.WriteFile(result.JSBindings, js, 0666)
+		if err != nil {
+			return result, err
+		}
+		err = os.WriteFile(result.TSBindings, dts, 0666)
+		if err != nil {
+			return result, err
+		}
+	}
 
 	// Add compiler-rt dependency if needed. Usually this is a simple load from
-	// a cache.
-	if config.Target.RTLib == "compiler-rt" {
+	// a cache. Libraries leave this to the C toolchain that links the final
+	// program, like libc.
+	if config.Target.RTLib == "compiler-rt" && !config.IsLibrary() {
 		job, unlock, err := CompilerRT.load(config, tmpdir)
 		if err != nil {
 			return result, err
@@ -684,7 +771,9 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 	}
 
 	// Add libc dependencies, if they exist.
-	linkerDependencies = append(linkerDependencies, libcDependencies...)
+	if !config.IsLibrary() {
+		linkerDependencies = append(linkerDependencies, libcDependencies...)
+	}
 
 	// Add embedded files.
 	linkerDependencies = append(linkerDependencies, embedFileObjects...)
@@ -764,6 +853,22 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 				return &commandError{"failed to link", result.Executable, err}
 			}
 
+			if config.BuildMode() == "c-archive" {
+				arfile, err := os.Create(result.Binary)
+				if err != nil {
+					return err
+				}
+				err = makeArchive(arfile, []string{result.Executable})
+				if err != nil {
+					arfile.Close()
+					return err
+				}
+				err = arfile.Close()
+				if err != nil {
+					return err
+				}
+			}
+
 			var calculatedStacks []string
 			var stackSizes map[string]functionStackSize
 			if config.Options.PrintStacks || config.AutomaticStackSize() {
@@ -834,20 +939,35 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 				}
 			}
 
-			// Print code size if requested.
-			if config.Options.PrintSizes == "short" || config.Options.PrintSizes == "full" {
+			// Print code size if requested. With -json, the size is always
+			// calculated as it is part of the build result.
+			printSizes := config.Options.PrintSizes == "short" || config.Options.PrintSizes == "full"
+			if printSizes || config.Options.Events != nil {
 				packagePathMap := make(map[string]string, len(lprogram.Packages))
 				for _, pkg := range lprogram.Sorted() {
 					packagePathMap[pkg.OriginalDir()] = pkg.Pkg.Path()
 				}
 				sizes, err := loadProgramSize(result.Executable, packagePathMap)
 				if err != nil {
-					return err
+					if printSizes {
+						return err
+					}
+					// Not all output formats are supported, so don't fail
+					// the build when the size wasn't explicitly requested.
+					sizes = nil
+				}
+				if sizes != nil {
+					result.Sizes = sizes.diagnostics(true)
 				}
-				if config.Options.PrintSizes == "short" {
+				if printSizes && config.Options.Events != nil {
+					config.Options.Events.Emit(diagnostics.Event{
+						Action: "size",
+						Sizes:  sizes.diagnostics(config.Options.PrintSizes == "full"),
+					})
+				} else if config.Options.PrintSizes == "short" {
 					fmt.Printf("   code    data     bss |   flash     ram\n")
 					fmt.Printf("%7d %7d %7d | %7d %7d\n", sizes.Code+sizes.ROData, sizes.Data, sizes.BSS, sizes.Flash(), sizes.RAM())
-				} else {
+				} else if config.Options.PrintSizes == "full" {
 					if !config.Debug() {
 						fmt.Println("warning: data incomplete, remove the -no-debug flag for more detail")
 					}
@@ -864,7 +984,11 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 
 			// Print goroutine stack sizes, as far as possible.
 			if config.Options.PrintStacks {
-				printStacks(calculatedStacks, stackSizes)
+				if config.Options.Events != nil {
+					emitStacks(config.Options.Events, calculatedStacks, stackSizes)
+				} else {
+					printStacks(calculatedStacks, stackSizes)
+				}
 			}
 
 			return nil
@@ -874,7 +998,7 @@ func Build(pkgName, outpath, tmpdir string, config *compileopts.Config) (BuildRe
 	// Run all jobs to compile and link the program.
 	// Do this now (instead of after elf-to-hex and similar conversions) as it
 	// is simpler and cannot be parallelized.
-	err = runJobs(linkJob, config.Options.Semaphore)
+	err = runJobs(linkJob, config.Options.Semaphore, config.Options.Events)
 	if err != nil {
 		return result, err
 	}
@@ -1360,6 +1484,35 @@ func printStacks(calculatedStacks []string, stackSizes map[string]functionStackS
 	}
 }
 
+// emitStacks is the -json counterpart of printStacks: it emits a "stack" event
+// for each function that is started as a goroutine.
+func emitStacks(events *diagnostics.Writer, calculatedStacks []string, stackSizes map[string]functionStackSize) {
+	for _, name := range calculatedStacks {
+		fn := stackSizes[name]
+		stack := &diagnostics.Stack{
+			Function: fn.humanName,
+		}
+		if fn.missingStackSize != nil {
+			stack.Cause = fn.missingStackSize.String()
+		}
+		switch fn.stackSizeType {
+		case stacksize.Bounded:
+			stack.Kind = "bounded"
+			stack.Size = fn.stackSize
+		case stacksize.Unknown:
+			stack.Kind = "unknown"
+		case stacksize.Recursive:
+			stack.Kind = "recursive"
+		case stacksize.IndirectCall:
+			stack.Kind = "indirect-call"
+		}
+		events.Emit(diagnostics.Event{
+			Action: "stack",
+			Stack:  stack,
+		})
+	}
+}
+
 // RP2040 second stage bootloader CRC32 calculation
 //
 // Spec: https://datasheets.raspberrypi.org/rp2040/rp2040-datasheet.pdf
@@ -0,0 +1,224 @@
+package builder
+
+// This file generates the C header that comes with a library built with
+// -buildmode=c-archive or -buildmode=c-shared. It is similar to the
+// _cgo_export.h header generated by the gc toolchain.
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// Preamble of the generated header, with the C equivalents of Go types.
+const cHeaderPreamble = `#include <stddef.h>
+#include <stdint.h>
+
+typedef int8_t GoInt8;
+typedef uint8_t GoUint8;
+typedef int16_t GoInt16;
+typedef uint16_t GoUint16;
+typedef int32_t GoInt32;
+typedef uint32_t GoUint32;
+typedef int64_t GoInt64;
+typedef uint64_t GoUint64;
+typedef intptr_t GoInt;
+typedef uintptr_t GoUint;
+typedef uintptr_t GoUintptr;
+typedef float GoFloat32;
+typedef double GoFloat64;
+typedef _Bool GoBool;
+typedef struct { const char *p; ptrdiff_t n; } GoString;
+`
+
+// cTypeNames maps the short names of CGo types (C.uint etc) to the C type.
+var cTypeNames = map[string]string{
+	"schar":     "signed char",
+	"uchar":     "unsigned char",
+	"ushort":    "unsigned short",
+	"uint":      "unsigned int",
+	"ulong":     "unsigned long",
+	"longlong":  "long long",
+	"ulonglong": "unsigned long long",
+}
+
+// generateCHeader returns a C header declaring all functions exported with
+// //export (or //go:export) in the given package. The CGo preamble of the
+// package is included, so that the C types used in exported functions are
+// defined.
+func generateCHeader(pkg *types.Package, files []*ast.File, cgoHeaders []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("/* Code generated by TinyGo. DO NOT EDIT. */\n\n")
+	buf.WriteString("#pragma once\n\n")
+	for _, header := range cgoHeaders {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+		buf.WriteString(strings.TrimSpace(header))
+		buf.WriteString("\n\n")
+	}
+	buf.WriteString(cHeaderPreamble)
+	buf.WriteString("\n#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Body == nil || decl.Recv != nil {
+				// Only functions that are defined in Go can be exported.
+				continue
+			}
+			name := exportName(decl)
+			if name == "" {
+				continue
+			}
+			fn := pkg.Scope().Lookup(decl.Name.Name)
+			if fn == nil {
+				continue
+			}
+			line, err := cFunctionDecl(name, fn.Type().(*types.Signature))
+			if err != nil {
+				return nil, fmt.Errorf("cannot export %s: %w", decl.Name.Name, err)
+			}
+			buf.WriteString(line)
+		}
+	}
+	buf.WriteString("\n#ifdef __cplusplus\n}\n#endif\n")
+	return buf.Bytes(), nil
+}
+
+// exportName returns the name given in an //export or //go:export pragma of
+// this function, or the empty string if it isn't exported.
+func exportName(decl *ast.FuncDecl) string {
+	if decl.Doc == nil {
+		return ""
+	}
+	name := ""
+	for _, comment := range decl.Doc.List {
+		parts := strings.Fields(comment.Text)
+		if len(parts) == 2 && (parts[0] == "//export" || parts[0] == "//go:export") {
+			name = parts[1]
+		}
+	}
+	return name
+}
+
+// cFunctionDecl returns the C declaration of an exported function.
+func cFunctionDecl(name string, sig *types.Signature) (string, error) {
+	if sig.Variadic() {
+		return "", fmt.Errorf("variadic functions are not supported")
+	}
+	result := "void"
+	switch sig.Results().Len() {
+	case 0:
+	case 1:
+		t := sig.Results().At(0).Type()
+		if basic, ok := t.Underlying().(*types.Basic); ok && basic.Info()&types.IsString != 0 {
+			// Strings are returned differently by C and Go on some
+			// architectures.
+			return "", fmt.Errorf("returning a string is not supported")
+		}
+		var err error
+		result, err = cType(t)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("multiple return values are not supported")
+	}
+	var params []string
+	for i := 0; i < sig.Params().Len(); i++ {
+		param := sig.Params().At(i)
+		t, err := cType(param.Type())
+		if err != nil {
+			return "", err
+		}
+		paramName := param.Name()
+		if paramName == "" || paramName == "_" {
+			paramName = fmt.Sprintf("p%d", i)
+		}
+		params = append(params, t+" "+paramName)
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	return fmt.Sprintf("extern %s %s(%s);\n", result, name, strings.Join(params, ", ")), nil
+}
+
+// cType returns the C type for a Go type used in an exported function. Only
+// types that are passed the same way in Go and C are supported.
+func cType(t types.Type) (string, error) {
+	if named, ok := t.(*types.Named); ok && strings.HasPrefix(named.Obj().Name(), "C.") {
+		// A type from CGo.
+		switch named.Underlying().(type) {
+		case *types.Basic, *types.Pointer:
+		default:
+			return "", fmt.Errorf("%s can only be passed by pointer", named.Obj().Name())
+		}
+		return cgoTypeName(named.Obj().Name()), nil
+	}
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		switch t.Kind() {
+		case types.Bool:
+			return "GoBool", nil
+		case types.Int:
+			return "GoInt", nil
+		case types.Int8:
+			return "GoInt8", nil
+		case types.Int16:
+			return "GoInt16", nil
+		case types.Int32:
+			return "GoInt32", nil
+		case types.Int64:
+			return "GoInt64", nil
+		case types.Uint:
+			return "GoUint", nil
+		case types.Uint8:
+			return "GoUint8", nil
+		case types.Uint16:
+			return "GoUint16", nil
+		case types.Uint32:
+			return "GoUint32", nil
+		case types.Uint64:
+			return "GoUint64", nil
+		case types.Uintptr:
+			return "GoUintptr", nil
+		case types.Float32:
+			return "GoFloat32", nil
+		case types.Float64:
+			return "GoFloat64", nil
+		case types.String:
+			return "GoString", nil
+		case types.UnsafePointer:
+			return "void*", nil
+		}
+	case *types.Pointer:
+		if named, ok := t.Elem().(*types.Named); ok && strings.HasPrefix(named.Obj().Name(), "C.") {
+			// Any CGo type, including structs, can be passed by pointer.
+			return cgoTypeName(named.Obj().Name()) + "*", nil
+		}
+		elem, err := cType(t.Elem())
+		if err != nil {
+			// Pointers to Go types that C doesn't know about.
+			return "void*", nil
+		}
+		return elem + "*", nil
+	}
+	return "", fmt.Errorf("type %s is not supported in exported functions", t.String())
+}
+
+// cgoTypeName converts a CGo type name like C.struct_point to the C type name
+// (struct point).
+func cgoTypeName(name string) string {
+	name = strings.TrimPrefix(name, "C.")
+	for _, prefix := range []string{"struct", "union", "enum"} {
+		if strings.HasPrefix(name, prefix+"_") {
+			return prefix + " " + name[len(prefix)+1:]
+		}
+	}
+	if cName, ok := cTypeNames[name]; ok {
+		return cName
+	}
+	return name
+}
@@ -0,0 +1,112 @@
+package builder
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCHeader(t *testing.T) {
+	const src = `package main
+
+import "unsafe"
+
+//export add
+func add(a, b int) int {
+	return a + b
+}
+
+//go:export tinygo_greet
+func greet(name string, buf unsafe.Pointer, _ *int32) {
+}
+
+//export notify
+func notify()
+
+func main() {
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := types.Config{Importer: importer.Default()}
+	pkg, err := config.Check("main", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := generateCHeader(pkg, []*ast.File{file}, []string{"#include <stdio.h>\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"#include <stdio.h>\n",
+		"extern GoInt add(GoInt a, GoInt b);\n",
+		"extern void tinygo_greet(GoString name, void* buf, GoInt32* p2);\n",
+	} {
+		if !strings.Contains(string(header), line) {
+			t.Errorf("header does not contain %q:\n%s", line, header)
+		}
+	}
+	if strings.Contains(string(header), "notify") {
+		t.Errorf("header contains imported function notify:\n%s", header)
+	}
+}
+
+func TestCGoTypeName(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		out string
+	}{
+		{"C.int", "int"},
+		{"C.uint", "unsigned int"},
+		{"C.ulonglong", "unsigned long long"},
+		{"C.size_t", "size_t"},
+		{"C.struct_point", "struct point"},
+		{"C.union_value", "union value"},
+		{"C.enum_color", "enum color"},
+	} {
+		if out := cgoTypeName(tc.in); out != tc.out {
+			t.Errorf("cgoTypeName(%q): expected %q but got %q", tc.in, tc.out, out)
+		}
+	}
+}
+
+func TestCFunctionDeclErrors(t *testing.T) {
+	pkg := types.NewPackage("main", "main")
+	point := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "C.struct_point", nil), types.NewStruct(nil, nil), nil)
+	newSig := func(params, results []types.Type) *types.Signature {
+		var paramVars, resultVars []*types.Var
+		for _, t := range params {
+			paramVars = append(paramVars, types.NewParam(token.NoPos, pkg, "", t))
+		}
+		for _, t := range results {
+			resultVars = append(resultVars, types.NewParam(token.NoPos, pkg, "", t))
+		}
+		return types.NewSignatureType(nil, nil, nil, types.NewTuple(paramVars...), types.NewTuple(resultVars...), false)
+	}
+
+	decl, err := cFunctionDecl("move", newSig([]types.Type{types.NewPointer(point)}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl != "extern void move(struct point* p0);\n" {
+		t.Errorf("unexpected declaration: %q", decl)
+	}
+
+	for _, sig := range []*types.Signature{
+		newSig([]types.Type{point}, nil),
+		newSig(nil, []types.Type{types.Typ[types.String]}),
+		newSig(nil, []types.Type{types.Typ[types.Int], types.Typ[types.Int]}),
+		newSig([]types.Type{types.NewSlice(types.Typ[types.Byte])}, nil),
+	} {
+		if _, err := cFunctionDecl("f", sig); err == nil {
+			t.Errorf("expected an error for %s", sig)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package builder
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/goenv"
@@ -39,6 +40,35 @@ func NewConfig(options *compileopts.Options) (*compileopts.Config, error) {
 		return nil, fmt.Errorf("requires go version 1.18 through 1.20, got go%d.%d", major, minor)
 	}
 
+	if strings.HasPrefix(spec.Triple, "wasm") {
+		// WebAssembly modules are either commands (the default) or reactors
+		// (c-shared).
+		if options.BuildMode == "c-archive" {
+			return nil, errors.New("-buildmode=c-archive is not supported on WebAssembly, use -buildmode=c-shared for a reactor module")
+		}
+	} else if options.BuildMode == "c-archive" || options.BuildMode == "c-shared" {
+		// Libraries need a hosted target: they rely on the system to call
+		// into them and on libc to provide memory.
+		parts := strings.Split(spec.Triple, "-")
+		if len(parts) < 3 || parts[2] != "linux" || spec.Libc != "musl" {
+			return nil, fmt.Errorf("-buildmode=%s is only supported on linux and WebAssembly, not for target %s", options.BuildMode, spec.Triple)
+		}
+	}
+
+	if options.WasmBindings && spec.WasmAbi != "js" {
+		// The bindings are built on top of wasm_exec.js.
+		return nil, fmt.Errorf("-wasm-bindings is only supported with -target=wasm, not for target %s", spec.Triple)
+	}
+	if options.WasmBindings {
+		for _, tag := range options.Tags {
+			if tag == "custommalloc" {
+				// The bindings free arguments after the call, which is only
+				// safe if free leaves them to the garbage collector.
+				return nil, errors.New("-wasm-bindings can't be used with a custom malloc (-tags=custommalloc)")
+			}
+		}
+	}
+
 	clangHeaderPath := getClangHeaderPath(goenv.Get("TINYGOROOT"))
 
 	return &compileopts.Config{
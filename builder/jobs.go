@@ -11,6 +11,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/tinygo-org/tinygo/diagnostics"
 )
 
 // Set to true to enable logging in the job runner. This may help to debug
@@ -53,7 +55,9 @@ func dummyCompileJob(result string) *compileJob {
 // It runs all jobs in the order of the dependencies slice, depth-first.
 // Therefore, if some jobs are preferred to run before others, they should be
 // ordered as such in the job dependencies.
-func runJobs(job *compileJob, sema chan struct{}) error {
+// Every job that finishes is reported as a "step" event to events, if it isn't
+// nil.
+func runJobs(job *compileJob, sema chan struct{}, events *diagnostics.Writer) error {
 	if sema == nil {
 		// Have a default, if the semaphore isn't set. This is useful for
 		// tests.
@@ -149,6 +153,13 @@ func runJobs(job *compileJob, sema chan struct{}) error {
 
 		// Update total run time.
 		totalTime += completed.duration
+		if completed.description != "<dummy>" {
+			events.Emit(diagnostics.Event{
+				Action:  "step",
+				Step:    completed.description,
+				Elapsed: completed.duration.Seconds(),
+			})
+		}
 
 		// Update dependent jobs.
 		for _, j := range dependents[completed] {
@@ -44,7 +44,7 @@ func (l *Library) Load(config *compileopts.Config, tmpdir string) (dir string, e
 		return "", err
 	}
 	defer unlock()
-	err = runJobs(job, config.Options.Semaphore)
+	err = runJobs(job, config.Options.Semaphore, config.Options.Events)
 	return filepath.Dir(job.result), err
 }
 
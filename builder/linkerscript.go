@@ -0,0 +1,148 @@
+package builder
+
+// This file generates a linker script from the memory map in the target
+// specification, so that boards that only differ in their memory layout don't
+// need their own linker script.
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+var (
+	linkerSymbolName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	linkerSize       = regexp.MustCompile(`^(0x[0-9a-fA-F]+|[0-9]+[KM]?)$`)
+	linkerComment    = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	linkerMemory     = regexp.MustCompile(`\bMEMORY\s*\{`)
+)
+
+// generateLinkerScript returns a linker script with the memory regions of the
+// given target, minus the reserved memory. The script includes the target
+// linker script (or the default one for the architecture) for the sections,
+// which is looked up relative to root and must not have a MEMORY block of its
+// own. The target name is only used in error messages.
+func generateLinkerScript(spec *compileopts.TargetSpec, target, root string) ([]byte, error) {
+	include := spec.LinkerScript
+	if include == "" {
+		arch := strings.Split(spec.Triple, "-")[0]
+		switch {
+		case strings.HasPrefix(arch, "thumb") || strings.HasPrefix(arch, "arm"):
+			include = "targets/arm.ld"
+		case strings.HasPrefix(arch, "riscv"):
+			include = "targets/riscv.ld"
+		default:
+			return nil, fmt.Errorf("memory map without a linker script is not supported for %s", spec.Triple)
+		}
+	}
+	if err := checkIncludedLinkerScript(include, target, root); err != nil {
+		return nil, err
+	}
+
+	var regionNames []string
+	for name, region := range spec.Memory {
+		if !linkerSymbolName.MatchString(name) {
+			return nil, fmt.Errorf("invalid memory region name: %q", name)
+		}
+		if !linkerSize.MatchString(region.Origin) {
+			return nil, fmt.Errorf("memory region %s: invalid origin: %q", name, region.Origin)
+		}
+		if !linkerSize.MatchString(region.Length) {
+			return nil, fmt.Errorf("memory region %s: invalid length: %q", name, region.Length)
+		}
+		regionNames = append(regionNames, name)
+	}
+	sort.Strings(regionNames)
+
+	// Sort reserved memory by name, so that the output is stable.
+	var reservedNames []string
+	for name, reserved := range spec.ReservedMemory {
+		if !linkerSymbolName.MatchString(name) {
+			return nil, fmt.Errorf("invalid reserved memory name: %q", name)
+		}
+		if _, ok := spec.Memory[reserved.Region]; !ok {
+			return nil, fmt.Errorf("reserved memory %s: unknown memory region %q", name, reserved.Region)
+		}
+		if !linkerSize.MatchString(reserved.Length) {
+			return nil, fmt.Errorf("reserved memory %s: invalid length: %q", name, reserved.Length)
+		}
+		reservedNames = append(reservedNames, name)
+	}
+	sort.Strings(reservedNames)
+
+	stackSize := spec.MainStackSize
+	if stackSize == "" {
+		stackSize = "4K"
+	}
+	if !linkerSize.MatchString(stackSize) {
+		return nil, fmt.Errorf("invalid main stack size: %q", stackSize)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("/* Generated by TinyGo from the memory map in the target specification. */\n\n")
+	buf.WriteString("MEMORY\n{\n")
+	var symbols bytes.Buffer
+	for _, name := range regionNames {
+		region := spec.Memory[name]
+		length := region.Length
+		// Reserved memory at the start of the region moves the origin,
+		// reserved memory at the end only reduces the length.
+		start := region.Origin
+		end := region.Origin + " + " + region.Length
+		for _, reservedName := range reservedNames {
+			reserved := spec.ReservedMemory[reservedName]
+			if reserved.Region != name {
+				continue
+			}
+			length += " - " + reserved.Length
+			if reserved.End {
+				fmt.Fprintf(&symbols, "_reserved_%s_start = %s - %s;\n", reservedName, end, reserved.Length)
+				fmt.Fprintf(&symbols, "_reserved_%s_end = %s;\n", reservedName, end)
+				end += " - " + reserved.Length
+			} else {
+				fmt.Fprintf(&symbols, "_reserved_%s_start = %s;\n", reservedName, start)
+				start += " + " + reserved.Length
+				fmt.Fprintf(&symbols, "_reserved_%s_end = %s;\n", reservedName, start)
+			}
+		}
+		attributes := region.Attributes
+		if attributes == "" {
+			attributes = "rwx"
+		}
+		fmt.Fprintf(buf, "    %s (%s) : ORIGIN = %s, LENGTH = %s\n", name, attributes, start, length)
+	}
+	buf.WriteString("}\n\n")
+	fmt.Fprintf(buf, "_stack_size = %s;\n\n", stackSize)
+	if symbols.Len() != 0 {
+		buf.WriteString("/* Reserved memory. */\n")
+		buf.Write(symbols.Bytes())
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(buf, "INCLUDE \"%s\"\n", include)
+	return buf.Bytes(), nil
+}
+
+// checkIncludedLinkerScript returns an error if the linker script that is
+// included by the generated one has a MEMORY block. The linker would either
+// reject the duplicate memory regions or silently merge them, so that the
+// memory map in the target specification doesn't take effect.
+func checkIncludedLinkerScript(include, target, root string) error {
+	path := include
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("target %s: could not read linker script: %w", target, err)
+	}
+	if linkerMemory.Match(linkerComment.ReplaceAll(data, nil)) {
+		return fmt.Errorf("target %s: linker script %s has a MEMORY block, which conflicts with the memory map in the target specification", target, include)
+	}
+	return nil
+}
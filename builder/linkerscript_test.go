@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+func TestGenerateLinkerScript(t *testing.T) {
+	spec := &compileopts.TargetSpec{
+		Triple: "thumbv7em-unknown-unknown-eabi",
+		Memory: map[string]*compileopts.MemoryRegion{
+			"FLASH_TEXT": {Origin: "0x00000000", Length: "1M", Attributes: "rw"},
+			"RAM":        {Origin: "0x20000000", Length: "256K", Attributes: "xrw"},
+		},
+		ReservedMemory: map[string]*compileopts.ReservedMemory{
+			"bootloader": {Region: "FLASH_TEXT", Length: "0x4000"},
+			"userdata":   {Region: "FLASH_TEXT", Length: "16K", End: true},
+			"softdevice": {Region: "RAM", Length: "0x39c0"},
+		},
+		MainStackSize: "8K",
+	}
+	script, err := generateLinkerScript(spec, "test", "..")
+	if err != nil {
+		t.Fatal("could not generate linker script:", err)
+	}
+	expected := `/* Generated by TinyGo from the memory map in the target specification. */
+
+MEMORY
+{
+    FLASH_TEXT (rw) : ORIGIN = 0x00000000 + 0x4000, LENGTH = 1M - 0x4000 - 16K
+    RAM (xrw) : ORIGIN = 0x20000000 + 0x39c0, LENGTH = 256K - 0x39c0
+}
+
+_stack_size = 8K;
+
+/* Reserved memory. */
+_reserved_bootloader_start = 0x00000000;
+_reserved_bootloader_end = 0x00000000 + 0x4000;
+_reserved_userdata_start = 0x00000000 + 1M - 16K;
+_reserved_userdata_end = 0x00000000 + 1M;
+_reserved_softdevice_start = 0x20000000;
+_reserved_softdevice_end = 0x20000000 + 0x39c0;
+
+INCLUDE "targets/arm.ld"
+`
+	if string(script) != expected {
+		t.Errorf("unexpected linker script:\n%s", script)
+	}
+
+	// A RISC-V target without reserved memory.
+	spec = &compileopts.TargetSpec{
+		Triple: "riscv32-unknown-none",
+		Memory: map[string]*compileopts.MemoryRegion{
+			"FLASH_TEXT": {Origin: "0x20010000", Length: "0x6a120"},
+			"RAM":        {Origin: "0x80000000", Length: "0x4000"},
+		},
+	}
+	script, err = generateLinkerScript(spec, "test", "..")
+	if err != nil {
+		t.Fatal("could not generate linker script:", err)
+	}
+	if !strings.Contains(string(script), "    RAM (rwx) : ORIGIN = 0x80000000, LENGTH = 0x4000\n") ||
+		!strings.Contains(string(script), "_stack_size = 4K;\n") ||
+		!strings.HasSuffix(string(script), "INCLUDE \"targets/riscv.ld\"\n") {
+		t.Errorf("unexpected linker script:\n%s", script)
+	}
+}
+
+func TestGenerateLinkerScriptErrors(t *testing.T) {
+	tests := []struct {
+		spec *compileopts.TargetSpec
+		err  string
+	}{
+		{&compileopts.TargetSpec{
+			Triple: "thumbv6m-unknown-unknown-eabi",
+			Memory: map[string]*compileopts.MemoryRegion{"RAM": {Origin: "0x20000000", Length: "32 K"}},
+		}, `memory region RAM: invalid length: "32 K"`},
+		{&compileopts.TargetSpec{
+			Triple:         "thumbv6m-unknown-unknown-eabi",
+			Memory:         map[string]*compileopts.MemoryRegion{"RAM": {Origin: "0x20000000", Length: "32K"}},
+			ReservedMemory: map[string]*compileopts.ReservedMemory{"bootloader": {Region: "FLASH", Length: "8K"}},
+		}, `reserved memory bootloader: unknown memory region "FLASH"`},
+		{&compileopts.TargetSpec{
+			Triple: "avr-unknown-unknown",
+			Memory: map[string]*compileopts.MemoryRegion{"RAM": {Origin: "0x100", Length: "2K"}},
+		}, "memory map without a linker script is not supported for avr-unknown-unknown"},
+		{&compileopts.TargetSpec{
+			Triple:       "thumbv6m-unknown-unknown-eabi",
+			LinkerScript: "targets/atsamd21.ld",
+			Memory:       map[string]*compileopts.MemoryRegion{"RAM": {Origin: "0x20000000", Length: "32K"}},
+		}, "target test: linker script targets/atsamd21.ld has a MEMORY block, which conflicts with the memory map in the target specification"},
+	}
+	for _, tc := range tests {
+		_, err := generateLinkerScript(tc.spec, "test", "..")
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
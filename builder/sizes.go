@@ -16,6 +16,7 @@ import (
 	"strings"
 
 	"github.com/aykevl/go-wasm"
+	"github.com/tinygo-org/tinygo/diagnostics"
 	"github.com/tinygo-org/tinygo/goenv"
 )
 
@@ -52,6 +53,26 @@ func (ps *programSize) RAM() uint64 {
 	return ps.Data + ps.BSS
 }
 
+// diagnostics converts the program size for use in -json output. Sizes per
+// package are only included if packages is true.
+func (ps *programSize) diagnostics(packages bool) *diagnostics.Sizes {
+	sizes := &diagnostics.Sizes{
+		Code:   ps.Code,
+		ROData: ps.ROData,
+		Data:   ps.Data,
+		BSS:    ps.BSS,
+		Flash:  ps.Flash(),
+		RAM:    ps.RAM(),
+	}
+	if packages {
+		sizes.Packages = make(map[string]diagnostics.PackageSize, len(ps.Packages))
+		for name, pkgSize := range ps.Packages {
+			sizes.Packages[name] = diagnostics.PackageSize(pkgSize)
+		}
+	}
+	return sizes
+}
+
 // packageSize contains the size of a package, calculated from the linked object
 // file.
 type packageSize struct {
@@ -90,3 +90,66 @@ func TestBinarySize(t *testing.T) {
 		})
 	}
 }
+
+// Test that the typed register field accessors generated by gen-device-svd
+// (Read*/Write* and the *_Value enum types) are zero-cost: after inlining, a
+// program using them must be exactly as big as the same program written with
+// the untyped constants and ReplaceBits.
+func TestRegisterAccessorSize(t *testing.T) {
+	if runtime.GOOS == "linux" && !hasBuiltinTools {
+		t.Skip("Skip: using external LLVM version so binary size might differ")
+	}
+
+	tests := []struct {
+		target string
+		path   string
+	}{
+		{"feather-stm32f405", "./testdata/regaccess-stm32"},
+		{"pca10040", "./testdata/regaccess-nrf"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.target, func(t *testing.T) {
+			t.Parallel()
+
+			raw := buildProgramSize(t, tc.target, tc.path, nil)
+			typed := buildProgramSize(t, tc.target, tc.path, []string{"typed"})
+			if raw.Code != typed.Code || raw.ROData != typed.ROData || raw.Data != typed.Data || raw.BSS != typed.BSS {
+				t.Errorf("Typed register accessors are not zero-cost: -target=%s %s", tc.target, tc.path)
+				t.Errorf("         code rodata   data    bss")
+				t.Errorf("raw:   %6d %6d %6d %6d", raw.Code, raw.ROData, raw.Data, raw.BSS)
+				t.Errorf("typed: %6d %6d %6d %6d", typed.Code, typed.ROData, typed.Data, typed.BSS)
+			}
+		})
+	}
+}
+
+// buildProgramSize builds the given package for the given target with -opt=z
+// and returns the size of the resulting binary.
+func buildProgramSize(t *testing.T, targetName, path string, tags []string) *programSize {
+	options := compileopts.Options{
+		Target:        targetName,
+		Opt:           "z",
+		Tags:          tags,
+		Semaphore:     sema,
+		InterpTimeout: 60 * time.Second,
+		VerifyIR:      true,
+	}
+	target, err := compileopts.LoadTarget(&options)
+	if err != nil {
+		t.Fatal("could not load target:", err)
+	}
+	config := &compileopts.Config{
+		Options: &options,
+		Target:  target,
+	}
+	result, err := Build(path, "", t.TempDir(), config)
+	if err != nil {
+		t.Fatal("could not build:", err)
+	}
+	sizes, err := loadProgramSize(result.Executable, nil)
+	if err != nil {
+		t.Fatal("could not read program size:", err)
+	}
+	return sizes
+}
@@ -0,0 +1,12 @@
+//go:build !typed
+
+package main
+
+import "device/nrf"
+
+func main() {
+	nrf.P0.PIN_CNF[17].ReplaceBits(nrf.GPIO_PIN_CNF_DIR_Output, nrf.GPIO_PIN_CNF_DIR_Msk>>nrf.GPIO_PIN_CNF_DIR_Pos, nrf.GPIO_PIN_CNF_DIR_Pos)
+	nrf.P0.PIN_CNF[17].ReplaceBits(nrf.GPIO_PIN_CNF_PULL_Pullup, nrf.GPIO_PIN_CNF_PULL_Msk>>nrf.GPIO_PIN_CNF_PULL_Pos, nrf.GPIO_PIN_CNF_PULL_Pos)
+	for nrf.P0.IN.Get()&nrf.GPIO_IN_PIN17_Msk>>nrf.GPIO_IN_PIN17_Pos != nrf.GPIO_IN_PIN17_High {
+	}
+}
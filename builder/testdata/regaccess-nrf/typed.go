@@ -0,0 +1,12 @@
+//go:build typed
+
+package main
+
+import "device/nrf"
+
+func main() {
+	nrf.P0.WritePIN_CNF_DIR(17, nrf.GPIO_PIN_CNF_DIR_Value_Output)
+	nrf.P0.WritePIN_CNF_PULL(17, nrf.GPIO_PIN_CNF_PULL_Value_Pullup)
+	for nrf.P0.ReadIN_PIN17() != nrf.GPIO_IN_PIN17_Value_High {
+	}
+}
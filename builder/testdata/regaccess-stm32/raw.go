@@ -0,0 +1,12 @@
+//go:build !typed
+
+package main
+
+import "device/stm32"
+
+func main() {
+	stm32.ADC1.CR1.ReplaceBits(stm32.ADC_CR1_RES_TenBit, stm32.ADC_CR1_RES_Msk>>stm32.ADC_CR1_RES_Pos, stm32.ADC_CR1_RES_Pos)
+	stm32.ADC1.CR2.ReplaceBits(stm32.ADC_CR2_ALIGN_Left, stm32.ADC_CR2_ALIGN_Msk>>stm32.ADC_CR2_ALIGN_Pos, stm32.ADC_CR2_ALIGN_Pos)
+	for stm32.ADC1.CR1.Get()&stm32.ADC_CR1_RES_Msk>>stm32.ADC_CR1_RES_Pos != stm32.ADC_CR1_RES_TenBit {
+	}
+}
@@ -0,0 +1,12 @@
+//go:build typed
+
+package main
+
+import "device/stm32"
+
+func main() {
+	stm32.ADC1.WriteCR1_RES(stm32.ADC_CR1_RES_Value_TenBit)
+	stm32.ADC1.WriteCR2_ALIGN(stm32.ADC_CR2_ALIGN_Value_Left)
+	for stm32.ADC1.ReadCR1_RES() != stm32.ADC_CR1_RES_Value_TenBit {
+	}
+}
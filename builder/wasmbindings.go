@@ -0,0 +1,297 @@
+package builder
+
+// This file generates JavaScript bindings for the functions exported from a
+// WebAssembly module built with -target=wasm: an ES module that wraps every
+// exported function and converts between JavaScript and Go values, and a
+// TypeScript declaration file for it.
+//
+// The wrappers follow the ABI of the WebAssembly exports:
+//   - Strings are passed as a pointer and a length, slices as a pointer, a
+//     length and a capacity. The data is copied to memory obtained from the
+//     exported malloc function, and passed to free after the call. TinyGo's
+//     malloc allocates this memory on the Go heap and free only drops the
+//     reference of the allocator, so the garbage collector keeps the data
+//     alive as long as Go code holds on to the string or slice. Changes Go
+//     makes to a slice after the call returned aren't visible in JavaScript.
+//   - Strings and slices are returned through a pointer passed as the first
+//     parameter, because WebAssembly functions return a single value.
+//   - With the "js" wasm-abi, 64-bit integer parameters are passed by
+//     reference as done by transform.ExternalInt64AsPtr. That pass doesn't
+//     support 64-bit results of exported functions yet.
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// wasmBindingsPrelude is the start of the generated ES module, with the
+// initialization function and helpers shared by all wrappers.
+const wasmBindingsPrelude = `// Code generated by TinyGo. DO NOT EDIT.
+
+// This module needs wasm_exec.js from the TinyGo distribution in the same
+// directory. Call init before calling any other function.
+//
+// Strings and Uint8Arrays are copied into the WebAssembly memory for each call.
+// Go code may keep them after the call returns: the copy belongs to the Go
+// garbage collector.
+
+import "./wasm_exec.js";
+
+const encoder = new TextEncoder();
+const decoder = new TextDecoder();
+
+let go;
+let exports;
+
+// Instantiate the WebAssembly module and run its main function. The source can
+// be a WebAssembly.Module, the bytes of the module, or a (promise of a) fetch
+// Response.
+export async function init(source) {
+	go = new Go();
+	let instance;
+	if (source instanceof WebAssembly.Module) {
+		instance = await WebAssembly.instantiate(source, go.importObject);
+	} else if (source instanceof Promise || (typeof Response !== "undefined" && source instanceof Response)) {
+		instance = (await WebAssembly.instantiateStreaming(source, go.importObject)).instance;
+	} else {
+		instance = (await WebAssembly.instantiate(source, go.importObject)).instance;
+	}
+	exports = instance.exports;
+	go.run(instance);
+	return instance;
+}
+
+function memory() {
+	return new DataView(exports.memory.buffer);
+}
+
+function malloc(size) {
+	const ptr = exports.malloc(size || 1);
+	if (ptr === 0) {
+		throw new Error("out of memory");
+	}
+	return ptr;
+}
+
+function copyIn(bytes) {
+	const ptr = malloc(bytes.length);
+	new Uint8Array(exports.memory.buffer, ptr, bytes.length).set(bytes);
+	return ptr;
+}
+
+function loadString(ptr) {
+	const mem = memory();
+	const data = mem.getUint32(ptr, true);
+	const len = mem.getUint32(ptr + 4, true);
+	return decoder.decode(new Uint8Array(exports.memory.buffer, data, len));
+}
+
+function loadBytes(ptr) {
+	const mem = memory();
+	const data = mem.getUint32(ptr, true);
+	const len = mem.getUint32(ptr + 4, true);
+	return new Uint8Array(exports.memory.buffer, data, len).slice();
+}
+`
+
+// wasmBindingsDeclarationsPrelude is the start of the generated TypeScript
+// declaration file.
+const wasmBindingsDeclarationsPrelude = `// Code generated by TinyGo. DO NOT EDIT.
+
+export function init(source: WebAssembly.Module | BufferSource | Response | Promise<Response>): Promise<WebAssembly.Instance>;
+`
+
+// wasmBindingType describes how a Go type is passed to and from JavaScript.
+type wasmBindingType struct {
+	ts      string // TypeScript type
+	kind    string // "number", "bool", "uint32", "int64", "uint64", "string" or "bytes"
+	retSize int    // size of the memory for a result that is returned by pointer
+}
+
+// generateWasmBindings returns an ES module and a TypeScript declaration file
+// for all functions exported with //export (or //go:export) in the given
+// package. The int64AsPtr parameter must be set when 64-bit integers are
+// passed by reference (the "js" wasm-abi).
+func generateWasmBindings(pkg *types.Package, files []*ast.File, int64AsPtr bool) (js, dts []byte, err error) {
+	jsBuf := &bytes.Buffer{}
+	dtsBuf := &bytes.Buffer{}
+	jsBuf.WriteString(wasmBindingsPrelude)
+	dtsBuf.WriteString(wasmBindingsDeclarationsPrelude)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Body == nil || decl.Recv != nil {
+				continue
+			}
+			name := exportName(decl)
+			if name == "" {
+				continue
+			}
+			fn := pkg.Scope().Lookup(decl.Name.Name)
+			if fn == nil {
+				continue
+			}
+			err := writeWasmBinding(jsBuf, dtsBuf, name, fn.Type().(*types.Signature), int64AsPtr)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot generate bindings for %s: %w", decl.Name.Name, err)
+			}
+		}
+	}
+	return jsBuf.Bytes(), dtsBuf.Bytes(), nil
+}
+
+// writeWasmBinding writes the wrapper and declaration of a single exported
+// function.
+func writeWasmBinding(js, dts *bytes.Buffer, name string, sig *types.Signature, int64AsPtr bool) error {
+	if sig.Variadic() {
+		return fmt.Errorf("variadic functions are not supported")
+	}
+	if sig.Results().Len() > 1 {
+		return fmt.Errorf("multiple return values are not supported")
+	}
+
+	var params, tsParams, args, setup, cleanup []string
+	for i := 0; i < sig.Params().Len(); i++ {
+		param := sig.Params().At(i)
+		typ, err := wasmBindingTypeOf(param.Type())
+		if err != nil {
+			return err
+		}
+		paramName := param.Name()
+		if paramName == "" || paramName == "_" {
+			paramName = fmt.Sprintf("p%d", i)
+		}
+		params = append(params, paramName)
+		tsParams = append(tsParams, paramName+": "+typ.ts)
+		switch typ.kind {
+		case "number", "uint32":
+			args = append(args, paramName)
+		case "bool":
+			args = append(args, paramName+" ? 1 : 0")
+		case "int64", "uint64":
+			if !int64AsPtr {
+				args = append(args, "BigInt("+paramName+")")
+				break
+			}
+			setter := "setBigInt64"
+			if typ.kind == "uint64" {
+				setter = "setBigUint64"
+			}
+			setup = append(setup,
+				fmt.Sprintf("const %s_ptr = malloc(8);", paramName),
+				fmt.Sprintf("memory().%s(%s_ptr, BigInt(%s), true);", setter, paramName, paramName))
+			args = append(args, paramName+"_ptr")
+			cleanup = append(cleanup, fmt.Sprintf("exports.free(%s_ptr);", paramName))
+		case "string":
+			setup = append(setup,
+				fmt.Sprintf("const %s_bytes = encoder.encode(%s);", paramName, paramName),
+				fmt.Sprintf("const %s_ptr = copyIn(%s_bytes);", paramName, paramName))
+			args = append(args, paramName+"_ptr", paramName+"_bytes.length")
+			cleanup = append(cleanup, fmt.Sprintf("exports.free(%s_ptr);", paramName))
+		case "bytes":
+			// Copy the data back afterwards, so that changes made by Go are
+			// visible in JavaScript.
+			setup = append(setup, fmt.Sprintf("const %s_ptr = copyIn(%s);", paramName, paramName))
+			args = append(args, paramName+"_ptr", paramName+".length", paramName+".length")
+			cleanup = append(cleanup,
+				fmt.Sprintf("%s.set(new Uint8Array(exports.memory.buffer, %s_ptr, %s.length));", paramName, paramName, paramName),
+				fmt.Sprintf("exports.free(%s_ptr);", paramName))
+		}
+	}
+
+	tsResult := "void"
+	result := ""
+	if sig.Results().Len() == 1 {
+		typ, err := wasmBindingTypeOf(sig.Results().At(0).Type())
+		if err != nil {
+			return err
+		}
+		if int64AsPtr && (typ.kind == "int64" || typ.kind == "uint64") {
+			return fmt.Errorf("returning a 64-bit integer is not supported with the js wasm-abi")
+		}
+		tsResult = typ.ts
+		if typ.retSize != 0 {
+			setup = append(setup, fmt.Sprintf("const result_ptr = malloc(%d);", typ.retSize))
+			args = append([]string{"result_ptr"}, args...)
+			cleanup = append(cleanup, "exports.free(result_ptr);")
+		}
+		switch typ.kind {
+		case "number":
+			result = "result"
+		case "uint32":
+			result = "result >>> 0"
+		case "bool":
+			result = "result !== 0"
+		case "int64":
+			result = "result"
+		case "uint64":
+			result = "BigInt.asUintN(64, result)"
+		case "string":
+			result = "loadString(result_ptr)"
+		case "bytes":
+			result = "loadBytes(result_ptr)"
+		}
+	}
+
+	fmt.Fprintf(dts, "export function %s(%s): %s;\n", name, strings.Join(tsParams, ", "), tsResult)
+
+	fmt.Fprintf(js, "\nexport function %s(%s) {\n", name, strings.Join(params, ", "))
+	indent := "\t"
+	for _, line := range setup {
+		js.WriteString(indent + line + "\n")
+	}
+	if len(cleanup) != 0 {
+		js.WriteString(indent + "try {\n")
+		indent = "\t\t"
+	}
+	call := fmt.Sprintf("exports.%s(%s)", name, strings.Join(args, ", "))
+	switch {
+	case result == "":
+		js.WriteString(indent + call + ";\n")
+	case strings.Contains(result, "result_ptr"):
+		js.WriteString(indent + call + ";\n")
+		js.WriteString(indent + "return " + result + ";\n")
+	default:
+		js.WriteString(indent + "const result = " + call + ";\n")
+		js.WriteString(indent + "return " + result + ";\n")
+	}
+	if len(cleanup) != 0 {
+		js.WriteString("\t} finally {\n")
+		for _, line := range cleanup {
+			js.WriteString("\t\t" + line + "\n")
+		}
+		js.WriteString("\t}\n")
+	}
+	js.WriteString("}\n")
+	return nil
+}
+
+// wasmBindingTypeOf returns how the given Go type is passed between Go and
+// JavaScript.
+func wasmBindingTypeOf(t types.Type) (wasmBindingType, error) {
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		switch t.Kind() {
+		case types.Bool:
+			return wasmBindingType{ts: "boolean", kind: "bool"}, nil
+		case types.Int, types.Int8, types.Int16, types.Int32, types.Uint8, types.Uint16, types.Float32, types.Float64:
+			return wasmBindingType{ts: "number", kind: "number"}, nil
+		case types.Uint, types.Uint32, types.Uintptr:
+			return wasmBindingType{ts: "number", kind: "uint32"}, nil
+		case types.Int64:
+			return wasmBindingType{ts: "bigint", kind: "int64"}, nil
+		case types.Uint64:
+			return wasmBindingType{ts: "bigint", kind: "uint64"}, nil
+		case types.String:
+			return wasmBindingType{ts: "string", kind: "string", retSize: 8}, nil
+		}
+	case *types.Slice:
+		if elem, ok := t.Elem().Underlying().(*types.Basic); ok && elem.Kind() == types.Uint8 {
+			return wasmBindingType{ts: "Uint8Array", kind: "bytes", retSize: 12}, nil
+		}
+	}
+	return wasmBindingType{}, fmt.Errorf("type %s is not supported", t.String())
+}
@@ -0,0 +1,104 @@
+package builder
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestGenerateWasmBindings(t *testing.T) {
+	const src = `package main
+
+//export add
+func add(a, b int32) int32 {
+	return a + b
+}
+
+//export greet
+func greet(name string, loud bool) string {
+	return "hello " + name
+}
+
+//export fill
+func fill(buf []byte, count uint32) {
+}
+
+//export mul64
+func mul64(a int64, _ uint64) {
+}
+
+//export notify
+func notify()
+
+func main() {
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := types.Config{Importer: importer.Default()}
+	pkg, err := config.Check("main", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, dts, err := generateWasmBindings(pkg, []*ast.File{file}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"export function add(a: number, b: number): number;\n",
+		"export function greet(name: string, loud: boolean): string;\n",
+		"export function fill(buf: Uint8Array, count: number): void;\n",
+		"export function mul64(a: bigint, p1: bigint): void;\n",
+	} {
+		if !strings.Contains(string(dts), line) {
+			t.Errorf("declarations do not contain %q:\n%s", line, dts)
+		}
+	}
+	for _, line := range []string{
+		"\tconst result = exports.add(a, b);\n",
+		"\t\texports.greet(result_ptr, name_ptr, name_bytes.length, loud ? 1 : 0);\n",
+		"\t\treturn loadString(result_ptr);\n",
+		"\t\texports.fill(buf_ptr, buf.length, buf.length, count);\n",
+		"\tmemory().setBigUint64(p1_ptr, BigInt(p1), true);\n",
+	} {
+		if !strings.Contains(string(js), line) {
+			t.Errorf("module does not contain %q:\n%s", line, js)
+		}
+	}
+	if strings.Contains(string(js), "notify") {
+		t.Errorf("module contains imported function notify:\n%s", js)
+	}
+}
+
+func TestWasmBindingErrors(t *testing.T) {
+	pkg := types.NewPackage("main", "main")
+	newSig := func(params, results []types.Type) *types.Signature {
+		var paramVars, resultVars []*types.Var
+		for _, t := range params {
+			paramVars = append(paramVars, types.NewParam(token.NoPos, pkg, "", t))
+		}
+		for _, t := range results {
+			resultVars = append(resultVars, types.NewParam(token.NoPos, pkg, "", t))
+		}
+		return types.NewSignatureType(nil, nil, nil, types.NewTuple(paramVars...), types.NewTuple(resultVars...), false)
+	}
+	for _, sig := range []*types.Signature{
+		newSig(nil, []types.Type{types.Typ[types.Int64]}),
+		newSig(nil, []types.Type{types.Typ[types.Int], types.Typ[types.Int]}),
+		newSig([]types.Type{types.NewSlice(types.Typ[types.Int])}, nil),
+		newSig([]types.Type{types.NewPointer(types.Typ[types.Int])}, nil),
+	} {
+		var js, dts bytes.Buffer
+		if err := writeWasmBinding(&js, &dts, "f", sig, true); err == nil {
+			t.Errorf("expected an error for %s", sig)
+		}
+	}
+}
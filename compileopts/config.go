@@ -76,6 +76,10 @@ func (c *Config) GOARM() string {
 // BuildTags returns the complete list of build tags used during this build.
 func (c *Config) BuildTags() []string {
 	tags := append(c.Target.BuildTags, []string{"tinygo", "math_big_pure_go", "gc." + c.GC(), "scheduler." + c.Scheduler(), "serial." + c.Serial()}...)
+	if c.BuildMode() != "default" {
+		// Build tags can't contain a dash, so c-archive becomes c_archive.
+		tags = append(tags, "buildmode."+strings.ReplaceAll(c.BuildMode(), "-", "_"))
+	}
 	for i := 1; i <= c.GoMinorVersion; i++ {
 		tags = append(tags, fmt.Sprintf("go1.%d", i))
 	}
@@ -90,7 +94,7 @@ func (c *Config) CgoEnabled() bool {
 }
 
 // GC returns the garbage collection strategy in use on this platform. Valid
-// values are "none", "leaking", "conservative" and "precise".
+// values are "none", "leaking", "conservative", "precise" and "incremental".
 func (c *Config) GC() string {
 	if c.Options.GC != "" {
 		return c.Options.GC
@@ -105,7 +109,7 @@ func (c *Config) GC() string {
 // that can be traced by the garbage collector.
 func (c *Config) NeedsStackObjects() bool {
 	switch c.GC() {
-	case "conservative", "custom", "precise":
+	case "conservative", "custom", "precise", "incremental":
 		for _, tag := range c.BuildTags() {
 			if tag == "tinygo.wasm" {
 				return true
@@ -118,12 +122,50 @@ func (c *Config) NeedsStackObjects() bool {
 	}
 }
 
+// NeedsWriteBarriers returns true if the compiler should insert write barriers
+// after pointer stores, for the incremental GC.
+func (c *Config) NeedsWriteBarriers() bool {
+	return c.GC() == "incremental"
+}
+
+// BuildMode returns the kind of output file: "default" for an executable,
+// "c-archive" for a static library or "c-shared" for a shared library.
+func (c *Config) BuildMode() string {
+	if c.Options.BuildMode != "" {
+		return c.Options.BuildMode
+	}
+	return "default"
+}
+
+// IsLibrary returns whether the output is a native C library (c-archive or
+// c-shared) instead of an executable.
+func (c *Config) IsLibrary() bool {
+	mode := c.BuildMode()
+	return (mode == "c-archive" || mode == "c-shared") && !c.isWebAssembly()
+}
+
+// IsWasmReactor returns whether the output is a WebAssembly reactor module
+// (-buildmode=c-shared), which exports _initialize instead of _start.
+func (c *Config) IsWasmReactor() bool {
+	return c.BuildMode() == "c-shared" && c.isWebAssembly()
+}
+
+// isWebAssembly returns whether this configuration targets WebAssembly.
+func (c *Config) isWebAssembly() bool {
+	return strings.HasPrefix(c.Triple(), "wasm")
+}
+
 // Scheduler returns the scheduler implementation. Valid values are "none",
 // "asyncify" and "tasks".
 func (c *Config) Scheduler() string {
 	if c.Options.Scheduler != "" {
 		return c.Options.Scheduler
 	}
+	if c.IsLibrary() {
+		// Exported functions are called on a foreign (C) stack, which doesn't
+		// work with goroutine stack switching.
+		return "none"
+	}
 	if c.Target.Scheduler != "" {
 		return c.Target.Scheduler
 	}
@@ -237,6 +279,14 @@ func (c *Config) LibcPath(name string) (path string, precompiled bool) {
 // DefaultBinaryExtension returns the default extension for binaries, such as
 // .exe, .wasm, or no extension (depending on the target).
 func (c *Config) DefaultBinaryExtension() string {
+	if c.IsLibrary() {
+		switch c.BuildMode() {
+		case "c-archive":
+			return ".a"
+		case "c-shared":
+			return ".so"
+		}
+	}
 	parts := strings.Split(c.Triple(), "-")
 	if parts[0] == "wasm32" {
 		// WebAssembly files always have the .wasm file extension.
@@ -315,6 +365,10 @@ func (c *Config) CFlags() []string {
 	cflags = append(cflags, "-O"+c.Options.Opt)
 	// Set the LLVM target triple.
 	cflags = append(cflags, "--target="+c.Triple())
+	if c.IsLibrary() {
+		// C code ends up in the library as well.
+		cflags = append(cflags, "-fPIC")
+	}
 	// Set the -mcpu (or similar) flag.
 	if c.Target.CPU != "" {
 		if c.GOARCH() == "amd64" || c.GOARCH() == "386" {
@@ -346,7 +400,9 @@ func (c *Config) LDFlags() []string {
 		ldflags = append(ldflags, strings.ReplaceAll(flag, "{root}", root))
 	}
 	ldflags = append(ldflags, "-L", root)
-	if c.Target.LinkerScript != "" {
+	if c.Target.LinkerScript != "" && len(c.Target.Memory) == 0 {
+		// With a memory map, the linker script is generated by the builder
+		// and includes the target linker script.
 		ldflags = append(ldflags, "-T", c.Target.LinkerScript)
 	}
 	return ldflags
@@ -485,6 +541,11 @@ func (c *Config) CodeModel() string {
 // RelocationModel returns the relocation model in use on this platform. Valid
 // values are "static", "pic", "dynamicnopic".
 func (c *Config) RelocationModel() string {
+	if c.IsLibrary() {
+		// Libraries may be linked into position-independent executables or
+		// loaded at any address.
+		return "pic"
+	}
 	if c.Target.RelocationModel != "" {
 		return c.Target.RelocationModel
 	}
@@ -2,18 +2,22 @@ package compileopts
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/tinygo-org/tinygo/diagnostics"
 )
 
 var (
-	validGCOptions            = []string{"none", "leaking", "conservative", "custom", "precise"}
+	validGCOptions            = []string{"none", "leaking", "conservative", "custom", "precise", "incremental"}
 	validSchedulerOptions     = []string{"none", "tasks", "asyncify"}
 	validSerialOptions        = []string{"none", "uart", "usb"}
 	validPrintSizeOptions     = []string{"none", "short", "full"}
 	validPanicStrategyOptions = []string{"print", "trap"}
 	validOptOptions           = []string{"none", "0", "1", "2", "s", "z"}
+	validBuildModeOptions     = []string{"default", "c-archive", "c-shared"}
 )
 
 // Options contains extra options to give to the compiler. These options are
@@ -25,6 +29,7 @@ type Options struct {
 	GOARM           string // environment variable (only used with GOARCH=arm)
 	Target          string
 	Opt             string
+	BuildMode       string
 	GC              string
 	PanicStrategy   string
 	Scheduler       string
@@ -42,6 +47,9 @@ type Options struct {
 	PrintSizes      string
 	PrintAllocs     *regexp.Regexp // regexp string
 	PrintStacks     bool
+	AllocReport     string         // -alloc-report file (.json or .html)
+	MaxAllocs       map[string]int // maximum number of heap allocations per package pattern
+	WasmBindings    bool           // -wasm-bindings flag to generate JavaScript bindings
 	Tags            []string
 	GlobalValues    map[string]map[string]string // map[pkgpath]map[varname]value
 	TestConfig      TestConfig
@@ -50,6 +58,7 @@ type Options struct {
 	LLVMFeatures    string
 	Directory       string
 	PrintJSON       bool
+	Events          *diagnostics.Writer `json:"-"` // -json output of build, run, flash and test
 	Monitor         bool
 	BaudRate        int
 	Timeout         time.Duration
@@ -108,6 +117,27 @@ func (o *Options) Verify() error {
 		}
 	}
 
+	if o.AllocReport != "" {
+		if ext := filepath.Ext(o.AllocReport); ext != ".json" && ext != ".html" {
+			return fmt.Errorf("invalid -alloc-report=%s: the file extension must be .json or .html", o.AllocReport)
+		}
+	}
+
+	for pattern, max := range o.MaxAllocs {
+		if max < 0 {
+			return fmt.Errorf("invalid -max-allocs for %s: %d is negative", pattern, max)
+		}
+	}
+
+	if o.BuildMode != "" {
+		if !isInArray(validBuildModeOptions, o.BuildMode) {
+			return fmt.Errorf("invalid -buildmode=%s: valid values are %s", o.BuildMode, strings.Join(validBuildModeOptions, ", "))
+		}
+		if o.BuildMode != "default" && o.Scheduler != "" && o.Scheduler != "none" {
+			return fmt.Errorf("-buildmode=%s does not support -scheduler=%s", o.BuildMode, o.Scheduler)
+		}
+	}
+
 	return nil
 }
 
@@ -9,10 +9,13 @@ import (
 
 func TestVerifyOptions(t *testing.T) {
 
-	expectedGCError := errors.New(`invalid gc option 'incorrect': valid values are none, leaking, conservative, custom, precise`)
+	expectedGCError := errors.New(`invalid gc option 'incorrect': valid values are none, leaking, conservative, custom, precise, incremental`)
 	expectedSchedulerError := errors.New(`invalid scheduler option 'incorrect': valid values are none, tasks, asyncify`)
 	expectedPrintSizeError := errors.New(`invalid size option 'incorrect': valid values are none, short, full`)
 	expectedPanicStrategyError := errors.New(`invalid panic option 'incorrect': valid values are print, trap`)
+	expectedBuildModeError := errors.New(`invalid -buildmode=incorrect: valid values are default, c-archive, c-shared`)
+	expectedBuildModeSchedulerError := errors.New(`-buildmode=c-shared does not support -scheduler=tasks`)
+	expectedAllocReportError := errors.New(`invalid -alloc-report=allocs.txt: the file extension must be .json or .html`)
 
 	testCases := []struct {
 		name          string
@@ -54,6 +57,12 @@ func TestVerifyOptions(t *testing.T) {
 				GC: "custom",
 			},
 		},
+		{
+			name: "GCOptionIncremental",
+			opts: compileopts.Options{
+				GC: "incremental",
+			},
+		},
 		{
 			name: "InvalidSchedulerOption",
 			opts: compileopts.Options{
@@ -117,6 +126,47 @@ func TestVerifyOptions(t *testing.T) {
 				PanicStrategy: "trap",
 			},
 		},
+		{
+			name: "InvalidBuildModeOption",
+			opts: compileopts.Options{
+				BuildMode: "incorrect",
+			},
+			expectedError: expectedBuildModeError,
+		},
+		{
+			name: "BuildModeOptionCArchive",
+			opts: compileopts.Options{
+				BuildMode: "c-archive",
+			},
+		},
+		{
+			name: "BuildModeOptionCSharedSchedulerNone",
+			opts: compileopts.Options{
+				BuildMode: "c-shared",
+				Scheduler: "none",
+			},
+		},
+		{
+			name: "BuildModeOptionCSharedSchedulerTasks",
+			opts: compileopts.Options{
+				BuildMode: "c-shared",
+				Scheduler: "tasks",
+			},
+			expectedError: expectedBuildModeSchedulerError,
+		},
+		{
+			name: "AllocReportHTML",
+			opts: compileopts.Options{
+				AllocReport: "allocs.html",
+			},
+		},
+		{
+			name: "AllocReportInvalidFormat",
+			opts: compileopts.Options{
+				AllocReport: "allocs.txt",
+			},
+			expectedError: expectedAllocReportError,
+		},
 	}
 
 	for _, tc := range testCases {
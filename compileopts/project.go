@@ -0,0 +1,201 @@
+package compileopts
+
+// This file loads the project configuration file (tinygo.yaml), which holds
+// compiler flags for a project so they don't have to be repeated on every
+// invocation.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ProjectFileName is the name of the project configuration file. It is looked
+// up in the current directory and its parents, up to the directory with the
+// go.mod file.
+const ProjectFileName = "tinygo.yaml"
+
+// Project is a project configuration file. The settings at the top level apply
+// to all variants, a variant can override them:
+//
+//	target: pico
+//	opt: z
+//	max-allocs:
+//	  example.com/firmware/drivers/...: 0
+//	default: prod
+//	variants:
+//	  prod:
+//	    tags: [prod]
+//	  debug-qemu:
+//	    target: cortex-m-qemu
+//	    opt: 1
+type Project struct {
+	Path     string              `yaml:"-"`       // path of the project file
+	Default  string              `yaml:"default"` // variant to use when none is selected
+	Variants map[string]*Variant `yaml:"variants"`
+	Variant  `yaml:",inline"`
+}
+
+// Variant is a named set of compiler options in the project file. Every field
+// corresponds to the command line flag of the same name.
+type Variant struct {
+	Target    string         `yaml:"target"`
+	GC        string         `yaml:"gc"`
+	Scheduler string         `yaml:"scheduler"`
+	Serial    string         `yaml:"serial"`
+	Opt       string         `yaml:"opt"`
+	Panic     string         `yaml:"panic"`
+	Tags      []string       `yaml:"tags"`
+	LDFlags   string         `yaml:"ldflags"`
+	StackSize string         `yaml:"stack-size"`
+	NoDebug   *bool          `yaml:"no-debug"`
+	MaxAllocs map[string]int `yaml:"max-allocs"`
+}
+
+// LoadProject looks for a project file in dir and its parent directories, up
+// to the directory containing go.mod. It returns nil (and no error) when there
+// is no project file.
+func LoadProject(dir string) (*Project, error) {
+	root, err := ProjectDir(dir)
+	if err != nil || root == "" {
+		return nil, err
+	}
+	path := filepath.Join(root, ProjectFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Module root without a project file.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	project := &Project{Path: path}
+	err = yaml.UnmarshalStrict(data, project)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if project.Default != "" && project.Variants[project.Default] == nil {
+		return nil, fmt.Errorf("%s: default variant %q does not exist", path, project.Default)
+	}
+	return project, nil
+}
+
+// ProjectDir returns the directory of the project that dir belongs to: the
+// first directory, starting at dir and going up, that contains a project file
+// or a go.mod file. It returns the empty string if there is no such directory.
+func ProjectDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range []string{ProjectFileName, "go.mod"} {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if err == nil {
+				return dir, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Resolve returns the settings of the given variant, merged with the settings
+// at the top level of the project file. An empty name selects the default
+// variant, or only the top-level settings when there is no default.
+func (p *Project) Resolve(name string) (*Variant, error) {
+	if name == "" {
+		name = p.Default
+	}
+	resolved := p.Variant
+	resolved.Tags = append([]string(nil), p.Tags...)
+	resolved.MaxAllocs = map[string]int{}
+	for pattern, max := range p.MaxAllocs {
+		resolved.MaxAllocs[pattern] = max
+	}
+	if name == "" {
+		return &resolved, nil
+	}
+	variant := p.Variants[name]
+	if variant == nil {
+		return nil, fmt.Errorf("%s: unknown variant %q, available variants: %s", p.Path, name, strings.Join(p.VariantNames(), ", "))
+	}
+	for _, field := range []struct{ dst, src *string }{
+		{&resolved.Target, &variant.Target},
+		{&resolved.GC, &variant.GC},
+		{&resolved.Scheduler, &variant.Scheduler},
+		{&resolved.Serial, &variant.Serial},
+		{&resolved.Opt, &variant.Opt},
+		{&resolved.Panic, &variant.Panic},
+		{&resolved.LDFlags, &variant.LDFlags},
+		{&resolved.StackSize, &variant.StackSize},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	if variant.NoDebug != nil {
+		resolved.NoDebug = variant.NoDebug
+	}
+	resolved.Tags = append(resolved.Tags, variant.Tags...)
+	for pattern, max := range variant.MaxAllocs {
+		resolved.MaxAllocs[pattern] = max
+	}
+	return &resolved, nil
+}
+
+// VariantNames returns the names of all variants, sorted.
+func (p *Project) VariantNames() []string {
+	var names []string
+	for name := range p.Variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flags returns the settings of the variant as command line flag values,
+// indexed by flag name. Settings that are not set are left out.
+func (v *Variant) Flags() map[string]string {
+	flags := map[string]string{}
+	for name, value := range map[string]string{
+		"target":     v.Target,
+		"gc":         v.GC,
+		"scheduler":  v.Scheduler,
+		"serial":     v.Serial,
+		"opt":        v.Opt,
+		"panic":      v.Panic,
+		"tags":       strings.Join(v.Tags, " "),
+		"ldflags":    v.LDFlags,
+		"stack-size": v.StackSize,
+	} {
+		if value != "" {
+			flags[name] = value
+		}
+	}
+	if v.NoDebug != nil {
+		flags["no-debug"] = strconv.FormatBool(*v.NoDebug)
+	}
+	if len(v.MaxAllocs) != 0 {
+		var budgets []string
+		for pattern, max := range v.MaxAllocs {
+			budgets = append(budgets, pattern+"="+strconv.Itoa(max))
+		}
+		sort.Strings(budgets)
+		flags["max-allocs"] = strings.Join(budgets, ",")
+	}
+	return flags
+}
@@ -0,0 +1,109 @@
+package compileopts
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadProject(t *testing.T) {
+	root := t.TempDir()
+	const projectFile = `
+target: pico
+opt: z
+tags: [board]
+max-allocs:
+  example.com/app/drivers/...: 0
+default: prod
+variants:
+  prod:
+    tags: [prod]
+    ldflags: -X main.version=1.0
+    max-allocs:
+      example.com/app: 2
+  debug-qemu:
+    target: cortex-m-qemu
+    opt: 1
+    no-debug: false
+`
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/app\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ProjectFileName), []byte(projectFile), 0666); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(root, "cmd", "app")
+	if err := os.MkdirAll(subdir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	// The project file is found from a subdirectory of the module.
+	project, err := LoadProject(subdir)
+	if err != nil {
+		t.Fatal("could not load project:", err)
+	}
+	if project == nil || project.Path != filepath.Join(root, ProjectFileName) {
+		t.Fatalf("project file not found: %v", project)
+	}
+	if names := project.VariantNames(); !reflect.DeepEqual(names, []string{"debug-qemu", "prod"}) {
+		t.Errorf("unexpected variants: %v", names)
+	}
+
+	// No variant selected: use the default variant.
+	variant, err := project.Resolve("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"target":     "pico",
+		"opt":        "z",
+		"tags":       "board prod",
+		"ldflags":    "-X main.version=1.0",
+		"max-allocs": "example.com/app/drivers/...=0,example.com/app=2",
+	}
+	if flags := variant.Flags(); !reflect.DeepEqual(flags, expected) {
+		t.Errorf("unexpected flags for default variant: %v", flags)
+	}
+
+	variant, err = project.Resolve("debug-qemu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]string{
+		"target":     "cortex-m-qemu",
+		"opt":        "1",
+		"tags":       "board",
+		"no-debug":   "false",
+		"max-allocs": "example.com/app/drivers/...=0",
+	}
+	if flags := variant.Flags(); !reflect.DeepEqual(flags, expected) {
+		t.Errorf("unexpected flags for debug-qemu: %v", flags)
+	}
+
+	_, err = project.Resolve("nonexistent")
+	if err == nil || err.Error() != project.Path+`: unknown variant "nonexistent", available variants: debug-qemu, prod` {
+		t.Errorf("unexpected error for unknown variant: %v", err)
+	}
+
+	// A project file isn't looked up outside of the module.
+	nested := filepath.Join(root, "nested")
+	if err := os.MkdirAll(nested, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(nested, "go.mod"), []byte("module example.com/nested\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	project, err = LoadProject(nested)
+	if err != nil || project != nil {
+		t.Errorf("expected no project file, got %v (error: %v)", project, err)
+	}
+
+	// Unknown keys are an error, to catch typos.
+	if err := os.WriteFile(filepath.Join(nested, ProjectFileName), []byte("schedular: tasks\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProject(nested); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
@@ -0,0 +1,239 @@
+package compileopts
+
+// This file validates target specifications against the JSON schema in
+// target-schema.json. Only the parts of JSON Schema that are used in that file
+// are implemented.
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The schema is part of the TinyGo binary instead of the targets directory, so
+// that it can't be confused with a target.
+//
+//go:embed target-schema.json
+var targetSchemaJSON []byte
+
+// jsonSchema is a (subset of a) JSON Schema.
+type jsonSchema struct {
+	Type                 schemaType             `json:"type"`
+	Enum                 []string               `json:"enum"`
+	Pattern              string                 `json:"pattern"`
+	Minimum              *float64               `json:"minimum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaType is the "type" keyword, which is either a single type or a list
+// of types.
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = schemaType{name}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// additionalProperties is the "additionalProperties" keyword, which is either
+// a boolean or a schema.
+type additionalProperties struct {
+	Allowed bool
+	Schema  *jsonSchema
+}
+
+func (p *additionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &p.Allowed); err == nil {
+		return nil
+	}
+	p.Allowed = true
+	p.Schema = &jsonSchema{}
+	return json.Unmarshal(data, p.Schema)
+}
+
+var (
+	targetSchema     *jsonSchema
+	targetSchemaErr  error
+	targetSchemaOnce sync.Once
+)
+
+// loadTargetSchema returns the schema for target specifications.
+func loadTargetSchema() (*jsonSchema, error) {
+	targetSchemaOnce.Do(func() {
+		schema := &jsonSchema{}
+		if err := json.Unmarshal(targetSchemaJSON, schema); err != nil {
+			targetSchemaErr = fmt.Errorf("target schema: %w", err)
+			return
+		}
+		if err := schema.compile(); err != nil {
+			targetSchemaErr = fmt.Errorf("target schema: %w", err)
+			return
+		}
+		targetSchema = schema
+	})
+	return targetSchema, targetSchemaErr
+}
+
+// compile compiles the regular expressions in the schema.
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = pattern
+	}
+	subschemas := []*jsonSchema{s.Items}
+	for _, prop := range s.Properties {
+		subschemas = append(subschemas, prop)
+	}
+	if s.AdditionalProperties != nil {
+		subschemas = append(subschemas, s.AdditionalProperties.Schema)
+	}
+	for _, subschema := range subschemas {
+		if subschema == nil {
+			continue
+		}
+		if err := subschema.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTarget checks the JSON of a target specification against the
+// target schema. Unknown properties are not an error, as custom targets may
+// contain properties of newer TinyGo versions or of other tools: they are
+// returned as warnings instead.
+func validateTarget(data []byte) (warnings []string, err error) {
+	schema, err := loadTargetSchema()
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	err = schema.validate(value, "", &warnings)
+	return warnings, err
+}
+
+// validate returns an error if value doesn't match the schema. The path is
+// the location of the value in the document, for error and warning messages.
+func (s *jsonSchema) validate(value interface{}, path string, warnings *[]string) error {
+	name := path
+	if name == "" {
+		name = "target"
+	}
+	if len(s.Type) != 0 {
+		typ := jsonTypeOf(value)
+		valid := false
+		for _, t := range s.Type {
+			if t == typ || (t == "number" && typ == "integer") {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%s: expected %s, got %s", name, strings.Join(s.Type, " or "), typ)
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		if len(s.Enum) != 0 && !isInArray(s.Enum, value) {
+			return fmt.Errorf("%s: invalid value %q, must be one of: %s", name, value, strings.Join(s.Enum, ", "))
+		}
+		if s.pattern != nil {
+			if !s.pattern.MatchString(value) {
+				return fmt.Errorf("%s: invalid value %q", name, value)
+			}
+		}
+	case json.Number:
+		if s.Minimum != nil {
+			n, err := value.Float64()
+			if err != nil || n < *s.Minimum {
+				return fmt.Errorf("%s: must be at least %v", name, *s.Minimum)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), warnings); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := value[key]; !ok {
+				return fmt.Errorf("%s: missing property %q", name, key)
+			}
+		}
+		// Check properties in a stable order, so that errors are the same
+		// every time.
+		var keys []string
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			propPath := key
+			if path != "" {
+				propPath = path + "." + key
+			}
+			propSchema := s.Properties[key]
+			if propSchema == nil && s.AdditionalProperties != nil {
+				if !s.AdditionalProperties.Allowed {
+					*warnings = append(*warnings, fmt.Sprintf("%s: unknown property %q", name, key))
+					continue
+				}
+				propSchema = s.AdditionalProperties.Schema
+			}
+			if propSchema == nil {
+				continue
+			}
+			if err := propSchema.validate(value[key], propPath, warnings); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonTypeOf returns the JSON Schema type name of a decoded JSON value.
+func jsonTypeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
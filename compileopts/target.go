@@ -7,12 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/tinygo-org/tinygo/goenv"
 )
@@ -23,46 +25,67 @@ import (
 // https://doc.rust-lang.org/nightly/nightly-rustc/rustc_target/spec/struct.TargetOptions.html
 // https://github.com/shepmaster/rust-arduino-blink-led-no-core-with-cargo/blob/master/blink/arduino.json
 type TargetSpec struct {
-	Inherits         []string `json:"inherits"`
-	Triple           string   `json:"llvm-target"`
-	CPU              string   `json:"cpu"`
-	ABI              string   `json:"target-abi"` // rougly equivalent to -mabi= flag
-	Features         string   `json:"features"`
-	GOOS             string   `json:"goos"`
-	GOARCH           string   `json:"goarch"`
-	BuildTags        []string `json:"build-tags"`
-	GC               string   `json:"gc"`
-	Scheduler        string   `json:"scheduler"`
-	Serial           string   `json:"serial"` // which serial output to use (uart, usb, none)
-	Linker           string   `json:"linker"`
-	RTLib            string   `json:"rtlib"` // compiler runtime library (libgcc, compiler-rt)
-	Libc             string   `json:"libc"`
-	AutoStackSize    *bool    `json:"automatic-stack-size"` // Determine stack size automatically at compile time.
-	DefaultStackSize uint64   `json:"default-stack-size"`   // Default stack size if the size couldn't be determined at compile time.
-	CFlags           []string `json:"cflags"`
-	LDFlags          []string `json:"ldflags"`
-	LinkerScript     string   `json:"linkerscript"`
-	ExtraFiles       []string `json:"extra-files"`
-	RP2040BootPatch  *bool    `json:"rp2040-boot-patch"` // Patch RP2040 2nd stage bootloader checksum
-	Emulator         string   `json:"emulator"`
-	FlashCommand     string   `json:"flash-command"`
-	GDB              []string `json:"gdb"`
-	PortReset        string   `json:"flash-1200-bps-reset"`
-	SerialPort       []string `json:"serial-port"` // serial port IDs in the form "vid:pid"
-	FlashMethod      string   `json:"flash-method"`
-	FlashVolume      []string `json:"msd-volume-name"`
-	FlashFilename    string   `json:"msd-firmware-name"`
-	UF2FamilyID      string   `json:"uf2-family-id"`
-	BinaryFormat     string   `json:"binary-format"`
-	OpenOCDInterface string   `json:"openocd-interface"`
-	OpenOCDTarget    string   `json:"openocd-target"`
-	OpenOCDTransport string   `json:"openocd-transport"`
-	OpenOCDCommands  []string `json:"openocd-commands"`
-	OpenOCDVerify    *bool    `json:"openocd-verify"` // enable verify when flashing with openocd
-	JLinkDevice      string   `json:"jlink-device"`
-	CodeModel        string   `json:"code-model"`
-	RelocationModel  string   `json:"relocation-model"`
-	WasmAbi          string   `json:"wasm-abi"`
+	Inherits         []string                   `json:"inherits"`
+	Triple           string                     `json:"llvm-target"`
+	CPU              string                     `json:"cpu"`
+	ABI              string                     `json:"target-abi"` // rougly equivalent to -mabi= flag
+	Features         string                     `json:"features"`
+	GOOS             string                     `json:"goos"`
+	GOARCH           string                     `json:"goarch"`
+	BuildTags        []string                   `json:"build-tags"`
+	GC               string                     `json:"gc"`
+	Scheduler        string                     `json:"scheduler"`
+	Serial           string                     `json:"serial"` // which serial output to use (uart, usb, none)
+	Linker           string                     `json:"linker"`
+	RTLib            string                     `json:"rtlib"` // compiler runtime library (libgcc, compiler-rt)
+	Libc             string                     `json:"libc"`
+	AutoStackSize    *bool                      `json:"automatic-stack-size"` // Determine stack size automatically at compile time.
+	DefaultStackSize uint64                     `json:"default-stack-size"`   // Default stack size if the size couldn't be determined at compile time.
+	CFlags           []string                   `json:"cflags"`
+	LDFlags          []string                   `json:"ldflags"`
+	LinkerScript     string                     `json:"linkerscript"`
+	Memory           map[string]*MemoryRegion   `json:"memory"`          // memory regions, to generate a linker script
+	ReservedMemory   map[string]*ReservedMemory `json:"reserved-memory"` // parts of memory regions that are not used by the program
+	MainStackSize    string                     `json:"main-stack-size"` // stack size of the main goroutine in a generated linker script
+	ExtraFiles       []string                   `json:"extra-files"`
+	RP2040BootPatch  *bool                      `json:"rp2040-boot-patch"` // Patch RP2040 2nd stage bootloader checksum
+	Emulator         string                     `json:"emulator"`
+	FlashCommand     string                     `json:"flash-command"`
+	GDB              []string                   `json:"gdb"`
+	PortReset        string                     `json:"flash-1200-bps-reset"`
+	SerialPort       []string                   `json:"serial-port"` // serial port IDs in the form "vid:pid"
+	FlashMethod      string                     `json:"flash-method"`
+	FlashVolume      []string                   `json:"msd-volume-name"`
+	FlashFilename    string                     `json:"msd-firmware-name"`
+	UF2FamilyID      string                     `json:"uf2-family-id"`
+	BinaryFormat     string                     `json:"binary-format"`
+	OpenOCDInterface string                     `json:"openocd-interface"`
+	OpenOCDTarget    string                     `json:"openocd-target"`
+	OpenOCDTransport string                     `json:"openocd-transport"`
+	OpenOCDCommands  []string                   `json:"openocd-commands"`
+	OpenOCDVerify    *bool                      `json:"openocd-verify"` // enable verify when flashing with openocd
+	JLinkDevice      string                     `json:"jlink-device"`
+	CodeModel        string                     `json:"code-model"`
+	RelocationModel  string                     `json:"relocation-model"`
+	WasmAbi          string                     `json:"wasm-abi"`
+}
+
+// MemoryRegion is a region in the memory map of a chip, like FLASH_TEXT or
+// RAM. Origin and length are linker script expressions like "0x20000000" or
+// "256K".
+type MemoryRegion struct {
+	Origin     string `json:"origin"`
+	Length     string `json:"length"`
+	Attributes string `json:"attributes"` // like "rw" or "xrw"
+}
+
+// ReservedMemory is a part of a memory region that is kept free for something
+// else than the program, for example a bootloader or a SoftDevice. It is taken
+// from the start of the region, or from the end if End is set.
+type ReservedMemory struct {
+	Region string `json:"region"`
+	Length string `json:"length"`
+	End    bool   `json:"end"`
 }
 
 // overrideProperties overrides all properties that are set in child into itself using reflection.
@@ -89,6 +112,21 @@ func (spec *TargetSpec) overrideProperties(child *TargetSpec) error {
 			if !src.IsNil() {
 				dst.Set(src)
 			}
+		case reflect.Map: // for maps, copy all keys of child and delete keys that are null in child
+			if src.Len() == 0 {
+				continue
+			}
+			if dst.IsNil() {
+				dst.Set(reflect.MakeMap(field.Type))
+			}
+			iter := src.MapRange()
+			for iter.Next() {
+				if iter.Value().IsNil() {
+					dst.SetMapIndex(iter.Key(), reflect.Value{})
+				} else {
+					dst.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
 		case reflect.Slice: // for slices, append the field and check for duplicates
 			dst.Set(reflect.AppendSlice(dst, src))
 			for i := 0; i < dst.Len(); i++ {
@@ -107,48 +145,126 @@ func (spec *TargetSpec) overrideProperties(child *TargetSpec) error {
 	return nil
 }
 
-// load reads a target specification from the JSON in the given io.Reader. It
-// may load more targets specified using the "inherits" property.
-func (spec *TargetSpec) load(r io.Reader) error {
-	err := json.NewDecoder(r).Decode(spec)
+// load reads a target specification from the JSON in the given io.Reader,
+// after validating it against the target schema. It may load more targets
+// specified using the "inherits" property. Warnings of the validation (such as
+// unknown properties) are returned, the caller decides whether to show them.
+func (spec *TargetSpec) load(r io.Reader) (warnings []string, err error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	warnings, err = validateTarget(data)
+	if err != nil {
+		return nil, err
+	}
+	return warnings, json.Unmarshal(data, spec)
+}
 
-	return nil
+var (
+	targetWarningsLock  sync.Mutex
+	targetWarningsShown = map[string]bool{}
+)
+
+// showTargetWarnings prints the warnings for the target file at the given
+// path, but only the first time the file is loaded: targets may be loaded
+// many times in one run (for example once per package in tinygo test).
+func showTargetWarnings(path string, warnings []string) {
+	targetWarningsLock.Lock()
+	defer targetWarningsLock.Unlock()
+	if targetWarningsShown[path] {
+		return
+	}
+	targetWarningsShown[path] = true
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", path, warning)
+	}
 }
 
-// loadFromGivenStr loads the TargetSpec from the given string that could be:
-//   - targets/ directory inside the compiler sources
-//   - a relative or absolute path to custom (project specific) target specification .json file;
-//     the Inherits[] could contain the files from target folder (ex. stm32f4disco)
-//     as well as path to custom files (ex. myAwesomeProject.json)
-func (spec *TargetSpec) loadFromGivenStr(str string) error {
-	path := ""
+// TargetSearchPath returns the directories in which targets are looked up by
+// name, in order of priority:
+//   - the directories in the TINYGO_TARGETPATH environment variable
+//   - the targets/ directory of the project that dir belongs to (see ProjectDir)
+//   - the tinygo/targets/ directory in the user configuration directory
+//     ($XDG_CONFIG_HOME/tinygo/targets on Linux)
+//   - the built-in targets in the TinyGo root
+func TargetSearchPath(dir string) []string {
+	var searchPath []string
+	for _, path := range filepath.SplitList(goenv.Get("TINYGO_TARGETPATH")) {
+		if path != "" {
+			searchPath = append(searchPath, path)
+		}
+	}
+	if projectDir, err := ProjectDir(dir); err == nil && projectDir != "" {
+		searchPath = append(searchPath, filepath.Join(projectDir, "targets"))
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		searchPath = append(searchPath, filepath.Join(configDir, "tinygo", "targets"))
+	}
+	return append(searchPath, filepath.Join(goenv.Get("TINYGOROOT"), "targets"))
+}
+
+// findTarget returns the path of the JSON file for the given target, which
+// could be:
+//   - the name of a target in one of the directories in the search path
+//   - a relative or absolute path to custom (project specific) target
+//     specification .json file; a relative path is resolved relative to dir
+//     when it exists there, and relative to the working directory otherwise
+func findTarget(str string, searchPath []string, dir string) (string, error) {
 	if strings.HasSuffix(str, ".json") {
-		path, _ = filepath.Abs(str)
-	} else {
-		path = filepath.Join(goenv.Get("TINYGOROOT"), "targets", strings.ToLower(str)+".json")
+		if dir != "" && !filepath.IsAbs(str) {
+			path := filepath.Join(dir, str)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+		return filepath.Abs(str)
+	}
+	name := strings.ToLower(str) + ".json"
+	for _, dir := range searchPath {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("could not find target %s in %s: %w", str, strings.Join(searchPath, string(filepath.ListSeparator)), fs.ErrNotExist)
+}
+
+// loadFromGivenStr loads the TargetSpec from the given string (see findTarget).
+// The Inherits[] could contain other targets in the search path (ex.
+// stm32f4disco) as well as paths to custom files (ex. myAwesomeProject.json),
+// relative to this target. It returns the path of the loaded file.
+func (spec *TargetSpec) loadFromGivenStr(str string, searchPath []string, dir string) (string, error) {
+	path, err := findTarget(str, searchPath, dir)
+	if err != nil {
+		return "", err
 	}
 	fp, err := os.Open(path)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer fp.Close()
-	return spec.load(fp)
+	warnings, err := spec.load(fp)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	showTargetWarnings(path, warnings)
+	return path, nil
 }
 
-// resolveInherits loads inherited targets, recursively.
-func (spec *TargetSpec) resolveInherits() error {
+// resolveInherits loads inherited targets, recursively. Inherited targets are
+// looked up in the search path, or relative to dir (the directory of the
+// target that inherits them).
+func (spec *TargetSpec) resolveInherits(searchPath []string, dir string) error {
 	// First create a new spec with all the inherited properties.
 	newSpec := &TargetSpec{}
 	for _, name := range spec.Inherits {
 		subtarget := &TargetSpec{}
-		err := subtarget.loadFromGivenStr(name)
+		path, err := subtarget.loadFromGivenStr(name, searchPath, dir)
 		if err != nil {
 			return err
 		}
-		err = subtarget.resolveInherits()
+		err = subtarget.resolveInherits(searchPath, filepath.Dir(path))
 		if err != nil {
 			return err
 		}
@@ -223,14 +339,19 @@ func LoadTarget(options *Options) (*TargetSpec, error) {
 
 	// See whether there is a target specification for this target (e.g.
 	// Arduino).
+	dir := options.Directory
+	if dir == "" {
+		dir = "."
+	}
+	searchPath := TargetSearchPath(dir)
 	spec := &TargetSpec{}
-	err := spec.loadFromGivenStr(options.Target)
+	path, err := spec.loadFromGivenStr(options.Target, searchPath, "")
 	if err != nil {
 		return nil, err
 	}
-	// Successfully loaded this target from a built-in .json file. Make sure
-	// it includes all parents as specified in the "inherits" key.
-	err = spec.resolveInherits()
+	// Successfully loaded this target from a .json file. Make sure it
+	// includes all parents as specified in the "inherits" key.
+	err = spec.resolveInherits(searchPath, filepath.Dir(path))
 	if err != nil {
 		return nil, fmt.Errorf("%s : %w", options.Target, err)
 	}
@@ -3,8 +3,14 @@ package compileopts
 import (
 	"errors"
 	"io/fs"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/tinygo-org/tinygo/goenv"
 )
 
 func TestLoadTarget(t *testing.T) {
@@ -80,4 +86,191 @@ func TestOverrideProperties(t *testing.T) {
 		t.Errorf("Overriding failed : got %v", base.DefaultStackSize)
 	}
 
+	base = &TargetSpec{
+		Memory: map[string]*MemoryRegion{
+			"FLASH_TEXT": {Origin: "0x0", Length: "1M"},
+			"RAM":        {Origin: "0x20000000", Length: "256K"},
+		},
+		ReservedMemory: map[string]*ReservedMemory{
+			"bootloader": {Region: "FLASH_TEXT", Length: "0x4000"},
+		},
+	}
+	child = &TargetSpec{
+		Memory: map[string]*MemoryRegion{
+			"RAM": {Origin: "0x20000000", Length: "128K"},
+		},
+		ReservedMemory: map[string]*ReservedMemory{
+			"bootloader": nil,
+		},
+	}
+	base.overrideProperties(child)
+	if base.Memory["FLASH_TEXT"].Length != "1M" || base.Memory["RAM"].Length != "128K" {
+		t.Errorf("Overriding failed : got %v %v", base.Memory["FLASH_TEXT"], base.Memory["RAM"])
+	}
+	if len(base.ReservedMemory) != 0 {
+		t.Errorf("Overriding failed : got %v", base.ReservedMemory)
+	}
+}
+
+func TestTargetSchema(t *testing.T) {
+	// All properties of TargetSpec must be in the schema, and the other way
+	// around.
+	schema, err := loadTargetSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	specProperties := map[string]bool{"$schema": true}
+	specType := reflect.TypeOf(TargetSpec{})
+	for i := 0; i < specType.NumField(); i++ {
+		specProperties[specType.Field(i).Tag.Get("json")] = true
+	}
+	for name := range specProperties {
+		if schema.Properties[name] == nil {
+			t.Errorf("property %q is missing from compileopts/target-schema.json", name)
+		}
+	}
+	for name := range schema.Properties {
+		if !specProperties[name] {
+			t.Errorf("property %q in compileopts/target-schema.json is not in TargetSpec", name)
+		}
+	}
+
+	// All built-in targets must be valid.
+	dir := filepath.Join(goenv.Get("TINYGOROOT"), "targets")
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warnings, err := validateTarget(data)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		for _, warning := range warnings {
+			t.Errorf("%s: %s", path, warning)
+		}
+	}
+
+	// Some invalid targets.
+	for _, tc := range []struct {
+		json string
+		err  string
+	}{
+		{`{"gc": "refcount"}`, `gc: invalid value "refcount", must be one of: none, leaking, conservative, custom, precise, incremental`},
+		{`{"default-stack-size": "4K"}`, `default-stack-size: expected integer, got string`},
+		{`{"build-tags": ["a", 1]}`, `build-tags[1]: expected string, got integer`},
+		{`{"memory": {"RAM": {"origin": "0x20000000"}}}`, `memory.RAM: missing property "length"`},
+		{`{"reserved-memory": {"bootloader": {"region": "FLASH_TEXT", "length": "16 K"}}}`, `reserved-memory.bootloader.length: invalid value "16 K"`},
+	} {
+		_, err := validateTarget([]byte(tc.json))
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("expected error %q for %s, got %v", tc.err, tc.json, err)
+		}
+	}
+
+	// Unknown properties are only a warning, so that custom targets with
+	// extra properties can still be used.
+	for _, tc := range []struct {
+		json     string
+		warnings []string
+	}{
+		{`{"inherits": ["cortex-m4"], "flash-metod": "openocd"}`, []string{`target: unknown property "flash-metod"`}},
+		{`{"x-board-vendor": "example", "memory": {"RAM": {"origin": "0x20000000", "length": "128K", "comment": "SRAM1"}}}`, []string{`memory.RAM: unknown property "comment"`, `target: unknown property "x-board-vendor"`}},
+	} {
+		warnings, err := validateTarget([]byte(tc.json))
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tc.json, err)
+		}
+		if !reflect.DeepEqual(warnings, tc.warnings) {
+			t.Errorf("expected warnings %q for %s, got %q", tc.warnings, tc.json, warnings)
+		}
+	}
+}
+
+func TestTargetSearchPath(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	envDir := t.TempDir()
+	t.Setenv("TINYGO_TARGETPATH", envDir)
+
+	projectDir := t.TempDir()
+	writeFile := func(path, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(projectDir, "go.mod"), "module example.com/app\n")
+	// A custom board in the project, which inherits from a custom chip in
+	// the TINYGO_TARGETPATH.
+	writeFile(filepath.Join(projectDir, "targets", "myboard.json"), `{
+		"inherits": ["mychip"],
+		"build-tags": ["myboard"],
+		"flash-method": "openocd"
+	}`)
+	writeFile(filepath.Join(envDir, "mychip.json"), `{
+		"inherits": ["cortex-m4", "./mychip-memory.json"],
+		"build-tags": ["mychip"]
+	}`)
+	writeFile(filepath.Join(envDir, "mychip-memory.json"), `{
+		"memory": {
+			"FLASH_TEXT": {"origin": "0x08000000", "length": "512K"},
+			"RAM": {"origin": "0x20000000", "length": "64K"}
+		}
+	}`)
+
+	searchPath := TargetSearchPath(filepath.Join(projectDir, "cmd"))
+	expected := []string{
+		envDir,
+		filepath.Join(projectDir, "targets"),
+		filepath.Join(configDir, "tinygo", "targets"),
+		filepath.Join(goenv.Get("TINYGOROOT"), "targets"),
+	}
+	if runtime.GOOS == "linux" && !reflect.DeepEqual(searchPath, expected) {
+		t.Errorf("unexpected search path: %v", searchPath)
+	}
+
+	spec, err := LoadTarget(&Options{Target: "myboard", Directory: projectDir})
+	if err != nil {
+		t.Fatal("could not load custom target:", err)
+	}
+	if !reflect.DeepEqual(spec.BuildTags, []string{"cortexm", "baremetal", "linux", "arm", "mychip", "myboard"}) {
+		t.Errorf("unexpected build tags: %v", spec.BuildTags)
+	}
+	if spec.CPU != "cortex-m4" || spec.Memory["RAM"] == nil || spec.FlashMethod != "openocd" {
+		t.Errorf("custom target not loaded correctly: %#v", spec)
+	}
+
+	// Targets outside of the project aren't found.
+	_, err = LoadTarget(&Options{Target: "myboard", Directory: t.TempDir()})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected target to be not found, got: %v", err)
+	}
+
+	// Invalid targets are rejected.
+	writeFile(filepath.Join(projectDir, "targets", "badboard.json"), `{"inherits": ["mychip"], "serial": "spi"}`)
+	_, err = LoadTarget(&Options{Target: "badboard", Directory: projectDir})
+	if err == nil || !strings.HasSuffix(err.Error(), `serial: invalid value "spi", must be one of: none, uart, usb`) {
+		t.Errorf("expected invalid target error, got: %v", err)
+	}
+
+	// Targets with unknown properties can still be used.
+	writeFile(filepath.Join(projectDir, "targets", "vendorboard.json"), `{"inherits": ["mychip"], "x-vendor": "example"}`)
+	if _, err := LoadTarget(&Options{Target: "vendorboard", Directory: projectDir}); err != nil {
+		t.Errorf("could not load target with unknown property: %v", err)
+	}
+
+	// The target schema isn't a target.
+	_, err = LoadTarget(&Options{Target: "schema", Directory: projectDir})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected schema to be not found as a target, got: %v", err)
+	}
 }
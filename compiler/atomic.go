@@ -37,6 +37,7 @@ func (b *builder) createAtomicOp(name string) llvm.Value {
 		val := b.getValue(b.fn.Params[1], getPos(b.fn))
 		isPointer := val.Type().TypeKind() == llvm.PointerTypeKind
 		if isPointer {
+			b.createGCShade(val)
 			// atomicrmw only supports integers, so cast to an integer.
 			// TODO: this is fixed in LLVM 15.
 			val = b.CreatePtrToInt(val, b.uintptrType, "")
@@ -45,12 +46,21 @@ func (b *builder) createAtomicOp(name string) llvm.Value {
 		oldVal := b.CreateAtomicRMW(llvm.AtomicRMWBinOpXchg, ptr, val, llvm.AtomicOrderingSequentiallyConsistent, true)
 		if isPointer {
 			oldVal = b.CreateIntToPtr(oldVal, b.i8ptrType, "")
+			// The old value can't be read before the exchange without a race,
+			// so shade it right after. This is still in time: the GC can't
+			// finish the mark phase between the exchange and this call
+			// without rescanning the stack, which holds the old value.
+			b.createGCShade(oldVal)
 		}
 		return oldVal
 	case "CompareAndSwapInt32", "CompareAndSwapInt64", "CompareAndSwapUint32", "CompareAndSwapUint64", "CompareAndSwapUintptr", "CompareAndSwapPointer":
 		ptr := b.getValue(b.fn.Params[0], getPos(b.fn))
 		old := b.getValue(b.fn.Params[1], getPos(b.fn))
 		newVal := b.getValue(b.fn.Params[2], getPos(b.fn))
+		if newVal.Type().TypeKind() == llvm.PointerTypeKind {
+			b.createGCShade(old)
+			b.createGCShade(newVal)
+		}
 		tuple := b.CreateAtomicCmpXchg(ptr, old, newVal, llvm.AtomicOrderingSequentiallyConsistent, llvm.AtomicOrderingSequentiallyConsistent, true)
 		swapped := b.CreateExtractValue(tuple, 1, "")
 		return swapped
@@ -63,6 +73,9 @@ func (b *builder) createAtomicOp(name string) llvm.Value {
 	case "StoreInt32", "StoreInt64", "StoreUint32", "StoreUint64", "StoreUintptr", "StorePointer":
 		ptr := b.getValue(b.fn.Params[0], getPos(b.fn))
 		val := b.getValue(b.fn.Params[1], getPos(b.fn))
+		if val.Type().TypeKind() == llvm.PointerTypeKind {
+			b.createGCShade(val)
+		}
 		if strings.HasPrefix(b.Triple, "avr") {
 			// SelectionDAGBuilder is currently missing the "are unaligned atomics allowed" check for stores.
 			vType := val.Type()
@@ -90,3 +103,19 @@ func (b *builder) createAtomicOp(name string) llvm.Value {
 		return llvm.Value{}
 	}
 }
+
+// createGCShade marks the object the given pointer points to as reachable, if
+// the incremental GC is in use. Atomic pointer stores don't go through the
+// regular write barrier, because the address they store to is usually not
+// known to be a heap object at compile time and the store must stay a single
+// atomic operation. Instead, the stored (and overwritten) pointer values are
+// shaded so that the GC can't miss them.
+func (b *builder) createGCShade(ptr llvm.Value) {
+	if !b.NeedsWriteBarriers {
+		return
+	}
+	if ptr.Type() != b.i8ptrType {
+		ptr = b.CreateBitCast(ptr, b.i8ptrType, "")
+	}
+	b.createRuntimeCall("gcShade", []llvm.Value{ptr}, "")
+}
@@ -54,7 +54,10 @@ type Config struct {
 	AutomaticStackSize bool
 	DefaultStackSize   uint64
 	NeedsStackObjects  bool
-	Debug              bool // Whether to emit debug information in the LLVM module.
+	NeedsWriteBarriers bool   // insert GC write barriers after pointer stores (for the incremental GC)
+	Debug              bool   // Whether to emit debug information in the LLVM module.
+	BuildMode          string // "default", "c-archive" or "c-shared"
+	PackagePaths       bool   // add the "tinygo-pkgpath" attribute to functions, for the heap allocation report
 }
 
 // compilerContext contains function-independent data that should still be
@@ -863,6 +866,16 @@ func (c *compilerContext) createPackage(irbuilder llvm.Builder, pkg *ssa.Package
 				continue
 			}
 			b.createFunction()
+			if c.isLibrary() && b.info.exported && pkg.Pkg.Name() == "main" {
+				// Functions exported from a C library need to initialize the
+				// runtime before they can run.
+				b.createLibraryEntry()
+			}
+			if b.info.wasmExport && b.Scheduler == "asyncify" {
+				// Exported functions may block, so they need to run in a
+				// goroutine.
+				b.createWasmExport()
+			}
 		case *ssa.Type:
 			if types.IsInterface(member.Type()) {
 				// Interfaces don't have concrete methods.
@@ -1140,6 +1153,13 @@ func (b *builder) createFunctionStart(intrinsic bool) {
 	}
 
 	b.addStandardDefinedAttributes(b.llvmFn)
+	if b.PackagePaths {
+		// The package can't be reliably derived from the function name, as
+		// the last element of a package path may contain dots.
+		if path := functionPackagePath(b.fn); path != "" {
+			b.llvmFn.AddFunctionAttr(b.ctx.CreateStringAttribute("tinygo-pkgpath", path))
+		}
+	}
 	if !b.info.exported {
 		// Do not set visibility for local linkage (internal or private).
 		// Otherwise a "local linkage requires default visibility"
@@ -1535,6 +1555,9 @@ func (b *builder) createInstruction(instr ssa.Instruction) {
 			return
 		}
 		b.CreateStore(llvmVal, llvmAddr)
+		if b.NeedsWriteBarriers {
+			b.createWriteBarrier(instr.Addr, llvmAddr, llvmVal)
+		}
 	default:
 		b.addError(instr.Pos(), "unknown instruction: "+instr.String())
 	}
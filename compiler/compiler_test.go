@@ -2,6 +2,9 @@ package compiler
 
 import (
 	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"os"
 	"strconv"
@@ -11,6 +14,8 @@ import (
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/loader"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
 	"tinygo.org/x/go-llvm"
 )
 
@@ -258,3 +263,106 @@ func testCompilePackage(t *testing.T, options *compileopts.Options, file string)
 	pkg := lprogram.MainPkg()
 	return CompilePackage(file, pkg, program.Package(pkg.Pkg), machine, compilerConfig, false)
 }
+
+func TestFunctionPackagePath(t *testing.T) {
+	t.Parallel()
+
+	// Two packages: one with a dot in the last element of its path, and one
+	// that uses it with its own types.
+	sources := []struct {
+		path   string
+		source string
+	}{
+		{"gopkg.in/yaml.v2", `package yaml
+type T struct{}
+func (T) Method() {}
+func (*T) Closure() func() { return func() {} }
+type List[E any] struct{ items []E }
+func (l *List[E]) Push(e E) { l.items = append(l.items, e) }
+func Map[E any](s []E, f func(E) E) []E {
+	for i := range s {
+		s[i] = f(s[i])
+	}
+	return s
+}
+`},
+		{"example.com/app", `package app
+import "gopkg.in/yaml.v2"
+type Value struct{ yaml.T }
+func Use() {
+	var l yaml.List[Value]
+	l.Push(Value{})
+	yaml.Map([]Value{}, func(v Value) Value { return v })
+}
+`},
+	}
+	fset := token.NewFileSet()
+	prog := ssa.NewProgram(fset, ssa.InstantiateGenerics)
+	packages := map[string]*types.Package{}
+	var ssaPackages []*ssa.Package
+	for _, src := range sources {
+		file, err := parser.ParseFile(fset, src.path+".go", src.source, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Instances:  map[*ast.Ident]types.Instance{},
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Implicits:  map[ast.Node]types.Object{},
+			Scopes:     map[ast.Node]*types.Scope{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+		}
+		config := types.Config{
+			Importer: importerFunc(func(path string) (*types.Package, error) {
+				return packages[path], nil
+			}),
+		}
+		pkg, err := config.Check(src.path, fset, []*ast.File{file}, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packages[src.path] = pkg
+		ssaPackages = append(ssaPackages, prog.CreatePackage(pkg, []*ast.File{file}, info, true))
+	}
+	for _, pkg := range ssaPackages {
+		pkg.Build()
+	}
+
+	functions := map[string]string{}
+	for fn := range ssautil.AllFunctions(prog) {
+		functions[fn.String()] = functionPackagePath(fn)
+	}
+	for _, tc := range []struct {
+		name string
+		path string
+	}{
+		{"gopkg.in/yaml.v2.Map", "gopkg.in/yaml.v2"},
+		{"(gopkg.in/yaml.v2.T).Method", "gopkg.in/yaml.v2"},
+		{"(*gopkg.in/yaml.v2.T).Closure$1", "gopkg.in/yaml.v2"},
+		{"example.com/app.Use", "example.com/app"},
+		{"example.com/app.Use$1", "example.com/app"},
+		// Instances of generic functions belong to the package of the generic
+		// function, not to the package of the type arguments.
+		{"gopkg.in/yaml.v2.Map[example.com/app.Value]", "gopkg.in/yaml.v2"},
+		{"(*gopkg.in/yaml.v2.List[example.com/app.Value]).Push[example.com/app.Value]", "gopkg.in/yaml.v2"},
+		// Wrappers of promoted methods.
+		{"(example.com/app.Value).Method", "gopkg.in/yaml.v2"},
+	} {
+		path, ok := functions[tc.name]
+		if !ok {
+			t.Errorf("function %s not found", tc.name)
+			continue
+		}
+		if path != tc.path {
+			t.Errorf("package of %s: got %q, expected %q", tc.name, path, tc.path)
+		}
+	}
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
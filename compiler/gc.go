@@ -87,6 +87,29 @@ func (b *builder) trackPointer(value llvm.Value) {
 	b.createRuntimeCall("trackPointer", []llvm.Value{value, b.stackChainAlloca}, "")
 }
 
+// createWriteBarrier inserts a call to runtime.gcWriteBarrier after a store of
+// the given value to the given address, if the value contains pointers and the
+// address may be part of a heap object. The incremental GC uses this to rescan
+// objects that were modified during the mark phase.
+func (b *builder) createWriteBarrier(addr ssa.Value, llvmAddr, llvmVal llvm.Value) {
+	if !typeHasPointers(llvmVal.Type()) {
+		return
+	}
+	if alloc, ok := addr.(*ssa.Alloc); ok && !alloc.Heap {
+		// Stores to the stack are found when the stack is scanned again at
+		// the end of the mark phase.
+		return
+	}
+	if _, ok := addr.(*ssa.Global); ok {
+		// Same for globals.
+		return
+	}
+	if llvmAddr.Type() != b.i8ptrType {
+		llvmAddr = b.CreateBitCast(llvmAddr, b.i8ptrType, "")
+	}
+	b.createRuntimeCall("gcWriteBarrier", []llvm.Value{llvmAddr}, "")
+}
+
 // typeHasPointers returns whether this type is a pointer or contains pointers.
 // If the type is an aggregate type, it will check whether there is a pointer
 // inside.
@@ -0,0 +1,80 @@
+package compiler
+
+// This file implements the entry points of exported functions when building a
+// C library (-buildmode=c-archive or -buildmode=c-shared).
+//
+// There is no main function that initializes the runtime in a library.
+// Instead, every exported function is wrapped in a function that initializes
+// the runtime on the first call and tells the garbage collector where the
+// (foreign) stack starts:
+//
+//	func exportedName(args...) results {
+//	    runtime.libraryEnter(llvm.stacksave())
+//	    results := exportedName$exported(args...)
+//	    runtime.libraryExit()
+//	    return results
+//	}
+
+import (
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// isLibrary returns whether this is a c-archive or c-shared build for a native
+// target. On WebAssembly, c-shared produces a reactor module instead, which
+// uses //go:wasmexport for its entry points.
+func (c *compilerContext) isLibrary() bool {
+	if strings.HasPrefix(c.Triple, "wasm") {
+		return false
+	}
+	return c.BuildMode == "c-archive" || c.BuildMode == "c-shared"
+}
+
+// createLibraryEntry wraps the exported function that was just created so
+// that it can be called from C code at any time.
+func (b *builder) createLibraryEntry() {
+	runtimePkg := b.program.ImportedPackage("runtime")
+	for _, name := range []string{"libraryEnter", "libraryExit"} {
+		if _, ok := runtimePkg.Members[name].(*ssa.Function); !ok {
+			b.addError(b.fn.Pos(), "-buildmode="+b.BuildMode+" is not supported by the runtime for this target")
+			return
+		}
+	}
+
+	// Move the function body out of the way, so that the wrapper can take its
+	// name. All existing references (for example from other exported
+	// functions) must go through the wrapper as well.
+	fn := b.llvmFn
+	name := fn.Name()
+	fnType := fn.GlobalValueType()
+	fn.SetName(name + "$exported")
+	wrapper := llvm.AddFunction(b.mod, name, fnType)
+	fn.ReplaceAllUsesWith(wrapper)
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+	noinline := b.ctx.CreateEnumAttribute(llvm.AttributeKindID("noinline"), 0)
+	fn.AddFunctionAttr(noinline)
+
+	// Create the wrapper function.
+	b.addStandardDefinedAttributes(wrapper)
+	// The stack pointer that is read in the wrapper must be above the stack of
+	// the function body.
+	wrapper.AddFunctionAttr(noinline)
+	entry := b.ctx.AddBasicBlock(wrapper, "entry")
+	b.SetInsertPointAtEnd(entry)
+	if b.Debug {
+		pos := b.program.Fset.Position(b.fn.Pos())
+		difunc := b.attachDebugInfoRaw(b.fn, wrapper, "$entry", pos.Filename, pos.Line)
+		b.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), difunc, llvm.Metadata{})
+	}
+	b.createRuntimeCall("libraryEnter", []llvm.Value{b.readStackPointer()}, "")
+	result := b.CreateCall(fnType, fn, wrapper.Params(), "")
+	b.createRuntimeCall("libraryExit", nil, "")
+	if fnType.ReturnType().TypeKind() == llvm.VoidTypeKind {
+		b.CreateRetVoid()
+	} else {
+		b.CreateRet(result)
+	}
+}
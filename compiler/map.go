@@ -43,7 +43,9 @@ func (b *builder) createMakeMap(expr *ssa.MakeMap) (llvm.Value, error) {
 	valueSize := b.targetData.TypeAllocSize(llvmValueType)
 	llvmKeySize := llvm.ConstInt(b.uintptrType, keySize, false)
 	llvmValueSize := llvm.ConstInt(b.uintptrType, valueSize, false)
-	sizeHint := llvm.ConstInt(b.uintptrType, 8, false)
+	// Without a size hint, the runtime doesn't allocate any space for entries
+	// until the first entry is stored.
+	sizeHint := llvm.ConstInt(b.uintptrType, 0, false)
 	algEnum := llvm.ConstInt(b.ctx.Int8Type(), alg, false)
 	if expr.Reserve != nil {
 		sizeHint = b.getValue(expr.Reserve, getPos(expr))
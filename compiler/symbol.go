@@ -28,6 +28,7 @@ type functionInfo struct {
 	linkName   string     // go:linkname, go:export - The name that we map for the particular module -> importName
 	section    string     // go:section - object file section name
 	exported   bool       // go:export, CGo
+	wasmExport bool       // go:wasmexport
 	interrupt  bool       // go:interrupt
 	nobounds   bool       // go:nobounds
 	variadic   bool       // go:variadic (CGo only)
@@ -170,6 +171,15 @@ func (c *compilerContext) getFunction(fn *ssa.Function) (llvm.Type, llvm.Value)
 		llvmFn.AddAttributeAtIndex(1, c.ctx.CreateEnumAttribute(llvm.AttributeKindID("nocapture"), 0))
 		llvmFn.AddAttributeAtIndex(2, c.ctx.CreateEnumAttribute(llvm.AttributeKindID("readonly"), 0))
 		llvmFn.AddAttributeAtIndex(2, c.ctx.CreateEnumAttribute(llvm.AttributeKindID("nocapture"), 0))
+	case "runtime.gcWriteBarrier":
+		// The write barrier only looks at the address to find the object that
+		// was modified, it doesn't keep the pointer.
+		llvmFn.AddAttributeAtIndex(1, c.ctx.CreateEnumAttribute(llvm.AttributeKindID("nocapture"), 0))
+		llvmFn.AddAttributeAtIndex(1, c.ctx.CreateEnumAttribute(llvm.AttributeKindID("readonly"), 0))
+	case "runtime.gcShade":
+		// Shading an object only changes the GC metadata.
+		llvmFn.AddAttributeAtIndex(1, c.ctx.CreateEnumAttribute(llvm.AttributeKindID("nocapture"), 0))
+		llvmFn.AddAttributeAtIndex(1, c.ctx.CreateEnumAttribute(llvm.AttributeKindID("readnone"), 0))
 	case "runtime.trackPointer":
 		// This function is necessary for tracking pointers on the stack in a
 		// portable way (see gc_stack_portable.go). Indicate to the optimizer
@@ -283,6 +293,16 @@ func (c *compilerContext) parsePragmas(info *functionInfo, f *ssa.Function) {
 
 				importName = parts[1]
 				info.exported = true
+			case "//go:wasmexport":
+				// Export a WebAssembly function that can block, see
+				// createWasmExport.
+				if len(parts) != 2 {
+					continue
+				}
+				c.checkWasmExport(f, comment.Text)
+				importName = parts[1]
+				info.exported = true
+				info.wasmExport = true
 			case "//go:interrupt":
 				if hasUnsafeImport(f.Pkg.Pkg) {
 					info.interrupt = true
@@ -394,6 +414,37 @@ func (c *compilerContext) checkWasmImport(f *ssa.Function, pragma string) {
 	}
 }
 
+// checkWasmExport checks whether the given function can be exported with
+// //go:wasmexport. It reports an error if not.
+func (c *compilerContext) checkWasmExport(f *ssa.Function, pragma string) {
+	if !strings.HasPrefix(c.Triple, "wasm") {
+		c.addError(f.Pos(), "//go:wasmexport is only supported on WebAssembly")
+		return
+	}
+	if f.Blocks == nil {
+		// Declarations can only be imported.
+		c.addError(f.Pos(), "can only use //go:wasmexport on definitions")
+		return
+	}
+	if f.Signature.Recv() != nil {
+		c.addError(f.Pos(), "cannot use //go:wasmexport on a method")
+		return
+	}
+	if f.Signature.Results().Len() > 1 {
+		c.addError(f.Signature.Results().At(1).Pos(), fmt.Sprintf("%s: too many return values", pragma))
+	} else if f.Signature.Results().Len() == 1 {
+		result := f.Signature.Results().At(0)
+		if !isValidWasmType(result.Type(), true) {
+			c.addError(result.Pos(), fmt.Sprintf("%s: unsupported result type %s", pragma, result.Type().String()))
+		}
+	}
+	for _, param := range f.Params {
+		if !isValidWasmType(param.Type(), false) {
+			c.addError(param.Pos(), fmt.Sprintf("%s: unsupported parameter type %s", pragma, param.Type().String()))
+		}
+	}
+}
+
 // Check whether the type maps directly to a WebAssembly type, according to:
 // https://github.com/golang/go/issues/59149
 func isValidWasmType(typ types.Type, isReturn bool) bool {
@@ -622,3 +673,25 @@ func hasUnsafeImport(pkg *types.Package) bool {
 	}
 	return false
 }
+
+// functionPackagePath returns the import path of the package that contains the
+// source code of the given function. Closures belong to the package of their
+// enclosing function and instances of generic functions to the package of the
+// generic function. It returns "" for synthetic functions that don't belong
+// to a package.
+func functionPackagePath(fn *ssa.Function) string {
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	if origin := fn.Origin(); origin != nil {
+		fn = origin
+	}
+	if fn.Pkg != nil {
+		return fn.Pkg.Pkg.Path()
+	}
+	if obj := fn.Object(); obj != nil && obj.Pkg() != nil {
+		// Wrappers, for example for promoted methods.
+		return obj.Pkg().Path()
+	}
+	return ""
+}
@@ -41,3 +41,21 @@ func invalidreturn() int
 //
 //go:wasmimport modulename invalidUnsafePointerReturn
 func invalidUnsafePointerReturn() unsafe.Pointer
+
+//go:wasmexport validexport
+func validexport(a int32, b uint64, c float64, d unsafe.Pointer) int64 {
+	return 0
+}
+
+// ERROR: can only use //go:wasmexport on definitions
+//
+//go:wasmexport declaration
+func declaration()
+
+// ERROR: //go:wasmexport invalidexport: unsupported result type int
+// ERROR: //go:wasmexport invalidexport: unsupported parameter type string
+//
+//go:wasmexport invalidexport
+func invalidexport(a string) int {
+	return 0
+}
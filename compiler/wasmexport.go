@@ -0,0 +1,126 @@
+package compiler
+
+// This file implements //go:wasmexport with the asyncify scheduler.
+//
+// An exported function may block, for example on a channel or in time.Sleep.
+// That is only possible in a goroutine, so the exported function runs in a new
+// goroutine while the caller runs the scheduler until it has finished. The
+// export moves to a wrapper function, calls from Go still use the function
+// directly:
+//
+//	//go:wasmexport exportedName
+//	func exportedName$wasmexport(a, b int32) int32 {
+//	    frame := &struct{ a, b, result int32 }{a, b, 0}
+//	    go exportedName$wasmexport.thunk(frame)
+//	    runtime.wasmExportRun()
+//	    return frame.result
+//	}
+//
+//	func exportedName$wasmexport.thunk(frame *struct{ a, b, result int32 }) {
+//	    frame.result = exportedName(frame.a, frame.b)
+//	    runtime.wasmExportDone()
+//	}
+
+import (
+	"github.com/tinygo-org/tinygo/compiler/llvmutil"
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// createWasmExport wraps the //go:wasmexport function that was just created, so
+// that it runs in its own goroutine.
+func (b *builder) createWasmExport() {
+	runtimePkg := b.program.ImportedPackage("runtime")
+	for _, name := range []string{"wasmExportRun", "wasmExportDone"} {
+		if _, ok := runtimePkg.Members[name].(*ssa.Function); !ok {
+			b.addError(b.fn.Pos(), "//go:wasmexport is not supported by the runtime for this target")
+			return
+		}
+	}
+
+	// Move the export to the wrapper. Calls from Go must not go through the
+	// wrapper, as they already run in a goroutine.
+	fn := b.llvmFn
+	name := fn.Name()
+	fnType := fn.GlobalValueType()
+	fn.RemoveStringAttributeAtIndex(-1, "wasm-export-name")
+	fn.SetVisibility(llvm.HiddenVisibility)
+	wrapper := llvm.AddFunction(b.mod, name+"$wasmexport", fnType)
+	b.addStandardDefinedAttributes(wrapper)
+	wrapper.AddFunctionAttr(b.ctx.CreateStringAttribute("wasm-export-name", name))
+	llvmutil.AppendToGlobal(b.mod, "llvm.used", wrapper)
+
+	// The frame holds the parameters and the result.
+	frameFields := fnType.ParamTypes()
+	hasResult := fnType.ReturnType().TypeKind() != llvm.VoidTypeKind
+	if hasResult {
+		frameFields = append(frameFields, fnType.ReturnType())
+	}
+	frameType := b.ctx.StructType(frameFields, false)
+	numParams := len(fnType.ParamTypes())
+
+	// Create the function that runs in the new goroutine.
+	thunkType := llvm.FunctionType(b.ctx.VoidType(), []llvm.Type{b.i8ptrType, b.i8ptrType}, false)
+	thunk := llvm.AddFunction(b.mod, name+"$wasmexport.thunk", thunkType)
+	thunk.SetLinkage(llvm.InternalLinkage)
+	thunk.SetUnnamedAddr(true)
+	b.addStandardDefinedAttributes(thunk)
+	b.SetInsertPointAtEnd(b.ctx.AddBasicBlock(thunk, "entry"))
+	if b.Debug {
+		pos := b.program.Fset.Position(b.fn.Pos())
+		difunc := b.attachDebugInfoRaw(b.fn, thunk, "$wasmexport.thunk", pos.Filename, pos.Line)
+		b.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), difunc, llvm.Metadata{})
+	}
+	frame := b.CreateBitCast(thunk.Param(0), llvm.PointerType(frameType, 0), "frame")
+	var params []llvm.Value
+	for i := 0; i < numParams; i++ {
+		gep := b.CreateInBoundsGEP(frameType, frame, []llvm.Value{
+			llvm.ConstInt(b.ctx.Int32Type(), 0, false),
+			llvm.ConstInt(b.ctx.Int32Type(), uint64(i), false),
+		}, "")
+		params = append(params, b.CreateLoad(frameFields[i], gep, ""))
+	}
+	result := b.CreateCall(fnType, fn, params, "")
+	if hasResult {
+		gep := b.CreateInBoundsGEP(frameType, frame, []llvm.Value{
+			llvm.ConstInt(b.ctx.Int32Type(), 0, false),
+			llvm.ConstInt(b.ctx.Int32Type(), uint64(numParams), false),
+		}, "")
+		b.CreateStore(result, gep)
+	}
+	b.createRuntimeCall("wasmExportDone", nil, "")
+	b.CreateRetVoid()
+
+	// Create the exported function, which starts the goroutine and waits for
+	// it to finish.
+	b.SetInsertPointAtEnd(b.ctx.AddBasicBlock(wrapper, "entry"))
+	if b.Debug {
+		pos := b.program.Fset.Position(b.fn.Pos())
+		difunc := b.attachDebugInfoRaw(b.fn, wrapper, "$wasmexport", pos.Filename, pos.Line)
+		b.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), difunc, llvm.Metadata{})
+	}
+	frameSize := llvm.ConstInt(b.uintptrType, b.targetData.TypeAllocSize(frameType), false)
+	framePtr := b.createRuntimeCall("alloc", []llvm.Value{frameSize, llvm.ConstNull(b.i8ptrType)}, "frame")
+	frame = b.CreateBitCast(framePtr, llvm.PointerType(frameType, 0), "")
+	for i, param := range wrapper.Params() {
+		gep := b.CreateInBoundsGEP(frameType, frame, []llvm.Value{
+			llvm.ConstInt(b.ctx.Int32Type(), 0, false),
+			llvm.ConstInt(b.ctx.Int32Type(), uint64(i), false),
+		}, "")
+		b.CreateStore(param, gep)
+	}
+	callee := b.createGoroutineStartWrapper(thunkType, thunk, "", false, b.fn.Pos())
+	stackSize := llvm.ConstInt(b.uintptrType, b.DefaultStackSize, false)
+	startType, start := b.getFunction(b.program.ImportedPackage("internal/task").Members["start"].(*ssa.Function))
+	b.createCall(startType, start, []llvm.Value{callee, framePtr, stackSize, llvm.Undef(b.i8ptrType)}, "")
+	b.createRuntimeCall("wasmExportRun", nil, "")
+	if hasResult {
+		gep := b.CreateInBoundsGEP(frameType, frame, []llvm.Value{
+			llvm.ConstInt(b.ctx.Int32Type(), 0, false),
+			llvm.ConstInt(b.ctx.Int32Type(), uint64(numParams), false),
+		}, "")
+		b.CreateRet(b.CreateLoad(fnType.ReturnType(), gep, "result"))
+	} else {
+		b.CreateRetVoid()
+	}
+}
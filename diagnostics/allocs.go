@@ -0,0 +1,256 @@
+package diagnostics
+
+// This file implements the heap allocation report (-alloc-report) and the
+// per-package allocation budget (-max-allocs).
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Alloc is a heap allocation that remains in the program after optimization.
+type Alloc struct {
+	Pos       *Position // nil if there is no debug information
+	Function  string    // function containing the allocation
+	Package   string    // package of Function
+	Size      uint64    `json:",omitempty"` // 0 if the size is not constant
+	Reason    string    // why it is not allocated on the stack
+	EscapePos *Position `json:",omitempty"` // where the object escapes, if known
+}
+
+// AllocReport is the JSON format of the allocation report.
+type AllocReport struct {
+	Packages map[string]int // number of heap allocations per package
+	Allocs   []Alloc
+}
+
+// SortAllocs sorts allocations by package and position, for stable output.
+func SortAllocs(allocs []Alloc) {
+	sort.SliceStable(allocs, func(i, j int) bool {
+		a, b := allocs[i], allocs[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		if (a.Pos == nil) != (b.Pos == nil) {
+			return a.Pos != nil
+		}
+		if a.Pos != nil {
+			if a.Pos.Filename != b.Pos.Filename {
+				return a.Pos.Filename < b.Pos.Filename
+			}
+			if a.Pos.Line != b.Pos.Line {
+				return a.Pos.Line < b.Pos.Line
+			}
+			if a.Pos.Column != b.Pos.Column {
+				return a.Pos.Column < b.Pos.Column
+			}
+		}
+		return a.Function < b.Function
+	})
+}
+
+// WriteAllocReport writes the allocation report to the given file. The format
+// depends on the file extension: .json for JSON, .html for an annotated view of
+// the source code.
+func WriteAllocReport(path string, allocs []Alloc) error {
+	var write func(io.Writer, []Alloc) error
+	switch filepath.Ext(path) {
+	case ".json":
+		write = writeAllocJSON
+	case ".html":
+		write = writeAllocHTML
+	default:
+		return fmt.Errorf("unknown allocation report format: %s (must be .json or .html)", path)
+	}
+	SortAllocs(allocs)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f, allocs)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeAllocJSON(w io.Writer, allocs []Alloc) error {
+	report := AllocReport{
+		Packages: map[string]int{},
+		Allocs:   allocs,
+	}
+	if report.Allocs == nil {
+		report.Allocs = []Alloc{}
+	}
+	for _, alloc := range allocs {
+		report.Packages[alloc.Package]++
+	}
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Data passed to allocReportTemplate.
+type allocReportFile struct {
+	Name    string
+	Package string
+	Count   int
+	Lines   []allocReportLine
+}
+
+type allocReportLine struct {
+	Number int
+	Text   string
+	Allocs []Alloc
+}
+
+var allocReportTemplate = template.Must(template.New("allocs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Heap allocations</title>
+<style>
+body { font-family: sans-serif; }
+table.source { border-collapse: collapse; font-family: monospace; white-space: pre; }
+table.source td { padding: 0 0.5em; }
+td.line { color: #888; text-align: right; }
+tr.alloc { background: #fdd; }
+tr.note td { background: #fee; color: #800; font-family: sans-serif; white-space: normal; }
+</style>
+</head>
+<body>
+<h1>Heap allocations</h1>
+<table>
+<tr><th>package</th><th>allocations</th></tr>
+{{range .Packages}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{range .Files}}
+<h2 id="{{.Name}}">{{.Name}} ({{.Count}})</h2>
+<table class="source">
+{{range .Lines}}{{if .Allocs}}<tr class="alloc"><td class="line">{{.Number}}</td><td>{{.Text}}</td></tr>
+{{range .Allocs}}<tr class="note"><td></td><td>{{.Function}}: {{.Reason}}{{if .Size}} ({{.Size}} bytes){{end}}</td></tr>
+{{end}}{{else}}<tr><td class="line">{{.Number}}</td><td>{{.Text}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}
+{{if .Unknown}}<h2>Without source location</h2>
+<ul>
+{{range .Unknown}}<li>{{.Function}}: {{.Reason}}{{if .Size}} ({{.Size}} bytes){{end}}</li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+// writeAllocHTML writes the source files containing heap allocations, with the
+// allocations highlighted and explained.
+func writeAllocHTML(w io.Writer, allocs []Alloc) error {
+	type packageCount struct {
+		Name  string
+		Count int
+	}
+	var data struct {
+		Packages []packageCount
+		Files    []*allocReportFile
+		Unknown  []Alloc
+	}
+
+	files := map[string]*allocReportFile{}
+	for _, alloc := range allocs {
+		if n := len(data.Packages); n == 0 || data.Packages[n-1].Name != alloc.Package {
+			data.Packages = append(data.Packages, packageCount{Name: alloc.Package})
+		}
+		data.Packages[len(data.Packages)-1].Count++
+
+		if alloc.Pos == nil {
+			data.Unknown = append(data.Unknown, alloc)
+			continue
+		}
+		file := files[alloc.Pos.Filename]
+		if file == nil {
+			source, err := os.ReadFile(alloc.Pos.Filename)
+			if err != nil {
+				return err
+			}
+			file = &allocReportFile{
+				Name:    alloc.Pos.Filename,
+				Package: alloc.Package,
+			}
+			for i, text := range strings.Split(strings.ReplaceAll(string(source), "\r\n", "\n"), "\n") {
+				file.Lines = append(file.Lines, allocReportLine{Number: i + 1, Text: text})
+			}
+			files[alloc.Pos.Filename] = file
+			data.Files = append(data.Files, file)
+		}
+		file.Count++
+		if line := alloc.Pos.Line; line >= 1 && line <= len(file.Lines) {
+			file.Lines[line-1].Allocs = append(file.Lines[line-1].Allocs, alloc)
+		}
+	}
+	return allocReportTemplate.Execute(w, &data)
+}
+
+// CheckAllocBudget returns an error for each heap allocation in a package that
+// has more allocations than allowed in budget. The keys of budget are package
+// paths, or patterns like "example.com/foo/..." that match a package and all
+// packages below it. The most specific pattern is used for each package.
+func CheckAllocBudget(allocs []Alloc, budget map[string]int) []error {
+	if len(budget) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, alloc := range allocs {
+		counts[alloc.Package]++
+	}
+	SortAllocs(allocs)
+	var errs []error
+	for _, alloc := range allocs {
+		pattern, ok := matchAllocBudget(budget, alloc.Package)
+		if !ok || counts[alloc.Package] <= budget[pattern] {
+			continue
+		}
+		var pos token.Position
+		if alloc.Pos != nil {
+			pos = token.Position{
+				Filename: alloc.Pos.Filename,
+				Line:     alloc.Pos.Line,
+				Column:   alloc.Pos.Column,
+			}
+		}
+		errs = append(errs, scanner.Error{
+			Pos: pos,
+			Msg: fmt.Sprintf("heap allocation in %s: %s (package %s has %d heap allocations, max-allocs for %s is %d)", alloc.Function, alloc.Reason, alloc.Package, counts[alloc.Package], pattern, budget[pattern]),
+		})
+	}
+	return errs
+}
+
+// matchAllocBudget returns the most specific pattern in budget that matches
+// the given package.
+func matchAllocBudget(budget map[string]int, pkg string) (string, bool) {
+	if _, ok := budget[pkg]; ok {
+		return pkg, true
+	}
+	best := ""
+	for pattern := range budget {
+		prefix := strings.TrimSuffix(pattern, "/...")
+		if prefix == pattern {
+			continue
+		}
+		if (pkg == prefix || strings.HasPrefix(pkg, prefix+"/")) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,130 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testAllocs(dir string) []Alloc {
+	source := filepath.Join(dir, "main.go")
+	return []Alloc{
+		{
+			Pos:      &Position{Filename: source, Line: 6, Column: 7},
+			Function: "main.main",
+			Package:  "main",
+			Reason:   "size is not constant",
+		},
+		{
+			Pos:       &Position{Filename: source, Line: 4, Column: 2},
+			Function:  "main.main",
+			Package:   "main",
+			Size:      8,
+			Reason:    "escapes at line 5",
+			EscapePos: &Position{Filename: source, Line: 5, Column: 8},
+		},
+		{
+			Function: "(*example.com/app/drivers/led.Device).Configure",
+			Package:  "example.com/app/drivers/led",
+			Size:     16,
+			Reason:   "escapes at unknown line",
+		},
+	}
+}
+
+func TestAllocReportJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "allocs.json")
+	if err := WriteAllocReport(path, testAllocs(dir)); err != nil {
+		t.Fatal("could not write report:", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report AllocReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal("could not parse report:", err)
+	}
+	expectedPackages := map[string]int{"main": 2, "example.com/app/drivers/led": 1}
+	if !reflect.DeepEqual(report.Packages, expectedPackages) {
+		t.Errorf("unexpected package counts: %v", report.Packages)
+	}
+	var order []string
+	for _, alloc := range report.Allocs {
+		order = append(order, alloc.Reason)
+	}
+	expectedOrder := []string{"escapes at unknown line", "escapes at line 5", "size is not constant"}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Errorf("allocations not sorted by package and position: %q", order)
+	}
+}
+
+func TestAllocReportHTML(t *testing.T) {
+	dir := t.TempDir()
+	source := "package main\n\nfunc main() {\n\tn := 3\n\tsink = &n\n\tuse(make([]byte, size()))\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0666); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "allocs.html")
+	if err := WriteAllocReport(path, testAllocs(dir)); err != nil {
+		t.Fatal("could not write report:", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+	for _, expected := range []string{
+		`<td class="line">4</td><td>	n := 3</td>`,
+		`main.main: escapes at line 5 (8 bytes)`,
+		`main.main: size is not constant</td>`,
+		`<li>(*example.com/app/drivers/led.Device).Configure: escapes at unknown line (16 bytes)</li>`,
+		`<tr><td>example.com/app/drivers/led</td><td>1</td></tr>`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected HTML report to contain %q", expected)
+		}
+	}
+	if !strings.Contains(html, `<tr class="alloc"><td class="line">6</td>`) {
+		t.Error("line 6 not marked as containing an allocation")
+	}
+	if strings.Contains(html, `<tr class="alloc"><td class="line">5</td>`) {
+		t.Error("line 5 marked as containing an allocation")
+	}
+
+	if err := WriteAllocReport(filepath.Join(dir, "allocs.txt"), nil); err == nil {
+		t.Error("expected an error for an unknown report format")
+	}
+}
+
+func TestCheckAllocBudget(t *testing.T) {
+	allocs := testAllocs("/src")
+	for _, tc := range []struct {
+		budget map[string]int
+		errors int
+	}{
+		{nil, 0},
+		{map[string]int{"main": 2}, 0},
+		{map[string]int{"main": 1}, 2},
+		{map[string]int{"example.com/app/...": 0}, 1},
+		{map[string]int{"example.com/app/drivers/...": 0}, 1},
+		{map[string]int{"example.com/app/...": 0, "example.com/app/drivers/...": 1}, 0},
+		{map[string]int{"example.com/app/drivers/led": 1, "example.com/app/...": 0}, 0},
+		{map[string]int{"example.com/ap/...": 0}, 0},
+	} {
+		errs := CheckAllocBudget(allocs, tc.budget)
+		if len(errs) != tc.errors {
+			t.Errorf("budget %v: expected %d errors, got %d: %v", tc.budget, tc.errors, len(errs), errs)
+		}
+	}
+
+	errs := CheckAllocBudget(allocs, map[string]int{"main": 1})
+	expected := "/src/main.go:4:2: heap allocation in main.main: escapes at line 5 (package main has 2 heap allocations, max-allocs for main is 1)"
+	if len(errs) != 0 && errs[0].Error() != expected {
+		t.Errorf("unexpected error:\n%s\nexpected:\n%s", errs[0], expected)
+	}
+}
@@ -0,0 +1,276 @@
+// Package diagnostics implements the machine-readable output of the -json flag
+// of tinygo build, flash, run and test.
+//
+// The output is a stream of JSON objects (one per line), each describing a
+// single Event. The Action field says what kind of event it is:
+//
+//	config        the build configuration (Config), only for tinygo build
+//	step          a build step finished (Step, Elapsed)
+//	diagnostic    an error or a report with a source position (Diagnostic)
+//	size          the size of the program (Sizes), with -size=short or -size=full
+//	stack         the stack size of a goroutine (Stack), with -print-stacks
+//	build-result  the program was built (Result)
+//	output        a line of output of the program, test or flash tool (Output)
+//	run           the test Test of ImportPath started
+//	pass, fail    the command, the tests of ImportPath or the test Test passed
+//	              or failed
+//	skip          the package ImportPath has no test files, or the test Test
+//	              was skipped
+//
+// New actions and fields may be added in the future, so consumers should
+// ignore what they don't know.
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/scanner"
+	"go/token"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single object in the -json output.
+type Event struct {
+	Time       time.Time
+	Action     string
+	ImportPath string      `json:",omitempty"`
+	Test       string      `json:",omitempty"` // name of a single test
+	Step       string      `json:",omitempty"`
+	Elapsed    float64     `json:",omitempty"` // seconds
+	Diagnostic *Diagnostic `json:",omitempty"`
+	Sizes      *Sizes      `json:",omitempty"`
+	Stack      *Stack      `json:",omitempty"`
+	Result     *Result     `json:",omitempty"`
+	Config     interface{} `json:",omitempty"`
+	Output     string      `json:",omitempty"`
+}
+
+// Diagnostic is a message about a source location. Compiler errors have kind
+// "error", heap allocations reported with -print-allocs have kind "alloc".
+type Diagnostic struct {
+	Kind     string
+	Pos      *Position `json:",omitempty"` // nil if the position is unknown
+	Message  string
+	Notes    []string    `json:",omitempty"` // extra lines, like an import stack
+	Related  []*Position `json:",omitempty"` // for example a traceback
+	Severity string      // "error" or "info"
+}
+
+// Position is a location in a source file.
+type Position struct {
+	Filename string
+	Line     int `json:",omitempty"`
+	Column   int `json:",omitempty"`
+}
+
+// NewPosition converts a token.Position. It returns nil for invalid positions.
+func NewPosition(pos token.Position) *Position {
+	if pos.Filename == "" {
+		return nil
+	}
+	return &Position{
+		Filename: pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+	}
+}
+
+// FromScannerError converts a parser or type checker error (after converting a
+// types.Error to a scanner.Error) to a diagnostic.
+func FromScannerError(err scanner.Error) *Diagnostic {
+	return &Diagnostic{
+		Kind:     "error",
+		Pos:      NewPosition(err.Pos),
+		Message:  err.Msg,
+		Severity: "error",
+	}
+}
+
+// Sizes is the size of a program, in bytes, like -size=full prints it.
+type Sizes struct {
+	Code     uint64
+	ROData   uint64
+	Data     uint64
+	BSS      uint64
+	Flash    uint64
+	RAM      uint64
+	Packages map[string]PackageSize `json:",omitempty"`
+}
+
+// PackageSize is the size of a single package within a program.
+type PackageSize struct {
+	Code   uint64
+	ROData uint64
+	Data   uint64
+	BSS    uint64
+}
+
+// Stack is the stack size of a goroutine (or of the reset handler). Kind is
+// "bounded" when Size is known, otherwise it says why not: "unknown",
+// "recursive" or "indirect-call", with the responsible function in Cause.
+type Stack struct {
+	Function string
+	Kind     string
+	Size     uint64 `json:",omitempty"`
+	Cause    string `json:",omitempty"`
+}
+
+// Result describes the output of a successful build.
+type Result struct {
+	Executable string            // output of the linker
+	Binary     string            // final output file
+	Sizes      *Sizes            `json:",omitempty"`
+	Extra      map[string]string `json:",omitempty"` // other output files, like a C header
+}
+
+// Writer writes events as JSON lines. It is safe for concurrent use.
+type Writer struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewWriter returns a Writer that writes events to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{encoder: json.NewEncoder(w)}
+}
+
+// Emit writes a single event. The time is set if it isn't set yet. Errors
+// while writing are ignored, like they are for regular output. Emit does
+// nothing on a nil Writer, so callers don't need to check whether -json is in
+// use.
+func (w *Writer) Emit(event Event) {
+	if w == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.encoder.Encode(&event)
+}
+
+// Output returns a writer that emits every line written to it as an "output"
+// event for the given package. The line includes the newline, like with go
+// test -json. Close must be called to emit the last line if it isn't
+// terminated by a newline.
+func (w *Writer) Output(importPath string) *OutputWriter {
+	return &OutputWriter{events: w, importPath: importPath}
+}
+
+// TestOutput is like Output, but for the output of a test binary run with
+// -test.v. It also emits a "run" event when a test starts, and a "pass",
+// "fail" or "skip" event when it finishes, like go test -json. The output of a
+// test that follows its result line (where the testing package puts the log
+// of the test) is attributed to the test.
+func (w *Writer) TestOutput(importPath string) *OutputWriter {
+	return &OutputWriter{events: w, importPath: importPath, tests: true}
+}
+
+// OutputWriter is the io.Writer returned by Writer.Output and
+// Writer.TestOutput.
+type OutputWriter struct {
+	lock       sync.Mutex
+	events     *Writer
+	importPath string
+	buf        []byte // incomplete line
+	tests      bool   // whether to recognize test results in the output
+	test       string // test the current output belongs to
+}
+
+// Write implements io.Writer.
+func (o *OutputWriter) Write(data []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.buf = append(o.buf, data...)
+	for {
+		index := bytes.IndexByte(o.buf, '\n')
+		if index < 0 {
+			break
+		}
+		o.emit(o.buf[:index+1])
+		o.buf = o.buf[index+1:]
+	}
+	return len(data), nil
+}
+
+// Close emits the remaining output, if any.
+func (o *OutputWriter) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.buf) != 0 {
+		o.emit(o.buf)
+		o.buf = nil
+	}
+	return nil
+}
+
+func (o *OutputWriter) emit(line []byte) {
+	var result *Event
+	if o.tests {
+		result = o.parseTestLine(string(line))
+	}
+	o.events.Emit(Event{
+		Action:     "output",
+		ImportPath: o.importPath,
+		Test:       o.test,
+		Output:     string(line),
+	})
+	if result != nil {
+		o.events.Emit(*result)
+	}
+}
+
+// Prefixes of the lines the testing package prints for -test.v, and the action
+// of the event for a line.
+var testLinePrefixes = []struct {
+	prefix string
+	action string
+}{
+	{"=== RUN   ", "run"},
+	{"--- PASS: ", "pass"},
+	{"--- FAIL: ", "fail"},
+	{"--- SKIP: ", "skip"},
+}
+
+// parseTestLine updates the current test for a line of test output. It emits
+// the "run" event for the start of a test and returns the event for the result
+// of a test, which is emitted after the line itself.
+func (o *OutputWriter) parseTestLine(line string) *Event {
+	// Results of subtests are indented.
+	text := strings.TrimRight(strings.TrimLeft(line, " "), "\r\n")
+	if text == "PASS" || text == "FAIL" || strings.HasPrefix(text, "ok  ") {
+		// The summary of the package.
+		o.test = ""
+		return nil
+	}
+	for _, p := range testLinePrefixes {
+		if !strings.HasPrefix(text, p.prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(text, p.prefix)
+		var elapsed float64
+		if i := strings.LastIndex(name, " ("); i >= 0 && strings.HasSuffix(name, ")") {
+			if duration, err := time.ParseDuration(name[i+2 : len(name)-1]); err == nil {
+				elapsed = duration.Seconds()
+			}
+			name = name[:i]
+		}
+		o.test = name
+		event := &Event{
+			Action:     p.action,
+			ImportPath: o.importPath,
+			Test:       name,
+			Elapsed:    elapsed,
+		}
+		if p.action == "run" {
+			o.events.Emit(*event)
+			return nil
+		}
+		return event
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Emit(Event{Action: "step", Step: "link", Elapsed: 0.5})
+	w.Emit(Event{
+		Action: "diagnostic",
+		Diagnostic: FromScannerError(scanner.Error{
+			Pos: token.Position{Filename: "/tmp/main.go", Line: 3, Column: 2},
+			Msg: "undefined: foo",
+		}),
+	})
+	out := w.Output("example.com/hello")
+	fmt.Fprint(out, "hello\nwor")
+	fmt.Fprint(out, "ld\n!")
+	out.Close()
+
+	var events []Event
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal("could not decode event:", err)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("event %d has no time", len(events))
+		}
+		event.Time = event.Time.UTC()
+		events = append(events, event)
+	}
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %d: %s", len(events), buf)
+	}
+
+	if events[0].Action != "step" || events[0].Step != "link" || events[0].Elapsed != 0.5 {
+		t.Errorf("unexpected step event: %+v", events[0])
+	}
+	expected := &Diagnostic{
+		Kind:     "error",
+		Pos:      &Position{Filename: "/tmp/main.go", Line: 3, Column: 2},
+		Message:  "undefined: foo",
+		Severity: "error",
+	}
+	if !reflect.DeepEqual(events[1].Diagnostic, expected) {
+		t.Errorf("unexpected diagnostic: %+v", events[1].Diagnostic)
+	}
+	var lines []string
+	for _, event := range events[2:] {
+		if event.Action != "output" || event.ImportPath != "example.com/hello" {
+			t.Errorf("unexpected output event: %+v", event)
+		}
+		lines = append(lines, event.Output)
+	}
+	if strings.Join(lines, "|") != "hello\n|world\n|!" {
+		t.Errorf("unexpected output lines: %q", lines)
+	}
+}
+
+func TestTestOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	out := w.TestOutput("example.com/hello")
+	fmt.Fprint(out, `=== RUN   TestA
+=== RUN   TestA/sub
+--- FAIL: TestA (0.25s)
+    --- FAIL: TestA/sub (0.01s)
+        hello_test.go:10: wrong answer
+=== RUN   TestB
+--- SKIP: TestB (0.00s)
+    hello_test.go:20: not implemented
+FAIL
+`)
+	out.Close()
+
+	type testEvent struct {
+		Action  string
+		Test    string
+		Elapsed float64
+		Output  string
+	}
+	var events []testEvent
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal("could not decode event:", err)
+		}
+		if event.ImportPath != "example.com/hello" {
+			t.Errorf("unexpected import path: %+v", event)
+		}
+		events = append(events, testEvent{event.Action, event.Test, event.Elapsed, event.Output})
+	}
+	expected := []testEvent{
+		{"run", "TestA", 0, ""},
+		{"output", "TestA", 0, "=== RUN   TestA\n"},
+		{"run", "TestA/sub", 0, ""},
+		{"output", "TestA/sub", 0, "=== RUN   TestA/sub\n"},
+		{"output", "TestA", 0, "--- FAIL: TestA (0.25s)\n"},
+		{"fail", "TestA", 0.25, ""},
+		{"output", "TestA/sub", 0, "    --- FAIL: TestA/sub (0.01s)\n"},
+		{"fail", "TestA/sub", 0.01, ""},
+		{"output", "TestA/sub", 0, "        hello_test.go:10: wrong answer\n"},
+		{"run", "TestB", 0, ""},
+		{"output", "TestB", 0, "=== RUN   TestB\n"},
+		{"output", "TestB", 0, "--- SKIP: TestB (0.00s)\n"},
+		{"skip", "TestB", 0, ""},
+		{"output", "TestB", 0, "    hello_test.go:20: not implemented\n"},
+		{"output", "", 0, "FAIL\n"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events:\n got: %+v\nwant: %+v", events, expected)
+	}
+}
+
+func TestWriterNil(t *testing.T) {
+	// Emitting to a nil writer (no -json flag) must be a no-op.
+	var w *Writer
+	w.Emit(Event{Action: "step"})
+}
+
+func TestNewPosition(t *testing.T) {
+	if pos := NewPosition(token.Position{}); pos != nil {
+		t.Errorf("expected nil for an invalid position, got %+v", pos)
+	}
+	pos := NewPosition(token.Position{Filename: "a.go", Line: 1})
+	if pos == nil || pos.Filename != "a.go" || pos.Line != 1 || pos.Column != 0 {
+		t.Errorf("unexpected position: %+v", pos)
+	}
+}
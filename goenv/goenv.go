@@ -24,6 +24,7 @@ var Keys = []string{
 	"GOCACHE",
 	"CGO_ENABLED",
 	"TINYGOROOT",
+	"TINYGO_TARGETPATH",
 }
 
 func init() {
@@ -95,6 +96,9 @@ func Get(name string) string {
 		return "1"
 	case "TINYGOROOT":
 		return sourceDir()
+	case "TINYGO_TARGETPATH":
+		// List of extra directories with target specifications.
+		return os.Getenv("TINYGO_TARGETPATH")
 	case "WASMOPT":
 		if path := os.Getenv("WASMOPT"); path != "" {
 			err := wasmOptCheckVersion(path)
@@ -226,6 +226,7 @@ func needsSyscallPackage(buildTags []string) bool {
 func pathsToOverride(goMinor int, needsSyscallPackage bool) map[string]bool {
 	paths := map[string]bool{
 		"":                      true,
+		"arena/":                false,
 		"crypto/":               true,
 		"crypto/rand/":          false,
 		"device/":               false,
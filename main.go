@@ -11,7 +11,7 @@ import (
 	"go/scanner"
 	"go/types"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -30,6 +30,7 @@ import (
 	"github.com/mattn/go-colorable"
 	"github.com/tinygo-org/tinygo/builder"
 	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/diagnostics"
 	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/interp"
 	"github.com/tinygo-org/tinygo/loader"
@@ -146,14 +147,10 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 		return err
 	}
 
-	if options.PrintJSON {
-		b, err := json.MarshalIndent(config, "", "  ")
-		if err != nil {
-			handleCompilerError(err)
-		}
-		fmt.Printf("%s\n", string(b))
-		return nil
-	}
+	options.Events.Emit(diagnostics.Event{
+		Action: "config",
+		Config: config,
+	})
 
 	// Create a temporary directory for intermediary files.
 	tmpdir, err := os.MkdirTemp("", "tinygo")
@@ -187,6 +184,30 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 			}
 		}
 
+		if result.Header != "" {
+			// Put the C header of a library next to it: libfoo.a gets a
+			// libfoo.h header.
+			headerPath := strings.TrimSuffix(outpath, filepath.Ext(outpath)) + ".h"
+			if err := moveFile(result.Header, headerPath); err != nil {
+				return err
+			}
+			result.Header = headerPath
+		}
+
+		if result.JSBindings != "" {
+			// Put the bindings next to the WebAssembly module: foo.wasm gets
+			// foo.js and foo.d.ts.
+			base := strings.TrimSuffix(outpath, filepath.Ext(outpath))
+			if err := moveFile(result.JSBindings, base+".js"); err != nil {
+				return err
+			}
+			if err := moveFile(result.TSBindings, base+".d.ts"); err != nil {
+				return err
+			}
+			result.JSBindings = base + ".js"
+			result.TSBindings = base + ".d.ts"
+		}
+
 		if err := os.Rename(result.Binary, outpath); err != nil {
 			// Moving failed. Do a file copy.
 			inf, err := os.Open(result.Binary)
@@ -206,14 +227,45 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 			}
 
 			// Check whether file writing was successful.
-			return outf.Close()
+			if err := outf.Close(); err != nil {
+				return err
+			}
 		}
 	}
 
 	// Move was successful.
+	emitBuildResult(options.Events, result, outpath)
 	return nil
 }
 
+// emitBuildResult emits the "build-result" event for -json, with binary as the
+// location of the output file.
+func emitBuildResult(events *diagnostics.Writer, result builder.BuildResult, binary string) {
+	extra := map[string]string{}
+	for name, path := range map[string]string{
+		"header":      result.Header,
+		"js-bindings": result.JSBindings,
+		"ts-bindings": result.TSBindings,
+	} {
+		if path != "" {
+			extra[name] = path
+		}
+	}
+	if len(extra) == 0 {
+		extra = nil
+	}
+	events.Emit(diagnostics.Event{
+		Action:     "build-result",
+		ImportPath: result.ImportPath,
+		Result: &diagnostics.Result{
+			Executable: result.Executable,
+			Binary:     binary,
+			Sizes:      result.Sizes,
+			Extra:      extra,
+		},
+	})
+}
+
 // Test runs the tests in the given package. Returns whether the test passed and
 // possibly an error if the test failed to run.
 func Test(pkgName string, stdout, stderr io.Writer, options *compileopts.Options, outpath string) (bool, error) {
@@ -227,7 +279,9 @@ func Test(pkgName string, stdout, stderr io.Writer, options *compileopts.Options
 
 	// Pass test flags to the test binary.
 	var flags []string
-	if testConfig.Verbose {
+	if testConfig.Verbose || options.Events != nil {
+		// With -json, the verbose output is needed for the events of every
+		// single test.
 		flags = append(flags, "-test.v")
 	}
 	if testConfig.Short {
@@ -259,8 +313,16 @@ func Test(pkgName string, stdout, stderr io.Writer, options *compileopts.Options
 
 	var buf bytes.Buffer
 	var output io.Writer = &buf
-	// Send the test output to stdout if -v or -bench
-	if logToStdout {
+	var jsonOutput *diagnostics.OutputWriter
+	if options.Events != nil {
+		// With -json, all test output is part of the event stream (like go
+		// test -json), not only the output of failed tests.
+		jsonOutput = options.Events.TestOutput(pkgName)
+		output = jsonOutput
+		stdout = jsonOutput
+		logToStdout = false
+	} else if logToStdout {
+		// Send the test output to stdout if -v or -bench
 		output = os.Stdout
 	}
 
@@ -346,6 +408,7 @@ func Test(pkgName string, stdout, stderr io.Writer, options *compileopts.Options
 	}
 	if err, ok := err.(loader.NoTestFilesError); ok {
 		fmt.Fprintf(w, "?   \t%s\t[no test files]\n", err.ImportPath)
+		emitTestResult(jsonOutput, options.Events, "skip", pkgName, 0)
 		// Pretend the test passed - it at least didn't fail.
 		return true, nil
 	} else if passed && !testConfig.CompileOnly {
@@ -353,9 +416,34 @@ func Test(pkgName string, stdout, stderr io.Writer, options *compileopts.Options
 	} else {
 		fmt.Fprintf(w, "FAIL\t%s\t%.3fs\n", importPath, duration.Seconds())
 	}
+	if err != nil && options.Events != nil {
+		// Report the error before the test result, like it would be
+		// printed before the FAIL line.
+		emitCompilerError(options.Events, err)
+		err = nil
+	}
+	if passed {
+		emitTestResult(jsonOutput, options.Events, "pass", pkgName, duration)
+	} else {
+		emitTestResult(jsonOutput, options.Events, "fail", pkgName, duration)
+	}
 	return passed, err
 }
 
+// emitTestResult emits the final event of a test package for -json, after all
+// of its output. It does nothing without -json.
+func emitTestResult(output *diagnostics.OutputWriter, events *diagnostics.Writer, action, importPath string, duration time.Duration) {
+	if events == nil {
+		return
+	}
+	output.Close()
+	events.Emit(diagnostics.Event{
+		Action:     action,
+		ImportPath: importPath,
+		Elapsed:    duration.Seconds(),
+	})
+}
+
 func dirsToModuleRoot(maindir, modroot string) []string {
 	var dirs = []string{"."}
 	last := ".."
@@ -425,6 +513,15 @@ func Flash(pkgName, port string, options *compileopts.Options) error {
 	if err != nil {
 		return err
 	}
+	emitBuildResult(options.Events, result, result.Binary)
+
+	// With -json, the output of the flash tool is part of the event stream.
+	var flashOutput io.Writer = os.Stdout
+	if options.Events != nil {
+		output := options.Events.Output(result.ImportPath)
+		defer output.Close()
+		flashOutput = output
+	}
 
 	// do we need port reset to put MCU into bootloader mode?
 	if config.Target.PortReset == "true" && flashMethod != "openocd" {
@@ -470,7 +567,7 @@ func Flash(pkgName, port string, options *compileopts.Options) error {
 			return fmt.Errorf("invalid flash command: %#v", flashCmd)
 		}
 		cmd := executeCommand(config.Options, flashCmdList[0], flashCmdList[1:]...)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = flashOutput
 		cmd.Stderr = os.Stderr
 		cmd.Dir = goenv.Get("TINYGOROOT")
 		err = cmd.Run()
@@ -504,7 +601,7 @@ func Flash(pkgName, port string, options *compileopts.Options) error {
 		}
 		args = append(args, "-c", "program "+filepath.ToSlash(result.Binary)+exit)
 		cmd := executeCommand(config.Options, "openocd", args...)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = flashOutput
 		cmd.Stderr = os.Stderr
 		err = cmd.Run()
 		if err != nil {
@@ -522,7 +619,7 @@ func Flash(pkgName, port string, options *compileopts.Options) error {
 		}
 		args := []string{"-ex", "target extended-remote " + bmpGDBPort, "-ex", "monitor swdp_scan", "-ex", "attach 1", "-ex", "load", filepath.ToSlash(result.Binary)}
 		cmd := executeCommand(config.Options, gdb, args...)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = flashOutput
 		cmd.Stderr = os.Stderr
 		err = cmd.Run()
 		if err != nil {
@@ -774,7 +871,13 @@ func Run(pkgName string, options *compileopts.Options, cmdArgs []string) error {
 		return err
 	}
 
-	_, err = buildAndRun(pkgName, config, os.Stdout, cmdArgs, nil, 0, func(cmd *exec.Cmd, result builder.BuildResult) error {
+	var stdout io.Writer = os.Stdout
+	if options.Events != nil {
+		output := options.Events.Output(pkgName)
+		defer output.Close()
+		stdout = output
+	}
+	_, err = buildAndRun(pkgName, config, stdout, cmdArgs, nil, 0, func(cmd *exec.Cmd, result builder.BuildResult) error {
 		return cmd.Run()
 	})
 	return err
@@ -856,6 +959,7 @@ func buildAndRun(pkgName string, config *compileopts.Config, stdout io.Writer, c
 	if err != nil {
 		return result, err
 	}
+	emitBuildResult(config.Options.Events, result, result.Binary)
 
 	// If needed, set a timeout on the command. This is done in tests so
 	// they don't waste resources on a stalled test.
@@ -892,6 +996,10 @@ func buildAndRun(pkgName string, config *compileopts.Config, stdout io.Writer, c
 	// stdout.
 	cmd.Stdout = stdout
 	cmd.Stderr = os.Stderr
+	if config.Options.Events != nil {
+		// With -json, all output is part of the event stream.
+		cmd.Stderr = stdout
+	}
 	if config.EmulatorName() == "simavr" {
 		cmd.Stdout = nil // don't print initial load commands
 		cmd.Stderr = stdout
@@ -1302,6 +1410,74 @@ func printCompilerError(logln func(...interface{}), err error) {
 	}
 }
 
+// emitCompilerError is the -json counterpart of printCompilerError: it emits
+// the error as one or more "diagnostic" events. File paths are left absolute,
+// as they are meant to be read by tools.
+func emitCompilerError(events *diagnostics.Writer, err error) {
+	emitDiagnostics(events, "", err)
+}
+
+// emitDiagnostics emits the diagnostics in err, for the package importPath if
+// it isn't known from the error itself.
+func emitDiagnostics(events *diagnostics.Writer, importPath string, err error) {
+	switch err := err.(type) {
+	case types.Error:
+		emitDiagnosticIn(events, importPath, diagnostics.FromScannerError(scanner.Error{
+			Pos: err.Fset.Position(err.Pos),
+			Msg: err.Msg,
+		}))
+	case scanner.Error:
+		emitDiagnosticIn(events, importPath, diagnostics.FromScannerError(err))
+	case scanner.ErrorList:
+		for _, scannerErr := range err {
+			emitDiagnosticIn(events, importPath, diagnostics.FromScannerError(*scannerErr))
+		}
+	case *interp.Error:
+		diagnostic := &diagnostics.Diagnostic{
+			Kind:     "error",
+			Pos:      diagnostics.NewPosition(err.Pos),
+			Message:  err.Err.Error(),
+			Severity: "error",
+		}
+		for _, line := range err.Traceback {
+			if pos := diagnostics.NewPosition(line.Pos); pos != nil {
+				diagnostic.Related = append(diagnostic.Related, pos)
+			}
+		}
+		emitDiagnosticIn(events, err.ImportPath, diagnostic)
+	case loader.Errors:
+		for _, e := range err.Errs {
+			emitDiagnostics(events, err.Pkg.ImportPath, e)
+		}
+	case loader.Error:
+		diagnostic := diagnostics.FromScannerError(err.Err)
+		diagnostic.Notes = append(diagnostic.Notes, "package "+err.ImportStack[0])
+		for _, pkgPath := range err.ImportStack[1:] {
+			diagnostic.Notes = append(diagnostic.Notes, "\timports "+pkgPath)
+		}
+		emitDiagnosticIn(events, importPath, diagnostic)
+	case *builder.MultiError:
+		for _, err := range err.Errs {
+			emitDiagnostics(events, importPath, err)
+		}
+	default:
+		emitDiagnosticIn(events, importPath, &diagnostics.Diagnostic{
+			Kind:     "error",
+			Message:  err.Error(),
+			Severity: "error",
+		})
+	}
+}
+
+// emitDiagnosticIn emits a single diagnostic for the given package.
+func emitDiagnosticIn(events *diagnostics.Writer, importPath string, diagnostic *diagnostics.Diagnostic) {
+	events.Emit(diagnostics.Event{
+		Action:     "diagnostic",
+		ImportPath: importPath,
+		Diagnostic: diagnostic,
+	})
+}
+
 func handleCompilerError(err error) {
 	if err != nil {
 		printCompilerError(func(args ...interface{}) {
@@ -1311,6 +1487,22 @@ func handleCompilerError(err error) {
 	}
 }
 
+// handleCommandResult is like handleCompilerError, but with -json (when events
+// is non-nil) it emits the error as diagnostics, followed by a "fail" or "pass"
+// event for the whole command.
+func handleCommandResult(events *diagnostics.Writer, err error) {
+	if events == nil {
+		handleCompilerError(err)
+		return
+	}
+	if err != nil {
+		emitCompilerError(events, err)
+		events.Emit(diagnostics.Event{Action: "fail"})
+		os.Exit(1)
+	}
+	events.Emit(diagnostics.Event{Action: "pass"})
+}
+
 // This is a special type for the -X flag to parse the pkgpath.Var=stringVal
 // format. It has to be a special type to allow multiple variables to be defined
 // this way.
@@ -1340,6 +1532,29 @@ func (m globalValuesFlag) Set(value string) error {
 	return nil
 }
 
+// maxAllocsFlag is the -max-allocs flag, in the pkgpath=N,pkgpath=N format. It
+// may be given multiple times.
+type maxAllocsFlag map[string]int
+
+func (m maxAllocsFlag) String() string {
+	return "pkgpath=N"
+}
+
+func (m maxAllocsFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		equalsIndex := strings.IndexByte(item, '=')
+		if equalsIndex <= 0 {
+			return errors.New("expected format pkgpath=N")
+		}
+		max, err := strconv.Atoi(item[equalsIndex+1:])
+		if err != nil || max < 0 {
+			return fmt.Errorf("invalid number of heap allocations for %s: %q", item[:equalsIndex], item[equalsIndex+1:])
+		}
+		m[item[:equalsIndex]] = max
+	}
+	return nil
+}
+
 // parseGoLinkFlag parses the -ldflags parameter. Its primary purpose right now
 // is the -X flag, for setting the value of global string variables.
 func parseGoLinkFlag(flagsString string) (map[string]map[string]string, error) {
@@ -1395,15 +1610,18 @@ func main() {
 	command := os.Args[1]
 
 	opt := flag.String("opt", "z", "optimization level: 0, 1, 2, s, z")
-	gc := flag.String("gc", "", "garbage collector to use (none, leaking, conservative)")
+	gc := flag.String("gc", "", "garbage collector to use (none, leaking, conservative, precise, incremental)")
 	panicStrategy := flag.String("panic", "print", "panic strategy (print, trap)")
 	scheduler := flag.String("scheduler", "", "which scheduler to use (none, tasks, asyncify)")
+	buildMode := flag.String("buildmode", "", "build mode to use (default, c-archive, c-shared)")
+	wasmBindings := flag.Bool("wasm-bindings", false, "generate an ES module and TypeScript declarations for exported functions (-target=wasm only)")
 	serial := flag.String("serial", "", "which serial output to use (none, uart, usb)")
 	work := flag.Bool("work", false, "print the name of the temporary build directory and do not delete this directory on exit")
 	interpTimeout := flag.Duration("interp-timeout", 180*time.Second, "interp optimization pass timeout")
 	var tags buildutil.TagsFlag
 	flag.Var(&tags, "tags", "a space-separated list of extra build tags")
 	target := flag.String("target", "", "chip/board name or JSON target specification file")
+	variant := flag.String("variant", "", "build variant from the project file ("+compileopts.ProjectFileName+")")
 	var stackSize uint64
 	flag.Func("stack-size", "goroutine stack size (if unknown at compile time)", func(s string) error {
 		size, err := bytesize.Parse(s)
@@ -1413,6 +1631,9 @@ func main() {
 	printSize := flag.String("size", "", "print sizes (none, short, full)")
 	printStacks := flag.Bool("print-stacks", false, "print stack sizes of goroutines")
 	printAllocsString := flag.String("print-allocs", "", "regular expression of functions for which heap allocations should be printed")
+	allocReport := flag.String("alloc-report", "", "write a report of all heap allocations to this file (.json or .html)")
+	maxAllocs := make(maxAllocsFlag)
+	flag.Var(maxAllocs, "max-allocs", "comma-separated list of pkgpath=N: fail the build if a package has more than N heap allocations (pkgpath may end in /...)")
 	printCommands := flag.Bool("x", false, "Print commands")
 	parallelism := flag.Int("p", runtime.GOMAXPROCS(0), "the number of build jobs that can run in parallel")
 	nodebug := flag.Bool("no-debug", false, "strip debug information")
@@ -1439,8 +1660,15 @@ func main() {
 	skipDwarf := flag.Bool("internal-nodwarf", false, "internal flag, use -no-debug instead")
 
 	var flagJSON, flagDeps, flagTest bool
-	if command == "help" || command == "list" || command == "info" || command == "build" {
+	switch command {
+	case "help", "list", "info":
 		flag.BoolVar(&flagJSON, "json", false, "print data in JSON format")
+	case "build", "run", "test", "flash":
+		flag.BoolVar(&flagJSON, "json", false, "print a stream of build events in JSON format")
+	}
+	var flagConfig bool
+	if command == "help" || command == "info" {
+		flag.BoolVar(&flagConfig, "config", false, "print the complete build configuration in JSON format")
 	}
 	if command == "help" || command == "list" {
 		flag.BoolVar(&flagDeps, "deps", false, "supply -deps flag to go list")
@@ -1478,6 +1706,48 @@ func main() {
 	}
 
 	flag.CommandLine.Parse(os.Args[2:])
+
+	// Use the settings from the project file for all flags that weren't given
+	// on the command line.
+	var project *compileopts.Project
+	switch command {
+	case "build", "run", "test", "flash", "gdb", "lldb", "info", "list":
+		var err error
+		project, err = compileopts.LoadProject(".")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if project == nil {
+			if *variant != "" {
+				fmt.Fprintf(os.Stderr, "-variant=%s: no %s found\n", *variant, compileopts.ProjectFileName)
+				os.Exit(1)
+			}
+			break
+		}
+		if *variant == "" {
+			*variant = project.Default
+		}
+		resolved, err := project.Resolve(*variant)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		explicitFlags := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) {
+			explicitFlags[f.Name] = true
+		})
+		for name, value := range resolved.Flags() {
+			if explicitFlags[name] {
+				continue
+			}
+			if err := flag.Set(name, value); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: invalid value %q for %s: %v\n", project.Path, value, name, err)
+				os.Exit(1)
+			}
+		}
+	}
+
 	globalVarValues, err := parseGoLinkFlag(*ldflags)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -1508,6 +1778,8 @@ func main() {
 		GC:              *gc,
 		PanicStrategy:   *panicStrategy,
 		Scheduler:       *scheduler,
+		BuildMode:       *buildMode,
+		WasmBindings:    *wasmBindings,
 		Serial:          *serial,
 		Work:            *work,
 		InterpTimeout:   *interpTimeout,
@@ -1520,6 +1792,8 @@ func main() {
 		PrintSizes:      *printSize,
 		PrintStacks:     *printStacks,
 		PrintAllocs:     printAllocs,
+		AllocReport:     *allocReport,
+		MaxAllocs:       maxAllocs,
 		Tags:            []string(tags),
 		TestConfig:      testConfig,
 		GlobalValues:    globalVarValues,
@@ -1534,6 +1808,12 @@ func main() {
 	if *printCommands {
 		options.PrintCommands = printCommand
 	}
+	if flagJSON {
+		switch command {
+		case "build", "run", "test", "flash":
+			options.Events = diagnostics.NewWriter(os.Stdout)
+		}
+	}
 
 	err = options.Verify()
 	if err != nil {
@@ -1571,7 +1851,7 @@ func main() {
 		}
 
 		err := Build(pkgName, outpath, options)
-		handleCompilerError(err)
+		handleCommandResult(options.Events, err)
 	case "build-library":
 		// Note: this command is only meant to be used while making a release!
 		if outpath == "" {
@@ -1620,7 +1900,7 @@ func main() {
 		pkgName := filepath.ToSlash(flag.Arg(0))
 		if command == "flash" {
 			err := Flash(pkgName, *port, options)
-			handleCompilerError(err)
+			handleCommandResult(options.Events, err)
 		} else {
 			if !options.Debug {
 				fmt.Fprintln(os.Stderr, "Debug disabled while running debugger?")
@@ -1638,7 +1918,7 @@ func main() {
 		}
 		pkgName := filepath.ToSlash(flag.Arg(0))
 		err := Run(pkgName, options, flag.Args()[1:])
-		handleCompilerError(err)
+		handleCommandResult(options.Events, err)
 	case "test":
 		var pkgNames []string
 		for i := 0; i < flag.NArg(); i++ {
@@ -1659,6 +1939,13 @@ func main() {
 			os.Exit(1)
 		}
 
+		if options.AllocReport != "" && len(explicitPkgNames) > 1 {
+			// The test binaries are built in parallel, and would all write
+			// their report to the same file.
+			fmt.Println("cannot use -alloc-report flag with multiple packages")
+			os.Exit(1)
+		}
+
 		fail := make(chan struct{}, 1)
 		var wg sync.WaitGroup
 		bufs := make([]testOutputBuf, len(explicitPkgNames))
@@ -1698,6 +1985,15 @@ func main() {
 				defer close(buf.done)
 				stdout := (*testStdout)(buf)
 				stderr := (*testStderr)(buf)
+				options := options
+				if options.Events != nil {
+					// Write the events of this package to its output
+					// buffer, so they don't get mixed with those of other
+					// packages.
+					pkgOptions := *options
+					pkgOptions.Events = diagnostics.NewWriter(stdout)
+					options = &pkgOptions
+				}
 				passed, err := Test(pkgName, stdout, stderr, options, outpath)
 				if err != nil {
 					printCompilerError(func(args ...interface{}) {
@@ -1723,33 +2019,52 @@ func main() {
 		err := Monitor("", *port, options)
 		handleCompilerError(err)
 	case "targets":
-		dir := filepath.Join(goenv.Get("TINYGOROOT"), "targets")
-		entries, err := ioutil.ReadDir(dir)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "could not list targets:", err)
-			os.Exit(1)
-			return
-		}
-		for _, entry := range entries {
-			if !entry.Mode().IsRegular() || !strings.HasSuffix(entry.Name(), ".json") {
-				// Only inspect JSON files.
+		// List the targets in all directories of the target search path. A
+		// target earlier in the search path hides targets with the same name
+		// later in the search path.
+		seen := map[string]bool{}
+		builtinDir := filepath.Join(goenv.Get("TINYGOROOT"), "targets")
+		for _, dir := range compileopts.TargetSearchPath(".") {
+			entries, err := os.ReadDir(dir)
+			if errors.Is(err, fs.ErrNotExist) {
 				continue
 			}
-			path := filepath.Join(dir, entry.Name())
-			spec, err := compileopts.LoadTarget(&compileopts.Options{Target: path})
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "could not list target:", err)
+				fmt.Fprintln(os.Stderr, "could not list targets:", err)
 				os.Exit(1)
 				return
 			}
-			if spec.FlashMethod == "" && spec.FlashCommand == "" && spec.Emulator == "" {
-				// This doesn't look like a regular target file, but rather like
-				// a parent target (such as targets/cortex-m.json).
-				continue
+			for _, entry := range entries {
+				if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".json") {
+					// Only inspect JSON files.
+					continue
+				}
+				name := entry.Name()
+				name = name[:len(name)-5]
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				path := filepath.Join(dir, entry.Name())
+				spec, err := compileopts.LoadTarget(&compileopts.Options{Target: path})
+				if err != nil && dir != builtinDir {
+					// A broken custom target (or a JSON file that isn't a
+					// target at all) shouldn't hide all the other targets.
+					fmt.Fprintln(os.Stderr, "warning: skipping target:", err)
+					continue
+				}
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "could not list target:", err)
+					os.Exit(1)
+					return
+				}
+				if spec.FlashMethod == "" && spec.FlashCommand == "" && spec.Emulator == "" {
+					// This doesn't look like a regular target file, but rather like
+					// a parent target (such as targets/cortex-m.json).
+					continue
+				}
+				fmt.Println(name)
 			}
-			name := entry.Name()
-			name = name[:len(name)-5]
-			fmt.Println(name)
 		}
 	case "info":
 		if flag.NArg() == 1 {
@@ -1765,6 +2080,16 @@ func main() {
 			usage(command)
 			os.Exit(1)
 		}
+		if flagConfig {
+			// The whole configuration, as tinygo build -json printed it
+			// before -json became an event stream.
+			data, err := json.MarshalIndent(config, "", "  ")
+			if err != nil {
+				handleCompilerError(err)
+			}
+			fmt.Printf("%s\n", data)
+			return
+		}
 		config.GoMinorVersion = 0 // this avoids creating the list of Go1.x build tags.
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -1775,34 +2100,59 @@ func main() {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+		var projectPath string
+		if project != nil {
+			projectPath = project.Path
+		}
 		if flagJSON {
 			json, _ := json.MarshalIndent(struct {
-				GOROOT     string   `json:"goroot"`
-				GOOS       string   `json:"goos"`
-				GOARCH     string   `json:"goarch"`
-				GOARM      string   `json:"goarm"`
-				BuildTags  []string `json:"build_tags"`
-				GC         string   `json:"garbage_collector"`
-				Scheduler  string   `json:"scheduler"`
-				LLVMTriple string   `json:"llvm_triple"`
+				ProjectFile string   `json:"project_file,omitempty"`
+				Variant     string   `json:"variant,omitempty"`
+				Target      string   `json:"target,omitempty"`
+				GOROOT      string   `json:"goroot"`
+				GOOS        string   `json:"goos"`
+				GOARCH      string   `json:"goarch"`
+				GOARM       string   `json:"goarm"`
+				BuildTags   []string `json:"build_tags"`
+				GC          string   `json:"garbage_collector"`
+				Scheduler   string   `json:"scheduler"`
+				Serial      string   `json:"serial"`
+				Opt         string   `json:"optimization"`
+				LLVMTriple  string   `json:"llvm_triple"`
 			}{
-				GOROOT:     cachedGOROOT,
-				GOOS:       config.GOOS(),
-				GOARCH:     config.GOARCH(),
-				GOARM:      config.GOARM(),
-				BuildTags:  config.BuildTags(),
-				GC:         config.GC(),
-				Scheduler:  config.Scheduler(),
-				LLVMTriple: config.Triple(),
+				ProjectFile: projectPath,
+				Variant:     *variant,
+				Target:      options.Target,
+				GOROOT:      cachedGOROOT,
+				GOOS:        config.GOOS(),
+				GOARCH:      config.GOARCH(),
+				GOARM:       config.GOARM(),
+				BuildTags:   config.BuildTags(),
+				GC:          config.GC(),
+				Scheduler:   config.Scheduler(),
+				Serial:      config.Serial(),
+				Opt:         options.Opt,
+				LLVMTriple:  config.Triple(),
 			}, "", "  ")
 			fmt.Println(string(json))
 		} else {
+			if project != nil {
+				fmt.Printf("project file:      %s\n", projectPath)
+				if *variant != "" {
+					fmt.Printf("variant:           %s\n", *variant)
+				}
+			}
+			if options.Target != "" {
+				fmt.Printf("target:            %s\n", options.Target)
+			}
 			fmt.Printf("LLVM triple:       %s\n", config.Triple())
 			fmt.Printf("GOOS:              %s\n", config.GOOS())
 			fmt.Printf("GOARCH:            %s\n", config.GOARCH())
 			fmt.Printf("build tags:        %s\n", strings.Join(config.BuildTags(), " "))
 			fmt.Printf("garbage collector: %s\n", config.GC())
 			fmt.Printf("scheduler:         %s\n", config.Scheduler())
+			fmt.Printf("serial:            %s\n", config.Serial())
+			fmt.Printf("optimization:      %s\n", options.Opt)
 			fmt.Printf("cached GOROOT:     %s\n", cachedGOROOT)
 		}
 	case "list":
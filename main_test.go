@@ -6,12 +6,17 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"go/scanner"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
@@ -22,6 +27,7 @@ import (
 
 	"github.com/tinygo-org/tinygo/builder"
 	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/diagnostics"
 	"github.com/tinygo-org/tinygo/goenv"
 )
 
@@ -43,6 +49,7 @@ func TestBuild(t *testing.T) {
 
 	tests := []string{
 		"alias.go",
+		"arena.go",
 		"atomic.go",
 		"binop.go",
 		"calls.go",
@@ -105,6 +112,21 @@ func TestBuild(t *testing.T) {
 			runTestWithConfig("print.go", t, opts, nil, nil)
 		})
 
+		// Test the incremental GC, including the write barriers for atomic
+		// pointer operations.
+		t.Run("gc=incremental", func(t *testing.T) {
+			t.Parallel()
+			for _, name := range []string{"atomic.go", "gc.go", "map.go"} {
+				name := name
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+					opts := optionsFromTarget("", sema)
+					opts.GC = "incremental"
+					runTestWithConfig(name, t, opts, nil, nil)
+				})
+			}
+		})
+
 		t.Run("ldflags", func(t *testing.T) {
 			t.Parallel()
 			opts := optionsFromTarget("", sema)
@@ -126,6 +148,12 @@ func TestBuild(t *testing.T) {
 	t.Run("EmulatedCortexM3", func(t *testing.T) {
 		t.Parallel()
 		runPlatTests(optionsFromTarget("cortex-m-qemu", sema), tests, t)
+
+		// Test a heap that is split over two memory regions.
+		t.Run("heapregions.go", func(t *testing.T) {
+			t.Parallel()
+			runTest("heapregions.go", optionsFromTarget("testdata/heapregions.json", sema), t, nil, nil)
+		})
 	})
 
 	t.Run("EmulatedRISCV", func(t *testing.T) {
@@ -242,6 +270,279 @@ func runPlatTests(options compileopts.Options, tests []string, t *testing.T) {
 			t.Parallel()
 			runTest("recover.go", options, t, nil, nil)
 		})
+		t.Run("arena_overflow.go", func(t *testing.T) {
+			t.Parallel()
+			runTest("arena_overflow.go", options, t, nil, nil)
+		})
+	}
+}
+
+// Test a WebAssembly reactor module with a //go:wasmexport function that
+// blocks.
+func TestWasmExport(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("wasmtime"); err != nil {
+		t.Skip("wasmtime not installed")
+	}
+
+	options := optionsFromTarget("wasi", sema)
+	options.BuildMode = "c-shared"
+	config, err := builder.NewConfig(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := builder.Build("./"+TESTDATA+"/wasmexport.go", "", t.TempDir(), config)
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	// wasmtime calls _initialize before invoking the function.
+	out, err := exec.Command("wasmtime", "run", "--invoke", "add", result.Binary, "3", "4").Output()
+	if err != nil {
+		t.Fatal("failed to run:", err)
+	}
+	if strings.TrimSpace(string(out)) != "17" {
+		t.Errorf("expected add(3, 4) to return 17, got %q", out)
+	}
+}
+
+// Test accepting a connection on a socket that is passed to a WASI program by
+// the runtime.
+func TestWasiListen(t *testing.T) {
+	t.Parallel()
+
+	cmd, addr, output := startWasiListener(t, "wasilisten.go")
+	defer cmd.Process.Kill()
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte("gopher\n")); err != nil {
+		t.Fatal("failed to write:", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal("failed to read:", err)
+	}
+	if reply != "hello, gopher\n" {
+		t.Errorf("unexpected reply: %q", reply)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("wasmtime failed: %v\n%s", err, output)
+	}
+	if strings.TrimSpace(output.String()) != "served gopher" {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+// Test an HTTP server that uses a socket passed to a WASI program by the
+// runtime.
+func TestWasiHTTP(t *testing.T) {
+	t.Parallel()
+
+	cmd, addr, _ := startWasiListener(t, "wasihttp.go")
+	defer cmd.Process.Kill()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var err error
+	for i := 0; i < 100; i++ {
+		var conn net.Conn
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	// The first two requests share a connection, the third one uses a new
+	// connection.
+	for i, name := range []string{"gopher", "tinygo", "wasi"} {
+		if i == 2 {
+			client.CloseIdleConnections()
+		}
+		resp, err := client.Get("http://" + addr + "/hello?name=" + name)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("failed to read response %d: %v", i, err)
+		}
+		if resp.StatusCode != http.StatusOK || string(body) != "hello, "+name+"\n" {
+			t.Errorf("unexpected response %d: %s %q", i, resp.Status, body)
+		}
+	}
+}
+
+// startWasiListener builds the given test program for WASI and runs it in
+// wasmtime with a listening socket. It returns the running command, the
+// address of the socket and the output of the program.
+func startWasiListener(t *testing.T, name string) (*exec.Cmd, string, *bytes.Buffer) {
+	t.Helper()
+
+	if _, err := exec.LookPath("wasmtime"); err != nil {
+		t.Skip("wasmtime not installed")
+	}
+
+	options := optionsFromTarget("wasi", sema)
+	config, err := builder.NewConfig(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := builder.Build("./"+TESTDATA+"/"+name, "", t.TempDir(), config)
+	if err != nil {
+		printCompilerError(t.Log, err)
+		t.FailNow()
+	}
+
+	// Find a free port for wasmtime to listen on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cmd := exec.Command("wasmtime", "run", "--tcplisten", addr, result.Binary)
+	output := &bytes.Buffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		t.Fatal("failed to start wasmtime:", err)
+	}
+	return cmd, addr, output
+}
+
+// Test building a C library with -buildmode=c-archive and -buildmode=c-shared,
+// and calling it from a C program.
+func TestBuildModeLibrary(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("libraries are only supported on linux")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler installed")
+	}
+	expected, err := os.ReadFile(TESTDATA + "/library.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{"c-archive", "c-shared"} {
+		mode := mode
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+			options := optionsFromTarget("", sema)
+			options.BuildMode = mode
+			config, err := builder.NewConfig(&options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmpdir := t.TempDir()
+			result, err := builder.Build("./"+TESTDATA+"/library.go", "", tmpdir, config)
+			if err != nil {
+				printCompilerError(t.Log, err)
+				t.FailNow()
+			}
+			if config.Scheduler() != "none" {
+				t.Errorf("library uses scheduler %s", config.Scheduler())
+			}
+
+			// The C program includes the header under the name the tinygo
+			// command gives it.
+			if err := moveFile(result.Header, tmpdir+"/library.h"); err != nil {
+				t.Fatal(err)
+			}
+			program := tmpdir + "/library"
+			cmd := exec.Command(cc, "-o", program, "-I", tmpdir, TESTDATA+"/library.c", result.Binary)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("failed to link the library: %v\n%s", err, out)
+			}
+			out, err := exec.Command(program).CombinedOutput()
+			if err != nil {
+				t.Fatalf("failed to run: %v\n%s", err, out)
+			}
+			if !bytes.Equal(out, expected) {
+				t.Errorf("unexpected output:\n%s\nexpected:\n%s", out, expected)
+			}
+		})
+	}
+}
+
+func TestMaxAllocs(t *testing.T) {
+	t.Parallel()
+
+	// Build the program with a budget of zero heap allocations in package
+	// main, which it exceeds.
+	tmpdir := t.TempDir()
+	options := optionsFromTarget("", sema)
+	options.AllocReport = filepath.Join(tmpdir, "allocs.json")
+	options.MaxAllocs = map[string]int{"main": 0}
+	config, err := builder.NewConfig(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = builder.Build("./"+TESTDATA+"/allocbudget.go", "", tmpdir, config)
+	if err == nil {
+		t.Fatal("expected the build to fail with -max-allocs=main=0")
+	}
+	errs := []error{err}
+	if err, ok := err.(*builder.MultiError); ok {
+		errs = err.Errs
+	}
+	for _, err := range errs {
+		err, ok := err.(scanner.Error)
+		if !ok || !strings.Contains(err.Msg, "max-allocs for main is 0") {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		if filepath.Base(err.Pos.Filename) != "allocbudget.go" || err.Pos.Line != 9 {
+			t.Errorf("unexpected position of heap allocation: %s", err.Pos)
+		}
+	}
+
+	// The report is written before the budget is checked.
+	data, err := os.ReadFile(options.AllocReport)
+	if err != nil {
+		t.Fatal("could not read allocation report:", err)
+	}
+	var report diagnostics.AllocReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal("could not parse allocation report:", err)
+	}
+	if report.Packages["main"] != len(errs) {
+		t.Errorf("report has %d heap allocations in main, but there were %d errors", report.Packages["main"], len(errs))
+	}
+
+	// The program builds within a budget that allows these allocations.
+	options.AllocReport = ""
+	options.MaxAllocs = map[string]int{"main": report.Packages["main"]}
+	config, err = builder.NewConfig(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Build("./"+TESTDATA+"/allocbudget.go", "", tmpdir, config); err != nil {
+		printCompilerError(t.Log, err)
+		t.Error("build failed within the allocation budget")
 	}
 }
 
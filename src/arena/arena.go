@@ -0,0 +1,226 @@
+// Package arena provides memory arenas and fixed-size object pools, for code
+// that must not do any work in the garbage collector.
+//
+// This package implements the API of the experimental upstream Go arena
+// package (NewArena, New, MakeSlice, Clone, Arena.Free) with a few TinyGo
+// specific additions: arenas that can be reset and reused (Arena.Reset),
+// arenas in a fixed buffer (NewArenaBuffer), and fixed-size object pools
+// (Pool).
+//
+// Memory for an arena is allocated from the heap in large chunks. The garbage
+// collector only sees these chunks: it doesn't track individual objects in an
+// arena, so allocating from an arena that has enough space left is just a
+// pointer increment. A chunk is scanned as a whole, so objects in an arena may
+// point to heap objects. An arena in a buffer that isn't on the heap (such as a
+// global array) doesn't use the heap at all.
+//
+// Unlike upstream Go, memory of an arena that has been freed is not unmapped.
+// Instead, it stays valid as long as it is referenced, just like regular heap
+// memory. Memory of an arena that has been reset is reused however, so it must
+// not be used anymore after the reset.
+package arena
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// defaultChunkSize is the minimum size of the chunks that an arena allocates
+// from the heap.
+const defaultChunkSize = 1024
+
+// Arena is a memory arena: a region of memory from which objects can be
+// allocated very quickly, and which are all freed at the same time.
+//
+// An Arena is not safe for concurrent use.
+type Arena struct {
+	first   *chunk  // first chunk, or nil if nothing was allocated yet
+	current *chunk  // chunk that is currently being allocated from
+	offset  uintptr // offset of the first free byte in current
+	fixed   bool    // whether the arena is backed by a fixed buffer
+}
+
+// chunk is a contiguous piece of arena memory. The chunk header is followed by
+// size bytes of memory that are used for arena objects.
+type chunk struct {
+	next *chunk
+	size uintptr
+}
+
+const chunkHeaderSize = unsafe.Sizeof(chunk{})
+
+//go:linkname alloc runtime.alloc
+func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer
+
+//go:linkname memzero runtime.memzero
+func memzero(ptr unsafe.Pointer, size uintptr)
+
+// zeroSizedAlloc is returned for allocations of zero bytes.
+var zeroSizedAlloc uint8
+
+// NewArena allocates a new arena. Memory is allocated from the heap as needed.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// NewArenaSize allocates a new arena with at least size bytes of memory
+// available. The memory is allocated immediately, so allocating up to size
+// bytes from the arena (including alignment padding) doesn't need the heap.
+func NewArenaSize(size int) *Arena {
+	a := &Arena{}
+	a.first = newChunk(uintptr(size))
+	a.current = a.first
+	return a
+}
+
+// NewArenaBuffer creates an arena that allocates from buf. It never uses the
+// heap: allocations that don't fit in buf cause a panic. The buffer should not
+// be on the heap (for example, a global array) when objects in the arena point
+// to heap objects, otherwise a precise garbage collector may not see these
+// pointers.
+func NewArenaBuffer(buf []byte) *Arena {
+	if uintptr(len(buf)) < chunkHeaderSize+unsafe.Alignof(uintptr(0)) {
+		panic("arena: buffer too small")
+	}
+	// Align the chunk header.
+	start := unsafe.Pointer(&buf[0])
+	pad := alignUp(uintptr(start), unsafe.Alignof(chunk{})) - uintptr(start)
+	c := (*chunk)(unsafe.Add(start, pad))
+	c.next = nil
+	c.size = uintptr(len(buf)) - pad - chunkHeaderSize
+	return &Arena{
+		first:   c,
+		current: c,
+		fixed:   true,
+	}
+}
+
+// Free frees all objects in the arena. The arena can still be used afterwards,
+// and will then allocate new memory.
+//
+// Existing objects are not actually freed until they are not referenced
+// anymore, see the package documentation.
+func (a *Arena) Free() {
+	if a.fixed {
+		// There is no other memory to use.
+		a.Reset()
+		return
+	}
+	a.first = nil
+	a.current = nil
+	a.offset = 0
+}
+
+// Reset frees all objects in the arena, keeping the memory for new objects.
+// Once an arena has grown big enough, allocating from it after a reset won't
+// need the heap. Objects that were allocated before the reset must not be used
+// anymore.
+func (a *Arena) Reset() {
+	a.current = a.first
+	a.offset = 0
+}
+
+// allocate allocates size bytes with the given alignment from the arena. The
+// returned memory is zeroed.
+func (a *Arena) allocate(size, align uintptr) unsafe.Pointer {
+	if size == 0 {
+		return unsafe.Pointer(&zeroSizedAlloc)
+	}
+	for {
+		if a.current != nil {
+			data := uintptr(unsafe.Pointer(a.current)) + chunkHeaderSize
+			start := alignUp(data+a.offset, align) - data
+			if start <= a.current.size && size <= a.current.size-start {
+				a.offset = start + size
+				ptr := unsafe.Pointer(uintptr(unsafe.Pointer(a.current)) + chunkHeaderSize + start)
+				memzero(ptr, size)
+				return ptr
+			}
+		}
+
+		// The current chunk is full, go to the next one.
+		if a.current != nil && a.current.next != nil {
+			a.current = a.current.next
+			a.offset = 0
+			continue
+		}
+		if a.fixed || size > ^uintptr(0)-chunkHeaderSize-align {
+			panic("arena: out of memory")
+		}
+		c := newChunk(size + align)
+		if a.current == nil {
+			a.first = c
+		} else {
+			a.current.next = c
+		}
+		a.current = c
+		a.offset = 0
+	}
+}
+
+// newChunk allocates a new chunk from the heap with at least size bytes of
+// memory. The chunk is a single heap object that the garbage collector scans
+// for pointers.
+func newChunk(size uintptr) *chunk {
+	if size < defaultChunkSize {
+		size = defaultChunkSize
+	}
+	c := (*chunk)(alloc(chunkHeaderSize+size, nil))
+	c.size = size
+	return c
+}
+
+func alignUp(n, align uintptr) uintptr {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// New creates a new *T in the provided arena. The *T must not be used after
+// the arena is reset.
+func New[T any](a *Arena) *T {
+	var zero T
+	return (*T)(a.allocate(unsafe.Sizeof(zero), unsafe.Alignof(zero)))
+}
+
+// MakeSlice creates a new []T with the provided capacity and length in the
+// provided arena. The []T must not be used after the arena is reset.
+func MakeSlice[T any](a *Arena, len, cap int) []T {
+	if len < 0 || cap < len {
+		panic("arena: invalid slice length or capacity")
+	}
+	var zero T
+	size := unsafe.Sizeof(zero)
+	if size != 0 && uintptr(cap) > ^uintptr(0)/size {
+		panic("makeslice: cap out of range")
+	}
+	ptr := a.allocate(size*uintptr(cap), unsafe.Alignof(zero))
+	return unsafe.Slice((*T)(ptr), cap)[:len]
+}
+
+// Clone makes a shallow copy of the input value that is no longer bound to any
+// arena it may have been allocated from, returning the copy. It only supports
+// pointers, slices, and strings.
+func Clone[T any](s T) T {
+	v := reflect.ValueOf(s)
+	var c reflect.Value
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return s
+		}
+		c = reflect.New(v.Type().Elem())
+		c.Elem().Set(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return s
+		}
+		c = reflect.MakeSlice(v.Type(), v.Cap(), v.Cap())
+		reflect.Copy(c, v.Slice(0, v.Cap()))
+		c = c.Slice(0, v.Len())
+	case reflect.String:
+		c = reflect.New(v.Type()).Elem()
+		c.SetString(string([]byte(v.String())))
+	default:
+		panic("arena: Clone only supports pointers, slices, and strings")
+	}
+	return c.Interface().(T)
+}
@@ -0,0 +1,109 @@
+package arena
+
+import (
+	"runtime/interrupt"
+	"unsafe"
+)
+
+// Pool is a fixed-size pool of objects of type T. All objects are allocated at
+// once when the pool is created, as a single heap object. Getting objects from
+// and returning objects to the pool never allocates and doesn't involve the
+// garbage collector.
+//
+// Unlike sync.Pool, objects are never removed from the pool by the garbage
+// collector. Get and Put disable interrupts while they update the pool, so a
+// pool can be shared with interrupt handlers.
+type Pool[T any] struct {
+	objects []T
+	free    []*T    // stack of objects that are not in use
+	inUse   []uint8 // bitmap of objects handed out by Get, to detect double Put
+}
+
+// NewPool creates a pool with room for n objects.
+func NewPool[T any](n int) *Pool[T] {
+	p := &Pool[T]{
+		objects: make([]T, n),
+		free:    make([]*T, n),
+		inUse:   make([]uint8, (n+7)/8),
+	}
+	// Hand out the objects in order.
+	for i := range p.objects {
+		p.free[n-1-i] = &p.objects[i]
+	}
+	return p
+}
+
+// Get returns a zeroed object from the pool, or nil if all objects are in use.
+func (p *Pool[T]) Get() *T {
+	mask := interrupt.Disable()
+	n := len(p.free)
+	if n == 0 {
+		interrupt.Restore(mask)
+		return nil
+	}
+	obj := p.free[n-1]
+	p.free[n-1] = nil
+	p.free = p.free[:n-1]
+	index, _ := p.index(obj)
+	p.inUse[index/8] |= 1 << (index % 8)
+	interrupt.Restore(mask)
+
+	var zero T
+	*obj = zero
+	return obj
+}
+
+// Put returns an object to the pool. The object must have been returned by Get
+// on the same pool, and must not be used anymore afterwards.
+func (p *Pool[T]) Put(obj *T) {
+	index, ok := p.index(obj)
+	if !ok {
+		panic("arena: object does not belong to this pool")
+	}
+	mask := interrupt.Disable()
+	if unsafe.Sizeof(*obj) == 0 {
+		// All zero-sized objects have the same address, so they can't be
+		// told apart. Only check that no more objects are returned than
+		// were taken.
+		if len(p.free) == cap(p.free) {
+			interrupt.Restore(mask)
+			panic("arena: pool overflow")
+		}
+	} else if p.inUse[index/8]&(1<<(index%8)) == 0 {
+		interrupt.Restore(mask)
+		panic("arena: object returned to pool twice")
+	}
+	p.inUse[index/8] &^= 1 << (index % 8)
+	n := len(p.free)
+	p.free = p.free[:n+1]
+	p.free[n] = obj
+	interrupt.Restore(mask)
+}
+
+// index returns the index of obj in the pool, and whether obj points to one of
+// the objects in the pool.
+func (p *Pool[T]) index(obj *T) (int, bool) {
+	if len(p.objects) == 0 || obj == nil {
+		return 0, false
+	}
+	size := unsafe.Sizeof(p.objects[0])
+	start := uintptr(unsafe.Pointer(&p.objects[0]))
+	offset := uintptr(unsafe.Pointer(obj)) - start
+	if size == 0 {
+		return 0, offset == 0
+	}
+	if offset >= size*uintptr(len(p.objects)) || offset%size != 0 {
+		return 0, false
+	}
+	return int(offset / size), true
+}
+
+// Len returns the number of objects that are available.
+func (p *Pool[T]) Len() int {
+	return len(p.free)
+}
+
+// Cap returns the total number of objects in the pool.
+func (p *Pool[T]) Cap() int {
+	return len(p.objects)
+}
@@ -0,0 +1,52 @@
+// This example sends CAN frames in loopback mode, so that they are received by
+// the same controller. It doesn't need a CAN bus or transceiver.
+package main
+
+import (
+	"machine"
+	"time"
+)
+
+func main() {
+	can := &machine.CAN1
+	err := can.Configure(machine.CANConfig{
+		TransferRate: machine.CANTransferRate500kbps,
+		Tx:           machine.CAN1_TX,
+		Rx:           machine.CAN1_RX,
+		Standby:      machine.NoPin,
+		Mode:         machine.CANModeLoopback,
+	})
+	if err != nil {
+		println("could not configure CAN:", err.Error())
+		return
+	}
+
+	// Only receive frames with an identifier in the range 0x120-0x12f.
+	can.SetFilters([]machine.CANFilter{{ID: 0x120, Mask: 0x7f0}})
+
+	go receive(can)
+
+	tx := machine.CANFrame{Length: 2}
+	for i := 0; ; i++ {
+		tx.ID = 0x100 + uint32(i%0x40)
+		tx.Data[0] = byte(i >> 8)
+		tx.Data[1] = byte(i)
+		if err := can.Transmit(&tx); err != nil {
+			println("transmit failed:", err.Error())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func receive(can *machine.CAN) {
+	var rx machine.CANFrame
+	for {
+		can.Receive(&rx)
+		counters := can.ErrorCounters()
+		print("received ", rx.ID, ":")
+		for _, b := range rx.Payload() {
+			print(" ", b)
+		}
+		println(" errors:", counters.TxErrors, counters.RxErrors)
+	}
+}
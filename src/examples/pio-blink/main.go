@@ -0,0 +1,75 @@
+//go:build rp2040
+
+package main
+
+// This example blinks the LED from a PIO state machine. The program is
+// assembled at runtime, the CPU only tells the state machine how long the LED
+// must be on and off.
+
+import (
+	"machine"
+	"machine/rp2040/pio"
+	"time"
+)
+
+const source = `
+.program blink
+    pull block
+    out y, 32       ; number of cycles the LED is on and off
+.wrap_target
+    mov x, y
+    set pins, 1
+lp1:
+    jmp x-- lp1     ; delay for (x + 1) cycles
+    mov x, y
+    set pins, 0
+lp2:
+    jmp x-- lp2
+.wrap
+`
+
+func main() {
+	programs, err := pio.Assemble(source)
+	if err != nil {
+		println("could not assemble:", err.Error())
+		return
+	}
+	prog := machine.PIOProgram(programs["blink"])
+	offset, err := machine.PIO0.AddProgram(&prog)
+	if err != nil {
+		println("could not load program:", err.Error())
+		return
+	}
+
+	sm, err := machine.PIO0.ClaimStateMachine()
+	if err != nil {
+		println("could not claim state machine:", err.Error())
+		return
+	}
+	machine.LED.Configure(machine.PinConfig{Mode: machine.PinPIO0})
+	err = sm.Configure(&prog, offset, machine.PIOStateMachineConfig{
+		Frequency: 2000,
+		SetBase:   machine.LED,
+		SetCount:  1,
+	})
+	if err != nil {
+		println("could not configure state machine:", err.Error())
+		return
+	}
+	sm.SetPinDirs(machine.LED, 1, true)
+	sm.SetEnabled(true)
+
+	// The state machine runs at 2kHz and each half period takes about y
+	// cycles, so the LED blinks at 1, 2 and 4Hz.
+	for {
+		for _, hz := range []uint32{1, 2, 4} {
+			sm.Put(1000 / hz)
+			time.Sleep(3 * time.Second)
+			// Restart the program so that it pulls the next delay.
+			sm.SetEnabled(false)
+			sm.Restart()
+			sm.Exec(pio.Jmp(pio.JmpAlways, offset))
+			sm.SetEnabled(true)
+		}
+	}
+}
@@ -1,8 +1,7 @@
-//go:build rp2040
-
 package main
 
-// This example demonstrates scheduling a delayed interrupt by real time clock.
+// This example demonstrates the real-time clock: setting the time, scheduling
+// a delayed interrupt and an alarm.
 //
 // An interrupt may execute user callback function or used for its side effects
 // like waking up from sleep or dormant states.
@@ -10,9 +9,6 @@ package main
 // The interrupt can be configured to repeat.
 //
 // There is no separate method to disable interrupt, use 0 delay for that.
-//
-// Unfortunately, it is not possible to use time.Duration to work with RTC directly,
-// that would introduce a circular dependency between "machine" and "time" packages.
 
 import (
 	"fmt"
@@ -22,14 +18,22 @@ import (
 
 func main() {
 
+	// Set the clock, for example to a time received from an NTP server or a
+	// GPS receiver. From now on time.Now returns the same time.
+	machine.RTC.SetTime(time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC))
+
 	// Schedule and enable recurring interrupt.
 	// The callback function is executed in the context of an interrupt handler,
 	// so regular restructions for this sort of code apply: no blocking, no memory allocation, etc.
 	delay := time.Minute + 12*time.Second
 	machine.RTC.SetInterrupt(uint32(delay.Seconds()), true, func() { println("Peekaboo!") })
 
+	// Schedule an alarm at a given time.
+	machine.RTC.SetAlarm(time.Date(2024, time.January, 1, 12, 2, 0, 0, time.UTC), func() { println("Alarm!") })
+
 	for {
-		fmt.Printf("%v\r\n", time.Now().Format(time.RFC3339))
+		t, _ := machine.RTC.Time()
+		fmt.Printf("%v %v\r\n", time.Now().Format(time.RFC3339), t.Format(time.RFC3339))
 		time.Sleep(1 * time.Second)
 	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"machine/usb/cdc/ncm"
+	"time"
+)
+
+// The board shows up as a USB network adapter. It answers ARP requests for
+// 192.168.7.2, so after giving the host side the address 192.168.7.1 the board
+// shows up in the ARP table of the host (arp -n).
+
+var (
+	mac = [6]byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	ip  = [4]byte{192, 168, 7, 2}
+
+	reply   [42]byte
+	pending bool
+)
+
+func main() {
+	ncm.Port().SetHandler(receive)
+	for {
+		if pending {
+			if err := ncm.Port().Send(reply[:]); err == nil {
+				pending = false
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// receive is called from an interrupt for every frame sent by the host.
+func receive(frame []byte) {
+	if len(frame) < 42 || pending {
+		return
+	}
+	// Ethernet type ARP, ARP request for our IP address.
+	if frame[12] != 0x08 || frame[13] != 0x06 || frame[21] != 1 || string(frame[38:42]) != string(ip[:]) {
+		return
+	}
+	copy(reply[0:6], frame[6:12]) // destination
+	copy(reply[6:12], mac[:])     // source
+	copy(reply[12:20], frame[12:20])
+	reply[21] = 2 // reply
+	copy(reply[22:28], mac[:])
+	copy(reply[28:32], ip[:])
+	copy(reply[32:42], frame[22:32]) // sender of the request
+	pending = true
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"machine"
+	"machine/usb/msc"
+	"time"
+)
+
+// Expose the flash memory that isn't used by the program as a USB drive. It
+// needs to be formatted (for example as FAT) the first time it is used.
+
+func main() {
+	led := machine.LED
+	led.Configure(machine.PinConfig{Mode: machine.PinOutput})
+
+	msc.Port().SetBlockDevice(machine.Flash)
+
+	for {
+		led.Set(!msc.Port().Ejected())
+		time.Sleep(100 * time.Millisecond)
+	}
+}
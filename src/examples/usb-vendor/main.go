@@ -0,0 +1,38 @@
+package main
+
+import (
+	"machine"
+	"machine/usb"
+	"time"
+)
+
+// A vendor specific interface with a pair of bulk endpoints, next to the
+// default serial port. Everything that is written to the Out endpoint is echoed
+// back on the In endpoint. It can be used with libusb, or with WebUSB after
+// adding the WebUSB descriptors.
+
+var vendor = machine.USBInterface{
+	Class: usb.DEVICE_CLASS_VENDOR_SPECIFIC,
+	Endpoints: []machine.USBEndpoint{
+		{Type: usb.ENDPOINT_TYPE_BULK, In: true},
+		{Type: usb.ENDPOINT_TYPE_BULK, RxHandler: echo},
+	},
+}
+
+func init() {
+	err := machine.AddUSBInterface(&vendor)
+	if err != nil {
+		println("could not add USB interface:", err.Error())
+	}
+}
+
+func echo(b []byte) {
+	machine.SendUSBInPacket(uint32(vendor.Endpoints[0].Number), b)
+}
+
+func main() {
+	for {
+		println("vendor interface", vendor.Number, "in", vendor.Endpoints[0].Number, "out", vendor.Endpoints[1].Number)
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"machine"
+	"time"
+)
+
+// The scheduler keeps the watchdog updated while the program sleeps. After ten
+// seconds the program gets stuck in a loop that never yields, so the watchdog
+// resets the chip.
+
+func main() {
+	println("reset cause:", machine.Watchdog.ResetCause().String())
+
+	machine.Watchdog.Configure(machine.WatchdogConfig{
+		TimeoutMillis:  1000,
+		UpdateWhenIdle: true,
+	})
+	machine.Watchdog.Start()
+
+	for i := 0; i < 10; i++ {
+		println("alive", i)
+		time.Sleep(time.Second)
+	}
+
+	println("getting stuck")
+	for {
+	}
+}
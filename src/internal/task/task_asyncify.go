@@ -116,8 +116,14 @@ func (t *Task) Resume() {
 	if t.state.asyncifysp > t.state.csp {
 		runtimePanic("stack overflow")
 	}
+
+	// The goroutine stack is a heap object and may have been modified.
+	gcWriteBarrier(unsafe.Pointer(t.state.asyncifysp))
 }
 
+//go:linkname gcWriteBarrier runtime.gcWriteBarrier
+func gcWriteBarrier(ptr unsafe.Pointer)
+
 //export tinygo_rewind
 func (*state) rewind()
 
@@ -67,6 +67,9 @@ func (t *Task) Resume() {
 	t.state.resume()
 	t.gcData.swap()
 	currentTask = nil
+
+	// The goroutine stack is a heap object and may have been modified.
+	gcWriteBarrier(unsafe.Pointer(t.state.canaryPtr))
 }
 
 // initialize the state and prepare to call the specified function with the specified argument bundle.
@@ -104,6 +107,9 @@ var startTask [0]uint8
 //go:linkname runqueuePushBack runtime.runqueuePushBack
 func runqueuePushBack(*Task)
 
+//go:linkname gcWriteBarrier runtime.gcWriteBarrier
+func gcWriteBarrier(ptr unsafe.Pointer)
+
 //go:linkname runtime_alloc runtime.alloc
 func runtime_alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer
 
@@ -1,35 +1,106 @@
 package machine
 
 import (
+	"runtime/interrupt"
 	"runtime/volatile"
 )
 
-const bufferSize = 128
+const (
+	bufferSize = 128
+
+	// maxBufferSize is the largest ring buffer, so that the distance between
+	// the head and tail index always fits in their 16 bits.
+	maxBufferSize = 32768
+)
 
 // RingBuffer is ring buffer implementation inspired by post at
 // https://www.embeddedrelated.com/showthread/comp.arch.embedded/77084-1.php
+//
+// One side (usually an interrupt handler) calls Put and the other side calls
+// Get, without further locking.
+//
+// The zero value is an empty ring buffer of 128 bytes. Its memory is allocated
+// on first use. Memory can't be allocated in an interrupt, so Put drops the
+// data when it is called from an interrupt before any other method: use
+// NewRingBuffer for a ring buffer that is filled by an interrupt handler.
 type RingBuffer struct {
-	rxbuffer [bufferSize]volatile.Register8
-	head     volatile.Register8
-	tail     volatile.Register8
+	rxbuffer []volatile.Register8
+	head     volatile.Register16
+	tail     volatile.Register16
 }
 
-// NewRingBuffer returns a new ring buffer.
+// NewRingBuffer returns a new ring buffer of 128 bytes.
 func NewRingBuffer() *RingBuffer {
-	return &RingBuffer{}
+	return NewRingBufferSize(bufferSize)
+}
+
+// NewRingBufferSize returns a new ring buffer that holds at least size bytes.
+// The size is rounded up to a power of two, with a maximum of 32768 bytes.
+func NewRingBufferSize(size int) *RingBuffer {
+	return &RingBuffer{
+		rxbuffer: make([]volatile.Register8, ringBufferSize(size)),
+	}
+}
+
+// ringBufferSize returns the size NewRingBufferSize uses for the requested
+// size.
+func ringBufferSize(size int) int {
+	n := 1
+	for n < size && n < maxBufferSize {
+		n <<= 1
+	}
+	return n
 }
 
-// Used returns how many bytes in buffer have been used.
+// buffer returns the memory of the ring buffer, allocating the default size
+// for a zero RingBuffer. It returns nil when that isn't possible because it is
+// called from an interrupt.
+func (rb *RingBuffer) buffer() []volatile.Register8 {
+	if rb.rxbuffer == nil && !interrupt.In() {
+		buf := make([]volatile.Register8, bufferSize)
+		// An interrupt handler may use the ring buffer at the same time, so it
+		// must not see a partially written slice.
+		mask := interrupt.Disable()
+		if rb.rxbuffer == nil {
+			rb.rxbuffer = buf
+		}
+		interrupt.Restore(mask)
+	}
+	return rb.rxbuffer
+}
+
+// Size returns how many bytes the buffer can hold.
+func (rb *RingBuffer) Size() int {
+	return len(rb.buffer())
+}
+
+// Used returns how many bytes in buffer have been used, up to 255. Use Len for
+// ring buffers that are bigger than that.
 func (rb *RingBuffer) Used() uint8 {
-	return uint8(rb.head.Get() - rb.tail.Get())
+	if n := rb.Len(); n < 255 {
+		return uint8(n)
+	}
+	return 255
+}
+
+// Len returns how many bytes in buffer have been used.
+func (rb *RingBuffer) Len() int {
+	// The indices are 16 bits, which isn't atomic on 8-bit chips.
+	mask := interrupt.Disable()
+	used := rb.head.Get() - rb.tail.Get()
+	interrupt.Restore(mask)
+	return int(used)
 }
 
 // Put stores a byte in the buffer. If the buffer is already
 // full, the method will return false.
 func (rb *RingBuffer) Put(val byte) bool {
-	if rb.Used() != bufferSize {
-		rb.head.Set(rb.head.Get() + 1)
-		rb.rxbuffer[rb.head.Get()%bufferSize].Set(val)
+	buf := rb.buffer()
+	if rb.Len() != len(buf) {
+		// Store the byte before publishing it to the reader.
+		head := rb.head.Get()
+		buf[int(head)&(len(buf)-1)].Set(val)
+		rb.head.Set(head + 1)
 		return true
 	}
 	return false
@@ -38,15 +109,20 @@ func (rb *RingBuffer) Put(val byte) bool {
 // Get returns a byte from the buffer. If the buffer is empty,
 // the method will return a false as the second value.
 func (rb *RingBuffer) Get() (byte, bool) {
-	if rb.Used() != 0 {
-		rb.tail.Set(rb.tail.Get() + 1)
-		return rb.rxbuffer[rb.tail.Get()%bufferSize].Get(), true
+	if rb.Len() != 0 {
+		buf := rb.buffer()
+		tail := rb.tail.Get()
+		val := buf[int(tail)&(len(buf)-1)].Get()
+		rb.tail.Set(tail + 1)
+		return val, true
 	}
 	return 0, false
 }
 
 // Clear resets the head and tail pointer to zero.
 func (rb *RingBuffer) Clear() {
+	mask := interrupt.Disable()
 	rb.head.Set(0)
 	rb.tail.Set(0)
+	interrupt.Restore(mask)
 }
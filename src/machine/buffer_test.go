@@ -0,0 +1,124 @@
+//go:build !baremetal
+
+package machine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRingBufferWraparound(t *testing.T) {
+	rb := NewRingBufferSize(4)
+	next := byte(0)
+	expected := byte(0)
+	// Fill and drain the buffer many times, so that the indices wrap around
+	// the buffer and around their 16 bits.
+	for i := 0; i < 70000; i++ {
+		for rb.Put(next) {
+			next++
+		}
+		if rb.Len() != 4 {
+			t.Fatalf("round %d: expected a full buffer, got %d bytes", i, rb.Len())
+		}
+		for j := 0; j < 3; j++ {
+			c, ok := rb.Get()
+			if !ok || c != expected {
+				t.Fatalf("round %d: got %d, %v, expected %d", i, c, ok, expected)
+			}
+			expected++
+		}
+	}
+	for {
+		c, ok := rb.Get()
+		if !ok {
+			break
+		}
+		if c != expected {
+			t.Fatalf("got %d, expected %d", c, expected)
+		}
+		expected++
+	}
+	if expected != next {
+		t.Errorf("lost data: read up to %d, wrote up to %d", expected, next)
+	}
+}
+
+func TestRingBufferSize(t *testing.T) {
+	tests := []struct {
+		size     int
+		expected int
+	}{
+		{1, 1},
+		{100, 128},
+		{128, 128},
+		{129, 256},
+		{1000, 1024},
+		{100000, 32768},
+	}
+	for _, tc := range tests {
+		rb := NewRingBufferSize(tc.size)
+		if rb.Size() != tc.expected {
+			t.Errorf("NewRingBufferSize(%d): expected size %d, got %d", tc.size, tc.expected, rb.Size())
+		}
+		n := 0
+		for rb.Put(byte(n)) {
+			n++
+		}
+		if n != tc.expected || rb.Len() != tc.expected {
+			t.Errorf("NewRingBufferSize(%d): stored %d bytes (Len %d), expected %d", tc.size, n, rb.Len(), tc.expected)
+		}
+		used := tc.expected
+		if used > 255 {
+			used = 255
+		}
+		if int(rb.Used()) != used {
+			t.Errorf("NewRingBufferSize(%d): expected Used() %d, got %d", tc.size, used, rb.Used())
+		}
+	}
+}
+
+func TestRingBufferZero(t *testing.T) {
+	// The zero value is a usable ring buffer of the default size.
+	var rb RingBuffer
+	if c, ok := rb.Get(); ok {
+		t.Errorf("empty buffer returned %d", c)
+	}
+	for i := 0; i < 200; i++ {
+		rb.Put(byte(i))
+	}
+	if rb.Size() != 128 || rb.Len() != 128 || rb.Used() != 128 {
+		t.Errorf("expected a full buffer of 128 bytes, got Size %d, Len %d, Used %d", rb.Size(), rb.Len(), rb.Used())
+	}
+	if c, ok := new(RingBuffer).Get(); ok {
+		t.Errorf("empty buffer returned %d", c)
+	}
+	rb2 := new(RingBuffer)
+	if !rb2.Put(5) {
+		t.Fatal("could not store a byte")
+	}
+	if c, ok := rb2.Get(); !ok || c != 5 {
+		t.Errorf("got %d, %v, expected 5", c, ok)
+	}
+}
+
+func TestUARTError(t *testing.T) {
+	var err error = ErrUARTOverrun | ErrUARTParity
+	if msg := err.Error(); msg != "UART overrun parity error" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+	if msg := ErrUARTFraming.Error(); msg != "UART framing error" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+	if !errors.Is(err, ErrUARTOverrun) || !errors.Is(err, ErrUARTParity) {
+		t.Error("expected both errors to be reported")
+	}
+	if errors.Is(err, ErrUARTFraming) {
+		t.Error("unexpected framing error")
+	}
+	if errors.Is(err, ErrUARTOverrun|ErrUARTFraming) {
+		t.Error("a combination of errors must only match if all occurred")
+	}
+	if errors.Is(err, UARTError(0)) {
+		t.Error("no errors must not match")
+	}
+}
@@ -0,0 +1,288 @@
+//go:build (sam && atsame51) || (sam && atsame54) || stm32f4 || stm32f7 || stm32l5 || esp32c3 || !baremetal
+
+package machine
+
+import "errors"
+
+// CANFrame is a single CAN (or CAN FD) frame.
+type CANFrame struct {
+	// ID is the 11-bit (standard) or 29-bit (extended) identifier.
+	ID uint32
+
+	// Extended is set when ID is a 29-bit identifier.
+	Extended bool
+
+	// Remote is set for remote transmission requests. Remote frames carry no
+	// data, but Length is sent as the requested data length.
+	Remote bool
+
+	// FD is set for CAN FD frames, which can carry up to 64 bytes of data.
+	// Only some chips support CAN FD.
+	FD bool
+
+	// BitRateSwitch is set when the data phase of a CAN FD frame is sent with
+	// CANConfig.TransferRateFD.
+	BitRateSwitch bool
+
+	// Length is the number of data bytes in Data. CAN FD frames longer than 8
+	// bytes are padded with zeroes to the next valid length (12, 16, 20, 24,
+	// 32, 48 or 64) when transmitted.
+	Length uint8
+
+	Data [64]byte
+}
+
+// Payload returns the data bytes of the frame.
+func (f *CANFrame) Payload() []byte {
+	if f.Remote {
+		return nil
+	}
+	return f.Data[:f.Length]
+}
+
+// CANFilter describes which frames are received. A frame is accepted when
+// its identifier is of the same kind (standard or extended) and
+// frame.ID&Mask == ID&Mask.
+type CANFilter struct {
+	ID       uint32
+	Mask     uint32
+	Extended bool
+}
+
+// matches returns whether the frame is accepted by this filter.
+func (f CANFilter) matches(frame *CANFrame) bool {
+	return f.Extended == frame.Extended && frame.ID&f.Mask == f.ID&f.Mask
+}
+
+// CANMode is the operating mode of a CAN controller.
+type CANMode uint8
+
+const (
+	// CANModeNormal transmits and receives on the bus.
+	CANModeNormal CANMode = iota
+
+	// CANModeLoopback receives all transmitted frames without driving the bus
+	// and without requiring an acknowledgement from another node. It can be
+	// used to test CAN code without a bus, for example in an emulator.
+	CANModeLoopback
+
+	// CANModeListenOnly receives frames but never transmits anything on the
+	// bus, not even acknowledgements.
+	CANModeListenOnly
+)
+
+type CANTransferRate uint32
+
+// CAN transfer rates for CANConfig
+const (
+	CANTransferRate125kbps  CANTransferRate = 125000
+	CANTransferRate250kbps  CANTransferRate = 250000
+	CANTransferRate500kbps  CANTransferRate = 500000
+	CANTransferRate1000kbps CANTransferRate = 1000000
+	CANTransferRate2000kbps CANTransferRate = 2000000
+	CANTransferRate4000kbps CANTransferRate = 4000000
+)
+
+// CANConfig holds CAN configuration parameters. Tx and Rx need to be
+// specified with some pins. When the Standby Pin is specified, configure it
+// as an output pin and output Low in Configure(). If this operation is not
+// necessary, specify NoPin.
+type CANConfig struct {
+	// TransferRate defaults to 500kbps.
+	TransferRate CANTransferRate
+
+	// TransferRateFD is the data phase rate of CAN FD frames. It is ignored
+	// on chips without CAN FD support.
+	TransferRateFD CANTransferRate
+
+	Tx      Pin
+	Rx      Pin
+	Standby Pin
+	Mode    CANMode
+}
+
+// CANBusState is the fault confinement state of a CAN controller.
+type CANBusState uint8
+
+const (
+	// CANBusErrorActive is the normal state.
+	CANBusErrorActive CANBusState = iota
+
+	// CANBusErrorPassive means one of the error counters is above 127. The
+	// controller still takes part in bus communication.
+	CANBusErrorPassive
+
+	// CANBusOff means the transmit error counter went above 255 and the
+	// controller disconnected from the bus. Call Recover to reconnect.
+	CANBusOff
+)
+
+// CANErrorCounters are the error counters of a CAN controller, as defined in
+// the CAN specification.
+type CANErrorCounters struct {
+	State    CANBusState
+	TxErrors uint8
+	RxErrors uint8
+}
+
+var (
+	errCANInvalidTransferRate   = errors.New("CAN: invalid TransferRate")
+	errCANInvalidTransferRateFD = errors.New("CAN: invalid TransferRateFD")
+
+	ErrCANInvalidFrame  = errors.New("CAN: invalid frame")
+	ErrCANInvalidFilter = errors.New("CAN: invalid or too many filters")
+	ErrCANBusOff        = errors.New("CAN: bus off")
+)
+
+// canBus is the portable CAN API. It is implemented by all chips that
+// support CAN.
+//
+// The CAN controllers (CAN0, CAN1, ...) are values of type CAN. The CAN type
+// holds no state of its own, so a copy of a controller refers to the same
+// hardware.
+type canBus interface {
+	Configure(config CANConfig) error
+
+	// SetFilters replaces the set of receive filters. A frame is received
+	// when it matches any of the filters. All frames are received when no
+	// filters are set, which is the default.
+	SetFilters(filters []CANFilter) error
+
+	// Transmit queues a frame for transmission. It blocks while the transmit
+	// queue is full, and returns ErrCANBusOff if the controller is bus-off.
+	// Other goroutines run while it blocks: it is woken up by the controller
+	// interrupt. Only one goroutine can be blocked in Transmit at a time.
+	Transmit(frame *CANFrame) error
+
+	// Receive blocks until a frame is received and copies it to frame. Like
+	// Transmit, it is woken up by the controller interrupt, and only one
+	// goroutine can be blocked in Receive at a time.
+	Receive(frame *CANFrame) error
+
+	// Available returns the number of frames that can be received without
+	// blocking.
+	Available() int
+
+	// ErrorCounters returns the current error counters and bus state.
+	ErrorCounters() CANErrorCounters
+
+	// Recover starts bus-off recovery. The controller reconnects after it
+	// has seen 128 occurrences of 11 recessive bits on the bus.
+	Recover() error
+}
+
+var _ canBus = (*CAN)(nil)
+
+// canWaiters holds the goroutines blocked on a CAN controller. They are woken
+// up from the controller interrupt.
+type canWaiters struct {
+	rx cond // notified when a frame was received
+	tx cond // notified when a frame was sent, or when the bus state changed
+}
+
+// check returns an error if the frame can't be sent on a controller with or
+// without CAN FD support.
+func (f *CANFrame) check(fd bool) error {
+	if f.Extended {
+		if f.ID > 0x1fffffff {
+			return ErrCANInvalidFrame
+		}
+	} else if f.ID > 0x7ff {
+		return ErrCANInvalidFrame
+	}
+	if f.FD {
+		if !fd || f.Remote || f.Length > 64 {
+			return ErrCANInvalidFrame
+		}
+	} else if f.Length > 8 || f.BitRateSwitch {
+		return ErrCANInvalidFrame
+	}
+	return nil
+}
+
+// canBitTiming calculates the bit timing for the given peripheral clock and
+// transfer rate, with a sample point at about 80% of the bit. It returns the
+// clock prescaler and the number of time quanta before (seg1, excluding the
+// synchronization segment) and after (seg2) the sample point.
+func canBitTiming(clock uint32, rate CANTransferRate, maxPrescaler uint32) (prescaler, seg1, seg2 uint32, err error) {
+	if rate == 0 {
+		return 0, 0, 0, errCANInvalidTransferRate
+	}
+	// Prefer more time quanta per bit, for a more accurate sample point.
+	for tq := uint32(20); tq >= 8; tq-- {
+		if clock%(uint32(rate)*tq) != 0 {
+			continue
+		}
+		prescaler = clock / (uint32(rate) * tq)
+		if prescaler > maxPrescaler {
+			break
+		}
+		seg2 = tq / 5
+		seg1 = tq - 1 - seg2
+		return prescaler, seg1, seg2, nil
+	}
+	return 0, 0, 0, errCANInvalidTransferRate
+}
+
+// canErrorState returns the bus state for the given error counters.
+func canErrorState(busOff bool, tec, rec uint32) CANBusState {
+	switch {
+	case busOff:
+		return CANBusOff
+	case tec > 127 || rec > 127:
+		return CANBusErrorPassive
+	default:
+		return CANBusErrorActive
+	}
+}
+
+// CANDlcToLength() converts a DLC value to its actual length.
+func CANDlcToLength(dlc byte, isFD bool) byte {
+	length := dlc
+	if !isFD {
+		if dlc > 8 {
+			length = 8
+		}
+	} else if dlc == 0x09 {
+		length = 12
+	} else if dlc == 0x0A {
+		length = 16
+	} else if dlc == 0x0B {
+		length = 20
+	} else if dlc == 0x0C {
+		length = 24
+	} else if dlc == 0x0D {
+		length = 32
+	} else if dlc == 0x0E {
+		length = 48
+	} else if dlc == 0x0F {
+		length = 64
+	}
+	return length
+}
+
+// CANLengthToDlc() converts its actual length to a DLC value. Classic CAN
+// frames can't be longer than 8 bytes, so for them a longer length results in
+// a DLC of 8. CAN FD lengths are rounded up to the next valid length, up to 64.
+func CANLengthToDlc(length byte, isFD bool) byte {
+	dlc := length
+	if length <= 0x08 {
+	} else if !isFD {
+		dlc = 0x08
+	} else if length <= 12 {
+		dlc = 0x09
+	} else if length <= 16 {
+		dlc = 0x0A
+	} else if length <= 20 {
+		dlc = 0x0B
+	} else if length <= 24 {
+		dlc = 0x0C
+	} else if length <= 32 {
+		dlc = 0x0D
+	} else if length <= 48 {
+		dlc = 0x0E
+	} else {
+		dlc = 0x0F
+	}
+	return dlc
+}
@@ -0,0 +1,215 @@
+//go:build !baremetal
+
+package machine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCANLengthToDlc(t *testing.T) {
+	tests := []struct {
+		length byte
+		isFD   bool
+		dlc    byte
+	}{
+		{0, false, 0},
+		{8, false, 8},
+		{9, false, 8}, // classic frames can't be longer than 8 bytes
+		{64, false, 8},
+		{0, true, 0},
+		{8, true, 8},
+		{9, true, 0x9},
+		{12, true, 0x9},
+		{13, true, 0xA},
+		{24, true, 0xC},
+		{33, true, 0xE},
+		{64, true, 0xF},
+		{65, true, 0xF},
+	}
+	for _, tc := range tests {
+		if dlc := CANLengthToDlc(tc.length, tc.isFD); dlc != tc.dlc {
+			t.Errorf("CANLengthToDlc(%d, %v) = %#x, expected %#x", tc.length, tc.isFD, dlc, tc.dlc)
+		}
+	}
+
+	for _, length := range []byte{0, 1, 8, 12, 16, 20, 24, 32, 48, 64} {
+		if got := CANDlcToLength(CANLengthToDlc(length, true), true); got != length {
+			t.Errorf("CAN FD length %d doesn't round trip, got %d", length, got)
+		}
+	}
+}
+
+func TestCANFrameCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame CANFrame
+		fd    bool
+		err   error
+	}{
+		{"standard", CANFrame{ID: 0x7ff, Length: 8}, false, nil},
+		{"standard ID too large", CANFrame{ID: 0x800}, false, ErrCANInvalidFrame},
+		{"extended", CANFrame{ID: 0x1fffffff, Extended: true}, false, nil},
+		{"extended ID too large", CANFrame{ID: 0x20000000, Extended: true}, false, ErrCANInvalidFrame},
+		{"classic too long", CANFrame{Length: 9}, true, ErrCANInvalidFrame},
+		{"classic bit rate switch", CANFrame{BitRateSwitch: true}, true, ErrCANInvalidFrame},
+		{"remote", CANFrame{Remote: true, Length: 4}, false, nil},
+		{"FD", CANFrame{FD: true, BitRateSwitch: true, Length: 64}, true, nil},
+		{"FD unsupported", CANFrame{FD: true, Length: 8}, false, ErrCANInvalidFrame},
+		{"FD too long", CANFrame{FD: true, Length: 65}, true, ErrCANInvalidFrame},
+		{"FD remote", CANFrame{FD: true, Remote: true}, true, ErrCANInvalidFrame},
+	}
+	for _, tc := range tests {
+		if err := tc.frame.check(tc.fd); err != tc.err {
+			t.Errorf("%s: got %v, expected %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+// newCANSim configures a controller on the simulated bus, which is
+// disconnected again at the end of the test.
+func newCANSim(t *testing.T, bus uint8, mode CANMode) CAN {
+	t.Helper()
+	can := CAN{Bus: bus}
+	if err := can.Configure(CANConfig{Mode: mode}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		delete(canSimBus, bus)
+	})
+	return can
+}
+
+// receiveCANSim returns the IDs of the frames that were received.
+func receiveCANSim(t *testing.T, can CAN) []uint32 {
+	t.Helper()
+	var ids []uint32
+	var frame CANFrame
+	for can.Available() != 0 {
+		if err := can.Receive(&frame); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, frame.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCANSimModes(t *testing.T) {
+	normal1 := newCANSim(t, 10, CANModeNormal)
+	normal2 := newCANSim(t, 11, CANModeNormal)
+	loopback := newCANSim(t, 12, CANModeLoopback)
+	listenOnly := newCANSim(t, 13, CANModeListenOnly)
+
+	for _, tx := range []struct {
+		can CAN
+		id  uint32
+	}{
+		{normal1, 0x101},
+		{loopback, 0x102},
+		{listenOnly, 0x103},
+	} {
+		frame := CANFrame{ID: tx.id, Length: 1}
+		if err := tx.can.Transmit(&frame); err != nil {
+			t.Fatalf("Transmit %#x: %v", tx.id, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		can  CAN
+		ids  []uint32
+	}{
+		{"normal1", normal1, nil},
+		{"normal2", normal2, []uint32{0x101}},
+		{"loopback", loopback, []uint32{0x102}},
+		{"listen-only", listenOnly, []uint32{0x101}},
+	}
+	for _, tc := range tests {
+		if ids := receiveCANSim(t, tc.can); !equalIDs(ids, tc.ids) {
+			t.Errorf("%s received %#x, expected %#x", tc.name, ids, tc.ids)
+		}
+	}
+}
+
+func TestCANSimFilters(t *testing.T) {
+	tx := newCANSim(t, 20, CANModeNormal)
+	rx := newCANSim(t, 21, CANModeNormal)
+
+	err := rx.SetFilters([]CANFilter{
+		{ID: 0x120, Mask: 0x7f0},
+		{ID: 0x120, Mask: 0x1fffffff, Extended: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range []CANFrame{
+		{ID: 0x11f},
+		{ID: 0x120},
+		{ID: 0x12f},
+		{ID: 0x130},
+		{ID: 0x121, Extended: true},
+		{ID: 0x120, Extended: true},
+	} {
+		if err := tx.Transmit(&frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids, expected := receiveCANSim(t, rx), []uint32{0x120, 0x12f, 0x120}; !equalIDs(ids, expected) {
+		t.Errorf("received %#x, expected %#x", ids, expected)
+	}
+
+	// Without filters, all frames are received.
+	rx.SetFilters(nil)
+	frame := CANFrame{ID: 0x7ff}
+	tx.Transmit(&frame)
+	if ids := receiveCANSim(t, rx); !equalIDs(ids, []uint32{0x7ff}) {
+		t.Errorf("received %#x without filters", ids)
+	}
+}
+
+func TestCANSimFrame(t *testing.T) {
+	tx := newCANSim(t, 30, CANModeNormal)
+	rx := newCANSim(t, 31, CANModeNormal)
+
+	frame := CANFrame{ID: 0x1234567, Extended: true, FD: true, BitRateSwitch: true, Length: 12}
+	copy(frame.Data[:], "hello, world")
+	if err := tx.Transmit(&frame); err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of a controller refers to the same controller.
+	rxCopy := rx
+	var received CANFrame
+	if err := rxCopy.Receive(&received); err != nil {
+		t.Fatal(err)
+	}
+	if received.ID != frame.ID || !received.Extended || !received.FD || !received.BitRateSwitch {
+		t.Errorf("received %+v", received)
+	}
+	if !bytes.Equal(received.Payload(), []byte("hello, world")) {
+		t.Errorf("received payload %q", received.Payload())
+	}
+	if rx.Available() != 0 {
+		t.Errorf("frame still available after it was received through a copy")
+	}
+
+	invalid := CANFrame{ID: 0x100, Length: 9}
+	if err := tx.Transmit(&invalid); err != ErrCANInvalidFrame {
+		t.Errorf("Transmit of a classic frame with 9 bytes: got %v", err)
+	}
+	if rx.Available() != 0 {
+		t.Errorf("invalid frame was received")
+	}
+}
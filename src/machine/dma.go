@@ -0,0 +1,191 @@
+//go:build rp2040 || (sam && atsamd51) || (sam && atsame5x) || stm32f4
+
+package machine
+
+import (
+	"errors"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// DMADirection is the direction of a DMA transfer. It determines which of the
+// source and destination addresses are incremented after each transfer unit,
+// and whether the transfer is paced by a peripheral.
+type DMADirection uint8
+
+const (
+	// DMAMemoryToMemory copies memory as fast as possible. Both addresses are
+	// incremented.
+	DMAMemoryToMemory DMADirection = iota
+
+	// DMAMemoryToPeripheral writes a buffer to a peripheral register, paced by
+	// the peripheral. Only the source address is incremented.
+	DMAMemoryToPeripheral
+
+	// DMAPeripheralToMemory reads a peripheral register into a buffer, paced
+	// by the peripheral. Only the destination address is incremented.
+	DMAPeripheralToMemory
+)
+
+// DMATransferSize is the size of a single transfer unit in bytes.
+type DMATransferSize uint8
+
+const (
+	DMASize8  DMATransferSize = 1
+	DMASize16 DMATransferSize = 2
+	DMASize32 DMATransferSize = 4
+)
+
+// DMATransfer describes a single DMA transfer. Transfers can be chained using
+// Next: when a transfer completes, the next one is started automatically.
+//
+// The memory referenced by a transfer must not be modified (or, for the
+// destination, read) until the transfer has completed.
+type DMATransfer struct {
+	Direction DMADirection
+	Size      DMATransferSize
+
+	// Source and destination address. For peripherals this is the address of
+	// the data register.
+	Src unsafe.Pointer
+	Dst unsafe.Pointer
+
+	// Count is the number of transfer units (not bytes).
+	Count uint32
+
+	// Next is started when this transfer completes.
+	Next *DMATransfer
+}
+
+var (
+	ErrDMANoChannel = errors.New("dma: no free channel")
+	ErrDMABusy      = errors.New("dma: channel busy")
+	ErrDMAInvalid   = errors.New("dma: invalid transfer")
+)
+
+// dmaChannelAPI is the portable DMA API. It is implemented by DMAChannel on
+// all chips that support it.
+//
+// A channel is obtained with ClaimDMAChannel, passing the chip-specific
+// trigger of the peripheral it is used with (or DMATriggerNone for
+// memory-to-memory transfers).
+type dmaChannelAPI interface {
+	// Start starts the given transfer, and the transfers chained to it. It
+	// returns ErrDMABusy if the channel is still busy.
+	Start(t *DMATransfer) error
+
+	// Busy returns whether a transfer is in progress.
+	Busy() bool
+
+	// Wait blocks the current goroutine until all transfers have completed.
+	// Other goroutines can run in the meantime. Only one goroutine can wait
+	// for a channel at a time.
+	Wait()
+
+	// Abort stops the current transfer. Chained transfers are not started.
+	Abort()
+
+	// SetCallback sets a function that is called when the last transfer in a
+	// chain has completed. It is called from an interrupt.
+	SetCallback(callback func(ch *DMAChannel))
+
+	// Release makes the channel available to ClaimDMAChannel again.
+	Release()
+}
+
+var _ dmaChannelAPI = (*DMAChannel)(nil)
+
+// check returns an error if the transfer chain contains an invalid transfer.
+func (t *DMATransfer) check() error {
+	for ; t != nil; t = t.Next {
+		if t.Src == nil || t.Dst == nil || t.Count == 0 || t.Count > dmaMaxCount {
+			return ErrDMAInvalid
+		}
+		switch t.Size {
+		case DMASize8, DMASize16, DMASize32:
+		default:
+			return ErrDMAInvalid
+		}
+	}
+	return nil
+}
+
+// dmaState is the state common to the DMAChannel implementations. The
+// transfer in progress is kept referenced, so that the garbage collector
+// doesn't free the buffers while the DMA controller is still using them.
+type dmaState struct {
+	transfer *DMATransfer // current transfer in the chain
+	busy     volatile.Register8
+	done     cond // notified when the channel becomes idle
+	callback func(ch *DMAChannel)
+	claimed  bool
+}
+
+// Start starts the given transfer, and the transfers chained to it. It
+// returns ErrDMABusy if the channel is still busy.
+func (ch *DMAChannel) Start(t *DMATransfer) error {
+	if ch.Busy() {
+		return ErrDMABusy
+	}
+	if err := t.check(); err != nil {
+		return err
+	}
+	ch.transfer = t
+	ch.busy.Set(1)
+	ch.start(t)
+	return nil
+}
+
+// Busy returns whether a transfer is in progress.
+func (ch *DMAChannel) Busy() bool {
+	return ch.busy.Get() != 0
+}
+
+// Wait blocks the current goroutine until all transfers have completed. Other
+// goroutines can run in the meantime: the goroutine is woken up by the DMA
+// interrupt. Only one goroutine can wait for a channel at a time.
+func (ch *DMAChannel) Wait() {
+	for ch.Busy() {
+		// A notification may be left over from an earlier transfer, so check
+		// again after waking up.
+		ch.done.Wait()
+	}
+}
+
+// SetCallback sets a function that is called from an interrupt when the last
+// transfer in a chain has completed. Pass nil to remove the callback.
+func (ch *DMAChannel) SetCallback(callback func(ch *DMAChannel)) {
+	ch.callback = callback
+}
+
+// Release aborts any transfer in progress and makes the channel available to
+// ClaimDMAChannel again.
+func (ch *DMAChannel) Release() {
+	ch.Abort()
+	ch.callback = nil
+	ch.claimed = false
+}
+
+// complete is called from the DMA interrupt when a transfer has completed. It
+// starts the next transfer in the chain, or marks the channel as idle.
+func (ch *DMAChannel) complete() {
+	if !ch.Busy() {
+		return
+	}
+	if next := ch.transfer.Next; next != nil {
+		ch.transfer = next
+		ch.start(next)
+		return
+	}
+	ch.stopped()
+	if ch.callback != nil {
+		ch.callback(ch)
+	}
+}
+
+// stopped marks the channel as idle, and wakes up the goroutine in Wait.
+func (ch *DMAChannel) stopped() {
+	ch.transfer = nil
+	ch.busy.Set(0)
+	ch.done.Notify()
+}
@@ -1,4 +1,4 @@
-//go:build atmega || nrf || sam || stm32 || fe310 || k210 || rp2040
+//go:build atmega || nrf || sam || stm32 || fe310 || k210 || rp2040 || !baremetal
 
 package machine
 
@@ -25,6 +25,9 @@ var (
 	errI2CBusError           = errors.New("I2C bus error")
 	errI2COverflow           = errors.New("I2C receive buffer overflow")
 	errI2COverread           = errors.New("I2C transmit buffer overflow")
+	errI2CNoInterrupt        = errors.New("I2C target mode not supported on this bus")
+	ErrInvalidTgtAddr        = errors.New("invalid target i2c address not in 0..0x80 or is reserved")
+	ErrI2CWrongMode          = errors.New("i2c wrong mode")
 )
 
 // I2CTargetEvent reflects events on the I2C bus
@@ -78,3 +81,11 @@ func (i2c *I2C) WriteRegister(address uint8, register uint8, data []byte) error
 func (i2c *I2C) ReadRegister(address uint8, register uint8, data []byte) error {
 	return i2c.Tx(uint16(address), []byte{register}, data)
 }
+
+// isReservedI2CAddr returns whether the 7-bit address is reserved by the I2C
+// specification, and can't be used as a target address.
+//
+//go:inline
+func isReservedI2CAddr(addr uint8) bool {
+	return (addr&0x78) == 0 || (addr&0x78) == 0x78
+}
@@ -0,0 +1,252 @@
+//go:build !baremetal
+
+package machine
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The tests only use the simulated bus, so the simulator functions for other
+// transfers don't need to do anything.
+
+//export __tinygo_i2c_configure
+func testI2CConfigure(bus uint8, scl Pin, sda Pin) {}
+
+//export __tinygo_i2c_transfer
+func testI2CTransfer(bus uint8, w *byte, wlen int, r *byte, rlen int) int {
+	return 0
+}
+
+// i2cTestEvent is an event as seen by a target on the simulated bus.
+type i2cTestEvent struct {
+	evt  I2CTargetEvent
+	data []byte
+}
+
+// runI2CTarget handles events on the target until a transaction is finished,
+// replying to every request with reply. It sends the events it saw to the
+// returned channel.
+func runI2CTarget(t *testing.T, target *I2C, bufSize int, reply []byte) <-chan []i2cTestEvent {
+	t.Helper()
+	result := make(chan []i2cTestEvent, 1)
+	go func() {
+		var events []i2cTestEvent
+		buf := make([]byte, bufSize)
+		for {
+			evt, n, err := target.WaitForEvent(buf)
+			if err != nil {
+				t.Error("WaitForEvent:", err)
+				break
+			}
+			events = append(events, i2cTestEvent{evt, append([]byte(nil), buf[:n]...)})
+			if evt == I2CRequest {
+				if err := target.Reply(reply); err != nil {
+					t.Error("Reply:", err)
+					break
+				}
+			}
+			if evt == I2CFinish {
+				break
+			}
+		}
+		result <- events
+	}()
+	return result
+}
+
+// removeI2CSimTarget takes a target off the simulated bus at the end of a
+// test, so that its address can be used again.
+func removeI2CSimTarget(t *testing.T, target *I2C) {
+	t.Cleanup(func() {
+		for i, other := range i2cSimTargets {
+			if other == target {
+				i2cSimTargets = append(i2cSimTargets[:i], i2cSimTargets[i+1:]...)
+				break
+			}
+		}
+	})
+}
+
+func newI2CSimPair(t *testing.T, addr uint16) (controller, target *I2C) {
+	t.Helper()
+	controller = &I2C{}
+	target = &I2C{}
+	if err := controller.Configure(I2CConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Configure(I2CConfig{Mode: I2CModeTarget}); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Listen(addr); err != nil {
+		t.Fatal(err)
+	}
+	removeI2CSimTarget(t, target)
+	return controller, target
+}
+
+func TestI2CSimTransfer(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    uint16
+		w       []byte
+		rlen    int
+		bufSize int
+		reply   []byte
+		r       []byte
+		events  []i2cTestEvent
+	}{
+		{
+			name:    "write",
+			addr:    0x10,
+			w:       []byte{0x01, 0x02, 0x03},
+			bufSize: 8,
+			events: []i2cTestEvent{
+				{I2CReceive, []byte{0x01, 0x02, 0x03}},
+				{I2CFinish, nil},
+			},
+		},
+		{
+			name:    "read",
+			addr:    0x11,
+			rlen:    2,
+			bufSize: 8,
+			reply:   []byte{0xaa, 0xbb},
+			r:       []byte{0xaa, 0xbb},
+			events: []i2cTestEvent{
+				{I2CRequest, nil},
+				{I2CFinish, nil},
+			},
+		},
+		{
+			name:    "register read",
+			addr:    0x12,
+			w:       []byte{0x05},
+			rlen:    3,
+			bufSize: 8,
+			reply:   []byte{0x55, 0x66, 0x77},
+			r:       []byte{0x55, 0x66, 0x77},
+			events: []i2cTestEvent{
+				{I2CReceive, []byte{0x05}},
+				{I2CRequest, nil},
+				{I2CFinish, nil},
+			},
+		},
+		{
+			// Bytes the target doesn't reply are read as 0xff.
+			name:    "short reply",
+			addr:    0x13,
+			rlen:    4,
+			bufSize: 8,
+			reply:   []byte{0x01},
+			r:       []byte{0x01, 0xff, 0xff, 0xff},
+			events: []i2cTestEvent{
+				{I2CRequest, nil},
+				{I2CFinish, nil},
+			},
+		},
+		{
+			// Bytes that don't fit in the buffer of the target are dropped.
+			name:    "receive overflow",
+			addr:    0x14,
+			w:       []byte{0x01, 0x02, 0x03, 0x04},
+			bufSize: 2,
+			events: []i2cTestEvent{
+				{I2CReceive, []byte{0x01, 0x02}},
+				{I2CFinish, nil},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			controller, target := newI2CSimPair(t, tc.addr)
+			result := runI2CTarget(t, target, tc.bufSize, tc.reply)
+			r := make([]byte, tc.rlen)
+			if err := controller.Tx(tc.addr, tc.w, r); err != nil {
+				t.Fatal("Tx:", err)
+			}
+			events := <-result
+			if !bytes.Equal(r, tc.r) {
+				t.Errorf("read %x, expected %x", r, tc.r)
+			}
+			if len(events) != len(tc.events) {
+				t.Fatalf("got %d events, expected %d: %v", len(events), len(tc.events), events)
+			}
+			for i, evt := range events {
+				if evt.evt != tc.events[i].evt || !bytes.Equal(evt.data, tc.events[i].data) {
+					t.Errorf("event %d: got %v %x, expected %v %x", i, evt.evt, evt.data, tc.events[i].evt, tc.events[i].data)
+				}
+			}
+		})
+	}
+}
+
+func TestI2CSimRegisters(t *testing.T) {
+	controller, target := newI2CSimPair(t, 0x20)
+
+	result := runI2CTarget(t, target, 8, nil)
+	if err := controller.WriteRegister(0x20, 0x0a, []byte{0x12, 0x34}); err != nil {
+		t.Fatal("WriteRegister:", err)
+	}
+	events := <-result
+	if len(events) != 2 || events[0].evt != I2CReceive || !bytes.Equal(events[0].data, []byte{0x0a, 0x12, 0x34}) {
+		t.Errorf("unexpected events for WriteRegister: %v", events)
+	}
+
+	result = runI2CTarget(t, target, 8, []byte{0x56, 0x78})
+	data := make([]byte, 2)
+	if err := controller.ReadRegister(0x20, 0x0b, data); err != nil {
+		t.Fatal("ReadRegister:", err)
+	}
+	events = <-result
+	if len(events) != 3 || !bytes.Equal(events[0].data, []byte{0x0b}) || events[1].evt != I2CRequest {
+		t.Errorf("unexpected events for ReadRegister: %v", events)
+	}
+	if !bytes.Equal(data, []byte{0x56, 0x78}) {
+		t.Errorf("ReadRegister read %x", data)
+	}
+}
+
+func TestI2CSimListen(t *testing.T) {
+	tests := []struct {
+		addr uint16
+		err  error
+	}{
+		{0x00, ErrInvalidTgtAddr}, // general call
+		{0x07, ErrInvalidTgtAddr}, // reserved
+		{0x08, nil},
+		{0x42, nil},
+		{0x77, nil},
+		{0x78, ErrInvalidTgtAddr}, // 10-bit addressing
+		{0x7f, ErrInvalidTgtAddr}, // reserved
+		{0x80, ErrInvalidTgtAddr}, // not a 7-bit address
+	}
+	target := &I2C{}
+	target.Configure(I2CConfig{Mode: I2CModeTarget})
+	removeI2CSimTarget(t, target)
+	for _, tc := range tests {
+		if err := target.Listen(tc.addr); err != tc.err {
+			t.Errorf("Listen(%#x): got %v, expected %v", tc.addr, err, tc.err)
+		}
+	}
+}
+
+func TestI2CSimWrongMode(t *testing.T) {
+	controller := &I2C{}
+	controller.Configure(I2CConfig{})
+	if err := controller.Listen(0x30); err != ErrI2CWrongMode {
+		t.Errorf("Listen in controller mode: got %v", err)
+	}
+	if _, _, err := controller.WaitForEvent(make([]byte, 1)); err != ErrI2CWrongMode {
+		t.Errorf("WaitForEvent in controller mode: got %v", err)
+	}
+
+	target := &I2C{}
+	target.Configure(I2CConfig{Mode: I2CModeTarget})
+	if err := target.Tx(0x30, []byte{1}, nil); err != ErrI2CWrongMode {
+		t.Errorf("Tx in target mode: got %v", err)
+	}
+	if err := target.Reply([]byte{1}); err != ErrI2CWrongMode {
+		t.Errorf("Reply without a request: got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build (sam && atsamd21) || (sam && atsamd51) || (sam && atsame5x) || rp2040 || stm32f1 || stm32f4 || stm32f7 || stm32l0 || stm32l4 || stm32l5 || stm32wlx
+
+package machine
+
+import "runtime/volatile"
+
+// i2cTarget is the state of an I2C peripheral in target mode. The bus events
+// are handled by the peripheral interrupt, while the goroutine that called
+// WaitForEvent or Reply is parked.
+type i2cTarget struct {
+	buf   []byte // receive buffer of WaitForEvent, or the data for Reply
+	count int    // number of bytes received or sent
+	reply bool   // set for Reply, cleared for WaitForEvent
+	event I2CTargetEvent
+	err   error
+	busy  volatile.Register8 // set while the interrupt handles a call
+	done  cond               // notified when busy is cleared
+}
+
+// start prepares the state for a call to WaitForEvent or Reply. The
+// interrupts must be enabled after calling start.
+func (t *i2cTarget) start(buf []byte, reply bool) {
+	t.buf = buf
+	t.count = 0
+	t.reply = reply
+	t.event = I2CReceive
+	t.err = nil
+	t.busy.Set(1)
+}
+
+// wait blocks the current goroutine until the interrupt handler calls
+// finish. Only one goroutine can wait for a peripheral at a time.
+func (t *i2cTarget) wait() {
+	for t.busy.Get() != 0 {
+		t.done.Wait()
+	}
+	t.buf = nil
+}
+
+// finish is called from the interrupt when the call in progress is complete.
+// The interrupts must be disabled before calling finish.
+func (t *i2cTarget) finish(event I2CTargetEvent, err error) {
+	t.event = event
+	t.err = err
+	t.busy.Set(0)
+	t.done.Notify()
+}
+
+// receive stores a byte received by WaitForEvent. It returns false if the
+// buffer is full, in which case the byte is dropped.
+func (t *i2cTarget) receive(b byte) bool {
+	if t.count >= len(t.buf) {
+		return false
+	}
+	t.buf[t.count] = b
+	t.count++
+	return true
+}
+
+// next returns the next byte to send for Reply. After the end of the data it
+// returns 0xff.
+func (t *i2cTarget) next() byte {
+	b := byte(0xff)
+	if t.count < len(t.buf) {
+		b = t.buf[t.count]
+	}
+	t.count++
+	return b
+}
@@ -156,10 +156,14 @@ type UART struct {
 	statusRegA *volatile.Register8
 	statusRegB *volatile.Register8
 	statusRegC *volatile.Register8
+
+	uartState
 }
 
 // Configure the UART on the AVR. Defaults to 9600 baud on Arduino.
 func (uart *UART) Configure(config UARTConfig) {
+	uart.configureBuffers(config, false)
+
 	if config.BaudRate == 0 {
 		config.BaudRate = 9600
 	}
@@ -179,14 +183,32 @@ func (uart *UART) Configure(config UARTConfig) {
 }
 
 func (uart *UART) handleInterrupt(intr interrupt.Interrupt) {
+	// The error flags are for the byte in UDR, so read them first.
+	status := uart.statusRegA.Get()
+
 	// Read register to clear it.
 	data := uart.dataReg.Get()
 
-	// Ensure no error.
-	if !uart.statusRegA.HasBits(avr.UCSR0A_FE0 | avr.UCSR0A_DOR0 | avr.UCSR0A_UPE0) {
-		// Put data from UDR register into buffer.
-		uart.Receive(byte(data))
+	if status&(avr.UCSR0A_FE0|avr.UCSR0A_DOR0|avr.UCSR0A_UPE0) != 0 {
+		var errs UARTError
+		if status&avr.UCSR0A_DOR0 != 0 {
+			errs |= ErrUARTOverrun
+		}
+		if status&avr.UCSR0A_FE0 != 0 {
+			errs |= ErrUARTFraming
+		}
+		if status&avr.UCSR0A_UPE0 != 0 {
+			errs |= ErrUARTParity
+		}
+		uart.receiveError(errs)
+		if status&(avr.UCSR0A_FE0|avr.UCSR0A_UPE0) != 0 {
+			// The byte itself is corrupt.
+			return
+		}
 	}
+
+	// Put data from UDR register into buffer.
+	uart.Receive(byte(data))
 }
 
 // WriteByte writes a byte of data to the UART.
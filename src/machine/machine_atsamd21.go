@@ -505,6 +505,7 @@ type UART struct {
 	Bus       *sam.SERCOM_USART_Type
 	SERCOM    uint8
 	Interrupt interrupt.Interrupt
+	uartState
 }
 
 const (
@@ -512,8 +513,17 @@ const (
 	lsbFirst      = 1
 )
 
+// Receive error bits in the STATUS register of a SERCOM USART.
+const (
+	sercomUSART_STATUS_PERR   = 1 << 0
+	sercomUSART_STATUS_FERR   = 1 << 1
+	sercomUSART_STATUS_BUFOVF = 1 << 2
+)
+
 // Configure the UART.
 func (uart *UART) Configure(config UARTConfig) error {
+	uart.configureBuffers(config, true)
+
 	// Default baud rate to 115200.
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
@@ -627,6 +637,11 @@ func (uart *UART) SetBaudRate(br uint32) {
 
 // WriteByte writes a byte of data to the UART.
 func (uart *UART) WriteByte(c byte) error {
+	if uart.txRing != nil {
+		uart.writeBuffered(c)
+		return nil
+	}
+
 	// wait until ready to receive
 	for !uart.Bus.INTFLAG.HasBits(sam.SERCOM_USART_INTFLAG_DRE) {
 	}
@@ -637,15 +652,67 @@ func (uart *UART) WriteByte(c byte) error {
 // handleInterrupt should be called from the appropriate interrupt handler for
 // this UART instance.
 func (uart *UART) handleInterrupt(interrupt.Interrupt) {
-	// should reset IRQ
-	uart.Receive(byte((uart.Bus.DATA.Get() & 0xFF)))
-	uart.Bus.INTFLAG.SetBits(sam.SERCOM_USART_INTFLAG_RXC)
+	if !uart.isUSART() {
+		return
+	}
+	if uart.Bus.INTFLAG.HasBits(sam.SERCOM_USART_INTFLAG_RXC) {
+		// The error bits are for the byte in DATA, so read them first.
+		if status := uart.Bus.STATUS.Get(); status&(sercomUSART_STATUS_PERR|sercomUSART_STATUS_FERR|sercomUSART_STATUS_BUFOVF) != 0 {
+			var errs UARTError
+			if status&sercomUSART_STATUS_BUFOVF != 0 {
+				errs |= ErrUARTOverrun
+			}
+			if status&sercomUSART_STATUS_FERR != 0 {
+				errs |= ErrUARTFraming
+			}
+			if status&sercomUSART_STATUS_PERR != 0 {
+				errs |= ErrUARTParity
+			}
+			uart.receiveError(errs)
+			uart.Bus.STATUS.Set(status)
+		}
+		// Reading DATA clears the RXC flag.
+		uart.Receive(byte((uart.Bus.DATA.Get() & 0xFF)))
+	}
+	if uart.Bus.INTENSET.HasBits(sam.SERCOM_USART_INTENSET_DRE) {
+		uart.handleTXInterrupt()
+	}
+}
+
+// isUSART returns whether the SERCOM is in USART mode. The SERCOM interrupt is
+// shared with the I2C target, so the handler checks this first.
+func (uart *UART) isUSART() bool {
+	return uart.Bus.CTRLA.Get()&sam.SERCOM_USART_CTRLA_MODE_Msk == sam.SERCOM_USART_CTRLA_MODE_USART_INT_CLK<<sam.SERCOM_USART_CTRLA_MODE_Pos
+}
+
+func (uart *UART) txReady() bool {
+	return uart.Bus.INTFLAG.HasBits(sam.SERCOM_USART_INTFLAG_DRE)
+}
+
+func (uart *UART) txWrite(c byte) {
+	uart.Bus.DATA.Set(uint16(c))
+}
+
+func (uart *UART) setTXInterrupt(enable bool) {
+	if enable {
+		uart.Bus.INTENSET.Set(sam.SERCOM_USART_INTENSET_DRE)
+	} else {
+		uart.Bus.INTENCLR.Set(sam.SERCOM_USART_INTENCLR_DRE)
+	}
 }
 
 // I2C on the SAMD21.
 type I2C struct {
 	Bus    *sam.SERCOM_I2CM_Type
 	SERCOM uint8
+
+	targetInterrupt interrupt.Interrupt
+	target          i2cTarget
+}
+
+// enableTargetInterrupt enables the SERCOM interrupt, for target mode.
+func (i2c *I2C) enableTargetInterrupt() {
+	i2c.targetInterrupt.Enable()
 }
 
 // I2CConfig is used to store config info for I2C.
@@ -653,6 +720,7 @@ type I2CConfig struct {
 	Frequency uint32
 	SCL       Pin
 	SDA       Pin
+	Mode      I2CMode
 }
 
 const (
@@ -706,6 +774,14 @@ func (i2c *I2C) Configure(config I2CConfig) error {
 		i2c.Bus.SYNCBUSY.HasBits(sam.SERCOM_I2CM_SYNCBUSY_SWRST) {
 	}
 
+	if config.Mode == I2CModeTarget {
+		// The peripheral is enabled by Listen.
+		i2c.Bus.CTRLA.Set(i2cTargetMode << sam.SERCOM_I2CS_CTRLA_MODE_Pos)
+		config.SDA.Configure(PinConfig{Mode: sdaPinMode})
+		config.SCL.Configure(PinConfig{Mode: sclPinMode})
+		return nil
+	}
+
 	// Set i2c controller mode
 	//SERCOM_I2CM_CTRLA_MODE( I2C_MASTER_OPERATION )
 	i2c.Bus.CTRLA.Set(sam.SERCOM_I2CM_CTRLA_MODE_I2C_MASTER << sam.SERCOM_I2CM_CTRLA_MODE_Pos) // |
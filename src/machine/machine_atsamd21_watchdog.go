@@ -0,0 +1,92 @@
+//go:build sam && atsamd21
+
+package machine
+
+import "device/sam"
+
+// Watchdog provides access to the hardware watchdog of the SAMD21.
+var Watchdog = &watchdogImpl{}
+
+const (
+	// WatchdogMaxTimeout is the maximum timeout in milliseconds (16s): 16384
+	// cycles of the 1.024kHz watchdog clock.
+	WatchdogMaxTimeout = (16384 * 1000) / 1024
+
+	// Generic clock generator that provides the watchdog clock.
+	watchdogClockGenerator = 5
+)
+
+type watchdogImpl struct {
+	config WatchdogConfig
+}
+
+// Configure the watchdog. The timeout is rounded up to a power of two number
+// of cycles of the 1.024kHz watchdog clock.
+func (wd *watchdogImpl) Configure(config WatchdogConfig) error {
+	wd.config = config
+
+	// Clock the watchdog from the internal ultra low power oscillator, divided
+	// by 32 to get 1.024kHz. Unlike the other oscillators it keeps running in
+	// all sleep modes.
+	sam.GCLK.GENDIV.Set((watchdogClockGenerator << sam.GCLK_GENDIV_ID_Pos) |
+		(32 << sam.GCLK_GENDIV_DIV_Pos))
+	waitForSync()
+	sam.GCLK.GENCTRL.Set((watchdogClockGenerator << sam.GCLK_GENCTRL_ID_Pos) |
+		(sam.GCLK_GENCTRL_SRC_OSCULP32K << sam.GCLK_GENCTRL_SRC_Pos) |
+		sam.GCLK_GENCTRL_GENEN)
+	waitForSync()
+	sam.GCLK.CLKCTRL.Set((sam.GCLK_CLKCTRL_ID_WDT << sam.GCLK_CLKCTRL_ID_Pos) |
+		(watchdogClockGenerator << sam.GCLK_CLKCTRL_GEN_Pos) |
+		sam.GCLK_CLKCTRL_CLKEN)
+	waitForSync()
+
+	// The period is a power of two, starting at 8 cycles.
+	cycles := int64(config.TimeoutMillis) * 1024 / 1000
+	period := uint8(0)
+	for cycles > 8 && period < 0xb {
+		period++
+		cycles >>= 1
+	}
+
+	sam.WDT.CTRL.ClearBits(sam.WDT_CTRL_ENABLE)
+	for sam.WDT.STATUS.HasBits(sam.WDT_STATUS_SYNCBUSY) {
+	}
+	sam.WDT.CONFIG.Set(period << sam.WDT_CONFIG_PER_Pos)
+	for sam.WDT.STATUS.HasBits(sam.WDT_STATUS_SYNCBUSY) {
+	}
+	return nil
+}
+
+// Start the watchdog.
+func (wd *watchdogImpl) Start() error {
+	sam.WDT.CTRL.SetBits(sam.WDT_CTRL_ENABLE)
+	for sam.WDT.STATUS.HasBits(sam.WDT_STATUS_SYNCBUSY) {
+	}
+	startWatchdogIdleHook(wd.config)
+	return nil
+}
+
+// Update the watchdog, indicating that the program is healthy.
+func (wd *watchdogImpl) Update() {
+	// 0xA5 is the magic value to clear the watchdog, other values reset the
+	// chip immediately.
+	sam.WDT.CLEAR.Set(0xA5)
+}
+
+// ResetCause returns why the chip was last reset.
+func (wd *watchdogImpl) ResetCause() ResetCause {
+	cause := sam.PM.RCAUSE.Get()
+	switch {
+	case cause&sam.PM_RCAUSE_WDT != 0:
+		return ResetCauseWatchdog
+	case cause&sam.PM_RCAUSE_SYST != 0:
+		return ResetCauseSoftware
+	case cause&sam.PM_RCAUSE_EXT != 0:
+		return ResetCausePin
+	case cause&(sam.PM_RCAUSE_BOD12|sam.PM_RCAUSE_BOD33) != 0:
+		return ResetCauseBrownout
+	case cause&sam.PM_RCAUSE_POR != 0:
+		return ResetCausePowerOn
+	}
+	return ResetCauseUnknown
+}
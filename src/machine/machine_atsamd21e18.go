@@ -33,6 +33,11 @@ func init() {
 	sercomUSART1.Interrupt = interrupt.New(sam.IRQ_SERCOM1, sercomUSART1.handleInterrupt)
 	sercomUSART2.Interrupt = interrupt.New(sam.IRQ_SERCOM2, sercomUSART2.handleInterrupt)
 	sercomUSART3.Interrupt = interrupt.New(sam.IRQ_SERCOM3, sercomUSART3.handleInterrupt)
+
+	sercomI2CM0.targetInterrupt = interrupt.New(sam.IRQ_SERCOM0, func(interrupt.Interrupt) { sercomI2CM0.handleTargetInterrupt() })
+	sercomI2CM1.targetInterrupt = interrupt.New(sam.IRQ_SERCOM1, func(interrupt.Interrupt) { sercomI2CM1.handleTargetInterrupt() })
+	sercomI2CM2.targetInterrupt = interrupt.New(sam.IRQ_SERCOM2, func(interrupt.Interrupt) { sercomI2CM2.handleTargetInterrupt() })
+	sercomI2CM3.targetInterrupt = interrupt.New(sam.IRQ_SERCOM3, func(interrupt.Interrupt) { sercomI2CM3.handleTargetInterrupt() })
 }
 
 // Return the register and mask to enable a given GPIO pin. This can be used to
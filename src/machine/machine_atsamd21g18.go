@@ -41,6 +41,13 @@ func init() {
 	sercomUSART3.Interrupt = interrupt.New(sam.IRQ_SERCOM3, sercomUSART3.handleInterrupt)
 	sercomUSART4.Interrupt = interrupt.New(sam.IRQ_SERCOM4, sercomUSART4.handleInterrupt)
 	sercomUSART5.Interrupt = interrupt.New(sam.IRQ_SERCOM5, sercomUSART5.handleInterrupt)
+
+	sercomI2CM0.targetInterrupt = interrupt.New(sam.IRQ_SERCOM0, func(interrupt.Interrupt) { sercomI2CM0.handleTargetInterrupt() })
+	sercomI2CM1.targetInterrupt = interrupt.New(sam.IRQ_SERCOM1, func(interrupt.Interrupt) { sercomI2CM1.handleTargetInterrupt() })
+	sercomI2CM2.targetInterrupt = interrupt.New(sam.IRQ_SERCOM2, func(interrupt.Interrupt) { sercomI2CM2.handleTargetInterrupt() })
+	sercomI2CM3.targetInterrupt = interrupt.New(sam.IRQ_SERCOM3, func(interrupt.Interrupt) { sercomI2CM3.handleTargetInterrupt() })
+	sercomI2CM4.targetInterrupt = interrupt.New(sam.IRQ_SERCOM4, func(interrupt.Interrupt) { sercomI2CM4.handleTargetInterrupt() })
+	sercomI2CM5.targetInterrupt = interrupt.New(sam.IRQ_SERCOM5, func(interrupt.Interrupt) { sercomI2CM5.handleTargetInterrupt() })
 }
 
 // Return the register and mask to enable a given GPIO pin. This can be used to
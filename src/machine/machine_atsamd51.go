@@ -968,6 +968,9 @@ type UART struct {
 	Bus       *sam.SERCOM_USART_INT_Type
 	SERCOM    uint8
 	Interrupt interrupt.Interrupt // RXC interrupt
+
+	txInterrupt interrupt.Interrupt // DRE interrupt
+	uartState
 }
 
 var (
@@ -981,11 +984,54 @@ var (
 
 func init() {
 	sercomUSART0.Interrupt = interrupt.New(sam.IRQ_SERCOM0_2, sercomUSART0.handleInterrupt)
+	sercomUSART0.txInterrupt = interrupt.New(sam.IRQ_SERCOM0_0, sercomUSART0.handleTXInterruptIRQ)
 	sercomUSART1.Interrupt = interrupt.New(sam.IRQ_SERCOM1_2, sercomUSART1.handleInterrupt)
+	sercomUSART1.txInterrupt = interrupt.New(sam.IRQ_SERCOM1_0, sercomUSART1.handleTXInterruptIRQ)
 	sercomUSART2.Interrupt = interrupt.New(sam.IRQ_SERCOM2_2, sercomUSART2.handleInterrupt)
+	sercomUSART2.txInterrupt = interrupt.New(sam.IRQ_SERCOM2_0, sercomUSART2.handleTXInterruptIRQ)
 	sercomUSART3.Interrupt = interrupt.New(sam.IRQ_SERCOM3_2, sercomUSART3.handleInterrupt)
+	sercomUSART3.txInterrupt = interrupt.New(sam.IRQ_SERCOM3_0, sercomUSART3.handleTXInterruptIRQ)
 	sercomUSART4.Interrupt = interrupt.New(sam.IRQ_SERCOM4_2, sercomUSART4.handleInterrupt)
+	sercomUSART4.txInterrupt = interrupt.New(sam.IRQ_SERCOM4_0, sercomUSART4.handleTXInterruptIRQ)
 	sercomUSART5.Interrupt = interrupt.New(sam.IRQ_SERCOM5_2, sercomUSART5.handleInterrupt)
+	sercomUSART5.txInterrupt = interrupt.New(sam.IRQ_SERCOM5_0, sercomUSART5.handleTXInterruptIRQ)
+
+	sercomI2CM0.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM0_0, func(interrupt.Interrupt) { sercomI2CM0.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM0_1, func(interrupt.Interrupt) { sercomI2CM0.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM0_2, func(interrupt.Interrupt) { sercomI2CM0.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM0_3, func(interrupt.Interrupt) { sercomI2CM0.handleTargetInterrupt() }),
+	}
+	sercomI2CM1.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM1_0, func(interrupt.Interrupt) { sercomI2CM1.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM1_1, func(interrupt.Interrupt) { sercomI2CM1.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM1_2, func(interrupt.Interrupt) { sercomI2CM1.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM1_3, func(interrupt.Interrupt) { sercomI2CM1.handleTargetInterrupt() }),
+	}
+	sercomI2CM2.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM2_0, func(interrupt.Interrupt) { sercomI2CM2.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM2_1, func(interrupt.Interrupt) { sercomI2CM2.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM2_2, func(interrupt.Interrupt) { sercomI2CM2.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM2_3, func(interrupt.Interrupt) { sercomI2CM2.handleTargetInterrupt() }),
+	}
+	sercomI2CM3.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM3_0, func(interrupt.Interrupt) { sercomI2CM3.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM3_1, func(interrupt.Interrupt) { sercomI2CM3.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM3_2, func(interrupt.Interrupt) { sercomI2CM3.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM3_3, func(interrupt.Interrupt) { sercomI2CM3.handleTargetInterrupt() }),
+	}
+	sercomI2CM4.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM4_0, func(interrupt.Interrupt) { sercomI2CM4.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM4_1, func(interrupt.Interrupt) { sercomI2CM4.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM4_2, func(interrupt.Interrupt) { sercomI2CM4.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM4_3, func(interrupt.Interrupt) { sercomI2CM4.handleTargetInterrupt() }),
+	}
+	sercomI2CM5.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM5_0, func(interrupt.Interrupt) { sercomI2CM5.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM5_1, func(interrupt.Interrupt) { sercomI2CM5.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM5_2, func(interrupt.Interrupt) { sercomI2CM5.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM5_3, func(interrupt.Interrupt) { sercomI2CM5.handleTargetInterrupt() }),
+	}
 }
 
 const (
@@ -993,8 +1039,17 @@ const (
 	lsbFirst      = 1
 )
 
+// Receive error bits in the STATUS register of a SERCOM USART.
+const (
+	sercomUSART_STATUS_PERR   = 1 << 0
+	sercomUSART_STATUS_FERR   = 1 << 1
+	sercomUSART_STATUS_BUFOVF = 1 << 2
+)
+
 // Configure the UART.
 func (uart *UART) Configure(config UARTConfig) error {
+	uart.configureBuffers(config, true)
+
 	// Default baud rate to 115200.
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
@@ -1115,6 +1170,13 @@ func (uart *UART) SetBaudRate(br uint32) {
 
 // WriteByte writes a byte of data to the UART.
 func (uart *UART) WriteByte(c byte) error {
+	uart.WaitAsync()
+
+	if uart.txRing != nil {
+		uart.writeBuffered(c)
+		return nil
+	}
+
 	// wait until ready to receive
 	for !uart.Bus.INTFLAG.HasBits(sam.SERCOM_USART_INT_INTFLAG_DRE) {
 	}
@@ -1123,15 +1185,78 @@ func (uart *UART) WriteByte(c byte) error {
 }
 
 func (uart *UART) handleInterrupt(interrupt.Interrupt) {
-	// should reset IRQ
-	uart.Receive(byte((uart.Bus.DATA.Get() & 0xFF)))
-	uart.Bus.INTFLAG.SetBits(sam.SERCOM_USART_INT_INTFLAG_RXC)
+	if !uart.isUSART() {
+		return
+	}
+	if uart.Bus.INTFLAG.HasBits(sam.SERCOM_USART_INT_INTFLAG_RXC) {
+		// The error bits are for the byte in DATA, so read them first.
+		if status := uart.Bus.STATUS.Get(); status&(sercomUSART_STATUS_PERR|sercomUSART_STATUS_FERR|sercomUSART_STATUS_BUFOVF) != 0 {
+			var errs UARTError
+			if status&sercomUSART_STATUS_BUFOVF != 0 {
+				errs |= ErrUARTOverrun
+			}
+			if status&sercomUSART_STATUS_FERR != 0 {
+				errs |= ErrUARTFraming
+			}
+			if status&sercomUSART_STATUS_PERR != 0 {
+				errs |= ErrUARTParity
+			}
+			uart.receiveError(errs)
+			uart.Bus.STATUS.Set(status)
+		}
+		// Reading DATA clears the RXC flag.
+		uart.Receive(byte((uart.Bus.DATA.Get() & 0xFF)))
+	}
+}
+
+// handleTXInterruptIRQ is the handler of the DRE interrupt, which is a
+// separate interrupt on the SAMD51.
+func (uart *UART) handleTXInterruptIRQ(interrupt.Interrupt) {
+	if !uart.isUSART() {
+		return
+	}
+	uart.handleTXInterrupt()
+}
+
+// isUSART returns whether the SERCOM is in USART mode. The SERCOM interrupts
+// are shared with the I2C target, so the handlers check this first.
+func (uart *UART) isUSART() bool {
+	return uart.Bus.CTRLA.Get()&sam.SERCOM_USART_INT_CTRLA_MODE_Msk == 1<<sam.SERCOM_USART_INT_CTRLA_MODE_Pos
+}
+
+func (uart *UART) txReady() bool {
+	return uart.Bus.INTFLAG.HasBits(sam.SERCOM_USART_INT_INTFLAG_DRE)
+}
+
+func (uart *UART) txWrite(c byte) {
+	uart.Bus.DATA.Set(uint32(c))
+}
+
+func (uart *UART) setTXInterrupt(enable bool) {
+	if enable {
+		uart.Bus.INTENSET.Set(sam.SERCOM_USART_INT_INTENSET_DRE)
+		uart.txInterrupt.Enable()
+	} else {
+		uart.Bus.INTENCLR.Set(sam.SERCOM_USART_INT_INTENCLR_DRE)
+	}
 }
 
 // I2C on the SAMD51.
 type I2C struct {
 	Bus    *sam.SERCOM_I2CM_Type
 	SERCOM uint8
+
+	// The PREC, AMATCH, DRDY and ERROR interrupts, which are separate
+	// interrupts on the SAMD51.
+	targetInterrupts [4]interrupt.Interrupt
+	target           i2cTarget
+}
+
+// enableTargetInterrupt enables the SERCOM interrupts, for target mode.
+func (i2c *I2C) enableTargetInterrupt() {
+	for _, intr := range i2c.targetInterrupts {
+		intr.Enable()
+	}
 }
 
 // I2CConfig is used to store config info for I2C.
@@ -1139,6 +1264,7 @@ type I2CConfig struct {
 	Frequency uint32
 	SCL       Pin
 	SDA       Pin
+	Mode      I2CMode
 }
 
 const (
@@ -1201,6 +1327,14 @@ func (i2c *I2C) Configure(config I2CConfig) error {
 	// set clock
 	setSERCOMClockGenerator(i2c.SERCOM, sam.GCLK_PCHCTRL_GEN_GCLK1)
 
+	if config.Mode == I2CModeTarget {
+		// The peripheral is enabled by Listen.
+		i2c.Bus.CTRLA.Set(i2cTargetMode << sam.SERCOM_I2CS_CTRLA_MODE_Pos)
+		config.SDA.Configure(PinConfig{Mode: sdaPinMode})
+		config.SCL.Configure(PinConfig{Mode: sclPinMode})
+		return nil
+	}
+
 	// Set i2c controller mode
 	//SERCOM_I2CM_CTRLA_MODE( I2C_MASTER_OPERATION )
 	// sam.SERCOM_I2CM_CTRLA_MODE_I2C_MASTER = 5?
@@ -1550,6 +1684,8 @@ func (spi SPI) Configure(config SPIConfig) error {
 
 // Transfer writes/reads a single byte using the SPI interface.
 func (spi SPI) Transfer(w byte) (byte, error) {
+	spi.WaitAsync()
+
 	// write data
 	spi.Bus.DATA.Set(uint32(w))
 
@@ -1579,6 +1715,7 @@ func (spi SPI) Transfer(w byte) (byte, error) {
 //
 //	spi.Tx(nil, rx)
 func (spi SPI) Tx(w, r []byte) error {
+	spi.WaitAsync()
 	switch {
 	case w == nil:
 		// read only, so write zero and read a result.
@@ -0,0 +1,294 @@
+//go:build (sam && atsamd51) || (sam && atsame5x)
+
+package machine
+
+import (
+	"device/sam"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// DMATrigger is the trigger source (TRIGSRC) of the peripheral that paces a
+// DMA transfer.
+type DMATrigger uint8
+
+// DMA triggers.
+const (
+	// DMATriggerNone transfers as fast as possible.
+	DMATriggerNone DMATrigger = 0
+
+	DMATriggerSERCOM0RX DMATrigger = 4
+	DMATriggerSERCOM0TX DMATrigger = 5
+	DMATriggerSERCOM1RX DMATrigger = 6
+	DMATriggerSERCOM1TX DMATrigger = 7
+	DMATriggerSERCOM2RX DMATrigger = 8
+	DMATriggerSERCOM2TX DMATrigger = 9
+	DMATriggerSERCOM3RX DMATrigger = 10
+	DMATriggerSERCOM3TX DMATrigger = 11
+	DMATriggerSERCOM4RX DMATrigger = 12
+	DMATriggerSERCOM4TX DMATrigger = 13
+	DMATriggerSERCOM5RX DMATrigger = 14
+	DMATriggerSERCOM5TX DMATrigger = 15
+	DMATriggerSERCOM6RX DMATrigger = 16
+	DMATriggerSERCOM6TX DMATrigger = 17
+	DMATriggerSERCOM7RX DMATrigger = 18
+	DMATriggerSERCOM7TX DMATrigger = 19
+)
+
+// Maximum number of transfer units of a single transfer.
+const dmaMaxCount = 0xffff
+
+// Only the first 16 of the 32 DMA channels are used, which halves the memory
+// needed for the descriptors. Channel n is reserved for the Tx of SERCOM n,
+// the others are assigned at runtime by ClaimDMAChannel.
+const (
+	numDMAChannels         = 16
+	numReservedDMAChannels = 8
+)
+
+// dmacDescriptor is a transfer descriptor as read by the DMA controller.
+type dmacDescriptor struct {
+	btctrl   volatile.Register16
+	btcnt    volatile.Register16
+	srcaddr  volatile.Register32
+	dstaddr  volatile.Register32
+	descaddr volatile.Register32
+}
+
+// The descriptors of the first transfer of each channel, and the write-back
+// memory where the DMA controller stores the state of active channels.
+//
+//go:align 16
+var dmacDescriptors [numDMAChannels]dmacDescriptor
+
+//go:align 16
+var dmacWriteback [numDMAChannels]dmacDescriptor
+
+// Register bits, as described in the datasheet.
+const (
+	dmacCTRL_DMAENABLE = 1 << 1
+	dmacCTRL_LVLEN_Msk = 0xf << 8 // all priority levels
+
+	dmacCHCTRLA_ENABLE      = 1 << 1
+	dmacCHCTRLA_TRIGSRC_Pos = 8
+	dmacCHCTRLA_TRIGACT_Pos = 20
+
+	dmacTRIGACT_BURST       = 2
+	dmacTRIGACT_TRANSACTION = 3
+
+	dmacCHINT_TERR  = 1 << 0
+	dmacCHINT_TCMPL = 1 << 1
+
+	dmacBTCTRL_VALID        = 1 << 0
+	dmacBTCTRL_BEATSIZE_Pos = 8
+	dmacBTCTRL_SRCINC       = 1 << 10
+	dmacBTCTRL_DSTINC       = 1 << 11
+)
+
+// DMAChannel is one of the DMA channels of the DMAC.
+type DMAChannel struct {
+	dmaState
+	index   uint8
+	trigger DMATrigger
+}
+
+var (
+	dmaChannelStates [numDMAChannels]DMAChannel
+	dmacEnabled      bool
+)
+
+// ClaimDMAChannel returns a free DMA channel, to be used with the given
+// trigger. It returns ErrDMANoChannel if all channels are in use.
+func ClaimDMAChannel(trigger DMATrigger) (*DMAChannel, error) {
+	mask := interrupt.Disable()
+	defer interrupt.Restore(mask)
+	for i := numReservedDMAChannels; i < len(dmaChannelStates); i++ {
+		if !dmaChannelStates[i].claimed {
+			return reservedDMAChannel(i, trigger), nil
+		}
+	}
+	return nil, ErrDMANoChannel
+}
+
+// reservedDMAChannel returns the given DMA channel, which is statically
+// assigned to a peripheral.
+func reservedDMAChannel(index int, trigger DMATrigger) *DMAChannel {
+	if !dmacEnabled {
+		dmacEnabled = true
+		sam.MCLK.AHBMASK.SetBits(sam.MCLK_AHBMASK_DMAC_)
+		sam.DMAC.BASEADDR.Set(uint32(uintptr(unsafe.Pointer(&dmacDescriptors))))
+		sam.DMAC.WRBADDR.Set(uint32(uintptr(unsafe.Pointer(&dmacWriteback))))
+		sam.DMAC.CTRL.Set(dmacCTRL_DMAENABLE | dmacCTRL_LVLEN_Msk)
+
+		// Channels 0-3 have their own interrupt, the others share one.
+		interrupt.New(sam.IRQ_DMAC_0, handleDMACInterrupt).Enable()
+		interrupt.New(sam.IRQ_DMAC_1, handleDMACInterrupt).Enable()
+		interrupt.New(sam.IRQ_DMAC_2, handleDMACInterrupt).Enable()
+		interrupt.New(sam.IRQ_DMAC_3, handleDMACInterrupt).Enable()
+		interrupt.New(sam.IRQ_DMAC_OTHER, handleDMACInterrupt).Enable()
+	}
+	ch := &dmaChannelStates[index]
+	if !ch.claimed {
+		ch.claimed = true
+		ch.index = uint8(index)
+		ch.trigger = trigger
+		sam.DMAC.CHANNEL[index].CHINTENSET.Set(dmacCHINT_TCMPL | dmacCHINT_TERR)
+	}
+	return ch
+}
+
+func handleDMACInterrupt(interrupt.Interrupt) {
+	for i := range dmaChannelStates {
+		regs := &sam.DMAC.CHANNEL[i]
+		flags := regs.CHINTFLAG.Get()
+		if flags == 0 {
+			continue
+		}
+		regs.CHINTFLAG.Set(flags) // clear interrupts
+		ch := &dmaChannelStates[i]
+		if flags&dmacCHINT_TERR != 0 {
+			// Bus error: the channel has been disabled by the hardware.
+			ch.stopped()
+		} else if flags&dmacCHINT_TCMPL != 0 {
+			ch.complete()
+		}
+	}
+}
+
+// start configures the channel for the given transfer and starts it.
+func (ch *DMAChannel) start(t *DMATransfer) {
+	// Addresses that are incremented must point to the end of the block.
+	src := uintptr(t.Src)
+	dst := uintptr(t.Dst)
+	size := uintptr(t.Count) * uintptr(t.Size)
+	btctrl := uint16(dmacBTCTRL_VALID)
+	switch t.Size {
+	case DMASize16:
+		btctrl |= 1 << dmacBTCTRL_BEATSIZE_Pos
+	case DMASize32:
+		btctrl |= 2 << dmacBTCTRL_BEATSIZE_Pos
+	}
+	trigger := ch.trigger
+	trigact := uint32(dmacTRIGACT_BURST)
+	switch t.Direction {
+	case DMAMemoryToMemory:
+		btctrl |= dmacBTCTRL_SRCINC | dmacBTCTRL_DSTINC
+		src += size
+		dst += size
+		trigger = DMATriggerNone
+		trigact = dmacTRIGACT_TRANSACTION
+	case DMAMemoryToPeripheral:
+		btctrl |= dmacBTCTRL_SRCINC
+		src += size
+	case DMAPeripheralToMemory:
+		btctrl |= dmacBTCTRL_DSTINC
+		dst += size
+	}
+
+	// Chained transfers are started from the interrupt, so that each of them
+	// raises a completion interrupt.
+	desc := &dmacDescriptors[ch.index]
+	desc.btctrl.Set(btctrl)
+	desc.btcnt.Set(uint16(t.Count))
+	desc.srcaddr.Set(uint32(src))
+	desc.dstaddr.Set(uint32(dst))
+	desc.descaddr.Set(0)
+
+	regs := &sam.DMAC.CHANNEL[ch.index]
+	regs.CHCTRLA.Set(uint32(trigger)<<dmacCHCTRLA_TRIGSRC_Pos | trigact<<dmacCHCTRLA_TRIGACT_Pos)
+	regs.CHCTRLA.SetBits(dmacCHCTRLA_ENABLE)
+	if trigger == DMATriggerNone {
+		sam.DMAC.SWTRIGCTRL.SetBits(1 << ch.index)
+	}
+}
+
+// Abort stops the current transfer. Chained transfers are not started.
+func (ch *DMAChannel) Abort() {
+	mask := interrupt.Disable()
+	regs := &sam.DMAC.CHANNEL[ch.index]
+	regs.CHCTRLA.ClearBits(dmacCHCTRLA_ENABLE)
+	for regs.CHCTRLA.HasBits(dmacCHCTRLA_ENABLE) {
+	}
+	regs.CHINTFLAG.Set(dmacCHINT_TCMPL | dmacCHINT_TERR)
+	ch.stopped()
+	interrupt.Restore(mask)
+}
+
+// The DMA transfers started by SPI.TxAsync and UART.WriteAsync, one for each
+// SERCOM. The source address is cleared by WaitAsync.
+var sercomDMATransfers [8]DMATransfer
+
+// sercomTxDMA starts writing data to the given data register of a SERCOM,
+// using the DMA channel reserved for it.
+func sercomTxDMA(sercom uint8, data []byte, reg unsafe.Pointer) error {
+	t := &sercomDMATransfers[sercom]
+	*t = DMATransfer{
+		Direction: DMAMemoryToPeripheral,
+		Size:      DMASize8,
+		Src:       unsafe.Pointer(&data[0]),
+		Dst:       reg,
+		Count:     uint32(len(data)),
+	}
+	trigger := DMATriggerSERCOM0TX + 2*DMATrigger(sercom)
+	return reservedDMAChannel(int(sercom), trigger).Start(t)
+}
+
+// sercomWaitDMA waits until the transfer started by sercomTxDMA has
+// completed. It returns false if no transfer was started.
+func sercomWaitDMA(sercom uint8) bool {
+	t := &sercomDMATransfers[sercom]
+	if t.Src == nil {
+		return false
+	}
+	dmaChannelStates[sercom].Wait()
+	t.Src = nil
+	return true
+}
+
+// TxAsync starts writing w using DMA, ignoring Rx, and returns without waiting
+// for the transfer to complete. Transfers are limited to 65535 bytes. The
+// buffer must not be modified until WaitAsync returns. Other SPI methods wait
+// for the transfer to complete before they start.
+func (spi SPI) TxAsync(w []byte) error {
+	spi.WaitAsync()
+	if len(w) == 0 {
+		return nil
+	}
+	return sercomTxDMA(spi.SERCOM, w, unsafe.Pointer(&spi.Bus.DATA))
+}
+
+// WaitAsync blocks until the transfer started by TxAsync has completed. Other
+// goroutines can run in the meantime.
+func (spi SPI) WaitAsync() {
+	if !sercomWaitDMA(spi.SERCOM) {
+		return
+	}
+	for !spi.Bus.INTFLAG.HasBits(sam.SERCOM_SPIM_INTFLAG_TXC) {
+	}
+
+	// The received bytes were not read, clear them and the overflow flag.
+	for spi.Bus.INTFLAG.HasBits(sam.SERCOM_SPIM_INTFLAG_RXC) {
+		spi.Bus.DATA.Get()
+	}
+	spi.Bus.STATUS.Set(sam.SERCOM_SPIM_STATUS_BUFOVF)
+}
+
+// WriteAsync starts writing data using DMA and returns without waiting for the
+// transfer to complete. Transfers are limited to 65535 bytes. The buffer must
+// not be modified until WaitAsync returns. WriteByte and Write wait for the
+// transfer to complete before they start.
+func (uart *UART) WriteAsync(data []byte) error {
+	uart.WaitAsync()
+	uart.flushTX()
+	if len(data) == 0 {
+		return nil
+	}
+	return sercomTxDMA(uart.SERCOM, data, unsafe.Pointer(&uart.Bus.DATA))
+}
+
+// WaitAsync blocks until the transfer started by WriteAsync has completed.
+// Other goroutines can run in the meantime.
+func (uart *UART) WaitAsync() {
+	sercomWaitDMA(uart.SERCOM)
+}
@@ -151,10 +151,8 @@ func handleUSBIRQ(intr interrupt.Interrupt) {
 			// Standard Requests
 			ok = handleStandardSetup(setup)
 		} else {
-			// Class Interface Requests
-			if setup.WIndex < uint16(len(usbSetupHandler)) && usbSetupHandler[setup.WIndex] != nil {
-				ok = usbSetupHandler[setup.WIndex](setup)
-			}
+			// Class and Vendor Requests
+			ok = handleClassSetup(setup)
 		}
 
 		if ok {
@@ -185,7 +183,9 @@ func handleUSBIRQ(intr interrupt.Interrupt) {
 			if usbRxHandler[i] != nil {
 				usbRxHandler[i](buf)
 			}
-			handleEndpointRxComplete(i)
+			if !usbRxPaused[i] {
+				handleEndpointRxComplete(i)
+			}
 		} else if (epFlags & sam.USB_DEVICE_ENDPOINT_EPINTFLAG_TRCPT1) > 0 {
 			if usbTxHandler[i] != nil {
 				usbTxHandler[i]()
@@ -0,0 +1,74 @@
+//go:build (sam && atsamd51) || (sam && atsame5x)
+
+package machine
+
+import "device/sam"
+
+// Watchdog provides access to the hardware watchdog of the SAMD51.
+var Watchdog = &watchdogImpl{}
+
+const (
+	// WatchdogMaxTimeout is the maximum timeout in milliseconds (16s): 16384
+	// cycles of the 1.024kHz watchdog clock.
+	WatchdogMaxTimeout = (16384 * 1000) / 1024
+)
+
+type watchdogImpl struct {
+	config WatchdogConfig
+}
+
+// Configure the watchdog. The timeout is rounded up to a power of two number
+// of cycles of the 1.024kHz watchdog clock.
+func (wd *watchdogImpl) Configure(config WatchdogConfig) error {
+	wd.config = config
+
+	// The period is a power of two, starting at 8 cycles.
+	cycles := int64(config.TimeoutMillis) * 1024 / 1000
+	period := uint8(0)
+	for cycles > 8 && period < 0xb {
+		period++
+		cycles >>= 1
+	}
+
+	sam.WDT.CTRLA.ClearBits(sam.WDT_CTRLA_ENABLE)
+	for sam.WDT.SYNCBUSY.HasBits(sam.WDT_SYNCBUSY_ENABLE) {
+	}
+	sam.WDT.CONFIG.Set(period << sam.WDT_CONFIG_PER_Pos)
+	return nil
+}
+
+// Start the watchdog.
+func (wd *watchdogImpl) Start() error {
+	sam.WDT.CTRLA.SetBits(sam.WDT_CTRLA_ENABLE)
+	for sam.WDT.SYNCBUSY.HasBits(sam.WDT_SYNCBUSY_ENABLE) {
+	}
+	startWatchdogIdleHook(wd.config)
+	return nil
+}
+
+// Update the watchdog, indicating that the program is healthy.
+func (wd *watchdogImpl) Update() {
+	// 0xA5 is the magic value to clear the watchdog, other values reset the
+	// chip immediately.
+	sam.WDT.CLEAR.Set(0xA5)
+}
+
+// ResetCause returns why the chip was last reset.
+func (wd *watchdogImpl) ResetCause() ResetCause {
+	cause := sam.RSTC.RCAUSE.Get()
+	switch {
+	case cause&sam.RSTC_RCAUSE_WDT != 0:
+		return ResetCauseWatchdog
+	case cause&sam.RSTC_RCAUSE_SYST != 0:
+		return ResetCauseSoftware
+	case cause&sam.RSTC_RCAUSE_EXT != 0:
+		return ResetCausePin
+	case cause&(sam.RSTC_RCAUSE_BODCORE|sam.RSTC_RCAUSE_BODVDD) != 0:
+		return ResetCauseBrownout
+	case cause&sam.RSTC_RCAUSE_BACKUP != 0:
+		return ResetCauseWakeup
+	case cause&sam.RSTC_RCAUSE_POR != 0:
+		return ResetCausePowerOn
+	}
+	return ResetCauseUnknown
+}
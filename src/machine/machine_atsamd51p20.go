@@ -6,7 +6,10 @@
 // http://ww1.microchip.com/downloads/en/DeviceDoc/60001507C.pdf
 package machine
 
-import "device/sam"
+import (
+	"device/sam"
+	"runtime/interrupt"
+)
 
 const HSRAM_SIZE = 0x00040000
 
@@ -30,6 +33,22 @@ var (
 	sercomSPIM7 = SPI{Bus: sam.SERCOM7_SPIM, SERCOM: 7}
 )
 
+func init() {
+	sercomI2CM6.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM6_0, func(interrupt.Interrupt) { sercomI2CM6.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM6_1, func(interrupt.Interrupt) { sercomI2CM6.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM6_2, func(interrupt.Interrupt) { sercomI2CM6.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM6_3, func(interrupt.Interrupt) { sercomI2CM6.handleTargetInterrupt() }),
+	}
+
+	sercomI2CM7.targetInterrupts = [4]interrupt.Interrupt{
+		interrupt.New(sam.IRQ_SERCOM7_0, func(interrupt.Interrupt) { sercomI2CM7.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM7_1, func(interrupt.Interrupt) { sercomI2CM7.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM7_2, func(interrupt.Interrupt) { sercomI2CM7.handleTargetInterrupt() }),
+		interrupt.New(sam.IRQ_SERCOM7_3, func(interrupt.Interrupt) { sercomI2CM7.handleTargetInterrupt() }),
+	}
+}
+
 // setSERCOMClockGenerator sets the GCLK for sercom
 func setSERCOMClockGenerator(sercom uint8, gclk uint32) {
 	switch sercom {
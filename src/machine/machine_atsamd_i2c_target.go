@@ -0,0 +1,186 @@
+//go:build (sam && atsamd21) || (sam && atsamd51) || (sam && atsame5x)
+
+package machine
+
+// I2C target mode for the SAMD21 and SAMD51. The SERCOM is accessed through
+// the I2CM registers, which are at the same offsets as the I2CS registers.
+
+import (
+	"device/sam"
+)
+
+const (
+	// SERCOM mode for an I2C target (I2C slave in the datasheet).
+	i2cTargetMode = 4
+
+	// target commands
+	i2cTargetCmdWaitStart = 2 // wait for a (repeated) start or stop
+	i2cTargetCmdContinue  = 3 // acknowledge and continue with the next byte
+
+	// interrupts that drive the target state machine
+	i2cTargetInterrupts = sam.SERCOM_I2CS_INTENSET_PREC | sam.SERCOM_I2CS_INTENSET_AMATCH |
+		sam.SERCOM_I2CS_INTENSET_DRDY | sam.SERCOM_I2CS_INTENSET_ERROR
+)
+
+// Listen starts listening for I2C requests sent to the specified address. The
+// I2C peripheral must have been configured in target mode.
+func (i2c *I2C) Listen(addr uint16) error {
+	if i2c.Bus.CTRLA.Get()&sam.SERCOM_I2CS_CTRLA_MODE_Msk != i2cTargetMode<<sam.SERCOM_I2CS_CTRLA_MODE_Pos {
+		return ErrI2CWrongMode
+	}
+	if addr >= 0x80 || isReservedI2CAddr(uint8(addr)) {
+		return ErrInvalidTgtAddr
+	}
+
+	i2c.Bus.CTRLA.ClearBits(sam.SERCOM_I2CS_CTRLA_ENABLE)
+	i2c.syncTarget()
+	i2c.Bus.ADDR.Set(uint32(addr) << sam.SERCOM_I2CS_ADDR_ADDR_Pos)
+	i2c.Bus.CTRLA.SetBits(sam.SERCOM_I2CS_CTRLA_ENABLE)
+	i2c.syncTarget()
+	i2c.enableTargetInterrupt()
+	return nil
+}
+
+// WaitForEvent blocks the current goroutine until an I2C event is received
+// (when in target mode). Other goroutines run in the meantime: the transfer is
+// handled by the SERCOM interrupt.
+//
+// The passed buffer will be populated for receive events, with the number of
+// bytes received returned in count. Bytes that don't fit in the buffer are not
+// acknowledged. For other event types, buf is not modified and a count of zero
+// is returned.
+//
+// For request events, the caller MUST call Reply to avoid hanging the I2C bus
+// indefinitely.
+func (i2c *I2C) WaitForEvent(buf []byte) (evt I2CTargetEvent, count int, err error) {
+	i2c.target.start(buf, false)
+	i2c.waitTarget()
+	return i2c.target.event, i2c.target.count, i2c.target.err
+}
+
+// Reply supplies the response data to the controller, after WaitForEvent
+// returned a request event. If the controller reads more bytes than are in
+// buf, it receives 0xff for the remaining bytes.
+func (i2c *I2C) Reply(buf []byte) error {
+	if !i2c.Bus.INTFLAG.HasBits(sam.SERCOM_I2CS_INTFLAG_AMATCH) ||
+		!i2c.Bus.STATUS.HasBits(sam.SERCOM_I2CS_STATUS_DIR) {
+		return ErrI2CWrongMode
+	}
+
+	i2c.target.start(buf, true)
+	// Acknowledge the address.
+	i2c.targetCommand(true, i2cTargetCmdContinue)
+	i2c.waitTarget()
+	return i2c.target.err
+}
+
+// waitTarget enables the target interrupts, and parks the current goroutine
+// until the interrupt handler has completed the call to WaitForEvent or Reply.
+func (i2c *I2C) waitTarget() {
+	i2c.Bus.INTENSET.Set(i2cTargetInterrupts)
+	i2c.target.wait()
+}
+
+// finishTarget disables the target interrupts and wakes up the goroutine in
+// waitTarget. The flags that are still set are handled by the next call.
+func (i2c *I2C) finishTarget(evt I2CTargetEvent, err error) {
+	i2c.Bus.INTENCLR.Set(i2cTargetInterrupts)
+	i2c.target.finish(evt, err)
+}
+
+// handleTargetInterrupt is called from the SERCOM interrupt, which is shared
+// with the UART on the same SERCOM.
+func (i2c *I2C) handleTargetInterrupt() {
+	if i2c.target.busy.Get() == 0 {
+		return
+	}
+	if i2c.target.reply {
+		i2c.handleReply()
+	} else {
+		i2c.handleEvent()
+	}
+}
+
+// handleEvent handles a single event for WaitForEvent.
+func (i2c *I2C) handleEvent() {
+	t := &i2c.target
+	flags := i2c.Bus.INTFLAG.Get()
+	switch {
+	case flags&sam.SERCOM_I2CS_INTFLAG_ERROR != 0:
+		i2c.Bus.INTFLAG.Set(sam.SERCOM_I2CS_INTFLAG_ERROR)
+		i2c.finishTarget(I2CReceive, errI2CBusError)
+
+	// Stop
+	case flags&sam.SERCOM_I2CS_INTFLAG_PREC != 0:
+		i2c.Bus.INTFLAG.Set(sam.SERCOM_I2CS_INTFLAG_PREC)
+		if t.count > 0 {
+			i2c.finishTarget(I2CReceive, nil)
+		} else {
+			i2c.finishTarget(I2CFinish, nil)
+		}
+
+	// Start or repeated start. The clock is stretched until the address is
+	// acknowledged.
+	case flags&sam.SERCOM_I2CS_INTFLAG_AMATCH != 0:
+		if t.count > 0 {
+			// Repeated start: first report the received data, the address
+			// is handled on the next call.
+			i2c.finishTarget(I2CReceive, nil)
+		} else if i2c.Bus.STATUS.HasBits(sam.SERCOM_I2CS_STATUS_DIR) {
+			// The address is acknowledged in Reply.
+			i2c.finishTarget(I2CRequest, nil)
+		} else {
+			i2c.targetCommand(true, i2cTargetCmdContinue)
+		}
+
+	// Data received
+	case flags&sam.SERCOM_I2CS_INTFLAG_DRDY != 0:
+		ack := t.receive(byte(i2c.Bus.DATA.Get()))
+		i2c.targetCommand(ack, i2cTargetCmdContinue)
+	}
+}
+
+// handleReply handles a single event for Reply.
+func (i2c *I2C) handleReply() {
+	t := &i2c.target
+	flags := i2c.Bus.INTFLAG.Get()
+	switch {
+	case flags&sam.SERCOM_I2CS_INTFLAG_ERROR != 0:
+		i2c.Bus.INTFLAG.Set(sam.SERCOM_I2CS_INTFLAG_ERROR)
+		i2c.finishTarget(I2CRequest, errI2CBusError)
+
+	case flags&sam.SERCOM_I2CS_INTFLAG_DRDY != 0:
+		if t.count > 0 && i2c.Bus.STATUS.HasBits(sam.SERCOM_I2CS_STATUS_RXNACK) {
+			// The controller doesn't want any more data.
+			i2c.targetCommand(true, i2cTargetCmdWaitStart)
+		} else {
+			i2c.Bus.DATA.Set(t.next())
+		}
+
+	case flags&sam.SERCOM_I2CS_INTFLAG_PREC != 0:
+		i2c.Bus.INTFLAG.Set(sam.SERCOM_I2CS_INTFLAG_PREC)
+		i2c.finishTarget(I2CRequest, nil)
+
+	// A repeated start is handled by WaitForEvent.
+	case flags&sam.SERCOM_I2CS_INTFLAG_AMATCH != 0:
+		i2c.finishTarget(I2CRequest, nil)
+	}
+}
+
+// syncTarget waits until the peripheral is enabled or disabled. The SAMD21 and
+// SAMD51 both have a separate SYNCBUSY register for this (the STATUS.SYNCBUSY
+// bit only exists on the SAMD20).
+func (i2c *I2C) syncTarget() {
+	for i2c.Bus.SYNCBUSY.HasBits(sam.SERCOM_I2CS_SYNCBUSY_ENABLE) {
+	}
+}
+
+// targetCommand acknowledges (or not) the last address or data byte, and
+// executes the given command.
+func (i2c *I2C) targetCommand(ack bool, cmd uint32) {
+	value := cmd << sam.SERCOM_I2CS_CTRLB_CMD_Pos
+	if !ack {
+		value |= sam.SERCOM_I2CS_CTRLB_ACKACT
+	}
+	i2c.Bus.CTRLB.ReplaceBits(value, sam.SERCOM_I2CS_CTRLB_CMD_Msk|sam.SERCOM_I2CS_CTRLB_ACKACT, 0)
+}
@@ -4,7 +4,6 @@ package machine
 
 import (
 	"device/sam"
-	"errors"
 	"runtime/interrupt"
 	"unsafe"
 )
@@ -27,38 +26,25 @@ var CANTxFifo [2][(8 + 64) * CANTxFifoSize]byte
 //go:align 4
 var CANEvFifo [2][(8) * CANEvFifoSize]byte
 
-type CAN struct {
-	Bus *sam.CAN_Type
-}
+// Number of standard and of extended filters that can be set with SetFilters.
+const canFilterCount = 8
 
-type CANTransferRate uint32
+//go:align 4
+var canStdFilters [2][canFilterCount]uint32
 
-// CAN transfer rates for CANConfig
-const (
-	CANTransferRate125kbps  CANTransferRate = 125000
-	CANTransferRate250kbps  CANTransferRate = 250000
-	CANTransferRate500kbps  CANTransferRate = 500000
-	CANTransferRate1000kbps CANTransferRate = 1000000
-	CANTransferRate2000kbps CANTransferRate = 2000000
-	CANTransferRate4000kbps CANTransferRate = 4000000
-)
+//go:align 4
+var canExtFilters [2][canFilterCount][2]uint32
 
-// CANConfig holds CAN configuration parameters. Tx and Rx need to be
-// specified with some pins. When the Standby Pin is specified, configure it
-// as an output pin and output Low in Configure(). If this operation is not
-// necessary, specify NoPin.
-type CANConfig struct {
-	TransferRate   CANTransferRate
-	TransferRateFD CANTransferRate
-	Tx             Pin
-	Rx             Pin
-	Standby        Pin
-}
+// The goroutines blocked in Transmit and Receive, for each controller.
+var canWait [2]canWaiters
 
-var (
-	errCANInvalidTransferRate   = errors.New("CAN: invalid TransferRate")
-	errCANInvalidTransferRateFD = errors.New("CAN: invalid TransferRateFD")
-)
+// The interrupts that wake up Transmit and Receive. They stay enabled
+// whatever is passed to SetInterrupt.
+const canDriverInterrupts = sam.CAN_IE_RF0NE | sam.CAN_IE_TCE | sam.CAN_IE_BOE
+
+type CAN struct {
+	Bus *sam.CAN_Type
+}
 
 // Configure this CAN peripheral with the given configuration.
 func (can *CAN) Configure(config CANConfig) error {
@@ -75,13 +61,18 @@ func (can *CAN) Configure(config CANConfig) error {
 	config.Rx.Configure(PinConfig{Mode: mode})
 	config.Tx.Configure(PinConfig{Mode: mode})
 
-	can.Bus.CCCR.SetBits(sam.CAN_CCCR_INIT)
-	for !can.Bus.CCCR.HasBits(sam.CAN_CCCR_INIT) {
-	}
-
-	can.Bus.CCCR.SetBits(sam.CAN_CCCR_CCE)
+	can.enterInit()
 
 	can.Bus.CCCR.SetBits(sam.CAN_CCCR_BRSE | sam.CAN_CCCR_FDOE)
+	can.Bus.CCCR.ClearBits(sam.CAN_CCCR_TEST | sam.CAN_CCCR_MON)
+	switch config.Mode {
+	case CANModeLoopback:
+		// internal loopback: transmitted frames are not sent to the bus
+		can.Bus.CCCR.SetBits(sam.CAN_CCCR_TEST | sam.CAN_CCCR_MON)
+		can.Bus.TEST.SetBits(sam.CAN_TEST_LBCK)
+	case CANModeListenOnly:
+		can.Bus.CCCR.SetBits(sam.CAN_CCCR_MON)
+	}
 	can.Bus.MRCFG.Set(sam.CAN_MRCFG_QOS_MEDIUM)
 	// base clock == 48 MHz
 	if config.TransferRate == 0 {
@@ -137,20 +128,146 @@ func (can *CAN) Configure(config CANConfig) error {
 
 	can.Bus.TSCC.Set(sam.CAN_TSCC_TSS_INC)
 
-	can.Bus.GFC.Set(0<<sam.CAN_GFC_ANFS_Pos | 0<<sam.CAN_GFC_ANFE_Pos)
-
-	can.Bus.SIDFC.Set(0 << sam.CAN_SIDFC_LSS_Pos)
-	can.Bus.XIDFC.Set(0 << sam.CAN_SIDFC_LSS_Pos)
+	can.setFilterLists(0, 0)
 
 	can.Bus.XIDAM.Set(0x1FFFFFFF << sam.CAN_XIDAM_EIDM_Pos)
 
 	can.Bus.ILE.SetBits(sam.CAN_ILE_EINT0)
+	can.Bus.TXBTIE.Set(1<<CANTxFifoSize - 1)
+	can.Bus.IE.SetBits(canDriverInterrupts)
+	can.enableInterrupt()
 
+	can.leaveInit()
+
+	return nil
+}
+
+// enterInit stops the CAN controller and enables changes to its
+// configuration.
+func (can *CAN) enterInit() {
+	can.Bus.CCCR.SetBits(sam.CAN_CCCR_INIT)
+	for !can.Bus.CCCR.HasBits(sam.CAN_CCCR_INIT) {
+	}
+	can.Bus.CCCR.SetBits(sam.CAN_CCCR_CCE)
+}
+
+// leaveInit starts the CAN controller again after enterInit.
+func (can *CAN) leaveInit() {
 	can.Bus.CCCR.ClearBits(sam.CAN_CCCR_CCE)
 	can.Bus.CCCR.ClearBits(sam.CAN_CCCR_INIT)
 	for can.Bus.CCCR.HasBits(sam.CAN_CCCR_INIT) {
 	}
+}
+
+// setFilterLists configures the standard and extended filter lists. When
+// there are no filters at all, all frames are stored in Rx FIFO 0. Otherwise
+// frames that don't match a filter are rejected.
+func (can *CAN) setFilterLists(std, ext uint32) {
+	nonMatching := uint32(0) // accept in Rx FIFO 0
+	if std+ext != 0 {
+		nonMatching = 2 // reject
+	}
+	can.Bus.GFC.Set(nonMatching<<sam.CAN_GFC_ANFS_Pos | nonMatching<<sam.CAN_GFC_ANFE_Pos)
+	can.Bus.SIDFC.Set(std<<sam.CAN_SIDFC_LSS_Pos | uint32(uintptr(unsafe.Pointer(&canStdFilters[can.instance()][0])))&0xFFFF)
+	can.Bus.XIDFC.Set(ext<<sam.CAN_XIDFC_LSE_Pos | uint32(uintptr(unsafe.Pointer(&canExtFilters[can.instance()][0])))&0xFFFF)
+}
+
+// SetFilters replaces the set of receive filters. A frame is received when it
+// matches any of the filters. All frames are received when no filters are
+// set, which is the default. Up to 8 standard and 8 extended filters can be
+// set.
+func (can *CAN) SetFilters(filters []CANFilter) error {
+	var std, ext uint32
+	for _, f := range filters {
+		if f.Extended {
+			ext++
+		} else {
+			std++
+		}
+	}
+	if std > canFilterCount || ext > canFilterCount {
+		return ErrCANInvalidFilter
+	}
 
+	can.enterInit()
+	std, ext = 0, 0
+	for _, f := range filters {
+		if f.Extended {
+			e := &canExtFilters[can.instance()][ext]
+			e[0], e[1] = mcanExtFilter(f)
+			ext++
+		} else {
+			canStdFilters[can.instance()][std] = mcanStdFilter(f)
+			std++
+		}
+	}
+	can.setFilterLists(std, ext)
+	can.leaveInit()
+	return nil
+}
+
+// Transmit queues a frame for transmission. It blocks while the Tx FIFO is
+// full, and returns ErrCANBusOff if the controller is bus-off.
+func (can *CAN) Transmit(frame *CANFrame) error {
+	if err := frame.check(true); err != nil {
+		return err
+	}
+	for {
+		if can.Bus.PSR.HasBits(sam.CAN_PSR_BO) {
+			return ErrCANBusOff
+		}
+		if !can.TxFifoIsFull() {
+			break
+		}
+		// Woken up when a frame was sent, or when the bus state changed.
+		canWait[can.instance()].tx.Wait()
+	}
+
+	putIndex := (can.Bus.TXFQS.Get() & sam.CAN_TXFQS_TFQPI_Msk) >> sam.CAN_TXFQS_TFQPI_Pos
+	e := (*mcanElement)(unsafe.Pointer(&CANTxFifo[can.instance()][putIndex*(8+64)]))
+	e.write(frame)
+	can.Bus.TXBAR.Set(1 << putIndex)
+	return nil
+}
+
+// Receive blocks until a frame is received and copies it to frame.
+func (can *CAN) Receive(frame *CANFrame) error {
+	for can.RxFifoIsEmpty() {
+		canWait[can.instance()].rx.Wait()
+	}
+	idx := (can.Bus.RXF0S.Get() & sam.CAN_RXF0S_F0GI_Msk) >> sam.CAN_RXF0S_F0GI_Pos
+	e := (*mcanElement)(unsafe.Pointer(&CANRxFifo[can.instance()][idx*(8+64)]))
+	e.read(frame)
+	can.Bus.RXF0A.Set(idx << sam.CAN_RXF0A_F0AI_Pos)
+	return nil
+}
+
+// Available returns the number of frames that can be received without
+// blocking.
+func (can *CAN) Available() int {
+	return can.RxFifoSize()
+}
+
+// ErrorCounters returns the current error counters and bus state.
+func (can *CAN) ErrorCounters() CANErrorCounters {
+	ecr := can.Bus.ECR.Get()
+	tec := (ecr & sam.CAN_ECR_TEC_Msk) >> sam.CAN_ECR_TEC_Pos
+	rec := (ecr & sam.CAN_ECR_REC_Msk) >> sam.CAN_ECR_REC_Pos
+	return CANErrorCounters{
+		State:    canErrorState(can.Bus.PSR.HasBits(sam.CAN_PSR_BO), tec, rec),
+		TxErrors: uint8(tec),
+		RxErrors: uint8(rec),
+	}
+}
+
+// Recover starts bus-off recovery. The controller reconnects after it has
+// seen 128 occurrences of 11 recessive bits on the bus.
+func (can *CAN) Recover() error {
+	if can.Bus.PSR.HasBits(sam.CAN_PSR_BO) {
+		// The controller sets INIT when it goes bus-off. Clearing it starts
+		// the recovery sequence.
+		can.Bus.CCCR.ClearBits(sam.CAN_CCCR_INIT)
+	}
 	return nil
 }
 
@@ -166,54 +283,64 @@ var (
 //
 // This call will replace a previously set callback. You can pass a nil func
 // to unset the CAN interrupt. If you do so, the change parameter is ignored
-// and can be set to any value (such as 0).
+// and can be set to any value (such as 0). The interrupts that Transmit and
+// Receive need stay enabled.
 func (can *CAN) SetInterrupt(ie uint32, callback func(*CAN)) error {
+	idx := can.instance()
 	if callback == nil {
 		// Disable this CAN interrupt
-		can.Bus.IE.ClearBits(ie)
+		can.Bus.IE.ClearBits(ie &^ canDriverInterrupts)
+		for i := uint(0); i < 32; i++ {
+			if ie&(1<<i) != 0 {
+				canCallbacks[idx][i] = nil
+			}
+		}
 		return nil
 	}
-	can.Bus.IE.SetBits(ie)
-
-	idx := 0
-	switch can.Bus {
-	case sam.CAN0:
-		canInstances[0] = can
-	case sam.CAN1:
-		canInstances[1] = can
-		idx = 1
-	}
 
+	canInstances[idx] = can
 	for i := uint(0); i < 32; i++ {
 		if ie&(1<<i) != 0 {
 			canCallbacks[idx][i] = callback
 		}
 	}
+	can.Bus.IE.SetBits(ie)
+	can.enableInterrupt()
 
+	return nil
+}
+
+// enableInterrupt registers the interrupt handler of this CAN controller and
+// enables its interrupt.
+func (can *CAN) enableInterrupt() {
 	switch can.Bus {
 	case sam.CAN0:
 		interrupt.New(sam.IRQ_CAN0, func(interrupt.Interrupt) {
-			ir := sam.CAN0.IR.Get()
-			sam.CAN0.IR.Set(ir) // clear interrupt
-			for i := uint(0); i < 32; i++ {
-				if ir&(1<<i) != 0 && canCallbacks[0][i] != nil {
-					canCallbacks[0][i](canInstances[0])
-				}
-			}
+			canHandleInterrupt(0, sam.CAN0)
 		}).Enable()
 	case sam.CAN1:
 		interrupt.New(sam.IRQ_CAN1, func(interrupt.Interrupt) {
-			ir := sam.CAN1.IR.Get()
-			sam.CAN1.IR.Set(ir) // clear interrupt
-			for i := uint(0); i < 32; i++ {
-				if ir&(1<<i) != 0 && canCallbacks[1][i] != nil {
-					canCallbacks[1][i](canInstances[1])
-				}
-			}
+			canHandleInterrupt(1, sam.CAN1)
 		}).Enable()
 	}
+}
 
-	return nil
+// canHandleInterrupt wakes up the goroutines blocked in Transmit and Receive,
+// and calls the callbacks set with SetInterrupt.
+func canHandleInterrupt(idx byte, bus *sam.CAN_Type) {
+	ir := bus.IR.Get() & bus.IE.Get()
+	bus.IR.Set(ir) // clear interrupt
+	if ir&sam.CAN_IR_RF0N != 0 {
+		canWait[idx].rx.Notify()
+	}
+	if ir&(sam.CAN_IR_TC|sam.CAN_IR_BO) != 0 {
+		canWait[idx].tx.Notify()
+	}
+	for i := uint(0); i < 32; i++ {
+		if ir&(1<<i) != 0 && canCallbacks[idx][i] != nil {
+			canCallbacks[idx][i](canInstances[idx])
+		}
+	}
 }
 
 // TxFifoIsFull returns whether TxFifo is full or not.
@@ -427,47 +554,3 @@ func (e CANRxBufferElement) Data() []byte {
 func (e CANRxBufferElement) Length() byte {
 	return CANDlcToLength(e.DLC, e.FDF)
 }
-
-// CANDlcToLength() converts a DLC value to its actual length.
-func CANDlcToLength(dlc byte, isFD bool) byte {
-	length := dlc
-	if dlc == 0x09 {
-		length = 12
-	} else if dlc == 0x0A {
-		length = 16
-	} else if dlc == 0x0B {
-		length = 20
-	} else if dlc == 0x0C {
-		length = 24
-	} else if dlc == 0x0D {
-		length = 32
-	} else if dlc == 0x0E {
-		length = 48
-	} else if dlc == 0x0F {
-		length = 64
-	}
-	return length
-
-}
-
-// CANLengthToDlc() converts its actual length to a DLC value.
-func CANLengthToDlc(length byte, isFD bool) byte {
-	dlc := length
-	if length <= 0x08 {
-	} else if length <= 12 {
-		dlc = 0x09
-	} else if length <= 16 {
-		dlc = 0x0A
-	} else if length <= 20 {
-		dlc = 0x0B
-	} else if length <= 24 {
-		dlc = 0x0C
-	} else if length <= 32 {
-		dlc = 0x0D
-	} else if length <= 48 {
-		dlc = 0x0E
-	} else if length <= 64 {
-		dlc = 0x0F
-	}
-	return dlc
-}
@@ -305,9 +305,11 @@ var (
 type UART struct {
 	Bus    *esp.UART_Type
 	Buffer *RingBuffer
+	uartState
 }
 
 func (uart *UART) Configure(config UARTConfig) {
+	uart.configureBuffers(config, false)
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
 	}
@@ -258,6 +258,7 @@ type UART struct {
 	ParityErrorDetected  bool // set when parity error detected
 	DataErrorDetected    bool // set when data corruption detected
 	DataOverflowDetected bool // set when data overflow detected in UART FIFO buffer or RingBuffer
+	uartState
 }
 
 const (
@@ -281,6 +282,7 @@ type registerSet struct {
 }
 
 func (uart *UART) Configure(config UARTConfig) error {
+	uart.configureBuffers(config, false)
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
 	}
@@ -446,17 +448,22 @@ func (uart *UART) serveInterrupt(num int) {
 			b := uart.Bus.GetFIFO_RXFIFO_RD_BYTE()
 			if !uart.Buffer.Put(byte(b & 0xff)) {
 				uart.DataOverflowDetected = true
+				uart.receiveError(ErrUARTOverrun)
 			}
 		}
+		uart.rxReady.Notify()
 	}
 	if interrutFlag&esp.UART_INT_ENA_PARITY_ERR_INT_ENA > 0 {
 		uart.ParityErrorDetected = true
+		uart.receiveError(ErrUARTParity)
 	}
 	if 0 != interrutFlag&esp.UART_INT_ENA_FRM_ERR_INT_ENA {
 		uart.DataErrorDetected = true
+		uart.receiveError(ErrUARTFraming)
 	}
 	if 0 != interrutFlag&esp.UART_INT_ENA_RXFIFO_OVF_INT_ENA {
 		uart.DataOverflowDetected = true
+		uart.receiveError(ErrUARTOverrun)
 	}
 	if 0 != interrutFlag&esp.UART_INT_ENA_GLITCH_DET_INT_ENA {
 		uart.DataErrorDetected = true
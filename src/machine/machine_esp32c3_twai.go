@@ -0,0 +1,325 @@
+//go:build esp32c3
+
+package machine
+
+// CAN driver for the TWAI (Two-Wire Automotive Interface) controller of the
+// ESP32-C3, which is compatible with the SJA1000 in PeliCAN mode.
+
+import (
+	"device/esp"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// CAN is a TWAI controller. It supports classic CAN frames with up to 8 data
+// bytes.
+type CAN struct {
+	Bus *esp.TWAI_Type
+}
+
+var CAN0 = CAN{Bus: esp.TWAI}
+
+// The TWAI controller has a single acceptance filter. Additional filters are
+// applied in software by Receive. They are package variables rather than fields
+// of CAN, so that copies of CAN0 share them.
+const canFilterCount = 8
+
+var (
+	twaiFilters     [canFilterCount]CANFilter
+	twaiFilterCount uint8
+)
+
+// The goroutines blocked in Transmit and Receive.
+var canWait canWaiters
+
+const (
+	twaiClockFrequency = 80e6 // APB clock
+
+	// TWAI_CLK_EN and TWAI_RST in PERIP_CLK_EN0 and PERIP_RST_EN0.
+	twaiPeripheralBit = 1 << 19
+
+	// GPIO matrix signals
+	twaiRxSignal = 74
+	twaiTxSignal = 74
+
+	// CPU interrupt of the TWAI controller. Pins use 6, the UARTs 7 and the
+	// runtime timer 8.
+	cpuInterruptFromCAN = 9
+)
+
+// Register bits, as described in the technical reference manual.
+const (
+	twaiMODE_RESET       = 1 << 0
+	twaiMODE_LISTEN_ONLY = 1 << 1
+	twaiMODE_SELF_TEST   = 1 << 2
+	twaiMODE_RX_FILTER   = 1 << 3 // single filter mode
+
+	twaiCMD_TX_REQ      = 1 << 0
+	twaiCMD_RELEASE_BUF = 1 << 2
+	twaiCMD_CLR_OVERRUN = 1 << 3
+	twaiCMD_SELF_RX_REQ = 1 << 4
+
+	twaiSTATUS_RX_BUF  = 1 << 0
+	twaiSTATUS_OVERRUN = 1 << 1
+	twaiSTATUS_TX_BUF  = 1 << 2
+	twaiSTATUS_BUS_OFF = 1 << 7
+
+	// INT_RAW and INT_ENA
+	twaiINT_RX       = 1 << 0
+	twaiINT_TX       = 1 << 1
+	twaiINT_ERR_WARN = 1 << 2 // error or bus status changed
+
+	twaiBUS_TIMING_0_SJW_Pos  = 14
+	twaiBUS_TIMING_1_SEG2_Pos = 4
+
+	// Frame information in the first data register.
+	twaiFrameFF  = 1 << 7 // extended frame format
+	twaiFrameRTR = 1 << 6
+)
+
+// data returns the 13 data registers. They hold a frame in operating mode,
+// and the acceptance filter in reset mode.
+func (can *CAN) data() *[13]volatile.Register32 {
+	return (*[13]volatile.Register32)(unsafe.Pointer(&can.Bus.DATA_0))
+}
+
+// Configure this CAN peripheral with the given configuration.
+//
+// In loopback mode the TWAI controller receives its own frames through the
+// GPIO matrix, so frames are still sent on the Tx pin.
+func (can *CAN) Configure(config CANConfig) error {
+	if config.TransferRate == 0 {
+		config.TransferRate = CANTransferRate500kbps
+	}
+	// The prescaler divides the APB clock by a multiple of 2.
+	prescaler, seg1, seg2, err := canBitTiming(twaiClockFrequency/2, config.TransferRate, 1<<13)
+	if err != nil {
+		return err
+	}
+
+	esp.SYSTEM.PERIP_CLK_EN0.SetBits(twaiPeripheralBit)
+	esp.SYSTEM.PERIP_RST_EN0.SetBits(twaiPeripheralBit)
+	esp.SYSTEM.PERIP_RST_EN0.ClearBits(twaiPeripheralBit)
+	can.Bus.MODE.Set(twaiMODE_RESET)
+
+	if config.Standby != NoPin {
+		config.Standby.Configure(PinConfig{Mode: PinOutput})
+		config.Standby.Low()
+	}
+	config.Tx.Configure(PinConfig{Mode: PinOutput})
+	config.Tx.outFunc().Set(twaiTxSignal)
+	rx := config.Rx
+	if config.Mode == CANModeLoopback {
+		rx = config.Tx
+	} else {
+		rx.Configure(PinConfig{Mode: PinInputPullup})
+	}
+	inFunc(twaiRxSignal).Set(esp.GPIO_FUNC_IN_SEL_CFG_SIG_IN_SEL | uint32(rx))
+
+	can.Bus.BUS_TIMING_0.Set((prescaler - 1) | (seg2-1)<<twaiBUS_TIMING_0_SJW_Pos)
+	can.Bus.BUS_TIMING_1.Set((seg1 - 1) | (seg2-1)<<twaiBUS_TIMING_1_SEG2_Pos)
+	// Interrupts for Transmit and Receive. The Rx interrupt is enabled by
+	// Receive when it has to wait.
+	can.Bus.INT_ENA.Set(twaiINT_TX | twaiINT_ERR_WARN)
+	esp.INTERRUPT_CORE0.CAN_INT_MAP.Set(cpuInterruptFromCAN)
+	interrupt.New(cpuInterruptFromCAN, func(interrupt.Interrupt) {
+		canHandleInterrupt(esp.TWAI)
+	}).Enable()
+
+	twaiFilterCount = 0
+	can.setAcceptanceFilter()
+
+	// Leave reset mode.
+	mode := uint32(twaiMODE_RX_FILTER)
+	switch config.Mode {
+	case CANModeLoopback:
+		mode |= twaiMODE_SELF_TEST
+	case CANModeListenOnly:
+		mode |= twaiMODE_LISTEN_ONLY
+	}
+	can.Bus.MODE.Set(mode)
+	return nil
+}
+
+// setAcceptanceFilter configures the hardware filter. It must be called in
+// reset mode. With a single filter the hardware does most of the filtering,
+// otherwise all frames are accepted and filtered by Receive.
+func (can *CAN) setAcceptanceFilter() {
+	code := uint32(0)
+	mask := uint32(0xffffffff) // 1 bits are ignored
+	if twaiFilterCount == 1 {
+		f := twaiFilters[0]
+		if f.Extended {
+			code = f.ID << 3
+			mask = ^(f.Mask << 3)
+		} else {
+			code = f.ID << 21
+			mask = ^(f.Mask << 21)
+		}
+	}
+	data := can.data()
+	for i := 0; i < 4; i++ {
+		data[i].Set(code >> (24 - 8*i) & 0xff)
+		data[4+i].Set(mask >> (24 - 8*i) & 0xff)
+	}
+}
+
+// SetFilters replaces the set of receive filters. A frame is received when it
+// matches any of the filters. All frames are received when no filters are
+// set, which is the default. Up to 8 filters can be set.
+func (can *CAN) SetFilters(filters []CANFilter) error {
+	if len(filters) > canFilterCount {
+		return ErrCANInvalidFilter
+	}
+	twaiFilterCount = uint8(copy(twaiFilters[:], filters))
+
+	mode := can.Bus.MODE.Get()
+	can.Bus.MODE.Set(mode | twaiMODE_RESET)
+	can.setAcceptanceFilter()
+	can.Bus.MODE.Set(mode)
+	return nil
+}
+
+// Transmit queues a frame for transmission. It blocks while the previous frame
+// is still being sent, and returns ErrCANBusOff if the controller is bus-off.
+func (can *CAN) Transmit(frame *CANFrame) error {
+	if err := frame.check(false); err != nil {
+		return err
+	}
+	for {
+		status := can.Bus.STATUS.Get()
+		if status&twaiSTATUS_BUS_OFF != 0 {
+			return ErrCANBusOff
+		}
+		if status&twaiSTATUS_TX_BUF != 0 {
+			break
+		}
+		// Woken up when the frame was sent, or when the bus state changed.
+		canWait.tx.Wait()
+	}
+
+	data := can.data()
+	info := uint32(frame.Length)
+	if frame.Remote {
+		info |= twaiFrameRTR
+	}
+	n := 3
+	if frame.Extended {
+		info |= twaiFrameFF
+		id := frame.ID << 3
+		data[1].Set(id >> 24 & 0xff)
+		data[2].Set(id >> 16 & 0xff)
+		data[3].Set(id >> 8 & 0xff)
+		data[4].Set(id & 0xff)
+		n = 5
+	} else {
+		id := frame.ID << 5
+		data[1].Set(id >> 8 & 0xff)
+		data[2].Set(id & 0xff)
+	}
+	data[0].Set(info)
+	for i := 0; i < int(frame.Length) && !frame.Remote; i++ {
+		data[n+i].Set(uint32(frame.Data[i]))
+	}
+
+	if can.Bus.MODE.Get()&twaiMODE_SELF_TEST != 0 {
+		// Send the frame without requiring an acknowledgement, and receive it.
+		can.Bus.CMD.Set(twaiCMD_SELF_RX_REQ)
+	} else {
+		can.Bus.CMD.Set(twaiCMD_TX_REQ)
+	}
+	return nil
+}
+
+// Receive blocks until a frame is received and copies it to frame.
+func (can *CAN) Receive(frame *CANFrame) error {
+	for {
+		for can.Bus.STATUS.Get()&twaiSTATUS_RX_BUF == 0 {
+			// The Rx interrupt stays pending while the FIFO isn't empty, so
+			// canHandleInterrupt disables it again.
+			can.Bus.INT_ENA.SetBits(twaiINT_RX)
+			canWait.rx.Wait()
+		}
+		if can.Bus.STATUS.Get()&twaiSTATUS_OVERRUN != 0 {
+			can.Bus.CMD.Set(twaiCMD_CLR_OVERRUN)
+		}
+
+		data := can.data()
+		info := data[0].Get()
+		frame.Extended = info&twaiFrameFF != 0
+		frame.Remote = info&twaiFrameRTR != 0
+		frame.FD = false
+		frame.BitRateSwitch = false
+		frame.Length = CANDlcToLength(byte(info&0xf), false)
+		n := 3
+		if frame.Extended {
+			frame.ID = (data[1].Get()<<24 | data[2].Get()<<16 | data[3].Get()<<8 | data[4].Get()) >> 3
+			n = 5
+		} else {
+			frame.ID = (data[1].Get()<<8 | data[2].Get()) >> 5
+		}
+		for i := 0; i < int(frame.Length) && !frame.Remote; i++ {
+			frame.Data[i] = byte(data[n+i].Get())
+		}
+		can.Bus.CMD.Set(twaiCMD_RELEASE_BUF)
+
+		if can.accepts(frame) {
+			return nil
+		}
+	}
+}
+
+// canHandleInterrupt wakes up the goroutines blocked in Transmit and Receive.
+func canHandleInterrupt(bus *esp.TWAI_Type) {
+	status := bus.INT_RAW.Get() // reading clears all but the Rx interrupt
+	if status&twaiINT_RX != 0 {
+		bus.INT_ENA.ClearBits(twaiINT_RX)
+		canWait.rx.Notify()
+	}
+	if status&(twaiINT_TX|twaiINT_ERR_WARN) != 0 {
+		canWait.tx.Notify()
+	}
+}
+
+// accepts returns whether the frame matches the filters set with SetFilters.
+func (can *CAN) accepts(frame *CANFrame) bool {
+	if twaiFilterCount == 0 {
+		return true
+	}
+	for _, f := range twaiFilters[:twaiFilterCount] {
+		if f.matches(frame) {
+			return true
+		}
+	}
+	return false
+}
+
+// Available returns the number of frames in the receive FIFO. Frames that
+// don't match the filters are only dropped by Receive, so fewer frames may be
+// returned when multiple filters are set.
+func (can *CAN) Available() int {
+	return int(can.Bus.RX_MESSAGE_CNT.Get() & 0x7f)
+}
+
+// ErrorCounters returns the current error counters and bus state.
+func (can *CAN) ErrorCounters() CANErrorCounters {
+	tec := can.Bus.TX_ERR_CNT.Get() & 0xff
+	rec := can.Bus.RX_ERR_CNT.Get() & 0xff
+	return CANErrorCounters{
+		State:    canErrorState(can.Bus.STATUS.HasBits(twaiSTATUS_BUS_OFF), tec, rec),
+		TxErrors: uint8(tec),
+		RxErrors: uint8(rec),
+	}
+}
+
+// Recover starts bus-off recovery. The controller reconnects after it has
+// seen 128 occurrences of 11 recessive bits on the bus.
+func (can *CAN) Recover() error {
+	if can.Bus.STATUS.HasBits(twaiSTATUS_BUS_OFF) {
+		// The controller enters reset mode when it goes bus-off. Leaving
+		// reset mode starts the recovery sequence.
+		can.Bus.MODE.ClearBits(twaiMODE_RESET)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+//go:build esp32c3
+
+package machine
+
+import "device/esp"
+
+// Watchdog provides access to the main system watchdog timer (MWDT) of timer
+// group 0.
+var Watchdog = &watchdogImpl{}
+
+const (
+	// WatchdogMaxTimeout is the maximum timeout in milliseconds (about 24
+	// days): the watchdog counts 32 bits at 2kHz.
+	WatchdogMaxTimeout = 0xffffffff / 2
+
+	// Divide the 80MHz APB clock down to 2kHz.
+	watchdogPrescaler = 40000
+
+	// Key that must be written to WDTWPROTECT to unlock the watchdog
+	// registers.
+	watchdogWriteKey = 0x50D83AA1
+
+	// Stage action that resets the whole system.
+	watchdogActionResetSystem = 3
+)
+
+// Reset causes in RTC_RESET_STATE.
+const (
+	espResetPowerOn     = 0x01 // power-on or reset pin
+	espResetSoftware    = 0x03 // software system reset
+	espResetDeepSleep   = 0x05 // deep sleep wakeup
+	espResetTG0WDT      = 0x07 // timer group 0 watchdog system reset
+	espResetTG1WDT      = 0x08 // timer group 1 watchdog system reset
+	espResetRTCWDT      = 0x09 // RTC watchdog system reset
+	espResetTG0WDTCPU   = 0x0c // timer group 0 watchdog CPU reset
+	espResetSoftCPU     = 0x0d // software CPU reset
+	espResetRTCWDTCPU   = 0x0e // RTC watchdog CPU reset
+	espResetBrownout    = 0x0f // brownout
+	espResetRTCWDTRTC   = 0x10 // RTC watchdog core and RTC reset
+	espResetTG1WDTCPU   = 0x11 // timer group 1 watchdog CPU reset
+	espResetSuperWDT    = 0x12 // super watchdog reset
+	espResetPowerGlitch = 0x17 // power glitch
+)
+
+type watchdogImpl struct {
+	config WatchdogConfig
+	hold   uint32 // timeout in watchdog ticks
+}
+
+// Configure the watchdog.
+func (wd *watchdogImpl) Configure(config WatchdogConfig) error {
+	wd.config = config
+	timeout := config.TimeoutMillis
+	if timeout > WatchdogMaxTimeout {
+		timeout = WatchdogMaxTimeout
+	}
+	wd.hold = timeout * 2
+	return nil
+}
+
+// Start the watchdog. The runtime disables it on startup, so that it doesn't
+// reset the chip unless it is explicitly started.
+func (wd *watchdogImpl) Start() error {
+	esp.TIMG0.WDTWPROTECT.Set(watchdogWriteKey)
+	esp.TIMG0.WDTCONFIG0.Set(0)
+	esp.TIMG0.WDTCONFIG1.Set(watchdogPrescaler << esp.TIMG_WDTCONFIG1_WDT_CLK_PRESCALE_Pos)
+	esp.TIMG0.WDTCONFIG2.Set(wd.hold)
+	esp.TIMG0.WDTFEED.Set(1)
+	esp.TIMG0.WDTCONFIG0.Set(esp.TIMG_WDTCONFIG0_WDT_EN |
+		watchdogActionResetSystem<<esp.TIMG_WDTCONFIG0_WDT_STG0_Pos)
+	// The new configuration is only used after it is explicitly updated.
+	esp.TIMG0.WDTCONFIG0.SetBits(esp.TIMG_WDTCONFIG0_WDT_CONF_UPDATE_EN)
+	esp.TIMG0.WDTWPROTECT.Set(0)
+
+	startWatchdogIdleHook(wd.config)
+	return nil
+}
+
+// Update the watchdog, indicating that the program is healthy.
+func (wd *watchdogImpl) Update() {
+	esp.TIMG0.WDTWPROTECT.Set(watchdogWriteKey)
+	esp.TIMG0.WDTFEED.Set(1)
+	esp.TIMG0.WDTWPROTECT.Set(0)
+}
+
+// ResetCause returns why the chip was last reset.
+func (wd *watchdogImpl) ResetCause() ResetCause {
+	cause := esp.RTC_CNTL.RTC_RESET_STATE.Get() & esp.RTC_CNTL_RTC_RESET_STATE_RESET_CAUSE_PROCPU_Msk
+	switch cause {
+	case espResetPowerOn:
+		return ResetCausePowerOn
+	case espResetSoftware, espResetSoftCPU:
+		return ResetCauseSoftware
+	case espResetDeepSleep:
+		return ResetCauseWakeup
+	case espResetTG0WDT, espResetTG1WDT, espResetRTCWDT, espResetTG0WDTCPU,
+		espResetRTCWDTCPU, espResetRTCWDTRTC, espResetTG1WDTCPU, espResetSuperWDT:
+		return ResetCauseWatchdog
+	case espResetBrownout, espResetPowerGlitch:
+		return ResetCauseBrownout
+	}
+	return ResetCauseUnknown
+}
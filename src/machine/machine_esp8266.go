@@ -170,11 +170,13 @@ var _UART0 = UART{Buffer: NewRingBuffer()}
 
 type UART struct {
 	Buffer *RingBuffer
+	uartState
 }
 
 // Configure the UART baud rate. TX and RX pins are fixed by the hardware so
 // cannot be modified and will be ignored.
 func (uart *UART) Configure(config UARTConfig) {
+	uart.configureBuffers(config, false)
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
 	}
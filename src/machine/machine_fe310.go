@@ -72,6 +72,7 @@ func (p Pin) PortMaskClear() (*uint32, uint32) {
 type UART struct {
 	Bus    *sifive.UART_Type
 	Buffer *RingBuffer
+	uartState
 }
 
 var (
@@ -80,6 +81,7 @@ var (
 )
 
 func (uart *UART) Configure(config UARTConfig) {
+	uart.configureBuffers(config, false)
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
 	}
@@ -90,8 +90,20 @@ func (adc ADC) Get() uint16 {
 func adcRead(pin Pin) uint16
 
 // I2C is a generic implementation of the Inter-IC communication protocol.
+//
+// Transfers to an address on which another I2C instance is listening in
+// target mode are handled in the program itself, as if both were connected to
+// the same bus. This makes it possible to test I2C target code on the host.
+// All other transfers are passed to the simulator.
 type I2C struct {
 	Bus uint8
+
+	mode    I2CMode
+	address uint16
+	events  chan i2cSimEvent // events sent by the controller
+	replies chan []byte      // data sent by Reply
+	done    chan struct{}    // the controller has copied the reply
+	request bool             // a request event is waiting for a reply
 }
 
 // I2CConfig is used to store config info for I2C.
@@ -99,27 +111,239 @@ type I2CConfig struct {
 	Frequency uint32
 	SCL       Pin
 	SDA       Pin
+	Mode      I2CMode
+}
+
+// i2cSimEvent is an event on the simulated I2C bus.
+type i2cSimEvent struct {
+	evt  I2CTargetEvent
+	data []byte
 }
 
+// I2C instances listening in target mode on the simulated bus.
+var i2cSimTargets []*I2C
+
 // Configure is intended to setup the I2C interface.
 func (i2c *I2C) Configure(config I2CConfig) error {
-	i2cConfigure(i2c.Bus, config.SCL, config.SDA)
+	i2c.mode = config.Mode
+	if i2c.mode == I2CModeController {
+		i2cConfigure(i2c.Bus, config.SCL, config.SDA)
+	}
 	return nil
 }
 
 // Tx does a single I2C transaction at the specified address.
 func (i2c *I2C) Tx(addr uint16, w, r []byte) error {
-	i2cTransfer(i2c.Bus, &w[0], len(w), &r[0], len(r))
+	if i2c.mode != I2CModeController {
+		return ErrI2CWrongMode
+	}
+	for _, target := range i2cSimTargets {
+		if target.address == addr {
+			target.simTransfer(w, r)
+			return nil
+		}
+	}
+
+	var wptr, rptr *byte
+	if len(w) != 0 {
+		wptr = &w[0]
+	}
+	if len(r) != 0 {
+		rptr = &r[0]
+	}
+	i2cTransfer(i2c.Bus, wptr, len(w), rptr, len(r))
 	// TODO: do something with the returned error code.
 	return nil
 }
 
+// simTransfer passes a transfer from a controller to this target on the
+// simulated bus. It blocks until the target has handled it.
+func (i2c *I2C) simTransfer(w, r []byte) {
+	if len(w) != 0 {
+		i2c.events <- i2cSimEvent{evt: I2CReceive, data: w}
+	}
+	if len(r) != 0 {
+		i2c.events <- i2cSimEvent{evt: I2CRequest}
+		reply := <-i2c.replies
+		n := copy(r, reply)
+		for i := n; i < len(r); i++ {
+			r[i] = 0xff // no device driving the bus
+		}
+		i2c.done <- struct{}{}
+	}
+	i2c.events <- i2cSimEvent{evt: I2CFinish}
+}
+
+// Listen starts listening for I2C requests sent to the specified address, on
+// the simulated bus.
+func (i2c *I2C) Listen(addr uint16) error {
+	if i2c.mode != I2CModeTarget {
+		return ErrI2CWrongMode
+	}
+	if addr >= 0x80 || isReservedI2CAddr(uint8(addr)) {
+		return ErrInvalidTgtAddr
+	}
+	if i2c.events == nil {
+		i2c.events = make(chan i2cSimEvent)
+		i2c.replies = make(chan []byte)
+		i2c.done = make(chan struct{})
+		i2cSimTargets = append(i2cSimTargets, i2c)
+	}
+	i2c.address = addr
+	return nil
+}
+
+// WaitForEvent blocks the current goroutine until an I2C event is received
+// (when in target mode).
+//
+// The passed buffer will be populated for receive events, with the number of
+// bytes received returned in count. Bytes that don't fit in the buffer are
+// dropped. For other event types, buf is not modified and a count of zero is
+// returned.
+//
+// For request events, the caller MUST call Reply to avoid hanging the I2C bus
+// indefinitely.
+func (i2c *I2C) WaitForEvent(buf []byte) (evt I2CTargetEvent, count int, err error) {
+	if i2c.events == nil {
+		return I2CFinish, 0, ErrI2CWrongMode
+	}
+	e := <-i2c.events
+	if e.evt == I2CRequest {
+		i2c.request = true
+	}
+	return e.evt, copy(buf, e.data), nil
+}
+
+// Reply supplies the response data to the controller, after WaitForEvent
+// returned a request event. If the controller reads more bytes than are in
+// buf, it receives 0xff for the remaining bytes.
+func (i2c *I2C) Reply(buf []byte) error {
+	if !i2c.request {
+		return ErrI2CWrongMode
+	}
+	i2c.request = false
+	i2c.replies <- buf
+	<-i2c.done
+	return nil
+}
+
 //export __tinygo_i2c_configure
 func i2cConfigure(bus uint8, scl Pin, sda Pin)
 
 //export __tinygo_i2c_transfer
 func i2cTransfer(bus uint8, w *byte, wlen int, r *byte, rlen int) int
 
+// CAN is a simulated CAN controller. All CAN instances in the program are
+// connected to the same simulated bus, which makes it possible to test CAN
+// code on the host.
+type CAN struct {
+	Bus uint8
+}
+
+// canSimState is the state of a simulated CAN controller. It is kept outside
+// of the CAN struct so that copies of a CAN value refer to the same controller,
+// like they do on real hardware.
+type canSimState struct {
+	mode     CANMode
+	filters  []CANFilter
+	received []CANFrame
+}
+
+// Simulated CAN controllers connected to the bus, by bus number.
+var canSimBus = map[uint8]*canSimState{}
+
+// state returns the state of the simulated controller. The controller is
+// connected to the bus when it is first used.
+func (can *CAN) state() *canSimState {
+	state := canSimBus[can.Bus]
+	if state == nil {
+		state = &canSimState{}
+		canSimBus[can.Bus] = state
+	}
+	return state
+}
+
+// Configure this CAN peripheral with the given configuration. Like on real
+// hardware, this removes all filters.
+func (can *CAN) Configure(config CANConfig) error {
+	state := can.state()
+	state.mode = config.Mode
+	state.filters = nil
+	return nil
+}
+
+// SetFilters replaces the set of receive filters. A frame is received when it
+// matches any of the filters. All frames are received when no filters are
+// set, which is the default.
+func (can *CAN) SetFilters(filters []CANFilter) error {
+	state := can.state()
+	state.filters = append(state.filters[:0], filters...)
+	return nil
+}
+
+// Transmit sends a frame to all other CAN instances on the simulated bus. In
+// loopback mode, the frame is only received by this instance. In listen-only
+// mode, the frame is dropped.
+func (can *CAN) Transmit(frame *CANFrame) error {
+	state := can.state()
+	if err := frame.check(true); err != nil {
+		return err
+	}
+	switch state.mode {
+	case CANModeLoopback:
+		state.deliver(frame)
+	case CANModeNormal:
+		for bus, other := range canSimBus {
+			if bus != can.Bus && other.mode != CANModeLoopback {
+				other.deliver(frame)
+			}
+		}
+	}
+	return nil
+}
+
+// deliver adds the frame to the receive queue, if it matches the filters.
+func (state *canSimState) deliver(frame *CANFrame) {
+	if len(state.filters) != 0 {
+		accepted := false
+		for _, f := range state.filters {
+			accepted = accepted || f.matches(frame)
+		}
+		if !accepted {
+			return
+		}
+	}
+	state.received = append(state.received, *frame)
+}
+
+// Receive blocks until a frame is received and copies it to frame.
+func (can *CAN) Receive(frame *CANFrame) error {
+	state := can.state()
+	for len(state.received) == 0 {
+		gosched()
+	}
+	*frame = state.received[0]
+	state.received = state.received[1:]
+	return nil
+}
+
+// Available returns the number of frames that can be received without
+// blocking.
+func (can *CAN) Available() int {
+	return len(can.state().received)
+}
+
+// ErrorCounters returns the error counters, which are always zero on the
+// simulated bus.
+func (can *CAN) ErrorCounters() CANErrorCounters {
+	return CANErrorCounters{}
+}
+
+// Recover does nothing, as the simulated bus never goes bus-off.
+func (can *CAN) Recover() error {
+	return nil
+}
+
 type UART struct {
 	Bus uint8
 }
@@ -176,14 +400,14 @@ var (
 	sercomUSART4 = UART{4}
 	sercomUSART5 = UART{5}
 
-	sercomI2CM0 = &I2C{0}
-	sercomI2CM1 = &I2C{1}
-	sercomI2CM2 = &I2C{2}
-	sercomI2CM3 = &I2C{3}
-	sercomI2CM4 = &I2C{4}
-	sercomI2CM5 = &I2C{5}
-	sercomI2CM6 = &I2C{6}
-	sercomI2CM7 = &I2C{7}
+	sercomI2CM0 = &I2C{Bus: 0}
+	sercomI2CM1 = &I2C{Bus: 1}
+	sercomI2CM2 = &I2C{Bus: 2}
+	sercomI2CM3 = &I2C{Bus: 3}
+	sercomI2CM4 = &I2C{Bus: 4}
+	sercomI2CM5 = &I2C{Bus: 5}
+	sercomI2CM6 = &I2C{Bus: 6}
+	sercomI2CM7 = &I2C{Bus: 7}
 
 	sercomSPIM0 = SPI{0}
 	sercomSPIM1 = SPI{1}
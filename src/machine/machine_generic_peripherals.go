@@ -7,5 +7,7 @@ package machine
 
 var (
 	SPI0 = SPI{0}
-	I2C0 = &I2C{0}
+	I2C0 = &I2C{Bus: 0}
+	CAN0 = CAN{Bus: 0}
+	CAN1 = CAN{Bus: 1}
 )
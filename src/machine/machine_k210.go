@@ -343,6 +343,7 @@ func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
 type UART struct {
 	Bus    *kendryte.UARTHS_Type
 	Buffer *RingBuffer
+	uartState
 }
 
 var (
@@ -351,6 +352,7 @@ var (
 )
 
 func (uart *UART) Configure(config UARTConfig) {
+	uart.configureBuffers(config, false)
 
 	// Use default baudrate  if not set.
 	if config.BaudRate == 0 {
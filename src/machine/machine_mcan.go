@@ -0,0 +1,109 @@
+//go:build (sam && atsame51) || (sam && atsame54) || stm32l5
+
+package machine
+
+// Helpers for the Bosch M_CAN controller, which is used for CAN FD on the
+// SAM E5x (CAN) and on the STM32L5 (FDCAN). Both share the same message RAM
+// element layout.
+
+import "runtime/volatile"
+
+// mcanElement is a Rx FIFO or Tx buffer element in the message RAM, with room
+// for 64 data bytes.
+type mcanElement [2 + 16]volatile.Register32
+
+// Bits in the first two words of a buffer element.
+const (
+	mcanElementXTD = 1 << 30
+	mcanElementRTR = 1 << 29
+	mcanElementFDF = 1 << 21
+	mcanElementBRS = 1 << 20
+
+	mcanElementDLC_Pos = 16
+)
+
+// Values for standard and extended filter elements.
+const (
+	mcanFilterClassic = 2 << 30 // SFT/EFT: classic filter (ID and mask)
+	mcanFilterFIFO0   = 1       // SFEC/EFEC: store in Rx FIFO 0
+
+	mcanStdFilterSFEC_Pos = 27
+	mcanStdFilterSFID_Pos = 16
+	mcanExtFilterEFEC_Pos = 29
+)
+
+// write stores a frame in a Tx buffer element.
+func (e *mcanElement) write(f *CANFrame) {
+	t0 := f.ID
+	if f.Extended {
+		t0 |= mcanElementXTD
+	} else {
+		// standard identifier is stored into ID[28:18]
+		t0 <<= 18
+	}
+	if f.Remote {
+		t0 |= mcanElementRTR
+	}
+	dlc := CANLengthToDlc(f.Length, f.FD)
+	t1 := uint32(dlc) << mcanElementDLC_Pos
+	if f.FD {
+		t1 |= mcanElementFDF
+	}
+	if f.BitRateSwitch {
+		t1 |= mcanElementBRS
+	}
+	e[0].Set(t0)
+	e[1].Set(t1)
+
+	if f.Remote {
+		return
+	}
+	// The message RAM must be written with 32-bit accesses. Pad the data with
+	// zeroes up to the length encoded in the DLC.
+	length := int(CANDlcToLength(dlc, f.FD))
+	for i := 0; i < length; i += 4 {
+		var word uint32
+		for j := 0; j < 4 && i+j < int(f.Length); j++ {
+			word |= uint32(f.Data[i+j]) << (8 * j)
+		}
+		e[2+i/4].Set(word)
+	}
+}
+
+// read copies the frame stored in a Rx FIFO element.
+func (e *mcanElement) read(f *CANFrame) {
+	r0 := e[0].Get()
+	r1 := e[1].Get()
+	f.Extended = r0&mcanElementXTD != 0
+	f.Remote = r0&mcanElementRTR != 0
+	f.ID = r0 & 0x1fffffff
+	if !f.Extended {
+		f.ID >>= 18
+	}
+	f.FD = r1&mcanElementFDF != 0
+	f.BitRateSwitch = r1&mcanElementBRS != 0
+	f.Length = CANDlcToLength(byte(r1>>mcanElementDLC_Pos)&0xf, f.FD)
+	if f.Remote {
+		return
+	}
+	for i := 0; i < int(f.Length); i += 4 {
+		word := e[2+i/4].Get()
+		for j := 0; j < 4 && i+j < int(f.Length); j++ {
+			f.Data[i+j] = byte(word >> (8 * j))
+		}
+	}
+}
+
+// mcanStdFilter returns a standard filter element that stores matching frames
+// in Rx FIFO 0.
+func mcanStdFilter(f CANFilter) uint32 {
+	return mcanFilterClassic | mcanFilterFIFO0<<mcanStdFilterSFEC_Pos |
+		(f.ID&0x7ff)<<mcanStdFilterSFID_Pos | f.Mask&0x7ff
+}
+
+// mcanExtFilter returns the two words of an extended filter element that
+// stores matching frames in Rx FIFO 0.
+func mcanExtFilter(f CANFilter) (f0, f1 uint32) {
+	return mcanFilterFIFO0<<mcanExtFilterEFEC_Pos | f.ID&0x1fffffff,
+		mcanFilterClassic | f.Mask&0x1fffffff
+}
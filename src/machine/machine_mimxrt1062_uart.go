@@ -34,6 +34,8 @@ type UART struct {
 	// auxiliary state data used internally
 	configured   bool
 	transmitting volatile.Register32
+
+	uartState
 }
 
 func (uart *UART) isTransmitting() bool { return uart.transmitting.Get() != 0 }
@@ -77,6 +79,11 @@ func (uart *UART) Configure(config UARTConfig) {
 	// reset all internal logic and registers
 	uart.resetTransmitting()
 
+	uart.configureBuffers(config, false)
+	if config.TXBufferSize != 0 && uart.txBuffer.Size() != ringBufferSize(config.TXBufferSize) {
+		uart.txBuffer = NewRingBufferSize(config.TXBufferSize)
+	}
+
 	// disable until we have finished configuring registers
 	uart.Bus.CTRL.Set(0)
 
@@ -261,6 +268,7 @@ func (uart *UART) handleInterrupt(interrupt.Interrupt) {
 
 	// check for and clear overrun, otherwise RX will not work
 	if (stat & uint32(nxp.LPUART_STAT_OR)) != 0 {
+		uart.receiveError(ErrUARTOverrun)
 		uart.Bus.STAT.Set((uart.Bus.STAT.Get() & uint32(0x3FE00000)) | nxp.LPUART_STAT_OR)
 	}
 
@@ -272,6 +280,7 @@ func (uart *UART) handleInterrupt(interrupt.Interrupt) {
 			// TODO: 7, 9, and 10-bit support?
 			uart.Buffer.Put(uint8(uart.Bus.DATA.Get() & uint32(0xFF)))
 		}
+		uart.rxReady.Notify()
 		// if it was an IDLE status, clear the flag
 		if (stat & uint32(nxp.LPUART_STAT_IDLE)) != 0 {
 			uart.Bus.STAT.SetBits(nxp.LPUART_STAT_IDLE)
@@ -7,6 +7,7 @@ import (
 	"device/nrf"
 	"encoding/binary"
 	"runtime/interrupt"
+	"runtime/volatile"
 	"unsafe"
 )
 
@@ -133,8 +134,19 @@ func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
 // UART on the NRF.
 type UART struct {
 	Buffer *RingBuffer
+	uartState
+
+	txStarted volatile.Register8 // a byte has been written since STARTTX
 }
 
+// Bits in the ERRORSRC register.
+const (
+	uartERRORSRC_OVERRUN = 1 << 0
+	uartERRORSRC_PARITY  = 1 << 1
+	uartERRORSRC_FRAMING = 1 << 2
+	uartERRORSRC_BREAK   = 1 << 3
+)
+
 // UART
 var (
 	// UART0 is the hardware UART on the NRF SoC.
@@ -144,6 +156,8 @@ var (
 
 // Configure the UART.
 func (uart *UART) Configure(config UARTConfig) {
+	uart.configureBuffers(config, true)
+
 	// Default baud rate to 115200.
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
@@ -162,7 +176,8 @@ func (uart *UART) Configure(config UARTConfig) {
 	nrf.UART0.ENABLE.Set(nrf.UART_ENABLE_ENABLE_Enabled)
 	nrf.UART0.TASKS_STARTTX.Set(1)
 	nrf.UART0.TASKS_STARTRX.Set(1)
-	nrf.UART0.INTENSET.Set(nrf.UART_INTENSET_RXDRDY_Msk)
+	uart.txStarted.Set(0)
+	nrf.UART0.INTENSET.Set(nrf.UART_INTENSET_RXDRDY_Msk | nrf.UART_INTENSET_ERROR_Msk)
 
 	// Enable RX IRQ.
 	intr := interrupt.New(nrf.IRQ_UART0, _UART0.handleInterrupt)
@@ -187,18 +202,62 @@ func (uart *UART) SetBaudRate(br uint32) {
 
 // WriteByte writes a byte of data to the UART.
 func (uart *UART) WriteByte(c byte) error {
-	nrf.UART0.EVENTS_TXDRDY.Set(0)
-	nrf.UART0.TXD.Set(uint32(c))
+	if uart.txRing != nil {
+		uart.writeBuffered(c)
+		return nil
+	}
+	for !uart.txReady() {
+	}
+	uart.txWrite(c)
 	for nrf.UART0.EVENTS_TXDRDY.Get() == 0 {
 	}
 	return nil
 }
 
 func (uart *UART) handleInterrupt(interrupt.Interrupt) {
+	if nrf.UART0.EVENTS_ERROR.Get() != 0 {
+		nrf.UART0.EVENTS_ERROR.Set(0x0)
+		src := nrf.UART0.ERRORSRC.Get()
+		nrf.UART0.ERRORSRC.Set(src) // write 1 to clear
+		var errs UARTError
+		if src&uartERRORSRC_OVERRUN != 0 {
+			errs |= ErrUARTOverrun
+		}
+		if src&(uartERRORSRC_FRAMING|uartERRORSRC_BREAK) != 0 {
+			errs |= ErrUARTFraming
+		}
+		if src&uartERRORSRC_PARITY != 0 {
+			errs |= ErrUARTParity
+		}
+		uart.receiveError(errs)
+	}
 	if nrf.UART0.EVENTS_RXDRDY.Get() != 0 {
 		uart.Receive(byte(nrf.UART0.RXD.Get()))
 		nrf.UART0.EVENTS_RXDRDY.Set(0x0)
 	}
+	if nrf.UART0.INTENSET.HasBits(nrf.UART_INTENSET_TXDRDY_Msk) && nrf.UART0.EVENTS_TXDRDY.Get() != 0 {
+		uart.handleTXInterrupt()
+	}
+}
+
+// txReady returns whether the previous byte has been sent. TXDRDY is only
+// generated after a byte was sent, so it isn't set for the first byte.
+func (uart *UART) txReady() bool {
+	return uart.txStarted.Get() == 0 || nrf.UART0.EVENTS_TXDRDY.Get() != 0
+}
+
+func (uart *UART) txWrite(c byte) {
+	nrf.UART0.EVENTS_TXDRDY.Set(0)
+	nrf.UART0.TXD.Set(uint32(c))
+	uart.txStarted.Set(1)
+}
+
+func (uart *UART) setTXInterrupt(enable bool) {
+	if enable {
+		nrf.UART0.INTENSET.Set(nrf.UART_INTENSET_TXDRDY_Msk)
+	} else {
+		nrf.UART0.INTENCLR.Set(nrf.UART_INTENCLR_TXDRDY_Msk)
+	}
 }
 
 // I2CConfig is used to store config info for I2C.
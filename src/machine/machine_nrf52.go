@@ -64,6 +64,9 @@ var (
 	PWM2 = &PWM{PWM: nrf.PWM2}
 )
 
+// The SPIM EasyDMA MAXCNT registers are 8 bits wide on the nRF52832.
+const spiMaxCount = 255
+
 const eraseBlockSizeValue = 4096
 
 func eraseBlockSize() int64 {
@@ -85,6 +85,9 @@ var (
 	PWM3 = &PWM{PWM: nrf.PWM3}
 )
 
+// The SPIM EasyDMA MAXCNT registers are 16 bits wide on the nRF52833.
+const spiMaxCount = 0xffff
+
 const eraseBlockSizeValue = 4096
 
 func eraseBlockSize() int64 {
@@ -103,6 +103,9 @@ func (pdm *PDM) Read(buf []int16) (uint32, error) {
 	return uint32(len(buf)), nil
 }
 
+// The SPIM EasyDMA MAXCNT registers are 16 bits wide on the nRF52840.
+const spiMaxCount = 0xffff
+
 const eraseBlockSizeValue = 4096
 
 func eraseBlockSize() int64 {
@@ -152,10 +152,8 @@ func handleUSBIRQ(interrupt.Interrupt) {
 			// Standard Requests
 			ok = handleStandardSetup(setup)
 		} else {
-			// Class Interface Requests
-			if setup.WIndex < uint16(len(usbSetupHandler)) && usbSetupHandler[setup.WIndex] != nil {
-				ok = usbSetupHandler[setup.WIndex](setup)
-			}
+			// Class and Vendor Requests
+			ok = handleClassSetup(setup)
 		}
 
 		if !ok {
@@ -196,7 +194,9 @@ func handleUSBIRQ(interrupt.Interrupt) {
 			if usbRxHandler[i] != nil {
 				usbRxHandler[i](buf)
 			}
-			handleEndpointRxComplete(uint32(i))
+			if !usbRxPaused[i] {
+				handleEndpointRxComplete(uint32(i))
+			}
 			exitCriticalSection()
 		}
 	}
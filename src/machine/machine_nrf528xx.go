@@ -7,7 +7,8 @@ import (
 	"unsafe"
 )
 
-// I2C on the NRF528xx.
+// I2C on the NRF528xx, using TWIM for controller mode and TWIS for target
+// mode.
 type I2C struct {
 	Bus  *nrf.TWIM_Type // Called Bus to align with Bus field in nrf51
 	BusT *nrf.TWIS_Type
@@ -95,7 +96,13 @@ func (i2c *I2C) Tx(addr uint16, w, r []byte) (err error) {
 // Listen starts listening for I2C requests sent to specified address
 //
 // addr is the address to listen to
-func (i2c *I2C) Listen(addr uint8) error {
+func (i2c *I2C) Listen(addr uint16) error {
+	if i2c.mode != I2CModeTarget {
+		return ErrI2CWrongMode
+	}
+	if addr >= 0x80 || isReservedI2CAddr(uint8(addr)) {
+		return ErrInvalidTgtAddr
+	}
 	i2c.BusT.ADDRESS[0].Set(uint32(addr))
 	i2c.BusT.CONFIG.Set(nrf.TWIS_CONFIG_ADDRESS0_Enabled)
 
@@ -4,6 +4,7 @@ package machine
 
 import (
 	"device/nrf"
+	"runtime/interrupt"
 	"runtime/volatile"
 	"unsafe"
 )
@@ -175,15 +176,25 @@ func (a ADC) Get() uint16 {
 
 // SPI on the NRF.
 type SPI struct {
-	Bus *nrf.SPIM_Type
-	buf *[1]byte // 1-byte buffer for the Transfer method
+	Bus   *nrf.SPIM_Type
+	buf   *[1]byte  // 1-byte buffer for the Transfer method
+	async *spiAsync // transfer started by TxAsync
+}
+
+// spiAsync is the state of a transfer started by TxAsync. It is sent in parts
+// of at most spiMaxCount bytes, each started from the END interrupt of the
+// previous part.
+type spiAsync struct {
+	rest []byte // part of the buffer that hasn't been started yet
+	busy volatile.Register8
+	done cond // notified when the transfer has completed
 }
 
 // There are 3 SPI interfaces on the NRF528xx.
 var (
-	SPI0 = SPI{Bus: nrf.SPIM0, buf: new([1]byte)}
-	SPI1 = SPI{Bus: nrf.SPIM1, buf: new([1]byte)}
-	SPI2 = SPI{Bus: nrf.SPIM2, buf: new([1]byte)}
+	SPI0 = SPI{Bus: nrf.SPIM0, buf: new([1]byte), async: new(spiAsync)}
+	SPI1 = SPI{Bus: nrf.SPIM1, buf: new([1]byte), async: new(spiAsync)}
+	SPI2 = SPI{Bus: nrf.SPIM2, buf: new([1]byte), async: new(spiAsync)}
 )
 
 // SPIConfig is used to store config info for SPI.
@@ -281,18 +292,18 @@ func (spi SPI) Transfer(w byte) (byte, error) {
 // padded until they fit: if len(w) > len(r) the extra bytes received will be
 // dropped and if len(w) < len(r) extra 0 bytes will be sent.
 func (spi SPI) Tx(w, r []byte) error {
-	// Unfortunately the hardware (on the nrf52832) only supports up to 255
-	// bytes in the buffers, so if either w or r is longer than that the
-	// transfer needs to be broken up in pieces.
-	// The nrf52840 supports far larger buffers however, which isn't yet
-	// supported.
+	spi.WaitAsync()
+
+	// Unfortunately the hardware only supports up to spiMaxCount bytes in the
+	// buffers (255 on the nrf52832), so if either w or r is longer than that
+	// the transfer needs to be broken up in pieces.
 	for len(r) != 0 || len(w) != 0 {
 		// Prepare the SPI transfer: set the DMA pointers and lengths.
 		if len(r) != 0 {
 			spi.Bus.RXD.PTR.Set(uint32(uintptr(unsafe.Pointer(&r[0]))))
 			n := uint32(len(r))
-			if n > 255 {
-				n = 255
+			if n > spiMaxCount {
+				n = spiMaxCount
 			}
 			spi.Bus.RXD.MAXCNT.Set(n)
 			r = r[n:]
@@ -300,8 +311,8 @@ func (spi SPI) Tx(w, r []byte) error {
 		if len(w) != 0 {
 			spi.Bus.TXD.PTR.Set(uint32(uintptr(unsafe.Pointer(&w[0]))))
 			n := uint32(len(w))
-			if n > 255 {
-				n = 255
+			if n > spiMaxCount {
+				n = spiMaxCount
 			}
 			spi.Bus.TXD.MAXCNT.Set(n)
 			w = w[n:]
@@ -319,6 +330,83 @@ func (spi SPI) Tx(w, r []byte) error {
 	return nil
 }
 
+// TxAsync starts writing w using EasyDMA, ignoring Rx, and returns without
+// waiting for the transfer to complete. Buffers longer than the EasyDMA limit
+// (255 bytes on the nrf52832, 65535 bytes on the nrf52833 and nrf52840) are
+// sent in parts, which are started from the SPI interrupt. The buffer must not
+// be modified until WaitAsync returns. Other SPI methods wait for the transfer
+// to complete before they start.
+func (spi SPI) TxAsync(w []byte) error {
+	spi.WaitAsync()
+	if len(w) == 0 {
+		return nil
+	}
+	spi.enableInterrupt()
+	spi.Bus.RXD.MAXCNT.Set(0)
+	spi.Bus.EVENTS_END.Set(0)
+	spi.async.busy.Set(1)
+	spi.async.rest = spi.startTx(w)
+	spi.Bus.INTENSET.Set(nrf.SPIM_INTENSET_END)
+	return nil
+}
+
+// WaitAsync blocks until the transfer started by TxAsync has completed. Other
+// goroutines can run in the meantime: the goroutine is woken up by the SPI
+// interrupt.
+func (spi SPI) WaitAsync() {
+	for spi.async.busy.Get() != 0 {
+		spi.async.done.Wait()
+	}
+}
+
+// startTx starts sending the first part of w. It returns the rest of the
+// buffer.
+func (spi SPI) startTx(w []byte) []byte {
+	n := len(w)
+	if n > spiMaxCount {
+		n = spiMaxCount
+	}
+	spi.Bus.TXD.PTR.Set(uint32(uintptr(unsafe.Pointer(&w[0]))))
+	spi.Bus.TXD.MAXCNT.Set(uint32(n))
+	spi.Bus.TASKS_START.Set(1)
+	return w[n:]
+}
+
+// handleInterrupt starts the next part of the TxAsync buffer when a part has
+// been sent, or ends the transfer after the last part.
+func (spi SPI) handleInterrupt() {
+	if spi.Bus.EVENTS_END.Get() == 0 {
+		return
+	}
+	spi.Bus.EVENTS_END.Set(0)
+	if len(spi.async.rest) != 0 {
+		spi.async.rest = spi.startTx(spi.async.rest)
+		return
+	}
+	spi.Bus.INTENCLR.Set(nrf.SPIM_INTENCLR_END)
+	spi.async.busy.Set(0)
+	spi.async.done.Notify()
+}
+
+// enableInterrupt enables the interrupt used by TxAsync. SPIM0 and SPIM1 share
+// their interrupt with the TWI peripherals, which don't use it.
+func (spi SPI) enableInterrupt() {
+	switch spi.Bus {
+	case nrf.SPIM0:
+		interrupt.New(nrf.IRQ_SPIM0_SPIS0_TWIM0_TWIS0_SPI0_TWI0, func(interrupt.Interrupt) {
+			SPI0.handleInterrupt()
+		}).Enable()
+	case nrf.SPIM1:
+		interrupt.New(nrf.IRQ_SPIM1_SPIS1_TWIM1_TWIS1_SPI1_TWI1, func(interrupt.Interrupt) {
+			SPI1.handleInterrupt()
+		}).Enable()
+	case nrf.SPIM2:
+		interrupt.New(nrf.IRQ_SPIM2_SPIS2_SPI2, func(interrupt.Interrupt) {
+			SPI2.handleInterrupt()
+		}).Enable()
+	}
+}
+
 // PWM is one PWM peripheral, which consists of a counter and multiple output
 // channels (that can be connected to actual pins). You can set the frequency
 // using SetPeriod, but only for all the channels in this PWM peripheral at
@@ -0,0 +1,74 @@
+//go:build nrf52 || nrf52840 || nrf52833
+
+package machine
+
+import "device/nrf"
+
+// Watchdog provides access to the hardware watchdog of the nRF52.
+var Watchdog = &watchdogImpl{}
+
+const (
+	// WatchdogMaxTimeout is the maximum timeout in milliseconds (about 36
+	// hours): the counter has 32 bits and runs at 32.768kHz.
+	WatchdogMaxTimeout = 0xffffffff / 32768 * 1000
+)
+
+type watchdogImpl struct {
+	config WatchdogConfig
+}
+
+// Configure the watchdog. The configuration can't be changed anymore once the
+// watchdog is started.
+func (wd *watchdogImpl) Configure(config WatchdogConfig) error {
+	wd.config = config
+
+	crv := uint64(config.TimeoutMillis) * 32768 / 1000
+	if crv < 0xf {
+		crv = 0xf // minimum value
+	}
+	if crv > 0xffffffff {
+		crv = 0xffffffff
+	}
+	nrf.WDT.CRV.Set(uint32(crv))
+
+	// Use a single reload request register.
+	nrf.WDT.RREN.Set(nrf.WDT_RREN_RR0)
+
+	// Keep running while the CPU sleeps, but not while it is halted by a
+	// debugger.
+	nrf.WDT.CONFIG.Set(nrf.WDT_CONFIG_SLEEP_Run << nrf.WDT_CONFIG_SLEEP_Pos)
+	return nil
+}
+
+// Start the watchdog.
+func (wd *watchdogImpl) Start() error {
+	nrf.WDT.TASKS_START.Set(1)
+	startWatchdogIdleHook(wd.config)
+	return nil
+}
+
+// Update the watchdog, indicating that the program is healthy.
+func (wd *watchdogImpl) Update() {
+	// 0x6E524635 is the magic value to reload the watchdog.
+	nrf.WDT.RR[0].Set(0x6E524635)
+}
+
+// ResetCause returns why the chip was last reset. The reset reasons
+// accumulate until a power-on reset, so the most specific reason is returned.
+func (wd *watchdogImpl) ResetCause() ResetCause {
+	cause := nrf.POWER.RESETREAS.Get()
+	switch {
+	case cause&nrf.POWER_RESETREAS_DOG != 0:
+		return ResetCauseWatchdog
+	case cause&(nrf.POWER_RESETREAS_SREQ|nrf.POWER_RESETREAS_LOCKUP) != 0:
+		return ResetCauseSoftware
+	case cause&nrf.POWER_RESETREAS_OFF != 0:
+		return ResetCauseWakeup
+	case cause&nrf.POWER_RESETREAS_RESETPIN != 0:
+		return ResetCausePin
+	case cause == 0:
+		// No reset reason is recorded after a power-on or brownout reset.
+		return ResetCausePowerOn
+	}
+	return ResetCauseUnknown
+}
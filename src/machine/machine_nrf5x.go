@@ -4,7 +4,8 @@ package machine
 
 import "device/nrf"
 
-// I2C on the NRF51 and NRF52.
+// I2C on the NRF51 and NRF52. Target mode is not supported, it needs the TWIS
+// peripheral of the nRF52833 and nRF52840.
 type I2C struct {
 	Bus  *nrf.TWI_Type
 	mode I2CMode
@@ -91,11 +91,12 @@ type UART struct {
 	DefaultTX Pin
 
 	// state
-	Buffer       RingBuffer // RX Buffer
-	TXBuffer     RingBuffer
+	Buffer       *RingBuffer // RX Buffer
+	TXBuffer     *RingBuffer
 	Configured   bool
 	Transmitting volatile.Register8
 	Interrupt    interrupt.Interrupt
+	uartState
 }
 
 var (
@@ -104,11 +105,11 @@ var (
 	UART2  = &_UART2
 	UART3  = &_UART3
 	UART4  = &_UART4
-	_UART0 = UART{UART_Type: nxp.UART0, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART0, DefaultRX: defaultUART0RX, DefaultTX: defaultUART0TX}
-	_UART1 = UART{UART_Type: nxp.UART1, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART1, DefaultRX: defaultUART1RX, DefaultTX: defaultUART1TX}
-	_UART2 = UART{UART_Type: nxp.UART2, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART2, DefaultRX: defaultUART2RX, DefaultTX: defaultUART2TX}
-	_UART3 = UART{UART_Type: nxp.UART3, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART3, DefaultRX: defaultUART3RX, DefaultTX: defaultUART3TX}
-	_UART4 = UART{UART_Type: nxp.UART4, SCGC: &nxp.SIM.SCGC1, SCGCMask: nxp.SIM_SCGC1_UART4, DefaultRX: defaultUART4RX, DefaultTX: defaultUART4TX}
+	_UART0 = UART{UART_Type: nxp.UART0, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART0, DefaultRX: defaultUART0RX, DefaultTX: defaultUART0TX, Buffer: NewRingBuffer(), TXBuffer: NewRingBuffer()}
+	_UART1 = UART{UART_Type: nxp.UART1, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART1, DefaultRX: defaultUART1RX, DefaultTX: defaultUART1TX, Buffer: NewRingBuffer(), TXBuffer: NewRingBuffer()}
+	_UART2 = UART{UART_Type: nxp.UART2, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART2, DefaultRX: defaultUART2RX, DefaultTX: defaultUART2TX, Buffer: NewRingBuffer(), TXBuffer: NewRingBuffer()}
+	_UART3 = UART{UART_Type: nxp.UART3, SCGC: &nxp.SIM.SCGC4, SCGCMask: nxp.SIM_SCGC4_UART3, DefaultRX: defaultUART3RX, DefaultTX: defaultUART3TX, Buffer: NewRingBuffer(), TXBuffer: NewRingBuffer()}
+	_UART4 = UART{UART_Type: nxp.UART4, SCGC: &nxp.SIM.SCGC1, SCGCMask: nxp.SIM_SCGC1_UART4, DefaultRX: defaultUART4RX, DefaultTX: defaultUART4TX, Buffer: NewRingBuffer(), TXBuffer: NewRingBuffer()}
 )
 
 func init() {
@@ -161,6 +162,11 @@ func (u *UART) configure(config UARTConfig, canSched bool) {
 		}
 	}
 
+	u.configureBuffers(config, false)
+	if config.TXBufferSize != 0 && u.TXBuffer.Size() != ringBufferSize(config.TXBufferSize) {
+		u.TXBuffer = NewRingBufferSize(config.TXBufferSize)
+	}
+
 	// set the divisor
 	u.BDH.Set(uint8((divisor >> 13) & 0x1F))
 	u.BDL.Set(uint8((divisor >> 5) & 0xFF))
@@ -251,6 +257,7 @@ func (u *UART) handleStatusInterrupt(interrupt.Interrupt) {
 					break
 				}
 			}
+			u.rxReady.Notify()
 		}
 	}
 
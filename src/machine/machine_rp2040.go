@@ -125,12 +125,14 @@ type dmaChannel struct {
 	_           [12]volatile.Register32 // aliases
 }
 
-// Static assignment of DMA channels to peripherals.
-// Allocating them statically is good enough for now. If lots of peripherals use
-// DMA, these might need to be assigned at runtime.
+// Static assignment of DMA channels to peripherals. Other channels are
+// assigned at runtime by ClaimDMAChannel.
 const (
 	spi0DMAChannel = iota
 	spi1DMAChannel
+	uart0DMAChannel
+	uart1DMAChannel
+	numReservedDMAChannels
 )
 
 // DMA channels usable on the RP2040.
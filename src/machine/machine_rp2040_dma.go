@@ -0,0 +1,138 @@
+//go:build rp2040
+
+package machine
+
+import (
+	"device/rp"
+	"runtime/interrupt"
+)
+
+// DMATrigger is the data request (DREQ) signal of the peripheral that paces a
+// DMA transfer.
+type DMATrigger uint8
+
+// DMA triggers. The triggers of the other PIO state machines follow the one
+// of state machine 0, for example DMATriggerPIO0TX0+2 is the Tx FIFO of state
+// machine 2.
+const (
+	DMATriggerPIO0TX0 DMATrigger = 0
+	DMATriggerPIO0RX0 DMATrigger = 4
+	DMATriggerPIO1TX0 DMATrigger = 8
+	DMATriggerPIO1RX0 DMATrigger = 12
+	DMATriggerSPI0TX  DMATrigger = 16
+	DMATriggerSPI0RX  DMATrigger = 17
+	DMATriggerSPI1TX  DMATrigger = 18
+	DMATriggerSPI1RX  DMATrigger = 19
+	DMATriggerUART0TX DMATrigger = 20
+	DMATriggerUART0RX DMATrigger = 21
+	DMATriggerUART1TX DMATrigger = 22
+	DMATriggerUART1RX DMATrigger = 23
+	DMATriggerI2C0TX  DMATrigger = 32
+	DMATriggerI2C0RX  DMATrigger = 33
+	DMATriggerI2C1TX  DMATrigger = 34
+	DMATriggerI2C1RX  DMATrigger = 35
+	DMATriggerADC     DMATrigger = 36
+
+	// DMATriggerNone transfers as fast as possible.
+	DMATriggerNone DMATrigger = 0x3f
+)
+
+// Maximum number of transfer units of a single transfer.
+const dmaMaxCount = 0xffffffff
+
+// DMAChannel is one of the 12 DMA channels of the RP2040.
+type DMAChannel struct {
+	dmaState
+	index   uint8
+	trigger DMATrigger
+}
+
+var (
+	dmaChannelStates    [12]DMAChannel
+	dmaInterruptEnabled bool
+)
+
+// ClaimDMAChannel returns a free DMA channel, to be used with the given
+// trigger. It returns ErrDMANoChannel if all channels are in use.
+func ClaimDMAChannel(trigger DMATrigger) (*DMAChannel, error) {
+	mask := interrupt.Disable()
+	defer interrupt.Restore(mask)
+	for i := numReservedDMAChannels; i < len(dmaChannelStates); i++ {
+		if !dmaChannelStates[i].claimed {
+			return reservedDMAChannel(i, trigger), nil
+		}
+	}
+	return nil, ErrDMANoChannel
+}
+
+// reservedDMAChannel returns the given DMA channel, which is statically
+// assigned to a peripheral.
+func reservedDMAChannel(index int, trigger DMATrigger) *DMAChannel {
+	ch := &dmaChannelStates[index]
+	if !ch.claimed {
+		ch.claimed = true
+		ch.index = uint8(index)
+		ch.trigger = trigger
+		if !dmaInterruptEnabled {
+			dmaInterruptEnabled = true
+			interrupt.New(rp.IRQ_DMA_IRQ_0, handleDMAInterrupt).Enable()
+		}
+		rp.DMA.INTE0.SetBits(1 << index)
+	}
+	return ch
+}
+
+func handleDMAInterrupt(interrupt.Interrupt) {
+	status := rp.DMA.INTS0.Get()
+	rp.DMA.INTS0.Set(status) // clear interrupts
+	for i := range dmaChannelStates {
+		if status&(1<<i) != 0 {
+			dmaChannelStates[i].complete()
+		}
+	}
+}
+
+// start configures the channel for the given transfer and starts it.
+func (ch *DMAChannel) start(t *DMATransfer) {
+	// Chaining to itself disables hardware chaining, chained transfers are
+	// started from the interrupt.
+	ctrl := uint32(ch.index)<<rp.DMA_CH0_CTRL_TRIG_CHAIN_TO_Pos | rp.DMA_CH0_CTRL_TRIG_EN
+	switch t.Size {
+	case DMASize8:
+		ctrl |= rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_SIZE_BYTE << rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Pos
+	case DMASize16:
+		ctrl |= rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_SIZE_HALFWORD << rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Pos
+	case DMASize32:
+		ctrl |= rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_SIZE_WORD << rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Pos
+	}
+	treq := ch.trigger
+	switch t.Direction {
+	case DMAMemoryToMemory:
+		ctrl |= rp.DMA_CH0_CTRL_TRIG_INCR_READ | rp.DMA_CH0_CTRL_TRIG_INCR_WRITE
+		treq = DMATriggerNone
+	case DMAMemoryToPeripheral:
+		ctrl |= rp.DMA_CH0_CTRL_TRIG_INCR_READ
+	case DMAPeripheralToMemory:
+		ctrl |= rp.DMA_CH0_CTRL_TRIG_INCR_WRITE
+	}
+	ctrl |= uint32(treq) << rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_Pos
+
+	regs := &dmaChannels[ch.index]
+	regs.READ_ADDR.Set(uint32(uintptr(t.Src)))
+	regs.WRITE_ADDR.Set(uint32(uintptr(t.Dst)))
+	regs.TRANS_COUNT.Set(t.Count)
+	regs.CTRL_TRIG.Set(ctrl)
+}
+
+// Abort stops the current transfer. Chained transfers are not started.
+func (ch *DMAChannel) Abort() {
+	mask := interrupt.Disable()
+	bit := uint32(1) << ch.index
+	rp.DMA.CHAN_ABORT.Set(bit)
+	for rp.DMA.CHAN_ABORT.HasBits(bit) {
+	}
+	// Aborting may raise a completion interrupt, which must be ignored.
+	rp.DMA.INTS0.Set(bit)
+	ch.stopped()
+	interrupt.Restore(mask)
+}
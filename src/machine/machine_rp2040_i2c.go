@@ -6,6 +6,7 @@ import (
 	"device/rp"
 	"errors"
 	"internal/itoa"
+	"runtime/interrupt"
 )
 
 // I2C on the RP2040.
@@ -55,17 +56,16 @@ type I2C struct {
 	Bus          *rp.I2C0_Type
 	mode         I2CMode
 	txInProgress bool
+	target       i2cTarget
 }
 
 var (
 	ErrInvalidI2CBaudrate  = errors.New("invalid i2c baudrate")
-	ErrInvalidTgtAddr      = errors.New("invalid target i2c address not in 0..0x80 or is reserved")
 	ErrI2CGeneric          = errors.New("i2c error")
 	ErrRP2040I2CDisable    = errors.New("i2c rp2040 peripheral timeout in disable")
 	errInvalidI2CSDA       = errors.New("invalid I2C SDA pin")
 	errInvalidI2CSCL       = errors.New("invalid I2C SCL pin")
 	ErrI2CAlreadyListening = errors.New("i2c already listening")
-	ErrI2CWrongMode        = errors.New("i2c wrong mode")
 	ErrI2CUnderflow        = errors.New("i2c underflow")
 )
 
@@ -437,57 +437,34 @@ func (i2c *I2C) listen(addr uint8) error {
 	}
 
 	i2c.Bus.IC_SAR.Set(uint32(addr))
+	i2c.enableTargetInterrupt()
 
 	i2c.enable()
 
 	return nil
 }
 
+// WaitForEvent blocks the current goroutine until an I2C event is received
+// (when in target mode). Other goroutines run in the meantime: the transfer is
+// handled by the I2C interrupt.
+//
+// The passed buffer will be populated for receive events, with the number of
+// bytes received returned in count. Bytes that don't fit in the buffer are
+// dropped. For other event types, buf is not modified and a count of zero is
+// returned.
+//
+// For request events, the caller MUST call Reply to avoid hanging the I2C bus
+// indefinitely.
 func (i2c *I2C) WaitForEvent(buf []byte) (evt I2CTargetEvent, count int, err error) {
-	rxPtr := 0
-	for {
-		stat := i2c.Bus.IC_RAW_INTR_STAT.Get()
-
-		if stat&rp.I2C0_IC_INTR_MASK_M_RX_FULL != 0 {
-			b := uint8(i2c.Bus.IC_DATA_CMD.Get())
-			if rxPtr < len(buf) {
-				buf[rxPtr] = b
-				rxPtr++
-			}
-		}
-
-		// Stop
-		if stat&rp.I2C0_IC_INTR_MASK_M_STOP_DET != 0 {
-			if rxPtr > 0 {
-				return I2CReceive, rxPtr, nil
-			}
-
-			i2c.Bus.IC_CLR_STOP_DET.Get() // clear
-			return I2CFinish, 0, nil
-		}
-
-		// Start or restart - ignore start, return on restart
-		if stat&rp.I2C0_IC_INTR_MASK_M_START_DET != 0 {
-			i2c.Bus.IC_CLR_START_DET.Get() // clear restart
-
-			// Restart
-			if rxPtr > 0 {
-				return I2CReceive, rxPtr, nil
-			}
-		}
-
-		// Read request - leave flag set until we start to reply.
-		if stat&rp.I2C0_IC_INTR_MASK_M_RD_REQ != 0 {
-			return I2CRequest, 0, nil
-		}
-
-		gosched()
-	}
+	i2c.target.start(buf, false)
+	i2c.Bus.IC_INTR_MASK.Set(i2cTargetEventInterrupts)
+	i2c.target.wait()
+	return i2c.target.event, i2c.target.count, i2c.target.err
 }
 
+// Reply supplies the response data to the controller, after WaitForEvent
+// returned a request event.
 func (i2c *I2C) Reply(buf []byte) error {
-	txPtr := 0
-
 	stat := i2c.Bus.IC_RAW_INTR_STAT.Get()
 
 	if stat&rp.I2C0_IC_INTR_MASK_M_RD_REQ == 0 {
@@ -500,23 +477,115 @@ func (i2c *I2C) Reply(buf []byte) error {
 		i2c.Bus.IC_CLR_TX_ABRT.Get()
 	}
 
-	for txPtr < len(buf) {
-		if stat&rp.I2C0_IC_INTR_MASK_M_TX_EMPTY != 0 {
-			i2c.Bus.IC_DATA_CMD.Set(uint32(buf[txPtr]))
-			txPtr++
+	if len(buf) == 0 {
+		return nil
+	}
+	i2c.target.start(buf, true)
+	i2c.Bus.IC_INTR_MASK.Set(i2cTargetReplyInterrupts)
+	i2c.target.wait()
+	return i2c.target.err
+}
+
+// The interrupts that drive the target state machine, for WaitForEvent and
+// for Reply.
+const (
+	i2cTargetEventInterrupts = rp.I2C0_IC_INTR_MASK_M_RX_FULL | rp.I2C0_IC_INTR_MASK_M_STOP_DET |
+		rp.I2C0_IC_INTR_MASK_M_START_DET | rp.I2C0_IC_INTR_MASK_M_RD_REQ
+	i2cTargetReplyInterrupts = rp.I2C0_IC_INTR_MASK_M_TX_EMPTY | rp.I2C0_IC_INTR_MASK_M_TX_ABRT
+)
+
+// enableTargetInterrupt enables the I2C interrupt, for target mode. The
+// interrupt sources are enabled by WaitForEvent and Reply.
+func (i2c *I2C) enableTargetInterrupt() {
+	i2c.Bus.IC_INTR_MASK.Set(0)
+	switch i2c.Bus {
+	case rp.I2C0:
+		interrupt.New(rp.IRQ_I2C0_IRQ, _I2C0.handleTargetInterrupt).Enable()
+	case rp.I2C1:
+		interrupt.New(rp.IRQ_I2C1_IRQ, _I2C1.handleTargetInterrupt).Enable()
+	}
+}
+
+// finishTarget disables the interrupt sources and wakes up the goroutine in
+// WaitForEvent or Reply. The flags that are still set are handled by the next
+// call.
+func (i2c *I2C) finishTarget(evt I2CTargetEvent, err error) {
+	i2c.Bus.IC_INTR_MASK.Set(0)
+	i2c.target.finish(evt, err)
+}
+
+// handleTargetInterrupt is the I2C interrupt handler in target mode.
+func (i2c *I2C) handleTargetInterrupt(interrupt.Interrupt) {
+	if i2c.target.busy.Get() == 0 {
+		return
+	}
+	if i2c.target.reply {
+		i2c.handleReply()
+	} else {
+		i2c.handleEvent()
+	}
+}
+
+// handleEvent handles the events for WaitForEvent.
+func (i2c *I2C) handleEvent() {
+	t := &i2c.target
+	stat := i2c.Bus.IC_RAW_INTR_STAT.Get()
+
+	if stat&rp.I2C0_IC_INTR_MASK_M_RX_FULL != 0 {
+		for i2c.readAvailable() != 0 {
+			t.receive(uint8(i2c.Bus.IC_DATA_CMD.Get()))
 		}
+	}
 
-		// This Tx abort is a normal case - we're sending more
-		// data than controller wants to receive
-		if stat&rp.I2C0_IC_INTR_MASK_M_TX_ABRT != 0 {
-			i2c.Bus.IC_CLR_TX_ABRT.Get()
-			return nil
+	// Stop
+	if stat&rp.I2C0_IC_INTR_MASK_M_STOP_DET != 0 {
+		if t.count > 0 {
+			// The stop is reported as a finish event on the next call.
+			i2c.finishTarget(I2CReceive, nil)
+			return
 		}
 
-		gosched()
+		i2c.Bus.IC_CLR_STOP_DET.Get() // clear
+		i2c.finishTarget(I2CFinish, nil)
+		return
 	}
 
-	return nil
+	// Start or restart - ignore start, return on restart
+	if stat&rp.I2C0_IC_INTR_MASK_M_START_DET != 0 {
+		i2c.Bus.IC_CLR_START_DET.Get() // clear restart
+
+		// Restart
+		if t.count > 0 {
+			i2c.finishTarget(I2CReceive, nil)
+			return
+		}
+	}
+
+	// Read request - leave flag set until we start to reply.
+	if stat&rp.I2C0_IC_INTR_MASK_M_RD_REQ != 0 {
+		i2c.finishTarget(I2CRequest, nil)
+	}
+}
+
+// handleReply handles the events for Reply.
+func (i2c *I2C) handleReply() {
+	t := &i2c.target
+	stat := i2c.Bus.IC_RAW_INTR_STAT.Get()
+
+	// This Tx abort is a normal case - we're sending more
+	// data than controller wants to receive
+	if stat&rp.I2C0_IC_INTR_MASK_M_TX_ABRT != 0 {
+		i2c.Bus.IC_CLR_TX_ABRT.Get()
+		i2c.finishTarget(I2CRequest, nil)
+		return
+	}
+
+	if stat&rp.I2C0_IC_INTR_MASK_M_TX_EMPTY != 0 {
+		i2c.Bus.IC_DATA_CMD.Set(uint32(t.next()))
+		if t.count == len(t.buf) {
+			i2c.finishTarget(I2CRequest, nil)
+		}
+	}
 }
 
 // writeAvailable determines non-blocking write space available
@@ -639,8 +708,3 @@ func u32max(a, b uint32) uint32 {
 	}
 	return b
 }
-
-//go:inline
-func isReservedI2CAddr(addr uint8) bool {
-	return (addr&0x78) == 0 || (addr&0x78) == 0x78
-}
@@ -0,0 +1,438 @@
+//go:build rp2040
+
+package machine
+
+import (
+	"device/rp"
+	"errors"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// PIO is one of the two programmable I/O blocks of the RP2040. Each block has
+// 32 words of instruction memory, shared by its 4 state machines.
+//
+// Programs can be assembled with the machine/rp2040/pio package. Pins used by
+// a state machine must be configured with PinPIO0 or PinPIO1.
+type PIO struct {
+	Bus *rp.PIO0_Type
+
+	usedInstructions uint32 // bitmask of the instruction memory in use
+	claimed          uint8  // bitmask of the claimed state machines
+}
+
+var (
+	PIO0 = &PIO{Bus: rp.PIO0}
+	PIO1 = &PIO{Bus: rp.PIO1}
+)
+
+// PIOProgram is a PIO program that can be loaded with AddProgram. Programs
+// assembled by the machine/rp2040/pio package can be converted to it.
+type PIOProgram struct {
+	// Instructions of the program. Jump addresses are relative to the start
+	// of the program, they are relocated when the program is loaded.
+	Instructions []uint16
+
+	// Origin is the address the program must be loaded at, or -1 if it can
+	// be loaded anywhere.
+	Origin int8
+
+	// WrapTarget and Wrap are the first and last instruction of the loop of
+	// the program, relative to the start of the program.
+	WrapTarget uint8
+	Wrap       uint8
+
+	// SideSetCount is the number of bits of the delay/side-set field that are
+	// used for side-set, including the enable bit of optional side-set.
+	SideSetCount    uint8
+	SideSetOptional bool
+
+	// SideSetPinDirs is true when side-set changes the pin directions
+	// instead of the pin values.
+	SideSetPinDirs bool
+}
+
+var (
+	ErrPIONoSpace        = errors.New("pio: not enough instruction memory")
+	ErrPIONoStateMachine = errors.New("pio: no free state machine")
+	errPIOInvalidProgram = errors.New("pio: invalid program")
+	errPIOInvalidConfig  = errors.New("pio: invalid state machine configuration")
+)
+
+// pioStateMachineRegs are the registers of a single state machine.
+type pioStateMachineRegs struct {
+	CLKDIV    volatile.Register32
+	EXECCTRL  volatile.Register32
+	SHIFTCTRL volatile.Register32
+	ADDR      volatile.Register32
+	INSTR     volatile.Register32
+	PINCTRL   volatile.Register32
+}
+
+// Register bits, as described in the datasheet.
+const (
+	pioCTRL_SM_RESTART_Pos     = 4
+	pioCTRL_CLKDIV_RESTART_Pos = 8
+
+	pioFSTAT_RXEMPTY_Pos = 8
+	pioFSTAT_TXFULL_Pos  = 16
+
+	pioCLKDIV_FRAC_Pos = 8
+	pioCLKDIV_INT_Pos  = 16
+
+	pioEXECCTRL_WRAP_BOTTOM_Pos = 7
+	pioEXECCTRL_WRAP_TOP_Pos    = 12
+	pioEXECCTRL_JMP_PIN_Pos     = 24
+	pioEXECCTRL_SIDE_PINDIR     = 1 << 29
+	pioEXECCTRL_SIDE_EN         = 1 << 30
+	pioEXECCTRL_EXEC_STALLED    = 1 << 31
+
+	pioSHIFTCTRL_AUTOPUSH        = 1 << 16
+	pioSHIFTCTRL_AUTOPULL        = 1 << 17
+	pioSHIFTCTRL_IN_SHIFTDIR     = 1 << 18
+	pioSHIFTCTRL_OUT_SHIFTDIR    = 1 << 19
+	pioSHIFTCTRL_PUSH_THRESH_Pos = 20
+	pioSHIFTCTRL_PULL_THRESH_Pos = 25
+	pioSHIFTCTRL_FJOIN_TX        = 1 << 30
+	pioSHIFTCTRL_FJOIN_RX        = 1 << 31
+
+	pioPINCTRL_OUT_BASE_Pos      = 0
+	pioPINCTRL_SET_BASE_Pos      = 5
+	pioPINCTRL_SIDESET_BASE_Pos  = 10
+	pioPINCTRL_IN_BASE_Pos       = 15
+	pioPINCTRL_OUT_COUNT_Pos     = 20
+	pioPINCTRL_SET_COUNT_Pos     = 26
+	pioPINCTRL_SIDESET_COUNT_Pos = 29
+)
+
+func (pio *PIO) instructionMemory() *[32]volatile.Register32 {
+	return (*[32]volatile.Register32)(unsafe.Pointer(&pio.Bus.INSTR_MEM0))
+}
+
+func (pio *PIO) stateMachineRegs() *[4]pioStateMachineRegs {
+	return (*[4]pioStateMachineRegs)(unsafe.Pointer(&pio.Bus.SM0_CLKDIV))
+}
+
+// AddProgram loads the program into the instruction memory and returns the
+// address it was loaded at. Jump addresses are relocated to this address.
+func (pio *PIO) AddProgram(prog *PIOProgram) (offset uint8, err error) {
+	n := len(prog.Instructions)
+	if n == 0 || n > 32 || int(prog.Wrap) >= n || prog.WrapTarget > prog.Wrap {
+		return 0, errPIOInvalidProgram
+	}
+	mask := uint32(1)<<n - 1
+	if n == 32 {
+		mask = 0xffffffff
+	}
+
+	state := interrupt.Disable()
+	defer interrupt.Restore(state)
+
+	found := false
+	if prog.Origin >= 0 {
+		offset = uint8(prog.Origin)
+		found = int(offset)+n <= 32 && pio.usedInstructions&(mask<<offset) == 0
+	} else {
+		// Allocate from the end of the memory, like the Pico SDK.
+		for i := 32 - n; i >= 0; i-- {
+			if pio.usedInstructions&(mask<<i) == 0 {
+				offset = uint8(i)
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return 0, ErrPIONoSpace
+	}
+
+	mem := pio.instructionMemory()
+	for i, instr := range prog.Instructions {
+		if instr>>13 == 0 {
+			// JMP: relocate the address in the lower 5 bits.
+			instr = instr&^0x1f | (instr+uint16(offset))&0x1f
+		}
+		mem[int(offset)+i].Set(uint32(instr))
+	}
+	pio.usedInstructions |= mask << offset
+	return offset, nil
+}
+
+// RemoveProgram frees the instruction memory used by a program that was loaded
+// at the given offset. The program must not be running.
+func (pio *PIO) RemoveProgram(prog *PIOProgram, offset uint8) {
+	n := len(prog.Instructions)
+	mask := uint32(1)<<n - 1
+	if n == 32 {
+		mask = 0xffffffff
+	}
+	state := interrupt.Disable()
+	pio.usedInstructions &^= mask << offset
+	interrupt.Restore(state)
+}
+
+// ClaimStateMachine returns a state machine that is not in use yet, or
+// ErrPIONoStateMachine if all 4 are in use.
+func (pio *PIO) ClaimStateMachine() (PIOStateMachine, error) {
+	state := interrupt.Disable()
+	defer interrupt.Restore(state)
+	for i := uint8(0); i < 4; i++ {
+		if pio.claimed&(1<<i) == 0 {
+			pio.claimed |= 1 << i
+			return PIOStateMachine{pio: pio, index: i}, nil
+		}
+	}
+	return PIOStateMachine{}, ErrPIONoStateMachine
+}
+
+// StateMachine returns the given state machine (0-3). It is not checked
+// whether the state machine is in use.
+func (pio *PIO) StateMachine(index uint8) PIOStateMachine {
+	return PIOStateMachine{pio: pio, index: index & 3}
+}
+
+// PIOStateMachine is one of the 4 state machines of a PIO block.
+type PIOStateMachine struct {
+	pio   *PIO
+	index uint8
+}
+
+// PIOFIFOJoin selects whether the Tx and Rx FIFOs of a state machine are
+// joined into a single FIFO of 8 words.
+type PIOFIFOJoin uint8
+
+const (
+	PIOFIFOJoinNone PIOFIFOJoin = iota
+	PIOFIFOJoinTx               // 8 words Tx FIFO, no Rx FIFO
+	PIOFIFOJoinRx               // 8 words Rx FIFO, no Tx FIFO
+)
+
+// PIOStateMachineConfig is the configuration of a state machine. Pins that are
+// not used by the program can be left zero or set to NoPin.
+type PIOStateMachineConfig struct {
+	// Frequency of the state machine in Hz. It defaults to the system clock.
+	Frequency uint32
+
+	// Pins used by OUT, SET, IN and side-set. The pins of each group are
+	// consecutive, starting at the base pin.
+	OutBase     Pin
+	OutCount    uint8
+	SetBase     Pin
+	SetCount    uint8
+	InBase      Pin
+	SideSetBase Pin
+
+	// JmpPin is the pin tested by JMP PIN.
+	JmpPin Pin
+
+	// Shift direction of the ISR and OSR. Bits are shifted to the left (MSB
+	// first) by default.
+	InShiftRight  bool
+	OutShiftRight bool
+
+	// Automatic push and pull, with the number of bits (1-32) after which
+	// the ISR is pushed or the OSR is refilled.
+	AutoPush      bool
+	PushThreshold uint8
+	AutoPull      bool
+	PullThreshold uint8
+
+	FIFOJoin PIOFIFOJoin
+}
+
+// regs returns the registers of this state machine.
+func (sm PIOStateMachine) regs() *pioStateMachineRegs {
+	return &sm.pio.stateMachineRegs()[sm.index]
+}
+
+// Configure stops the state machine and configures it to run the given
+// program, which was loaded at offset. Call SetEnabled to start it.
+func (sm PIOStateMachine) Configure(prog *PIOProgram, offset uint8, config PIOStateMachineConfig) error {
+	if config.OutCount > 32 || config.SetCount > 5 || config.PushThreshold > 32 || config.PullThreshold > 32 {
+		return errPIOInvalidConfig
+	}
+	sm.SetEnabled(false)
+
+	// Clock divider in 16.8 fixed point.
+	div := uint32(1 << 8)
+	if config.Frequency != 0 {
+		div = uint32((uint64(CPUFrequency())<<8 + uint64(config.Frequency)/2) / uint64(config.Frequency))
+		if div < 1<<8 || div >= 1<<24 {
+			return errPIOInvalidConfig
+		}
+	}
+
+	execctrl := uint32(offset+prog.WrapTarget)<<pioEXECCTRL_WRAP_BOTTOM_Pos |
+		uint32(offset+prog.Wrap)<<pioEXECCTRL_WRAP_TOP_Pos
+	if config.JmpPin != NoPin {
+		execctrl |= uint32(config.JmpPin) << pioEXECCTRL_JMP_PIN_Pos
+	}
+	if prog.SideSetOptional {
+		execctrl |= pioEXECCTRL_SIDE_EN
+	}
+	if prog.SideSetPinDirs {
+		execctrl |= pioEXECCTRL_SIDE_PINDIR
+	}
+
+	// A threshold of 32 is encoded as 0.
+	shiftctrl := uint32(config.PushThreshold&0x1f)<<pioSHIFTCTRL_PUSH_THRESH_Pos |
+		uint32(config.PullThreshold&0x1f)<<pioSHIFTCTRL_PULL_THRESH_Pos
+	if config.InShiftRight {
+		shiftctrl |= pioSHIFTCTRL_IN_SHIFTDIR
+	}
+	if config.OutShiftRight {
+		shiftctrl |= pioSHIFTCTRL_OUT_SHIFTDIR
+	}
+	if config.AutoPush {
+		shiftctrl |= pioSHIFTCTRL_AUTOPUSH
+	}
+	if config.AutoPull {
+		shiftctrl |= pioSHIFTCTRL_AUTOPULL
+	}
+	switch config.FIFOJoin {
+	case PIOFIFOJoinTx:
+		shiftctrl |= pioSHIFTCTRL_FJOIN_TX
+	case PIOFIFOJoinRx:
+		shiftctrl |= pioSHIFTCTRL_FJOIN_RX
+	}
+
+	var pinctrl uint32
+	if config.OutBase != NoPin {
+		pinctrl |= uint32(config.OutBase)<<pioPINCTRL_OUT_BASE_Pos |
+			uint32(config.OutCount)<<pioPINCTRL_OUT_COUNT_Pos
+	}
+	if config.SetBase != NoPin {
+		pinctrl |= uint32(config.SetBase)<<pioPINCTRL_SET_BASE_Pos |
+			uint32(config.SetCount)<<pioPINCTRL_SET_COUNT_Pos
+	}
+	if config.InBase != NoPin {
+		pinctrl |= uint32(config.InBase) << pioPINCTRL_IN_BASE_Pos
+	}
+	if config.SideSetBase != NoPin {
+		pinctrl |= uint32(config.SideSetBase) << pioPINCTRL_SIDESET_BASE_Pos
+	}
+	pinctrl |= uint32(prog.SideSetCount) << pioPINCTRL_SIDESET_COUNT_Pos
+
+	regs := sm.regs()
+	regs.CLKDIV.Set(div << pioCLKDIV_FRAC_Pos)
+	regs.EXECCTRL.Set(execctrl)
+	regs.SHIFTCTRL.Set(shiftctrl)
+	regs.PINCTRL.Set(pinctrl)
+
+	// Changing the FIFO join flushes the FIFOs, make sure they are empty in
+	// any case.
+	regs.SHIFTCTRL.Set(shiftctrl ^ pioSHIFTCTRL_FJOIN_RX)
+	regs.SHIFTCTRL.Set(shiftctrl)
+
+	sm.Restart()
+	sm.Exec(uint16(offset)) // JMP offset
+	return nil
+}
+
+// SetEnabled starts or stops the state machine.
+func (sm PIOStateMachine) SetEnabled(enabled bool) {
+	if enabled {
+		sm.pio.Bus.CTRL.SetBits(1 << sm.index)
+	} else {
+		sm.pio.Bus.CTRL.ClearBits(1 << sm.index)
+	}
+}
+
+// Restart clears the internal state of the state machine (shift counters,
+// delay and stall state) and restarts its clock divider.
+func (sm PIOStateMachine) Restart() {
+	sm.pio.Bus.CTRL.SetBits(1<<(pioCTRL_SM_RESTART_Pos+sm.index) | 1<<(pioCTRL_CLKDIV_RESTART_Pos+sm.index))
+}
+
+// Exec executes a single instruction immediately, for example to set the
+// direction of pins. It waits until the instruction has completed.
+func (sm PIOStateMachine) Exec(instr uint16) {
+	regs := sm.regs()
+	regs.INSTR.Set(uint32(instr))
+	for regs.EXECCTRL.HasBits(pioEXECCTRL_EXEC_STALLED) {
+		gosched()
+	}
+}
+
+// SetPinDirs sets the direction of count consecutive pins starting at base,
+// using SET PINDIRS instructions. The state machine must be stopped.
+func (sm PIOStateMachine) SetPinDirs(base Pin, count uint8, output bool) {
+	regs := sm.regs()
+	pinctrl := regs.PINCTRL.Get()
+	execctrl := regs.EXECCTRL.Get()
+	// Side-set must not interfere with the SET instructions.
+	regs.EXECCTRL.ClearBits(pioEXECCTRL_SIDE_EN)
+	value := uint16(0)
+	if output {
+		value = 0x1f
+	}
+	for count > 0 {
+		n := count
+		if n > 5 {
+			n = 5
+		}
+		regs.PINCTRL.Set(uint32(base)<<pioPINCTRL_SET_BASE_Pos | uint32(n)<<pioPINCTRL_SET_COUNT_Pos)
+		sm.Exec(0xe080 | value) // SET PINDIRS, value
+		base += Pin(n)
+		count -= n
+	}
+	regs.PINCTRL.Set(pinctrl)
+	regs.EXECCTRL.Set(execctrl)
+}
+
+// TxFull returns whether the Tx FIFO is full.
+func (sm PIOStateMachine) TxFull() bool {
+	return sm.pio.Bus.FSTAT.HasBits(1 << (pioFSTAT_TXFULL_Pos + sm.index))
+}
+
+// RxEmpty returns whether the Rx FIFO is empty.
+func (sm PIOStateMachine) RxEmpty() bool {
+	return sm.pio.Bus.FSTAT.HasBits(1 << (pioFSTAT_RXEMPTY_Pos + sm.index))
+}
+
+// Put writes a word to the Tx FIFO. It blocks while the FIFO is full.
+func (sm PIOStateMachine) Put(value uint32) {
+	for sm.TxFull() {
+		gosched()
+	}
+	sm.TxFIFO().Set(value)
+}
+
+// Get reads a word from the Rx FIFO. It blocks while the FIFO is empty.
+func (sm PIOStateMachine) Get() uint32 {
+	for sm.RxEmpty() {
+		gosched()
+	}
+	return sm.RxFIFO().Get()
+}
+
+// TxFIFO returns the register to write the Tx FIFO, for example as the
+// destination of a DMA transfer.
+func (sm PIOStateMachine) TxFIFO() *volatile.Register32 {
+	return &(*[4]volatile.Register32)(unsafe.Pointer(&sm.pio.Bus.TXF0))[sm.index]
+}
+
+// RxFIFO returns the register to read the Rx FIFO, for example as the source
+// of a DMA transfer.
+func (sm PIOStateMachine) RxFIFO() *volatile.Register32 {
+	return &(*[4]volatile.Register32)(unsafe.Pointer(&sm.pio.Bus.RXF0))[sm.index]
+}
+
+// TxDMATrigger returns the DMA trigger to write the Tx FIFO of this state
+// machine.
+func (sm PIOStateMachine) TxDMATrigger() DMATrigger {
+	if sm.pio == PIO1 {
+		return DMATriggerPIO1TX0 + DMATrigger(sm.index)
+	}
+	return DMATriggerPIO0TX0 + DMATrigger(sm.index)
+}
+
+// RxDMATrigger returns the DMA trigger to read the Rx FIFO of this state
+// machine.
+func (sm PIOStateMachine) RxDMATrigger() DMATrigger {
+	if sm.pio == PIO1 {
+		return DMATriggerPIO1RX0 + DMATrigger(sm.index)
+	}
+	return DMATriggerPIO0RX0 + DMATrigger(sm.index)
+}
@@ -7,8 +7,8 @@ package machine
 
 import (
 	"device/rp"
-	"errors"
 	"runtime/interrupt"
+	"time"
 	"unsafe"
 )
 
@@ -24,75 +24,72 @@ type rtcTime struct {
 	Sec   int8
 }
 
+// RTC is the real-time clock.
 var RTC = (*rtcType)(unsafe.Pointer(rp.RTC))
 
 const (
-	second = 1
-	minute = 60 * second
-	hour   = 60 * minute
-	day    = 24 * hour
+	rtcMinTime = 0           // 1970-01-01 00:00:00
+	rtcMaxTime = 67090118399 // 4095-12-31 23:59:59
 )
 
-var (
-	rtcAlarmRepeats bool
-	rtcCallback     func()
-	rtcEpoch        = rtcTime{
-		Year: 1970, Month: 1, Day: 1, Dotw: 4, Hour: 0, Min: 0, Sec: 0,
-	}
-)
-
-var (
-	ErrRtcDelayTooSmall = errors.New("RTC interrupt deplay is too small, shall be at least 1 second")
-	ErrRtcDelayTooLarge = errors.New("RTC interrupt deplay is too large, shall be no more than 1 day")
-)
-
-// SetInterrupt configures delayed and optionally recurring interrupt by real time clock.
-//
-// Delay is specified in whole seconds, allowed range depends on platform.
-// Zero delay disables previously configured interrupt, if any.
-//
-// RP2040 implementation allows delay to be up to 1 day, otherwise a respective error is emitted.
-func (rtc *rtcType) SetInterrupt(delay uint32, repeat bool, callback func()) error {
+// rtcEpoch is the time the clock starts at when it is used without being set.
+var rtcEpoch = rtcTime{
+	Year: 1970, Month: 1, Day: 1, Dotw: 4, Hour: 0, Min: 0, Sec: 0,
+}
 
-	// Verify delay range
-	if delay > day {
-		return ErrRtcDelayTooLarge
+func (rtc *rtcType) start() {
+	if !rtc.isActive() {
+		rtc.setDivider()
+		rtc.setTime(rtcEpoch)
 	}
+}
 
-	// De-configure delayed interrupt if delay is zero
-	if delay == 0 {
-		rtc.disableInterruptMatch()
-		return nil
-	}
+func (rtc *rtcType) valid() bool {
+	return rtcTimeSet && rtc.isActive()
+}
 
-	// Configure delayed interrupt
+func (rtc *rtcType) setUnix(sec int64) {
 	rtc.setDivider()
+	rtc.setTime(toRTCTime(sec))
+}
 
-	rtcAlarmRepeats = repeat
-	rtcCallback = callback
+func (rtc *rtcType) now() time.Time {
+	// RTC_0 must be read before RTC_1, reading RTC_0 latches RTC_1.
+	rtc0 := rtc.RTC_0.Get()
+	rtc1 := rtc.RTC_1.Get()
+	return time.Date(
+		int((rtc1&rp.RTC_SETUP_0_YEAR_Msk)>>rp.RTC_SETUP_0_YEAR_Pos),
+		time.Month((rtc1&rp.RTC_SETUP_0_MONTH_Msk)>>rp.RTC_SETUP_0_MONTH_Pos),
+		int((rtc1&rp.RTC_SETUP_0_DAY_Msk)>>rp.RTC_SETUP_0_DAY_Pos),
+		int((rtc0&rp.RTC_SETUP_1_HOUR_Msk)>>rp.RTC_SETUP_1_HOUR_Pos),
+		int((rtc0&rp.RTC_SETUP_1_MIN_Msk)>>rp.RTC_SETUP_1_MIN_Pos),
+		int((rtc0&rp.RTC_SETUP_1_SEC_Msk)>>rp.RTC_SETUP_1_SEC_Pos),
+		0, time.UTC)
+}
 
-	err := rtc.setTime(rtcEpoch)
-	if err != nil {
-		return err
+func (rtc *rtcType) armAlarm(sec int64) {
+	if now := rtc.now().Unix(); sec <= now {
+		// The alarm only fires on an exact match.
+		sec = now + 1
 	}
-	rtc.setAlarm(toAlarmTime(delay), callback)
+	rtc.setAlarm(toRTCTime(sec))
+}
 
-	return nil
+func (rtc *rtcType) disarmAlarm() {
+	rtc.disableInterruptMatch()
 }
 
-func toAlarmTime(delay uint32) rtcTime {
-	result := rtcEpoch
-	remainder := delay + 1 // needed "+1", otherwise alarm fires one second too early
-	if remainder >= hour {
-		result.Hour = int8(remainder / hour)
-		remainder %= hour
+func toRTCTime(sec int64) rtcTime {
+	t := time.Unix(sec, 0).UTC()
+	return rtcTime{
+		Year:  int16(t.Year()),
+		Month: int8(t.Month()),
+		Day:   int8(t.Day()),
+		Dotw:  int8(t.Weekday()),
+		Hour:  int8(t.Hour()),
+		Min:   int8(t.Minute()),
+		Sec:   int8(t.Second()),
 	}
-	if remainder >= minute {
-		result.Min = int8(remainder / minute)
-		remainder %= minute
-	}
-	result.Sec = int8(remainder)
-	return result
 }
 
 func (rtc *rtcType) setDivider() {
@@ -152,9 +149,7 @@ func (rtc *rtcType) isActive() bool {
 }
 
 // setAlarm configures alarm in RTC and arms it.
-// The callback is executed in the context of an interrupt handler,
-// so regular restructions for this sort of code apply: no blocking, no memory allocation, etc.
-func (rtc *rtcType) setAlarm(t rtcTime, callback func()) {
+func (rtc *rtcType) setAlarm(t rtcTime) {
 
 	rtc.disableInterruptMatch()
 
@@ -227,14 +222,5 @@ func rtcHandleInterrupt(itr interrupt.Interrupt) {
 	// If it matches on a second it can keep firing for that second.
 	RTC.disableInterruptMatch()
 
-	// Call user callback function
-	if rtcCallback != nil {
-		rtcCallback()
-	}
-
-	if rtcAlarmRepeats {
-		// If it is a repeatable alarm, reset time and re-enable the alarm.
-		RTC.setTime(rtcEpoch)
-		RTC.enableInterruptMatch()
-	}
+	rtcHandleAlarm()
 }
@@ -74,6 +74,7 @@ type SPI struct {
 // This form sends 0xff and puts the result into rx buffer. Useful for reading from SD cards
 // which require 0xff input on SI.
 func (spi SPI) Tx(w, r []byte) (err error) {
+	spi.WaitAsync()
 	switch {
 	case w == nil:
 		// read only, so write zero and read a result.
@@ -93,6 +94,7 @@ func (spi SPI) Tx(w, r []byte) (err error) {
 
 // Write a single byte and read a single byte from TX/RX FIFO.
 func (spi SPI) Transfer(w byte) (byte, error) {
+	spi.WaitAsync()
 	for !spi.isWritable() {
 	}
 
@@ -287,49 +289,57 @@ func (spi SPI) isBusy() bool {
 	return spi.Bus.SSPSR.HasBits(rp.SPI0_SSPSR_BSY)
 }
 
-// tx writes buffer to SPI ignoring Rx.
-func (spi SPI) tx(tx []byte) error {
-	if len(tx) == 0 {
-		// We don't have to do anything.
-		// This avoids a panic in &tx[0] when len(tx) == 0.
-		return nil
+// The DMA transfer started by TxAsync of each SPI peripheral. The source
+// address is cleared by WaitAsync.
+var spiDMATransfers [2]DMATransfer
+
+// dmaTransfer returns the DMA transfer of this SPI peripheral.
+func (spi SPI) dmaTransfer() *DMATransfer {
+	if spi.Bus == rp.SPI0 {
+		return &spiDMATransfers[0]
 	}
+	return &spiDMATransfers[1]
+}
 
-	// Pick the DMA channel reserved for this SPI peripheral.
-	var ch *dmaChannel
-	var dreq uint32
+// dmaChannel returns the DMA channel reserved for this SPI peripheral.
+func (spi SPI) dmaChannel() *DMAChannel {
 	if spi.Bus == rp.SPI0 {
-		ch = &dmaChannels[spi0DMAChannel]
-		dreq = 16 // DREQ_SPI0_TX
-	} else { // SPI1
-		ch = &dmaChannels[spi1DMAChannel]
-		dreq = 18 // DREQ_SPI1_TX
+		return reservedDMAChannel(spi0DMAChannel, DMATriggerSPI0TX)
+	}
+	return reservedDMAChannel(spi1DMAChannel, DMATriggerSPI1TX)
+}
+
+// TxAsync starts writing w using DMA, ignoring Rx, and returns without waiting
+// for the transfer to complete. The buffer must not be modified until
+// WaitAsync returns. Other SPI methods wait for the transfer to complete
+// before they start.
+func (spi SPI) TxAsync(w []byte) error {
+	spi.WaitAsync()
+	if len(w) == 0 {
+		// We don't have to do anything.
+		// This avoids a panic in &w[0] when len(w) == 0.
+		return nil
+	}
+	t := spi.dmaTransfer()
+	*t = DMATransfer{
+		Direction: DMAMemoryToPeripheral,
+		Size:      DMASize8,
+		Src:       unsafe.Pointer(&w[0]),
+		Dst:       unsafe.Pointer(&spi.Bus.SSPDR),
+		Count:     uint32(len(w)),
 	}
+	return spi.dmaChannel().Start(t)
+}
 
-	// Configure the DMA peripheral as follows:
-	//   - set read address, write address, and number of transfer units (bytes)
-	//   - increment read address (in memory), don't increment write address (SSPDR)
-	//   - set data size to single bytes
-	//   - set the DREQ so that the DMA will fill the SPI FIFO as needed
-	//   - start the transfer
-	ch.READ_ADDR.Set(uint32(uintptr(unsafe.Pointer(&tx[0]))))
-	ch.WRITE_ADDR.Set(uint32(uintptr(unsafe.Pointer(&spi.Bus.SSPDR))))
-	ch.TRANS_COUNT.Set(uint32(len(tx)))
-	ch.CTRL_TRIG.Set(rp.DMA_CH0_CTRL_TRIG_INCR_READ |
-		rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_SIZE_BYTE<<rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Pos |
-		dreq<<rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_Pos |
-		rp.DMA_CH0_CTRL_TRIG_EN)
-
-	// Wait until the transfer is complete.
-	// TODO: do this more efficiently:
-	//   - Add a new API to start the transfer, without waiting for it to
-	//     complete. This way, the CPU can do something useful while the
-	//     transfer is in progress.
-	//   - If we have to wait, do so by waiting for an interrupt and blocking
-	//     this goroutine until finished (so that other goroutines can run or
-	//     the CPU can go to sleep).
-	for ch.CTRL_TRIG.Get()&rp.DMA_CH0_CTRL_TRIG_BUSY != 0 {
+// WaitAsync blocks until the transfer started by TxAsync has completed. Other
+// goroutines can run in the meantime.
+func (spi SPI) WaitAsync() {
+	t := spi.dmaTransfer()
+	if t.Src == nil {
+		return
 	}
+	spi.dmaChannel().Wait()
+	t.Src = nil
 
 	// We didn't read any result values, which means the RX FIFO has likely
 	// overflown. We have to clean up this mess now.
@@ -346,7 +356,13 @@ func (spi SPI) tx(tx []byte) error {
 	}
 	// Don't leave overrun flag set
 	spi.Bus.SSPICR.Set(rp.SPI0_SSPICR_RORIC)
-	return nil
+}
+
+// tx writes buffer to SPI ignoring Rx.
+func (spi SPI) tx(tx []byte) error {
+	err := spi.TxAsync(tx)
+	spi.WaitAsync()
+	return err
 }
 
 // rx reads buffer to SPI ignoring x.
@@ -5,6 +5,7 @@ package machine
 import (
 	"device/rp"
 	"runtime/interrupt"
+	"unsafe"
 )
 
 // UART on the RP2040.
@@ -12,11 +13,23 @@ type UART struct {
 	Buffer    *RingBuffer
 	Bus       *rp.UART0_Type
 	Interrupt interrupt.Interrupt
+
+	txTransfer DMATransfer // started by WriteAsync
+	uartState
 }
 
+// Error bits in the UARTDR register, for the byte that was read.
+const (
+	uartDR_FE = 1 << 8  // framing error
+	uartDR_PE = 1 << 9  // parity error
+	uartDR_BE = 1 << 10 // break error
+	uartDR_OE = 1 << 11 // overrun error
+)
+
 // Configure the UART.
 func (uart *UART) Configure(config UARTConfig) error {
 	initUART(uart)
+	uart.configureBuffers(config, true)
 
 	// Default baud rate to 115200.
 	if config.BaudRate == 0 {
@@ -87,6 +100,13 @@ func (uart *UART) SetBaudRate(br uint32) {
 
 // WriteByte writes a byte of data to the UART.
 func (uart *UART) WriteByte(c byte) error {
+	uart.WaitAsync()
+
+	if uart.txRing != nil {
+		uart.writeBuffered(c)
+		return nil
+	}
+
 	// wait until buffer is not full
 	for uart.Bus.UARTFR.HasBits(rp.UART0_UARTFR_TXFF) {
 	}
@@ -96,6 +116,45 @@ func (uart *UART) WriteByte(c byte) error {
 	return nil
 }
 
+// WriteAsync starts writing data using DMA and returns without waiting for the
+// transfer to complete. The buffer must not be modified until WaitAsync
+// returns. WriteByte and Write wait for the transfer to complete before they
+// start.
+func (uart *UART) WriteAsync(data []byte) error {
+	uart.WaitAsync()
+	uart.flushTX()
+	if len(data) == 0 {
+		return nil
+	}
+	uart.Bus.UARTDMACR.SetBits(rp.UART0_UARTDMACR_TXDMAE)
+	uart.txTransfer = DMATransfer{
+		Direction: DMAMemoryToPeripheral,
+		Size:      DMASize8,
+		Src:       unsafe.Pointer(&data[0]),
+		Dst:       unsafe.Pointer(&uart.Bus.UARTDR),
+		Count:     uint32(len(data)),
+	}
+	return uart.dmaChannel().Start(&uart.txTransfer)
+}
+
+// WaitAsync blocks until the transfer started by WriteAsync has completed.
+// Other goroutines can run in the meantime.
+func (uart *UART) WaitAsync() {
+	if uart.txTransfer.Src == nil {
+		return
+	}
+	uart.dmaChannel().Wait()
+	uart.txTransfer.Src = nil
+}
+
+// dmaChannel returns the DMA channel reserved for this UART.
+func (uart *UART) dmaChannel() *DMAChannel {
+	if uart.Bus == rp.UART0 {
+		return reservedDMAChannel(uart0DMAChannel, DMATriggerUART0TX)
+	}
+	return reservedDMAChannel(uart1DMAChannel, DMATriggerUART1TX)
+}
+
 // SetFormat for number of data bits, stop bits, and parity for the UART.
 func (uart *UART) SetFormat(databits, stopbits uint8, parity UARTParity) error {
 	var pen, pev uint8
@@ -131,7 +190,42 @@ func initUART(uart *UART) {
 // handleInterrupt should be called from the appropriate interrupt handler for
 // this UART instance.
 func (uart *UART) handleInterrupt(interrupt.Interrupt) {
-	for uart.Bus.UARTFR.HasBits(rp.UART0_UARTFR_RXFE) {
+	for !uart.Bus.UARTFR.HasBits(rp.UART0_UARTFR_RXFE) {
+		data := uart.Bus.UARTDR.Get()
+		if data&(uartDR_FE|uartDR_PE|uartDR_BE|uartDR_OE) != 0 {
+			var errs UARTError
+			if data&uartDR_OE != 0 {
+				errs |= ErrUARTOverrun
+			}
+			if data&(uartDR_FE|uartDR_BE) != 0 {
+				errs |= ErrUARTFraming
+			}
+			if data&uartDR_PE != 0 {
+				errs |= ErrUARTParity
+			}
+			uart.receiveError(errs)
+		}
+		uart.Receive(byte(data & 0xFF))
+	}
+	if uart.Bus.UARTIMSC.HasBits(rp.UART0_UARTIMSC_TXIM) {
+		uart.handleTXInterrupt()
+	}
+}
+
+func (uart *UART) txReady() bool {
+	return !uart.Bus.UARTFR.HasBits(rp.UART0_UARTFR_TXFF)
+}
+
+func (uart *UART) txWrite(c byte) {
+	uart.Bus.UARTDR.Set(uint32(c))
+}
+
+func (uart *UART) setTXInterrupt(enable bool) {
+	// The TX interrupt fires when the transmitter becomes ready, also if it
+	// happened before the interrupt was enabled.
+	if enable {
+		uart.Bus.UARTIMSC.SetBits(rp.UART0_UARTIMSC_TXIM)
+	} else {
+		uart.Bus.UARTIMSC.ClearBits(rp.UART0_UARTIMSC_TXIM)
 	}
-	uart.Receive(byte((uart.Bus.UARTDR.Get() & 0xFF)))
 }
@@ -69,10 +69,8 @@ func handleUSBIRQ(intr interrupt.Interrupt) {
 			// Standard Requests
 			ok = handleStandardSetup(setup)
 		} else {
-			// Class Interface Requests
-			if setup.WIndex < uint16(len(usbSetupHandler)) && usbSetupHandler[setup.WIndex] != nil {
-				ok = usbSetupHandler[setup.WIndex](setup)
-			}
+			// Class and Vendor Requests
+			ok = handleClassSetup(setup)
 		}
 
 		if !ok {
@@ -108,7 +106,9 @@ func handleUSBIRQ(intr interrupt.Interrupt) {
 				if usbRxHandler[i] != nil {
 					usbRxHandler[i](buf)
 				}
-				handleEndpointRxComplete(uint32(i))
+				if !usbRxPaused[i] {
+					handleEndpointRxComplete(uint32(i))
+				}
 			}
 		}
 
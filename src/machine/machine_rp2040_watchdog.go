@@ -25,3 +25,78 @@ var watchdog = (*watchdogType)(unsafe.Pointer(rp.WATCHDOG))
 func (wd *watchdogType) startTick(cycles uint32) {
 	wd.tick.Set(cycles | rp.WATCHDOG_TICK_ENABLE)
 }
+
+// Watchdog provides access to the hardware watchdog of the RP2040.
+var Watchdog = &watchdogImpl{}
+
+const (
+	// WatchdogMaxTimeout is the maximum timeout in milliseconds (about 8.3s).
+	// The counter has 24 bits and nominally counts at 1MHz, but due to errata
+	// RP2040-E1 it decrements twice per tick.
+	WatchdogMaxTimeout = rp.WATCHDOG_LOAD_LOAD_Msk / 1000 / 2
+)
+
+type watchdogImpl struct {
+	config WatchdogConfig
+
+	// value the counter is reset to on each Update
+	loadValue uint32
+}
+
+// Configure the watchdog. It counts the 1MHz watchdog tick, which is started
+// by the clock initialization.
+func (wd *watchdogImpl) Configure(config WatchdogConfig) error {
+	wd.config = config
+	wd.loadValue = config.TimeoutMillis * 1000 * 2 // x2 due to errata RP2040-E1
+	if config.TimeoutMillis > WatchdogMaxTimeout {
+		wd.loadValue = rp.WATCHDOG_LOAD_LOAD_Msk
+	}
+
+	watchdog.ctrl.ClearBits(rp.WATCHDOG_CTRL_ENABLE)
+
+	// Reset everything apart from the oscillators.
+	rp.PSM.WDSEL.Set(0x0001ffff &^ (rp.PSM_WDSEL_ROSC | rp.PSM_WDSEL_XOSC))
+
+	// Don't reset the chip while it is halted by a debugger.
+	watchdog.ctrl.SetBits(rp.WATCHDOG_CTRL_PAUSE_DBG0 | rp.WATCHDOG_CTRL_PAUSE_DBG1 | rp.WATCHDOG_CTRL_PAUSE_JTAG)
+
+	watchdog.load.Set(wd.loadValue)
+	return nil
+}
+
+// Start the watchdog.
+func (wd *watchdogImpl) Start() error {
+	watchdog.load.Set(wd.loadValue)
+	watchdog.ctrl.SetBits(rp.WATCHDOG_CTRL_ENABLE)
+	startWatchdogIdleHook(wd.config)
+	return nil
+}
+
+// Update the watchdog, indicating that the program is healthy.
+func (wd *watchdogImpl) Update() {
+	watchdog.load.Set(wd.loadValue)
+}
+
+// ResetCause returns why the chip was last reset.
+func (wd *watchdogImpl) ResetCause() ResetCause {
+	reason := watchdog.reason.Get()
+	if reason&rp.WATCHDOG_REASON_TIMER != 0 {
+		return ResetCauseWatchdog
+	}
+	if reason&rp.WATCHDOG_REASON_FORCE != 0 {
+		// The watchdog was triggered on purpose, which is how the bootrom
+		// and the SDK reboot the chip.
+		return ResetCauseSoftware
+	}
+	chipReset := rp.VREG_AND_CHIP_RESET.CHIP_RESET.Get()
+	switch {
+	case chipReset&rp.VREG_AND_CHIP_RESET_CHIP_RESET_HAD_POR != 0:
+		return ResetCausePowerOn
+	case chipReset&rp.VREG_AND_CHIP_RESET_CHIP_RESET_HAD_RUN != 0:
+		return ResetCausePin
+	case chipReset&rp.VREG_AND_CHIP_RESET_CHIP_RESET_HAD_PSM_RESTART != 0:
+		// Reset from the debug port.
+		return ResetCauseSoftware
+	}
+	return ResetCauseUnknown
+}
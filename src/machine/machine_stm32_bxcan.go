@@ -0,0 +1,323 @@
+//go:build stm32f4 || stm32f7
+
+package machine
+
+// CAN driver for the bxCAN peripheral of the STM32F4 and STM32F7.
+
+import (
+	"device/stm32"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// CAN is a bxCAN controller. It supports classic CAN frames with up to 8 data
+// bytes.
+type CAN struct {
+	Bus             *stm32.CAN_Type
+	AltFuncSelector uint8
+	filterBank      uint8 // first filter bank used by this controller
+}
+
+// The filter banks are shared between CAN1 and CAN2, and are only accessible
+// through CAN1. By default the first 14 banks are used by CAN1 and the rest by
+// CAN2. Each bank holds a single filter.
+const canFilterCount = 14
+
+// The bxCAN is clocked by PCLK1. The runtime sets the APB1 prescaler to a
+// value other than 1, so the APB1 timer clock is twice PCLK1.
+const canClockFrequency = APB1_TIM_FREQ / 2
+
+// The goroutines blocked in Transmit and Receive, for CAN1 and CAN2.
+var canWait [2]canWaiters
+
+// Register bits, as described in the reference manual.
+const (
+	bxcanMCR_INRQ  = 1 << 0
+	bxcanMCR_SLEEP = 1 << 1
+	bxcanMCR_TXFP  = 1 << 2
+
+	bxcanMSR_INAK = 1 << 0
+	bxcanMSR_SLAK = 1 << 1
+	bxcanMSR_ERRI = 1 << 2
+
+	bxcanTSR_RQCP0    = 1 << 0
+	bxcanTSR_RQCP1    = 1 << 8
+	bxcanTSR_RQCP2    = 1 << 16
+	bxcanTSR_CODE_Pos = 24
+	bxcanTSR_TME_Msk  = 7 << 26
+
+	bxcanRF0R_FMP0_Msk = 3 << 0
+	bxcanRF0R_RFOM0    = 1 << 5
+
+	bxcanESR_BOFF    = 1 << 2
+	bxcanESR_TEC_Pos = 16
+	bxcanESR_REC_Pos = 24
+
+	bxcanBTR_TS1_Pos = 16
+	bxcanBTR_TS2_Pos = 20
+	bxcanBTR_SJW_Pos = 24
+	bxcanBTR_LBKM    = 1 << 30
+	bxcanBTR_SILM    = 1 << 31
+
+	bxcanIER_TMEIE  = 1 << 0
+	bxcanIER_FMPIE0 = 1 << 1
+	bxcanIER_BOFIE  = 1 << 10
+	bxcanIER_ERRIE  = 1 << 15
+
+	// TIxR and RIxR
+	bxcanIR_TXRQ     = 1 << 0
+	bxcanIR_RTR      = 1 << 1
+	bxcanIR_IDE      = 1 << 2
+	bxcanIR_EXID_Pos = 3
+	bxcanIR_STID_Pos = 21
+
+	bxcanFMR_FINIT = 1 << 0
+)
+
+// bxcanMailbox is a Tx mailbox or the output of a Rx FIFO.
+type bxcanMailbox struct {
+	IR  volatile.Register32
+	DTR volatile.Register32
+	DLR volatile.Register32
+	DHR volatile.Register32
+}
+
+func (can *CAN) txMailboxes() *[3]bxcanMailbox {
+	return (*[3]bxcanMailbox)(unsafe.Pointer(&can.Bus.TI0R))
+}
+
+func (can *CAN) rxFIFO0() *bxcanMailbox {
+	return (*bxcanMailbox)(unsafe.Pointer(&can.Bus.RI0R))
+}
+
+// filterBanks returns the filter bank registers, which are part of CAN1.
+func filterBanks() *[28][2]volatile.Register32 {
+	return (*[28][2]volatile.Register32)(unsafe.Pointer(&stm32.CAN1.F0R1))
+}
+
+// Configure this CAN peripheral with the given configuration.
+func (can *CAN) Configure(config CANConfig) error {
+	if config.TransferRate == 0 {
+		config.TransferRate = CANTransferRate500kbps
+	}
+	prescaler, seg1, seg2, err := canBitTiming(canClockFrequency, config.TransferRate, 1024)
+	if err != nil {
+		return err
+	}
+
+	if config.Standby != NoPin {
+		config.Standby.Configure(PinConfig{Mode: PinOutput})
+		config.Standby.Low()
+	}
+	config.Tx.ConfigureAltFunc(PinConfig{Mode: PinModeCANTX}, can.AltFuncSelector)
+	config.Rx.ConfigureAltFunc(PinConfig{Mode: PinModeCANRX}, can.AltFuncSelector)
+
+	// CAN2 can only be used together with CAN1, which owns the filters.
+	enableAltFuncClock(unsafe.Pointer(stm32.CAN1))
+	enableAltFuncClock(unsafe.Pointer(can.Bus))
+
+	// Leave sleep mode and enter initialization mode.
+	can.Bus.MCR.ClearBits(bxcanMCR_SLEEP)
+	can.Bus.MCR.SetBits(bxcanMCR_INRQ)
+	for can.Bus.MSR.Get()&(bxcanMSR_INAK|bxcanMSR_SLAK) != bxcanMSR_INAK {
+	}
+
+	// Transmit frames in the order they were queued. Automatic bus-off
+	// recovery is disabled, see Recover.
+	can.Bus.MCR.Set(bxcanMCR_INRQ | bxcanMCR_TXFP)
+
+	btr := (prescaler - 1) | (seg1-1)<<bxcanBTR_TS1_Pos | (seg2-1)<<bxcanBTR_TS2_Pos |
+		(seg2-1)<<bxcanBTR_SJW_Pos
+	switch config.Mode {
+	case CANModeLoopback:
+		btr |= bxcanBTR_LBKM | bxcanBTR_SILM
+	case CANModeListenOnly:
+		btr |= bxcanBTR_SILM
+	}
+	can.Bus.BTR.Set(btr)
+
+	can.SetFilters(nil)
+
+	// Interrupts for Transmit and Receive. The Rx FIFO interrupt is enabled
+	// by Receive when it has to wait.
+	can.Bus.IER.Set(bxcanIER_TMEIE | bxcanIER_BOFIE | bxcanIER_ERRIE)
+	can.enableInterrupt()
+
+	can.Bus.MCR.ClearBits(bxcanMCR_INRQ)
+	for can.Bus.MSR.HasBits(bxcanMSR_INAK) {
+	}
+	return nil
+}
+
+// SetFilters replaces the set of receive filters. A frame is received when it
+// matches any of the filters. All frames are received when no filters are
+// set, which is the default. Up to 14 filters can be set.
+func (can *CAN) SetFilters(filters []CANFilter) error {
+	if len(filters) > canFilterCount {
+		return ErrCANInvalidFilter
+	}
+
+	master := stm32.CAN1
+	banks := filterBanks()
+	mask := uint32(1<<canFilterCount-1) << can.filterBank
+	master.FMR.SetBits(bxcanFMR_FINIT)
+	master.FA1R.ClearBits(mask)
+	master.FM1R.ClearBits(mask)  // identifier mask mode
+	master.FS1R.SetBits(mask)    // single 32-bit filter
+	master.FFA1R.ClearBits(mask) // store in FIFO 0
+	if len(filters) == 0 {
+		// Accept all frames.
+		bank := &banks[can.filterBank]
+		bank[0].Set(0)
+		bank[1].Set(0)
+		master.FA1R.SetBits(1 << can.filterBank)
+	}
+	for i, f := range filters {
+		// The IDE bit is part of the mask, so that standard filters don't
+		// match extended frames and the other way around.
+		var id, idMask uint32
+		if f.Extended {
+			id = (f.ID&0x1fffffff)<<bxcanIR_EXID_Pos | bxcanIR_IDE
+			idMask = (f.Mask&0x1fffffff)<<bxcanIR_EXID_Pos | bxcanIR_IDE
+		} else {
+			id = (f.ID & 0x7ff) << bxcanIR_STID_Pos
+			idMask = (f.Mask&0x7ff)<<bxcanIR_STID_Pos | bxcanIR_IDE
+		}
+		n := uint32(can.filterBank) + uint32(i)
+		banks[n][0].Set(id)
+		banks[n][1].Set(idMask)
+		master.FA1R.SetBits(1 << n)
+	}
+	master.FMR.ClearBits(bxcanFMR_FINIT)
+	return nil
+}
+
+// Transmit queues a frame for transmission. It blocks while all three Tx
+// mailboxes are in use, and returns ErrCANBusOff if the controller is bus-off.
+func (can *CAN) Transmit(frame *CANFrame) error {
+	if err := frame.check(false); err != nil {
+		return err
+	}
+	for {
+		if can.Bus.ESR.HasBits(bxcanESR_BOFF) {
+			return ErrCANBusOff
+		}
+		if can.Bus.TSR.Get()&bxcanTSR_TME_Msk != 0 {
+			break
+		}
+		// Woken up when a mailbox became empty, or when the controller went
+		// bus-off.
+		can.waiters().tx.Wait()
+	}
+
+	// CODE is the number of the next empty mailbox.
+	mb := &can.txMailboxes()[(can.Bus.TSR.Get()>>bxcanTSR_CODE_Pos)&3]
+	var ir uint32
+	if frame.Extended {
+		ir = frame.ID<<bxcanIR_EXID_Pos | bxcanIR_IDE
+	} else {
+		ir = frame.ID << bxcanIR_STID_Pos
+	}
+	if frame.Remote {
+		ir |= bxcanIR_RTR
+	}
+	mb.DTR.Set(uint32(frame.Length))
+	mb.DLR.Set(uint32(frame.Data[0]) | uint32(frame.Data[1])<<8 | uint32(frame.Data[2])<<16 | uint32(frame.Data[3])<<24)
+	mb.DHR.Set(uint32(frame.Data[4]) | uint32(frame.Data[5])<<8 | uint32(frame.Data[6])<<16 | uint32(frame.Data[7])<<24)
+	mb.IR.Set(ir | bxcanIR_TXRQ)
+	return nil
+}
+
+// Receive blocks until a frame is received and copies it to frame.
+func (can *CAN) Receive(frame *CANFrame) error {
+	for can.Available() == 0 {
+		// The interrupt stays pending while the FIFO isn't empty, so
+		// canHandleRX disables it again.
+		can.Bus.IER.SetBits(bxcanIER_FMPIE0)
+		can.waiters().rx.Wait()
+	}
+
+	mb := can.rxFIFO0()
+	ir := mb.IR.Get()
+	frame.Extended = ir&bxcanIR_IDE != 0
+	if frame.Extended {
+		frame.ID = ir >> bxcanIR_EXID_Pos
+	} else {
+		frame.ID = ir >> bxcanIR_STID_Pos
+	}
+	frame.Remote = ir&bxcanIR_RTR != 0
+	frame.FD = false
+	frame.BitRateSwitch = false
+	frame.Length = CANDlcToLength(byte(mb.DTR.Get()&0xf), false)
+	dlr := mb.DLR.Get()
+	dhr := mb.DHR.Get()
+	for i := 0; i < 4; i++ {
+		frame.Data[i] = byte(dlr >> (8 * i))
+		frame.Data[4+i] = byte(dhr >> (8 * i))
+	}
+
+	// Release the FIFO output mailbox.
+	can.Bus.RF0R.SetBits(bxcanRF0R_RFOM0)
+	return nil
+}
+
+// Available returns the number of frames that can be received without
+// blocking.
+func (can *CAN) Available() int {
+	return int(can.Bus.RF0R.Get() & bxcanRF0R_FMP0_Msk)
+}
+
+// ErrorCounters returns the current error counters and bus state.
+func (can *CAN) ErrorCounters() CANErrorCounters {
+	esr := can.Bus.ESR.Get()
+	tec := (esr >> bxcanESR_TEC_Pos) & 0xff
+	rec := (esr >> bxcanESR_REC_Pos) & 0xff
+	return CANErrorCounters{
+		State:    canErrorState(esr&bxcanESR_BOFF != 0, tec, rec),
+		TxErrors: uint8(tec),
+		RxErrors: uint8(rec),
+	}
+}
+
+// Recover starts bus-off recovery. The controller reconnects after it has
+// seen 128 occurrences of 11 recessive bits on the bus.
+func (can *CAN) Recover() error {
+	if !can.Bus.ESR.HasBits(bxcanESR_BOFF) {
+		return nil
+	}
+	// Without automatic bus-off management, recovery starts when software
+	// enters and leaves initialization mode.
+	can.Bus.MCR.SetBits(bxcanMCR_INRQ)
+	for !can.Bus.MSR.HasBits(bxcanMSR_INAK) {
+	}
+	can.Bus.MCR.ClearBits(bxcanMCR_INRQ)
+	return nil
+}
+
+// waiters returns the goroutines blocked on this controller.
+func (can *CAN) waiters() *canWaiters {
+	if can.Bus == stm32.CAN1 {
+		return &canWait[0]
+	}
+	return &canWait[1]
+}
+
+// canHandleTX is called from the Tx interrupt, when a Tx mailbox became empty.
+func canHandleTX(bus *stm32.CAN_Type, w *canWaiters) {
+	bus.TSR.Set(bxcanTSR_RQCP0 | bxcanTSR_RQCP1 | bxcanTSR_RQCP2) // clear interrupt
+	w.tx.Notify()
+}
+
+// canHandleRX is called from the Rx FIFO 0 interrupt, when the FIFO holds a
+// frame.
+func canHandleRX(bus *stm32.CAN_Type, w *canWaiters) {
+	bus.IER.ClearBits(bxcanIER_FMPIE0)
+	w.rx.Notify()
+}
+
+// canHandleError is called from the status change interrupt, when the
+// controller went bus-off.
+func canHandleError(bus *stm32.CAN_Type, w *canWaiters) {
+	bus.MSR.Set(bxcanMSR_ERRI) // clear interrupt
+	w.tx.Notify()
+}
@@ -104,6 +104,7 @@ type I2CConfig struct {
 	SCL       Pin
 	SDA       Pin
 	DutyCycle uint8
+	Mode      I2CMode
 }
 
 // Configure is intended to setup the STM32 I2C interface.
@@ -154,6 +155,7 @@ func (i2c *I2C) Configure(config I2CConfig) error {
 	// enable I2C interface
 	i2c.Bus.CR1.SetBits(stm32.I2C_CR1_PE)
 
+	i2c.mode = config.Mode
 	return nil
 }
 
@@ -428,3 +430,169 @@ func (i2c *I2C) controllerRequestRead(addr uint16, option transferOption) error
 
 	return nil
 }
+
+// Listen starts listening for I2C requests sent to the specified address. The
+// I2C peripheral must have been configured in target mode.
+func (i2c *I2C) Listen(addr uint16) error {
+	if i2c.mode != I2CModeTarget {
+		return ErrI2CWrongMode
+	}
+	if addr >= 0x80 || isReservedI2CAddr(uint8(addr)) {
+		return ErrInvalidTgtAddr
+	}
+
+	// Bit 14 of OAR1 must always be kept at 1 by software.
+	i2c.Bus.OAR1.Set(1<<14 | uint32(addr)<<1)
+
+	if !i2c.enableTargetInterrupt() {
+		return errI2CNoInterrupt
+	}
+
+	// Acknowledge the address and received bytes.
+	i2c.Bus.CR1.SetBits(stm32.I2C_CR1_ACK)
+	return nil
+}
+
+// WaitForEvent blocks the current goroutine until an I2C event is received
+// (when in target mode). Other goroutines run in the meantime: the transfer is
+// handled by the I2C interrupts.
+//
+// The passed buffer will be populated for receive events, with the number of
+// bytes received returned in count. Bytes that don't fit in the buffer are
+// dropped. For other event types, buf is not modified and a count of zero is
+// returned.
+//
+// For request events, the caller MUST call Reply to avoid hanging the I2C bus
+// indefinitely.
+func (i2c *I2C) WaitForEvent(buf []byte) (evt I2CTargetEvent, count int, err error) {
+	i2c.target.start(buf, false)
+	i2c.waitTarget()
+	return i2c.target.event, i2c.target.count, i2c.target.err
+}
+
+// Reply supplies the response data to the controller, after WaitForEvent
+// returned a request event. If the controller reads more bytes than are in
+// buf, it receives 0xff for the remaining bytes.
+func (i2c *I2C) Reply(buf []byte) error {
+	if !i2c.hasFlag(flagTRA) {
+		return ErrI2CWrongMode
+	}
+
+	i2c.target.start(buf, true)
+	i2c.waitTarget()
+	return i2c.target.err
+}
+
+// The interrupts that drive the target state machine.
+const i2cTargetInterrupts = stm32.I2C_CR2_ITEVTEN | stm32.I2C_CR2_ITBUFEN | stm32.I2C_CR2_ITERREN
+
+// waitTarget enables the interrupts and parks the current goroutine until the
+// interrupt handler finishes the call.
+func (i2c *I2C) waitTarget() {
+	i2c.Bus.CR2.SetBits(i2cTargetInterrupts)
+	i2c.target.wait()
+}
+
+// finishTarget disables the interrupts and wakes up the goroutine in
+// WaitForEvent or Reply. The flags that are still set are handled by the next
+// call.
+func (i2c *I2C) finishTarget(evt I2CTargetEvent, err error) {
+	i2c.Bus.CR2.ClearBits(i2cTargetInterrupts)
+	i2c.target.finish(evt, err)
+}
+
+// handleTargetInterrupt is the handler of both the event and the error
+// interrupt in target mode.
+func (i2c *I2C) handleTargetInterrupt() {
+	if i2c.target.busy.Get() == 0 {
+		return
+	}
+	if i2c.target.reply {
+		i2c.handleReply()
+	} else {
+		i2c.handleEvent()
+	}
+}
+
+// handleEvent handles the events for WaitForEvent.
+func (i2c *I2C) handleEvent() {
+	t := &i2c.target
+
+	if i2c.hasFlag(flagBERR) || i2c.hasFlag(flagOVR) {
+		i2c.clearFlag(flagBERR | flagOVR)
+		i2c.finishTarget(I2CReceive, errI2CBusError)
+		return
+	}
+
+	// A NACK at the end of a reply, or a lost arbitration: there is nothing
+	// to report.
+	if i2c.hasFlag(flagAF) || i2c.hasFlag(flagARLO) {
+		i2c.clearFlag(flagAF | flagARLO)
+	}
+
+	for i2c.hasFlag(flagRXNE) {
+		t.receive(byte(i2c.Bus.DR.Get()))
+	}
+
+	// Stop
+	if i2c.hasFlag(flagSTOPF) {
+		i2c.clearStopFlag()
+		if t.count > 0 {
+			i2c.finishTarget(I2CReceive, nil)
+			return
+		}
+		i2c.finishTarget(I2CFinish, nil)
+		return
+	}
+
+	// Start or repeated start. The clock is stretched until the ADDR flag is
+	// cleared.
+	if i2c.hasFlag(flagADDR) {
+		if t.count > 0 {
+			// Repeated start: first report the received data, the address
+			// is handled on the next call.
+			i2c.finishTarget(I2CReceive, nil)
+			return
+		}
+		// Reading SR2 clears the ADDR flag.
+		if i2c.hasFlag(flagTRA) {
+			// The clock is stretched until Reply writes the first byte.
+			i2c.finishTarget(I2CRequest, nil)
+		}
+	}
+}
+
+// handleReply handles the events for Reply.
+func (i2c *I2C) handleReply() {
+	t := &i2c.target
+
+	if i2c.hasFlag(flagBERR) || i2c.hasFlag(flagOVR) || i2c.hasFlag(flagARLO) {
+		i2c.clearFlag(flagBERR | flagOVR | flagARLO)
+		i2c.finishTarget(I2CRequest, errI2CBusError)
+		return
+	}
+
+	// The controller doesn't want any more data, it will send a stop or a
+	// repeated start next.
+	if i2c.hasFlag(flagAF) {
+		i2c.clearFlag(flagAF)
+		i2c.finishTarget(I2CRequest, nil)
+		return
+	}
+
+	if i2c.hasFlag(flagTXE) {
+		i2c.Bus.DR.Set(uint32(t.next()))
+		return
+	}
+
+	if i2c.hasFlag(flagSTOPF) || i2c.hasFlag(flagADDR) {
+		// Handled by WaitForEvent.
+		i2c.finishTarget(I2CRequest, nil)
+	}
+}
+
+// clearStopFlag clears the STOPF flag, by reading SR1 and then writing CR1.
+func (i2c *I2C) clearStopFlag() {
+	i2c.Bus.SR1.Get()
+	i2c.Bus.CR1.Set(i2c.Bus.CR1.Get())
+}
@@ -41,12 +41,15 @@ const (
 type I2C struct {
 	Bus             *stm32.I2C_Type
 	AltFuncSelector uint8
+	mode            I2CMode
+	target          i2cTarget
 }
 
 // I2CConfig is used to store config info for I2C.
 type I2CConfig struct {
-	SCL Pin
-	SDA Pin
+	SCL  Pin
+	SDA  Pin
+	Mode I2CMode
 }
 
 func (i2c *I2C) Configure(config I2CConfig) error {
@@ -72,8 +75,14 @@ func (i2c *I2C) Configure(config I2CConfig) error {
 	// 7 bit addressing, no self address
 	i2c.Bus.OAR1.Set(stm32.I2C_OAR1_OA1EN)
 
-	// Enable the AUTOEND by default, and enable NACK (should be disable only during Slave process
-	i2c.Bus.CR2.Set(stm32.I2C_CR2_AUTOEND | stm32.I2C_CR2_NACK)
+	i2c.mode = config.Mode
+	if config.Mode == I2CModeTarget {
+		// Acknowledge received bytes, the own address is set by Listen.
+		i2c.Bus.CR2.Set(0)
+	} else {
+		// Enable the AUTOEND by default, and enable NACK (should be disable only during Slave process
+		i2c.Bus.CR2.Set(stm32.I2C_CR2_AUTOEND | stm32.I2C_CR2_NACK)
+	}
 
 	// Disable Own Address2 / Dual Addressing
 	i2c.Bus.OAR2.Set(0)
@@ -348,3 +357,170 @@ func (i2c *I2C) clearFlag(flag uint32) {
 		i2c.Bus.ICR.SetBits(flag)
 	}
 }
+
+// Listen starts listening for I2C requests sent to the specified address. The
+// I2C peripheral must have been configured in target mode.
+func (i2c *I2C) Listen(addr uint16) error {
+	if i2c.mode != I2CModeTarget {
+		return ErrI2CWrongMode
+	}
+	if addr >= 0x80 || isReservedI2CAddr(uint8(addr)) {
+		return ErrInvalidTgtAddr
+	}
+
+	// The own address can only be changed while it is disabled.
+	i2c.Bus.OAR1.ClearBits(stm32.I2C_OAR1_OA1EN)
+	i2c.Bus.OAR1.Set(stm32.I2C_OAR1_OA1EN | uint32(addr)<<1)
+
+	if !i2c.enableTargetInterrupt() {
+		return errI2CNoInterrupt
+	}
+	return nil
+}
+
+// WaitForEvent blocks the current goroutine until an I2C event is received
+// (when in target mode). Other goroutines run in the meantime: the transfer is
+// handled by the I2C interrupts.
+//
+// The passed buffer will be populated for receive events, with the number of
+// bytes received returned in count. Bytes that don't fit in the buffer are
+// dropped. For other event types, buf is not modified and a count of zero is
+// returned.
+//
+// For request events, the caller MUST call Reply to avoid hanging the I2C bus
+// indefinitely.
+func (i2c *I2C) WaitForEvent(buf []byte) (evt I2CTargetEvent, count int, err error) {
+	i2c.target.start(buf, false)
+	i2c.waitTarget(i2cTargetEventInterrupts)
+	return i2c.target.event, i2c.target.count, i2c.target.err
+}
+
+// Reply supplies the response data to the controller, after WaitForEvent
+// returned a request event. If the controller reads more bytes than are in
+// buf, it receives 0xff for the remaining bytes.
+func (i2c *I2C) Reply(buf []byte) error {
+	if !i2c.hasFlag(stm32.I2C_ISR_ADDR) || !i2c.hasFlag(stm32.I2C_ISR_DIR) {
+		return ErrI2CWrongMode
+	}
+
+	// Drop data left over from a previous reply, and acknowledge the address.
+	i2c.clearFlag(flagTXE)
+	i2c.Bus.ICR.Set(stm32.I2C_ICR_ADDRCF)
+
+	i2c.target.start(buf, true)
+	i2c.waitTarget(i2cTargetReplyInterrupts)
+	return i2c.target.err
+}
+
+// The interrupts that drive the target state machine, for WaitForEvent and
+// for Reply.
+const (
+	i2cTargetEventInterrupts = stm32.I2C_CR1_ADDRIE | stm32.I2C_CR1_RXIE | stm32.I2C_CR1_STOPIE | stm32.I2C_CR1_ERRIE
+	i2cTargetReplyInterrupts = stm32.I2C_CR1_ADDRIE | stm32.I2C_CR1_TXIE | stm32.I2C_CR1_NACKIE | stm32.I2C_CR1_STOPIE | stm32.I2C_CR1_ERRIE
+)
+
+// waitTarget enables the given interrupts and parks the current goroutine
+// until the interrupt handler finishes the call.
+func (i2c *I2C) waitTarget(interrupts uint32) {
+	i2c.Bus.CR1.SetBits(interrupts)
+	i2c.target.wait()
+}
+
+// finishTarget disables the interrupts and wakes up the goroutine in
+// WaitForEvent or Reply. The flags that are still set are handled by the next
+// call.
+func (i2c *I2C) finishTarget(evt I2CTargetEvent, err error) {
+	i2c.Bus.CR1.ClearBits(i2cTargetEventInterrupts | i2cTargetReplyInterrupts)
+	i2c.target.finish(evt, err)
+}
+
+// handleTargetInterrupt is the I2C interrupt handler in target mode.
+func (i2c *I2C) handleTargetInterrupt() {
+	if i2c.target.busy.Get() == 0 {
+		return
+	}
+	if i2c.target.reply {
+		i2c.handleReply()
+	} else {
+		i2c.handleEvent()
+	}
+}
+
+// handleEvent handles the events for WaitForEvent.
+func (i2c *I2C) handleEvent() {
+	t := &i2c.target
+	isr := i2c.Bus.ISR.Get()
+
+	if isr&(stm32.I2C_ISR_BERR|stm32.I2C_ISR_OVR) != 0 {
+		i2c.Bus.ICR.Set(stm32.I2C_ICR_BERRCF | stm32.I2C_ICR_OVRCF)
+		i2c.finishTarget(I2CReceive, errI2CBusError)
+		return
+	}
+
+	// Lost arbitration: there is nothing to report.
+	if isr&stm32.I2C_ISR_ARLO != 0 {
+		i2c.Bus.ICR.Set(stm32.I2C_ICR_ARLOCF)
+	}
+
+	if isr&flagRXNE != 0 {
+		t.receive(byte(i2c.Bus.RXDR.Get()))
+	}
+
+	// Stop
+	if isr&flagSTOPF != 0 {
+		i2c.clearFlag(flagSTOPF)
+		if t.count > 0 {
+			i2c.finishTarget(I2CReceive, nil)
+			return
+		}
+		i2c.finishTarget(I2CFinish, nil)
+		return
+	}
+
+	// Start or repeated start. The clock is stretched until the ADDR flag is
+	// cleared.
+	if isr&stm32.I2C_ISR_ADDR != 0 {
+		if t.count > 0 {
+			// Repeated start: first report the received data, the address
+			// is handled on the next call.
+			i2c.finishTarget(I2CReceive, nil)
+			return
+		}
+		if isr&stm32.I2C_ISR_DIR != 0 {
+			// The address is acknowledged in Reply.
+			i2c.finishTarget(I2CRequest, nil)
+			return
+		}
+		i2c.Bus.ICR.Set(stm32.I2C_ICR_ADDRCF)
+	}
+}
+
+// handleReply handles the events for Reply.
+func (i2c *I2C) handleReply() {
+	t := &i2c.target
+	isr := i2c.Bus.ISR.Get()
+
+	if isr&(stm32.I2C_ISR_BERR|stm32.I2C_ISR_OVR|stm32.I2C_ISR_ARLO) != 0 {
+		i2c.Bus.ICR.Set(stm32.I2C_ICR_BERRCF | stm32.I2C_ICR_OVRCF | stm32.I2C_ICR_ARLOCF)
+		i2c.finishTarget(I2CRequest, errI2CBusError)
+		return
+	}
+
+	// The controller doesn't want any more data, it will send a stop or a
+	// repeated start next.
+	if isr&flagAF != 0 {
+		i2c.Bus.ICR.Set(stm32.I2C_ICR_NACKCF)
+		i2c.finishTarget(I2CRequest, nil)
+		return
+	}
+
+	if isr&flagTXIS != 0 {
+		i2c.Bus.TXDR.Set(uint32(t.next()))
+		return
+	}
+
+	if isr&(flagSTOPF|stm32.I2C_ISR_ADDR) != 0 {
+		// Handled by WaitForEvent.
+		i2c.finishTarget(I2CRequest, nil)
+	}
+}
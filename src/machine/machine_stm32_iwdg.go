@@ -0,0 +1,106 @@
+//go:build stm32
+
+package machine
+
+import "device/stm32"
+
+// Watchdog provides access to the independent watchdog (IWDG) of the STM32.
+var Watchdog = &watchdogImpl{}
+
+const (
+	// WatchdogMaxTimeout is the maximum timeout in milliseconds (about 32s):
+	// a 12-bit counter with a divider of 256. The watchdog runs on the LSI
+	// oscillator, which is nominally 32kHz on most chips but is not accurate,
+	// so the timeouts are only approximate.
+	WatchdogMaxTimeout = (0xfff + 1) * 256 * 1000 / 32768
+)
+
+const (
+	iwdgKeyEnable = 0x5555 // enable access to PR and RLR
+	iwdgKeyReload = 0xaaaa // reload the counter
+	iwdgKeyStart  = 0xcccc // start the watchdog
+)
+
+// Reset flags in RCC_CSR. They are at the same position on all families, but
+// not always named the same.
+const (
+	rccCSRPowerOnFlag  = 1 << 27 // PORRSTF or BORRSTF
+	rccCSRPinFlag      = 1 << 26 // PINRSTF
+	rccCSRSoftwareFlag = 1 << 28 // SFTRSTF
+	rccCSRIWDGFlag     = 1 << 29 // IWDGRSTF
+	rccCSRWWDGFlag     = 1 << 30 // WWDGRSTF
+)
+
+type watchdogImpl struct {
+	config WatchdogConfig
+
+	// reset cause, read once as the flags are cleared afterwards
+	resetCause ResetCause
+
+	rlr uint16 // reload value
+	pr  uint8  // prescaler, the divider is 4<<pr
+}
+
+// Configure the watchdog. The settings are applied when the watchdog is
+// started.
+func (wd *watchdogImpl) Configure(config WatchdogConfig) error {
+	wd.config = config
+
+	// Find the smallest divider that fits the timeout in the 12-bit counter.
+	ticks := int64(config.TimeoutMillis) * 32768 / 1000 / 4
+	pr := uint8(0)
+	for ticks > 0xfff && pr < 6 {
+		pr++
+		ticks >>= 1
+	}
+	if ticks > 0xfff {
+		ticks = 0xfff
+	}
+	wd.pr = pr
+	wd.rlr = uint16(ticks)
+	return nil
+}
+
+// Start the watchdog.
+func (wd *watchdogImpl) Start() error {
+	stm32.IWDG.KR.Set(iwdgKeyStart)
+
+	stm32.IWDG.KR.Set(iwdgKeyEnable)
+	stm32.IWDG.PR.Set(uint32(wd.pr))
+	stm32.IWDG.RLR.Set(uint32(wd.rlr))
+	// Wait until the new values are used by the watchdog.
+	for stm32.IWDG.SR.Get() != 0 {
+	}
+
+	stm32.IWDG.KR.Set(iwdgKeyReload)
+	startWatchdogIdleHook(wd.config)
+	return nil
+}
+
+// Update the watchdog, indicating that the program is healthy.
+func (wd *watchdogImpl) Update() {
+	stm32.IWDG.KR.Set(iwdgKeyReload)
+}
+
+// ResetCause returns why the chip was last reset. The reset flags accumulate
+// until they are cleared, so they are read once and then cleared.
+func (wd *watchdogImpl) ResetCause() ResetCause {
+	if wd.resetCause != ResetCauseUnknown {
+		return wd.resetCause
+	}
+	csr := stm32.RCC.CSR.Get()
+	stm32.RCC.CSR.SetBits(stm32.RCC_CSR_RMVF)
+
+	// The reset pin flag is also set by internal resets, so check it last.
+	switch {
+	case csr&(rccCSRIWDGFlag|rccCSRWWDGFlag) != 0:
+		wd.resetCause = ResetCauseWatchdog
+	case csr&rccCSRSoftwareFlag != 0:
+		wd.resetCause = ResetCauseSoftware
+	case csr&rccCSRPowerOnFlag != 0:
+		wd.resetCause = ResetCausePowerOn
+	case csr&rccCSRPinFlag != 0:
+		wd.resetCause = ResetCausePin
+	}
+	return wd.resetCause
+}
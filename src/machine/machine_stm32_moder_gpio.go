@@ -36,6 +36,10 @@ const (
 
 	// for PWM
 	PinModePWMOutput PinMode = 12
+
+	// for CAN
+	PinModeCANTX PinMode = 13
+	PinModeCANRX PinMode = 14
 )
 
 // Define several bitfields that have different names across chip families but
@@ -144,6 +148,17 @@ func (p Pin) ConfigureAltFunc(config PinConfig, altFunc uint8) {
 		port.PUPDR.ReplaceBits(gpioPullFloating, gpioPullMask, pos)
 		p.SetAltFunc(altFunc)
 
+	// CAN
+	case PinModeCANTX:
+		port.MODER.ReplaceBits(gpioModeAlternate, gpioModeMask, pos)
+		port.OSPEEDR.ReplaceBits(gpioOutputSpeedHigh, gpioOutputSpeedMask, pos)
+		port.PUPDR.ReplaceBits(gpioPullFloating, gpioPullMask, pos)
+		p.SetAltFunc(altFunc)
+	case PinModeCANRX:
+		port.MODER.ReplaceBits(gpioModeAlternate, gpioModeMask, pos)
+		port.PUPDR.ReplaceBits(gpioPullUp, gpioPullMask, pos)
+		p.SetAltFunc(altFunc)
+
 	// ADC
 	case PinInputAnalog:
 		port.MODER.ReplaceBits(gpioModeAnalog, gpioModeMask, pos)
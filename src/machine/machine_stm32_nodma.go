@@ -0,0 +1,7 @@
+//go:build stm32 && !stm32f4
+
+package machine
+
+// Asynchronous transfers are only implemented on the STM32F4, so on other
+// series the blocking UART methods have nothing to wait for.
+func (uart *UART) waitAsync() {}
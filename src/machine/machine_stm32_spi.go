@@ -97,6 +97,7 @@ func (spi SPI) Configure(config SPIConfig) {
 
 // Transfer writes/reads a single byte using the SPI interface.
 func (spi SPI) Transfer(w byte) (byte, error) {
+	spi.waitAsync()
 
 	// 1. Enable the SPI by setting the SPE bit to 1.
 	// 2. Write the first data item to be transmitted into the SPI_DR register
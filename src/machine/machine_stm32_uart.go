@@ -24,10 +24,30 @@ type UART struct {
 	txReg       *volatile.Register32
 	statusReg   *volatile.Register32
 	txEmptyFlag uint32
+
+	// errorClearReg clears the receive error flags, on chips where reading
+	// the data register doesn't.
+	errorClearReg *volatile.Register32
+
+	uartState
 }
 
+// Bits in the status register (SR or ISR), the error clear register (ICR) and
+// CR1, which are the same for all families.
+const (
+	uartSR_PE   = 1 << 0
+	uartSR_FE   = 1 << 1
+	uartSR_NE   = 1 << 2
+	uartSR_ORE  = 1 << 3
+	uartSR_RXNE = 1 << 5
+
+	uartCR1_TXEIE = 1 << 7
+)
+
 // Configure the UART.
 func (uart *UART) Configure(config UARTConfig) {
+	uart.configureBuffers(config, true)
+
 	// Default baud rate to 115200.
 	if config.BaudRate == 0 {
 		config.BaudRate = 115200
@@ -63,7 +83,30 @@ func (uart *UART) Configure(config UARTConfig) {
 // handleInterrupt should be called from the appropriate interrupt handler for
 // this UART instance.
 func (uart *UART) handleInterrupt(interrupt.Interrupt) {
-	uart.Receive(byte((uart.rxReg.Get() & 0xFF)))
+	status := uart.statusReg.Get()
+	if status&(uartSR_PE|uartSR_FE|uartSR_NE|uartSR_ORE) != 0 {
+		var errs UARTError
+		if status&uartSR_ORE != 0 {
+			errs |= ErrUARTOverrun
+		}
+		if status&uartSR_FE != 0 {
+			errs |= ErrUARTFraming
+		}
+		if status&uartSR_PE != 0 {
+			errs |= ErrUARTParity
+		}
+		uart.receiveError(errs)
+		if uart.errorClearReg != nil {
+			uart.errorClearReg.Set(status & (uartSR_PE | uartSR_FE | uartSR_NE | uartSR_ORE))
+		}
+		// Otherwise, reading the data register clears the flags.
+	}
+	if status&uartSR_RXNE != 0 {
+		uart.Receive(byte((uart.rxReg.Get() & 0xFF)))
+	}
+	if uart.Bus.CR1.HasBits(uartCR1_TXEIE) {
+		uart.handleTXInterrupt()
+	}
 }
 
 // SetBaudRate sets the communication speed for the UART. Defer to chip-specific
@@ -75,9 +118,31 @@ func (uart *UART) SetBaudRate(br uint32) {
 
 // WriteByte writes a byte of data to the UART.
 func (uart *UART) WriteByte(c byte) error {
+	uart.waitAsync()
+	if uart.txRing != nil {
+		uart.writeBuffered(c)
+		return nil
+	}
+
 	uart.txReg.Set(uint32(c))
 
 	for !uart.statusReg.HasBits(uart.txEmptyFlag) {
 	}
 	return nil
 }
+
+func (uart *UART) txReady() bool {
+	return uart.statusReg.HasBits(uart.txEmptyFlag)
+}
+
+func (uart *UART) txWrite(c byte) {
+	uart.txReg.Set(uint32(c))
+}
+
+func (uart *UART) setTXInterrupt(enable bool) {
+	if enable {
+		uart.Bus.CR1.SetBits(uartCR1_TXEIE)
+	} else {
+		uart.Bus.CR1.ClearBits(uartCR1_TXEIE)
+	}
+}
@@ -374,7 +374,9 @@ func (spi SPI) configurePins(config SPIConfig) {
 // TODO: implement I2C2.
 
 type I2C struct {
-	Bus *stm32.I2C_Type
+	Bus    *stm32.I2C_Type
+	mode   I2CMode
+	target i2cTarget
 }
 
 var (
@@ -382,6 +384,37 @@ var (
 	I2C0 = I2C1
 )
 
+// i2cTargets are the I2C peripherals in target mode, for the interrupt
+// handlers.
+var i2cTargets [2]*I2C
+
+// enableTargetInterrupt registers the event and error interrupt handlers of
+// this I2C peripheral and enables them. It returns false if the peripheral is
+// not supported.
+func (i2c *I2C) enableTargetInterrupt() bool {
+	switch i2c.Bus {
+	case stm32.I2C1:
+		i2cTargets[0] = i2c
+		interrupt.New(stm32.IRQ_I2C1_EV, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+		interrupt.New(stm32.IRQ_I2C1_ER, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+	case stm32.I2C2:
+		i2cTargets[1] = i2c
+		interrupt.New(stm32.IRQ_I2C2_EV, func(interrupt.Interrupt) {
+			i2cTargets[1].handleTargetInterrupt()
+		}).Enable()
+		interrupt.New(stm32.IRQ_I2C2_ER, func(interrupt.Interrupt) {
+			i2cTargets[1].handleTargetInterrupt()
+		}).Enable()
+	default:
+		return false
+	}
+	return true
+}
+
 func (i2c *I2C) configurePins(config I2CConfig) {
 	if config.SDA == PB9 {
 		// use alternate I2C1 pins PB8/PB9 via AFIO mapping
@@ -721,6 +721,47 @@ func (spi SPI) getBaudRate(config SPIConfig) uint32 {
 type I2C struct {
 	Bus             *stm32.I2C_Type
 	AltFuncSelector uint8
+	mode            I2CMode
+	target          i2cTarget
+}
+
+// i2cTargets are the I2C peripherals in target mode, for the interrupt
+// handlers.
+var i2cTargets [3]*I2C
+
+// enableTargetInterrupt registers the event and error interrupt handlers of
+// this I2C peripheral and enables them. It returns false if the peripheral is
+// not supported.
+func (i2c *I2C) enableTargetInterrupt() bool {
+	switch i2c.Bus {
+	case stm32.I2C1:
+		i2cTargets[0] = i2c
+		interrupt.New(stm32.IRQ_I2C1_EV, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+		interrupt.New(stm32.IRQ_I2C1_ER, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+	case stm32.I2C2:
+		i2cTargets[1] = i2c
+		interrupt.New(stm32.IRQ_I2C2_EV, func(interrupt.Interrupt) {
+			i2cTargets[1].handleTargetInterrupt()
+		}).Enable()
+		interrupt.New(stm32.IRQ_I2C2_ER, func(interrupt.Interrupt) {
+			i2cTargets[1].handleTargetInterrupt()
+		}).Enable()
+	case stm32.I2C3:
+		i2cTargets[2] = i2c
+		interrupt.New(stm32.IRQ_I2C3_EV, func(interrupt.Interrupt) {
+			i2cTargets[2].handleTargetInterrupt()
+		}).Enable()
+		interrupt.New(stm32.IRQ_I2C3_ER, func(interrupt.Interrupt) {
+			i2cTargets[2].handleTargetInterrupt()
+		}).Enable()
+	default:
+		return false
+	}
+	return true
 }
 
 func (i2c *I2C) configurePins(config I2CConfig) {
@@ -794,6 +835,40 @@ func (i2c *I2C) getSpeed(config I2CConfig) uint32 {
 	}
 }
 
+//---------- CAN related code
+
+var (
+	CAN1 = CAN{Bus: stm32.CAN1, AltFuncSelector: AF9_CAN1_CAN2_TIM12_13_14}
+	CAN2 = CAN{Bus: stm32.CAN2, AltFuncSelector: AF9_CAN1_CAN2_TIM12_13_14, filterBank: 14}
+)
+
+// enableInterrupt registers the interrupt handlers of this CAN controller and
+// enables them.
+func (can *CAN) enableInterrupt() {
+	switch can.Bus {
+	case stm32.CAN1:
+		interrupt.New(stm32.IRQ_CAN1_TX, func(interrupt.Interrupt) {
+			canHandleTX(stm32.CAN1, &canWait[0])
+		}).Enable()
+		interrupt.New(stm32.IRQ_CAN1_RX0, func(interrupt.Interrupt) {
+			canHandleRX(stm32.CAN1, &canWait[0])
+		}).Enable()
+		interrupt.New(stm32.IRQ_CAN1_SCE, func(interrupt.Interrupt) {
+			canHandleError(stm32.CAN1, &canWait[0])
+		}).Enable()
+	case stm32.CAN2:
+		interrupt.New(stm32.IRQ_CAN2_TX, func(interrupt.Interrupt) {
+			canHandleTX(stm32.CAN2, &canWait[1])
+		}).Enable()
+		interrupt.New(stm32.IRQ_CAN2_RX0, func(interrupt.Interrupt) {
+			canHandleRX(stm32.CAN2, &canWait[1])
+		}).Enable()
+		interrupt.New(stm32.IRQ_CAN2_SCE, func(interrupt.Interrupt) {
+			canHandleError(stm32.CAN2, &canWait[1])
+		}).Enable()
+	}
+}
+
 //---------- Flash related code
 
 // the block size actually depends on the sector.
@@ -0,0 +1,391 @@
+//go:build stm32f4
+
+package machine
+
+import (
+	"device/stm32"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// DMATrigger selects the DMA controller, stream and channel that are
+// connected to the request of a peripheral. Requests are hardwired to a
+// stream, so every stream can only be used by one peripheral at a time. See
+// the DMA request mapping in the reference manual for the available
+// combinations.
+type DMATrigger uint8
+
+// A trigger is encoded as the controller (0 for DMA1, 1 for DMA2) in bit 6, the
+// stream in bits 3-5 and the channel in bits 0-2.
+const dmaTriggerDMA2 = 1 << 6
+
+// DMA triggers of common peripherals.
+const (
+	DMATriggerSPI1TX   DMATrigger = dmaTriggerDMA2 | 3<<3 | 3
+	DMATriggerSPI1RX   DMATrigger = dmaTriggerDMA2 | 0<<3 | 3
+	DMATriggerSPI2TX   DMATrigger = 4<<3 | 0
+	DMATriggerSPI2RX   DMATrigger = 3<<3 | 0
+	DMATriggerSPI3TX   DMATrigger = 5<<3 | 0
+	DMATriggerSPI3RX   DMATrigger = 0<<3 | 0
+	DMATriggerUSART1TX DMATrigger = dmaTriggerDMA2 | 7<<3 | 4
+	DMATriggerUSART1RX DMATrigger = dmaTriggerDMA2 | 2<<3 | 4
+	DMATriggerUSART2TX DMATrigger = 6<<3 | 4
+	DMATriggerUSART2RX DMATrigger = 5<<3 | 4
+	DMATriggerUSART3TX DMATrigger = 3<<3 | 4
+	DMATriggerUSART3RX DMATrigger = 1<<3 | 4
+	DMATriggerUART4TX  DMATrigger = 4<<3 | 4
+	DMATriggerUART4RX  DMATrigger = 2<<3 | 4
+	DMATriggerUART5TX  DMATrigger = 7<<3 | 4
+	DMATriggerUART5RX  DMATrigger = 0<<3 | 4
+	DMATriggerUSART6TX DMATrigger = dmaTriggerDMA2 | 6<<3 | 5
+	DMATriggerUSART6RX DMATrigger = dmaTriggerDMA2 | 1<<3 | 5
+	DMATriggerADC1     DMATrigger = dmaTriggerDMA2 | 0<<3 | 0
+)
+
+// DMATriggerNone transfers as fast as possible. Only the streams of DMA2 can
+// do memory-to-memory transfers, ClaimDMAChannel picks a free one.
+const DMATriggerNone DMATrigger = 0xff
+
+// Maximum number of transfer units of a single transfer.
+const dmaMaxCount = 0xffff
+
+// dmaStream is the register block of a DMA stream.
+type dmaStream struct {
+	CR   volatile.Register32
+	NDTR volatile.Register32
+	PAR  volatile.Register32
+	M0AR volatile.Register32
+	M1AR volatile.Register32
+	FCR  volatile.Register32
+}
+
+// Register bits, as described in the reference manual.
+const (
+	dmaSxCR_EN        = 1 << 0
+	dmaSxCR_TEIE      = 1 << 2
+	dmaSxCR_TCIE      = 1 << 4
+	dmaSxCR_DIR_Pos   = 6
+	dmaSxCR_PINC      = 1 << 9
+	dmaSxCR_MINC      = 1 << 10
+	dmaSxCR_PSIZE_Pos = 11
+	dmaSxCR_MSIZE_Pos = 13
+	dmaSxCR_CHSEL_Pos = 25
+
+	dmaDIR_PeripheralToMemory = 0
+	dmaDIR_MemoryToPeripheral = 1
+	dmaDIR_MemoryToMemory     = 2
+
+	// Flags of a stream in the ISR and IFCR registers.
+	dmaFlagTEIF = 1 << 3
+	dmaFlagTCIF = 1 << 5
+	dmaFlagsAll = 0x3d
+)
+
+// DMAChannel is a stream of one of the two DMA controllers.
+type DMAChannel struct {
+	dmaState
+	index   uint8 // stream number, plus 8 for DMA2
+	channel uint8 // request channel of the stream
+}
+
+var dmaChannelStates [16]DMAChannel
+
+// ClaimDMAChannel returns the DMA stream connected to the given trigger. It
+// returns ErrDMANoChannel if the stream is already in use.
+func ClaimDMAChannel(trigger DMATrigger) (*DMAChannel, error) {
+	mask := interrupt.Disable()
+	defer interrupt.Restore(mask)
+	if trigger == DMATriggerNone {
+		for i := 8; i < len(dmaChannelStates); i++ {
+			if !dmaChannelStates[i].claimed {
+				return reservedDMAChannel(DMATrigger(i << 3)), nil
+			}
+		}
+		return nil, ErrDMANoChannel
+	}
+	if trigger >= 1<<7 {
+		return nil, ErrDMAInvalid
+	}
+	if dmaChannelStates[trigger>>3].claimed {
+		return nil, ErrDMANoChannel
+	}
+	return reservedDMAChannel(trigger), nil
+}
+
+// reservedDMAChannel returns the DMA stream connected to the given trigger,
+// which is statically assigned to a peripheral.
+func reservedDMAChannel(trigger DMATrigger) *DMAChannel {
+	ch := &dmaChannelStates[trigger>>3]
+	if !ch.claimed {
+		ch.claimed = true
+		ch.index = uint8(trigger >> 3)
+		ch.channel = uint8(trigger & 7)
+		if ch.index < 8 {
+			stm32.RCC.AHB1ENR.SetBits(stm32.RCC_AHB1ENR_DMA1EN)
+		} else {
+			stm32.RCC.AHB1ENR.SetBits(stm32.RCC_AHB1ENR_DMA2EN)
+		}
+		enableDMAInterrupt(ch.index)
+	}
+	return ch
+}
+
+// enableDMAInterrupt enables the interrupt of the given stream.
+func enableDMAInterrupt(index uint8) {
+	switch index {
+	case 0:
+		interrupt.New(stm32.IRQ_DMA1_Stream0, handleDMAInterrupt).Enable()
+	case 1:
+		interrupt.New(stm32.IRQ_DMA1_Stream1, handleDMAInterrupt).Enable()
+	case 2:
+		interrupt.New(stm32.IRQ_DMA1_Stream2, handleDMAInterrupt).Enable()
+	case 3:
+		interrupt.New(stm32.IRQ_DMA1_Stream3, handleDMAInterrupt).Enable()
+	case 4:
+		interrupt.New(stm32.IRQ_DMA1_Stream4, handleDMAInterrupt).Enable()
+	case 5:
+		interrupt.New(stm32.IRQ_DMA1_Stream5, handleDMAInterrupt).Enable()
+	case 6:
+		interrupt.New(stm32.IRQ_DMA1_Stream6, handleDMAInterrupt).Enable()
+	case 7:
+		interrupt.New(stm32.IRQ_DMA1_Stream7, handleDMAInterrupt).Enable()
+	case 8:
+		interrupt.New(stm32.IRQ_DMA2_Stream0, handleDMAInterrupt).Enable()
+	case 9:
+		interrupt.New(stm32.IRQ_DMA2_Stream1, handleDMAInterrupt).Enable()
+	case 10:
+		interrupt.New(stm32.IRQ_DMA2_Stream2, handleDMAInterrupt).Enable()
+	case 11:
+		interrupt.New(stm32.IRQ_DMA2_Stream3, handleDMAInterrupt).Enable()
+	case 12:
+		interrupt.New(stm32.IRQ_DMA2_Stream4, handleDMAInterrupt).Enable()
+	case 13:
+		interrupt.New(stm32.IRQ_DMA2_Stream5, handleDMAInterrupt).Enable()
+	case 14:
+		interrupt.New(stm32.IRQ_DMA2_Stream6, handleDMAInterrupt).Enable()
+	case 15:
+		interrupt.New(stm32.IRQ_DMA2_Stream7, handleDMAInterrupt).Enable()
+	}
+}
+
+func handleDMAInterrupt(interrupt.Interrupt) {
+	for i := range dmaChannelStates {
+		ch := &dmaChannelStates[i]
+		if !ch.claimed {
+			continue
+		}
+		isr, ifcr, shift := ch.flagRegisters()
+		flags := (isr.Get() >> shift) & dmaFlagsAll
+		if flags == 0 {
+			continue
+		}
+		ifcr.Set(flags << shift) // clear interrupts
+		if flags&dmaFlagTEIF != 0 {
+			// Transfer error: the stream has been disabled by the hardware.
+			ch.stopped()
+		} else if flags&dmaFlagTCIF != 0 {
+			ch.complete()
+		}
+	}
+}
+
+// controller returns the DMA controller of this stream.
+func (ch *DMAChannel) controller() *stm32.DMA_Type {
+	if ch.index < 8 {
+		return stm32.DMA1
+	}
+	return stm32.DMA2
+}
+
+// stream returns the registers of this stream.
+func (ch *DMAChannel) stream() *dmaStream {
+	streams := (*[8]dmaStream)(unsafe.Pointer(&ch.controller().S0CR))
+	return &streams[ch.index%8]
+}
+
+// flagRegisters returns the interrupt status and flag clear registers of this
+// stream, and the position of its flags in these registers.
+func (ch *DMAChannel) flagRegisters() (isr, ifcr *volatile.Register32, shift uint32) {
+	dma := ch.controller()
+	stream := ch.index % 8
+	isr, ifcr = &dma.LISR, &dma.LIFCR
+	if stream >= 4 {
+		isr, ifcr = &dma.HISR, &dma.HIFCR
+	}
+	// The flags of streams 0-3 (and 4-7) are at bit 0, 6, 16 and 22.
+	shift = uint32(stream%4)*6 + uint32(stream%4/2)*4
+	return
+}
+
+// start configures the stream for the given transfer and starts it.
+func (ch *DMAChannel) start(t *DMATransfer) {
+	var size uint32
+	switch t.Size {
+	case DMASize16:
+		size = 1
+	case DMASize32:
+		size = 2
+	}
+	cr := uint32(ch.channel)<<dmaSxCR_CHSEL_Pos | size<<dmaSxCR_PSIZE_Pos | size<<dmaSxCR_MSIZE_Pos |
+		dmaSxCR_TCIE | dmaSxCR_TEIE
+	// The peripheral address register is the source in peripheral-to-memory
+	// and memory-to-memory mode.
+	par, mar := t.Dst, t.Src
+	switch t.Direction {
+	case DMAMemoryToMemory:
+		cr |= dmaDIR_MemoryToMemory<<dmaSxCR_DIR_Pos | dmaSxCR_PINC | dmaSxCR_MINC
+		par, mar = t.Src, t.Dst
+	case DMAMemoryToPeripheral:
+		cr |= dmaDIR_MemoryToPeripheral<<dmaSxCR_DIR_Pos | dmaSxCR_MINC
+	case DMAPeripheralToMemory:
+		cr |= dmaDIR_PeripheralToMemory<<dmaSxCR_DIR_Pos | dmaSxCR_MINC
+		par, mar = t.Src, t.Dst
+	}
+
+	_, ifcr, shift := ch.flagRegisters()
+	ifcr.Set(dmaFlagsAll << shift)
+	s := ch.stream()
+	s.CR.Set(cr)
+	s.NDTR.Set(t.Count)
+	s.PAR.Set(uint32(uintptr(par)))
+	s.M0AR.Set(uint32(uintptr(mar)))
+	s.FCR.Set(0) // direct mode
+	s.CR.SetBits(dmaSxCR_EN)
+}
+
+// Abort stops the current transfer. Chained transfers are not started.
+func (ch *DMAChannel) Abort() {
+	mask := interrupt.Disable()
+	s := ch.stream()
+	s.CR.ClearBits(dmaSxCR_EN)
+	for s.CR.HasBits(dmaSxCR_EN) {
+	}
+	_, ifcr, shift := ch.flagRegisters()
+	ifcr.Set(dmaFlagsAll << shift)
+	ch.stopped()
+	interrupt.Restore(mask)
+}
+
+// The DMA transfers started by SPI.TxAsync and UART.WriteAsync, one for each
+// stream. The source address is cleared by WaitAsync.
+var dmaStreamTransfers [16]DMATransfer
+
+// startTxDMA starts writing data to the given data register, using the stream
+// connected to the given trigger.
+func startTxDMA(trigger DMATrigger, data []byte, reg unsafe.Pointer) error {
+	t := &dmaStreamTransfers[trigger>>3]
+	*t = DMATransfer{
+		Direction: DMAMemoryToPeripheral,
+		Size:      DMASize8,
+		Src:       unsafe.Pointer(&data[0]),
+		Dst:       reg,
+		Count:     uint32(len(data)),
+	}
+	return reservedDMAChannel(trigger).Start(t)
+}
+
+// waitTxDMA waits until the transfer started by startTxDMA has completed. It
+// returns false if no transfer was started.
+func waitTxDMA(trigger DMATrigger) bool {
+	t := &dmaStreamTransfers[trigger>>3]
+	if t.Src == nil {
+		return false
+	}
+	dmaChannelStates[trigger>>3].Wait()
+	t.Src = nil
+	return true
+}
+
+// txDMATrigger returns the DMA trigger of the Tx of this SPI peripheral.
+func (spi SPI) txDMATrigger() DMATrigger {
+	switch spi.Bus {
+	case stm32.SPI2:
+		return DMATriggerSPI2TX
+	case stm32.SPI3:
+		return DMATriggerSPI3TX
+	default:
+		return DMATriggerSPI1TX
+	}
+}
+
+// TxAsync starts writing w using DMA, ignoring Rx, and returns without waiting
+// for the transfer to complete. Transfers are limited to 65535 bytes. The
+// buffer must not be modified until WaitAsync returns. Other SPI methods wait
+// for the transfer to complete before they start.
+func (spi SPI) TxAsync(w []byte) error {
+	spi.WaitAsync()
+	if len(w) == 0 {
+		return nil
+	}
+	spi.Bus.CR2.SetBits(stm32.SPI_CR2_TXDMAEN)
+	return startTxDMA(spi.txDMATrigger(), w, unsafe.Pointer(&spi.Bus.DR))
+}
+
+// WaitAsync blocks until the transfer started by TxAsync has completed. Other
+// goroutines can run in the meantime.
+func (spi SPI) WaitAsync() {
+	if !waitTxDMA(spi.txDMATrigger()) {
+		return
+	}
+	spi.Bus.CR2.ClearBits(stm32.SPI_CR2_TXDMAEN)
+	for !spi.Bus.SR.HasBits(stm32.SPI_SR_TXE) {
+	}
+	for spi.Bus.SR.HasBits(stm32.SPI_SR_BSY) {
+	}
+
+	// The received bytes were not read. Reading DR and then SR clears the
+	// overrun flag.
+	spi.Bus.DR.Get()
+	spi.Bus.SR.Get()
+}
+
+// waitAsync is called by the blocking SPI methods before they start.
+func (spi SPI) waitAsync() {
+	spi.WaitAsync()
+}
+
+// txDMATrigger returns the DMA trigger of the Tx of this UART.
+func (uart *UART) txDMATrigger() DMATrigger {
+	switch uart.Bus {
+	case stm32.USART2:
+		return DMATriggerUSART2TX
+	case stm32.USART3:
+		return DMATriggerUSART3TX
+	case stm32.UART4:
+		return DMATriggerUART4TX
+	case stm32.UART5:
+		return DMATriggerUART5TX
+	case stm32.USART6:
+		return DMATriggerUSART6TX
+	default:
+		return DMATriggerUSART1TX
+	}
+}
+
+// WriteAsync starts writing data using DMA and returns without waiting for the
+// transfer to complete. Transfers are limited to 65535 bytes. The buffer must
+// not be modified until WaitAsync returns. WriteByte and Write wait for the
+// transfer to complete before they start.
+func (uart *UART) WriteAsync(data []byte) error {
+	uart.WaitAsync()
+	uart.flushTX()
+	if len(data) == 0 {
+		return nil
+	}
+	uart.Bus.CR3.SetBits(stm32.USART_CR3_DMAT)
+	return startTxDMA(uart.txDMATrigger(), data, unsafe.Pointer(&uart.Bus.DR))
+}
+
+// WaitAsync blocks until the transfer started by WriteAsync has completed.
+// Other goroutines can run in the meantime.
+func (uart *UART) WaitAsync() {
+	if waitTxDMA(uart.txDMATrigger()) {
+		uart.Bus.CR3.ClearBits(stm32.USART_CR3_DMAT)
+	}
+}
+
+// waitAsync is called by the blocking UART methods before they start.
+func (uart *UART) waitAsync() {
+	uart.WaitAsync()
+}
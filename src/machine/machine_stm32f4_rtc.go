@@ -0,0 +1,198 @@
+//go:build stm32f4
+
+package machine
+
+import (
+	"device/stm32"
+	"runtime/interrupt"
+	"time"
+	"unsafe"
+)
+
+type rtcType stm32.RTC_Type
+
+// RTC is the real-time clock. It runs from the LSE crystal if there is one,
+// and from the (much less accurate) LSI oscillator otherwise. The clock is in
+// the backup domain, so it keeps running across resets. This is the only STM32
+// family with an RTC implementation so far.
+var RTC = (*rtcType)(unsafe.Pointer(stm32.RTC))
+
+const (
+	rtcMinTime = 946684800  // 2000-01-01 00:00:00
+	rtcMaxTime = 4102444799 // 2099-12-31 23:59:59
+)
+
+// Bits in the RTC and RCC registers.
+const (
+	rtcISR_ALRAWF = 1 << 0
+	rtcISR_INITS  = 1 << 4
+	rtcISR_RSF    = 1 << 5
+	rtcISR_INITF  = 1 << 6
+	rtcISR_INIT   = 1 << 7
+	rtcISR_ALRAF  = 1 << 8
+
+	rtcCR_ALRAE  = 1 << 8
+	rtcCR_ALRAIE = 1 << 12
+
+	rccBDCR_LSEON      = 1 << 0
+	rccBDCR_LSERDY     = 1 << 1
+	rccBDCR_RTCSEL_LSE = 1 << 8
+	rccBDCR_RTCSEL_LSI = 2 << 8
+	rccBDCR_RTCSEL_Msk = 3 << 8
+	rccBDCR_RTCEN      = 1 << 15
+
+	rccCSR_LSION  = 1 << 0
+	rccCSR_LSIRDY = 1 << 1
+
+	pwrCR_DBP = 1 << 8
+
+	// The RTC alarm is connected to EXTI line 17.
+	rtcAlarmEXTILine = 1 << 17
+)
+
+func (rtc *rtcType) start() {
+	// Allow writes to the backup domain.
+	stm32.RCC.APB1ENR.SetBits(stm32.RCC_APB1ENR_PWREN)
+	stm32.PWR.CR.SetBits(pwrCR_DBP)
+
+	if !stm32.RCC.BDCR.HasBits(rccBDCR_RTCEN) {
+		// Use the LSE crystal if it starts within a second, the LSI otherwise.
+		clock := uint32(rccBDCR_RTCSEL_LSI)
+		stm32.RCC.BDCR.SetBits(rccBDCR_LSEON)
+		for start := time.Now(); time.Since(start) < time.Second; {
+			if stm32.RCC.BDCR.HasBits(rccBDCR_LSERDY) {
+				clock = rccBDCR_RTCSEL_LSE
+				break
+			}
+		}
+		if clock == rccBDCR_RTCSEL_LSI {
+			stm32.RCC.BDCR.ClearBits(rccBDCR_LSEON)
+			stm32.RCC.CSR.SetBits(rccCSR_LSION)
+			for !stm32.RCC.CSR.HasBits(rccCSR_LSIRDY) {
+			}
+		}
+		stm32.RCC.BDCR.ReplaceBits(clock, rccBDCR_RTCSEL_Msk, 0)
+		stm32.RCC.BDCR.SetBits(rccBDCR_RTCEN)
+	}
+
+	if !rtc.ISR.HasBits(rtcISR_INITS) {
+		// The calendar has never been initialized, start it at 2000-01-01.
+		rtc.setUnix(rtcMinTime)
+	}
+}
+
+func (rtc *rtcType) valid() bool {
+	// INITS is set once the year is not 2000 anymore, which it is at reset.
+	return rtcTimeSet || (stm32.RCC.BDCR.HasBits(rccBDCR_RTCEN) && rtc.ISR.HasBits(rtcISR_INITS))
+}
+
+func (rtc *rtcType) setUnix(sec int64) {
+	t := time.Unix(sec, 0).UTC()
+	weekday := uint32(t.Weekday())
+	if weekday == 0 {
+		weekday = 7 // Sunday
+	}
+
+	rtc.unlock()
+	rtc.ISR.SetBits(rtcISR_INIT)
+	for !rtc.ISR.HasBits(rtcISR_INITF) {
+	}
+
+	// Divide the 32.768kHz LSE or the 32kHz LSI down to 1Hz.
+	prediv := uint32(255)
+	if stm32.RCC.BDCR.Get()&rccBDCR_RTCSEL_Msk == rccBDCR_RTCSEL_LSI {
+		prediv = 249
+	}
+	rtc.PRER.Set(prediv)
+	rtc.PRER.Set(127<<16 | prediv)
+
+	rtc.TR.Set(rtcTimeBCD(t))
+	rtc.DR.Set(toBCD(uint32(t.Year()-2000))<<16 | weekday<<13 |
+		toBCD(uint32(t.Month()))<<8 | toBCD(uint32(t.Day())))
+
+	// Leave init mode, and wait until the shadow registers have been updated.
+	rtc.ISR.ClearBits(rtcISR_INIT | rtcISR_RSF)
+	rtc.lock()
+	for !rtc.ISR.HasBits(rtcISR_RSF) {
+	}
+}
+
+func (rtc *rtcType) now() time.Time {
+	// Reading TR locks the shadow registers until DR is read.
+	tr := rtc.TR.Get()
+	dr := rtc.DR.Get()
+	return time.Date(
+		2000+int(fromBCD(dr>>16&0xff)),
+		time.Month(fromBCD(dr>>8&0x1f)),
+		int(fromBCD(dr&0x3f)),
+		int(fromBCD(tr>>16&0x3f)),
+		int(fromBCD(tr>>8&0x7f)),
+		int(fromBCD(tr&0x7f)),
+		0, time.UTC)
+}
+
+func (rtc *rtcType) armAlarm(sec int64) {
+	if now := rtc.now().Unix(); sec <= now {
+		// The alarm only fires on an exact match.
+		sec = now + 1
+	}
+	t := time.Unix(sec, 0).UTC()
+
+	rtc.unlock()
+	rtc.CR.ClearBits(rtcCR_ALRAE | rtcCR_ALRAIE)
+	for !rtc.ISR.HasBits(rtcISR_ALRAWF) {
+	}
+	// Match on the day of the month and the time of day.
+	rtc.ALRMAR.Set(toBCD(uint32(t.Day()))<<24 | rtcTimeBCD(t))
+	rtc.ISR.ClearBits(rtcISR_ALRAF)
+	rtc.CR.SetBits(rtcCR_ALRAE | rtcCR_ALRAIE)
+	rtc.lock()
+
+	stm32.EXTI.PR.Set(rtcAlarmEXTILine)
+	stm32.EXTI.RTSR.SetBits(rtcAlarmEXTILine)
+	stm32.EXTI.IMR.SetBits(rtcAlarmEXTILine)
+	interrupt.New(stm32.IRQ_RTC_Alarm, rtcHandleInterrupt).Enable()
+}
+
+func (rtc *rtcType) disarmAlarm() {
+	rtc.unlock()
+	rtc.CR.ClearBits(rtcCR_ALRAE | rtcCR_ALRAIE)
+	rtc.lock()
+}
+
+// unlock disables the write protection of the RTC registers.
+func (rtc *rtcType) unlock() {
+	rtc.WPR.Set(0xca)
+	rtc.WPR.Set(0x53)
+}
+
+// lock enables the write protection of the RTC registers again.
+func (rtc *rtcType) lock() {
+	rtc.WPR.Set(0xff)
+}
+
+func rtcHandleInterrupt(interrupt.Interrupt) {
+	RTC.ISR.ClearBits(rtcISR_ALRAF)
+	stm32.EXTI.PR.Set(rtcAlarmEXTILine)
+
+	if RTC.now().Unix() < rtcAlarmTime {
+		// The alarm matched the day of an earlier month, it matches again
+		// next month.
+		return
+	}
+	RTC.disarmAlarm()
+	rtcHandleAlarm()
+}
+
+// rtcTimeBCD returns the time of day in the format of the TR register.
+func rtcTimeBCD(t time.Time) uint32 {
+	return toBCD(uint32(t.Hour()))<<16 | toBCD(uint32(t.Minute()))<<8 | toBCD(uint32(t.Second()))
+}
+
+func toBCD(v uint32) uint32 {
+	return v/10<<4 | v%10
+}
+
+func fromBCD(v uint32) uint32 {
+	return v>>4*10 + v&0xf
+}
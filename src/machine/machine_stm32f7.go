@@ -721,3 +721,43 @@ func initRNG() {
 	stm32.RCC.AHB2ENR.SetBits(stm32.RCC_AHB2ENR_RNGEN)
 	stm32.RNG.CR.SetBits(stm32.RNG_CR_RNGEN)
 }
+
+var CAN1 = CAN{Bus: stm32.CAN1, AltFuncSelector: AF9_CAN1_TIM12_13_14_QUADSPI_FMC_OTG2_HS}
+
+// enableInterrupt registers the interrupt handlers of CAN1 and enables them.
+func (can *CAN) enableInterrupt() {
+	interrupt.New(stm32.IRQ_CAN1_TX, func(interrupt.Interrupt) {
+		canHandleTX(stm32.CAN1, &canWait[0])
+	}).Enable()
+	interrupt.New(stm32.IRQ_CAN1_RX0, func(interrupt.Interrupt) {
+		canHandleRX(stm32.CAN1, &canWait[0])
+	}).Enable()
+	interrupt.New(stm32.IRQ_CAN1_SCE, func(interrupt.Interrupt) {
+		canHandleError(stm32.CAN1, &canWait[0])
+	}).Enable()
+}
+
+//---------- I2C target related code
+
+// i2cTargets are the I2C peripherals in target mode, for the interrupt
+// handlers.
+var i2cTargets [1]*I2C
+
+// enableTargetInterrupt registers the event and error interrupt handlers of
+// this I2C peripheral and enables them. It returns false if the peripheral is
+// not supported.
+func (i2c *I2C) enableTargetInterrupt() bool {
+	switch i2c.Bus {
+	case stm32.I2C1:
+		i2cTargets[0] = i2c
+		interrupt.New(stm32.IRQ_I2C1_EV, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+		interrupt.New(stm32.IRQ_I2C1_ER, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+	default:
+		return false
+	}
+	return true
+}
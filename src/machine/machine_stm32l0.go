@@ -221,6 +221,7 @@ func (uart *UART) setRegisters() {
 	uart.rxReg = &uart.Bus.RDR
 	uart.txReg = &uart.Bus.TDR
 	uart.statusReg = &uart.Bus.ISR
+	uart.errorClearReg = &uart.Bus.ICR
 	uart.txEmptyFlag = stm32.USART_ISR_TXE
 }
 
@@ -302,3 +303,24 @@ func (i2c I2C) getFreqRange() uint32 {
 	// TODO: Do calculations based on PCLK1
 	return 0x00303D5B
 }
+
+//---------- I2C target related code
+
+// i2cTargets are the I2C peripherals in target mode, for the interrupt
+// handlers.
+var i2cTargets [1]*I2C
+
+// enableTargetInterrupt registers the interrupt handler of this I2C peripheral
+// and enables it. It returns false if the peripheral is not supported.
+func (i2c *I2C) enableTargetInterrupt() bool {
+	switch i2c.Bus {
+	case stm32.I2C1:
+		i2cTargets[0] = i2c
+		interrupt.New(stm32.IRQ_I2C1, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+	default:
+		return false
+	}
+	return true
+}
@@ -296,6 +296,7 @@ func (uart *UART) setRegisters() {
 	uart.rxReg = &uart.Bus.RDR
 	uart.txReg = &uart.Bus.TDR
 	uart.statusReg = &uart.Bus.ISR
+	uart.errorClearReg = &uart.Bus.ICR
 	uart.txEmptyFlag = stm32.USART_ISR_TXE
 }
 
@@ -646,3 +647,28 @@ func checkError() error {
 
 	return nil
 }
+
+//---------- I2C target related code
+
+// i2cTargets are the I2C peripherals in target mode, for the interrupt
+// handlers.
+var i2cTargets [1]*I2C
+
+// enableTargetInterrupt registers the event and error interrupt handlers of
+// this I2C peripheral and enables them. It returns false if the peripheral is
+// not supported.
+func (i2c *I2C) enableTargetInterrupt() bool {
+	switch i2c.Bus {
+	case stm32.I2C1:
+		i2cTargets[0] = i2c
+		interrupt.New(stm32.IRQ_I2C1_EV, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+		interrupt.New(stm32.IRQ_I2C1_ER, func(interrupt.Interrupt) {
+			i2cTargets[0].handleTargetInterrupt()
+		}).Enable()
+	default:
+		return false
+	}
+	return true
+}
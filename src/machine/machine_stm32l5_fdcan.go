@@ -0,0 +1,301 @@
+//go:build stm32l5
+
+package machine
+
+// CAN driver for the FDCAN peripheral of the STM32L5, which is a Bosch M_CAN
+// controller with a fixed message RAM layout.
+
+import (
+	"device/stm32"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// CAN is a FDCAN controller. It supports classic CAN and CAN FD frames.
+type CAN struct {
+	Bus             *stm32.FDCAN_Type
+	AltFuncSelector uint8
+}
+
+var CAN1 = CAN{Bus: stm32.FDCAN1, AltFuncSelector: AF9_FDCAN1_TSC}
+
+// Number of standard and extended filters that can be set with SetFilters.
+// This is fixed by the message RAM layout.
+const (
+	canStdFilterCount = 28
+	canExtFilterCount = 8
+)
+
+// The FDCAN kernel clock is configured to use the PLL Q output, which runs at
+// the same frequency as the system clock.
+const canClockFrequency = 110e6
+
+// The goroutines blocked in Transmit and Receive.
+var canWait canWaiters
+
+// fdcanRAM is the layout of the message RAM.
+type fdcanRAM struct {
+	stdFilters [canStdFilterCount]volatile.Register32
+	extFilters [canExtFilterCount][2]volatile.Register32
+	rxFIFO0    [3]mcanElement
+	rxFIFO1    [3]mcanElement
+	txEvents   [3][2]volatile.Register32
+	txBuffers  [3]mcanElement
+}
+
+// The message RAM of FDCAN1.
+var fdcanMessageRAM = (*fdcanRAM)(unsafe.Pointer(uintptr(0x4000AC00)))
+
+// Register bits, as described in the reference manual.
+const (
+	fdcanCCCR_INIT = 1 << 0
+	fdcanCCCR_CCE  = 1 << 1
+	fdcanCCCR_MON  = 1 << 5
+	fdcanCCCR_TEST = 1 << 7
+	fdcanCCCR_FDOE = 1 << 8
+	fdcanCCCR_BRSE = 1 << 9
+
+	fdcanTEST_LBCK = 1 << 4
+
+	fdcanNBTP_NTSEG2_Pos = 0
+	fdcanNBTP_NTSEG1_Pos = 8
+	fdcanNBTP_NBRP_Pos   = 16
+	fdcanNBTP_NSJW_Pos   = 25
+
+	fdcanDBTP_DSJW_Pos   = 0
+	fdcanDBTP_DTSEG2_Pos = 4
+	fdcanDBTP_DTSEG1_Pos = 8
+	fdcanDBTP_DBRP_Pos   = 16
+
+	fdcanECR_TEC_Pos = 0
+	fdcanECR_REC_Pos = 8
+
+	fdcanPSR_BO = 1 << 7
+
+	// IR and IE
+	fdcanIR_RF0N = 1 << 0
+	fdcanIR_TC   = 1 << 7
+	fdcanIR_BO   = 1 << 19
+
+	fdcanILE_EINT0 = 1 << 0
+
+	fdcanRXGFC_ANFE_Pos = 2
+	fdcanRXGFC_ANFS_Pos = 4
+	fdcanRXGFC_LSS_Pos  = 16
+	fdcanRXGFC_LSE_Pos  = 24
+
+	fdcanRXF0S_F0FL_Msk = 0xf
+	fdcanRXF0S_F0GI_Pos = 8
+
+	fdcanTXFQS_TFQPI_Pos = 16
+	fdcanTXFQS_TFQF      = 1 << 21
+)
+
+// Configure this CAN peripheral with the given configuration.
+func (can *CAN) Configure(config CANConfig) error {
+	if config.TransferRate == 0 {
+		config.TransferRate = CANTransferRate500kbps
+	}
+	if config.TransferRateFD == 0 {
+		config.TransferRateFD = CANTransferRate1000kbps
+	}
+	if config.TransferRateFD < config.TransferRate {
+		return errCANInvalidTransferRateFD
+	}
+	brp, seg1, seg2, err := canBitTiming(canClockFrequency, config.TransferRate, 512)
+	if err != nil {
+		return err
+	}
+	dbrp, dseg1, dseg2, err := canBitTiming(canClockFrequency, config.TransferRateFD, 32)
+	if err != nil {
+		return errCANInvalidTransferRateFD
+	}
+
+	if config.Standby != NoPin {
+		config.Standby.Configure(PinConfig{Mode: PinOutput})
+		config.Standby.Low()
+	}
+	config.Tx.ConfigureAltFunc(PinConfig{Mode: PinModeCANTX}, can.AltFuncSelector)
+	config.Rx.ConfigureAltFunc(PinConfig{Mode: PinModeCANRX}, can.AltFuncSelector)
+
+	// Use the PLL Q output as kernel clock (FDCANSEL = 1).
+	stm32.RCC.PLLCFGR.SetBits(stm32.RCC_PLLCFGR_PLLQEN)
+	stm32.RCC.CCIPR1.ReplaceBits(1, 0x3, 24)
+	enableAltFuncClock(unsafe.Pointer(can.Bus))
+
+	can.enterInit()
+
+	can.Bus.CCCR.ClearBits(fdcanCCCR_TEST | fdcanCCCR_MON)
+	can.Bus.CCCR.SetBits(fdcanCCCR_FDOE | fdcanCCCR_BRSE)
+	switch config.Mode {
+	case CANModeLoopback:
+		// internal loopback: transmitted frames are not sent to the bus
+		can.Bus.CCCR.SetBits(fdcanCCCR_TEST | fdcanCCCR_MON)
+		can.Bus.TEST.SetBits(fdcanTEST_LBCK)
+	case CANModeListenOnly:
+		can.Bus.CCCR.SetBits(fdcanCCCR_MON)
+	}
+
+	can.Bus.NBTP.Set((seg2-1)<<fdcanNBTP_NTSEG2_Pos | (seg1-1)<<fdcanNBTP_NTSEG1_Pos |
+		(brp-1)<<fdcanNBTP_NBRP_Pos | (seg2-1)<<fdcanNBTP_NSJW_Pos)
+	can.Bus.DBTP.Set((dseg2-1)<<fdcanDBTP_DSJW_Pos | (dseg2-1)<<fdcanDBTP_DTSEG2_Pos |
+		(dseg1-1)<<fdcanDBTP_DTSEG1_Pos | (dbrp-1)<<fdcanDBTP_DBRP_Pos)
+
+	// Use the Tx buffers as a FIFO.
+	can.Bus.TXBC.Set(0)
+	can.Bus.XIDAM.Set(0x1fffffff)
+	can.setFilterLists(0, 0)
+
+	// Interrupts for Transmit and Receive, on interrupt line 0.
+	can.Bus.TXBTIE.Set(1<<len(fdcanMessageRAM.txBuffers) - 1)
+	can.Bus.IE.Set(fdcanIR_RF0N | fdcanIR_TC | fdcanIR_BO)
+	can.Bus.ILS.Set(0)
+	can.Bus.ILE.Set(fdcanILE_EINT0)
+	interrupt.New(stm32.IRQ_FDCAN1_IT0, func(interrupt.Interrupt) {
+		canHandleInterrupt(stm32.FDCAN1)
+	}).Enable()
+
+	can.leaveInit()
+	return nil
+}
+
+// canHandleInterrupt wakes up the goroutines blocked in Transmit and Receive.
+func canHandleInterrupt(bus *stm32.FDCAN_Type) {
+	ir := bus.IR.Get() & bus.IE.Get()
+	bus.IR.Set(ir) // clear interrupt
+	if ir&fdcanIR_RF0N != 0 {
+		canWait.rx.Notify()
+	}
+	if ir&(fdcanIR_TC|fdcanIR_BO) != 0 {
+		canWait.tx.Notify()
+	}
+}
+
+// enterInit stops the CAN controller and enables changes to its
+// configuration.
+func (can *CAN) enterInit() {
+	can.Bus.CCCR.SetBits(fdcanCCCR_INIT)
+	for !can.Bus.CCCR.HasBits(fdcanCCCR_INIT) {
+	}
+	can.Bus.CCCR.SetBits(fdcanCCCR_CCE)
+}
+
+// leaveInit starts the CAN controller again after enterInit.
+func (can *CAN) leaveInit() {
+	can.Bus.CCCR.ClearBits(fdcanCCCR_CCE)
+	can.Bus.CCCR.ClearBits(fdcanCCCR_INIT)
+	for can.Bus.CCCR.HasBits(fdcanCCCR_INIT) {
+	}
+}
+
+// setFilterLists configures the number of standard and extended filters in
+// use. When there are no filters at all, all frames are stored in Rx FIFO 0.
+// Otherwise frames that don't match a filter are rejected.
+func (can *CAN) setFilterLists(std, ext uint32) {
+	nonMatching := uint32(0) // accept in Rx FIFO 0
+	if std+ext != 0 {
+		nonMatching = 2 // reject
+	}
+	can.Bus.RXGFC.Set(std<<fdcanRXGFC_LSS_Pos | ext<<fdcanRXGFC_LSE_Pos |
+		nonMatching<<fdcanRXGFC_ANFS_Pos | nonMatching<<fdcanRXGFC_ANFE_Pos)
+}
+
+// SetFilters replaces the set of receive filters. A frame is received when it
+// matches any of the filters. All frames are received when no filters are
+// set, which is the default. Up to 28 standard and 8 extended filters can be
+// set.
+func (can *CAN) SetFilters(filters []CANFilter) error {
+	var std, ext uint32
+	for _, f := range filters {
+		if f.Extended {
+			ext++
+		} else {
+			std++
+		}
+	}
+	if std > canStdFilterCount || ext > canExtFilterCount {
+		return ErrCANInvalidFilter
+	}
+
+	ram := fdcanMessageRAM
+	can.enterInit()
+	std, ext = 0, 0
+	for _, f := range filters {
+		if f.Extended {
+			f0, f1 := mcanExtFilter(f)
+			ram.extFilters[ext][0].Set(f0)
+			ram.extFilters[ext][1].Set(f1)
+			ext++
+		} else {
+			ram.stdFilters[std].Set(mcanStdFilter(f))
+			std++
+		}
+	}
+	can.setFilterLists(std, ext)
+	can.leaveInit()
+	return nil
+}
+
+// Transmit queues a frame for transmission. It blocks while the Tx FIFO is
+// full, and returns ErrCANBusOff if the controller is bus-off.
+func (can *CAN) Transmit(frame *CANFrame) error {
+	if err := frame.check(true); err != nil {
+		return err
+	}
+	for {
+		if can.Bus.PSR.HasBits(fdcanPSR_BO) {
+			return ErrCANBusOff
+		}
+		if !can.Bus.TXFQS.HasBits(fdcanTXFQS_TFQF) {
+			break
+		}
+		// Woken up when a frame was sent, or when the bus state changed.
+		canWait.tx.Wait()
+	}
+
+	putIndex := (can.Bus.TXFQS.Get() >> fdcanTXFQS_TFQPI_Pos) & 0x3
+	fdcanMessageRAM.txBuffers[putIndex].write(frame)
+	can.Bus.TXBAR.Set(1 << putIndex)
+	return nil
+}
+
+// Receive blocks until a frame is received and copies it to frame.
+func (can *CAN) Receive(frame *CANFrame) error {
+	for can.Available() == 0 {
+		canWait.rx.Wait()
+	}
+	idx := (can.Bus.RXF0S.Get() >> fdcanRXF0S_F0GI_Pos) & 0x3
+	fdcanMessageRAM.rxFIFO0[idx].read(frame)
+	can.Bus.RXF0A.Set(idx)
+	return nil
+}
+
+// Available returns the number of frames that can be received without
+// blocking.
+func (can *CAN) Available() int {
+	return int(can.Bus.RXF0S.Get() & fdcanRXF0S_F0FL_Msk)
+}
+
+// ErrorCounters returns the current error counters and bus state.
+func (can *CAN) ErrorCounters() CANErrorCounters {
+	ecr := can.Bus.ECR.Get()
+	tec := (ecr >> fdcanECR_TEC_Pos) & 0xff
+	rec := (ecr >> fdcanECR_REC_Pos) & 0x7f
+	return CANErrorCounters{
+		State:    canErrorState(can.Bus.PSR.HasBits(fdcanPSR_BO), tec, rec),
+		TxErrors: uint8(tec),
+		RxErrors: uint8(rec),
+	}
+}
+
+// Recover starts bus-off recovery. The controller reconnects after it has
+// seen 128 occurrences of 11 recessive bits on the bus.
+func (can *CAN) Recover() error {
+	if can.Bus.PSR.HasBits(fdcanPSR_BO) {
+		// The controller sets INIT when it goes bus-off. Clearing it starts
+		// the recovery sequence.
+		can.Bus.CCCR.ClearBits(fdcanCCCR_INIT)
+	}
+	return nil
+}
@@ -43,6 +43,7 @@ func (uart *UART) setRegisters() {
 	uart.rxReg = &uart.Bus.RDR
 	uart.txReg = &uart.Bus.TDR
 	uart.statusReg = &uart.Bus.ISR
+	uart.errorClearReg = &uart.Bus.ICR
 	uart.txEmptyFlag = stm32.USART_ISR_TXE
 }
 
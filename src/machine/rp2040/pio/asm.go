@@ -0,0 +1,732 @@
+package pio
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The assembler accepts the syntax of pioasm, with these directives:
+//
+//	.program <name>
+//	.origin <offset>
+//	.side_set <count> [opt] [pindirs]
+//	.wrap_target
+//	.wrap
+//	.define [public] <symbol> <value>
+//	.word <value>
+//
+// Values can be expressions with + - * / and parentheses, using numbers,
+// labels and defined symbols. Code blocks for other languages (% ... %{ %})
+// and .lang_opt directives are ignored.
+
+// Error is a syntax or semantic error in a PIO program.
+type Error struct {
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("pio: line %d: %v", e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errNoProgram     = errors.New("instruction outside of a program")
+	errTooLong       = errors.New("program is longer than 32 instructions")
+	errDuplicate     = errors.New("duplicate symbol")
+	errUnknownSymbol = errors.New("unknown symbol")
+	errSyntax        = errors.New("syntax error")
+	errRange         = errors.New("value out of range")
+	errSideSet       = errors.New("side-set is required by .side_set")
+)
+
+// line is an instruction line, which is encoded once all labels are known.
+type line struct {
+	num  int
+	text string
+}
+
+// program is a program while it is being assembled.
+type program struct {
+	name        string
+	prog        Program
+	sideSetBits uint8 // number of side-set value bits, without the enable bit
+	lines       []line
+	symbols     map[string]int // labels and local defines
+	hasWrap     bool
+}
+
+// Assemble assembles the programs in src and returns them by name.
+func Assemble(src string) (map[string]Program, error) {
+	globals := map[string]int{}
+	var programs []*program
+	var p *program
+	inCode := false
+	for i, text := range strings.Split(src, "\n") {
+		num := i + 1
+		text = stripComment(text)
+		trimmed := strings.TrimSpace(text)
+
+		// Skip code blocks for other languages.
+		if inCode {
+			if strings.HasPrefix(trimmed, "%}") {
+				inCode = false
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "%") {
+			inCode = strings.HasSuffix(trimmed, "{")
+			continue
+		}
+
+		// Labels.
+		for {
+			label, rest, ok := cutLabel(trimmed)
+			if !ok {
+				break
+			}
+			if p == nil {
+				return nil, &Error{num, errNoProgram}
+			}
+			if _, exists := p.symbols[label]; exists {
+				return nil, &Error{num, fmt.Errorf("%w: %s", errDuplicate, label)}
+			}
+			p.symbols[label] = len(p.lines)
+			trimmed = rest
+		}
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ".") {
+			fields := strings.Fields(trimmed)
+			directive := strings.ToLower(fields[0])
+			args := fields[1:]
+			if directive == ".program" {
+				if len(args) != 1 {
+					return nil, &Error{num, errSyntax}
+				}
+				p = &program{
+					name:    args[0],
+					prog:    Program{Origin: -1},
+					symbols: map[string]int{},
+				}
+				programs = append(programs, p)
+				continue
+			}
+			if directive == ".define" {
+				if len(args) > 0 && strings.EqualFold(args[0], "public") {
+					args = args[1:]
+				}
+				if len(args) < 2 {
+					return nil, &Error{num, errSyntax}
+				}
+				symbols := globals
+				if p != nil {
+					symbols = p.symbols
+				}
+				value, err := p.eval(strings.Join(args[1:], " "), globals)
+				if err != nil {
+					return nil, &Error{num, err}
+				}
+				if _, exists := symbols[args[0]]; exists {
+					return nil, &Error{num, fmt.Errorf("%w: %s", errDuplicate, args[0])}
+				}
+				symbols[args[0]] = value
+				continue
+			}
+			if directive == ".lang_opt" {
+				continue
+			}
+			if p == nil {
+				return nil, &Error{num, errNoProgram}
+			}
+			if directive == ".word" {
+				p.lines = append(p.lines, line{num, trimmed})
+				continue
+			}
+			if err := p.directive(directive, args, globals); err != nil {
+				return nil, &Error{num, err}
+			}
+			continue
+		}
+
+		if p == nil {
+			return nil, &Error{num, errNoProgram}
+		}
+		p.lines = append(p.lines, line{num, trimmed})
+	}
+
+	result := make(map[string]Program, len(programs))
+	for _, p := range programs {
+		if err := p.assemble(globals); err != nil {
+			return nil, err
+		}
+		result[p.name] = p.prog
+	}
+	return result, nil
+}
+
+// directive handles the directives that apply to the current program.
+func (p *program) directive(directive string, args []string, globals map[string]int) error {
+	switch directive {
+	case ".origin":
+		origin, err := p.evalRange(strings.Join(args, " "), globals, 0, 31)
+		if err != nil {
+			return err
+		}
+		p.prog.Origin = int8(origin)
+	case ".side_set":
+		if len(args) == 0 {
+			return errSyntax
+		}
+		count, err := p.evalRange(args[0], globals, 0, 5)
+		if err != nil {
+			return err
+		}
+		p.sideSetBits = uint8(count)
+		for _, arg := range args[1:] {
+			switch strings.ToLower(arg) {
+			case "opt":
+				p.prog.SideSetOptional = true
+			case "pindirs":
+				p.prog.SideSetPinDirs = true
+			default:
+				return errSyntax
+			}
+		}
+		p.prog.SideSetCount = p.sideSetBits
+		if p.prog.SideSetOptional {
+			p.prog.SideSetCount++
+		}
+		if p.prog.SideSetCount > 5 {
+			return errRange
+		}
+	case ".wrap_target":
+		p.prog.WrapTarget = uint8(len(p.lines))
+	case ".wrap":
+		if len(p.lines) == 0 {
+			return errSyntax
+		}
+		p.prog.Wrap = uint8(len(p.lines) - 1)
+		p.hasWrap = true
+	default:
+		return fmt.Errorf("%w: unknown directive %s", errSyntax, directive)
+	}
+	return nil
+}
+
+// assemble encodes the instructions of the program.
+func (p *program) assemble(globals map[string]int) error {
+	if len(p.lines) > 32 {
+		return &Error{p.lines[32].num, errTooLong}
+	}
+	p.prog.Instructions = make([]uint16, len(p.lines))
+	for i, l := range p.lines {
+		instr, err := p.instruction(l.text, globals)
+		if err != nil {
+			return &Error{l.num, err}
+		}
+		p.prog.Instructions[i] = instr
+	}
+	if !p.hasWrap && len(p.lines) > 0 {
+		p.prog.Wrap = uint8(len(p.lines) - 1)
+	}
+	return nil
+}
+
+// instruction encodes a single instruction line, with side-set and delay.
+func (p *program) instruction(text string, globals map[string]int) (uint16, error) {
+	if rest, ok := cutPrefixFold(text, ".word"); ok {
+		value, err := p.evalRange(rest, globals, 0, 0xffff)
+		return uint16(value), err
+	}
+
+	// Delay, at the end of the line.
+	delay := 0
+	hasDelay := false
+	if strings.HasSuffix(text, "]") {
+		start := strings.LastIndexByte(text, '[')
+		if start < 0 {
+			return 0, errSyntax
+		}
+		maxDelay := 0x1f >> p.prog.SideSetCount
+		var err error
+		delay, err = p.evalRange(text[start+1:len(text)-1], globals, 0, maxDelay)
+		if err != nil {
+			return 0, err
+		}
+		text = strings.TrimSpace(text[:start])
+		hasDelay = true
+	}
+
+	// Side-set, after the operands.
+	sideSet := -1
+	fields := strings.Fields(text)
+	for i, f := range fields {
+		if strings.EqualFold(f, "side") || strings.EqualFold(f, "sideset") {
+			if p.sideSetBits == 0 {
+				return 0, fmt.Errorf("%w: side-set without .side_set", errSyntax)
+			}
+			var err error
+			sideSet, err = p.evalRange(strings.Join(fields[i+1:], " "), globals, 0, 1<<p.sideSetBits-1)
+			if err != nil {
+				return 0, err
+			}
+			fields = fields[:i]
+			break
+		}
+	}
+	if len(fields) == 0 {
+		return 0, errSyntax
+	}
+	if sideSet < 0 && p.sideSetBits != 0 && !p.prog.SideSetOptional {
+		return 0, errSideSet
+	}
+
+	instr, err := p.encode(strings.ToLower(fields[0]), strings.Join(fields[1:], " "), globals)
+	if err != nil {
+		return 0, err
+	}
+	if hasDelay {
+		instr = WithDelay(instr, uint8(delay), p.prog.SideSetCount)
+	}
+	if sideSet >= 0 {
+		instr = WithSideSet(instr, uint8(sideSet), p.prog.SideSetCount, p.prog.SideSetOptional)
+	}
+	return instr, nil
+}
+
+// encode encodes the instruction without side-set and delay.
+func (p *program) encode(mnemonic, operands string, globals map[string]int) (uint16, error) {
+	switch mnemonic {
+	case "nop":
+		if operands != "" {
+			return 0, errSyntax
+		}
+		return Nop(), nil
+
+	case "jmp":
+		fields := strings.Fields(strings.Replace(operands, ",", " ", 1))
+		cond := JmpAlways
+		if len(fields) > 1 {
+			if c, ok := jmpConditions[strings.ToLower(fields[0])]; ok {
+				cond = c
+				fields = fields[1:]
+			}
+		}
+		addr, err := p.evalRange(strings.Join(fields, " "), globals, 0, 31)
+		if err != nil {
+			return 0, err
+		}
+		return Jmp(cond, uint8(addr)), nil
+
+	case "wait":
+		fields := strings.Fields(operands)
+		polarity := 1
+		if len(fields) > 0 {
+			if _, ok := waitSources[strings.ToLower(fields[0])]; !ok {
+				var err error
+				polarity, err = p.evalRange(fields[0], globals, 0, 1)
+				if err != nil {
+					return 0, err
+				}
+				fields = fields[1:]
+			}
+		}
+		if len(fields) < 2 {
+			return 0, errSyntax
+		}
+		src, ok := waitSources[strings.ToLower(fields[0])]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown wait source %s", errSyntax, fields[0])
+		}
+		rel := strings.EqualFold(fields[len(fields)-1], "rel")
+		if rel {
+			if src != WaitIRQ {
+				return 0, errSyntax
+			}
+			fields = fields[:len(fields)-1]
+		}
+		index, err := p.evalRange(strings.Join(fields[1:], " "), globals, 0, 31)
+		if err != nil {
+			return 0, err
+		}
+		if src == WaitIRQ && index > 7 {
+			return 0, errRange
+		}
+		if rel {
+			index |= IRQRel
+		}
+		return Wait(polarity == 1, src, uint8(index)), nil
+
+	case "in", "out":
+		name, count, err := p.operands(operands)
+		if err != nil {
+			return 0, err
+		}
+		bitCount, err := p.evalRange(count, globals, 1, 32)
+		if err != nil {
+			return 0, err
+		}
+		if mnemonic == "in" {
+			src, ok := inSources[name]
+			if !ok {
+				return 0, fmt.Errorf("%w: unknown in source %s", errSyntax, name)
+			}
+			return In(src, uint8(bitCount)), nil
+		}
+		dest, ok := outDestinations[name]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown out destination %s", errSyntax, name)
+		}
+		return Out(dest, uint8(bitCount)), nil
+
+	case "push", "pull":
+		cond := "iffull"
+		if mnemonic == "pull" {
+			cond = "ifempty"
+		}
+		ifCond, block := false, true
+		for _, f := range strings.Fields(strings.ToLower(operands)) {
+			switch f {
+			case cond:
+				ifCond = true
+			case "block":
+				block = true
+			case "noblock":
+				block = false
+			default:
+				return 0, errSyntax
+			}
+		}
+		if mnemonic == "push" {
+			return Push(ifCond, block), nil
+		}
+		return Pull(ifCond, block), nil
+
+	case "mov":
+		name, src, err := p.operands(operands)
+		if err != nil {
+			return 0, err
+		}
+		dest, ok := movDestinations[name]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown mov destination %s", errSyntax, name)
+		}
+		op := MovNone
+		if s, ok := cutPrefixFold(src, "::"); ok {
+			op, src = MovBitReverse, s
+		} else if s, ok := cutPrefixFold(src, "!"); ok {
+			op, src = MovInvert, s
+		} else if s, ok := cutPrefixFold(src, "~"); ok {
+			op, src = MovInvert, s
+		}
+		source, ok := movSources[strings.ToLower(strings.TrimSpace(src))]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown mov source %s", errSyntax, src)
+		}
+		return Mov(dest, op, source), nil
+
+	case "irq":
+		fields := strings.Fields(operands)
+		clear, wait := false, false
+		if len(fields) > 0 {
+			switch strings.ToLower(fields[0]) {
+			case "set", "nowait":
+				fields = fields[1:]
+			case "wait":
+				wait = true
+				fields = fields[1:]
+			case "clear":
+				clear = true
+				fields = fields[1:]
+			}
+		}
+		rel := len(fields) > 0 && strings.EqualFold(fields[len(fields)-1], "rel")
+		if rel {
+			fields = fields[:len(fields)-1]
+		}
+		index, err := p.evalRange(strings.Join(fields, " "), globals, 0, 7)
+		if err != nil {
+			return 0, err
+		}
+		if rel {
+			index |= IRQRel
+		}
+		return Irq(clear, wait, uint8(index)), nil
+
+	case "set":
+		name, value, err := p.operands(operands)
+		if err != nil {
+			return 0, err
+		}
+		dest, ok := setDestinations[name]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown set destination %s", errSyntax, name)
+		}
+		v, err := p.evalRange(value, globals, 0, 31)
+		if err != nil {
+			return 0, err
+		}
+		return Set(dest, uint8(v)), nil
+	}
+	return 0, fmt.Errorf("%w: unknown instruction %s", errSyntax, mnemonic)
+}
+
+// operands splits "name, value" operands. The name is returned in lower case.
+func (p *program) operands(operands string) (name, value string, err error) {
+	name, value, ok := strings.Cut(operands, ",")
+	if !ok {
+		return "", "", errSyntax
+	}
+	return strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value), nil
+}
+
+var jmpConditions = map[string]JmpCondition{
+	"!x":    JmpXZero,
+	"x--":   JmpXNotZeroPostDec,
+	"!y":    JmpYZero,
+	"y--":   JmpYNotZeroPostDec,
+	"x!=y":  JmpXNotEqualY,
+	"pin":   JmpPin,
+	"!osre": JmpOSRNotEmpty,
+}
+
+var waitSources = map[string]WaitSource{
+	"gpio": WaitGPIO,
+	"pin":  WaitPin,
+	"irq":  WaitIRQ,
+}
+
+var inSources = map[string]Source{
+	"pins": SrcPins,
+	"x":    SrcX,
+	"y":    SrcY,
+	"null": SrcNull,
+	"isr":  SrcISR,
+	"osr":  SrcOSR,
+}
+
+var outDestinations = map[string]Destination{
+	"pins":    DestPins,
+	"x":       DestX,
+	"y":       DestY,
+	"null":    DestNull,
+	"pindirs": DestPinDirs,
+	"pc":      DestPC,
+	"isr":     DestISR,
+	"exec":    DestOutExec,
+}
+
+var movDestinations = map[string]Destination{
+	"pins": DestPins,
+	"x":    DestX,
+	"y":    DestY,
+	"exec": DestExec,
+	"pc":   DestPC,
+	"isr":  DestISR,
+	"osr":  DestOSR,
+}
+
+var movSources = map[string]Source{
+	"pins":   SrcPins,
+	"x":      SrcX,
+	"y":      SrcY,
+	"null":   SrcNull,
+	"status": SrcStatus,
+	"isr":    SrcISR,
+	"osr":    SrcOSR,
+}
+
+var setDestinations = map[string]Destination{
+	"pins":    DestPins,
+	"x":       DestX,
+	"y":       DestY,
+	"pindirs": DestPinDirs,
+}
+
+// evalRange evaluates an expression and checks that the result is within the
+// given range.
+func (p *program) evalRange(expr string, globals map[string]int, min, max int) (int, error) {
+	value, err := p.eval(expr, globals)
+	if err != nil {
+		return 0, err
+	}
+	if value < min || value > max {
+		return 0, fmt.Errorf("%w: %d", errRange, value)
+	}
+	return value, nil
+}
+
+// eval evaluates an expression. Symbols are looked up in the program (if any)
+// and then in the global symbols.
+func (p *program) eval(expr string, globals map[string]int) (int, error) {
+	e := &exprParser{tokens: tokenize(expr), lookup: func(name string) (int, bool) {
+		if p != nil {
+			if v, ok := p.symbols[name]; ok {
+				return v, true
+			}
+		}
+		v, ok := globals[name]
+		return v, ok
+	}}
+	value, err := e.sum()
+	if err != nil {
+		return 0, err
+	}
+	if len(e.tokens) != 0 {
+		return 0, errSyntax
+	}
+	return value, nil
+}
+
+// exprParser is a recursive descent parser for expressions.
+type exprParser struct {
+	tokens []string
+	lookup func(name string) (int, bool)
+}
+
+func (e *exprParser) peek() string {
+	if len(e.tokens) == 0 {
+		return ""
+	}
+	return e.tokens[0]
+}
+
+func (e *exprParser) next() string {
+	t := e.peek()
+	if len(e.tokens) != 0 {
+		e.tokens = e.tokens[1:]
+	}
+	return t
+}
+
+func (e *exprParser) sum() (int, error) {
+	value, err := e.product()
+	for err == nil && (e.peek() == "+" || e.peek() == "-") {
+		op := e.next()
+		var rhs int
+		rhs, err = e.product()
+		if op == "+" {
+			value += rhs
+		} else {
+			value -= rhs
+		}
+	}
+	return value, err
+}
+
+func (e *exprParser) product() (int, error) {
+	value, err := e.unary()
+	for err == nil && (e.peek() == "*" || e.peek() == "/") {
+		op := e.next()
+		var rhs int
+		rhs, err = e.unary()
+		if err != nil {
+			break
+		}
+		if op == "*" {
+			value *= rhs
+		} else if rhs == 0 {
+			err = errRange
+		} else {
+			value /= rhs
+		}
+	}
+	return value, err
+}
+
+func (e *exprParser) unary() (int, error) {
+	switch t := e.next(); {
+	case t == "":
+		return 0, errSyntax
+	case t == "-":
+		value, err := e.unary()
+		return -value, err
+	case t == "(":
+		value, err := e.sum()
+		if err == nil && e.next() != ")" {
+			err = errSyntax
+		}
+		return value, err
+	case t[0] >= '0' && t[0] <= '9':
+		value, err := strconv.ParseInt(t, 0, 32)
+		if err != nil {
+			return 0, errSyntax
+		}
+		return int(value), nil
+	default:
+		value, ok := e.lookup(t)
+		if !ok {
+			return 0, fmt.Errorf("%w: %s", errUnknownSymbol, t)
+		}
+		return value, nil
+	}
+}
+
+// tokenize splits an expression into numbers, symbols and operators.
+func tokenize(expr string) []string {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case isWordChar(c):
+			start := i
+			for i < len(expr) && isWordChar(expr[i]) {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		default:
+			tokens = append(tokens, expr[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// stripComment removes ; and // comments from a line.
+func stripComment(text string) string {
+	if i := strings.Index(text, ";"); i >= 0 {
+		text = text[:i]
+	}
+	if i := strings.Index(text, "//"); i >= 0 {
+		text = text[:i]
+	}
+	return text
+}
+
+// cutLabel splits off a label ("name:" or "public name:") at the start of
+// the line.
+func cutLabel(text string) (label, rest string, ok bool) {
+	if s, ok := cutPrefixFold(text, "public "); ok {
+		text = strings.TrimSpace(s)
+	}
+	i := 0
+	for i < len(text) && isWordChar(text[i]) && text[i] != '.' {
+		i++
+	}
+	if i == 0 || i >= len(text) || text[i] != ':' || strings.HasPrefix(text[i:], "::") {
+		return "", "", false
+	}
+	return text[:i], strings.TrimSpace(text[i+1:]), true
+}
+
+// cutPrefixFold is like strings.CutPrefix, but ignores case.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
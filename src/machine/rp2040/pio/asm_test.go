@@ -0,0 +1,250 @@
+package pio
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Programs from the Pico SDK examples, with the output of pioasm.
+var sdkPrograms = []struct {
+	source string
+	name   string
+	want   Program
+}{
+	{
+		source: `
+.program squarewave
+    set pindirs, 1   ; Set pin to output
+again:
+    set pins, 1 [1]  ; Drive pin high and then delay for one cycle
+    set pins, 0      ; Drive pin low
+    jmp again        ; Set PC to label 'again'
+`,
+		name: "squarewave",
+		want: Program{
+			Instructions: []uint16{0xe081, 0xe101, 0xe000, 0x0001},
+			Origin:       -1,
+			Wrap:         3,
+		},
+	},
+	{
+		source: `
+.program ws2812
+.side_set 1
+
+.define public T1 2
+.define public T2 5
+.define public T3 3
+
+.lang_opt python sideset_init = pico.PIO.OUT_HIGH
+
+.wrap_target
+bitloop:
+    out x, 1       side 0 [T3 - 1] ; Side-set still takes place when instruction stalls
+    jmp !x do_zero side 1 [T1 - 1] ; Branch on the bit we shifted out. Positive pulse
+do_one:
+    jmp  bitloop   side 1 [T2 - 1] ; Continue driving high, for a long pulse
+do_zero:
+    nop            side 0 [T2 - 1] ; Or drive low, for a short pulse
+.wrap
+
+% c-sdk {
+#include "hardware/clocks.h"
+%}
+`,
+		name: "ws2812",
+		want: Program{
+			Instructions: []uint16{0x6221, 0x1123, 0x1400, 0xa442},
+			Origin:       -1,
+			WrapTarget:   0,
+			Wrap:         3,
+			SideSetCount: 1,
+		},
+	},
+	{
+		source: `
+.program uart_tx
+.side_set 1 opt
+    pull       side 1 [7]
+    set x, 7   side 0 [7]
+bitloop:
+    out pins, 1
+    jmp x-- bitloop   [6]
+`,
+		name: "uart_tx",
+		want: Program{
+			Instructions:    []uint16{0x9fa0, 0xf727, 0x6001, 0x0642},
+			Origin:          -1,
+			Wrap:            3,
+			SideSetCount:    2,
+			SideSetOptional: true,
+		},
+	},
+	{
+		source: `
+.program uart_rx
+start:
+    wait 0 pin 0
+    set x, 7    [10]
+bitloop:
+    in pins, 1
+    jmp x-- bitloop [6]
+    jmp pin good_stop
+    irq 4 rel
+    wait 1 pin 0
+    jmp start
+good_stop:
+    push
+`,
+		name: "uart_rx",
+		want: Program{
+			Instructions: []uint16{0x2020, 0xea27, 0x4001, 0x0642, 0x00c8, 0xc014, 0x20a0, 0x0000, 0x8020},
+			Origin:       -1,
+			Wrap:         8,
+		},
+	},
+}
+
+func TestAssembleSDKPrograms(t *testing.T) {
+	for _, tc := range sdkPrograms {
+		programs, err := Assemble(tc.source)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		got, ok := programs[tc.name]
+		if !ok {
+			t.Errorf("%s: program not found", tc.name)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %#v\nwant %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAssembleInstructions(t *testing.T) {
+	tests := []struct {
+		instr string
+		want  uint16
+	}{
+		{"jmp 3", 0x0003},
+		{"jmp !y, 3", 0x0063},
+		{"jmp y-- 3", 0x0083},
+		{"jmp x!=y 3", 0x00a3},
+		{"jmp !osre 3", 0x00e3},
+		{"wait 1 gpio 7", 0x2087},
+		{"wait 0 irq 2", 0x2042},
+		{"in osr, 32", 0x40e0},
+		{"in null, 0x10", 0x4070},
+		{"out pindirs, 4", 0x6084},
+		{"out exec, 16", 0x60f0},
+		{"out pc, 5", 0x60a5},
+		{"push iffull noblock", 0x8040},
+		{"pull ifempty", 0x80e0},
+		{"pull noblock", 0x8080},
+		{"mov x, ~osr", 0xa02f},
+		{"mov pins, !x", 0xa009},
+		{"mov isr, ::y", 0xa0d2},
+		{"mov exec, x", 0xa081},
+		{"mov osr, status", 0xa0e5},
+		{"irq wait 0 rel", 0xc030},
+		{"irq clear 3", 0xc043},
+		{"irq nowait 1", 0xc001},
+		{"set y, 0b11111", 0xe05f},
+		{"nop [31]", 0xbf42},
+		{"set x, (2 + 3) * 2", 0xe02a},
+		{".word 0x1234", 0x1234},
+	}
+	for _, tc := range tests {
+		programs, err := Assemble(".program p\n" + tc.instr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.instr, err)
+			continue
+		}
+		if got := programs["p"].Instructions[0]; got != tc.want {
+			t.Errorf("%s: got %#04x, want %#04x", tc.instr, got, tc.want)
+		}
+	}
+}
+
+func TestAssembleDirectives(t *testing.T) {
+	programs, err := Assemble(`
+.define N 2
+.program first
+.origin 4
+.side_set 2 pindirs
+    set pins, N side 3
+.wrap_target
+loop:
+    jmp loop    side 1 [3]
+.wrap
+.program second
+public entry:
+    nop
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Program{
+		Instructions:   []uint16{0xf802, 0x0b01},
+		Origin:         4,
+		WrapTarget:     1,
+		Wrap:           1,
+		SideSetCount:   2,
+		SideSetPinDirs: true,
+	}
+	if got := programs["first"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %#v\nwant %#v", got, want)
+	}
+	if got := programs["second"].Instructions; !reflect.DeepEqual(got, []uint16{0xa042}) {
+		t.Errorf("second: got %#04x", got)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		line   int
+		err    error
+	}{
+		{"nop", 1, errNoProgram},
+		{".program p\nset x, 32", 2, errRange},
+		{".program p\njmp nowhere", 2, errUnknownSymbol},
+		{".program p\nfoo x", 2, errSyntax},
+		{".program p\nmov x, osre", 2, errSyntax},
+		{".program p\nin pins, 0", 2, errRange},
+		{".program p\n.side_set 1\nnop", 3, errSideSet},
+		{".program p\n.side_set 2\nnop side 0 [8]", 3, errRange},
+		{".program p\nnop side 1", 2, errSyntax},
+		{".program p\na:\na:\nnop", 3, errDuplicate},
+		{".program p\nirq 8", 2, errRange},
+	}
+	for _, tc := range tests {
+		_, err := Assemble(tc.source)
+		var asmErr *Error
+		if !errors.As(err, &asmErr) {
+			t.Errorf("%q: got error %v, want *Error", tc.source, err)
+			continue
+		}
+		if asmErr.Line != tc.line || !errors.Is(err, tc.err) {
+			t.Errorf("%q: got %v, want line %d: %v", tc.source, err, tc.line, tc.err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	// Build the ws2812 program with the encoding functions.
+	const sideSetCount = 1
+	got := []uint16{
+		WithSideSet(WithDelay(Out(DestX, 1), 2, sideSetCount), 0, sideSetCount, false),
+		WithSideSet(WithDelay(Jmp(JmpXZero, 3), 1, sideSetCount), 1, sideSetCount, false),
+		WithSideSet(WithDelay(Jmp(JmpAlways, 0), 4, sideSetCount), 1, sideSetCount, false),
+		WithSideSet(WithDelay(Nop(), 4, sideSetCount), 0, sideSetCount, false),
+	}
+	want := sdkPrograms[1].want.Instructions
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#04x, want %#04x", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+// Package pio assembles programs for the programmable I/O (PIO) blocks of the
+// RP2040.
+//
+// Programs can be written in the syntax of the pioasm tool from the Pico SDK
+// and assembled at runtime with Assemble, or built instruction by instruction
+// with the encoding functions of this package. The result is loaded into a PIO
+// block with machine.PIO.AddProgram, after converting it to a
+// machine.PIOProgram:
+//
+//	programs, err := pio.Assemble(source)
+//	prog := machine.PIOProgram(programs["blink"])
+//	offset, err := machine.PIO0.AddProgram(&prog)
+//
+// This package doesn't depend on the hardware, so it can be used (and tested)
+// on the host as well.
+package pio
+
+// Program is an assembled PIO program. It has the same fields as
+// machine.PIOProgram, so it can be converted to one.
+type Program struct {
+	// Instructions of the program. Jump addresses are relative to the start
+	// of the program, they are relocated when the program is loaded.
+	Instructions []uint16
+
+	// Origin is the address the program must be loaded at, or -1 if it can
+	// be loaded anywhere.
+	Origin int8
+
+	// WrapTarget and Wrap are the first and last instruction of the loop of
+	// the program, relative to the start of the program.
+	WrapTarget uint8
+	Wrap       uint8
+
+	// SideSetCount is the number of bits of the delay/side-set field that are
+	// used for side-set, including the enable bit of optional side-set.
+	SideSetCount    uint8
+	SideSetOptional bool
+
+	// SideSetPinDirs is true when side-set changes the pin directions
+	// instead of the pin values.
+	SideSetPinDirs bool
+}
+
+// JmpCondition is the condition of a JMP instruction.
+type JmpCondition uint8
+
+const (
+	JmpAlways          JmpCondition = iota
+	JmpXZero                        // !X
+	JmpXNotZeroPostDec              // X--
+	JmpYZero                        // !Y
+	JmpYNotZeroPostDec              // Y--
+	JmpXNotEqualY                   // X!=Y
+	JmpPin                          // PIN
+	JmpOSRNotEmpty                  // !OSRE
+)
+
+// WaitSource is the source of a WAIT instruction.
+type WaitSource uint8
+
+const (
+	WaitGPIO WaitSource = iota
+	WaitPin
+	WaitIRQ
+)
+
+// Source is the source of an IN or MOV instruction.
+type Source uint8
+
+const (
+	SrcPins   Source = 0
+	SrcX      Source = 1
+	SrcY      Source = 2
+	SrcNull   Source = 3
+	SrcStatus Source = 5 // MOV only
+	SrcISR    Source = 6
+	SrcOSR    Source = 7
+)
+
+// Destination is the destination of an OUT, MOV or SET instruction. Not all
+// destinations are valid for every instruction.
+type Destination uint8
+
+const (
+	DestPins    Destination = 0 // OUT, MOV, SET
+	DestX       Destination = 1 // OUT, MOV, SET
+	DestY       Destination = 2 // OUT, MOV, SET
+	DestNull    Destination = 3 // OUT
+	DestPinDirs Destination = 4 // OUT, SET
+	DestExec    Destination = 4 // MOV (OUT: DestOutExec)
+	DestPC      Destination = 5 // OUT, MOV
+	DestISR     Destination = 6 // OUT, MOV
+	DestOSR     Destination = 7 // MOV
+	DestOutExec Destination = 7 // OUT
+)
+
+// MovOp is the operation a MOV instruction applies to the data.
+type MovOp uint8
+
+const (
+	MovNone MovOp = iota
+	MovInvert
+	MovBitReverse
+)
+
+// Opcodes in bits 15:13 of an instruction.
+const (
+	opJmp  = 0 << 13
+	opWait = 1 << 13
+	opIn   = 2 << 13
+	opOut  = 3 << 13
+	opPush = 4 << 13 // also PULL
+	opMov  = 5 << 13
+	opIrq  = 6 << 13
+	opSet  = 7 << 13
+)
+
+// Jmp encodes a JMP instruction to the given address.
+func Jmp(cond JmpCondition, addr uint8) uint16 {
+	return opJmp | uint16(cond&7)<<5 | uint16(addr&0x1f)
+}
+
+// Wait encodes a WAIT instruction. For WaitIRQ, the index can be made relative
+// to the state machine by adding IRQRel.
+func Wait(polarity bool, src WaitSource, index uint8) uint16 {
+	return opWait | uint16(boolToBit(polarity))<<7 | uint16(src&3)<<5 | uint16(index&0x1f)
+}
+
+// IRQRel makes an IRQ index relative to the state machine number.
+const IRQRel = 0x10
+
+// In encodes an IN instruction, which shifts bitCount (1-32) bits into the
+// ISR.
+func In(src Source, bitCount uint8) uint16 {
+	return opIn | uint16(src&7)<<5 | uint16(bitCount&0x1f)
+}
+
+// Out encodes an OUT instruction, which shifts bitCount (1-32) bits out of
+// the OSR.
+func Out(dest Destination, bitCount uint8) uint16 {
+	return opOut | uint16(dest&7)<<5 | uint16(bitCount&0x1f)
+}
+
+// Push encodes a PUSH instruction.
+func Push(ifFull, block bool) uint16 {
+	return opPush | uint16(boolToBit(ifFull))<<6 | uint16(boolToBit(block))<<5
+}
+
+// Pull encodes a PULL instruction.
+func Pull(ifEmpty, block bool) uint16 {
+	return opPush | 1<<7 | uint16(boolToBit(ifEmpty))<<6 | uint16(boolToBit(block))<<5
+}
+
+// Mov encodes a MOV instruction.
+func Mov(dest Destination, op MovOp, src Source) uint16 {
+	return opMov | uint16(dest&7)<<5 | uint16(op&3)<<3 | uint16(src&7)
+}
+
+// Irq encodes an IRQ instruction, which sets the flag with the given index,
+// or clears it if clear is set. The index can be made relative to the state
+// machine by adding IRQRel.
+func Irq(clear, wait bool, index uint8) uint16 {
+	return opIrq | uint16(boolToBit(clear))<<6 | uint16(boolToBit(wait))<<5 | uint16(index&0x1f)
+}
+
+// Set encodes a SET instruction with a 5-bit value.
+func Set(dest Destination, value uint8) uint16 {
+	return opSet | uint16(dest&7)<<5 | uint16(value&0x1f)
+}
+
+// Nop encodes a NOP, which is assembled as MOV Y, Y.
+func Nop() uint16 {
+	return Mov(DestY, MovNone, SrcY)
+}
+
+// WithDelay returns the instruction with the given delay in cycles, for a
+// program that uses sideSetCount bits for side-set.
+func WithDelay(instr uint16, delay, sideSetCount uint8) uint16 {
+	return instr | uint16(delay&(0x1f>>sideSetCount))<<8
+}
+
+// WithSideSet returns the instruction with the given side-set value, for a
+// program that uses sideSetCount bits for side-set (including the enable bit
+// if optional is set).
+func WithSideSet(instr uint16, value, sideSetCount uint8, optional bool) uint16 {
+	if optional {
+		value |= 1 << (sideSetCount - 1)
+	}
+	return instr | uint16(value)<<(13-sideSetCount)
+}
+
+func boolToBit(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,186 @@
+//go:build rp2040 || nrf52 || nrf52840 || nrf52833 || (sam && atsamd21) || (sam && atsamd51) || (sam && atsame5x) || stm32f4 || esp32c3
+
+package machine
+
+import (
+	"errors"
+	"runtime/interrupt"
+	"time"
+	_ "unsafe" // for go:linkname
+)
+
+var (
+	ErrRTCNotSet        = errors.New("RTC time has not been set")
+	ErrRTCInvalidTime   = errors.New("RTC time is out of range")
+	ErrRtcDelayTooSmall = errors.New("RTC interrupt deplay is too small, shall be at least 1 second")
+	ErrRtcDelayTooLarge = errors.New("RTC interrupt deplay is too large, shall be no more than 1 day")
+)
+
+// realTimeClock must be implemented by all chips with a real-time clock.
+//
+// The RP2040 and STM32F4 have a hardware calendar that RTC reads and sets. On
+// the nRF52, SAMD21, SAMD51 and ESP32-C3 the runtime already uses the RTC (or
+// the only suitable timer) for time.Now, so there RTC is a software clock on
+// top of the runtime timer, which uses the same crystal.
+//
+// Of the STM32 families, only the STM32F4 has an RTC implementation so far. The
+// RTC peripheral of the other families is similar, but its clock setup in the
+// RCC differs, so RTC isn't defined there yet.
+type realTimeClock interface {
+	SetTime(t time.Time) error
+	Time() (time.Time, error)
+	SetAlarm(t time.Time, callback func()) error
+	DisableAlarm()
+	SetInterrupt(delay uint32, repeat bool, callback func()) error
+}
+
+// The chip specific part of the RTC implements these methods:
+//
+//	start()              start the clock if it isn't running yet
+//	valid() bool         whether the clock holds a time that was set
+//	setUnix(sec int64)   set the clock
+//	now() time.Time      read the clock
+//	armAlarm(sec int64)  call rtcHandleAlarm at the given time, or as soon as possible if it has passed
+//	disarmAlarm()        disable the alarm
+
+// Make sure all chips implement the same API.
+var _ realTimeClock = RTC
+
+const (
+	second = 1
+	minute = 60 * second
+	hour   = 60 * minute
+	day    = 24 * hour
+)
+
+var (
+	rtcTimeSet       bool   // SetTime has been called
+	rtcAlarmEnabled  bool   // an alarm or interrupt has been set
+	rtcAlarmTime     int64  // Unix time of the alarm
+	rtcAlarmInterval uint32 // interval of a repeating interrupt, in seconds
+	rtcCallback      func()
+)
+
+//go:linkname setWallClock runtime.setWallClock
+func setWallClock(unixNano int64)
+
+// SetTime sets the clock to the given time, with a resolution of one second on
+// chips with a hardware calendar. From then on time.Now returns the same
+// wall-clock time, so this is how a program that gets the time from an NTP
+// server, a GPS receiver or the host should set it.
+//
+// Interrupts configured with SetInterrupt keep their delay, alarms configured
+// with SetAlarm keep their time.
+func (rtc *rtcType) SetTime(t time.Time) error {
+	sec := t.Unix()
+	if sec < rtcMinTime || sec > rtcMaxTime {
+		return ErrRTCInvalidTime
+	}
+	rtc.start()
+	delta := sec - rtc.now().Unix()
+	rtc.setUnix(sec)
+	setWallClock(t.UnixNano())
+	rtcTimeSet = true
+
+	mask := interrupt.Disable()
+	if rtcAlarmEnabled {
+		if rtcAlarmInterval != 0 {
+			rtcAlarmTime += delta
+		}
+		rtc.armAlarm(rtcAlarmTime)
+	}
+	interrupt.Restore(mask)
+	return nil
+}
+
+// Time returns the current time of the clock, or ErrRTCNotSet if it hasn't
+// been set since the clock was last reset.
+func (rtc *rtcType) Time() (time.Time, error) {
+	if !rtc.valid() {
+		return time.Time{}, ErrRTCNotSet
+	}
+	return rtc.now(), nil
+}
+
+// SetAlarm calls callback once at the given time, replacing the alarm or
+// interrupt that was set before. The time must have been set with SetTime.
+//
+// The callback is executed in the context of an interrupt handler, so regular
+// restrictions for this sort of code apply: no blocking, no memory allocation,
+// etc.
+func (rtc *rtcType) SetAlarm(t time.Time, callback func()) error {
+	if !rtc.valid() {
+		return ErrRTCNotSet
+	}
+	sec := t.Unix()
+	if sec < rtcMinTime || sec > rtcMaxTime {
+		return ErrRTCInvalidTime
+	}
+	rtc.enableAlarm(sec, 0, callback)
+	return nil
+}
+
+// DisableAlarm disables the alarm or interrupt, if any.
+func (rtc *rtcType) DisableAlarm() {
+	mask := interrupt.Disable()
+	rtc.disarmAlarm()
+	rtcAlarmEnabled = false
+	rtcCallback = nil
+	interrupt.Restore(mask)
+}
+
+// SetInterrupt configures delayed and optionally recurring interrupt by real time clock.
+//
+// Delay is specified in whole seconds, up to 1 day, otherwise a respective
+// error is emitted. Zero delay disables previously configured interrupt, if
+// any. The interrupt works without setting the time first.
+//
+// The callback is executed in the context of an interrupt handler, so regular
+// restrictions for this sort of code apply: no blocking, no memory allocation,
+// etc.
+func (rtc *rtcType) SetInterrupt(delay uint32, repeat bool, callback func()) error {
+	// Verify delay range
+	if delay > day {
+		return ErrRtcDelayTooLarge
+	}
+
+	// De-configure delayed interrupt if delay is zero
+	if delay == 0 {
+		rtc.DisableAlarm()
+		return nil
+	}
+
+	rtc.start()
+	interval := uint32(0)
+	if repeat {
+		interval = delay
+	}
+	rtc.enableAlarm(rtc.now().Unix()+int64(delay), interval, callback)
+	return nil
+}
+
+func (rtc *rtcType) enableAlarm(sec int64, interval uint32, callback func()) {
+	mask := interrupt.Disable()
+	rtcAlarmEnabled = true
+	rtcAlarmTime = sec
+	rtcAlarmInterval = interval
+	rtcCallback = callback
+	rtc.armAlarm(sec)
+	interrupt.Restore(mask)
+}
+
+// rtcHandleAlarm is called from the interrupt handler of the chip once the
+// alarm time has been reached. The chip disables the alarm before calling it.
+func rtcHandleAlarm() {
+	callback := rtcCallback
+	if rtcAlarmInterval != 0 {
+		rtcAlarmTime += int64(rtcAlarmInterval)
+		RTC.armAlarm(rtcAlarmTime)
+	} else {
+		rtcAlarmEnabled = false
+		rtcCallback = nil
+	}
+	if callback != nil {
+		callback()
+	}
+}
@@ -0,0 +1,46 @@
+//go:build nrf52 || nrf52840 || nrf52833 || (sam && atsamd21) || (sam && atsamd51) || (sam && atsame5x) || esp32c3
+
+package machine
+
+import (
+	"time"
+	_ "unsafe" // for go:linkname
+)
+
+// On these chips the runtime uses the RTC (or the only suitable timer) for
+// time.Now, so the RTC is kept in software: setting it sets the time offset of
+// the runtime, and alarms use a second compare channel of the runtime timer.
+type rtcType struct{}
+
+// RTC is the real-time clock.
+var RTC = &rtcType{}
+
+const (
+	rtcMinTime = 0          // 1970-01-01 00:00:00
+	rtcMaxTime = 4102444799 // 2099-12-31 23:59:59
+)
+
+//go:linkname setRTCAlarm runtime.setRTCAlarm
+func setRTCAlarm(unixNano int64, hook func())
+
+func (rtc *rtcType) start() {}
+
+func (rtc *rtcType) valid() bool {
+	return rtcTimeSet
+}
+
+func (rtc *rtcType) setUnix(sec int64) {
+	// The wall-clock time of the runtime is the clock.
+}
+
+func (rtc *rtcType) now() time.Time {
+	return time.Now()
+}
+
+func (rtc *rtcType) armAlarm(sec int64) {
+	setRTCAlarm(sec*int64(time.Second), rtcHandleAlarm)
+}
+
+func (rtc *rtcType) disarmAlarm() {
+	setRTCAlarm(0, nil)
+}
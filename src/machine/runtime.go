@@ -1,7 +1,8 @@
 package machine
 
 import (
-	_ "unsafe"
+	"time"
+	"unsafe"
 )
 
 //
@@ -11,3 +12,37 @@ import (
 
 //go:linkname gosched runtime.Gosched
 func gosched()
+
+// cond is a runtime.Cond: a condition variable that can be notified from an
+// interrupt, and waited on by a single goroutine. It has room for a
+// runtime.Cond, which holds a task pointer (or a bool with -scheduler=none).
+type cond struct {
+	t     unsafe.Pointer
+	timer unsafe.Pointer // runtime timer for WaitTimeout, allocated on first use
+}
+
+// Notify sends a notification. It can be called from an interrupt.
+func (c *cond) Notify() {
+	condNotify(unsafe.Pointer(c))
+}
+
+// Wait blocks the current goroutine until a notification is sent, or returns
+// immediately if one was sent since the last call to Wait.
+func (c *cond) Wait() {
+	condWait(unsafe.Pointer(c))
+}
+
+// WaitTimeout is like Wait, but gives up after the timeout. It reports
+// whether a notification was received.
+func (c *cond) WaitTimeout(timeout time.Duration) bool {
+	return condWaitTimeout(unsafe.Pointer(c), &c.timer, int64(timeout))
+}
+
+//go:linkname condNotify runtime.machineCondNotify
+func condNotify(c unsafe.Pointer)
+
+//go:linkname condWait runtime.machineCondWait
+func condWait(c unsafe.Pointer)
+
+//go:linkname condWaitTimeout runtime.machineCondWaitTimeout
+func condWaitTimeout(c unsafe.Pointer, timer *unsafe.Pointer, timeout int64) bool
@@ -1,6 +1,9 @@
 package machine
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var errNoByte = errors.New("machine: no byte read")
 
@@ -11,6 +14,70 @@ type UARTConfig struct {
 	BaudRate uint32
 	TX       Pin
 	RX       Pin
+
+	// RXBufferSize is the size of the receive ring buffer, rounded up to a
+	// power of two. Zero keeps the buffer the UART already has (128 bytes by
+	// default).
+	RXBufferSize int
+
+	// TXBufferSize is the size of the transmit ring buffer, rounded up to a
+	// power of two. With a transmit buffer, writes return as soon as the data
+	// is in the buffer and an interrupt sends it. Zero means writes wait until
+	// each byte has been handed to the hardware. Chips without interrupt-driven
+	// transmission ignore it.
+	TXBufferSize int
+
+	// ReadTimeout is how long Read waits for data when the receive buffer is
+	// empty, letting other goroutines run in the meantime. Zero means Read
+	// doesn't wait, a negative value means it waits until there is data.
+	ReadTimeout time.Duration
+
+	// ReportErrors makes Read return a UARTError when the UART detected
+	// receive errors (overrun, framing or parity errors) since the previous
+	// Read. By default, these errors are ignored.
+	ReportErrors bool
+}
+
+// UARTError is returned by Read when the UART detected receive errors since
+// the previous Read, if ReportErrors is set in the UARTConfig. It is a set of
+// flags, so a single error can be checked with
+// errors.Is(err, machine.ErrUARTOverrun). The data around an error may be
+// missing or corrupt, so this is a good moment to resynchronize a protocol.
+//
+// Not all chips detect all errors.
+type UARTError uint8
+
+const (
+	// ErrUARTOverrun means received data was lost, because the hardware
+	// or the receive ring buffer was full.
+	ErrUARTOverrun UARTError = 1 << iota
+
+	// ErrUARTFraming means a byte didn't end with a stop bit, usually because
+	// of a wrong baud rate or a break condition on the line.
+	ErrUARTFraming
+
+	// ErrUARTParity means the parity bit of a byte didn't match.
+	ErrUARTParity
+)
+
+func (e UARTError) Error() string {
+	msg := "UART"
+	if e&ErrUARTOverrun != 0 {
+		msg += " overrun"
+	}
+	if e&ErrUARTFraming != 0 {
+		msg += " framing"
+	}
+	if e&ErrUARTParity != 0 {
+		msg += " parity"
+	}
+	return msg + " error"
+}
+
+// Is reports whether all errors in target occurred.
+func (e UARTError) Is(target error) bool {
+	t, ok := target.(UARTError)
+	return ok && t != 0 && e&t == t
 }
 
 // NullSerial is a serial version of /dev/null (or null router): it drops
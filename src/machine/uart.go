@@ -2,9 +2,35 @@
 
 package machine
 
-import "errors"
+import (
+	"errors"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"time"
+)
+
+var (
+	errUARTBufferEmpty = errors.New("UART buffer empty")
+
+	// ErrUARTReadTimeout is returned by Read when no data arrived within the
+	// ReadTimeout of the UARTConfig.
+	ErrUARTReadTimeout = errors.New("UART read timeout")
+)
+
+// uartState is the part of the UART state that is the same for all chips.
+// Every UART type embeds it.
+type uartState struct {
+	// txRing holds data for the TX interrupt to send, if there is a transmit
+	// buffer. See uart_txbuffer.go.
+	txRing *RingBuffer
+
+	readTimeout  time.Duration
+	reportErrors bool               // whether Read returns receive errors
+	rxErrors     volatile.Register8 // UARTError flags since the last Read
 
-var errUARTBufferEmpty = errors.New("UART buffer empty")
+	rxReady cond // notified when data or a receive error arrives
+	txEmpty cond // notified when the TX interrupt emptied the transmit buffer
+}
 
 // UARTParity is the parity setting to be used for UART communication.
 type UARTParity uint8
@@ -27,22 +53,48 @@ const (
 //
 // 		type UART struct {
 // 			Buffer *RingBuffer
+// 			uartState
 // 		}
 //
 // You can also add additional members to this struct depending on your implementation,
-// but the *RingBuffer is required.
+// but the *RingBuffer and the embedded uartState are required. Configure must
+// call configureBuffers.
 // When you are declaring your UARTs for your board, make sure that you also declare the
 // RingBuffer using the NewRingBuffer() function when you declare your UART:
 //
 //		UART{Buffer: NewRingBuffer()}
 //
 
-// Read from the RX buffer.
+// configureBuffers applies the buffer sizes and the read timeout of the
+// config. Chips that send data from an interrupt handler pass txInterrupt, the
+// others don't get a transmit buffer.
+func (uart *UART) configureBuffers(config UARTConfig, txInterrupt bool) {
+	if config.RXBufferSize != 0 && (uart.Buffer == nil || uart.Buffer.Size() != ringBufferSize(config.RXBufferSize)) {
+		uart.Buffer = NewRingBufferSize(config.RXBufferSize)
+	}
+	if !txInterrupt || config.TXBufferSize == 0 {
+		uart.txRing = nil
+	} else if uart.txRing == nil || uart.txRing.Size() != ringBufferSize(config.TXBufferSize) {
+		uart.txRing = NewRingBufferSize(config.TXBufferSize)
+	}
+	uart.readTimeout = config.ReadTimeout
+	uart.reportErrors = config.ReportErrors
+	uart.rxErrors.Set(0)
+}
+
+// Read from the RX buffer. If the buffer is empty, Read waits for data as long
+// as the ReadTimeout of the UARTConfig, letting other goroutines run. It
+// returns ErrUARTReadTimeout if no data arrived in time. With ReportErrors set
+// in the UARTConfig, Read returns the data that it has together with a
+// UARTError when the UART detected receive errors since the previous Read.
 func (uart *UART) Read(data []byte) (n int, err error) {
 	// check if RX buffer is empty
 	size := uart.Buffered()
+	if size == 0 && len(data) != 0 {
+		size, err = uart.waitForData()
+	}
 	if size == 0 {
-		return 0, nil
+		return 0, err
 	}
 
 	// Make sure we do not read more from buffer than the data slice can hold.
@@ -56,9 +108,57 @@ func (uart *UART) Read(data []byte) (n int, err error) {
 		data[i] = v
 	}
 
+	if errs := uart.takeErrors(); errs != 0 {
+		return size, errs
+	}
 	return size, nil
 }
 
+// waitForData waits until there is data in the RX buffer, a receive error or
+// the read timeout, and returns the number of buffered bytes. The goroutine is
+// woken up by the RX interrupt, or by a timer for the read timeout.
+func (uart *UART) waitForData() (int, error) {
+	var deadline time.Time
+	if uart.readTimeout > 0 {
+		deadline = time.Now().Add(uart.readTimeout)
+	}
+	timedOut := false
+	for {
+		if size := uart.Buffered(); size != 0 {
+			return size, nil
+		}
+		if errs := uart.takeErrors(); errs != 0 {
+			return 0, errs
+		}
+		if uart.readTimeout == 0 {
+			return 0, nil
+		}
+		if timedOut {
+			return 0, ErrUARTReadTimeout
+		}
+		if uart.readTimeout < 0 {
+			uart.rxReady.Wait()
+		} else {
+			// Check the buffer once more after a timeout, in case data
+			// arrived at the same time.
+			timedOut = !uart.rxReady.WaitTimeout(time.Until(deadline))
+		}
+	}
+}
+
+// takeErrors returns and clears the receive errors since the last call. It
+// returns no errors unless they are reported.
+func (uart *UART) takeErrors() UARTError {
+	if !uart.reportErrors || uart.rxErrors.Get() == 0 {
+		return 0
+	}
+	mask := interrupt.Disable()
+	errs := UARTError(uart.rxErrors.Get())
+	uart.rxErrors.Set(0)
+	interrupt.Restore(mask)
+	return errs
+}
+
 // Write data to the UART.
 func (uart *UART) Write(data []byte) (n int, err error) {
 	for _, v := range data {
@@ -80,11 +180,24 @@ func (uart *UART) ReadByte() (byte, error) {
 
 // Buffered returns the number of bytes currently stored in the RX buffer.
 func (uart *UART) Buffered() int {
-	return int(uart.Buffer.Used())
+	return uart.Buffer.Len()
 }
 
 // Receive handles adding data to the UART's data buffer.
 // Usually called by the IRQ handler for a machine.
 func (uart *UART) Receive(data byte) {
-	uart.Buffer.Put(data)
+	if !uart.Buffer.Put(data) {
+		uart.receiveError(ErrUARTOverrun)
+	}
+	uart.rxReady.Notify()
+}
+
+// receiveError records receive errors for the next Read. It is called by the
+// IRQ handler of the chip.
+func (uart *UART) receiveError(errs UARTError) {
+	if !uart.reportErrors {
+		return
+	}
+	uart.rxErrors.Set(uart.rxErrors.Get() | uint8(errs))
+	uart.rxReady.Notify()
 }
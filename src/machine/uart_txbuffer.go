@@ -0,0 +1,67 @@
+//go:build rp2040 || nrf || (sam && atsamd21) || (sam && atsamd51) || (sam && atsame5x) || stm32
+
+package machine
+
+import "runtime/interrupt"
+
+// Interrupt-driven transmission for the UARTs of these chips. They implement:
+//
+//	txReady() bool              whether the transmitter can take another byte
+//	txWrite(c byte)             hand a byte to the transmitter
+//	setTXInterrupt(enable bool) enable the interrupt that fires while txReady
+//
+// and call handleTXInterrupt from their interrupt handler.
+
+// writeBuffered puts c in the transmit ring buffer for the TX interrupt to
+// send. When the ring buffer is full, it waits for the TX interrupt to make
+// room with interrupts enabled. It also sends a byte itself once the
+// transmitter is ready, so that it works in interrupt handlers and with
+// interrupts disabled.
+func (uart *UART) writeBuffered(c byte) {
+	for {
+		mask := interrupt.Disable()
+		if uart.txRing.Len() == 0 && uart.txReady() {
+			// Nothing is waiting, so the byte can go out directly.
+			uart.txWrite(c)
+			interrupt.Restore(mask)
+			return
+		}
+		if uart.txRing.Put(c) {
+			uart.setTXInterrupt(true)
+			interrupt.Restore(mask)
+			return
+		}
+		if uart.txReady() {
+			b, _ := uart.txRing.Get()
+			uart.txWrite(b)
+		}
+		interrupt.Restore(mask)
+	}
+}
+
+// handleTXInterrupt moves data from the transmit ring buffer to the
+// transmitter, and disables the TX interrupt once the buffer is empty.
+func (uart *UART) handleTXInterrupt() {
+	if uart.txRing == nil {
+		uart.setTXInterrupt(false)
+		return
+	}
+	for uart.txReady() {
+		c, ok := uart.txRing.Get()
+		if !ok {
+			uart.setTXInterrupt(false)
+			uart.txEmpty.Notify()
+			return
+		}
+		uart.txWrite(c)
+	}
+}
+
+// flushTX waits until the transmit ring buffer is empty, letting other
+// goroutines run. The TX interrupt stays enabled until it finds the buffer
+// empty, so it always wakes up the goroutine.
+func (uart *UART) flushTX() {
+	for uart.txRing != nil && uart.txRing.Len() != 0 {
+		uart.txEmpty.Wait()
+	}
+}
@@ -5,6 +5,7 @@ package machine
 import (
 	"machine/usb"
 	"machine/usb/descriptor"
+	"runtime/interrupt"
 
 	"errors"
 )
@@ -116,7 +117,8 @@ var usb_trans_buffer [255]uint8
 var (
 	usbTxHandler    [usb.NumberOfEndpoints]func()
 	usbRxHandler    [usb.NumberOfEndpoints]func([]byte)
-	usbSetupHandler [usb.NumberOfInterfaces]func(usb.Setup) bool
+	usbRxPaused     [usb.NumberOfEndpoints]bool
+	usbSetupHandler [usbMaxInterfaces]func(usb.Setup) bool
 
 	endPoints = []uint32{
 		usb.CONTROL_ENDPOINT:  usb.ENDPOINT_TYPE_CONTROL,
@@ -146,9 +148,17 @@ func sendDescriptor(setup usb.Setup) {
 			usbDescriptor = descriptor.CDCMIDI
 		case (usbDescriptorConfig & usb.DescriptorConfigJoystick) > 0:
 			usbDescriptor = descriptor.CDCJoystick
+		case (usbDescriptorConfig & usb.DescriptorConfigMSC) > 0:
+			usbDescriptor = descriptor.CDCMSC
+		case (usbDescriptorConfig & usb.DescriptorConfigNCM) > 0:
+			usbDescriptor = descriptor.CDCNCM
 		default:
 			usbDescriptor = descriptor.CDC
 		}
+		if len(usbInterfaces) > 0 || len(usbExtraDescriptors) > 0 {
+			// user-defined interfaces
+			usbDescriptor = usbCompositeDescriptor(usbDescriptor)
+		}
 
 		usbDescriptor.Configure(usbVendorID(), usbProductID())
 		sendUSBPacket(0, usbDescriptor.Device, setup.WLength)
@@ -176,6 +186,17 @@ func sendDescriptor(setup usb.Setup) {
 		case usb.ISERIAL:
 			// TODO: allow returning a product serial number
 			SendZlp()
+
+		default:
+			for _, str := range usbStrings {
+				if str.index == setup.WValueL {
+					b := usb_trans_buffer[:(len(str.s)<<1)+2]
+					strToUTF16LEDescriptor(str.s, b)
+					sendUSBPacket(0, b, setup.WLength)
+					return
+				}
+			}
+			SendZlp()
 		}
 		return
 	case descriptor.TypeHIDReport:
@@ -186,6 +207,12 @@ func sendDescriptor(setup usb.Setup) {
 	case descriptor.TypeDeviceQualifier:
 		// skip
 	default:
+		for _, d := range usbExtraDescriptors {
+			if d.descriptorType == setup.WValueH {
+				sendUSBPacket(0, d.data, setup.WLength)
+				return
+			}
+		}
 	}
 
 	// do not know how to handle this message, so return zero
@@ -272,6 +299,42 @@ func handleStandardSetup(setup usb.Setup) bool {
 	}
 }
 
+// PauseUSBOutEndpoint stops receiving data on the given OUT endpoint after the
+// current packet, until ResumeUSBOutEndpoint is called. The host retries
+// sending in the meantime. It must be called from the receive handler of the
+// endpoint, and can be used by a class that can't process the received data
+// right away, for example because it needs to write it to flash first.
+func PauseUSBOutEndpoint(ep uint32) {
+	usbRxPaused[ep] = true
+}
+
+// ResumeUSBOutEndpoint continues receiving data on an OUT endpoint that was
+// paused with PauseUSBOutEndpoint. It may be called from any goroutine.
+func ResumeUSBOutEndpoint(ep uint32) {
+	mask := interrupt.Disable()
+	if usbRxPaused[ep] {
+		usbRxPaused[ep] = false
+		handleEndpointRxComplete(ep)
+	}
+	interrupt.Restore(mask)
+}
+
+// handleClassSetup handles the setup requests that aren't standard requests.
+// Vendor requests to the device go to the vendor setup handler, all others to
+// the setup handler of the interface in wIndex.
+func handleClassSetup(setup usb.Setup) bool {
+	if setup.BmRequestType&(usb.REQUEST_TYPE|usb.REQUEST_RECIPIENT) == usb.REQUEST_VENDOR|usb.REQUEST_DEVICE {
+		if usbVendorSetupHandler != nil {
+			return usbVendorSetupHandler(setup)
+		}
+		return false
+	}
+	if setup.WIndex < uint16(len(usbSetupHandler)) && usbSetupHandler[setup.WIndex] != nil {
+		return usbSetupHandler[setup.WIndex](setup)
+	}
+	return false
+}
+
 func EnableCDC(txHandler func(), rxHandler func([]byte), setupHandler func(usb.Setup) bool) {
 	usbDescriptorConfig |= usb.DescriptorConfigCDC
 	endPoints[usb.CDC_ENDPOINT_ACM] = (usb.ENDPOINT_TYPE_INTERRUPT | usb.EndpointIn)
@@ -286,6 +349,7 @@ func EnableCDC(txHandler func(), rxHandler func([]byte), setupHandler func(usb.S
 // EnableHID enables HID. This function must be executed from the init().
 func EnableHID(txHandler func(), rxHandler func([]byte), setupHandler func(usb.Setup) bool) {
 	usbDescriptorConfig |= usb.DescriptorConfigHID
+	reserveUSBEndpoints(usb.HID_ENDPOINT_IN)
 	endPoints[usb.HID_ENDPOINT_IN] = (usb.ENDPOINT_TYPE_INTERRUPT | usb.EndpointIn)
 	usbTxHandler[usb.HID_ENDPOINT_IN] = txHandler
 	usbSetupHandler[usb.HID_INTERFACE] = setupHandler // 0x03 (HID - Human Interface Device)
@@ -294,12 +358,42 @@ func EnableHID(txHandler func(), rxHandler func([]byte), setupHandler func(usb.S
 // EnableMIDI enables MIDI. This function must be executed from the init().
 func EnableMIDI(txHandler func(), rxHandler func([]byte), setupHandler func(usb.Setup) bool) {
 	usbDescriptorConfig |= usb.DescriptorConfigMIDI
+	reserveUSBEndpoints(usb.MIDI_ENDPOINT_IN, usb.MIDI_ENDPOINT_OUT)
 	endPoints[usb.MIDI_ENDPOINT_OUT] = (usb.ENDPOINT_TYPE_BULK | usb.EndpointOut)
 	endPoints[usb.MIDI_ENDPOINT_IN] = (usb.ENDPOINT_TYPE_BULK | usb.EndpointIn)
 	usbRxHandler[usb.MIDI_ENDPOINT_OUT] = rxHandler
 	usbTxHandler[usb.MIDI_ENDPOINT_IN] = txHandler
 }
 
+// EnableMSC enables USB Mass Storage. This function must be executed from the
+// init(). It uses the same endpoints as MIDI, so both can't be enabled at the
+// same time.
+func EnableMSC(txHandler func(), rxHandler func([]byte), setupHandler func(usb.Setup) bool) {
+	usbDescriptorConfig |= usb.DescriptorConfigMSC
+	reserveUSBEndpoints(usb.MSC_ENDPOINT_IN, usb.MSC_ENDPOINT_OUT)
+	endPoints[usb.MSC_ENDPOINT_OUT] = (usb.ENDPOINT_TYPE_BULK | usb.EndpointOut)
+	endPoints[usb.MSC_ENDPOINT_IN] = (usb.ENDPOINT_TYPE_BULK | usb.EndpointIn)
+	usbRxHandler[usb.MSC_ENDPOINT_OUT] = rxHandler
+	usbTxHandler[usb.MSC_ENDPOINT_IN] = txHandler
+	usbSetupHandler[usb.MSC_INTERFACE] = setupHandler // 0x08 (Mass Storage)
+}
+
+// EnableNCM enables the CDC-NCM network interface. This function must be
+// executed from the init(). It uses the same endpoints as HID and MIDI, so it
+// can't be enabled together with those.
+func EnableNCM(txHandler func(), rxHandler func([]byte), setupHandler func(usb.Setup) bool, notifyHandler func()) {
+	usbDescriptorConfig |= usb.DescriptorConfigNCM
+	reserveUSBEndpoints(usb.NCM_ENDPOINT_INT, usb.NCM_ENDPOINT_IN, usb.NCM_ENDPOINT_OUT)
+	endPoints[usb.NCM_ENDPOINT_INT] = (usb.ENDPOINT_TYPE_INTERRUPT | usb.EndpointIn)
+	endPoints[usb.NCM_ENDPOINT_OUT] = (usb.ENDPOINT_TYPE_BULK | usb.EndpointOut)
+	endPoints[usb.NCM_ENDPOINT_IN] = (usb.ENDPOINT_TYPE_BULK | usb.EndpointIn)
+	usbTxHandler[usb.NCM_ENDPOINT_INT] = notifyHandler
+	usbRxHandler[usb.NCM_ENDPOINT_OUT] = rxHandler
+	usbTxHandler[usb.NCM_ENDPOINT_IN] = txHandler
+	usbSetupHandler[usb.NCM_INTERFACE] = setupHandler // 0x02 (CDC NCM)
+	usbSetupHandler[usb.NCM_DATA_INTERFACE] = nil     // 0x0A (CDC-Data)
+}
+
 // EnableJoystick enables HID. This function must be executed from the init().
 func EnableJoystick(txHandler func(), rxHandler func([]byte), setupHandler func(usb.Setup) bool, hidDesc []byte) {
 	class, err := descriptor.FindClassHIDType(descriptor.CDCJoystick.Configuration, descriptor.ClassHIDJoystick.Bytes())
@@ -312,6 +406,7 @@ func EnableJoystick(txHandler func(), rxHandler func([]byte), setupHandler func(
 	descriptor.CDCJoystick.HID[2] = hidDesc
 
 	usbDescriptorConfig |= usb.DescriptorConfigJoystick
+	reserveUSBEndpoints(usb.HID_ENDPOINT_IN, usb.HID_ENDPOINT_OUT)
 	endPoints[usb.HID_ENDPOINT_OUT] = (usb.ENDPOINT_TYPE_INTERRUPT | usb.EndpointOut)
 	usbRxHandler[usb.HID_ENDPOINT_OUT] = rxHandler
 	endPoints[usb.HID_ENDPOINT_IN] = (usb.ENDPOINT_TYPE_INTERRUPT | usb.EndpointIn)
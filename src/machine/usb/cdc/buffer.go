@@ -20,8 +20,8 @@ func NewRxRingBuffer() *rxRingBuffer {
 }
 
 // Used returns how many bytes in buffer have been used.
-func (rb *rxRingBuffer) Used() uint8 {
-	return uint8(rb.head.Get() - rb.tail.Get())
+func (rb *rxRingBuffer) Used() int {
+	return int(uint8(rb.head.Get() - rb.tail.Get()))
 }
 
 // Put stores a byte in the buffer. If the buffer is already
@@ -70,8 +70,8 @@ func NewTxRingBuffer() *txRingBuffer {
 }
 
 // Used returns how many bytes in buffer have been used.
-func (rb *txRingBuffer) Used() uint8 {
-	return uint8(rb.head.Get() - rb.tail.Get())
+func (rb *txRingBuffer) Used() int {
+	return int(uint8(rb.head.Get() - rb.tail.Get()))
 }
 
 // Put stores a byte in the buffer. If the buffer is already
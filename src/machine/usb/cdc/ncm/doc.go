@@ -0,0 +1,13 @@
+// package ncm is for USB CDC Network Control Model (NCM) devices. It presents
+// the board to the host as an Ethernet adapter, next to the default CDC serial
+// port.
+//
+// The package works on the level of Ethernet frames: received frames are
+// passed to the handler set with SetHandler, and frames are sent with Send. An
+// IP stack is needed on top of it to talk to the host. Both Linux and macOS
+// support NCM devices without installing a driver.
+//
+// The host and the board each have their own MAC address. The address of the
+// host side is set with SetHostMACAddress, the IP stack on the board must use
+// a different address.
+package ncm
@@ -0,0 +1,281 @@
+//go:build sam || nrf52840 || rp2040
+
+package ncm
+
+import (
+	"encoding/binary"
+	"errors"
+	"machine"
+	"machine/usb"
+	"runtime/interrupt"
+)
+
+var (
+	ErrNotConnected = errors.New("ncm: not connected")
+	ErrBusy         = errors.New("ncm: busy sending the previous frame")
+)
+
+const (
+	ncmEndpointInt = usb.NCM_ENDPOINT_INT // notifications to PC
+	ncmEndpointIn  = usb.NCM_ENDPOINT_IN  // to PC
+	ncmEndpointOut = usb.NCM_ENDPOINT_OUT // from PC
+
+	// class specific requests
+	ncmSetEthernetPacketFilter = 0x43
+	ncmGetNTBParameters        = 0x80
+	ncmGetNTBFormat            = 0x83
+	ncmSetNTBFormat            = 0x84
+	ncmGetNTBInputSize         = 0x85
+	ncmSetNTBInputSize         = 0x86
+
+	// notifications
+	ncmNetworkConnection     = 0x00
+	ncmConnectionSpeedChange = 0x2A
+	ncmNotificationLen       = 8
+
+	// string descriptor index of the MAC address, see the CDC Ethernet
+	// functional descriptor
+	ncmMACAddressString = 4
+
+	// reported link speed in bits per second (USB full speed)
+	ncmLinkSpeed = 12_000_000
+)
+
+var Net *ncm
+
+type ncm struct {
+	rx        receiver
+	rxBuf     [ntbMaxSize]byte
+	rxHandler func(frame []byte)
+
+	tx       [ntbMaxSize]byte
+	txMax    int    // maximum NTB size requested by the host
+	txData   []byte // rest of the NTB that is being sent
+	txZLP    bool   // whether the NTB must be terminated by a zero length packet
+	txBusy   bool
+	sequence uint16
+
+	connected bool
+	notify    [ncmNotificationLen + 8]byte
+	notified  bool // whether the connection notification has been sent
+
+	control [28]byte
+}
+
+func init() {
+	if Net == nil {
+		Net = newNCM()
+	}
+}
+
+// Port returns the USB NCM network interface.
+func Port() *ncm {
+	return Net
+}
+
+func newNCM() *ncm {
+	n := &ncm{
+		txMax: ntbMaxSize,
+	}
+	n.rx.buf = n.rxBuf[:]
+	n.SetHostMACAddress([6]byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+	machine.EnableNCM(n.Handler, n.RxHandler, n.SetupHandler, n.NotifyHandler)
+	return n
+}
+
+// SetHandler sets the function that is called for every Ethernet frame that
+// is received from the host. It is called from an interrupt, and the frame is
+// only valid until it returns.
+func (n *ncm) SetHandler(rxHandler func(frame []byte)) {
+	n.rxHandler = rxHandler
+}
+
+// SetHostMACAddress sets the MAC address of the network interface on the host.
+// It must be called from the init(), before the host enumerates the device.
+// The default is the locally administered address 02:00:00:00:00:01.
+func (n *ncm) SetHostMACAddress(mac [6]byte) {
+	const hex = "0123456789ABCDEF"
+	var s [12]byte
+	for i, b := range mac {
+		s[i*2] = hex[b>>4]
+		s[i*2+1] = hex[b&0xf]
+	}
+	machine.SetUSBString(ncmMACAddressString, string(s[:]))
+}
+
+// Connected returns whether the host has activated the network interface.
+func (n *ncm) Connected() bool {
+	return n.connected
+}
+
+// Send sends an Ethernet frame to the host. It returns ErrBusy if the previous
+// frame is still being sent, in which case it should be retried later.
+func (n *ncm) Send(frame []byte) error {
+	if !n.connected {
+		return ErrNotConnected
+	}
+	mask := interrupt.Disable()
+	busy := n.txBusy
+	n.txBusy = true
+	interrupt.Restore(mask)
+	if busy {
+		return ErrBusy
+	}
+
+	// The send buffer is not in use while txBusy was false.
+	length, err := buildNTB(n.tx[:n.txMax], n.sequence, frame)
+	if err != nil {
+		n.txBusy = false
+		return err
+	}
+	n.sequence++
+
+	mask = interrupt.Disable()
+	n.txData = n.tx[:length]
+	// A transfer of the maximum size doesn't need to be terminated.
+	n.txZLP = length%usb.EndpointPacketSize == 0 && length < n.txMax
+	n.sendNext()
+	interrupt.Restore(mask)
+	return nil
+}
+
+// sendNext sends the next packet of the NTB that is being sent.
+func (n *ncm) sendNext() {
+	if len(n.txData) > 0 {
+		count := len(n.txData)
+		if count > usb.EndpointPacketSize {
+			count = usb.EndpointPacketSize
+		}
+		machine.SendUSBInPacket(ncmEndpointIn, n.txData[:count])
+		n.txData = n.txData[count:]
+		return
+	}
+	if n.txZLP {
+		n.txZLP = false
+		machine.SendUSBInPacket(ncmEndpointIn, nil)
+		return
+	}
+	n.txBusy = false
+}
+
+// from BulkIn
+func (n *ncm) Handler() {
+	n.sendNext()
+}
+
+// from BulkOut
+func (n *ncm) RxHandler(b []byte) {
+	// Invalid NTBs are dropped, like corrupted frames on a real network.
+	n.rx.receive(b, n.receiveFrame)
+}
+
+func (n *ncm) receiveFrame(frame []byte) {
+	if n.rxHandler != nil {
+		n.rxHandler(frame)
+	}
+}
+
+// from InterruptIn
+func (n *ncm) NotifyHandler() {
+	if n.connected && !n.notified {
+		n.notified = true
+		n.sendNotification(ncmNetworkConnection, 1, nil)
+	}
+}
+
+// sendNotification sends a notification to the host. The connection speed
+// change notification has 8 bytes of data.
+func (n *ncm) sendNotification(code uint8, value uint16, data []byte) {
+	n.notify[0] = usb.REQUEST_DEVICETOHOST_CLASS_INTERFACE
+	n.notify[1] = code
+	binary.LittleEndian.PutUint16(n.notify[2:4], value)
+	binary.LittleEndian.PutUint16(n.notify[4:6], usb.NCM_INTERFACE)
+	binary.LittleEndian.PutUint16(n.notify[6:8], uint16(len(data)))
+	copy(n.notify[ncmNotificationLen:], data)
+	machine.SendUSBInPacket(ncmEndpointInt, n.notify[:ncmNotificationLen+len(data)])
+}
+
+// connect tells the host that the link is up, by sending the connection speed
+// and then the network connection notification.
+func (n *ncm) connect() {
+	if n.connected {
+		return
+	}
+	n.connected = true
+	n.notified = false
+	var speed [8]byte
+	binary.LittleEndian.PutUint32(speed[0:4], ncmLinkSpeed) // downlink
+	binary.LittleEndian.PutUint32(speed[4:8], ncmLinkSpeed) // uplink
+	n.sendNotification(ncmConnectionSpeedChange, 0, speed[:])
+}
+
+func (n *ncm) SetupHandler(setup usb.Setup) bool {
+	if setup.BmRequestType == usb.REQUEST_DEVICETOHOST_CLASS_INTERFACE {
+		var b []byte
+		switch setup.BRequest {
+		case ncmGetNTBParameters:
+			b = n.control[:28]
+			binary.LittleEndian.PutUint16(b[0:2], 28)             // wLength
+			binary.LittleEndian.PutUint16(b[2:4], 0x0001)         // bmNtbFormatsSupported (16-bit only)
+			binary.LittleEndian.PutUint32(b[4:8], ntbMaxSize)     // dwNtbInMaxSize
+			binary.LittleEndian.PutUint16(b[8:10], ntbAlignment)  // wNdpInDivisor
+			binary.LittleEndian.PutUint16(b[10:12], 0)            // wNdpInPayloadRemainder
+			binary.LittleEndian.PutUint16(b[12:14], ntbAlignment) // wNdpInAlignment
+			binary.LittleEndian.PutUint16(b[14:16], 0)            // reserved
+			binary.LittleEndian.PutUint32(b[16:20], ntbMaxSize)   // dwNtbOutMaxSize
+			binary.LittleEndian.PutUint16(b[20:22], ntbAlignment) // wNdpOutDivisor
+			binary.LittleEndian.PutUint16(b[22:24], 0)            // wNdpOutPayloadRemainder
+			binary.LittleEndian.PutUint16(b[24:26], ntbAlignment) // wNdpOutAlignment
+			binary.LittleEndian.PutUint16(b[26:28], 0)            // wNtbOutMaxDatagrams (no limit)
+		case ncmGetNTBFormat:
+			b = n.control[:2]
+			binary.LittleEndian.PutUint16(b, 0) // 16-bit NTBs
+		case ncmGetNTBInputSize:
+			b = n.control[:4]
+			binary.LittleEndian.PutUint32(b, uint32(n.txMax))
+		default:
+			return false
+		}
+		if int(setup.WLength) < len(b) {
+			b = b[:setup.WLength]
+		}
+		machine.SendUSBInPacket(0, b)
+		return true
+	}
+
+	if setup.BmRequestType == usb.REQUEST_HOSTTODEVICE_CLASS_INTERFACE {
+		switch setup.BRequest {
+		case ncmSetEthernetPacketFilter:
+			// All frames are passed on anyway. The host sets the filter when
+			// it brings the interface up, so now is the time to tell it that
+			// the link is up.
+			machine.SendZlp()
+			n.connect()
+			return true
+		case ncmSetNTBFormat:
+			if setup.WValueL != 0 || setup.WValueH != 0 {
+				// Only 16-bit NTBs are supported.
+				return false
+			}
+			machine.SendZlp()
+			return true
+		case ncmSetNTBInputSize:
+			b, err := machine.ReceiveUSBControlPacket()
+			if err != nil {
+				return false
+			}
+			size := int(binary.LittleEndian.Uint32(b[0:4]))
+			if size > ntbMaxSize {
+				size = ntbMaxSize
+			}
+			mask := interrupt.Disable()
+			if size >= nth16Len+ndp16Len+8 {
+				n.txMax = size
+			}
+			interrupt.Restore(mask)
+			machine.SendZlp()
+			return true
+		}
+	}
+	return false
+}
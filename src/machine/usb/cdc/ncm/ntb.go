@@ -0,0 +1,181 @@
+package ncm
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Ethernet frames are sent in NCM Transfer Blocks (NTBs): a header (NTH16)
+// followed by the frames and one or more datagram pointer tables (NDP16) that
+// point to the frames. Only the 16-bit NTB format is supported.
+
+var (
+	ErrInvalidNTB      = errors.New("ncm: invalid NTB")
+	ErrNTBTooLarge     = errors.New("ncm: NTB too large")
+	ErrFrameTooLarge   = errors.New("ncm: frame too large")
+	errTooManyNDPs     = errors.New("ncm: too many NDPs in NTB")
+	errInvalidDatagram = errors.New("ncm: invalid datagram pointer")
+)
+
+const (
+	nth16Signature = 0x484D434E // "NCMH"
+	nth16Len       = 12
+	ndp16Signature = 0x304D434E // "NCM0", without CRC
+	ndp16CRC       = 0x314D434E // "NCM1", with CRC (which is ignored)
+	ndp16Len       = 8          // without datagram pointers
+
+	// ntbMaxSize is the maximum size of NTBs in both directions, and the size
+	// of the receive and send buffers.
+	ntbMaxSize = 2048
+
+	// Frames and NDPs are aligned to this many bytes.
+	ntbAlignment = 4
+
+	// maxNDPs limits the number of NDPs in a received NTB, to avoid an
+	// endless loop on NTBs where the NDPs point to each other.
+	maxNDPs = 16
+
+	maxPacketSize = 64
+)
+
+// parseNTB calls handle for each frame in the NTB. It returns an error if the
+// NTB is invalid, but still passes on the valid frames before the error.
+func parseNTB(ntb []byte, handle func(frame []byte)) error {
+	if len(ntb) < nth16Len ||
+		binary.LittleEndian.Uint32(ntb[0:4]) != nth16Signature ||
+		binary.LittleEndian.Uint16(ntb[4:6]) != nth16Len {
+		return ErrInvalidNTB
+	}
+	blockLen := int(binary.LittleEndian.Uint16(ntb[8:10]))
+	if blockLen > len(ntb) {
+		return ErrInvalidNTB
+	}
+	ntb = ntb[:blockLen]
+
+	ndp := int(binary.LittleEndian.Uint16(ntb[10:12]))
+	for i := 0; ndp != 0; i++ {
+		if i == maxNDPs {
+			return errTooManyNDPs
+		}
+		if ndp%ntbAlignment != 0 || ndp < nth16Len || ndp+ndp16Len > len(ntb) {
+			return ErrInvalidNTB
+		}
+		signature := binary.LittleEndian.Uint32(ntb[ndp : ndp+4])
+		ndpLen := int(binary.LittleEndian.Uint16(ntb[ndp+4 : ndp+6]))
+		if signature != ndp16Signature && signature != ndp16CRC ||
+			ndpLen < ndp16Len || ndp+ndpLen > len(ntb) {
+			return ErrInvalidNTB
+		}
+
+		// The datagram pointers are terminated by an entry of zeroes.
+		for p := ndp + ndp16Len; p+4 <= ndp+ndpLen; p += 4 {
+			index := int(binary.LittleEndian.Uint16(ntb[p : p+2]))
+			length := int(binary.LittleEndian.Uint16(ntb[p+2 : p+4]))
+			if index == 0 || length == 0 {
+				break
+			}
+			if index < nth16Len || index+length > len(ntb) {
+				return errInvalidDatagram
+			}
+			handle(ntb[index : index+length])
+		}
+
+		ndp = int(binary.LittleEndian.Uint16(ntb[ndp+6 : ndp+8]))
+	}
+	return nil
+}
+
+// buildNTB writes an NTB with a single frame to buf, and returns the length of
+// the NTB.
+func buildNTB(buf []byte, sequence uint16, frame []byte) (int, error) {
+	// The frame directly follows the header, the NDP follows the frame.
+	index := nth16Len
+	ndp := alignNTB(index + len(frame))
+	ndpLen := ndp16Len + 2*4 // one datagram pointer and the terminator
+	blockLen := ndp + ndpLen
+	if blockLen > len(buf) {
+		return 0, ErrFrameTooLarge
+	}
+
+	binary.LittleEndian.PutUint32(buf[0:4], nth16Signature)
+	binary.LittleEndian.PutUint16(buf[4:6], nth16Len)
+	binary.LittleEndian.PutUint16(buf[6:8], sequence)
+	binary.LittleEndian.PutUint16(buf[8:10], uint16(blockLen))
+	binary.LittleEndian.PutUint16(buf[10:12], uint16(ndp))
+
+	copy(buf[index:], frame)
+	for i := index + len(frame); i < ndp; i++ {
+		buf[i] = 0 // padding
+	}
+
+	binary.LittleEndian.PutUint32(buf[ndp:ndp+4], ndp16Signature)
+	binary.LittleEndian.PutUint16(buf[ndp+4:ndp+6], uint16(ndpLen))
+	binary.LittleEndian.PutUint16(buf[ndp+6:ndp+8], 0) // no next NDP
+	binary.LittleEndian.PutUint16(buf[ndp+8:ndp+10], uint16(index))
+	binary.LittleEndian.PutUint16(buf[ndp+10:ndp+12], uint16(len(frame)))
+	binary.LittleEndian.PutUint32(buf[ndp+12:ndp+16], 0) // terminator
+
+	return blockLen, nil
+}
+
+func alignNTB(n int) int {
+	return (n + ntbAlignment - 1) &^ (ntbAlignment - 1)
+}
+
+// receiver reassembles NTBs from the packets of bulk transfers.
+type receiver struct {
+	buf  []byte
+	n    int
+	drop bool // drop the rest of the current transfer
+}
+
+// receive handles a packet of a bulk transfer. Once a complete NTB has been
+// received, handle is called for every frame in it.
+func (r *receiver) receive(packet []byte, handle func(frame []byte)) error {
+	// A short packet (including a zero length packet) ends the transfer.
+	short := len(packet) < maxPacketSize
+	if r.drop {
+		r.drop = !short
+		return nil
+	}
+	if r.n+len(packet) > len(r.buf) {
+		r.reset(short)
+		return ErrNTBTooLarge
+	}
+	r.n += copy(r.buf[r.n:], packet)
+
+	if r.n >= nth16Len {
+		if binary.LittleEndian.Uint32(r.buf[0:4]) != nth16Signature {
+			r.reset(short)
+			return ErrInvalidNTB
+		}
+		blockLen := int(binary.LittleEndian.Uint16(r.buf[8:10]))
+		if blockLen < nth16Len || blockLen > len(r.buf) {
+			r.reset(short)
+			return ErrInvalidNTB
+		}
+		if r.n >= blockLen {
+			r.n = 0
+			err := parseNTB(r.buf[:blockLen], handle)
+			if !short && blockLen%maxPacketSize != 0 {
+				// The transfer is longer than the NTB.
+				r.drop = true
+			}
+			return err
+		}
+	}
+
+	if short && r.n != 0 {
+		// The transfer ended before the NTB was complete.
+		r.reset(true)
+		return ErrInvalidNTB
+	}
+	return nil
+}
+
+// reset drops the NTB that is being received, and the rest of the transfer
+// if it hasn't ended yet.
+func (r *receiver) reset(short bool) {
+	r.n = 0
+	r.drop = !short
+}
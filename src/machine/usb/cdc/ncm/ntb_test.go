@@ -0,0 +1,146 @@
+package ncm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// An NTB with two frames in the layout used by the Linux cdc_ncm driver: the
+// NDP directly follows the header, and the frames follow the NDP.
+const linuxNTB = `
+4e434d48 0c00 0100 7e00 0c00
+4e434d30 1400 0000 2000 2a00 4c00 3200 0000 0000
+ffffffffffff 020000000001 0806 0001 0800 0604 0001 020000000001 c0a80701 000000000000 c0a80702
+0000
+ffffffffffff 020000000001 0800 4500 0024 0000 4000 4011 0000 c0a80701 c0a807ff 0044 0043 0010 0000
+6869 2074 6865 7265
+`
+
+var linuxFrames = []string{
+	// ARP request
+	"ffffffffffff020000000001080600010800060400010200000000" +
+		"01c0a80701000000000000c0a80702",
+	// UDP broadcast
+	"ffffffffffff02000000000108004500002400004000401100" +
+		"00c0a80701c0a807ff00440043001000006869207468657265",
+}
+
+func TestParseNTB(t *testing.T) {
+	ntb := fromHex(t, linuxNTB)
+	var frames []string
+	err := parseNTB(ntb, func(frame []byte) {
+		frames = append(frames, hex.EncodeToString(frame))
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(frames) != len(linuxFrames) {
+		t.Fatalf("expected %d frames, got %d", len(linuxFrames), len(frames))
+	}
+	for i := range frames {
+		if frames[i] != linuxFrames[i] {
+			t.Errorf("frame %d:\nexpected %s\ngot      %s", i, linuxFrames[i], frames[i])
+		}
+	}
+}
+
+func TestParseInvalidNTB(t *testing.T) {
+	ntb := fromHex(t, linuxNTB)
+	for _, tc := range []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{"signature", func(b []byte) []byte { b[0] = 'X'; return b }},
+		{"truncated", func(b []byte) []byte { return b[:100] }},
+		{"ndp index", func(b []byte) []byte { b[10] = 0x0d; return b }},
+		{"ndp signature", func(b []byte) []byte { b[12] = 'X'; return b }},
+		{"datagram", func(b []byte) []byte { b[22] = 0xff; return b }},
+		{"ndp loop", func(b []byte) []byte { b[18] = 0x0c; return b }},
+	} {
+		b := tc.modify(append([]byte(nil), ntb...))
+		if err := parseNTB(b, func([]byte) {}); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestBuildNTB(t *testing.T) {
+	frame := fromHex(t, linuxFrames[1])
+	buf := make([]byte, ntbMaxSize)
+	n, err := buildNTB(buf, 7, frame)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if n%ntbAlignment != 0 {
+		t.Errorf("NTB length %d is not aligned", n)
+	}
+	var frames [][]byte
+	err = parseNTB(buf[:n], func(frame []byte) {
+		frames = append(frames, append([]byte(nil), frame...))
+	})
+	if err != nil {
+		t.Fatal("could not parse NTB:", err)
+	}
+	if len(frames) != 1 || !bytes.Equal(frames[0], frame) {
+		t.Errorf("frame did not round-trip: %x", frames)
+	}
+
+	if _, err := buildNTB(buf, 8, make([]byte, ntbMaxSize)); err != ErrFrameTooLarge {
+		t.Errorf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+// transfer splits an NTB into the packets of a bulk transfer, including the
+// zero length packet if the NTB is a multiple of the packet size.
+func transfer(ntb []byte) [][]byte {
+	var packets [][]byte
+	for len(ntb) >= maxPacketSize {
+		packets = append(packets, ntb[:maxPacketSize])
+		ntb = ntb[maxPacketSize:]
+	}
+	return append(packets, ntb)
+}
+
+func TestReceiver(t *testing.T) {
+	ntb := fromHex(t, linuxNTB)
+	sent := make([]byte, ntbMaxSize)
+	n, err := buildNTB(sent, 1, make([]byte, 4*maxPacketSize-nth16Len-16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aligned := sent[:n] // a multiple of the packet size, ends with a zero length packet
+	invalid := append([]byte("garbage"), ntb...)
+
+	r := receiver{buf: make([]byte, ntbMaxSize)}
+	var frames, errors int
+	replay := func(ntb []byte) {
+		for _, packet := range transfer(ntb) {
+			if err := r.receive(packet, func([]byte) { frames++ }); err != nil {
+				errors++
+			}
+		}
+	}
+	replay(ntb)
+	replay(aligned)
+	replay(invalid)
+	replay(ntb[:50]) // truncated
+	replay(ntb)
+
+	if frames != 5 {
+		t.Errorf("expected 5 frames, got %d", frames)
+	}
+	if errors != 2 {
+		t.Errorf("expected 2 errors, got %d", errors)
+	}
+}
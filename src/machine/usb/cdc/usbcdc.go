@@ -56,7 +56,7 @@ func (usbcdc *USBCDC) ReadByte() (byte, error) {
 
 // Buffered returns the number of bytes currently stored in the RX buffer.
 func (usbcdc *USBCDC) Buffered() int {
-	return int(usbcdc.rxBuffer.Used())
+	return usbcdc.rxBuffer.Used()
 }
 
 // Receive handles adding data to the UART's data buffer.
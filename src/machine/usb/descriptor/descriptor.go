@@ -11,6 +11,7 @@ const (
 	TypeInterface             = 0x4
 	TypeEndpoint              = 0x5
 	TypeDeviceQualifier       = 0x6
+	TypeBOS                   = 0xf
 	TypeInterfaceAssociation  = 0xb
 	TypeClassHID              = 0x21
 	TypeHIDReport             = 0x22
@@ -46,6 +47,27 @@ func (d *Descriptor) Configure(idVendor, idProduct uint16) {
 	conf.TotalLength(uint16(len(d.Configuration)))
 }
 
+// USBVersion sets the USB version in the device descriptor, as a BCD number
+// like 0x0200 for USB 2.0.
+func (d *Descriptor) USBVersion(v uint16) {
+	dev := DeviceType{d.Device}
+	dev.USB(v)
+}
+
+// Extend returns a copy of the descriptor with extra descriptors (interfaces,
+// endpoints and class specific descriptors) appended to the configuration. The
+// number of interfaces in the configuration is increased by numInterfaces.
+func (d *Descriptor) Extend(numInterfaces uint8, extra [][]byte) Descriptor {
+	conf := ConfigurationType{Append(append([][]byte{d.Configuration}, extra...))}
+	conf.NumInterfaces(d.Configuration[4] + numInterfaces)
+
+	return Descriptor{
+		Device:        Append([][]byte{d.Device}),
+		Configuration: conf.Bytes(),
+		HID:           d.HID,
+	}
+}
+
 func Append[T any](slices [][]T) []T {
 	var size, pos int
 
@@ -82,6 +82,18 @@ type EndpointType struct {
 	data []byte
 }
 
+// NewEndpointType returns a new endpoint descriptor.
+func NewEndpointType(address, attributes uint8, maxPacketSize uint16, interval uint8) EndpointType {
+	d := EndpointType{data: make([]byte, endpointTypeLen)}
+	d.Length(endpointTypeLen)
+	d.Type(TypeEndpoint)
+	d.EndpointAddress(address)
+	d.Attributes(attributes)
+	d.MaxPacketSize(maxPacketSize)
+	d.Interval(interval)
+	return d
+}
+
 func (d EndpointType) Bytes() []byte {
 	return d.data
 }
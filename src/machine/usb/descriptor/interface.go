@@ -8,6 +8,19 @@ type InterfaceType struct {
 	data []byte
 }
 
+// NewInterfaceType returns a new interface descriptor.
+func NewInterfaceType(number, numEndpoints, class, subClass, protocol uint8) InterfaceType {
+	d := InterfaceType{data: make([]byte, interfaceTypeLen)}
+	d.Length(interfaceTypeLen)
+	d.Type(TypeInterface)
+	d.InterfaceNumber(number)
+	d.NumEndpoints(numEndpoints)
+	d.InterfaceClass(class)
+	d.InterfaceSubClass(subClass)
+	d.InterfaceProtocol(protocol)
+	return d
+}
+
 func (d InterfaceType) Bytes() []byte {
 	return d.data
 }
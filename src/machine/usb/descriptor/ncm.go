@@ -0,0 +1,208 @@
+package descriptor
+
+const cdcFunctionalNCM = 0x1a
+
+var configurationCDCNCM = [configurationTypeLen]byte{
+	configurationTypeLen,
+	TypeConfiguration,
+	0xa0, 0x00, // adjust length as needed
+	0x04, // number of interfaces
+	0x01, // configuration value
+	0x00, // index to string description
+	0xa0, // attributes
+	0x32, // maxpower
+}
+
+var ConfigurationCDCNCM = ConfigurationType{
+	data: configurationCDCNCM[:],
+}
+
+var interfaceAssociationNCM = [interfaceAssociationTypeLen]byte{
+	interfaceAssociationTypeLen,
+	TypeInterfaceAssociation,
+	0x02, // FirstInterface
+	0x02, // InterfaceCount
+	0x02, // FunctionClass
+	0x0d, // FunctionSubClass (NCM)
+	0x00, // FunctionProtocol
+	0x00, // Function
+}
+
+var InterfaceAssociationNCM = InterfaceAssociationType{
+	data: interfaceAssociationNCM[:],
+}
+
+var interfaceNCMControl = [interfaceTypeLen]byte{
+	interfaceTypeLen,
+	TypeInterface,
+	0x02, // InterfaceNumber
+	0x00, // AlternateSetting
+	0x01, // NumEndpoints
+	0x02, // InterfaceClass
+	0x0d, // InterfaceSubClass (NCM)
+	0x00, // InterfaceProtocol
+	0x00, // Interface
+}
+
+var InterfaceNCMControl = InterfaceType{
+	data: interfaceNCMControl[:],
+}
+
+var classSpecificNCMHeader = [classSpecificTypeLen]byte{
+	classSpecificTypeLen,
+	TypeClassSpecific,
+	cdcFunctionalHeader,
+	0x10, //
+	0x1,  //
+}
+
+var ClassSpecificNCMHeader = ClassSpecificType{
+	data: classSpecificNCMHeader[:],
+}
+
+var classSpecificNCMUnion = [classSpecificTypeLen]byte{
+	classSpecificTypeLen,
+	TypeClassSpecific,
+	cdcFunctionalUnion,
+	0x2, // MasterInterface
+	0x3, // SlaveInterface
+}
+
+var ClassSpecificNCMUnion = ClassSpecificType{
+	data: classSpecificNCMUnion[:],
+}
+
+const classSpecificNCMEthernetLen = 13
+
+var classSpecificNCMEthernet = [classSpecificNCMEthernetLen]byte{
+	classSpecificNCMEthernetLen,
+	TypeClassSpecific,
+	cdcFunctionalEthernet,
+	0x04,                   // iMACAddress
+	0x00, 0x00, 0x00, 0x00, // bmEthernetStatistics
+	0xea, 0x05, // wMaxSegmentSize (1514)
+	0x00, 0x00, // wNumberMCFilters
+	0x00, // bNumberPowerFilters
+}
+
+var ClassSpecificNCMEthernet = ClassSpecificType{
+	data: classSpecificNCMEthernet[:],
+}
+
+const classSpecificNCMFunctionalLen = 6
+
+var classSpecificNCMFunctional = [classSpecificNCMFunctionalLen]byte{
+	classSpecificNCMFunctionalLen,
+	TypeClassSpecific,
+	cdcFunctionalNCM,
+	0x00, 0x01, // bcdNcmVersion
+	0x00, // bmNetworkCapabilities
+}
+
+var ClassSpecificNCMFunctional = ClassSpecificType{
+	data: classSpecificNCMFunctional[:],
+}
+
+var endpointNCMNotify = [endpointTypeLen]byte{
+	endpointTypeLen,
+	TypeEndpoint,
+	0x85, // EndpointAddress
+	0x03, // Attributes
+	0x10, // MaxPacketSizeL
+	0x00, // MaxPacketSizeH
+	0x10, // Interval
+}
+
+var EndpointNCMNotify = EndpointType{
+	data: endpointNCMNotify[:],
+}
+
+// The data interface has no endpoints in the default alternate setting, the
+// host selects the second alternate setting to start the network.
+var interfaceNCMDataIdle = [interfaceTypeLen]byte{
+	interfaceTypeLen,
+	TypeInterface,
+	0x03, // InterfaceNumber
+	0x00, // AlternateSetting
+	0x00, // NumEndpoints
+	0x0a, // InterfaceClass
+	0x00, // InterfaceSubClass
+	0x01, // InterfaceProtocol (NCM data)
+	0x00, // Interface
+}
+
+var InterfaceNCMDataIdle = InterfaceType{
+	data: interfaceNCMDataIdle[:],
+}
+
+var interfaceNCMData = [interfaceTypeLen]byte{
+	interfaceTypeLen,
+	TypeInterface,
+	0x03, // InterfaceNumber
+	0x01, // AlternateSetting
+	0x02, // NumEndpoints
+	0x0a, // InterfaceClass
+	0x00, // InterfaceSubClass
+	0x01, // InterfaceProtocol (NCM data)
+	0x00, // Interface
+}
+
+var InterfaceNCMData = InterfaceType{
+	data: interfaceNCMData[:],
+}
+
+var endpointNCMIN = [endpointTypeLen]byte{
+	endpointTypeLen,
+	TypeEndpoint,
+	0x86, // EndpointAddress
+	0x02, // Attributes
+	0x40, // MaxPacketSizeL
+	0x00, // MaxPacketSizeH
+	0x00, // Interval
+}
+
+var EndpointNCMIN = EndpointType{
+	data: endpointNCMIN[:],
+}
+
+var endpointNCMOUT = [endpointTypeLen]byte{
+	endpointTypeLen,
+	TypeEndpoint,
+	0x07, // EndpointAddress
+	0x02, // Attributes
+	0x40, // MaxPacketSizeL
+	0x00, // MaxPacketSizeH
+	0x00, // Interval
+}
+
+var EndpointNCMOUT = EndpointType{
+	data: endpointNCMOUT[:],
+}
+
+var CDCNCM = Descriptor{
+	Device: DeviceCDC.Bytes(),
+	Configuration: Append([][]byte{
+		ConfigurationCDCNCM.Bytes(),
+		InterfaceAssociationCDC.Bytes(),
+		InterfaceCDCControl.Bytes(),
+		ClassSpecificCDCHeader.Bytes(),
+		ClassSpecificCDCACM.Bytes(),
+		ClassSpecificCDCUnion.Bytes(),
+		ClassSpecificCDCCallManagement.Bytes(),
+		EndpointEP1IN.Bytes(),
+		InterfaceCDCData.Bytes(),
+		EndpointEP2OUT.Bytes(),
+		EndpointEP3IN.Bytes(),
+		InterfaceAssociationNCM.Bytes(),
+		InterfaceNCMControl.Bytes(),
+		ClassSpecificNCMHeader.Bytes(),
+		ClassSpecificNCMUnion.Bytes(),
+		ClassSpecificNCMEthernet.Bytes(),
+		ClassSpecificNCMFunctional.Bytes(),
+		EndpointNCMNotify.Bytes(),
+		InterfaceNCMDataIdle.Bytes(),
+		InterfaceNCMData.Bytes(),
+		EndpointNCMIN.Bytes(),
+		EndpointNCMOUT.Bytes(),
+	}),
+}
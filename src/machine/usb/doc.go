@@ -1,4 +1,5 @@
 // package usb contains the subpackages with USB descriptors and device
 // implementations for standard USB device classes such as the Communcation
-// Data Class (CDC), Human Interface Device (HID), and Audio Device Class (ADC).
+// Data Class (CDC), Human Interface Device (HID), Audio Device Class (ADC), and
+// Mass Storage Class (MSC).
 package usb
@@ -0,0 +1,71 @@
+package msc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The Bulk-Only Transport wraps every SCSI command in a Command Block Wrapper
+// (CBW) sent by the host, followed by an optional data phase and a Command
+// Status Wrapper (CSW) sent by the device.
+
+const (
+	// Command Block Wrapper and Command Status Wrapper
+	cbwSignature = 0x43425355 // "USBC"
+	cbwLen       = 31
+	cbwFlagIn    = 0x80
+	cswSignature = 0x53425355 // "USBS"
+	cswLen       = 13
+
+	cswStatusPassed     = 0
+	cswStatusFailed     = 1
+	cswStatusPhaseError = 2
+)
+
+var (
+	errInvalidCBW      = errors.New("msc: invalid command block wrapper")
+	errInvalidCBLength = errors.New("msc: invalid command block length")
+)
+
+// commandBlockWrapper is a parsed CBW.
+type commandBlockWrapper struct {
+	tag    uint32
+	length uint32 // number of bytes the host wants to transfer in the data phase
+	dataIn bool   // whether the data phase is from the device to the host
+	cbLen  uint8
+	cb     [16]byte
+}
+
+// command returns the SCSI command block.
+func (cbw *commandBlockWrapper) command() []byte {
+	return cbw.cb[:cbw.cbLen]
+}
+
+// parseCBW parses a Command Block Wrapper. It returns errInvalidCBW if b isn't
+// a CBW at all, in which case it must be ignored. If the command block length
+// is invalid, it returns errInvalidCBLength together with the parsed tag and
+// length, so that a phase error can be reported.
+func parseCBW(b []byte, cbw *commandBlockWrapper) error {
+	if len(b) != cbwLen || binary.LittleEndian.Uint32(b[0:4]) != cbwSignature {
+		return errInvalidCBW
+	}
+	cbw.tag = binary.LittleEndian.Uint32(b[4:8])
+	cbw.length = binary.LittleEndian.Uint32(b[8:12])
+	cbw.dataIn = b[12]&cbwFlagIn != 0
+	cbLen := b[14] & 0x1F
+	if cbLen == 0 || cbLen > 16 {
+		cbw.cbLen = 0
+		return errInvalidCBLength
+	}
+	cbw.cbLen = cbLen
+	copy(cbw.cb[:], b[15:15+cbLen])
+	return nil
+}
+
+// putCSW writes a Command Status Wrapper to buf.
+func putCSW(buf *[cswLen]byte, tag, residue uint32, status uint8) {
+	binary.LittleEndian.PutUint32(buf[0:4], cswSignature)
+	binary.LittleEndian.PutUint32(buf[4:8], tag)
+	binary.LittleEndian.PutUint32(buf[8:12], residue)
+	buf[12] = status
+}
@@ -0,0 +1,68 @@
+package msc
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// A READ(10) of 8 sectors at LBA 0x40, as sent by Linux.
+const linuxRead10CBW = `
+55534243 2a000000 00100000 80 00 0a
+28 00 00000040 00 0008 00 000000000000
+`
+
+func TestParseCBW(t *testing.T) {
+	var cbw commandBlockWrapper
+	if err := parseCBW(fromHex(t, linuxRead10CBW), &cbw); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if cbw.tag != 0x2a || cbw.length != 4096 || !cbw.dataIn {
+		t.Errorf("unexpected CBW: tag %#x, length %d, data in %v", cbw.tag, cbw.length, cbw.dataIn)
+	}
+	if cb := hex.EncodeToString(cbw.command()); cb != "28000000004000000800" {
+		t.Errorf("unexpected command block: %s", cb)
+	}
+}
+
+func TestParseInvalidCBW(t *testing.T) {
+	cbw := fromHex(t, linuxRead10CBW)
+	for _, tc := range []struct {
+		name   string
+		modify func(b []byte) []byte
+		err    error
+	}{
+		{"signature", func(b []byte) []byte { b[0] = 'X'; return b }, errInvalidCBW},
+		{"truncated", func(b []byte) []byte { return b[:30] }, errInvalidCBW},
+		{"too long", func(b []byte) []byte { return append(b, 0) }, errInvalidCBW},
+		{"no command", func(b []byte) []byte { b[14] = 0; return b }, errInvalidCBLength},
+		{"command too long", func(b []byte) []byte { b[14] = 17; return b }, errInvalidCBLength},
+	} {
+		var parsed commandBlockWrapper
+		b := tc.modify(append([]byte(nil), cbw...))
+		if err := parseCBW(b, &parsed); err != tc.err {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+		if tc.err == errInvalidCBLength && parsed.tag != 0x2a {
+			// The tag is needed for the phase error status.
+			t.Errorf("%s: tag not parsed", tc.name)
+		}
+	}
+}
+
+func TestPutCSW(t *testing.T) {
+	var csw [cswLen]byte
+	putCSW(&csw, 0x2a, 512, cswStatusFailed)
+	if s := hex.EncodeToString(csw[:]); s != "555342532a0000000002000001" {
+		t.Errorf("unexpected CSW: %s", s)
+	}
+}
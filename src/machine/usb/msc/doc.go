@@ -0,0 +1,19 @@
+// package msc is for USB Mass Storage devices. It implements the Bulk-Only
+// Transport with the subset of SCSI commands that is needed to expose a
+// machine.BlockDevice (such as machine.Flash or an SD card) as a USB drive.
+//
+// Importing this package enables the Mass Storage interface next to the
+// default CDC serial port. The drive shows up without a medium until a block
+// device is attached with SetBlockDevice:
+//
+//	msc.Port().SetBlockDevice(machine.Flash)
+//
+// The host doesn't know about other users of the block device: while the drive
+// is mounted by the host, the program itself should only read from it.
+//
+// The block device is accessed from a goroutine, not from the USB interrupt,
+// so this package needs a scheduler (which is the default). Writes from the
+// host are cached in RAM per erase block, and written back when the host writes
+// to another erase block, synchronizes its cache or ejects the drive. Call Sync
+// to write them back before reading the data from the program.
+package msc
@@ -0,0 +1,379 @@
+//go:build sam || nrf52840 || rp2040
+
+package msc
+
+import (
+	"machine"
+	"machine/usb"
+	"runtime"
+	"runtime/interrupt"
+	"sync"
+)
+
+const (
+	mscEndpointIn  = usb.MSC_ENDPOINT_IN  // to PC
+	mscEndpointOut = usb.MSC_ENDPOINT_OUT // from PC
+
+	// class specific requests
+	mscGetMaxLUN = 0xFE
+	mscReset     = 0xFF
+)
+
+// state is the Bulk-Only Transport state.
+type state uint8
+
+const (
+	stateCommand    state = iota // waiting for a Command Block Wrapper
+	stateBusy                    // the worker goroutine is accessing the block device
+	stateDataIn                  // sending data to the host
+	stateDataOut                 // receiving data from the host
+	stateStatus                  // Command Status Wrapper is ready to be sent
+	stateStatusSent              // Command Status Wrapper has been sent
+)
+
+// job is the work the USB interrupt handler hands to the worker goroutine,
+// because it involves the block device (which may be slow, or may need
+// interrupts itself).
+type job uint8
+
+const (
+	jobCommand job = iota // execute the SCSI command in cbw
+	jobRead               // read the next sector of a READ command
+	jobWrite              // write the sector in buf of a WRITE command
+)
+
+var Storage *msc
+
+type msc struct {
+	// The SCSI logical unit. Its command results and buffer belong to the
+	// worker goroutine in stateBusy, and to the interrupt handler otherwise.
+	disk
+
+	// lock serializes access to the block device between the worker
+	// goroutine and the methods called by the program.
+	lock sync.Mutex
+	work runtime.Cond
+	job  job
+
+	state state
+	busy  bool // whether a packet is being sent on the Bulk In endpoint
+	reset bool // whether a reset was requested while the worker was busy
+	cbw   commandBlockWrapper
+
+	// residue is the number of bytes of the data transfer the host asked for
+	// that haven't been transferred yet.
+	residue uint32
+
+	// Whether the last packet that was sent was a full packet (which means a
+	// zero length packet may be needed to end the transfer early), and whether
+	// the last packet that was received was a short packet (which ends the
+	// transfer).
+	lastFull bool
+	short    bool
+
+	// Number of bytes of the current sector received in buf.
+	bufLen int
+
+	csw [cswLen]byte
+}
+
+func init() {
+	if Storage == nil {
+		Storage = newMSC()
+	}
+}
+
+// Port returns the USB Mass Storage port.
+func Port() *msc {
+	return Storage
+}
+
+func newMSC() *msc {
+	m := &msc{}
+	m.cacheBlock = -1
+	m.setSense(senseNotReady, ascMediumNotPresent, 0)
+	machine.EnableMSC(m.Handler, m.RxHandler, m.SetupHandler)
+	go m.run()
+	return m
+}
+
+// SetBlockDevice attaches the block device that is exposed to the host, or
+// detaches it when dev is nil. Data written by the host to the previous block
+// device is flushed first. The host is notified that the medium changed.
+func (m *msc) SetBlockDevice(dev machine.BlockDevice) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var err error
+	if m.dev != nil {
+		err = m.flush()
+	}
+	var bd blockDevice
+	if dev != nil {
+		bd = dev
+	}
+	mask := interrupt.Disable()
+	m.setDevice(bd)
+	interrupt.Restore(mask)
+	return err
+}
+
+// Sync writes data written by the host that is still cached in RAM to the block
+// device. The cache is written back when the host writes to another erase
+// block, synchronizes its cache or ejects the drive, but not every host does
+// the last two when it is done writing, so a program that wants to read the
+// data can call Sync first.
+func (m *msc) Sync() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.dev == nil {
+		return nil
+	}
+	return m.flush()
+}
+
+// SetReadOnly sets whether the host may write to the block device.
+func (m *msc) SetReadOnly(readOnly bool) {
+	m.readOnly = readOnly
+}
+
+// Ejected returns whether the host ejected the drive. After that, the host
+// doesn't access the block device anymore until it is attached again with
+// SetBlockDevice.
+func (m *msc) Ejected() bool {
+	return m.ejected
+}
+
+// from BulkIn
+func (m *msc) Handler() {
+	m.busy = false
+	if m.state == stateStatusSent {
+		m.state = stateCommand
+	}
+	m.next()
+}
+
+// from BulkOut
+func (m *msc) RxHandler(b []byte) {
+	switch m.state {
+	case stateCommand, stateStatusSent:
+		// The host sends the next command as soon as it received the status
+		// of the previous one, which may be before the Bulk In handler runs.
+		m.handleCommand(b)
+	case stateDataOut:
+		m.receiveData(b)
+	}
+}
+
+// startJob hands a job to the worker goroutine. When called from the Bulk Out
+// handler, no more data is received until the job is done.
+func (m *msc) startJob(j job, fromRx bool) {
+	m.job = j
+	m.state = stateBusy
+	if fromRx {
+		machine.PauseUSBOutEndpoint(mscEndpointOut)
+	}
+	m.work.Notify()
+}
+
+// run is the worker goroutine, which does all block device access for the
+// host. The USB interrupt handler can't do this itself: erasing and writing
+// flash may take a long time, and some block devices (like SD cards on SPI)
+// need interrupts or other goroutines to work.
+func (m *msc) run() {
+	for {
+		m.work.Wait()
+
+		m.lock.Lock()
+		switch m.job {
+		case jobCommand:
+			m.scsiCommand(m.cbw.command())
+			if m.sectors > 0 && !m.write && m.cbw.dataIn && m.residue > 0 {
+				m.readSector()
+			}
+		case jobRead:
+			m.readSector()
+		case jobWrite:
+			m.writeSector()
+			m.bufLen = 0
+		}
+		m.lock.Unlock()
+
+		mask := interrupt.Disable()
+		m.finishJob()
+		interrupt.Restore(mask)
+		machine.ResumeUSBOutEndpoint(mscEndpointOut)
+	}
+}
+
+// finishJob continues the transfer after the worker goroutine has done its job.
+// It must be called with interrupts disabled.
+func (m *msc) finishJob() {
+	if m.reset {
+		// The host reset the transport while the job was running.
+		m.reset = false
+		m.resetState()
+		return
+	}
+	switch m.job {
+	case jobCommand:
+		switch {
+		case m.residue == 0:
+			m.sendStatus(m.status)
+		case m.cbw.dataIn:
+			m.lastFull = true
+			m.state = stateDataIn
+			m.next()
+		default:
+			// Any data that isn't part of a WRITE command is discarded.
+			m.state = stateDataOut
+		}
+	case jobRead:
+		m.state = stateDataIn
+		m.next()
+	case jobWrite:
+		if m.residue == 0 || m.short {
+			m.sendStatus(m.status)
+		} else {
+			m.state = stateDataOut
+		}
+	}
+}
+
+// next sends the next packet to the host, unless the previous one is still
+// being sent.
+func (m *msc) next() {
+	if m.busy {
+		return
+	}
+	switch m.state {
+	case stateDataIn:
+		m.sendData()
+	case stateStatus:
+		m.state = stateStatusSent
+		m.send(m.csw[:])
+	}
+}
+
+// send sends a packet on the Bulk In endpoint.
+func (m *msc) send(b []byte) {
+	m.busy = true
+	machine.SendUSBInPacket(mscEndpointIn, b)
+}
+
+var maxLUN [1]byte
+
+// SetupHandler handles the class specific requests of the Bulk-Only
+// Transport.
+func (m *msc) SetupHandler(setup usb.Setup) bool {
+	if setup.BmRequestType == usb.REQUEST_DEVICETOHOST_CLASS_INTERFACE && setup.BRequest == mscGetMaxLUN {
+		// There is only one logical unit.
+		maxLUN[0] = 0
+		machine.SendUSBInPacket(0, maxLUN[:])
+		return true
+	}
+	if setup.BmRequestType == usb.REQUEST_HOSTTODEVICE_CLASS_INTERFACE && setup.BRequest == mscReset {
+		if m.state == stateBusy {
+			// The worker owns the command state, so reset it once the worker
+			// is done.
+			m.reset = true
+		} else {
+			m.resetState()
+		}
+		m.busy = false
+		machine.SendZlp()
+		return true
+	}
+	return false
+}
+
+// resetState makes the transport wait for the next command.
+func (m *msc) resetState() {
+	m.state = stateCommand
+	m.data = nil
+	m.sectors = 0
+	m.bufLen = 0
+}
+
+// handleCommand parses a Command Block Wrapper and hands the command to the
+// worker goroutine.
+func (m *msc) handleCommand(b []byte) {
+	err := parseCBW(b, &m.cbw)
+	if err == errInvalidCBW {
+		// Not a CBW, ignore it.
+		return
+	}
+	m.residue = m.cbw.length
+	if err != nil {
+		m.sendStatus(cswStatusPhaseError)
+		return
+	}
+	m.short = false
+	m.bufLen = 0
+	m.startJob(jobCommand, true)
+}
+
+// sendData sends the next packet of the data phase to the host, and the status
+// once all data has been sent.
+func (m *msc) sendData() {
+	if len(m.data) == 0 && m.sectors > 0 && m.residue > 0 {
+		// Let the worker read the next sector.
+		m.startJob(jobRead, false)
+		return
+	}
+
+	n := len(m.data)
+	if uint32(n) > m.residue {
+		n = int(m.residue)
+	}
+	if n == 0 {
+		if m.residue > 0 && m.lastFull {
+			// The host expects more data than there is: end the transfer
+			// with a short packet.
+			m.lastFull = false
+			m.send(nil)
+			return
+		}
+		m.sendStatus(m.status)
+		return
+	}
+
+	if n > usb.EndpointPacketSize {
+		n = usb.EndpointPacketSize
+	}
+	m.send(m.data[:n])
+	m.data = m.data[n:]
+	m.residue -= uint32(n)
+	m.lastFull = n == usb.EndpointPacketSize
+}
+
+// receiveData handles a packet of the data phase from the host. Complete
+// sectors are handed to the worker goroutine to be written. The status is sent
+// once all data has been received.
+func (m *msc) receiveData(b []byte) {
+	m.short = len(b) < usb.EndpointPacketSize
+	if uint32(len(b)) > m.residue {
+		b = b[:m.residue]
+	}
+	m.residue -= uint32(len(b))
+
+	if m.write && m.sectors > 0 {
+		// The packet size divides the sector size, so a packet never
+		// contains data of two sectors.
+		m.bufLen += copy(m.buf[m.bufLen:], b)
+		if m.bufLen == sectorSize {
+			m.startJob(jobWrite, true)
+			return
+		}
+	}
+
+	if m.residue == 0 || m.short {
+		m.sendStatus(m.status)
+	}
+}
+
+// sendStatus sends the Command Status Wrapper of the current command.
+func (m *msc) sendStatus(status uint8) {
+	putCSW(&m.csw, m.cbw.tag, m.residue, status)
+	m.state = stateStatus
+	m.next()
+}
@@ -0,0 +1,380 @@
+package msc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"machine/usb"
+)
+
+// SCSI operation codes.
+const (
+	scsiTestUnitReady          = 0x00
+	scsiRequestSense           = 0x03
+	scsiInquiry                = 0x12
+	scsiModeSense6             = 0x1A
+	scsiStartStopUnit          = 0x1B
+	scsiPreventAllowRemoval    = 0x1E
+	scsiReadFormatCapacities   = 0x23
+	scsiReadCapacity10         = 0x25
+	scsiRead10                 = 0x28
+	scsiWrite10                = 0x2A
+	scsiVerify10               = 0x2F
+	scsiSynchronizeCache10     = 0x35
+	scsiModeSense10            = 0x5A
+	scsiInquiryLen             = 36
+	scsiRequestSenseLen        = 18
+	scsiReadCapacity10Len      = 8
+	scsiReadFormatCapacityLen  = 12
+	scsiModeSense6Len          = 4
+	scsiModeSense10Len         = 8
+	scsiModeWriteProtect       = 0x80
+	scsiStartStopUnitLoadEject = 0x02
+	scsiStartStopUnitStart     = 0x01
+)
+
+// Sense keys and additional sense codes.
+const (
+	senseNotReady       = 0x02
+	senseMediumError    = 0x03
+	senseIllegalRequest = 0x05
+	senseUnitAttention  = 0x06
+	senseDataProtect    = 0x07
+
+	ascUnrecoveredReadError = 0x11
+	ascWriteFault           = 0x03
+	ascInvalidCommand       = 0x20
+	ascLBAOutOfRange        = 0x21
+	ascInvalidFieldInCDB    = 0x24
+	ascWriteProtected       = 0x27
+	ascMediumChanged        = 0x28
+	ascMediumNotPresent     = 0x3A
+)
+
+// sectorSize is the SCSI logical block size, independent of the block sizes of
+// the underlying block device.
+const sectorSize = 512
+
+// blockDevice is the part of machine.BlockDevice that is used to store the
+// data of the drive.
+type blockDevice interface {
+	ReadAt(p []byte, off int64) (n int, err error)
+	WriteAt(p []byte, off int64) (n int, err error)
+	Size() int64
+	EraseBlockSize() int64
+	EraseBlocks(start, len int64) error
+}
+
+// disk is the SCSI logical unit: it executes SCSI commands on a block device.
+// It doesn't know about USB, the Bulk-Only Transport moves the data of the
+// commands between disk and the host.
+type disk struct {
+	dev      blockDevice
+	blocks   uint32 // number of sectors on dev
+	readOnly bool
+	ejected  bool
+
+	sense senseData
+
+	// Result of the current command: the status, the data to send to the host
+	// and the sectors that still need to be read or written.
+	status  uint8
+	data    []byte
+	lba     uint32
+	sectors uint32
+	write   bool
+
+	buf [sectorSize]byte
+
+	// Write cache of one erase block of the block device.
+	cache      []byte
+	cacheBlock int64
+	dirty      bool
+}
+
+// senseData is the error of the last command that failed, which the host
+// requests with REQUEST SENSE.
+type senseData struct {
+	key  uint8
+	asc  uint8
+	ascq uint8
+}
+
+func (d *disk) setSense(key, asc, ascq uint8) {
+	d.sense = senseData{key, asc, ascq}
+}
+
+// fail marks the current command as failed.
+func (d *disk) fail(key, asc, ascq uint8) {
+	d.setSense(key, asc, ascq)
+	d.status = cswStatusFailed
+}
+
+// setDevice attaches a block device, or detaches it when dev is nil. The write
+// cache of the previous device must have been flushed.
+func (d *disk) setDevice(dev blockDevice) {
+	var cache []byte
+	if dev != nil {
+		size := dev.EraseBlockSize()
+		if size < sectorSize {
+			size = sectorSize
+		}
+		if len(d.cache) == int(size) {
+			cache = d.cache
+		} else {
+			cache = make([]byte, size)
+		}
+	}
+	d.dev = dev
+	d.cache = cache
+	d.cacheBlock = -1
+	d.dirty = false
+	d.ejected = false
+	d.blocks = 0
+	if dev != nil {
+		d.blocks = uint32(dev.Size() / sectorSize)
+		d.setSense(senseUnitAttention, ascMediumChanged, 0)
+	} else {
+		d.setSense(senseNotReady, ascMediumNotPresent, 0)
+	}
+}
+
+// ready checks whether there is a medium that the host can access, and fails
+// the command if not.
+func (d *disk) ready() bool {
+	if d.dev == nil || d.ejected || d.blocks == 0 {
+		d.fail(senseNotReady, ascMediumNotPresent, 0)
+		return false
+	}
+	if d.sense.key == senseUnitAttention {
+		// Report the medium change once, so the host rereads the capacity.
+		d.status = cswStatusFailed
+		return false
+	}
+	return true
+}
+
+// scsiCommand executes a SCSI command. It sets up the data to send or receive
+// in the data phase, and the status of the command.
+func (d *disk) scsiCommand(cb []byte) {
+	d.status = cswStatusPassed
+	d.data = nil
+	d.sectors = 0
+	d.write = false
+	switch cb[0] {
+	case scsiTestUnitReady:
+		d.ready()
+
+	case scsiRequestSense:
+		buf := d.buf[:scsiRequestSenseLen]
+		zero(buf)
+		buf[0] = 0x70 // current error, fixed format
+		buf[2] = d.sense.key
+		buf[7] = scsiRequestSenseLen - 8 // additional length
+		buf[12] = d.sense.asc
+		buf[13] = d.sense.ascq
+		d.data = buf
+		d.sense = senseData{}
+		if d.dev == nil || d.ejected {
+			// Keep reporting that there is no medium.
+			d.setSense(senseNotReady, ascMediumNotPresent, 0)
+		}
+
+	case scsiInquiry:
+		if cb[1]&0x01 != 0 {
+			// Vital product data pages are not supported.
+			d.fail(senseIllegalRequest, ascInvalidFieldInCDB, 0)
+			return
+		}
+		buf := d.buf[:scsiInquiryLen]
+		buf[0] = 0x00 // direct access block device
+		buf[1] = 0x80 // removable medium
+		buf[2] = 0x04 // SPC-2
+		buf[3] = 0x02 // response data format
+		buf[4] = scsiInquiryLen - 5
+		buf[5] = 0
+		buf[6] = 0
+		buf[7] = 0
+		putString(buf[8:16], usb.Manufacturer, "TinyGo")
+		putString(buf[16:32], usb.Product, "Mass Storage")
+		putString(buf[32:36], "", "1.0")
+		d.data = buf
+
+	case scsiModeSense6, scsiModeSense10:
+		var flags byte
+		if d.readOnly {
+			flags = scsiModeWriteProtect
+		}
+		// Only the mode parameter header, without any pages.
+		if cb[0] == scsiModeSense6 {
+			buf := d.buf[:scsiModeSense6Len]
+			buf[0] = scsiModeSense6Len - 1 // mode data length
+			buf[1] = 0                     // medium type
+			buf[2] = flags
+			buf[3] = 0 // block descriptor length
+			d.data = buf
+		} else {
+			buf := d.buf[:scsiModeSense10Len]
+			zero(buf)
+			buf[1] = scsiModeSense10Len - 2 // mode data length
+			buf[3] = flags
+			d.data = buf
+		}
+
+	case scsiStartStopUnit:
+		if cb[4]&scsiStartStopUnitLoadEject != 0 && cb[4]&scsiStartStopUnitStart == 0 {
+			// Flush before the host considers the drive safe to remove.
+			if d.dev != nil {
+				if err := d.flush(); err != nil {
+					d.fail(senseMediumError, ascWriteFault, 0)
+					return
+				}
+			}
+			d.ejected = true
+		}
+
+	case scsiPreventAllowRemoval:
+		// The medium can't be removed by the user, so there is nothing to
+		// prevent.
+
+	case scsiReadFormatCapacities:
+		if !d.ready() {
+			return
+		}
+		buf := d.buf[:scsiReadFormatCapacityLen]
+		zero(buf)
+		buf[3] = 8 // capacity list length
+		binary.BigEndian.PutUint32(buf[4:8], d.blocks)
+		binary.BigEndian.PutUint32(buf[8:12], sectorSize)
+		buf[8] = 0x02 // formatted media
+		d.data = buf
+
+	case scsiReadCapacity10:
+		if !d.ready() {
+			return
+		}
+		buf := d.buf[:scsiReadCapacity10Len]
+		binary.BigEndian.PutUint32(buf[0:4], d.blocks-1) // last LBA
+		binary.BigEndian.PutUint32(buf[4:8], sectorSize)
+		d.data = buf
+
+	case scsiRead10, scsiWrite10, scsiVerify10:
+		if !d.ready() {
+			return
+		}
+		lba := binary.BigEndian.Uint32(cb[2:6])
+		count := uint32(binary.BigEndian.Uint16(cb[7:9]))
+		if lba > d.blocks || count > d.blocks-lba {
+			d.fail(senseIllegalRequest, ascLBAOutOfRange, 0)
+			return
+		}
+		switch cb[0] {
+		case scsiRead10:
+			d.lba = lba
+			d.sectors = count
+		case scsiWrite10:
+			if d.readOnly {
+				d.fail(senseDataProtect, ascWriteProtected, 0)
+				return
+			}
+			d.lba = lba
+			d.sectors = count
+			d.write = true
+		case scsiVerify10:
+			// The data is verified when it is written back, so there is
+			// nothing to do here.
+		}
+
+	case scsiSynchronizeCache10:
+		if !d.ready() {
+			return
+		}
+		if err := d.flush(); err != nil {
+			d.fail(senseMediumError, ascWriteFault, 0)
+		}
+
+	default:
+		d.fail(senseIllegalRequest, ascInvalidCommand, 0)
+	}
+}
+
+// putString copies s (or def if s is empty) into buf, padded with spaces as
+// required for the identification strings in the INQUIRY data.
+func putString(buf []byte, s, def string) {
+	if s == "" {
+		s = def
+	}
+	n := copy(buf, s)
+	for i := n; i < len(buf); i++ {
+		buf[i] = ' '
+	}
+}
+
+func zero(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// readSector reads the next sector of a READ command into buf, and makes it the
+// data to send to the host.
+func (d *disk) readSector() {
+	addr := int64(d.lba) * sectorSize
+	if size := int64(len(d.cache)); addr/size == d.cacheBlock {
+		// The sector may have been modified in the write cache.
+		copy(d.buf[:], d.cache[addr-d.cacheBlock*size:])
+	} else if _, err := d.dev.ReadAt(d.buf[:], addr); err != nil {
+		d.fail(senseMediumError, ascUnrecoveredReadError, 0)
+		d.sectors = 0
+		return
+	}
+	d.data = d.buf[:]
+	d.lba++
+	d.sectors--
+}
+
+// writeSector writes the sector in buf, received as part of a WRITE command, to
+// the write cache. The cache holds one erase block, which is erased and written
+// back when a sector in another erase block is written or the cache is flushed.
+func (d *disk) writeSector() {
+	size := int64(len(d.cache))
+	addr := int64(d.lba) * sectorSize
+	block := addr / size
+	if block != d.cacheBlock {
+		if err := d.flush(); err != nil {
+			d.fail(senseMediumError, ascWriteFault, 0)
+			d.sectors = 0
+			return
+		}
+		if _, err := d.dev.ReadAt(d.cache, block*size); err != nil {
+			d.fail(senseMediumError, ascWriteFault, 0)
+			d.sectors = 0
+			return
+		}
+		d.cacheBlock = block
+	}
+	sector := d.cache[addr-block*size:][:sectorSize]
+	if !bytes.Equal(sector, d.buf[:]) {
+		copy(sector, d.buf[:])
+		d.dirty = true
+	}
+	d.lba++
+	d.sectors--
+}
+
+// flush writes the write cache back to the block device, if needed. It also
+// invalidates the cache, in case the program writes to the block device.
+func (d *disk) flush() error {
+	block := d.cacheBlock
+	d.cacheBlock = -1
+	if !d.dirty {
+		return nil
+	}
+	d.dirty = false
+	size := int64(len(d.cache))
+	eraseSize := d.dev.EraseBlockSize()
+	if err := d.dev.EraseBlocks(block*size/eraseSize, size/eraseSize); err != nil {
+		return err
+	}
+	_, err := d.dev.WriteAt(d.cache, block*size)
+	return err
+}
@@ -0,0 +1,211 @@
+package msc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// nor is a block device that behaves like NOR flash: writes can only clear
+// bits, so data must be erased before it is overwritten.
+type nor struct {
+	mem    []byte
+	erases int
+}
+
+func newNOR(size int) *nor {
+	d := &nor{mem: make([]byte, size)}
+	for i := range d.mem {
+		d.mem[i] = 0xff
+	}
+	return d
+}
+
+func (d *nor) ReadAt(p []byte, off int64) (int, error) { return copy(p, d.mem[off:]), nil }
+func (d *nor) Size() int64                             { return int64(len(d.mem)) }
+func (d *nor) EraseBlockSize() int64                   { return 4096 }
+
+func (d *nor) WriteAt(p []byte, off int64) (int, error) {
+	for i, b := range p {
+		d.mem[off+int64(i)] &= b
+	}
+	return len(p), nil
+}
+
+func (d *nor) EraseBlocks(start, n int64) error {
+	d.erases++
+	for i := start * 4096; i < (start+n)*4096; i++ {
+		d.mem[i] = 0xff
+	}
+	return nil
+}
+
+// rw10 returns a READ(10) or WRITE(10) command block.
+func rw10(op byte, lba uint32, count uint16) []byte {
+	cb := make([]byte, 10)
+	cb[0] = op
+	binary.BigEndian.PutUint32(cb[2:], lba)
+	binary.BigEndian.PutUint16(cb[7:], count)
+	return cb
+}
+
+func TestSCSINoMedium(t *testing.T) {
+	var d disk
+	d.setDevice(nil)
+	d.scsiCommand([]byte{scsiTestUnitReady, 0, 0, 0, 0, 0})
+	if d.status != cswStatusFailed {
+		t.Error("TEST UNIT READY passed without a medium")
+	}
+	d.scsiCommand([]byte{scsiRequestSense, 0, 0, 0, scsiRequestSenseLen, 0})
+	if d.status != cswStatusPassed || len(d.data) != scsiRequestSenseLen {
+		t.Fatal("REQUEST SENSE failed")
+	}
+	if d.data[2] != senseNotReady || d.data[12] != ascMediumNotPresent {
+		t.Errorf("unexpected sense data: %x", d.data)
+	}
+}
+
+func TestSCSICommands(t *testing.T) {
+	var d disk
+	d.setDevice(newNOR(64 * 1024))
+
+	// The first command reports the medium change.
+	d.scsiCommand([]byte{scsiTestUnitReady, 0, 0, 0, 0, 0})
+	if d.status != cswStatusFailed {
+		t.Error("expected a unit attention")
+	}
+	d.scsiCommand([]byte{scsiRequestSense, 0, 0, 0, scsiRequestSenseLen, 0})
+	if d.data[2] != senseUnitAttention || d.data[12] != ascMediumChanged {
+		t.Errorf("unexpected sense data: %x", d.data)
+	}
+	d.scsiCommand([]byte{scsiTestUnitReady, 0, 0, 0, 0, 0})
+	if d.status != cswStatusPassed {
+		t.Error("TEST UNIT READY failed")
+	}
+
+	d.scsiCommand([]byte{scsiInquiry, 0, 0, 0, scsiInquiryLen, 0})
+	if len(d.data) != scsiInquiryLen || string(d.data[8:16]) != "TinyGo  " {
+		t.Errorf("unexpected INQUIRY data: %q", d.data)
+	}
+	d.scsiCommand([]byte{scsiInquiry, 1, 0x80, 0, scsiInquiryLen, 0})
+	if d.status != cswStatusFailed {
+		t.Error("vital product data should not be supported")
+	}
+
+	d.scsiCommand([]byte{scsiReadCapacity10, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	if last, size := binary.BigEndian.Uint32(d.data[0:4]), binary.BigEndian.Uint32(d.data[4:8]); last != 127 || size != sectorSize {
+		t.Errorf("unexpected capacity: last LBA %d, block size %d", last, size)
+	}
+
+	d.scsiCommand(rw10(scsiRead10, 120, 8))
+	if d.status != cswStatusPassed || d.lba != 120 || d.sectors != 8 || d.write {
+		t.Errorf("unexpected READ(10) result: status %d, LBA %d, %d sectors", d.status, d.lba, d.sectors)
+	}
+	d.scsiCommand(rw10(scsiRead10, 127, 2))
+	if d.status != cswStatusFailed || d.sense.asc != ascLBAOutOfRange {
+		t.Error("expected READ(10) past the end to fail")
+	}
+	d.scsiCommand(rw10(scsiWrite10, 3, 1))
+	if d.status != cswStatusPassed || d.lba != 3 || d.sectors != 1 || !d.write {
+		t.Errorf("unexpected WRITE(10) result: status %d, LBA %d, %d sectors", d.status, d.lba, d.sectors)
+	}
+
+	d.readOnly = true
+	d.scsiCommand([]byte{scsiModeSense6, 0, 0x3f, 0, scsiModeSense6Len, 0})
+	if d.data[2] != scsiModeWriteProtect {
+		t.Error("MODE SENSE(6) doesn't report write protection")
+	}
+	d.scsiCommand(rw10(scsiWrite10, 3, 1))
+	if d.status != cswStatusFailed || d.sense.key != senseDataProtect {
+		t.Error("expected WRITE(10) to a read-only medium to fail")
+	}
+
+	d.scsiCommand([]byte{0xC0, 0, 0, 0, 0, 0})
+	if d.status != cswStatusFailed || d.sense.asc != ascInvalidCommand {
+		t.Error("expected an unknown command to fail")
+	}
+
+	d.scsiCommand([]byte{scsiStartStopUnit, 0, 0, 0, scsiStartStopUnitLoadEject, 0})
+	if !d.ejected {
+		t.Error("medium not ejected")
+	}
+	d.scsiCommand([]byte{scsiTestUnitReady, 0, 0, 0, 0, 0})
+	if d.status != cswStatusFailed {
+		t.Error("TEST UNIT READY passed after eject")
+	}
+}
+
+// write writes count sectors with the given data, like the transport does for
+// a WRITE(10) command.
+func write(t *testing.T, d *disk, lba uint32, data []byte) {
+	t.Helper()
+	d.scsiCommand(rw10(scsiWrite10, lba, uint16(len(data)/sectorSize)))
+	for d.sectors > 0 {
+		copy(d.buf[:], data)
+		data = data[sectorSize:]
+		d.writeSector()
+	}
+	if d.status != cswStatusPassed {
+		t.Fatal("write failed")
+	}
+}
+
+// read reads count sectors, like the transport does for a READ(10) command.
+func read(t *testing.T, d *disk, lba uint32, count uint16) []byte {
+	t.Helper()
+	var data []byte
+	d.scsiCommand(rw10(scsiRead10, lba, count))
+	for d.sectors > 0 {
+		d.readSector()
+		data = append(data, d.data...)
+	}
+	if d.status != cswStatusPassed {
+		t.Fatal("read failed")
+	}
+	return data
+}
+
+func TestSCSIWriteCache(t *testing.T) {
+	dev := newNOR(64 * 1024)
+	var d disk
+	d.setDevice(dev)
+	d.sense = senseData{}
+
+	// Write 3 sectors, crossing from the first into the second erase block
+	// (of 8 sectors each).
+	data := make([]byte, 3*sectorSize)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	write(t, &d, 7, data)
+
+	// Only the first erase block has been written back, when the host
+	// started writing to the second.
+	if !bytes.Equal(dev.mem[7*sectorSize:8*sectorSize], data[:sectorSize]) {
+		t.Error("first erase block was not written back")
+	}
+	if bytes.Equal(dev.mem[8*sectorSize:10*sectorSize], data[sectorSize:]) {
+		t.Error("second erase block was written back before a flush")
+	}
+	if got := read(t, &d, 7, 3); !bytes.Equal(got, data) {
+		t.Error("reading the cached sectors returned stale data")
+	}
+
+	// SYNCHRONIZE CACHE writes back the rest.
+	d.scsiCommand([]byte{scsiSynchronizeCache10, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	if d.status != cswStatusPassed || !bytes.Equal(dev.mem[7*sectorSize:10*sectorSize], data) {
+		t.Error("SYNCHRONIZE CACHE did not write back the cache")
+	}
+	for _, b := range dev.mem[:7*sectorSize] {
+		if b != 0xff {
+			t.Fatal("sectors before the written sectors were modified")
+		}
+	}
+
+	// Writing the same data again doesn't erase anything.
+	erases := dev.erases
+	write(t, &d, 7, data)
+	if err := d.flush(); err != nil || dev.erases != erases {
+		t.Errorf("unchanged data was erased and written again")
+	}
+}
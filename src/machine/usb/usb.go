@@ -10,6 +10,8 @@ const (
 	DescriptorConfigHID
 	DescriptorConfigMIDI
 	DescriptorConfigJoystick
+	DescriptorConfigMSC
+	DescriptorConfigNCM
 )
 
 const (
@@ -65,6 +67,9 @@ const (
 	CDC_DATA_INTERFACE = 1 // CDC Data
 	CDC_FIRST_ENDPOINT = 1
 	HID_INTERFACE      = 2 // HID
+	MSC_INTERFACE      = 2 // Mass Storage
+	NCM_INTERFACE      = 2 // CDC NCM Communication
+	NCM_DATA_INTERFACE = 3 // CDC NCM Data
 
 	// Endpoint
 	CONTROL_ENDPOINT  = 0
@@ -75,6 +80,11 @@ const (
 	HID_ENDPOINT_OUT  = 5 // for Interrupt Out
 	MIDI_ENDPOINT_IN  = 6 // for Bulk In
 	MIDI_ENDPOINT_OUT = 7 // for Bulk Out
+	MSC_ENDPOINT_IN   = 6 // for Bulk In, shared with MIDI
+	MSC_ENDPOINT_OUT  = 7 // for Bulk Out, shared with MIDI
+	NCM_ENDPOINT_INT  = 5 // for Interrupt In, shared with HID
+	NCM_ENDPOINT_IN   = 6 // for Bulk In, shared with MIDI
+	NCM_ENDPOINT_OUT  = 7 // for Bulk Out, shared with MIDI
 	NumberOfEndpoints = 8
 
 	// bmRequestType
@@ -0,0 +1,235 @@
+//go:build sam || nrf52840 || rp2040
+
+package machine
+
+import (
+	"errors"
+	"machine/usb"
+	"machine/usb/descriptor"
+)
+
+var (
+	ErrUSBTooManyInterfaces = errors.New("USB too many interfaces")
+	ErrUSBNoFreeEndpoint    = errors.New("USB no free endpoint")
+	ErrUSBInvalidEndpoint   = errors.New("USB invalid endpoint type")
+	ErrUSBAlreadyEnumerated = errors.New("USB device already enumerated")
+)
+
+const (
+	// usbMaxInterfaces is the maximum number of interfaces, including the
+	// interfaces of the built-in classes (up to 4 with CDC and MIDI).
+	usbMaxInterfaces = 8
+
+	usbMaxBuiltinInterfaces = 4
+)
+
+// USBEndpoint is an endpoint of a USB interface added with AddUSBInterface.
+type USBEndpoint struct {
+	// Type is the transfer type, usb.ENDPOINT_TYPE_BULK or
+	// usb.ENDPOINT_TYPE_INTERRUPT.
+	Type uint8
+
+	// In is true for endpoints that send data to the host, and false for
+	// endpoints that receive data from the host.
+	In bool
+
+	// Interval is the polling interval of interrupt endpoints, in
+	// milliseconds.
+	Interval uint8
+
+	// ClassDescriptor is sent right after the endpoint descriptor, if set.
+	ClassDescriptor []byte
+
+	// TxHandler is called when a packet has been sent on an In endpoint.
+	TxHandler func()
+
+	// RxHandler is called for every packet received on an Out endpoint.
+	RxHandler func([]byte)
+
+	// Number is the endpoint number, allocated by AddUSBInterface. Use it to
+	// send packets with SendUSBInPacket.
+	Number uint8
+}
+
+// USBInterface is a user-defined USB interface, such as a vendor specific
+// interface with bulk endpoints for WinUSB or WebUSB.
+type USBInterface struct {
+	// Class, SubClass and Protocol are the interface class codes, for
+	// example usb.DEVICE_CLASS_VENDOR_SPECIFIC.
+	Class    uint8
+	SubClass uint8
+	Protocol uint8
+
+	// ClassDescriptor is sent right after the interface descriptor, if set.
+	ClassDescriptor []byte
+
+	// Endpoints are the endpoints of the interface.
+	Endpoints []USBEndpoint
+
+	// SetupHandler handles the class and vendor specific setup requests
+	// for this interface. It returns false for requests it doesn't support.
+	SetupHandler func(usb.Setup) bool
+
+	// Number is the interface number. It is assigned after the interfaces of
+	// the built-in classes when the host enumerates the device.
+	Number uint8
+}
+
+type usbString struct {
+	index uint8
+	s     string
+}
+
+type usbExtraDescriptor struct {
+	descriptorType uint8
+	data           []byte
+}
+
+var (
+	usbInterfaces         []*USBInterface
+	usbExtraDescriptors   []usbExtraDescriptor
+	usbStrings            []usbString
+	usbVendorSetupHandler func(usb.Setup) bool
+	usbCustomDescriptor   *descriptor.Descriptor
+
+	// Endpoints used by the built-in classes (CDC is always enabled) and
+	// endpoints allocated by AddUSBInterface.
+	usbEndpointsBuiltin uint32 = 1<<usb.CONTROL_ENDPOINT | 1<<usb.CDC_ENDPOINT_ACM | 1<<usb.CDC_ENDPOINT_OUT | 1<<usb.CDC_ENDPOINT_IN
+	usbEndpointsUser    uint32
+)
+
+// AddUSBInterface adds a user-defined interface to the USB device, next to the
+// built-in classes. The endpoints are allocated immediately, and their numbers
+// are stored in the Number field of each endpoint.
+//
+// This function must be executed from the init(), before the host enumerates
+// the device. Enabling a built-in class afterwards that needs an endpoint that
+// has been allocated by AddUSBInterface causes a panic.
+func AddUSBInterface(intf *USBInterface) error {
+	if usbCustomDescriptor != nil {
+		return ErrUSBAlreadyEnumerated
+	}
+	if len(usbInterfaces)+usbMaxBuiltinInterfaces >= usbMaxInterfaces {
+		return ErrUSBTooManyInterfaces
+	}
+
+	// Allocate the endpoints from the highest number down, the built-in
+	// classes use the low numbers.
+	used := usbEndpointsBuiltin | usbEndpointsUser
+	var allocated uint32
+	for i := range intf.Endpoints {
+		ep := &intf.Endpoints[i]
+		if ep.Type != usb.ENDPOINT_TYPE_BULK && ep.Type != usb.ENDPOINT_TYPE_INTERRUPT {
+			return ErrUSBInvalidEndpoint
+		}
+		n := usb.NumberOfEndpoints - 1
+		for ; n > 0; n-- {
+			if (used|allocated)&(1<<n) == 0 {
+				break
+			}
+		}
+		if n == 0 {
+			return ErrUSBNoFreeEndpoint
+		}
+		allocated |= 1 << n
+		ep.Number = uint8(n)
+	}
+
+	usbEndpointsUser |= allocated
+	for _, ep := range intf.Endpoints {
+		if ep.In {
+			endPoints[ep.Number] = uint32(ep.Type) | usb.EndpointIn
+			usbTxHandler[ep.Number] = ep.TxHandler
+		} else {
+			endPoints[ep.Number] = uint32(ep.Type) | usb.EndpointOut
+			usbRxHandler[ep.Number] = ep.RxHandler
+		}
+	}
+	usbInterfaces = append(usbInterfaces, intf)
+	return nil
+}
+
+// SetUSBVendorSetupHandler sets the handler for vendor specific setup requests
+// that are addressed to the device instead of an interface, such as the
+// requests of WebUSB and Microsoft OS 2.0 descriptors.
+func SetUSBVendorSetupHandler(setupHandler func(usb.Setup) bool) {
+	usbVendorSetupHandler = setupHandler
+}
+
+// SetUSBDescriptor sets a descriptor that is sent when the host requests a
+// descriptor of the given type that isn't handled by the USB stack itself, for
+// example a descriptor.TypeBOS descriptor. Setting a BOS descriptor also
+// changes the USB version of the device to 2.1, as required for the host to
+// request it.
+//
+// This function must be executed from the init().
+func SetUSBDescriptor(descriptorType uint8, data []byte) {
+	for i := range usbExtraDescriptors {
+		if usbExtraDescriptors[i].descriptorType == descriptorType {
+			usbExtraDescriptors[i].data = data
+			return
+		}
+	}
+	usbExtraDescriptors = append(usbExtraDescriptors, usbExtraDescriptor{descriptorType, data})
+}
+
+// SetUSBString sets the string descriptor with the given index, for string
+// indices that are used in interface or class specific descriptors. The
+// indices 1 to 3 are used for the manufacturer, product and serial number.
+// Only ASCII strings are supported.
+func SetUSBString(index uint8, s string) {
+	for i := range usbStrings {
+		if usbStrings[i].index == index {
+			usbStrings[i].s = s
+			return
+		}
+	}
+	usbStrings = append(usbStrings, usbString{index, s})
+}
+
+// reserveUSBEndpoints marks endpoints as used by a built-in class.
+func reserveUSBEndpoints(eps ...uint8) {
+	for _, ep := range eps {
+		if usbEndpointsUser&(1<<ep) != 0 {
+			panic("machine: USB endpoint already in use by AddUSBInterface")
+		}
+		usbEndpointsBuiltin |= 1 << ep
+	}
+}
+
+// usbCompositeDescriptor returns the descriptor of the built-in classes with
+// the user-defined interfaces appended. It is only built once, after which no
+// interfaces can be added anymore.
+func usbCompositeDescriptor(base descriptor.Descriptor) descriptor.Descriptor {
+	if usbCustomDescriptor != nil {
+		return *usbCustomDescriptor
+	}
+
+	number := base.Configuration[4] // number of interfaces of the built-in classes
+	var extra [][]byte
+	for _, intf := range usbInterfaces {
+		intf.Number = number
+		usbSetupHandler[number] = intf.SetupHandler
+		number++
+
+		d := descriptor.NewInterfaceType(intf.Number, uint8(len(intf.Endpoints)), intf.Class, intf.SubClass, intf.Protocol)
+		extra = append(extra, d.Bytes(), intf.ClassDescriptor)
+		for _, ep := range intf.Endpoints {
+			address := ep.Number
+			if ep.In {
+				address |= usb.EndpointIn
+			}
+			d := descriptor.NewEndpointType(address, ep.Type, usb.EndpointPacketSize, ep.Interval)
+			extra = append(extra, d.Bytes(), ep.ClassDescriptor)
+		}
+	}
+
+	d := base.Extend(uint8(len(usbInterfaces)), extra)
+	for _, extra := range usbExtraDescriptors {
+		if extra.descriptorType == descriptor.TypeBOS {
+			d.USBVersion(0x0210)
+		}
+	}
+	usbCustomDescriptor = &d
+	return d
+}
@@ -0,0 +1,96 @@
+//go:build rp2040 || (sam && atsamd21) || (sam && atsamd51) || (sam && atsame5x) || nrf52 || nrf52840 || nrf52833 || stm32 || esp32c3
+
+package machine
+
+import (
+	"time"
+	_ "unsafe" // for go:linkname
+)
+
+// WatchdogConfig holds the configuration of the watchdog timer.
+type WatchdogConfig struct {
+	// TimeoutMillis is the time (in milliseconds) after which the watchdog
+	// resets the chip if it hasn't been updated. It is rounded to a timeout
+	// the hardware supports, and is limited to WatchdogMaxTimeout.
+	TimeoutMillis uint32
+
+	// UpdateWhenIdle makes the scheduler update the watchdog whenever there
+	// are no goroutines to run, or the only one that is ready yields while it
+	// polls for something. Update doesn't need to be called at all: the chip
+	// is reset if some goroutine keeps running without ever yielding, for
+	// example because it is stuck in a loop.
+	UpdateWhenIdle bool
+}
+
+// watchdogTimer must be implemented by all chips that support a watchdog timer.
+type watchdogTimer interface {
+	// Configure the watchdog. It must be called before Start, some chips
+	// don't allow changing the configuration once the watchdog has started.
+	Configure(config WatchdogConfig) error
+
+	// Start the watchdog. It can't be stopped again, except by a reset.
+	Start() error
+
+	// Update the watchdog (also known as feeding or kicking it), to indicate
+	// that the program is still working.
+	Update()
+
+	// ResetCause returns why the chip was last reset.
+	ResetCause() ResetCause
+}
+
+// Make sure all chips implement the same API.
+var _ watchdogTimer = Watchdog
+
+const _ = WatchdogMaxTimeout
+
+// ResetCause is the reason the chip was last reset, as returned by
+// Watchdog.ResetCause.
+type ResetCause uint8
+
+const (
+	ResetCauseUnknown  ResetCause = iota // reset reason is not known
+	ResetCausePowerOn                    // power-on reset
+	ResetCausePin                        // reset pin
+	ResetCauseWatchdog                   // watchdog timer
+	ResetCauseSoftware                   // reset requested by software
+	ResetCauseBrownout                   // supply voltage too low
+	ResetCauseWakeup                     // wakeup from deep sleep or system off
+)
+
+// String returns a human readable name of the reset cause.
+func (c ResetCause) String() string {
+	switch c {
+	case ResetCausePowerOn:
+		return "power-on"
+	case ResetCausePin:
+		return "reset pin"
+	case ResetCauseWatchdog:
+		return "watchdog"
+	case ResetCauseSoftware:
+		return "software"
+	case ResetCauseBrownout:
+		return "brownout"
+	case ResetCauseWakeup:
+		return "wakeup"
+	default:
+		return "unknown"
+	}
+}
+
+//go:linkname setIdleHook runtime.setIdleHook
+func setIdleHook(hook func(), interval int64)
+
+// startWatchdogIdleHook lets the scheduler update the watchdog, if requested in
+// the configuration. It is called by Watchdog.Start. The watchdog is updated
+// at least twice per timeout.
+func startWatchdogIdleHook(config WatchdogConfig) {
+	if !config.UpdateWhenIdle {
+		return
+	}
+	timeout := config.TimeoutMillis
+	if timeout > WatchdogMaxTimeout {
+		timeout = WatchdogMaxTimeout
+	}
+	setIdleHook(Watchdog.Update, int64(timeout)*int64(time.Millisecond)/2)
+}
@@ -16,8 +16,15 @@ func Dial(network, address string) (Conn, error) {
 	return nil, ErrNotImplemented
 }
 
+// Listen announces on the local network address.
+//
+// On WASI, the listener is one of the sockets that the runtime passed to the
+// program (for example with wasmtime --tcplisten). Their addresses can't be
+// queried, so the address must be ":0" (or another unspecified IP address with
+// port 0), otherwise Listen returns an error. Other platforms don't support
+// listening yet.
 func Listen(network, address string) (Listener, error) {
-	return nil, ErrNotImplemented
+	return listen(network, address)
 }
 
 func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn, error) {
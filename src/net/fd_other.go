@@ -0,0 +1,56 @@
+//go:build !wasi
+
+package net
+
+import (
+	"os"
+	"time"
+)
+
+// netFD is the file descriptor of a network connection. Network connections
+// are not supported on this platform.
+type netFD struct {
+	net   string
+	laddr Addr
+	raddr Addr
+}
+
+func (fd *netFD) Read(p []byte) (int, error) {
+	return 0, ErrNotImplemented
+}
+
+func (fd *netFD) Write(p []byte) (int, error) {
+	return 0, ErrNotImplemented
+}
+
+func (fd *netFD) Close() error {
+	return ErrNotImplemented
+}
+
+func (fd *netFD) closeWrite() error {
+	return ErrNotImplemented
+}
+
+func (fd *netFD) accept() (*netFD, error) {
+	return nil, ErrNotImplemented
+}
+
+func (fd *netFD) SetDeadline(t time.Time) error {
+	return ErrNotImplemented
+}
+
+func (fd *netFD) SetReadDeadline(t time.Time) error {
+	return ErrNotImplemented
+}
+
+func (fd *netFD) SetWriteDeadline(t time.Time) error {
+	return ErrNotImplemented
+}
+
+func listen(network, address string) (Listener, error) {
+	return nil, ErrNotImplemented
+}
+
+func fileListener(f *os.File) (Listener, error) {
+	return nil, ErrNotImplemented
+}
@@ -0,0 +1,234 @@
+//go:build wasi
+
+package net
+
+// Network connections on WASI preview 1.
+//
+// WASI preview 1 can't create sockets, but the runtime can pass listening
+// sockets to the program as preopened file descriptors (for example wasmtime
+// with --tcplisten). Listen returns these sockets, connections accepted on
+// them are read and written with sock_recv and sock_send.
+//
+// All sockets are non-blocking. When a socket isn't ready, the goroutine waits
+// for it with poll_oneoff in the runtime, so that other goroutines can run in
+// the meantime.
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	errNoPreopenedSocket = errors.New("no preopened socket available")
+	errListenAddress     = errors.New("the address of a preopened socket can't be checked, listen on \":0\" or use FileListener")
+)
+
+// Preopened sockets that have already been returned by Listen.
+var listenedFDs = map[int]bool{}
+
+type netFD struct {
+	fd     int
+	net    string
+	laddr  Addr
+	raddr  Addr
+	closed bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newFD(fd int, net string, laddr, raddr Addr) (*netFD, error) {
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	return &netFD{fd: fd, net: net, laddr: laddr, raddr: raddr}, nil
+}
+
+// pollWait waits until the socket can be read (or written, if write is set),
+// for at most timeout nanoseconds if timeout isn't negative. It returns whether
+// the socket is ready.
+func pollWait(fd int, write bool, timeout int64) bool // in package runtime
+
+// wait waits until the socket can be tried again. It returns an error when the
+// socket was closed in the meantime or the deadline has passed.
+func (fd *netFD) wait(write bool, deadline time.Time) error {
+	if fd.closed {
+		return ErrClosed
+	}
+	timeout := int64(-1)
+	if !deadline.IsZero() {
+		timeout = int64(time.Until(deadline))
+		if timeout <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+	}
+	pollWait(fd.fd, write, timeout)
+	if fd.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (fd *netFD) Read(p []byte) (int, error) {
+	for {
+		n, err := syscall.Recv(fd.fd, p, 0)
+		if err == syscall.EAGAIN {
+			if err := fd.wait(false, fd.readDeadline); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, os.NewSyscallError("sock_recv", err)
+		}
+		if n == 0 && len(p) != 0 {
+			return 0, io.EOF
+		}
+		return n, nil
+	}
+}
+
+func (fd *netFD) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := syscall.Send(fd.fd, p[written:], 0)
+		if err == syscall.EAGAIN {
+			if err := fd.wait(true, fd.writeDeadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		if err != nil {
+			return written, os.NewSyscallError("sock_send", err)
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (fd *netFD) Close() error {
+	if fd.closed {
+		return ErrClosed
+	}
+	fd.closed = true
+	return syscall.Close(fd.fd)
+}
+
+func (fd *netFD) closeWrite() error {
+	return os.NewSyscallError("sock_shutdown", syscall.Shutdown(fd.fd, syscall.SHUT_WR))
+}
+
+func (fd *netFD) accept() (*netFD, error) {
+	for {
+		nfd, err := syscall.Accept(fd.fd, syscall.O_NONBLOCK)
+		if err == syscall.EAGAIN {
+			if err := fd.wait(false, fd.readDeadline); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, os.NewSyscallError("sock_accept", err)
+		}
+		// WASI preview 1 has no way to get the address of the peer.
+		return &netFD{fd: nfd, net: fd.net, laddr: fd.laddr, raddr: &TCPAddr{}}, nil
+	}
+}
+
+func (fd *netFD) SetDeadline(t time.Time) error {
+	fd.readDeadline = t
+	fd.writeDeadline = t
+	return nil
+}
+
+func (fd *netFD) SetReadDeadline(t time.Time) error {
+	fd.readDeadline = t
+	return nil
+}
+
+func (fd *netFD) SetWriteDeadline(t time.Time) error {
+	fd.writeDeadline = t
+	return nil
+}
+
+// listen returns the next preopened socket that wasn't returned before. WASI
+// preview 1 has no way to query the address of a socket, so the address can't
+// be used to select a socket. Only addresses that leave the choice of the
+// address to the system (":0", "0.0.0.0:0" or "[::]:0") are accepted, for
+// other addresses FileListener must be used with the right file descriptor.
+func listen(network, address string) (Listener, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, &OpError{Op: "listen", Net: network, Err: ErrNotImplemented}
+	}
+	laddr, ok := listenAddr(address)
+	if !ok {
+		return nil, &OpError{Op: "listen", Net: network, Addr: laddr, Err: errListenAddress}
+	}
+	// Preopened file descriptors start after stdin, stdout and stderr.
+	for fd := 3; ; fd++ {
+		isSocket, err := syscall.IsSocket(fd)
+		if err == syscall.EBADF {
+			break
+		}
+		if err != nil || !isSocket || listenedFDs[fd] {
+			continue
+		}
+		l, err := newTCPListener(fd, network, laddr)
+		if err != nil {
+			return nil, &OpError{Op: "listen", Net: network, Addr: laddr, Err: err}
+		}
+		listenedFDs[fd] = true
+		return l, nil
+	}
+	return nil, &OpError{Op: "listen", Net: network, Addr: laddr, Err: errNoPreopenedSocket}
+}
+
+// fileListener returns a listener for a socket that was opened as a file. The
+// file descriptor can't be duplicated in WASI preview 1, so the listener and
+// the file share it: only one of them must be closed.
+func fileListener(f *os.File) (Listener, error) {
+	fd := int(f.Fd())
+	isSocket, err := syscall.IsSocket(fd)
+	if err != nil {
+		return nil, os.NewSyscallError("fd_fdstat_get", err)
+	}
+	if !isSocket {
+		return nil, syscall.ENOTSOCK
+	}
+	return newTCPListener(fd, "tcp", &TCPAddr{})
+}
+
+func newTCPListener(fd int, network string, laddr Addr) (*TCPListener, error) {
+	nfd, err := newFD(fd, network, laddr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &TCPListener{fd: nfd}, nil
+}
+
+// listenAddr parses the address given to Listen, and returns whether it lets
+// the system choose the address: an unspecified IP address and port 0.
+func listenAddr(address string) (*TCPAddr, bool) {
+	addr := &TCPAddr{}
+	host, port, err := SplitHostPort(address)
+	if err != nil {
+		return addr, false
+	}
+	if host != "" {
+		addr.IP = ParseIP(host)
+		if addr.IP == nil || !addr.IP.IsUnspecified() {
+			return addr, false
+		}
+	}
+	n, i, ok := dtoi(port)
+	if port != "" && (!ok || i != len(port)) {
+		return addr, false
+	}
+	addr.Port = n
+	return addr, n == 0
+}
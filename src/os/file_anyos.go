@@ -136,6 +136,9 @@ func (f unixFileHandle) Fd() uintptr {
 // The other bits are currently unused. For compatibility with Go 1.12
 // and earlier, use a non-zero mode. Use mode 0400 for a read-only
 // file and 0600 for a readable+writable file.
+//
+// On WASI, which has no file permissions, Chmod only checks that the file
+// exists.
 func Chmod(name string, mode FileMode) error {
 	longName := fixLongPath(name)
 	e := ignoringEINTR(func() error {
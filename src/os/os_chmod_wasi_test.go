@@ -0,0 +1,23 @@
+//go:build wasi
+
+package os_test
+
+import (
+	. "os"
+	"testing"
+)
+
+// WASI preview 1 has no file permissions, so Chmod can only check that the
+// file exists.
+func TestChmodWASI(t *testing.T) {
+	f := newFile("TestChmod", t)
+	defer Remove(f.Name())
+	defer f.Close()
+
+	if err := Chmod(f.Name(), 0456); err != nil {
+		t.Fatalf("chmod %s: %s", f.Name(), err)
+	}
+	if err := Chmod(f.Name()+".missing", 0644); !IsNotExist(err) {
+		t.Errorf("chmod of a missing file: expected a not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !windows && !baremetal && !js
+
+package os_test
+
+import (
+	. "os"
+	"testing"
+	"time"
+)
+
+func TestChtimes(t *testing.T) {
+	f := newFile("TestChtimes", t)
+	defer Remove(f.Name())
+	f.Write([]byte("hello, world\n"))
+	f.Close()
+
+	atime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	if err := Chtimes(f.Name(), atime, mtime); err != nil {
+		t.Fatalf("Chtimes %s: %s", f.Name(), err)
+	}
+	st, err := Stat(f.Name())
+	if err != nil {
+		t.Fatalf("Stat %s: %s", f.Name(), err)
+	}
+	if !st.ModTime().Equal(mtime) {
+		t.Errorf("ModTime didn't change: expected %s, got %s", mtime, st.ModTime())
+	}
+}
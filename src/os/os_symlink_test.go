@@ -1,4 +1,4 @@
-//go:build !windows && !baremetal && !js && !wasi
+//go:build !windows && !baremetal && !js
 
 // Copyright 2009 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
@@ -11,8 +11,6 @@ import (
 	"testing"
 )
 
-// TODO: Move this back into os_anyos_test.go when wasi supports symlink
-
 func TestSymlink(t *testing.T) {
 	//testenv.MustHaveSymlink(t)
 
@@ -1063,6 +1063,7 @@ func (v Value) Set(x Value) {
 		xptr = unsafe.Pointer(&value)
 	}
 	memcpy(v.value, xptr, size)
+	gcWriteBarrier(v.value)
 }
 
 func (v Value) SetBool(x bool) {
@@ -1566,6 +1567,9 @@ func (e *ValueError) Error() string {
 //go:linkname memcpy runtime.memcpy
 func memcpy(dst, src unsafe.Pointer, size uintptr)
 
+//go:linkname gcWriteBarrier runtime.gcWriteBarrier
+func gcWriteBarrier(ptr unsafe.Pointer)
+
 //go:linkname alloc runtime.alloc
 func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer
 
@@ -21,12 +21,23 @@ var globalsEndSymbol [0]byte
 //go:extern _stack_top
 var stackTopSymbol [0]byte
 
+//go:extern _heap_regions_start
+var heapRegionsStartSymbol [0]byte
+
+//go:extern _heap_regions_end
+var heapRegionsEndSymbol [0]byte
+
 var (
 	heapStart    = uintptr(unsafe.Pointer(&heapStartSymbol))
 	heapEnd      = uintptr(unsafe.Pointer(&heapEndSymbol))
 	globalsStart = uintptr(unsafe.Pointer(&globalsStartSymbol))
 	globalsEnd   = uintptr(unsafe.Pointer(&globalsEndSymbol))
 	stackTop     = uintptr(unsafe.Pointer(&stackTopSymbol))
+
+	// Table of additional heap regions (such as external RAM), as start/end
+	// address pairs. It is empty unless the linker script defines it.
+	heapRegionsStart = uintptr(unsafe.Pointer(&heapRegionsStartSymbol))
+	heapRegionsEnd   = uintptr(unsafe.Pointer(&heapRegionsEndSymbol))
 )
 
 // growHeap tries to grow the heap size. It returns true if it succeeds, false
@@ -77,6 +88,12 @@ func now() (sec int64, nsec int32, mono int64) {
 	return
 }
 
+// setWallClock sets the time offset so that time.Now returns the given Unix
+// time in nanoseconds. It is called by machine.RTC when the clock is set.
+func setWallClock(unixNano int64) {
+	timeOffset = unixNano - nanotime()
+}
+
 // AdjustTimeOffset adds the given offset to the built-in time offset. A
 // positive value adds to the time (skipping some time), a negative value moves
 // the clock into the past.
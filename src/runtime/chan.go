@@ -248,6 +248,7 @@ func (ch *channel) push(value unsafe.Pointer) bool {
 		value,
 		ch.elementSize,
 	)
+	gcWriteBarrier(ch.buf)
 
 	// update buffer state
 	ch.bufUsed++
@@ -277,6 +278,7 @@ func (ch *channel) pop(value unsafe.Pointer) bool {
 		addr,
 		ch.elementSize,
 	)
+	gcWriteBarrier(value)
 
 	// zero buffer element to allow garbage collection of value
 	memzero(
@@ -324,6 +326,7 @@ func (ch *channel) trySend(value unsafe.Pointer) bool {
 
 		// copy value to receiver
 		memcpy(dst, value, ch.elementSize)
+		gcWriteBarrier(dst)
 
 		// change state to empty if there are no more receivers
 		if ch.blocked == nil {
@@ -390,6 +393,7 @@ func (ch *channel) tryRecv(value unsafe.Pointer) (bool, bool) {
 
 			// copy sender's value
 			memcpy(value, src, ch.elementSize)
+			gcWriteBarrier(value)
 
 			if ch.blocked == nil {
 				// last sender unblocked - update state
@@ -0,0 +1,72 @@
+package runtime
+
+import "unsafe"
+
+// The machine package can't import the runtime package, so it accesses Cond
+// through these functions (using go:linkname), to let a goroutine wait for an
+// interrupt.
+
+// machineCondNotify calls Notify on the Cond at c.
+func machineCondNotify(c unsafe.Pointer) {
+	(*Cond)(c).Notify()
+}
+
+// machineCondWait calls Wait on the Cond at c.
+func machineCondWait(c unsafe.Pointer) {
+	(*Cond)(c).Wait()
+}
+
+// machineCondWaitTimeout is like machineCondWait, but gives up after timeout
+// nanoseconds and reports whether a notification was received. The timer it
+// needs is allocated on the first call and stored in *timerPtr, so that later
+// calls with the same timer don't allocate.
+func machineCondWaitTimeout(c unsafe.Pointer, timerPtr *unsafe.Pointer, timeout int64) bool {
+	cond := (*Cond)(c)
+	if cond.Poll() {
+		return true
+	}
+	if timeout <= 0 {
+		return false
+	}
+	if !hasScheduler {
+		// Without a scheduler, timers don't run and there is nothing else to
+		// do in the meantime: poll until the deadline.
+		deadline := nanotime() + timeout
+		for nanotime() < deadline {
+			if cond.Poll() {
+				return true
+			}
+		}
+		return false
+	}
+	ct := (*condTimer)(*timerPtr)
+	if ct == nil {
+		ct = new(condTimer)
+		ct.node.timer = &ct.timer
+		ct.node.callback = condTimerExpired
+		*timerPtr = unsafe.Pointer(ct)
+	}
+	ct.cond = cond
+	ct.expired = false
+	ct.timer.when = nanotime() + timeout
+	addTimer(&ct.node)
+	cond.Wait()
+	removeTimer(&ct.timer)
+	return !ct.expired
+}
+
+// condTimer is a timer that notifies a Cond when it expires.
+type condTimer struct {
+	node    timerNode // must be the first field, see condTimerExpired
+	timer   timer
+	cond    *Cond
+	expired bool
+}
+
+// condTimerExpired is the timer callback of a condTimer. It is called by the
+// scheduler, so the waiting goroutine isn't running at the same time.
+func condTimerExpired(tn *timerNode) {
+	ct := (*condTimer)(unsafe.Pointer(tn))
+	ct.expired = true
+	ct.cond.Notify()
+}
@@ -33,6 +33,12 @@ func (c *Cond) Poll() bool {
 // If the condition variable was previously notified, this returns immediately.
 func (c *Cond) Wait() {
 	for !c.Poll() {
+		if idleHook != nil {
+			// An interrupt may not arrive before the idle hook is due, so
+			// poll instead of waiting for one.
+			runIdleHook(0)
+			continue
+		}
 		waitForEvents()
 	}
 }
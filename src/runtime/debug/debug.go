@@ -1,4 +1,4 @@
-// Package debug is a dummy package that is not yet implemented.
+// Package debug is a partial implementation of the runtime/debug package.
 package debug
 
 // SetMaxStack sets the maximum amount of memory that can be used by a single
@@ -54,7 +54,42 @@ type Module struct {
 	Replace *Module // replaced by this module
 }
 
-// Not implemented.
-func SetGCPercent(n int) int {
-	return n
+// SetGCPercent sets the garbage collection target percentage: a collection is
+// triggered when the ratio of freshly allocated data to live data remaining
+// after the previous collection reaches this percentage. SetGCPercent returns
+// the previous setting. The initial setting is the value of the GOGC
+// environment variable at startup, or 100 if the variable is not set. A
+// negative percentage disables garbage collection until the heap is full.
+func SetGCPercent(percent int) int {
+	// The runtime stores the percentage as an int32. Clamp it, so that large
+	// values don't wrap around (and large negative values still mean off).
+	if percent > 1<<31-1 {
+		percent = 1<<31 - 1
+	} else if percent < 0 {
+		percent = -1
+	}
+	return int(setGCPercent(int32(percent)))
+}
+
+// SetMemoryLimit provides the runtime with a soft memory limit. The garbage
+// collector runs more often as the heap gets close to the limit, and the heap
+// is only grown past it when there is no other way to satisfy an allocation.
+// SetMemoryLimit returns the previously set memory limit. A negative input does
+// not adjust the limit, and allows for retrieval of the currently set memory
+// limit. The initial setting is the value of the GOMEMLIMIT environment variable
+// at startup, or math.MaxInt64 if the variable is not set.
+func SetMemoryLimit(limit int64) int64 {
+	return setMemoryLimit(limit)
 }
+
+// FreeOSMemory forces a garbage collection.
+//
+// Unlike upstream Go, memory is not returned to the operating system.
+func FreeOSMemory() {
+	freeOSMemory()
+}
+
+// Implemented in the runtime.
+func setGCPercent(percent int32) int32
+func setMemoryLimit(limit int64) int64
+func freeOSMemory()
@@ -1,4 +1,4 @@
-//go:build gc.conservative || gc.precise
+//go:build gc.conservative || gc.precise || gc.incremental
 
 package runtime
 
@@ -11,7 +11,9 @@ package runtime
 // satisfy the allocation. If it finds one, it marks the first one as the "head"
 // and the following ones (if any) as the "tail" (see below). If it cannot find
 // any free space, it will perform a garbage collection cycle and try again. If
-// it still cannot find any free space, it gives up.
+// it still cannot find any free space, it gives up. A garbage collection cycle
+// is also started when the heap has grown by GOGC percent since the last cycle
+// (see gcSetHeapGoal).
 //
 // Every block has some metadata, which is stored at the end of the heap.
 // The four states are "free", "head", "tail", and "mark". During normal
@@ -23,6 +25,22 @@ package runtime
 // metadataStart..heapEnd. The actual blocks are stored in
 // heapStart..metadataStart.
 //
+// Some systems have more memory than the main heap, for example external PSRAM.
+// This memory can be added as separate heap regions (see addHeapRegion). Every
+// region stores its own metadata at the end of the region, just like the main
+// heap. Blocks are numbered consecutively over all regions: the main heap
+// comes first and the additional regions follow in the order they were added.
+// An object never spans more than one region.
+//
+// With -gc=incremental, the mark phase is split in small steps that are done
+// during allocation (see gcMarkStep), so that a collection cycle doesn't stop
+// the program for a long time. Marked objects that still need to be scanned are
+// kept on the grey stack. The compiler inserts a write barrier
+// (gcWriteBarrier) after every pointer store that may modify a heap object, so
+// that an object that was already scanned is scanned again. The mark phase is
+// finished by scanning the roots (stacks and globals) once more, followed by a
+// regular sweep.
+//
 // More information:
 // https://aykevl.nl/2020/09/gc-tinygo
 // https://github.com/micropython/micropython/wiki/Memory-Manager
@@ -46,17 +64,57 @@ const (
 	stateBits          = 2 // how many bits a block state takes (see blockState type)
 	blocksPerStateByte = 8 / stateBits
 	markStackSize      = 4 * unsafe.Sizeof((*int)(nil)) // number of to-be-marked blocks to queue before forcing a rescan
+	greyStackSize      = 64                             // number of to-be-scanned blocks for the incremental GC
 )
 
 var (
 	metadataStart unsafe.Pointer // pointer to the start of the heap metadata
 	nextAlloc     gcBlock        // the next block that should be tried by the allocator
+	mainEndBlock  gcBlock        // the block just past the end of the main heap
 	endBlock      gcBlock        // the block just past the end of the available space
 	gcTotalAlloc  uint64         // total number of bytes allocated
 	gcMallocs     uint64         // total number of allocations
 	gcFrees       uint64         // total number of objects freed
 )
 
+// maxHeapRegions is the maximum number of heap regions that can be added in
+// addition to the main heap.
+const maxHeapRegions = 4
+
+// heapRegion is an area of memory that is used as heap in addition to the main
+// heap (heapStart..heapEnd). Unlike the main heap, it cannot grow.
+type heapRegion struct {
+	start         uintptr        // start of the first block
+	metadataStart unsafe.Pointer // start of the metadata, just past the last block
+	end           uintptr        // end of the region (and of the metadata)
+	firstBlock    gcBlock        // the first block in this region
+	endBlock      gcBlock        // the block just past the end of this region
+}
+
+var (
+	heapRegions    [maxHeapRegions]heapRegion
+	numHeapRegions int
+)
+
+// State of the incremental GC, only used with -gc=incremental.
+var (
+	gcMarking     bool                          // whether the mark phase is in progress
+	gcRescanning  bool                          // whether all marked blocks are being rescanned after a grey stack overflow
+	gcRescanBlock gcBlock                       // the next block to rescan
+	greyStack     [greyStackSize]gcBlock        // marked blocks that still need to be scanned
+	greyStackLen  uintptr                       // number of blocks on greyStack
+	gcStepSize    uintptr                = 1024 // maximum number of bytes to scan in a single mark step
+)
+
+// Pacing state, see gcSetHeapGoal.
+var (
+	gcAllocSinceSweep uintptr // number of bytes allocated since the last sweep
+	gcHeapLive        uintptr // number of bytes in use after the last sweep
+	gcHeapGoal        uintptr // heap size at which the next collection cycle should be finished
+	gcHeapTrigger     uintptr // heap size at which the next collection cycle is started
+	gcMinHeapGoal     uintptr // heap goal for an empty heap (at GOGC=100)
+)
+
 // zeroSizedAlloc is just a sentinel that gets returned when allocating 0 bytes.
 var zeroSizedAlloc uint8
 
@@ -97,10 +155,48 @@ type gcBlock uintptr
 // blockFromAddr returns a block given an address somewhere in the heap (which
 // might not be heap-aligned).
 func blockFromAddr(addr uintptr) gcBlock {
-	if gcAsserts && (addr < heapStart || addr >= uintptr(metadataStart)) {
+	if addr >= heapStart && addr < uintptr(metadataStart) {
+		return gcBlock((addr - heapStart) / bytesPerBlock)
+	}
+	for i := 0; i < numHeapRegions; i++ {
+		r := &heapRegions[i]
+		if addr >= r.start && addr < uintptr(r.metadataStart) {
+			return r.firstBlock + gcBlock((addr-r.start)/bytesPerBlock)
+		}
+	}
+	if gcAsserts {
 		runtimePanic("gc: trying to get block from invalid address")
 	}
-	return gcBlock((addr - heapStart) / bytesPerBlock)
+	return 0
+}
+
+// region returns the additional heap region this block is part of, or nil if
+// the block is part of the main heap.
+func (b gcBlock) region() *heapRegion {
+	if b < mainEndBlock {
+		return nil
+	}
+	for i := 0; i < numHeapRegions; i++ {
+		r := &heapRegions[i]
+		if b < r.endBlock {
+			return r
+		}
+	}
+	if gcAsserts {
+		runtimePanic("gc: block outside of heap")
+	}
+	return nil
+}
+
+// isRegionStart returns whether this block is the first block of an additional
+// heap region.
+func (b gcBlock) isRegionStart() bool {
+	for i := 0; i < numHeapRegions; i++ {
+		if b == heapRegions[i].firstBlock {
+			return true
+		}
+	}
+	return false
 }
 
 // Return a pointer to the start of the allocated object.
@@ -110,6 +206,9 @@ func (b gcBlock) pointer() unsafe.Pointer {
 
 // Return the address of the start of the allocated object.
 func (b gcBlock) address() uintptr {
+	if r := b.region(); r != nil {
+		return r.start + uintptr(b-r.firstBlock)*bytesPerBlock
+	}
 	addr := heapStart + uintptr(b)*bytesPerBlock
 	if gcAsserts && addr > uintptr(metadataStart) {
 		runtimePanic("gc: block pointing inside metadata")
@@ -135,27 +234,41 @@ func (b gcBlock) findHead() gcBlock {
 // findNext returns the first block just past the end of the tail. This may or
 // may not be the head of an object.
 func (b gcBlock) findNext() gcBlock {
+	end := mainEndBlock
+	if r := b.region(); r != nil {
+		end = r.endBlock
+	}
 	if b.state() == blockStateHead || b.state() == blockStateMark {
 		b++
 	}
-	for b.address() < uintptr(metadataStart) && b.state() == blockStateTail {
+	for b < end && b.state() == blockStateTail {
 		b++
 	}
 	return b
 }
 
+// stateByte returns a pointer to the metadata byte that contains the state of
+// this block, and the shift of the state bits within this byte.
+func (b gcBlock) stateByte() (*uint8, uintptr) {
+	metadata, index := metadataStart, uintptr(b)
+	if r := b.region(); r != nil {
+		metadata, index = r.metadataStart, uintptr(b-r.firstBlock)
+	}
+	return (*uint8)(unsafe.Add(metadata, index/blocksPerStateByte)), (index % blocksPerStateByte) * stateBits
+}
+
 // State returns the current block state.
 func (b gcBlock) state() blockState {
-	stateBytePtr := (*uint8)(unsafe.Add(metadataStart, b/blocksPerStateByte))
-	return blockState(*stateBytePtr>>((b%blocksPerStateByte)*stateBits)) & blockStateMask
+	stateBytePtr, shift := b.stateByte()
+	return blockState(*stateBytePtr>>shift) & blockStateMask
 }
 
 // setState sets the current block to the given state, which must contain more
 // bits than the current state. Allowed transitions: from free to any state and
 // from head to mark.
 func (b gcBlock) setState(newState blockState) {
-	stateBytePtr := (*uint8)(unsafe.Add(metadataStart, b/blocksPerStateByte))
-	*stateBytePtr |= uint8(newState << ((b % blocksPerStateByte) * stateBits))
+	stateBytePtr, shift := b.stateByte()
+	*stateBytePtr |= uint8(newState << shift)
 	if gcAsserts && b.state() != newState {
 		runtimePanic("gc: setState() was not successful")
 	}
@@ -163,8 +276,8 @@ func (b gcBlock) setState(newState blockState) {
 
 // markFree sets the block state to free, no matter what state it was in before.
 func (b gcBlock) markFree() {
-	stateBytePtr := (*uint8)(unsafe.Add(metadataStart, b/blocksPerStateByte))
-	*stateBytePtr &^= uint8(blockStateMask << ((b % blocksPerStateByte) * stateBits))
+	stateBytePtr, shift := b.stateByte()
+	*stateBytePtr &^= uint8(blockStateMask << shift)
 	if gcAsserts && b.state() != blockStateFree {
 		runtimePanic("gc: markFree() was not successful")
 	}
@@ -180,15 +293,24 @@ func (b gcBlock) unmark() {
 		runtimePanic("gc: unmark() on a block that is not marked")
 	}
 	clearMask := blockStateMask ^ blockStateHead // the bits to clear from the state
-	stateBytePtr := (*uint8)(unsafe.Add(metadataStart, b/blocksPerStateByte))
-	*stateBytePtr &^= uint8(clearMask << ((b % blocksPerStateByte) * stateBits))
+	stateBytePtr, shift := b.stateByte()
+	*stateBytePtr &^= uint8(clearMask << shift)
 	if gcAsserts && b.state() != blockStateHead {
 		runtimePanic("gc: unmark() was not successful")
 	}
 }
 
 func isOnHeap(ptr uintptr) bool {
-	return ptr >= heapStart && ptr < uintptr(metadataStart)
+	if ptr >= heapStart && ptr < uintptr(metadataStart) {
+		return true
+	}
+	for i := 0; i < numHeapRegions; i++ {
+		r := &heapRegions[i]
+		if ptr >= r.start && ptr < uintptr(r.metadataStart) {
+			return true
+		}
+	}
+	return false
 }
 
 // Initialize the memory allocator.
@@ -201,6 +323,103 @@ func initHeap() {
 	// Set all block states to 'free'.
 	metadataSize := heapEnd - uintptr(metadataStart)
 	memzero(unsafe.Pointer(metadataStart), metadataSize)
+
+	// Set up GC pacing. The initial heap (including any heap regions added
+	// below) is the minimum heap goal, so that by default a fixed size heap on
+	// baremetal systems is only collected once it is full.
+	gcMinHeapGoal = uintptr(mainEndBlock) * bytesPerBlock
+	if !baremetal {
+		gcReadEnv()
+	}
+	gcSetHeapGoal()
+
+	// Add the heap regions from the linker script, if there are any. The
+	// table consists of pointer-sized start/end address pairs.
+	const entrySize = 2 * unsafe.Sizeof(uintptr(0))
+	for entry := heapRegionsStart; entry+entrySize <= heapRegionsEnd; entry += entrySize {
+		start := *(*uintptr)(unsafe.Pointer(entry))
+		end := *(*uintptr)(unsafe.Pointer(entry + unsafe.Sizeof(uintptr(0))))
+		addHeapRegion(start, end)
+	}
+}
+
+// AddHeapRegion adds the memory in start..end to the heap, in addition to the
+// main heap and the heap regions from the linker script. It reports whether the
+// memory was added: a region that is too small to hold even a single object is
+// ignored, and so is any region when the GC doesn't support heap regions
+// (-gc=leaking, -gc=none and -gc=custom). It panics when there are more than 4
+// heap regions, including those from the linker script.
+//
+// This is meant for memory that only becomes usable at runtime, such as
+// external PSRAM that must be configured by the program first. The memory
+// must be fully initialized and usable when AddHeapRegion is called: the GC
+// writes its metadata to the end of the region immediately. From then on the
+// memory belongs to the GC until the program exits, a region can't be removed
+// again. It must not overlap the main heap, the stack, globals or another heap
+// region, or be accessed in any other way.
+//
+// AddHeapRegion may be called at any time after package initialization,
+// including while an incremental collection cycle (-gc=incremental) is in
+// progress: all blocks of a new region are free, so they don't need to be
+// marked. Like any allocation, it must not be called from an interrupt.
+//
+// This function is specific to TinyGo.
+func AddHeapRegion(start, end uintptr) bool {
+	if interrupt.In() {
+		runtimePanic("gc: heap region added in interrupt")
+	}
+	return addHeapRegion(start, end)
+}
+
+// addHeapRegion adds the memory in start..end to the heap, in addition to the
+// main heap. This can be used for memory that is not contiguous with the main
+// heap, such as external PSRAM. It may be called at any time after initHeap,
+// for example once the external memory has been configured. The allocator
+// searches heap regions in the order they were added, after the main heap.
+func addHeapRegion(start, end uintptr) bool {
+	if numHeapRegions == len(heapRegions) {
+		runtimePanic("gc: too many heap regions")
+	}
+	start = align(start)
+	if end <= start || end-start < 2*bytesPerBlock {
+		// Too small to be useful.
+		return false
+	}
+	metadataSize := heapMetadataSize(end - start)
+	r := &heapRegions[numHeapRegions]
+	r.start = start
+	r.metadataStart = unsafe.Pointer(end - metadataSize)
+	r.end = end
+	memzero(r.metadataStart, metadataSize)
+	numHeapRegions++
+	calculateHeapRegionBlocks()
+	gcMinHeapGoal += uintptr(r.endBlock-r.firstBlock) * bytesPerBlock
+	gcSetHeapGoal()
+	if gcDebug {
+		println("heap region:      ", start, "-", end)
+	}
+	return true
+}
+
+// heapMetadataSize returns the number of metadata bytes needed for a heap area
+// of the given size, such that it keeps 2 bits of information about every block
+// that fits in the rest of the area.
+func heapMetadataSize(totalSize uintptr) uintptr {
+	return (totalSize + blocksPerStateByte*bytesPerBlock) / (1 + blocksPerStateByte*bytesPerBlock)
+}
+
+// calculateHeapRegionBlocks numbers the blocks of the additional heap regions,
+// following the blocks of the main heap. It must be called each time the size
+// of the main heap or the list of regions changes.
+func calculateHeapRegionBlocks() {
+	block := mainEndBlock
+	for i := 0; i < numHeapRegions; i++ {
+		r := &heapRegions[i]
+		r.firstBlock = block
+		block += gcBlock((uintptr(r.metadataStart) - r.start) / bytesPerBlock)
+		r.endBlock = block
+	}
+	endBlock = block
 }
 
 // setHeapEnd is called to expand the heap. The heap can only grow, not shrink.
@@ -243,12 +462,13 @@ func calculateHeapAddresses() {
 	totalSize := heapEnd - heapStart
 
 	// Allocate some memory to keep 2 bits of information about every block.
-	metadataSize := (totalSize + blocksPerStateByte*bytesPerBlock) / (1 + blocksPerStateByte*bytesPerBlock)
+	metadataSize := heapMetadataSize(totalSize)
 	metadataStart = unsafe.Pointer(heapEnd - metadataSize)
 
 	// Use the rest of the available memory as heap.
 	numBlocks := (uintptr(metadataStart) - heapStart) / bytesPerBlock
-	endBlock = gcBlock(numBlocks)
+	mainEndBlock = gcBlock(numBlocks)
+	calculateHeapRegionBlocks()
 	if gcDebug {
 		println("heapStart:        ", heapStart)
 		println("heapEnd:          ", heapEnd)
@@ -284,6 +504,23 @@ func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer {
 	gcTotalAlloc += uint64(size)
 	gcMallocs++
 
+	// Start a new collection cycle once the heap has grown enough since the
+	// last one (see gcSetHeapGoal).
+	gcAllocSinceSweep += size
+	if gcIncremental {
+		// Do a bit of marking work, or start a new mark phase.
+		if gcMarking {
+			if gcMarkStep(gcStepSize) {
+				// Nothing left to mark, finish the cycle.
+				runGC()
+			}
+		} else if gcHeapLive+gcAllocSinceSweep >= gcHeapTrigger {
+			gcStartMark()
+		}
+	} else if gcHeapLive+gcAllocSinceSweep >= gcHeapTrigger {
+		runGC()
+	}
+
 	neededBlocks := (size + (bytesPerBlock - 1)) / bytesPerBlock
 
 	// Continue looping until a run of free blocks has been found that fits the
@@ -300,14 +537,7 @@ func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer {
 				// could be found. Run a garbage collection cycle to reclaim
 				// free memory and try again.
 				heapScanCount = 2
-				freeBytes := runGC()
-				heapSize := uintptr(metadataStart) - heapStart
-				if freeBytes < heapSize/3 {
-					// Ensure there is at least 33% headroom.
-					// This percentage was arbitrarily chosen, and may need to
-					// be tuned in the future.
-					growHeap()
-				}
+				runGC()
 			} else {
 				// Even after garbage collection, no free memory could be found.
 				// Try to increase heap size.
@@ -337,6 +567,11 @@ func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer {
 			continue
 		}
 
+		// Allocations cannot span multiple heap regions.
+		if numHeapRegions != 0 && numFreeBlocks != 0 && index.isRegionStart() {
+			numFreeBlocks = 0
+		}
+
 		// Is the block we're looking at free?
 		if index.state() != blockStateFree {
 			// This block is in use. Try again from this point.
@@ -361,6 +596,12 @@ func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer {
 			for i := thisAlloc + 1; i != nextAlloc; i++ {
 				i.setState(blockStateTail)
 			}
+			if gcIncremental && gcMarking {
+				// Objects allocated during the mark phase must survive this
+				// cycle, and must be scanned as they may be initialized with
+				// pointers without a write barrier.
+				greyBlock(thisAlloc)
+			}
 
 			// Return a pointer to this allocation.
 			pointer := thisAlloc.pointer()
@@ -385,7 +626,8 @@ func realloc(ptr unsafe.Pointer, size uintptr) unsafe.Pointer {
 	}
 
 	ptrAddress := uintptr(ptr)
-	endOfTailAddress := blockFromAddr(ptrAddress).findNext().address()
+	block := blockFromAddr(ptrAddress)
+	endOfTailAddress := block.address() + uintptr(block.findNext()-block)*bytesPerBlock
 
 	// this might be a few bytes longer than the original size of
 	// ptr, because we align to full blocks of size bytesPerBlock
@@ -418,6 +660,12 @@ func runGC() (freeBytes uintptr) {
 		println("running collection cycle...")
 	}
 
+	// With the incremental GC, a mark phase might already be in progress. In
+	// that case, scanning all roots and finishing the mark phase completes it.
+	if gcIncremental {
+		gcMarking = true
+	}
+
 	// Mark phase: mark all reachable objects, recursively.
 	markStack()
 	markGlobals()
@@ -456,6 +704,18 @@ func runGC() (freeBytes uintptr) {
 	// Sweep phase: free all non-marked objects and unmark marked objects for
 	// the next collection cycle.
 	freeBytes = sweep()
+	if gcIncremental {
+		gcMarking = false
+	}
+
+	// Calculate when to run the next cycle, and make sure the heap is big
+	// enough to get there.
+	gcHeapLive = uintptr(endBlock)*bytesPerBlock - freeBytes
+	gcAllocSinceSweep = 0
+	gcSetHeapGoal()
+	if gcGrowHeap() {
+		freeBytes = uintptr(endBlock)*bytesPerBlock - gcHeapLive
+	}
 
 	// Show how much has been sweeped, for debugging.
 	if gcDebug {
@@ -465,6 +725,74 @@ func runGC() (freeBytes uintptr) {
 	return
 }
 
+// gcSetHeapGoal calculates when the next collection cycle should run, based on
+// the amount of memory that survived the last cycle. Like in upstream Go, the
+// live heap may grow by GOGC percent (see debug.SetGCPercent) before it is
+// collected again. The initial heap size, scaled by GOGC, is the minimum goal.
+// A memory limit (see debug.SetMemoryLimit) lowers the goal, but it is a soft
+// limit: the heap still grows past it when there is not enough free memory
+// after a collection cycle.
+func gcSetHeapGoal() {
+	if gcPercent < 0 {
+		// GOGC=off: only collect when the heap is full.
+		gcHeapGoal = ^uintptr(0)
+	} else {
+		goal := uint64(gcHeapLive) * uint64(100+gcPercent) / 100
+		if minGoal := uint64(gcMinHeapGoal) * uint64(gcPercent) / 100; goal < minGoal {
+			goal = minGoal
+		}
+		if goal > uint64(^uintptr(0)) {
+			goal = uint64(^uintptr(0))
+		}
+		gcHeapGoal = uintptr(goal)
+	}
+	if gcMemoryLimit != maxInt64 && uint64(gcMemoryLimit) < uint64(gcHeapGoal) {
+		// Collect more often to stay below the memory limit, but not so often
+		// that the program doesn't make any progress anymore.
+		gcHeapGoal = uintptr(gcMemoryLimit)
+		if minGoal := gcHeapLive + gcHeapLive/16 + bytesPerBlock; gcHeapGoal < minGoal {
+			gcHeapGoal = minGoal
+		}
+	}
+
+	gcHeapTrigger = gcHeapGoal
+	if gcIncremental {
+		// Start marking halfway between the live heap and the goal (or the end
+		// of the heap if that comes first), so that marking is finished before
+		// the goal is reached.
+		goal := gcHeapGoal
+		if heapSize := uintptr(endBlock) * bytesPerBlock; goal > heapSize {
+			goal = heapSize
+		}
+		if goal > gcHeapLive {
+			gcHeapTrigger = gcHeapLive + (goal-gcHeapLive)/2
+		}
+	}
+}
+
+// gcGrowHeap grows the heap after a collection cycle, so that the heap goal can
+// be reached without running out of memory first. With GOGC=off, it ensures
+// there is at least 33% headroom instead. It returns whether the heap was grown.
+func gcGrowHeap() bool {
+	target := gcHeapGoal
+	if target == ^uintptr(0) {
+		// This percentage was arbitrarily chosen, and may need to be tuned in
+		// the future.
+		target = gcHeapLive + gcHeapLive/2
+	}
+	if uint64(target) > uint64(gcMemoryLimit) {
+		target = uintptr(gcMemoryLimit)
+	}
+	grown := false
+	for uintptr(endBlock)*bytesPerBlock < target && growHeap() {
+		grown = true
+	}
+	if grown {
+		gcSetHeapGoal()
+	}
+	return grown
+}
+
 // markRoots reads all pointers from start to end (exclusive) and if they look
 // like a heap pointer and are unmarked, marks them and scans that object as
 // well (recursively). The start and end parameters must be valid pointers and
@@ -501,6 +829,12 @@ var stackOverflow bool
 
 // startMark starts the marking process on a root and all of its children.
 func startMark(root gcBlock) {
+	if gcIncremental {
+		// Only mark the root here, its children are marked in later mark
+		// steps.
+		greyBlock(root)
+		return
+	}
 	var stack [markStackSize]gcBlock
 	stack[0] = root
 	root.setState(blockStateMark)
@@ -520,7 +854,8 @@ func startMark(root gcBlock) {
 			// This is a fast path for objects like make([]int, 4096).
 			continue
 		}
-		start, end := block.address(), block.findNext().address()
+		start := block.address()
+		end := start + uintptr(block.findNext()-block)*bytesPerBlock
 		if preciseHeap {
 			// The first word of the object is just the pointer layout value.
 			// Skip it.
@@ -580,6 +915,10 @@ func startMark(root gcBlock) {
 
 // finishMark finishes the marking process by processing all stack overflows.
 func finishMark() {
+	if gcIncremental {
+		gcMarkStep(^uintptr(0))
+		return
+	}
 	for stackOverflow {
 		// Re-mark all blocks.
 		stackOverflow = false
@@ -615,6 +954,110 @@ func markRoot(addr, root uintptr) {
 	}
 }
 
+// gcStartMark starts an incremental mark phase, by marking all objects that are
+// directly referenced from the roots. They are scanned in later mark steps.
+func gcStartMark() {
+	if gcDebug {
+		println("starting incremental mark phase...")
+	}
+	gcMarking = true
+	markStack()
+	markGlobals()
+}
+
+// greyBlock marks the object that starts at the given head block and queues it
+// to be scanned. The object may already be marked, in which case it will be
+// scanned again.
+func greyBlock(head gcBlock) {
+	if head.state() != blockStateMark {
+		head.setState(blockStateMark)
+	}
+	mask := interrupt.Disable()
+	if greyStackLen == uintptr(len(greyStack)) {
+		// The grey stack is full. All marked blocks will be rescanned once
+		// the grey stack is empty.
+		stackOverflow = true
+	} else {
+		greyStack[greyStackLen] = head
+		greyStackLen++
+	}
+	interrupt.Restore(mask)
+}
+
+// gcMarkStep scans grey objects until the given number of bytes has been
+// scanned, or until there is nothing left to scan. It returns true if there are
+// no grey objects left.
+func gcMarkStep(budget uintptr) bool {
+	for {
+		var block gcBlock
+		mask := interrupt.Disable()
+		if greyStackLen != 0 {
+			greyStackLen--
+			block = greyStack[greyStackLen]
+			interrupt.Restore(mask)
+		} else if gcRescanning {
+			interrupt.Restore(mask)
+			if gcRescanBlock == endBlock {
+				gcRescanning = false
+				continue
+			}
+			block = gcRescanBlock
+			gcRescanBlock++
+			if block.state() != blockStateMark {
+				continue
+			}
+		} else if stackOverflow {
+			// The grey stack overflowed, so some marked blocks were never
+			// scanned. Rescan all marked blocks.
+			stackOverflow = false
+			interrupt.Restore(mask)
+			gcRescanning = true
+			gcRescanBlock = 0
+			continue
+		} else {
+			interrupt.Restore(mask)
+			return true
+		}
+
+		scanned := scanBlock(block)
+		if scanned >= budget {
+			return false
+		}
+		budget -= scanned
+	}
+}
+
+// scanBlock scans the object that starts at the given head block, and greys all
+// unmarked objects it points to. It returns the size of the object in bytes.
+func scanBlock(block gcBlock) uintptr {
+	start := block.address()
+	end := start + uintptr(block.findNext()-block)*bytesPerBlock
+	scanner := newGCObjectScanner(block)
+	if scanner.pointerFree() {
+		return end - start
+	}
+	size := end - start
+	if preciseHeap {
+		// The first word of the object is just the pointer layout value.
+		start += align(unsafe.Sizeof(uintptr(0)))
+	}
+	for addr := start; addr != end; addr += unsafe.Alignof(addr) {
+		word := *(*uintptr)(unsafe.Pointer(addr))
+		if !scanner.nextIsPointer(word, block.address(), addr) {
+			continue
+		}
+		referencedBlock := blockFromAddr(word)
+		if referencedBlock.state() == blockStateFree {
+			continue
+		}
+		referencedBlock = referencedBlock.findHead()
+		if referencedBlock.state() != blockStateMark {
+			greyBlock(referencedBlock)
+		}
+	}
+	return size
+}
+
 // Sweep goes through all memory and frees unmarked memory.
 // It returns how many bytes are free in the heap after the sweep.
 func sweep() (freeBytes uintptr) {
@@ -690,6 +1133,12 @@ func ReadMemStats(m *MemStats) {
 	m.Mallocs = gcMallocs
 	m.Frees = gcFrees
 	m.Sys = uint64(heapEnd - heapStart)
+	m.NextGC = uint64(gcHeapGoal)
+	for i := 0; i < numHeapRegions; i++ {
+		r := &heapRegions[i]
+		m.GCSys += uint64(r.end - uintptr(r.metadataStart))
+		m.Sys += uint64(r.end - r.start)
+	}
 }
 
 func SetFinalizer(obj interface{}, finalizer interface{}) {
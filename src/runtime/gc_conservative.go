@@ -1,8 +1,9 @@
-//go:build gc.conservative
+//go:build gc.conservative || gc.incremental
 
 // This implements the block-based heap as a fully conservative GC. No tracking
 // of pointers is done, every word in an object is considered live if it looks
-// like a pointer.
+// like a pointer. The incremental GC (-gc=incremental) also uses this object
+// scanner.
 
 package runtime
 
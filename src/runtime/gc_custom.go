@@ -61,3 +61,14 @@ func ReadMemStats(ms *MemStats)
 func setHeapEnd(newHeapEnd uintptr) {
 	// Heap is in custom GC so ignore for when called from wasm initialization.
 }
+
+// gcSetHeapGoal is called when the GC pacing parameters (see
+// debug.SetGCPercent) change. They are currently not passed to a custom GC.
+func gcSetHeapGoal() {}
+
+// AddHeapRegion adds the memory in start..end to the heap and reports whether
+// it was added. Heap regions are not passed to a custom GC, so it always
+// returns false.
+func AddHeapRegion(start, end uintptr) bool {
+	return false
+}
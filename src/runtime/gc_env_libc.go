@@ -0,0 +1,25 @@
+//go:build darwin || windows || (linux && !baremetal && !nintendoswitch)
+
+package runtime
+
+import "unsafe"
+
+// char *getenv(const char *name);
+//
+//export getenv
+func libc_getenv(name *byte) *byte
+
+// gcGetenv returns the value of the given environment variable, or "" if it
+// isn't set. It doesn't allocate, so it can be used while initializing the
+// heap.
+func gcGetenv(name *byte) string {
+	value := libc_getenv(name)
+	if value == nil {
+		return ""
+	}
+	s := _string{
+		ptr:    value,
+		length: strlen(unsafe.Pointer(value)),
+	}
+	return *(*string)(unsafe.Pointer(&s))
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !windows && (!linux || baremetal || nintendoswitch)
+
+package runtime
+
+// gcGetenv returns the value of the given environment variable. This system
+// has no (real) environment variables, so it always returns "".
+func gcGetenv(name *byte) string {
+	return ""
+}
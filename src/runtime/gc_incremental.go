@@ -0,0 +1,62 @@
+//go:build gc.incremental
+
+package runtime
+
+// This file contains the parts of the incremental GC that are not shared with
+// the other block based GCs. See gc_blocks.go for a description of how it
+// works.
+
+import "unsafe"
+
+const gcIncremental = true
+
+// gcWriteBarrier is called by the compiler after storing a pointer to memory
+// that may be part of a heap object, and by the runtime after copying memory
+// that may contain pointers. If a mark phase is in progress and the object has
+// already been marked, it is scanned again to find the new pointer.
+func gcWriteBarrier(ptr unsafe.Pointer) {
+	if !gcMarking || !isOnHeap(uintptr(ptr)) {
+		return
+	}
+	block := blockFromAddr(uintptr(ptr))
+	if block.state() == blockStateFree {
+		return
+	}
+	head := block.findHead()
+	if head.state() == blockStateMark {
+		greyBlock(head)
+	}
+}
+
+// gcShade is called by the compiler before an atomic store of a pointer (and
+// for the pointer that is overwritten by an atomic swap or compare-and-swap).
+// If a mark phase is in progress, the object the pointer points to is marked
+// so that it can't be freed even if the object it is stored in was already
+// scanned.
+func gcShade(ptr unsafe.Pointer) {
+	if !gcMarking {
+		return
+	}
+	markRoot(0, uintptr(ptr))
+}
+
+// SetGCStepSize sets the maximum number of bytes the incremental garbage
+// collector scans while allocating memory, and returns the previous value.
+// Smaller values result in shorter pauses, but collection cycles will take
+// longer which may result in more memory being used. The last step of a
+// collection cycle (scanning the stacks and globals and freeing unreferenced
+// memory) can't be split and may take longer. The scan of a single object can't
+// be split either, so the pause is not bounded by the step size when the heap
+// contains large objects with pointers, like big arrays of pointers or slices:
+// such an object is always scanned at once.
+//
+// This function is specific to TinyGo and only has an effect with
+// -gc=incremental.
+func SetGCStepSize(bytes uintptr) uintptr {
+	old := gcStepSize
+	if bytes == 0 {
+		bytes = 1
+	}
+	gcStepSize = bytes
+	return old
+}
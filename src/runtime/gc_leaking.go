@@ -104,3 +104,13 @@ func setHeapEnd(newHeapEnd uintptr) {
 func markRoots(start, end uintptr) {
 	// dummy, so that markGlobals will compile
 }
+
+// gcSetHeapGoal is called when the GC pacing parameters change. There is no
+// collection cycle to pace with this GC.
+func gcSetHeapGoal() {}
+
+// AddHeapRegion adds the memory in start..end to the heap and reports whether
+// it was added. The leaking GC doesn't support heap regions, so it always returns false.
+func AddHeapRegion(start, end uintptr) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build !gc.incremental
+
+package runtime
+
+import "unsafe"
+
+const gcIncremental = false
+
+// gcWriteBarrier is only needed for the incremental GC.
+func gcWriteBarrier(ptr unsafe.Pointer) {
+}
+
+// gcShade is only needed for the incremental GC.
+func gcShade(ptr unsafe.Pointer) {
+}
+
+// SetGCStepSize sets the maximum number of bytes the incremental garbage
+// collector scans while allocating memory, and returns the previous value.
+//
+// This function is specific to TinyGo and only has an effect with
+// -gc=incremental.
+func SetGCStepSize(bytes uintptr) uintptr {
+	return 0
+}
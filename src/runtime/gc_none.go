@@ -41,3 +41,13 @@ func setHeapEnd(newHeapEnd uintptr) {
 func markRoots(start, end uintptr) {
 	// dummy, so that markGlobals will compile
 }
+
+func gcSetHeapGoal() {
+	// Nothing to pace.
+}
+
+// AddHeapRegion adds the memory in start..end to the heap and reports whether
+// it was added. Without a GC there is no heap, so it always returns false.
+func AddHeapRegion(start, end uintptr) bool {
+	return false
+}
@@ -0,0 +1,120 @@
+package runtime
+
+// GC pacing parameters, as set by debug.SetGCPercent and debug.SetMemoryLimit
+// or by the GOGC and GOMEMLIMIT environment variables. Only the block based
+// GCs (conservative, precise, incremental) use them, see gcSetHeapGoal.
+
+const maxInt64 = 1<<63 - 1
+
+var (
+	gcPercent     int32 = 100      // GOGC: how much the live heap may grow before the next cycle (-1 means off)
+	gcMemoryLimit int64 = maxInt64 // GOMEMLIMIT: soft limit on the heap size in bytes
+)
+
+//go:linkname debug_setGCPercent runtime/debug.setGCPercent
+func debug_setGCPercent(percent int32) int32 {
+	old := gcPercent
+	if percent < 0 {
+		percent = -1
+	}
+	gcPercent = percent
+	gcSetHeapGoal()
+	return old
+}
+
+//go:linkname debug_setMemoryLimit runtime/debug.setMemoryLimit
+func debug_setMemoryLimit(limit int64) int64 {
+	old := gcMemoryLimit
+	if limit >= 0 {
+		// A negative limit only queries the current limit.
+		gcMemoryLimit = limit
+		gcSetHeapGoal()
+	}
+	return old
+}
+
+//go:linkname debug_freeOSMemory runtime/debug.freeOSMemory
+func debug_freeOSMemory() {
+	// Memory is never returned to the OS, so the best we can do is to make as
+	// much memory as possible available for future allocations.
+	GC()
+}
+
+// gcReadEnv reads the GOGC and GOMEMLIMIT environment variables, on systems
+// that have environment variables. Invalid values are ignored.
+func gcReadEnv() {
+	gogc := [...]byte{'G', 'O', 'G', 'C', 0}
+	if s := gcGetenv(&gogc[0]); s != "" {
+		if percent, ok := parseGOGC(s); ok {
+			gcPercent = percent
+		}
+	}
+	gomemlimit := [...]byte{'G', 'O', 'M', 'E', 'M', 'L', 'I', 'M', 'I', 'T', 0}
+	if s := gcGetenv(&gomemlimit[0]); s != "" {
+		if limit, ok := parseGOMEMLIMIT(s); ok {
+			gcMemoryLimit = limit
+		}
+	}
+}
+
+// parseGOGC parses the value of the GOGC environment variable: either "off" or
+// a non-negative percentage.
+func parseGOGC(s string) (int32, bool) {
+	if s == "off" {
+		return -1, true
+	}
+	n, rest, ok := parseUint(s)
+	if !ok || rest != "" || n > 1<<31-1 {
+		return 0, false
+	}
+	return int32(n), true
+}
+
+// parseGOMEMLIMIT parses the value of the GOMEMLIMIT environment variable:
+// either "off" or a number of bytes with an optional unit suffix (B, KiB, MiB,
+// GiB or TiB), like "512MiB".
+func parseGOMEMLIMIT(s string) (int64, bool) {
+	if s == "off" {
+		return maxInt64, true
+	}
+	n, unit, ok := parseUint(s)
+	if !ok {
+		return 0, false
+	}
+	var shift uint
+	switch unit {
+	case "", "B":
+		shift = 0
+	case "KiB":
+		shift = 10
+	case "MiB":
+		shift = 20
+	case "GiB":
+		shift = 30
+	case "TiB":
+		shift = 40
+	default:
+		return 0, false
+	}
+	if n > maxInt64>>shift {
+		return 0, false
+	}
+	return int64(n << shift), true
+}
+
+// parseUint parses the decimal number at the start of s and returns it together
+// with the rest of the string. It fails if s doesn't start with a digit or the
+// number doesn't fit in an int64.
+func parseUint(s string) (n uint64, rest string, ok bool) {
+	i := 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		if n > maxInt64/10 {
+			return 0, "", false
+		}
+		n = n*10 + uint64(s[i]-'0')
+		if n > maxInt64 {
+			return 0, "", false
+		}
+	}
+	return n, s[i:], i != 0
+}
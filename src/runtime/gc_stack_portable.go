@@ -1,4 +1,4 @@
-//go:build (gc.conservative || gc.custom || gc.precise) && tinygo.wasm
+//go:build (gc.conservative || gc.custom || gc.precise || gc.incremental) && tinygo.wasm
 
 package runtime
 
@@ -47,6 +47,10 @@ func markStack() {
 
 	if task.OnSystemStack() {
 		markRoots(getCurrentStackPointer(), stackTop)
+	} else if gcIncremental {
+		// The incremental GC may have scanned the current goroutine stack
+		// before, so make sure it gets scanned again.
+		gcWriteBarrier(unsafe.Pointer(getCurrentStackPointer()))
 	}
 }
 
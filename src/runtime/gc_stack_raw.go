@@ -1,8 +1,11 @@
-//go:build (gc.conservative || gc.precise) && !tinygo.wasm
+//go:build (gc.conservative || gc.precise || gc.incremental) && !tinygo.wasm
 
 package runtime
 
-import "internal/task"
+import (
+	"internal/task"
+	"unsafe"
+)
 
 // markStack marks all root pointers found on the stack.
 //
@@ -35,5 +38,10 @@ func scanstack(sp uintptr) {
 		// This is a goroutine stack.
 		// It is an allocation, so scan it as if it were a value in a global.
 		markRoot(0, sp)
+		if gcIncremental {
+			// The stack may have been scanned before in this mark phase, so
+			// scan it again.
+			gcWriteBarrier(unsafe.Pointer(sp))
+		}
 	}
 }
@@ -1,9 +1,25 @@
 package runtime
 
 // This is a hashmap implementation for the map[T]T type.
-// It is very roughly based on the implementation of the Go hashmap:
 //
-//     https://golang.org/src/runtime/map.go
+// It is an open addressing hash table, loosely based on the design of Swiss
+// tables (https://abseil.io/about/design/swisstables):
+//
+//   - All entries are stored in a single allocation (the table): first a
+//     control byte for every slot, then all keys, then all values. Keeping the
+//     keys and values apart means there is no padding between them.
+//   - A control byte indicates whether a slot is empty, deleted (a tombstone),
+//     or in use. For slots that are in use, it also contains the lowest 7 bits
+//     of the hash of the key. That way, almost all slots with a different key
+//     can be skipped during a lookup without comparing keys.
+//   - Slots are divided in groups of 8. The upper bits of the hash select the
+//     group where a lookup starts, after which the following groups are
+//     visited using triangular probing. A lookup stops at the first group that
+//     has an empty slot.
+//   - The table is rehashed when 7/8 of all slots are in use or deleted.
+//
+// A map that is created without a size hint doesn't allocate a table until the
+// first entry is stored.
 
 import (
 	"reflect"
@@ -12,12 +28,13 @@ import (
 
 // The underlying hashmap structure for Go.
 type hashmap struct {
-	buckets    unsafe.Pointer // pointer to array of buckets
+	table      unsafe.Pointer // control bytes, keys, and values (nil if nothing was stored yet)
 	seed       uintptr
-	count      uintptr
+	count      uintptr // number of entries in the map
+	growthLeft uintptr // number of empty slots that can be used before the table must be rehashed
 	keySize    uintptr // maybe this can store the key type as well? E.g. keysize == 5 means string?
 	valueSize  uintptr
-	bucketBits uint8
+	sizeBits   uint8 // the table has 1<<sizeBits slots
 	keyEqual   func(x, y unsafe.Pointer, n uintptr) bool
 	keyHash    func(key unsafe.Pointer, size, seed uintptr) uint32
 }
@@ -30,61 +47,47 @@ const (
 	hashmapAlgorithmInterface
 )
 
-// A hashmap bucket. A bucket is a container of 8 key/value pairs: first the
-// following two entries, then the 8 keys, then the 8 values. This somewhat odd
-// ordering is to make sure the keys and values are well aligned when one of
-// them is smaller than the system word size.
-type hashmapBucket struct {
-	tophash [8]uint8
-	next    *hashmapBucket // next bucket (if there are more than 8 in a chain)
-	// Followed by the actual keys, and then the actual values. These are
-	// allocated but as they're of variable size they can't be shown here.
-}
+const (
+	hashmapGroupSize    = 8 // number of slots in a group, also the minimum table size
+	hashmapMinSizeBits  = 3 // log2 of hashmapGroupSize
+	hashmapCtrlEmpty    = 0x00
+	hashmapCtrlDeleted  = 0x01
+	hashmapCtrlFull     = 0x80 // set for slots that are in use, the other bits are part of the hash
+	hashmapCtrlHashMask = 0x7f
+)
 
 type hashmapIterator struct {
-	buckets      unsafe.Pointer // pointer to array of hashapBuckets
-	numBuckets   uintptr        // length of buckets array
-	bucketNumber uintptr        // current index into buckets array
-	bucket       *hashmapBucket // current bucket in chain
-	bucketIndex  uint8          // current index into bucket
+	table    unsafe.Pointer // table that is being iterated over
+	numSlots uintptr        // number of slots in table
+	index    uintptr        // next slot to look at
 }
 
 func hashmapNewIterator() unsafe.Pointer {
 	return unsafe.Pointer(new(hashmapIterator))
 }
 
-// Get the topmost 8 bits of the hash, without using a special value (like 0).
-func hashmapTopHash(hash uint32) uint8 {
-	tophash := uint8(hash >> 24)
-	if tophash < 1 {
-		// 0 means empty slot, so make it bigger.
-		tophash += 1
-	}
-	return tophash
-}
-
 // Create a new hashmap with the given keySize and valueSize.
 func hashmapMake(keySize, valueSize uintptr, sizeHint uintptr, alg uint8) *hashmap {
-	bucketBits := uint8(0)
-	for hashmapHasSpaceToGrow(bucketBits) && hashmapOverLoadFactor(sizeHint, bucketBits) {
-		bucketBits++
+	sizeBits := uint8(hashmapMinSizeBits)
+	for hashmapHasSpaceToGrow(sizeBits) && sizeHint > hashmapMaxEntries(sizeBits) {
+		sizeBits++
 	}
 
-	bucketBufSize := unsafe.Sizeof(hashmapBucket{}) + keySize*8 + valueSize*8
-	buckets := alloc(bucketBufSize*(1<<bucketBits), nil)
-
 	keyHash := hashmapKeyHashAlg(hashmapAlgorithm(alg))
 	keyEqual := hashmapKeyEqualAlg(hashmapAlgorithm(alg))
 
-	return &hashmap{
-		buckets:    buckets,
-		seed:       uintptr(fastrand()),
-		keySize:    keySize,
-		valueSize:  valueSize,
-		bucketBits: bucketBits,
-		keyEqual:   keyEqual,
-		keyHash:    keyHash,
+	m := &hashmap{
+		seed:      uintptr(fastrand()),
+		keySize:   keySize,
+		valueSize: valueSize,
+		sizeBits:  sizeBits,
+		keyEqual:  keyEqual,
+		keyHash:   keyHash,
 	}
+	if sizeHint != 0 {
+		hashmapAllocTable(m)
+	}
+	return m
 }
 
 func hashmapMakeUnsafePointer(keySize, valueSize uintptr, sizeHint uintptr, alg uint8) unsafe.Pointer {
@@ -119,23 +122,18 @@ func hashmapKeyHashAlg(alg hashmapAlgorithm) func(key unsafe.Pointer, n, seed ui
 	}
 }
 
-func hashmapHasSpaceToGrow(bucketBits uint8) bool {
+func hashmapHasSpaceToGrow(sizeBits uint8) bool {
 	// Over this limit, we're likely to overflow uintptrs during calculations
-	// or numbers of hash elements.   Don't allow any more growth.
-	// With 29 bits, this is 2^32 elements anyway.
-	return bucketBits <= uint8((unsafe.Sizeof(uintptr(0))*8)-3)
+	// or numbers of hash elements. Don't allow any more growth.
+	return sizeBits <= uint8((unsafe.Sizeof(uintptr(0))*8)-4)
 }
 
-func hashmapOverLoadFactor(n uintptr, bucketBits uint8) bool {
-	// "maximum" number of elements is 0.75 * buckets * elements per bucket
-	// to avoid overflow, this is calculated as
-	// max = 3 * (1/4 * buckets * elements per bucket)
-	//     = 3 * (buckets * (elements per bucket)/4)
-	//     = 3 * (buckets * (8/4)
-	//     = 3 * (buckets * 2)
-	//     = 6 * buckets
-	max := (uintptr(6) << bucketBits)
-	return n > max
+// hashmapMaxEntries returns the number of slots that may be in use (or deleted)
+// in a table with 1<<sizeBits slots: 7/8 of all slots. This guarantees that
+// there is always an empty slot, which terminates a lookup.
+func hashmapMaxEntries(sizeBits uint8) uintptr {
+	numSlots := uintptr(1) << sizeBits
+	return numSlots - numSlots/8
 }
 
 // Return the number of entries in this hashmap, called from the len builtin.
@@ -153,144 +151,165 @@ func hashmapLenUnsafePointer(m unsafe.Pointer) int {
 	return hashmapLen((*hashmap)(m))
 }
 
-//go:inline
-func hashmapBucketSize(m *hashmap) uintptr {
-	return unsafe.Sizeof(hashmapBucket{}) + uintptr(m.keySize)*8 + uintptr(m.valueSize)*8
+// hashmapAllocTable allocates a new empty table for the map, with 1<<m.sizeBits
+// slots. The old table (if any) is not modified.
+func hashmapAllocTable(m *hashmap) {
+	numSlots := uintptr(1) << m.sizeBits
+	m.table = alloc(numSlots*(1+m.keySize+m.valueSize), nil)
+	m.growthLeft = hashmapMaxEntries(m.sizeBits)
+	m.count = 0
 }
 
+// The control byte for the given slot. Control bytes are stored at the start of
+// the table.
+//
 //go:inline
-func hashmapBucketAddr(m *hashmap, buckets unsafe.Pointer, n uintptr) *hashmapBucket {
-	bucketSize := hashmapBucketSize(m)
-	bucket := (*hashmapBucket)(unsafe.Add(buckets, bucketSize*n))
-	return bucket
+func hashmapSlotCtrl(table unsafe.Pointer, slot uintptr) *uint8 {
+	return (*uint8)(unsafe.Add(table, slot))
 }
 
+// The key for the given slot. Keys are stored after the control bytes. The
+// number of slots is a multiple of 8 so keys are aligned.
+//
 //go:inline
-func hashmapBucketAddrForHash(m *hashmap, hash uint32) *hashmapBucket {
-	numBuckets := uintptr(1) << m.bucketBits
-	bucketNumber := (uintptr(hash) & (numBuckets - 1))
-	return hashmapBucketAddr(m, m.buckets, bucketNumber)
+func hashmapSlotKey(m *hashmap, table unsafe.Pointer, numSlots, slot uintptr) unsafe.Pointer {
+	return unsafe.Add(table, numSlots+m.keySize*slot)
 }
 
+// The value for the given slot. Values are stored after the keys.
+//
 //go:inline
-func hashmapSlotKey(m *hashmap, bucket *hashmapBucket, slot uint8) unsafe.Pointer {
-	slotKeyOffset := unsafe.Sizeof(hashmapBucket{}) + uintptr(m.keySize)*uintptr(slot)
-	slotKey := unsafe.Add(unsafe.Pointer(bucket), slotKeyOffset)
-	return slotKey
+func hashmapSlotValue(m *hashmap, table unsafe.Pointer, numSlots, slot uintptr) unsafe.Pointer {
+	return unsafe.Add(table, numSlots*(1+m.keySize)+m.valueSize*slot)
+}
+
+// hashmapFindSlot looks for the slot that contains the given key. If the key is
+// not in the map, it returns the first slot where the key can be inserted
+// instead. The map must have a table.
+//
+//go:nobounds
+func hashmapFindSlot(m *hashmap, key unsafe.Pointer, hash uint32) (slot uintptr, found bool) {
+	numSlots := uintptr(1) << m.sizeBits
+	groupMask := numSlots/hashmapGroupSize - 1
+	ctrl := uint8(hash&hashmapCtrlHashMask) | hashmapCtrlFull
+	group := uintptr(hash>>7) & groupMask
+	insertSlot := numSlots // invalid slot: no free slot found yet
+	for probe := uintptr(1); ; probe++ {
+		// Look at all 8 control bytes of the group at once, to quickly skip
+		// groups that don't contain the key.
+		groupCtrl := *(*uint64)(unsafe.Add(m.table, group*hashmapGroupSize))
+		if hashmapGroupHasByte(groupCtrl, ctrl) {
+			for slot := group * hashmapGroupSize; slot < (group+1)*hashmapGroupSize; slot++ {
+				if *hashmapSlotCtrl(m.table, slot) == ctrl && m.keyEqual(key, hashmapSlotKey(m, m.table, numSlots, slot), m.keySize) {
+					return slot, true
+				}
+			}
+		}
+		if insertSlot == numSlots && groupCtrl&0x8080808080808080 != 0x8080808080808080 {
+			// There is an empty or deleted slot in this group: the key can be
+			// inserted here if it doesn't exist.
+			for slot := group * hashmapGroupSize; ; slot++ {
+				if *hashmapSlotCtrl(m.table, slot)&hashmapCtrlFull == 0 {
+					insertSlot = slot
+					break
+				}
+			}
+		}
+		if hashmapGroupHasByte(groupCtrl, hashmapCtrlEmpty) {
+			// The key would have been stored in this group if it existed.
+			return insertSlot, false
+		}
+		// Triangular probing: this visits every group exactly once when the
+		// number of groups is a power of two.
+		group = (group + probe) & groupMask
+	}
 }
 
+// hashmapGroupHasByte returns whether any of the 8 control bytes in groupCtrl
+// equals b.
+//
 //go:inline
-func hashmapSlotValue(m *hashmap, bucket *hashmapBucket, slot uint8) unsafe.Pointer {
-	slotValueOffset := unsafe.Sizeof(hashmapBucket{}) + uintptr(m.keySize)*8 + uintptr(m.valueSize)*uintptr(slot)
-	slotValue := unsafe.Add(unsafe.Pointer(bucket), slotValueOffset)
-	return slotValue
+func hashmapGroupHasByte(groupCtrl uint64, b uint8) bool {
+	x := groupCtrl ^ (0x0101010101010101 * uint64(b))
+	return (x-0x0101010101010101)&^x&0x8080808080808080 != 0
 }
 
 // Set a specified key to a given value. Grow the map if necessary.
 //
 //go:nobounds
 func hashmapSet(m *hashmap, key unsafe.Pointer, value unsafe.Pointer, hash uint32) {
-	if hashmapHasSpaceToGrow(m.bucketBits) && hashmapOverLoadFactor(m.count, m.bucketBits) {
-		hashmapGrow(m)
-		// seed changed when we grew; rehash key with new seed
-		hash = m.keyHash(key, m.keySize, m.seed)
-	}
-
-	tophash := hashmapTopHash(hash)
-	bucket := hashmapBucketAddrForHash(m, hash)
-	var lastBucket *hashmapBucket
-
-	// See whether the key already exists somewhere.
-	var emptySlotKey unsafe.Pointer
-	var emptySlotValue unsafe.Pointer
-	var emptySlotTophash *byte
-	for bucket != nil {
-		for i := uint8(0); i < 8; i++ {
-			slotKey := hashmapSlotKey(m, bucket, i)
-			slotValue := hashmapSlotValue(m, bucket, i)
-			if bucket.tophash[i] == 0 && emptySlotKey == nil {
-				// Found an empty slot, store it for if we couldn't find an
-				// existing slot.
-				emptySlotKey = slotKey
-				emptySlotValue = slotValue
-				emptySlotTophash = &bucket.tophash[i]
-			}
-			if bucket.tophash[i] == tophash {
-				// Could be an existing key that's the same.
-				if m.keyEqual(key, slotKey, m.keySize) {
-					// found same key, replace it
-					memcpy(slotValue, value, m.valueSize)
-					return
-				}
-			}
-		}
-		lastBucket = bucket
-		bucket = bucket.next
+	if m.table == nil {
+		hashmapAllocTable(m)
 	}
-	if emptySlotKey == nil {
-		// Add a new bucket to the bucket chain.
-		// TODO: rebalance if necessary to avoid O(n) insert and lookup time.
-		lastBucket.next = (*hashmapBucket)(hashmapInsertIntoNewBucket(m, key, value, tophash))
+
+	slot, found := hashmapFindSlot(m, key, hash)
+	numSlots := uintptr(1) << m.sizeBits
+	if found {
+		// found same key, replace the value
+		memcpy(hashmapSlotValue(m, m.table, numSlots, slot), value, m.valueSize)
+		gcWriteBarrier(m.table)
 		return
 	}
+
+	if *hashmapSlotCtrl(m.table, slot) == hashmapCtrlEmpty {
+		if m.growthLeft == 0 {
+			// The table is full, rehash it to make space and look for a
+			// free slot again.
+			hashmapGrow(m)
+			slot, _ = hashmapFindSlot(m, key, hash)
+			numSlots = uintptr(1) << m.sizeBits
+		}
+		if *hashmapSlotCtrl(m.table, slot) == hashmapCtrlEmpty {
+			m.growthLeft--
+		}
+	}
+
 	m.count++
-	memcpy(emptySlotKey, key, m.keySize)
-	memcpy(emptySlotValue, value, m.valueSize)
-	*emptySlotTophash = tophash
+	*hashmapSlotCtrl(m.table, slot) = uint8(hash&hashmapCtrlHashMask) | hashmapCtrlFull
+	memcpy(hashmapSlotKey(m, m.table, numSlots, slot), key, m.keySize)
+	memcpy(hashmapSlotValue(m, m.table, numSlots, slot), value, m.valueSize)
+	gcWriteBarrier(m.table)
 }
 
 func hashmapSetUnsafePointer(m unsafe.Pointer, key unsafe.Pointer, value unsafe.Pointer, hash uint32) {
 	hashmapSet((*hashmap)(m), key, value, hash)
 }
 
-// hashmapInsertIntoNewBucket creates a new bucket, inserts the given key and
-// value into the bucket, and returns a pointer to this bucket.
-func hashmapInsertIntoNewBucket(m *hashmap, key, value unsafe.Pointer, tophash uint8) *hashmapBucket {
-	bucketBufSize := hashmapBucketSize(m)
-	bucketBuf := alloc(bucketBufSize, nil)
-	bucket := (*hashmapBucket)(bucketBuf)
-
-	// Insert into the first slot, which is empty as it has just been allocated.
-	slotKey := hashmapSlotKey(m, bucket, 0)
-	slotValue := hashmapSlotValue(m, bucket, 0)
-	m.count++
-	memcpy(slotKey, key, m.keySize)
-	memcpy(slotValue, value, m.valueSize)
-	bucket.tophash[0] = tophash
-	return bucket
-}
-
+// hashmapGrow moves all entries to a new table. The new table is twice as big,
+// unless most of the used slots of the old table are tombstones: in that case
+// the new table has the same size.
+//
+//go:nobounds
 func hashmapGrow(m *hashmap) {
-	// clone map as empty
-	n := *m
-	n.count = 0
-	n.seed = uintptr(fastrand())
-
-	// allocate our new buckets twice as big
-	n.bucketBits = m.bucketBits + 1
-	numBuckets := uintptr(1) << n.bucketBits
-	bucketBufSize := hashmapBucketSize(m)
-	n.buckets = alloc(bucketBufSize*numBuckets, nil)
-
-	// use a hashmap iterator to go through the old map
-	var it hashmapIterator
-
-	var key = alloc(m.keySize, nil)
-	var value = alloc(m.valueSize, nil)
-
-	for hashmapNext(m, &it, key, value) {
-		h := n.keyHash(key, uintptr(n.keySize), n.seed)
-		hashmapSet(&n, key, value, h)
+	oldTable := m.table
+	oldNumSlots := uintptr(1) << m.sizeBits
+	if m.count >= hashmapMaxEntries(m.sizeBits)/2 && hashmapHasSpaceToGrow(m.sizeBits) {
+		m.sizeBits++
 	}
+	hashmapAllocTable(m)
+	numSlots := uintptr(1) << m.sizeBits
 
-	*m = n
+	for oldSlot := uintptr(0); oldSlot < oldNumSlots; oldSlot++ {
+		if *hashmapSlotCtrl(oldTable, oldSlot)&hashmapCtrlFull == 0 {
+			continue
+		}
+		key := hashmapSlotKey(m, oldTable, oldNumSlots, oldSlot)
+		hash := m.keyHash(key, m.keySize, m.seed)
+		slot, _ := hashmapFindSlot(m, key, hash)
+		*hashmapSlotCtrl(m.table, slot) = uint8(hash&hashmapCtrlHashMask) | hashmapCtrlFull
+		memcpy(hashmapSlotKey(m, m.table, numSlots, slot), key, m.keySize)
+		memcpy(hashmapSlotValue(m, m.table, numSlots, slot), hashmapSlotValue(m, oldTable, oldNumSlots, oldSlot), m.valueSize)
+		m.count++
+		m.growthLeft--
+	}
+	gcWriteBarrier(m.table)
 }
 
 // Get the value of a specified key, or zero the value if not found.
 //
 //go:nobounds
 func hashmapGet(m *hashmap, key, value unsafe.Pointer, valueSize uintptr, hash uint32) bool {
-	if m == nil {
+	if m == nil || m.table == nil {
 		// Getting a value out of a nil map is valid. From the spec:
 		// > if the map is nil or does not contain such an entry, a[x] is the
 		// > zero value for the element type of M
@@ -298,29 +317,18 @@ func hashmapGet(m *hashmap, key, value unsafe.Pointer, valueSize uintptr, hash u
 		return false
 	}
 
-	tophash := hashmapTopHash(hash)
-	bucket := hashmapBucketAddrForHash(m, hash)
-
-	// Try to find the key.
-	for bucket != nil {
-		for i := uint8(0); i < 8; i++ {
-			slotKey := hashmapSlotKey(m, bucket, i)
-			slotValue := hashmapSlotValue(m, bucket, i)
-			if bucket.tophash[i] == tophash {
-				// This could be the key we're looking for.
-				if m.keyEqual(key, slotKey, m.keySize) {
-					// Found the key, copy it.
-					memcpy(value, slotValue, m.valueSize)
-					return true
-				}
-			}
-		}
-		bucket = bucket.next
+	slot, found := hashmapFindSlot(m, key, hash)
+	if !found {
+		// Did not find the key.
+		memzero(value, m.valueSize)
+		return false
 	}
 
-	// Did not find the key.
-	memzero(value, m.valueSize)
-	return false
+	// Found the key, copy the value.
+	numSlots := uintptr(1) << m.sizeBits
+	memcpy(value, hashmapSlotValue(m, m.table, numSlots, slot), m.valueSize)
+	gcWriteBarrier(value)
+	return true
 }
 
 func hashmapGetUnsafePointer(m unsafe.Pointer, key, value unsafe.Pointer, valueSize uintptr, hash uint32) bool {
@@ -332,36 +340,37 @@ func hashmapGetUnsafePointer(m unsafe.Pointer, key, value unsafe.Pointer, valueS
 //
 //go:nobounds
 func hashmapDelete(m *hashmap, key unsafe.Pointer, hash uint32) {
-	if m == nil {
+	if m == nil || m.table == nil {
 		// The delete builtin is defined even when the map is nil. From the spec:
 		// > If the map m is nil or the element m[k] does not exist, delete is a
 		// > no-op.
 		return
 	}
 
-	tophash := hashmapTopHash(hash)
-	bucket := hashmapBucketAddrForHash(m, hash)
-
-	// Try to find the key.
-	for bucket != nil {
-		for i := uint8(0); i < 8; i++ {
-			slotKey := hashmapSlotKey(m, bucket, i)
-			if bucket.tophash[i] == tophash {
-				// This could be the key we're looking for.
-				if m.keyEqual(key, slotKey, m.keySize) {
-					// Found the key, delete it.
-					bucket.tophash[i] = 0
-					// Zero out the key and value so garbage collector doesn't pin the allocations.
-					memzero(slotKey, m.keySize)
-					slotValue := hashmapSlotValue(m, bucket, i)
-					memzero(slotValue, m.valueSize)
-					m.count--
-					return
-				}
-			}
+	slot, found := hashmapFindSlot(m, key, hash)
+	if !found {
+		return
+	}
+
+	// If there is an empty slot in the same group, no lookup ever continued
+	// past this group so the slot can be marked as empty. Otherwise it must be
+	// marked as deleted, so that lookups for keys in later groups continue.
+	ctrl := uint8(hashmapCtrlDeleted)
+	group := slot &^ (hashmapGroupSize - 1)
+	for i := group; i < group+hashmapGroupSize; i++ {
+		if *hashmapSlotCtrl(m.table, i) == hashmapCtrlEmpty {
+			ctrl = hashmapCtrlEmpty
+			m.growthLeft++
+			break
 		}
-		bucket = bucket.next
 	}
+	*hashmapSlotCtrl(m.table, slot) = ctrl
+
+	// Zero out the key and value so garbage collector doesn't pin the allocations.
+	numSlots := uintptr(1) << m.sizeBits
+	memzero(hashmapSlotKey(m, m.table, numSlots, slot), m.keySize)
+	memzero(hashmapSlotValue(m, m.table, numSlots, slot), m.valueSize)
+	m.count--
 }
 
 // Iterate over a hashmap.
@@ -373,58 +382,48 @@ func hashmapNext(m *hashmap, it *hashmapIterator, key, value unsafe.Pointer) boo
 		return false
 	}
 
-	if it.buckets == nil {
+	if it.table == nil {
+		if m.table == nil {
+			// Nothing has been stored in the map yet.
+			return false
+		}
 		// initialize iterator
-		it.buckets = m.buckets
-		it.numBuckets = uintptr(1) << m.bucketBits
+		it.table = m.table
+		it.numSlots = uintptr(1) << m.sizeBits
 	}
 
-	for {
-		if it.bucketIndex >= 8 {
-			// end of bucket, move to the next in the chain
-			it.bucketIndex = 0
-			it.bucket = it.bucket.next
-		}
-		if it.bucket == nil {
-			if it.bucketNumber >= it.numBuckets {
-				// went through all buckets
-				return false
-			}
-			it.bucket = hashmapBucketAddr(m, it.buckets, it.bucketNumber)
-			it.bucketNumber++ // next bucket
-		}
-		if it.bucket.tophash[it.bucketIndex] == 0 {
-			// slot is empty - move on
-			it.bucketIndex++
+	for it.index < it.numSlots {
+		slot := it.index
+		it.index++
+		if *hashmapSlotCtrl(it.table, slot)&hashmapCtrlFull == 0 {
+			// slot is empty or deleted - move on
 			continue
 		}
 
-		slotKey := hashmapSlotKey(m, it.bucket, it.bucketIndex)
-		memcpy(key, slotKey, m.keySize)
+		memcpy(key, hashmapSlotKey(m, it.table, it.numSlots, slot), m.keySize)
+		gcWriteBarrier(key)
 
-		if it.buckets == m.buckets {
-			// Our view of the buckets is the same as the parent map.
-			// Just copy the value we have
-			slotValue := hashmapSlotValue(m, it.bucket, it.bucketIndex)
-			memcpy(value, slotValue, m.valueSize)
-			it.bucketIndex++
+		if it.table == m.table {
+			// Our view of the table is the same as the parent map.
+			// Just copy the value we have.
+			memcpy(value, hashmapSlotValue(m, it.table, it.numSlots, slot), m.valueSize)
+			gcWriteBarrier(value)
 		} else {
-			it.bucketIndex++
-
-			// Our view of the buckets doesn't match the parent map.
-			// Look up the key in the new buckets and return that value if it exists
+			// The map was rehashed while iterating. The old table isn't
+			// modified anymore, so look up the key in the new table and return
+			// that value if it still exists.
 			hash := m.keyHash(key, m.keySize, m.seed)
-			ok := hashmapGet(m, key, value, m.valueSize, hash)
-			if !ok {
+			if !hashmapGet(m, key, value, m.valueSize, hash) {
 				// doesn't exist in parent map; try next key
 				continue
 			}
-
-			// All good.
 		}
 
 		return true
 	}
+
+	// went through all slots
+	return false
 }
 
 func hashmapNextUnsafePointer(m unsafe.Pointer, it unsafe.Pointer, key, value unsafe.Pointer) bool {
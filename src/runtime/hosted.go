@@ -3,3 +3,7 @@
 package runtime
 
 const baremetal = false
+
+// There are no additional heap regions on hosted systems: the heap is grown
+// using the OS instead.
+var heapRegionsStart, heapRegionsEnd uintptr
@@ -0,0 +1,39 @@
+package runtime
+
+// The idle hook is called whenever the scheduler has nothing to run, just
+// before it goes to sleep. Sleeps are limited to idleHookInterval, so that the
+// hook is also called regularly while all goroutines are sleeping or blocked.
+// It is also called when a goroutine yields while no other goroutine is ready
+// to run (a wait that polls with Gosched), and while Cond.Wait polls without a
+// scheduler.
+//
+// It is used by the machine package to update the watchdog timer: as long as
+// the scheduler regularly becomes idle no goroutine is stuck in a loop, and a
+// goroutine that never yields will eventually reset the chip.
+var (
+	idleHook         func()
+	idleHookInterval timeUnit
+)
+
+// setIdleHook sets (or with a nil hook, removes) the idle hook. The interval
+// is in nanoseconds.
+func setIdleHook(hook func(), interval int64) {
+	idleHookInterval = nanosecondsToTicks(interval)
+	if idleHookInterval <= 0 {
+		idleHookInterval = 1
+	}
+	idleHook = hook
+}
+
+// runIdleHook calls the idle hook, if there is one, and returns the time the
+// caller may sleep before calling it again.
+func runIdleHook(timeLeft timeUnit) timeUnit {
+	if idleHook == nil {
+		return timeLeft
+	}
+	idleHook()
+	if timeLeft > idleHookInterval {
+		timeLeft = idleHookInterval
+	}
+	return timeLeft
+}
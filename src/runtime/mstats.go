@@ -57,4 +57,12 @@ type MemStats struct {
 
 	// GCSys is bytes of memory in garbage collection metadata.
 	GCSys uint64
+
+	// Garbage collector statistics.
+
+	// NextGC is the target heap size of the next GC cycle.
+	//
+	// The garbage collector's goal is to keep HeapInuse ≤ NextGC.
+	// See debug.SetGCPercent and debug.SetMemoryLimit.
+	NextGC uint64
 }
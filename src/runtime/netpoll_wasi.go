@@ -0,0 +1,142 @@
+//go:build tinygo.wasm && wasi
+
+package runtime
+
+// Waiting for sockets on WASI, for the net package. A goroutine that finds a
+// non-blocking socket not ready calls netpollWait, which parks it until
+// poll_oneoff reports the socket as ready. The scheduler calls poll_oneoff when
+// it has nothing else to do, with the sockets that goroutines wait for and the
+// time until the next goroutine or timer needs to run. Without a scheduler,
+// netpollWait calls poll_oneoff itself.
+
+import "internal/task"
+
+// netpollWaiter is a goroutine waiting for a socket.
+type netpollWaiter struct {
+	fd          int32
+	write       bool
+	ready       bool
+	hasDeadline bool
+	deadline    timeUnit
+	task        *task.Task // nil without a scheduler
+}
+
+var (
+	netpollWaiters       []*netpollWaiter
+	netpollSubscriptions []__wasi_subscription_t
+	netpollEvents        []__wasi_event_t
+)
+
+// netpollTimeoutUserData marks the clock subscription of a netpoll call.
+const netpollTimeoutUserData = ^uint64(0)
+
+// netpollWait waits until the socket can be read (or written, if write is set)
+// without blocking, or until timeout nanoseconds have passed. A negative timeout
+// means no timeout. It returns whether the socket is ready, which may also mean
+// that using it returns an error.
+//
+//go:linkname netpollWait net.pollWait
+func netpollWait(fd int, write bool, timeout int64) bool {
+	w := &netpollWaiter{fd: int32(fd), write: write}
+	if timeout >= 0 {
+		w.hasDeadline = true
+		w.deadline = ticks() + nanosecondsToTicks(timeout)
+	}
+	netpollWaiters = append(netpollWaiters, w)
+	if !hasScheduler {
+		for netpollWaiting(w) {
+			netpoll(-1)
+		}
+		return w.ready
+	}
+	w.task = task.Current()
+	task.Pause()
+	return w.ready
+}
+
+// netpollWaiting returns whether w is still waiting for its socket.
+func netpollWaiting(w *netpollWaiter) bool {
+	for _, other := range netpollWaiters {
+		if other == w {
+			return true
+		}
+	}
+	return false
+}
+
+// netpoll waits until a socket in netpollWaiters is ready, the deadline of a
+// waiter has passed or d ticks have passed, whichever comes first. A negative d
+// means there is no limit other than the deadlines of the waiters. Waiters that
+// are done are removed from netpollWaiters and their goroutines are added to
+// the runqueue.
+func netpoll(d timeUnit) {
+	now := ticks()
+	timeout := d
+	subscriptions := netpollSubscriptions[:0]
+	for i, w := range netpollWaiters {
+		if w.hasDeadline {
+			left := w.deadline - now
+			if left < 0 {
+				left = 0
+			}
+			if timeout < 0 || left < timeout {
+				timeout = left
+			}
+		}
+		sub := __wasi_subscription_t{userData: uint64(i)}
+		sub.u.tag = __wasi_eventtype_t_fd_read
+		if w.write {
+			sub.u.tag = __wasi_eventtype_t_fd_write
+		}
+		// The file descriptor of a subscription_fd_readwrite is at the same
+		// offset as the clock id.
+		sub.u.u.id = uint32(w.fd)
+		subscriptions = append(subscriptions, sub)
+	}
+	if timeout >= 0 {
+		sub := sleepTicksSubscription
+		sub.userData = netpollTimeoutUserData
+		sub.u.u.timeout = uint64(timeout)
+		subscriptions = append(subscriptions, sub)
+	}
+	netpollSubscriptions = subscriptions
+	if len(netpollEvents) < len(subscriptions) {
+		netpollEvents = make([]__wasi_event_t, len(subscriptions))
+	}
+
+	var nevents uint32
+	if len(subscriptions) != 0 {
+		errno := poll_oneoff(&subscriptions[0], &netpollEvents[0], uint32(len(subscriptions)), &nevents)
+		if errno != 0 {
+			// Let all waiters try again, they'll get the error when they use
+			// their socket.
+			for _, w := range netpollWaiters {
+				w.ready = true
+			}
+		}
+	}
+	for _, event := range netpollEvents[:nevents] {
+		if event.userData != netpollTimeoutUserData {
+			// The socket is ready, or polling it failed (for example because
+			// it was closed).
+			netpollWaiters[event.userData].ready = true
+		}
+	}
+
+	now = ticks()
+	waiting := netpollWaiters[:0]
+	for _, w := range netpollWaiters {
+		if !w.ready && (!w.hasDeadline || now < w.deadline) {
+			waiting = append(waiting, w)
+			continue
+		}
+		if w.task != nil {
+			runqueuePushBack(w.task)
+		}
+	}
+	for i := len(waiting); i < len(netpollWaiters); i++ {
+		// Don't keep the waiters that are done alive.
+		netpollWaiters[i] = nil
+	}
+	netpollWaiters = waiting
+}
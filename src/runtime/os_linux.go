@@ -87,7 +87,29 @@ func markGlobals() {
 		PF_W    = 0x2 // program flag: write access
 	)
 
+	// Position independent executables and shared libraries are loaded at a
+	// different address than the one in the program header. The ELF header is
+	// at the start of the first loadable segment, which gives the difference.
+	var bias uintptr
 	headerPtr := unsafe.Pointer(uintptr(unsafe.Pointer(&ehdr_start)) + ehdr_start.phoff)
+	for i := 0; i < int(ehdr_start.phnum); i++ {
+		if TargetBits == 64 {
+			header := (*elfProgramHeader64)(headerPtr)
+			if header._type == PT_LOAD {
+				bias = uintptr(unsafe.Pointer(&ehdr_start)) + header.offset - header.vaddr
+				break
+			}
+		} else {
+			header := (*elfProgramHeader32)(headerPtr)
+			if header._type == PT_LOAD {
+				bias = uintptr(unsafe.Pointer(&ehdr_start)) + header.offset - header.vaddr
+				break
+			}
+		}
+		headerPtr = unsafe.Add(headerPtr, ehdr_start.phentsize)
+	}
+
+	headerPtr = unsafe.Pointer(uintptr(unsafe.Pointer(&ehdr_start)) + ehdr_start.phoff)
 	for i := 0; i < int(ehdr_start.phnum); i++ {
 		// Look for a writable segment and scan its contents.
 		// There is a little bit of duplication here, which is unfortunate. But
@@ -97,14 +119,14 @@ func markGlobals() {
 		if TargetBits == 64 {
 			header := (*elfProgramHeader64)(headerPtr)
 			if header._type == PT_LOAD && header.flags&PF_W != 0 {
-				start := header.vaddr
+				start := header.vaddr + bias
 				end := start + header.memsz
 				markRoots(start, end)
 			}
 		} else {
 			header := (*elfProgramHeader32)(headerPtr)
 			if header._type == PT_LOAD && header.flags&PF_W != 0 {
-				start := header.vaddr
+				start := header.vaddr + bias
 				end := start + header.memsz
 				markRoots(start, end)
 			}
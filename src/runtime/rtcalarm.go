@@ -0,0 +1,45 @@
+//go:build nrf || (sam && atsamd21) || (sam && atsamd51) || (sam && atsame5x) || esp32c3
+
+package runtime
+
+import "runtime/interrupt"
+
+// The RTC alarm is used by machine.RTC on chips where the runtime already uses
+// the real-time clock (or the only suitable timer) for timekeeping. The
+// machine package keeps the wall-clock time in timeOffset, the runtime arms a
+// second compare channel of its timer to call the alarm hook. The SAMD21 RTC
+// has only one compare channel in 32-bit mode, so there sleeps and the alarm
+// take turns on it (see setRTCCompare).
+var (
+	rtcAlarmHook  func()
+	rtcAlarmTicks timeUnit
+)
+
+// setRTCAlarm arranges for hook to be called from an interrupt once time.Now
+// reaches the given Unix time in nanoseconds. It replaces a previously set
+// alarm, a nil hook disables the alarm.
+func setRTCAlarm(unixNano int64, hook func()) {
+	mask := interrupt.Disable()
+	rtcAlarmHook = hook
+	if hook != nil {
+		ns := unixNano - timeOffset
+		if ns < 0 {
+			ns = 0
+		}
+		rtcAlarmTicks = nanosecondsToTicks(ns)
+	}
+	armRTCAlarm()
+	interrupt.Restore(mask)
+}
+
+// checkRTCAlarm is called from the timer interrupt with the current time in
+// ticks. It calls the alarm hook once the alarm time has passed.
+func checkRTCAlarm(now timeUnit) {
+	if rtcAlarmHook == nil || now < rtcAlarmTicks {
+		return
+	}
+	hook := rtcAlarmHook
+	rtcAlarmHook = nil
+	armRTCAlarm()
+	hook()
+}
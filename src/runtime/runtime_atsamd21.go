@@ -230,16 +230,24 @@ func initRTC() {
 
 	rtcInterrupt := interrupt.New(sam.IRQ_RTC, func(intr interrupt.Interrupt) {
 		flags := sam.RTC_MODE0.INTFLAG.Get()
-		if flags&sam.RTC_MODE0_INTENSET_CMP0 != 0 {
-			// The timer (for a sleep) has expired.
-			timerWakeup.Set(1)
-		}
 		if flags&sam.RTC_MODE0_INTENSET_OVF != 0 {
 			// The 32-bit RTC timer has overflowed.
 			rtcOverflows.Set(rtcOverflows.Get() + 1)
 		}
 		// Mark this interrupt has handled for CMP0 and OVF.
 		sam.RTC_MODE0.INTFLAG.Set(sam.RTC_MODE0_INTENSET_CMP0 | sam.RTC_MODE0_INTENSET_OVF)
+		if flags&sam.RTC_MODE0_INTENSET_CMP0 != 0 {
+			// The compare channel is shared by sleeps and the RTC alarm, so
+			// check which of the two has expired.
+			cnt := readRTC()
+			if timerSleeping && int32(cnt-timerSleepEnd) >= 0 {
+				// The timer (for a sleep) has expired.
+				timerSleeping = false
+				timerWakeup.Set(1)
+			}
+			checkRTCAlarm(timeUnit(rtcOverflows.Get())<<32 + timeUnit(cnt))
+			setRTCCompare()
+		}
 	})
 	sam.RTC_MODE0.INTENSET.Set(sam.RTC_MODE0_INTENSET_OVF)
 	rtcInterrupt.SetPriority(0xc0)
@@ -316,6 +324,11 @@ func readRTC() uint32 {
 	return sam.RTC_MODE0.COUNT.Get()
 }
 
+var (
+	timerSleeping bool   // whether timerSleep is waiting for the compare match
+	timerSleepEnd uint32 // RTC counter value at which the sleep ends
+)
+
 // ticks are in microseconds
 // Returns true if the timer completed.
 // Returns false if another interrupt occured which requires an early return to scheduler.
@@ -329,17 +342,11 @@ func timerSleep(ticks uint32) bool {
 		ticks = 7
 	}
 
-	// request read of count
-	sam.RTC_MODE0.READREQ.Set(sam.RTC_MODE0_READREQ_RREQ)
-	waitForSync()
-
-	// set compare value
-	cnt := sam.RTC_MODE0.COUNT.Get()
-	sam.RTC_MODE0.COMP0.Set(uint32(cnt) + ticks)
-	waitForSync()
-
-	// enable IRQ for CMP0 compare
-	sam.RTC_MODE0.INTENSET.Set(sam.RTC_MODE0_INTENSET_CMP0)
+	mask := interrupt.Disable()
+	timerSleepEnd = readRTC() + ticks
+	timerSleeping = true
+	setRTCCompare()
+	interrupt.Restore(mask)
 
 wait:
 	waitForEvents()
@@ -348,8 +355,10 @@ wait:
 	}
 	if hasScheduler {
 		// The interurpt may have awoken a goroutine, so bail out early.
-		// Disable IRQ for CMP0 compare.
-		sam.RTC_MODE0.INTENCLR.Set(sam.RTC_MODE0_INTENSET_CMP0)
+		mask := interrupt.Disable()
+		timerSleeping = false
+		setRTCCompare()
+		interrupt.Restore(mask)
 		return false
 	} else {
 		// This is running without a scheduler.
@@ -358,6 +367,60 @@ wait:
 	}
 }
 
+// armRTCAlarm updates the compare channel for a changed RTC alarm.
+func armRTCAlarm() {
+	setRTCCompare()
+}
+
+// setRTCCompare sets the compare value to the end of the current sleep or the
+// RTC alarm time, whichever comes first. The SAMD21 RTC has only one compare
+// channel in 32-bit counter mode (COMP1 only exists in 16-bit mode, which would
+// overflow every two seconds), so both have to share it: the RTC interrupt
+// checks which of the two expired and calls this function again for the other
+// one. The compare interrupt is disabled when there is neither. It must be
+// called with interrupts disabled.
+func setRTCCompare() {
+	if !timerSleeping && rtcAlarmHook == nil {
+		// Disable IRQ for CMP0 compare.
+		sam.RTC_MODE0.INTENCLR.Set(sam.RTC_MODE0_INTENSET_CMP0)
+		return
+	}
+
+	// Don't use ticks() here: this may be called from the RTC interrupt, where
+	// ticks() would spin forever on a pending overflow.
+	cnt := readRTC()
+	delta := uint32(0xffffffff)
+	if timerSleeping {
+		delta = timerSleepEnd - cnt
+		if int32(delta) < 7 {
+			delta = 7
+		}
+	}
+	if rtcAlarmHook != nil {
+		overflows := rtcOverflows.Get()
+		if sam.RTC_MODE0.INTFLAG.Get()&sam.RTC_MODE0_INTENSET_OVF != 0 && cnt < 1<<31 {
+			// The counter wrapped around, but the interrupt hasn't counted
+			// the overflow yet.
+			overflows++
+		}
+		now := timeUnit(overflows)<<32 + timeUnit(cnt)
+		d := timeUnit(7)
+		if rtcAlarmTicks > now+d {
+			d = rtcAlarmTicks - now
+		}
+		if d < timeUnit(delta) {
+			delta = uint32(d)
+		}
+	}
+
+	// set compare value
+	sam.RTC_MODE0.COMP0.Set(cnt + delta)
+	waitForSync()
+
+	// enable IRQ for CMP0 compare
+	sam.RTC_MODE0.INTENSET.Set(sam.RTC_MODE0_INTENSET_CMP0)
+}
+
 func initUSBClock() {
 	// Turn on clock for USB
 	sam.PM.APBBMASK.SetBits(sam.PM_APBBMASK_USB_)
@@ -231,8 +231,12 @@ func initRTC() {
 			// The 32-bit RTC timer has overflowed.
 			rtcOverflows.Set(rtcOverflows.Get() + 1)
 		}
-		// Mark this interrupt has handled for CMP0 and OVF.
-		sam.RTC_MODE0.INTFLAG.Set(sam.RTC_MODE0_INTENSET_CMP0 | sam.RTC_MODE0_INTENSET_OVF)
+		// Mark this interrupt has handled for CMP0, CMP1 and OVF.
+		sam.RTC_MODE0.INTFLAG.Set(sam.RTC_MODE0_INTENSET_CMP0 | sam.RTC_MODE0_INTENSET_CMP1 | sam.RTC_MODE0_INTENSET_OVF)
+		if flags&sam.RTC_MODE0_INTENSET_CMP1 != 0 {
+			// The lower 32 bits of the RTC alarm time matched.
+			checkRTCAlarm(timeUnit(rtcOverflows.Get())<<32 + timeUnit(readRTC()))
+		}
 	})
 	sam.RTC_MODE0.INTENSET.Set(sam.RTC_MODE0_INTENSET_OVF)
 	irq.SetPriority(0xc0)
@@ -305,6 +309,30 @@ func readRTC() uint32 {
 	return sam.RTC_MODE0.COUNT.Get()
 }
 
+const rtcSYNCBUSY_COMP1 = 1 << 6 // COMP1 bit in RTC_MODE0.SYNCBUSY
+
+// armRTCAlarm sets the second compare channel of the RTC to the RTC alarm
+// time, or disables it if there is no alarm.
+func armRTCAlarm() {
+	if rtcAlarmHook == nil {
+		sam.RTC_MODE0.INTENCLR.Set(sam.RTC_MODE0_INTENSET_CMP1)
+		return
+	}
+	// Don't use ticks() here: this may be called from the RTC interrupt, where
+	// ticks() would spin forever on a pending overflow.
+	cnt := readRTC()
+	alarm := rtcAlarmTicks
+	if now := timeUnit(rtcOverflows.Get())<<32 + timeUnit(cnt); alarm < now+8 {
+		// Same minimum as in timerSleep.
+		alarm = now + 8
+	}
+	sam.RTC_MODE0.COMP[1].Set(uint32(alarm))
+	for sam.RTC_MODE0.SYNCBUSY.HasBits(rtcSYNCBUSY_COMP1) {
+	}
+	sam.RTC_MODE0.INTFLAG.Set(sam.RTC_MODE0_INTENSET_CMP1)
+	sam.RTC_MODE0.INTENSET.Set(sam.RTC_MODE0_INTENSET_CMP1)
+}
+
 // ticks are in microseconds
 // Returns true if the timer completed.
 // Returns false if another interrupt occured which requires an early return to scheduler.
@@ -15,9 +15,8 @@ import (
 //export main
 func main() {
 	// This initialization configures the following things:
-	// * It disables all watchdog timers. They might be useful at some point in
-	//   the future, but will need integration into the scheduler. For now,
-	//   they're all disabled.
+	// * It disables all watchdog timers. The timer group 0 watchdog can be
+	//   started again using machine.Watchdog.
 	// * It sets the CPU frequency to 160MHz, which is the maximum speed allowed
 	//   for this CPU. Lower frequencies might be possible in the future, but
 	//   running fast and sleeping quickly is often also a good strategy to save
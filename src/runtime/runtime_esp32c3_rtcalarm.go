@@ -0,0 +1,47 @@
+//go:build esp32c3
+
+package runtime
+
+import (
+	"device/esp"
+	"runtime/interrupt"
+)
+
+// CPU interrupt for the RTC alarm. The machine package uses 6 (GPIO) and 7
+// (UART).
+const cpuInterruptFromTimer = 8
+
+const (
+	timgT0ConfigAlarmEn = 1 << 10 // T0_ALARM_EN in T0CONFIG
+	timgIntT0           = 1 << 0  // T0_INT_* in the INT_*_TIMERS registers
+)
+
+var rtcAlarmInterruptEnabled bool
+
+// armRTCAlarm sets the alarm of timer 0 in timer group 0 (the timer used for
+// timekeeping) to the RTC alarm time, or disables it if there is no alarm.
+func armRTCAlarm() {
+	if rtcAlarmHook == nil {
+		esp.TIMG0.T0CONFIG.ClearBits(timgT0ConfigAlarmEn)
+		esp.TIMG0.INT_ENA_TIMERS.ClearBits(timgIntT0)
+		return
+	}
+	if !rtcAlarmInterruptEnabled {
+		rtcAlarmInterruptEnabled = true
+		esp.INTERRUPT_CORE0.TG_T0_INTR_MAP.Set(cpuInterruptFromTimer)
+		interrupt.New(cpuInterruptFromTimer, func(interrupt.Interrupt) {
+			esp.TIMG0.INT_CLR_TIMERS.Set(timgIntT0)
+			checkRTCAlarm(ticks())
+		}).Enable()
+	}
+	alarm := rtcAlarmTicks
+	if now := ticks(); alarm < now+40 {
+		// Make sure the alarm is in the future (by at least 1µs).
+		alarm = now + 40
+	}
+	esp.TIMG0.T0ALARMLO.Set(uint32(alarm))
+	esp.TIMG0.T0ALARMHI.Set(uint32(alarm >> 32))
+	esp.TIMG0.INT_CLR_TIMERS.Set(timgIntT0)
+	esp.TIMG0.INT_ENA_TIMERS.SetBits(timgIntT0)
+	esp.TIMG0.T0CONFIG.SetBits(timgT0ConfigAlarmEn)
+}
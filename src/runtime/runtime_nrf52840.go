@@ -58,6 +58,11 @@ func initRTC() {
 			nrf.RTC1.EVENTS_OVRFLW.Set(0)
 			rtcOverflows.Set(rtcOverflows.Get() + 1)
 		}
+		if nrf.RTC1.EVENTS_COMPARE[1].Get() != 0 {
+			// The lower 24 bits of the RTC alarm time matched.
+			nrf.RTC1.EVENTS_COMPARE[1].Set(0)
+			checkRTCAlarm(timeUnit(rtcOverflows.Get())<<24 + timeUnit(nrf.RTC1.COUNTER.Get()))
+		}
 	})
 	nrf.RTC1.INTENSET.Set(nrf.RTC_INTENSET_OVRFLW)
 	intr.SetPriority(0xc0) // low priority
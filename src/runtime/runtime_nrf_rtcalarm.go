@@ -0,0 +1,27 @@
+//go:build nrf
+
+package runtime
+
+import "device/nrf"
+
+// armRTCAlarm sets the second compare channel of RTC1 to the RTC alarm time,
+// or disables it if there is no alarm. The channel only compares the lower 24
+// bits, so for alarms more than 512 seconds away it fires a few times before
+// checkRTCAlarm calls the hook.
+func armRTCAlarm() {
+	if rtcAlarmHook == nil {
+		nrf.RTC1.INTENCLR.Set(nrf.RTC_INTENSET_COMPARE1)
+		return
+	}
+	// Don't use ticks() here: this may be called from the RTC1 interrupt,
+	// where ticks() would spin forever on a pending overflow.
+	now := timeUnit(rtcOverflows.Get())<<24 + timeUnit(nrf.RTC1.COUNTER.Get())
+	alarm := rtcAlarmTicks
+	if alarm < now+2 {
+		// Writing COUNTER or COUNTER+1 to CC doesn't trigger a compare event.
+		alarm = now + 2
+	}
+	nrf.RTC1.CC[1].Set(uint32(alarm) & 0x00ffffff)
+	nrf.RTC1.EVENTS_COMPARE[1].Set(0)
+	nrf.RTC1.INTENSET.Set(nrf.RTC_INTENSET_COMPARE1)
+}
@@ -0,0 +1,40 @@
+//go:build linux && !baremetal && !wasi && !nintendoswitch && (buildmode.c_archive || buildmode.c_shared)
+
+package runtime
+
+import "unsafe"
+
+// In a C library (-buildmode=c-archive or -buildmode=c-shared) there is no
+// main function that initializes the runtime. Instead, the compiler wraps every
+// exported function in calls to libraryEnter and libraryExit.
+//
+// Only one thread may call into the library at a time: the runtime is not
+// thread safe.
+
+var (
+	libraryInitialized bool
+	libraryDepth       int
+)
+
+// libraryEnter is called at the start of every exported function, with the
+// stack pointer of the caller. It initializes the runtime on the first call.
+func libraryEnter(sp unsafe.Pointer) {
+	if libraryDepth == 0 {
+		// The stack may be at a different place on every call from C, so
+		// remember where it starts for the garbage collector. Nested calls
+		// (C calling back into Go) run on the same stack.
+		stackTop = uintptr(sp)
+	}
+	libraryDepth++
+	if !libraryInitialized {
+		libraryInitialized = true
+		preinit()
+		initHeap()
+		initAll()
+	}
+}
+
+// libraryExit is called at the end of every exported function.
+func libraryExit() {
+	libraryDepth--
+}
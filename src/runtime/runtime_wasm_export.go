@@ -0,0 +1,44 @@
+//go:build tinygo.wasm
+
+package runtime
+
+// Support for //go:wasmexport functions that can block. The compiler runs
+// them in a new goroutine, and runs the scheduler until they return.
+
+// wasmNested is used to detect scheduler nesting (WASM calls into JS calls back into WASM).
+// When this happens, we need to use a reduced version of the scheduler.
+var wasmNested bool
+
+// wasmExportFinished is set when the currently running //go:wasmexport
+// function returns.
+var wasmExportFinished bool
+
+// wasmExportRun is called by the wrapper of a //go:wasmexport function after it
+// started the goroutine that runs the function. It runs the scheduler (and thus
+// all other goroutines) until the function returns.
+func wasmExportRun() {
+	if wasmNested {
+		// The host called an exported function while Go code was running,
+		// for example from an imported function.
+		runtimePanic("//go:wasmexport function called while the scheduler is running")
+	}
+	wasmNested = true
+	wasmExportFinished = false
+	done := schedulerDone
+	schedulerDone = false
+	scheduler()
+	if !wasmExportFinished {
+		// The JavaScript scheduler returns instead of sleeping.
+		runtimePanic("//go:wasmexport function blocked")
+	}
+	schedulerDone = done
+	wasmNested = false
+}
+
+// wasmExportDone is called in the goroutine of a //go:wasmexport function when
+// the function returns. It stops the scheduler that was started by
+// wasmExportRun.
+func wasmExportDone() {
+	wasmExportFinished = true
+	schedulerDone = true
+}
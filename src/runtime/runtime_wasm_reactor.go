@@ -0,0 +1,29 @@
+//go:build tinygo.wasm && buildmode.c_shared
+
+package runtime
+
+import "unsafe"
+
+// A reactor module (-buildmode=c-shared) has no main function that runs once.
+// Instead, the host calls _initialize once and may then call exported
+// functions as often as it wants. The heap and all goroutines are kept between
+// these calls, goroutines run while an exported function is running.
+
+//export _initialize
+func _initialize() {
+	// These need to be initialized early so that the heap can be initialized.
+	heapStart = uintptr(unsafe.Pointer(&heapStartSymbol))
+	heapEnd = uintptr(wasm_memory_size(0) * wasmPageSize)
+	initHeap()
+
+	if hasScheduler {
+		// Package initializers may block, like any other Go code.
+		go func() {
+			initAll()
+			wasmExportDone()
+		}()
+		wasmExportRun()
+	} else {
+		initAll()
+	}
+}
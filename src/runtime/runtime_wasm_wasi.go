@@ -13,14 +13,6 @@ type timeUnit int64
 //export __wasm_call_ctors
 func __wasm_call_ctors()
 
-//export _start
-func _start() {
-	// These need to be initialized early so that the heap can be initialized.
-	heapStart = uintptr(unsafe.Pointer(&heapStartSymbol))
-	heapEnd = uintptr(wasm_memory_size(0) * wasmPageSize)
-	run()
-}
-
 // Read the command line arguments from WASI.
 // For example, they can be passed to a program with wasmtime like this:
 //
@@ -89,10 +81,24 @@ var (
 )
 
 func sleepTicks(d timeUnit) {
+	if len(netpollWaiters) != 0 {
+		// Wake up early when a socket becomes ready.
+		netpoll(d)
+		return
+	}
 	sleepTicksSubscription.u.u.timeout = uint64(d)
 	poll_oneoff(&sleepTicksSubscription, &sleepTicksResult, 1, &sleepTicksNEvents)
 }
 
+// waitForEvents is called by the scheduler when all goroutines are blocked and
+// none of them will wake up by itself. Only a socket can wake them up then.
+func waitForEvents() {
+	if len(netpollWaiters) == 0 {
+		runtimePanic("deadlocked: no event source")
+	}
+	netpoll(-1)
+}
+
 func ticks() timeUnit {
 	var nano uint64
 	clock_time_get(0, timePrecisionNanoseconds, &nano)
@@ -116,9 +122,9 @@ func poll_oneoff(in *__wasi_subscription_t, out *__wasi_event_t, nsubscriptions
 type __wasi_eventtype_t = uint8
 
 const (
-	__wasi_eventtype_t_clock __wasi_eventtype_t = 0
-	// TODO: __wasi_eventtype_t_fd_read  __wasi_eventtype_t = 1
-	// TODO: __wasi_eventtype_t_fd_write __wasi_eventtype_t = 2
+	__wasi_eventtype_t_clock    __wasi_eventtype_t = 0
+	__wasi_eventtype_t_fd_read  __wasi_eventtype_t = 1
+	__wasi_eventtype_t_fd_write __wasi_eventtype_t = 2
 )
 
 type (
@@ -131,7 +137,8 @@ type (
 	__wasi_subscription_u_t struct {
 		tag __wasi_eventtype_t
 
-		// TODO: support fd_read/fd_write event
+		// The subscription_fd_readwrite of fd_read and fd_write events only
+		// has a file descriptor, which is stored in the clock id.
 		u __wasi_subscription_clock_t
 	}
 
@@ -152,7 +159,6 @@ type (
 		eventType __wasi_eventtype_t
 
 		// only used for fd_read or fd_write events
-		// TODO: support fd_read/fd_write event
 		_ struct {
 			nBytes uint64
 			flags  uint16
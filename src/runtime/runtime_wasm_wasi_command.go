@@ -0,0 +1,16 @@
+//go:build tinygo.wasm && wasi && !buildmode.c_shared
+
+package runtime
+
+import "unsafe"
+
+//export _start
+func _start() {
+	// These need to be initialized early so that the heap can be initialized.
+	heapStart = uintptr(unsafe.Pointer(&heapStartSymbol))
+	heapEnd = uintptr(wasm_memory_size(0) * wasmPageSize)
+
+	wasmNested = true
+	run()
+	wasmNested = false
+}
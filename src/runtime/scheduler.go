@@ -196,6 +196,11 @@ func scheduler() {
 					// JavaScript is treated specially, see below.
 					return
 				}
+				if idleHook != nil {
+					// Wake up in time to call the idle hook again.
+					sleepTicks(runIdleHook(idleHookInterval))
+					continue
+				}
 				waitForEvents()
 				continue
 			}
@@ -220,7 +225,7 @@ func scheduler() {
 					println("---   timer waiting:", tim, tim.whenTicks())
 				}
 			}
-			sleepTicks(timeLeft)
+			sleepTicks(runIdleHook(timeLeft))
 			if asyncScheduler {
 				// The sleepTicks function above only sets a timeout at which
 				// point the scheduler will be called again. It does not really
@@ -256,6 +261,11 @@ func minSched() {
 }
 
 func Gosched() {
+	if runqueue.Empty() {
+		// No other goroutine is ready to run, so the caller is polling for
+		// something and the scheduler is effectively idle.
+		runIdleHook(0)
+	}
 	runqueue.Push(task.Current())
 	task.Pause()
 }
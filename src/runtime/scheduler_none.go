@@ -8,7 +8,13 @@ func sleep(duration int64) {
 		return
 	}
 
-	sleepTicks(nanosecondsToTicks(duration))
+	ticks := nanosecondsToTicks(duration)
+	for ticks > 0 {
+		// Without a scheduler, sleeping is the only time the CPU is idle.
+		t := runIdleHook(ticks)
+		sleepTicks(t)
+		ticks -= t
+	}
 }
 
 // getSystemStackPointer returns the current stack pointer of the system stack.
@@ -38,6 +38,7 @@ func sliceAppend(srcBuf, elemsBuf unsafe.Pointer, srcLen, srcCap, elemsLen uintp
 
 	// The slice fits (after possibly allocating a new one), append it in-place.
 	memmove(unsafe.Add(srcBuf, srcLen*elemSize), elemsBuf, elemsLen*elemSize)
+	gcWriteBarrier(srcBuf)
 	return srcBuf, srcLen + elemsLen, srcCap
 }
 
@@ -49,6 +50,7 @@ func sliceCopy(dst, src unsafe.Pointer, dstLen, srcLen uintptr, elemSize uintptr
 		n = dstLen
 	}
 	memmove(dst, src, n*elemSize)
+	gcWriteBarrier(dst)
 	return int(n)
 }
 
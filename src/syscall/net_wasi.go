@@ -0,0 +1,117 @@
+//go:build wasi
+
+package syscall
+
+// Sockets in WASI preview 1. Sockets can't be created by the program itself,
+// but a runtime can pass listening sockets as preopened file descriptors (for
+// example wasmtime with --tcplisten). Connections accepted on such a socket
+// are read and written with sock_recv and sock_send.
+
+import "unsafe"
+
+const (
+	SHUT_RD   = 0x1 // __WASI_SDFLAGS_RD
+	SHUT_WR   = 0x2 // __WASI_SDFLAGS_WR
+	SHUT_RDWR = SHUT_RD | SHUT_WR
+)
+
+// https://github.com/WebAssembly/WASI/blob/main/legacy/preview1/docs.md#-fdstat-record
+type fdstat struct {
+	filetype         uint8
+	flags            uint16
+	rightsBase       uint64
+	rightsInheriting uint64
+}
+
+// https://github.com/WebAssembly/WASI/blob/main/legacy/preview1/docs.md#-iovec-record
+type iovec struct {
+	buf    unsafe.Pointer
+	bufLen uint32
+}
+
+// IsSocket returns whether the file descriptor is a stream socket, such as a
+// preopened listening socket.
+func IsSocket(fd int) (bool, error) {
+	var stat fdstat
+	if errno := fd_fdstat_get(int32(fd), unsafe.Pointer(&stat)); errno != 0 {
+		return false, Errno(errno)
+	}
+	return stat.filetype == __WASI_FILETYPE_SOCKET_STREAM, nil
+}
+
+// SetNonblock puts the file descriptor in non-blocking mode, or takes it out
+// of non-blocking mode.
+func SetNonblock(fd int, nonblocking bool) (err error) {
+	var stat fdstat
+	if errno := fd_fdstat_get(int32(fd), unsafe.Pointer(&stat)); errno != 0 {
+		return Errno(errno)
+	}
+	flags := stat.flags &^ __WASI_FDFLAGS_NONBLOCK
+	if nonblocking {
+		flags |= __WASI_FDFLAGS_NONBLOCK
+	}
+	if errno := fd_fdstat_set_flags(int32(fd), uint32(flags)); errno != 0 {
+		return Errno(errno)
+	}
+	return nil
+}
+
+// Accept accepts a new connection on a listening socket. The new socket is in
+// non-blocking mode when flags includes O_NONBLOCK.
+func Accept(fd int, flags int) (nfd int, err error) {
+	var newfd int32
+	if errno := sock_accept(int32(fd), uint32(flags&O_NONBLOCK), unsafe.Pointer(&newfd)); errno != 0 {
+		return -1, Errno(errno)
+	}
+	return int(newfd), nil
+}
+
+// Recv reads from a connected socket.
+func Recv(fd int, p []byte, flags int) (n int, err error) {
+	buf, count := splitSlice(p)
+	iov := iovec{buf: unsafe.Pointer(buf), bufLen: uint32(count)}
+	var received uint32
+	var roflags uint16
+	if errno := sock_recv(int32(fd), unsafe.Pointer(&iov), 1, uint32(flags), unsafe.Pointer(&received), unsafe.Pointer(&roflags)); errno != 0 {
+		return 0, Errno(errno)
+	}
+	return int(received), nil
+}
+
+// Send writes to a connected socket.
+func Send(fd int, p []byte, flags int) (n int, err error) {
+	buf, count := splitSlice(p)
+	iov := iovec{buf: unsafe.Pointer(buf), bufLen: uint32(count)}
+	var sent uint32
+	if errno := sock_send(int32(fd), unsafe.Pointer(&iov), 1, uint32(flags), unsafe.Pointer(&sent)); errno != 0 {
+		return 0, Errno(errno)
+	}
+	return int(sent), nil
+}
+
+// Shutdown shuts down the read side (SHUT_RD), the write side (SHUT_WR) or
+// both sides (SHUT_RDWR) of a connected socket.
+func Shutdown(fd int, how int) (err error) {
+	if errno := sock_shutdown(int32(fd), uint32(how)); errno != 0 {
+		return Errno(errno)
+	}
+	return nil
+}
+
+//go:wasmimport wasi_snapshot_preview1 fd_fdstat_get
+func fd_fdstat_get(fd int32, buf unsafe.Pointer) uint32
+
+//go:wasmimport wasi_snapshot_preview1 fd_fdstat_set_flags
+func fd_fdstat_set_flags(fd int32, flags uint32) uint32
+
+//go:wasmimport wasi_snapshot_preview1 sock_accept
+func sock_accept(fd int32, flags uint32, newfd unsafe.Pointer) uint32
+
+//go:wasmimport wasi_snapshot_preview1 sock_recv
+func sock_recv(fd int32, iovs unsafe.Pointer, iovsLen uint32, flags uint32, nread unsafe.Pointer, oflags unsafe.Pointer) uint32
+
+//go:wasmimport wasi_snapshot_preview1 sock_send
+func sock_send(fd int32, iovs unsafe.Pointer, iovsLen uint32, flags uint32, nwritten unsafe.Pointer) uint32
+
+//go:wasmimport wasi_snapshot_preview1 sock_shutdown
+func sock_shutdown(fd int32, how uint32) uint32
@@ -152,6 +152,10 @@ func (ts *Timespec) Unix() (sec int64, nsec int64) {
 	return int64(ts.Sec), int64(ts.Nsec)
 }
 
+func setTimespec(sec, nsec int64) Timespec {
+	return Timespec{Sec: sec, Nsec: nsec}
+}
+
 // Source: upstream ztypes_darwin_amd64.go
 type Dirent struct {
 	Ino       uint64
@@ -0,0 +1,34 @@
+//go:build darwin || wasi
+
+package syscall
+
+import "unsafe"
+
+// AT_FDCWD is the same value (-2) on darwin and in wasi-libc.
+const _AT_FDCWD = -2
+
+func NsecToTimespec(nsec int64) Timespec {
+	sec := nsec / 1e9
+	nsec = nsec % 1e9
+	if nsec < 0 {
+		nsec += 1e9
+		sec--
+	}
+	return setTimespec(sec, nsec)
+}
+
+func UtimesNano(path string, ts []Timespec) (err error) {
+	if len(ts) != 2 {
+		return EINVAL
+	}
+	data := cstring(path)
+	if libc_utimensat(_AT_FDCWD, &data[0], unsafe.Pointer(&ts[0]), 0) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+// int utimensat(int dirfd, const char *path, const struct timespec times[2], int flags);
+//
+//export utimensat
+func libc_utimensat(dirfd int32, path *byte, times unsafe.Pointer, flags int32) int32
@@ -219,8 +219,12 @@ const (
 
 // https://github.com/WebAssembly/wasi-libc/blob/main/libc-bottom-half/headers/public/__struct_timespec.h
 type Timespec struct {
-	Sec  int32
-	Nsec int64
+	Sec  int64
+	Nsec int32
+}
+
+func setTimespec(sec, nsec int64) Timespec {
+	return Timespec{Sec: sec, Nsec: int32(nsec)}
 }
 
 // Unix returns the time stored in ts as seconds plus nanoseconds.
@@ -393,6 +397,7 @@ func Chmod(path string, mode uint32) (err error) {
 	//
 	// We make a call to Lstat instead so we detect conditions like the path not
 	// existing, but we don't honnor the request to modify the file permissions.
+	// This is what the wasip1 port of upstream Go does as well.
 	stat := Stat_t{}
 	return Lstat(path, &stat)
 }
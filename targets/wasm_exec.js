@@ -474,6 +474,14 @@
 
 			const mem = new DataView(this._inst.exports.memory.buffer)
 
+			if (this._inst.exports._initialize) {
+				// Reactor module (built with -buildmode=c-shared): there is no
+				// main function. Initialize it, after which the exported
+				// functions can be called.
+				this._inst.exports._initialize();
+				return;
+			}
+
 			while (true) {
 				const callbackPromise = new Promise((resolve) => {
 					this._resolveCallbackPromise = () => {
@@ -0,0 +1,13 @@
+package main
+
+// This program has a heap allocation in package main that can't be converted
+// to a stack allocation. It is used to test -max-allocs and -alloc-report.
+
+var sink *[64]byte
+
+func main() {
+	buf := new([64]byte)
+	buf[0] = 'x'
+	sink = buf
+	println("allocated", sink[0])
+}
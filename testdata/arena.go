@@ -0,0 +1,91 @@
+package main
+
+import (
+	"arena"
+	"runtime"
+)
+
+type node struct {
+	next  *node
+	value int
+}
+
+var buffer [256]byte
+
+func main() {
+	testArena()
+	testArenaBuffer()
+	testPool()
+}
+
+func testArena() {
+	a := arena.NewArenaSize(256)
+	list := buildList(a, 10)
+	println("list sum:", sum(list))
+
+	// Once the arena is big enough, reusing it doesn't allocate.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 100; i++ {
+		a.Reset()
+		list = buildList(a, 10)
+	}
+	runtime.ReadMemStats(&after)
+	println("list sum after reset:", sum(list))
+	println("allocations after reset:", after.Mallocs-before.Mallocs)
+
+	// Growing beyond the initial size.
+	list = buildList(a, 100)
+	println("big list sum:", sum(list))
+
+	// Clone copies values out of the arena.
+	s := arena.MakeSlice[int](a, 3, 5)
+	s[1] = 42
+	c := arena.Clone(s)
+	a.Free()
+	println("clone:", len(c), cap(c), c[1])
+}
+
+func testArenaBuffer() {
+	// An arena in a buffer never uses the heap.
+	a := arena.NewArenaBuffer(buffer[:])
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	list := buildList(a, 5)
+	runtime.ReadMemStats(&after)
+	println("buffer list sum:", sum(list))
+	println("buffer allocations:", after.Mallocs-before.Mallocs)
+}
+
+func testPool() {
+	p := arena.NewPool[node](2)
+	n1 := p.Get()
+	n2 := p.Get()
+	println("pool exhausted:", p.Get() == nil, p.Len(), p.Cap())
+	n1.value = 5
+	p.Put(n1)
+	n3 := p.Get()
+	println("pool reuse:", n3 == n1, n3.value)
+	p.Put(n2)
+	p.Put(n3)
+	println("pool len:", p.Len())
+}
+
+func buildList(a *arena.Arena, n int) *node {
+	var list *node
+	for i := 1; i <= n; i++ {
+		nd := arena.New[node](a)
+		nd.value = i
+		nd.next = list
+		list = nd
+	}
+	return list
+}
+
+func sum(list *node) int {
+	total := 0
+	for ; list != nil; list = list.next {
+		total += list.value
+	}
+	return total
+}
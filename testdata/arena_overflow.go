@@ -0,0 +1,47 @@
+package main
+
+// Test that allocations from an arena that don't fit in the address space
+// panic, instead of wrapping around and returning a pointer to memory that
+// is too small. This needs recover(), so it is a separate test.
+
+import "arena"
+
+const maxInt = int(^uint(0) >> 1)
+
+type node struct {
+	next  *node
+	value int
+}
+
+func main() {
+	a := arena.NewArenaSize(256)
+
+	// The slice size (capacity times element size) overflows.
+	allocate("slice capacity", func() {
+		arena.MakeSlice[int64](a, 0, maxInt/2)
+	})
+
+	// The slice size itself fits, but not after the objects that are already
+	// in the chunk.
+	arena.New[node](a)
+	allocate("slice after object", func() {
+		arena.MakeSlice[[2]byte](a, 0, maxInt)
+	})
+
+	// The arena can still be used after a failed allocation.
+	s := arena.MakeSlice[int](a, 2, 2)
+	s[1] = 5
+	println("slice:", len(s), s[1])
+}
+
+func allocate(name string, f func()) {
+	defer func() {
+		err := recover()
+		if err == nil {
+			println(name+":", "no panic")
+			return
+		}
+		println(name+":", err.(string))
+	}()
+	f()
+}
@@ -1,6 +1,10 @@
 package main
 
-import "runtime"
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+)
 
 var xorshift32State uint32 = 1
 
@@ -20,6 +24,7 @@ func randuint32() uint32 {
 func main() {
 	testNonPointerHeap()
 	testKeepAlive()
+	testGCPercent()
 }
 
 var scalarSlices [4][]byte
@@ -74,3 +79,32 @@ func testKeepAlive() {
 	var x int
 	runtime.KeepAlive(&x)
 }
+
+func testGCPercent() {
+	// SetGCPercent returns the previous setting, which is 100 by default.
+	println("GC percent:", debug.SetGCPercent(50))
+	println("GC percent:", debug.SetGCPercent(50))
+
+	// Collect more often than usual, and check that the heap still works.
+	testNonPointerHeap()
+
+	// A negative percentage turns the GC off until the heap is full, and is
+	// reported as -1.
+	var stats runtime.MemStats
+	println("GC percent:", debug.SetGCPercent(-20))
+	runtime.ReadMemStats(&stats)
+	println("GC off:", debug.SetGCPercent(-1) == -1, stats.NextGC == uint64(^uintptr(0)))
+	println("GC percent:", debug.SetGCPercent(100))
+	runtime.ReadMemStats(&stats)
+	println("GC on:", stats.NextGC < uint64(^uintptr(0)))
+
+	// Values that don't fit in the runtime's int32 are clamped instead of
+	// wrapping around.
+	debug.SetGCPercent(math.MaxInt)
+	println("clamped max:", debug.SetGCPercent(math.MinInt) == math.MaxInt32)
+	println("clamped min:", debug.SetGCPercent(100) == -1)
+
+	// A negative limit only reads the current memory limit.
+	println("no memory limit:", debug.SetMemoryLimit(-1) == math.MaxInt64)
+	debug.FreeOSMemory()
+}
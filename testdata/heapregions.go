@@ -0,0 +1,82 @@
+package main
+
+// Test allocating from heap regions that are not contiguous with the main heap:
+// one from the linker script and one added at runtime. See heapregions.ld for
+// the memory layout.
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+const (
+	region2Start = 0x20008000
+	region3Start = 0x20004000 // added at runtime
+	region3End   = 0x20008000
+)
+
+var keep [][]byte
+
+func main() {
+	for round := 0; round < 3; round++ {
+		// Allocate more than fits in the main heap, so that some objects must
+		// be allocated in the second heap region.
+		inRegion2 := 0
+		for i := 0; i < 40; i++ {
+			buf := make([]byte, 512)
+			for j := range buf {
+				buf[j] = byte(i + round)
+			}
+			if uintptr(unsafe.Pointer(&buf[0])) >= region2Start {
+				inRegion2++
+			}
+			keep = append(keep, buf)
+		}
+		runtime.GC()
+
+		// The objects in both regions must have survived the GC.
+		corrupt := false
+		for i, buf := range keep {
+			for _, b := range buf {
+				if b != byte(i+round) {
+					corrupt = true
+				}
+			}
+		}
+		println("round", round, "used second region:", inRegion2 > 0, "corrupt:", corrupt)
+
+		// Free everything, so the next round must reuse the memory.
+		keep = nil
+		runtime.GC()
+	}
+
+	// Add more memory at runtime, like a program would do for external
+	// memory once it has been configured. A region that is too small to be
+	// used is ignored.
+	println("added tiny region:", runtime.AddHeapRegion(region3Start, region3Start+8))
+	println("added third region:", runtime.AddHeapRegion(region3Start, region3End))
+
+	// Keep more memory alive than fits in the main heap and the second region
+	// together, so that the third region must be used.
+	inRegion3 := 0
+	for i := 0; i < 90; i++ {
+		buf := make([]byte, 512)
+		for j := range buf {
+			buf[j] = byte(i)
+		}
+		if addr := uintptr(unsafe.Pointer(&buf[0])); addr >= region3Start && addr < region3End {
+			inRegion3++
+		}
+		keep = append(keep, buf)
+	}
+	runtime.GC()
+	corrupt := false
+	for i, buf := range keep {
+		for _, b := range buf {
+			if b != byte(i) {
+				corrupt = true
+			}
+		}
+	}
+	println("used third region:", inRegion3 > 0, "corrupt:", corrupt)
+}
@@ -0,0 +1,14 @@
+#include <stdio.h>
+#include "library.h"
+
+// Calls the library built from library.go.
+int main(void) {
+	printf("initDone: %d\n", (int)initDone());
+	printf("add(3, 4): %d\n", (int)add(3, 4));
+	for (int i = 1; i <= 100; i++) {
+		remember(i);
+	}
+	printf("remember(1000): %d\n", (int)remember(1000));
+	printf("sum: %d\n", (int)sum());
+	return 0;
+}
@@ -0,0 +1,54 @@
+package main
+
+// This is a C library, built with -buildmode=c-archive and -buildmode=c-shared
+// and called from library.c.
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// numbers is kept on the heap across calls from C.
+var numbers []string
+
+var initialized = initialize()
+
+func initialize() bool {
+	println("library initialized")
+	return true
+}
+
+//export add
+func add(a, b int) int {
+	return a + b
+}
+
+//export remember
+func remember(n int) int {
+	numbers = append(numbers, strconv.Itoa(n))
+	// The slice must survive a garbage collection between calls.
+	runtime.GC()
+	return len(numbers)
+}
+
+//export sum
+func sum() int {
+	total := 0
+	for _, s := range numbers {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			panic(err)
+		}
+		total += n
+	}
+	return total
+}
+
+//export initDone
+func initDone() bool {
+	return initialized
+}
+
+func main() {
+	println("main must not be called in a library")
+}
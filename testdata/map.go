@@ -130,6 +130,8 @@ func main() {
 
 	mapgrow()
 
+	mapchurn()
+
 	interfacerehash()
 }
 
@@ -277,6 +279,32 @@ func mapgrow() {
 	println("done")
 }
 
+// mapchurn inserts and deletes many keys, while keeping the map small. This
+// leaves behind a lot of deleted slots, which must not break lookups.
+func mapchurn() {
+	m := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		m[i] = i
+		if i >= 10 {
+			delete(m, i-10)
+		}
+		if len(m) > 10 {
+			println("bad length during churn:", len(m))
+		}
+		for j := i - len(m) + 1; j <= i; j++ {
+			if v, ok := m[j]; !ok || v != j {
+				println("lookup failure during churn:", j, v, ok)
+				return
+			}
+		}
+	}
+	var sum int
+	for k := range m {
+		sum += k
+	}
+	println("churn:", len(m), sum)
+}
+
 type Counter interface {
 	count() int
 }
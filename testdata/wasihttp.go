@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Serve HTTP requests on the socket that wasmtime passes with --tcplisten.
+func main() {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		println("listen:", err.Error())
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello, %s\n", r.URL.Query().Get("name"))
+	})
+	err = http.Serve(ln, mux)
+	println("serve:", err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+// Serve a single connection on the socket that wasmtime passes with
+// --tcplisten.
+func main() {
+	// The address of a preopened socket can't be checked, so a specific
+	// address is rejected.
+	if _, err := net.Listen("tcp", "127.0.0.1:8080"); err == nil {
+		println("listen: expected an error for a specific address")
+		os.Exit(1)
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		println("listen:", err.Error())
+		os.Exit(1)
+	}
+	defer ln.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		println("accept:", err.Error())
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		println("read:", err.Error())
+		os.Exit(1)
+	}
+	name := strings.TrimSpace(line)
+	if _, err := conn.Write([]byte("hello, " + name + "\n")); err != nil {
+		println("write:", err.Error())
+		os.Exit(1)
+	}
+	println("served", name)
+}
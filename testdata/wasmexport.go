@@ -0,0 +1,24 @@
+package main
+
+import "time"
+
+var offset int32
+
+func init() {
+	offset = 10
+}
+
+// Exported functions run in their own goroutine, so they can block.
+//
+//go:wasmexport add
+func add(a, b int32) int32 {
+	time.Sleep(time.Millisecond)
+	ch := make(chan int32)
+	go func() {
+		ch <- a + b
+	}()
+	return <-ch + offset
+}
+
+func main() {
+}
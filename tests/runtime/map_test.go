@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+var mapSizes = []int{8, 100, 1000}
+
+func BenchmarkMapSet(b *testing.B) {
+	for _, n := range mapSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m := make(map[int32]int32)
+				for j := 0; j < n; j++ {
+					m[int32(j)] = int32(j)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMapGet(b *testing.B) {
+	for _, n := range mapSizes {
+		m := make(map[int32]int32)
+		for j := 0; j < n; j++ {
+			m[int32(j)] = int32(j)
+		}
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			var sum int32
+			for i := 0; i < b.N; i++ {
+				// Half of the lookups are for keys that don't exist.
+				sum += m[int32(i%(2*n))]
+			}
+			total += uint64(sum)
+		})
+	}
+}
+
+func BenchmarkMapGetString(b *testing.B) {
+	for _, n := range mapSizes {
+		keys := make([]string, 2*n)
+		for j := range keys {
+			keys[j] = "key" + strconv.Itoa(j)
+		}
+		m := make(map[string]int)
+		for j := 0; j < n; j++ {
+			m[keys[j]] = j
+		}
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			var sum int
+			for i := 0; i < b.N; i++ {
+				sum += m[keys[i%len(keys)]]
+			}
+			total += uint64(sum)
+		})
+	}
+}
+
+func BenchmarkMapDelete(b *testing.B) {
+	for _, n := range mapSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				m := make(map[int32]int32)
+				for j := 0; j < n; j++ {
+					m[int32(j)] = int32(j)
+				}
+				b.StartTimer()
+				for j := 0; j < n; j++ {
+					delete(m, int32(j))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMapChurn(b *testing.B) {
+	// Insert and delete keys while keeping the map at the same size.
+	m := make(map[int32]int32)
+	for i := 0; i < b.N; i++ {
+		m[int32(i)] = int32(i)
+		delete(m, int32(i-100))
+	}
+}
+
+func BenchmarkMapIterate(b *testing.B) {
+	for _, n := range mapSizes {
+		m := make(map[int32]int32)
+		for j := 0; j < n; j++ {
+			m[int32(j)] = int32(j)
+		}
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			var sum int32
+			for i := 0; i < b.N; i++ {
+				for k, v := range m {
+					sum += k + v
+				}
+			}
+			total += uint64(sum)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package wasm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBindings(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not found:", err)
+	}
+
+	tmpDir := t.TempDir()
+
+	err := run(t, "tinygo build -o "+tmpDir+"/bindings.wasm -target wasm -wasm-bindings testdata/bindings.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bindings.js", "bindings.d.ts"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The generated module imports wasm_exec.js from the same directory.
+	wasmExec, err := os.ReadFile("../../targets/wasm_exec.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(tmpDir, "wasm_exec.js"), wasmExec, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Node treats .js files as ES modules with this package.json.
+	err = os.WriteFile(filepath.Join(tmpDir, "package.json"), []byte(`{"type": "module"}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(tmpDir, "test.js"), []byte(`
+import { readFileSync } from "fs";
+import * as bindings from "./bindings.js";
+
+await bindings.init(readFileSync(new URL("bindings.wasm", import.meta.url)));
+console.log(bindings.add(3, 4));
+console.log(bindings.greet("gopher", false));
+console.log(bindings.greet("gopher", true));
+const buf = new Uint8Array([1, 2, 3]);
+bindings.increment(buf);
+console.log(buf.join(","));
+console.log(bindings.reverse(buf).join(","));
+console.log(bindings.addInt64(1n << 40n, 5n - (1n << 40n)));
+bindings.save("kept", new Uint8Array([104, 105]));
+for (let i = 0; i < 10; i++) {
+	bindings.greet("x".repeat(1000), false);
+}
+console.log(bindings.load());
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("node", filepath.Join(tmpDir, "test.js"))
+	output, err := cmd.CombinedOutput()
+	t.Logf("output:\n%s", output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "7\nhello gopher\nHELLO GOPHER\n2,3,4\n4,3,2\n5\nkept:hi\n"
+	if string(output) != expected {
+		t.Errorf("unexpected output: expected %q but got %q", expected, strings.TrimSpace(string(output)))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+)
+
+//export add
+func add(a, b int32) int32 {
+	return a + b
+}
+
+//export greet
+func greet(name string, loud bool) string {
+	if loud {
+		return "HELLO " + strings.ToUpper(name)
+	}
+	return "hello " + name
+}
+
+//export increment
+func increment(buf []byte) {
+	for i := range buf {
+		buf[i]++
+	}
+}
+
+//export reverse
+func reverse(buf []byte) []byte {
+	result := make([]byte, len(buf))
+	for i, c := range buf {
+		result[len(buf)-1-i] = c
+	}
+	return result
+}
+
+//export addInt64
+func addInt64(a, b int64) int32 {
+	return int32(a + b)
+}
+
+var (
+	saved      string
+	savedBytes []byte
+	sink       []byte
+)
+
+// save keeps its arguments after it returned.
+//
+//export save
+func save(s string, b []byte) {
+	saved = s
+	savedBytes = b
+}
+
+// load returns the arguments of the last save call, after a garbage collection
+// and a new allocation that could reuse the memory if it had been freed.
+//
+//export load
+func load() string {
+	runtime.GC()
+	sink = make([]byte, 4096)
+	for i := range sink {
+		sink[i] = 'x'
+	}
+	return saved + ":" + string(savedBytes)
+}
+
+func main() {
+}
@@ -57,6 +57,7 @@ type SVDRegister struct {
 	Fields        []*SVDField `xml:"fields>field"`
 	Offset        *string     `xml:"offset"`
 	AddressOffset *string     `xml:"addressOffset"`
+	Access        string      `xml:"access"`
 }
 
 type SVDField struct {
@@ -67,6 +68,7 @@ type SVDField struct {
 	BitOffset        *uint32 `xml:"bitOffset"`
 	BitWidth         *uint32 `xml:"bitWidth"`
 	BitRange         *string `xml:"bitRange"`
+	Access           string  `xml:"access"`
 	EnumeratedValues struct {
 		DerivedFrom     string `xml:"derivedFrom,attr"`
 		Name            string `xml:"name"`
@@ -137,6 +139,7 @@ type PeripheralField struct {
 	Registers    []*PeripheralField // contains fields if this is a cluster
 	Array        int
 	ElementSize  int
+	Access       string // SVD access of the register
 	Constants    []Constant
 	ShortName    string     // name stripped of "spaced array" suffix
 	Bitfields    []Bitfield // set of bit-fields provided by this
@@ -150,9 +153,23 @@ type Constant struct {
 }
 
 type Bitfield struct {
-	Name   string
-	Offset uint32
-	Mask   uint32
+	Name     string
+	Offset   uint32
+	Mask     uint32
+	Access   string     // SVD access of the field, inherited from the register
+	EnumType string     // name of the enumerated value type, if there is one
+	Enums    []Constant // enumerated values, named relative to EnumType
+}
+
+// readable returns whether the bitfield may be read according to the SVD file.
+func (b *Bitfield) readable() bool {
+	return b.Access != "write-only" && b.Access != "writeOnce"
+}
+
+// writable returns whether the bitfield may be written according to the SVD
+// file.
+func (b *Bitfield) writable() bool {
+	return b.Access != "read-only"
 }
 
 func formatText(text string) string {
@@ -534,7 +551,7 @@ func addInterrupt(interrupts map[string]*Interrupt, name, interruptName string,
 	}
 }
 
-func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPrefix string) ([]Constant, []Bitfield) {
+func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPrefix, regAccess string) ([]Constant, []Bitfield) {
 	var fields []Constant
 	var bitfields []Bitfield
 	enumSeen := map[string]int64{}
@@ -604,11 +621,17 @@ func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPre
 			}
 		}
 
+		access := fieldEl.Access
+		if access == "" {
+			access = regAccess
+		}
 		bitfields = append(bitfields, Bitfield{
 			Name:   fieldName,
 			Offset: lsb,
 			Mask:   (0xffffffff >> (31 - (msb - lsb))) << lsb,
+			Access: access,
 		})
+		bitfield := &bitfields[len(bitfields)-1]
 		fields = append(fields, Constant{
 			Name:        fmt.Sprintf("%s_%s%s_%s_Pos", groupName, bitfieldPrefix, regName, fieldName),
 			Description: fmt.Sprintf("Position of %s field.", fieldName),
@@ -654,6 +677,11 @@ func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPre
 					panic(err)
 				}
 			}
+			bitfield.Enums = append(bitfield.Enums, Constant{
+				Name:        enumName,
+				Description: enumDescription,
+				Value:       enumValue,
+			})
 			enumName = fmt.Sprintf("%s_%s%s_%s_%s", groupName, bitfieldPrefix, regName, fieldName, enumName)
 
 			// Avoid duplicate values. Duplicate names with the same value are
@@ -691,6 +719,31 @@ func parseBitfields(groupName, regName string, fieldEls []*SVDField, bitfieldPre
 			})
 		}
 	}
+
+	// Create a typed enum for every field with enumerated values. Values that
+	// were removed above because of a name conflict are left out here too.
+	for i := range bitfields {
+		bitfield := &bitfields[i]
+		prefix := fmt.Sprintf("%s_%s%s_%s_", groupName, bitfieldPrefix, regName, bitfield.Name)
+		var enums []Constant
+		seen := map[string]bool{}
+		for _, enum := range bitfield.Enums {
+			if enum.Name == "Value" {
+				// The untyped constant would conflict with the type name.
+				enums = nil
+				break
+			}
+			if enumSeen[prefix+enum.Name] < 0 || seen[enum.Name] {
+				continue
+			}
+			seen[enum.Name] = true
+			enums = append(enums, enum)
+		}
+		bitfield.Enums = enums
+		if len(enums) != 0 {
+			bitfield.EnumType = prefix + "Value"
+		}
+	}
 	return fields, bitfields
 }
 
@@ -822,11 +875,12 @@ func parseRegister(groupName string, regEl *SVDRegister, baseAddress uint64, bit
 					Description: reg.description(),
 					Array:       -1,
 					ElementSize: reg.size(),
+					Access:      regEl.Access,
 					ShortName:   shortName,
 				})
 			}
 			// set first result bitfield
-			results[0].Constants, results[0].Bitfields = parseBitfields(groupName, shortName, regEl.Fields, bitfieldPrefix)
+			results[0].Constants, results[0].Bitfields = parseBitfields(groupName, shortName, regEl.Fields, bitfieldPrefix, regEl.Access)
 			results[0].HasBitfields = len(results[0].Bitfields) > 0
 			for i := 1; i < len(results); i++ {
 				results[i].Bitfields = results[0].Bitfields
@@ -841,7 +895,7 @@ func parseRegister(groupName string, regEl *SVDRegister, baseAddress uint64, bit
 	}
 	regName = cleanName(regName)
 
-	constants, bitfields := parseBitfields(groupName, regName, regEl.Fields, bitfieldPrefix)
+	constants, bitfields := parseBitfields(groupName, regName, regEl.Fields, bitfieldPrefix, regEl.Access)
 	return []*PeripheralField{&PeripheralField{
 		Name:         regName,
 		Address:      reg.address(),
@@ -849,6 +903,7 @@ func parseRegister(groupName string, regEl *SVDRegister, baseAddress uint64, bit
 		Constants:    constants,
 		Array:        reg.dim(),
 		ElementSize:  reg.size(),
+		Access:       regEl.Access,
 		ShortName:    regName,
 		Bitfields:    bitfields,
 		HasBitfields: len(bitfields) > 0,
@@ -975,6 +1030,7 @@ var (
 	}
 
 	// Define peripheral struct types.
+	enumTypes := map[string]bool{} // enum types that have already been defined
 	for _, peripheral := range device.Peripherals {
 		if peripheral.Registers == nil {
 			// This peripheral was derived from another peripheral. No new type
@@ -1078,7 +1134,7 @@ var (
 
 		for _, register := range peripheral.Registers {
 			regName := register.Name
-			writeGoRegisterBitfieldType(w, register, peripheral.GroupName, regName)
+			writeGoRegisterBitfieldType(w, register, peripheral.GroupName, regName, enumTypes)
 		}
 
 		// Define clusters
@@ -1191,7 +1247,7 @@ var (
 			for _, register := range cluster.registers {
 				regName := register.Name
 				if register.Array == -1 {
-					writeGoRegisterBitfieldType(w, register, cluster.name, regName)
+					writeGoRegisterBitfieldType(w, register, cluster.name, regName, enumTypes)
 				}
 			}
 		}
@@ -1253,7 +1309,7 @@ func writeGoRegisterConstants(w *bufio.Writer, register *PeripheralField, name s
 	}
 }
 
-func writeGoRegisterBitfieldType(w *bufio.Writer, register *PeripheralField, peripheralName, registerName string) {
+func writeGoRegisterBitfieldType(w *bufio.Writer, register *PeripheralField, peripheralName, registerName string, enumTypes map[string]bool) {
 	if len(register.Bitfields) == 0 {
 		return
 	}
@@ -1322,7 +1378,100 @@ func writeGoRegisterBitfieldType(w *bufio.Writer, register *PeripheralField, per
 			fmt.Fprintf(w, "\treturn volatile.LoadUint%d(%s)&0x%x\n", bitSize, regAccess, bitfield.Mask)
 		}
 		w.WriteString("}\n")
+
+		// Typed accessors. Unlike the Set/Get functions above, these take and
+		// return the field value using the enumerated type (or bool for
+		// single-bit fields) and are only defined when the SVD file allows the
+		// access, so that misuse is caught at compile time.
+		uintType := fmt.Sprintf("uint%d", bitSize)
+		valueType := uintType
+		fullRegister := maxMask == bitfield.Mask
+		if bitfield.EnumType != "" {
+			valueType = bitfield.EnumType
+			writeGoBitfieldEnumType(w, &bitfield, uintType, peripheralName+"."+registerName, enumTypes)
+		} else if !fullRegister && bitfield.Mask>>bitfield.Offset == 1 {
+			valueType = "bool"
+		}
+		if bitfield.readable() {
+			fmt.Fprintf(w, "\n// Read%s returns the %s field of %s.%s.\n", funcSuffix, bitfield.Name, peripheralName, registerName)
+			fmt.Fprintf(w, "func (o *%s) Read%s(%s) %s {\n", typeName, funcSuffix, strings.TrimSuffix(idxArg, ", "), valueType)
+			value := fmt.Sprintf("volatile.LoadUint%d(%s)", bitSize, regAccess)
+			if valueType == "bool" {
+				value = fmt.Sprintf("%s&0x%x != 0", value, bitfield.Mask)
+			} else {
+				if !fullRegister {
+					value = fmt.Sprintf("%s&0x%x", value, bitfield.Mask)
+				}
+				if bitfield.Offset > 0 {
+					value = fmt.Sprintf("(%s)>>%d", value, bitfield.Offset)
+				}
+				if valueType != uintType {
+					value = fmt.Sprintf("%s(%s)", valueType, value)
+				}
+			}
+			fmt.Fprintf(w, "\treturn %s\n", value)
+			w.WriteString("}\n")
+		}
+		if bitfield.writable() {
+			// Write-only registers can't be read back, so the other fields of
+			// the register are cleared instead of preserved.
+			writeOnly := register.Access == "write-only" || register.Access == "writeOnce"
+			fmt.Fprintf(w, "\n// Write%s sets the %s field of %s.%s.\n", funcSuffix, bitfield.Name, peripheralName, registerName)
+			if writeOnly && !fullRegister {
+				w.WriteString("// The register is write-only: all other fields are cleared.\n")
+			}
+			fmt.Fprintf(w, "func (o *%s) Write%s(%svalue %s) {\n", typeName, funcSuffix, idxArg, valueType)
+			store := fmt.Sprintf("volatile.StoreUint%d(%s, ", bitSize, regAccess)
+			load := fmt.Sprintf("volatile.LoadUint%d(%s)", bitSize, regAccess)
+			switch {
+			case valueType == "bool" && writeOnly:
+				fmt.Fprintf(w, "\tif value {\n\t\t%s0x%x)\n\t} else {\n\t\t%s0)\n\t}\n", store, bitfield.Mask, store)
+			case valueType == "bool":
+				fmt.Fprintf(w, "\tif value {\n\t\t%s%s|0x%x)\n\t} else {\n\t\t%s%s&^0x%x)\n\t}\n", store, load, bitfield.Mask, store, load, bitfield.Mask)
+			default:
+				value := "value"
+				if valueType != uintType {
+					value = uintType + "(value)"
+				}
+				if fullRegister {
+					fmt.Fprintf(w, "\t%s%s)\n", store, value)
+					break
+				}
+				if bitfield.Offset > 0 {
+					value += fmt.Sprintf("<<%d", bitfield.Offset)
+				}
+				value += fmt.Sprintf("&0x%x", bitfield.Mask)
+				if writeOnly {
+					fmt.Fprintf(w, "\t%s%s)\n", store, value)
+				} else {
+					fmt.Fprintf(w, "\t%s%s&^0x%x|%s)\n", store, load, bitfield.Mask, value)
+				}
+			}
+			w.WriteString("}\n")
+		}
+	}
+}
+
+// writeGoBitfieldEnumType writes the type for the enumerated values of a
+// bitfield, together with its typed constants. Every type is only written
+// once, as registers in a "spaced array" share their bitfields.
+func writeGoBitfieldEnumType(w *bufio.Writer, bitfield *Bitfield, uintType, registerName string, enumTypes map[string]bool) {
+	if enumTypes[bitfield.EnumType] {
+		return
+	}
+	enumTypes[bitfield.EnumType] = true
+	fmt.Fprintf(w, "\n// %s is a value of the %s field of %s.\n", bitfield.EnumType, bitfield.Name, registerName)
+	fmt.Fprintf(w, "type %s %s\n\n", bitfield.EnumType, uintType)
+	w.WriteString("const (\n")
+	for _, enum := range bitfield.Enums {
+		if enum.Description != "" {
+			for _, l := range splitLine(enum.Description) {
+				w.WriteString("\t// " + l + "\n")
+			}
+		}
+		fmt.Fprintf(w, "\t%s_%s %s = 0x%x\n", bitfield.EnumType, enum.Name, bitfield.EnumType, enum.Value)
 	}
+	w.WriteString(")\n")
 }
 
 // The interrupt vector, which is hard to write directly in Go.
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generateTestDevice generates the Go file for testdata/accessors.svd and
+// returns its source.
+func generateTestDevice(t *testing.T) string {
+	t.Helper()
+	device, err := readSVD("testdata/accessors.svd", "https://example.com/accessors.svd")
+	if err != nil {
+		t.Fatal("could not read SVD file:", err)
+	}
+	outdir := filepath.Join(t.TempDir(), "device")
+	if err := os.Mkdir(outdir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeGo(outdir, device, "software"); err != nil {
+		t.Fatal("could not generate Go file:", err)
+	}
+	source, err := os.ReadFile(filepath.Join(outdir, "accessors.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(source)
+}
+
+// volatileImporter type checks runtime/volatile from the TinyGo source tree,
+// which the generated files import.
+type volatileImporter struct {
+	fset     *token.FileSet
+	volatile *types.Package
+}
+
+func (imp *volatileImporter) Import(path string) (*types.Package, error) {
+	if path != "runtime/volatile" {
+		return importer.Default().Import(path)
+	}
+	if imp.volatile != nil {
+		return imp.volatile, nil
+	}
+	var files []*ast.File
+	for _, name := range []string{"register.go", "volatile.go"} {
+		file, err := parser.ParseFile(imp.fset, filepath.Join("..", "..", "src", "runtime", "volatile", name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	pkg, err := (&types.Config{}).Check(path, imp.fset, files, nil)
+	imp.volatile = pkg
+	return pkg, err
+}
+
+// checkDevice type checks the generated device package together with a file
+// that uses it, and returns the type errors.
+func checkDevice(t *testing.T, source, usage string) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for name, text := range map[string]string{"accessors.go": source, "usage.go": usage} {
+		file, err := parser.ParseFile(fset, name, text, 0)
+		if err != nil {
+			t.Fatal("could not parse:", err)
+		}
+		files = append(files, file)
+	}
+	var errs []string
+	config := types.Config{
+		Importer: &volatileImporter{fset: fset},
+		Error: func(err error) {
+			errs = append(errs, err.Error())
+		},
+	}
+	config.Check("device", fset, files, nil)
+	return errs
+}
+
+func TestTypedAccessors(t *testing.T) {
+	source := generateTestDevice(t)
+
+	// The typed accessors have the expected signatures and can be used
+	// together.
+	errs := checkDevice(t, source, `package device
+
+func useAccessors() {
+	var enabled bool = TIMER.ReadCTRL_ENABLE()
+	TIMER.WriteCTRL_ENABLE(!enabled)
+	var mode TIMER_CTRL_MODE_Value = TIMER.ReadCTRL_MODE()
+	if mode == TIMER_CTRL_MODE_Value_ONESHOT {
+		TIMER.WriteCTRL_MODE(TIMER_CTRL_MODE_Value_PERIODIC)
+	}
+	var prescaler uint32 = TIMER.ReadCTRL_PRESCALER()
+	TIMER.WriteCTRL_PRESCALER(prescaler + 1)
+	var running bool = TIMER.ReadCTRL_RUNNING()
+	_ = running
+	var count uint32 = TIMER.ReadCOUNT()
+	_ = count
+	TIMER.WriteTASKS_START(true)
+	TIMER.WriteTASKS_RELOAD(0x80)
+}
+`)
+	for _, err := range errs {
+		t.Error("unexpected error:", err)
+	}
+
+	// Misuse of the accessors is rejected at compile time.
+	tests := []struct {
+		name  string
+		usage string
+		err   string
+	}{
+		{"write read-only field", "TIMER.WriteCTRL_RUNNING(true)", "has no field or method WriteCTRL_RUNNING"},
+		{"write read-only register", "TIMER.WriteCOUNT(0)", "has no field or method WriteCOUNT"},
+		{"read write-only field", "_ = TIMER.ReadTASKS_START()", "has no field or method ReadTASKS_START"},
+		{"read write-only multi-bit field", "_ = TIMER.ReadTASKS_RELOAD()", "has no field or method ReadTASKS_RELOAD"},
+		{"untyped enum value", "var mode uint32 = 1; TIMER.WriteCTRL_MODE(mode)", "cannot use mode"},
+		{"integer single-bit field", "TIMER.WriteCTRL_ENABLE(1)", "cannot use 1"},
+	}
+	for _, tc := range tests {
+		errs := checkDevice(t, source, "package device\n\nfunc misuse() {\n\t"+tc.usage+"\n}\n")
+		if len(errs) != 1 || !strings.Contains(errs[0], tc.err) {
+			t.Errorf("%s: expected error containing %q, got %q", tc.name, tc.err, errs)
+		}
+	}
+}
+
+func TestTypedAccessorsSource(t *testing.T) {
+	source := generateTestDevice(t)
+
+	// The generated function bodies preserve the other fields of a register,
+	// except when the register is write-only.
+	tests := []string{
+		"func (o *TIMER_Type) ReadCTRL_ENABLE() bool {\n\treturn volatile.LoadUint32(&o.CTRL.Reg)&0x1 != 0\n}",
+		"func (o *TIMER_Type) ReadCTRL_MODE() TIMER_CTRL_MODE_Value {\n\treturn TIMER_CTRL_MODE_Value((volatile.LoadUint32(&o.CTRL.Reg)&0x30)>>4)\n}",
+		"func (o *TIMER_Type) WriteCTRL_MODE(value TIMER_CTRL_MODE_Value) {\n\tvolatile.StoreUint32(&o.CTRL.Reg, volatile.LoadUint32(&o.CTRL.Reg)&^0x30|uint32(value)<<4&0x30)\n}",
+		"func (o *TIMER_Type) ReadCOUNT() uint32 {\n\treturn volatile.LoadUint32(&o.COUNT.Reg)\n}",
+		"func (o *TIMER_Type) WriteTASKS_RELOAD(value uint32) {\n\tvolatile.StoreUint32(&o.TASKS.Reg, value<<8&0xff00)\n}",
+		"// The register is write-only: all other fields are cleared.\nfunc (o *TIMER_Type) WriteTASKS_START(value bool) {",
+	}
+	for _, expected := range tests {
+		if !strings.Contains(source, expected) {
+			t.Errorf("generated code doesn't contain:\n%s", expected)
+		}
+	}
+}
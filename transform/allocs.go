@@ -10,6 +10,7 @@ import (
 	"go/token"
 	"regexp"
 
+	"github.com/tinygo-org/tinygo/diagnostics"
 	"tinygo.org/x/go-llvm"
 )
 
@@ -43,22 +44,14 @@ func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(tok
 
 	for _, heapalloc := range getUses(allocator) {
 		logAllocs := printAllocs != nil && printAllocs.MatchString(heapalloc.InstructionParent().Parent().Name())
-		if heapalloc.Operand(0).IsAConstantInt().IsNil() {
-			// Do not allocate variable length arrays on the stack.
+		if reason := allocSizeReason(heapalloc); reason != "" {
 			if logAllocs {
-				logAlloc(logger, heapalloc, "size is not constant")
+				logAlloc(logger, heapalloc, reason)
 			}
 			continue
 		}
 
 		size := heapalloc.Operand(0).ZExtValue()
-		if size > maxStackAlloc {
-			// The maximum size for a stack allocation.
-			if logAllocs {
-				logAlloc(logger, heapalloc, fmt.Sprintf("object size %d exceeds maximum stack allocation size %d", size, maxStackAlloc))
-			}
-			continue
-		}
 
 		if size == 0 {
 			// If the size is 0, the pointer is allowed to alias other
@@ -72,27 +65,10 @@ func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(tok
 			continue
 		}
 
-		// In general the pattern is:
-		//     %0 = call i8* @runtime.alloc(i32 %size, i8* null)
-		//     %1 = bitcast i8* %0 to type*
-		//     (use %1 only)
-		// But the bitcast might sometimes be dropped when allocating an *i8.
-		// The 'bitcast' variable below is thus usually a bitcast of the
-		// heapalloc but not always.
-		bitcast := heapalloc // instruction that creates the value
-		if uses := getUses(heapalloc); len(uses) == 1 && !uses[0].IsABitCastInst().IsNil() {
-			// getting only bitcast use
-			bitcast = uses[0]
-		}
-
+		bitcast := allocBitcast(heapalloc)
 		if at := valueEscapesAt(bitcast); !at.IsNil() {
 			if logAllocs {
-				atPos := getPosition(at)
-				msg := "escapes at unknown line"
-				if atPos.Line != 0 {
-					msg = fmt.Sprintf("escapes at line %d", atPos.Line)
-				}
-				logAlloc(logger, heapalloc, msg)
+				logAlloc(logger, heapalloc, escapeReason(at))
 			}
 			continue
 		}
@@ -139,6 +115,103 @@ func OptimizeAllocs(mod llvm.Module, printAllocs *regexp.Regexp, logger func(tok
 	}
 }
 
+// allocSizeReason returns why the given runtime.alloc call can't be turned into
+// a stack allocation because of its size, or the empty string if the size is
+// not a problem.
+func allocSizeReason(heapalloc llvm.Value) string {
+	if heapalloc.Operand(0).IsAConstantInt().IsNil() {
+		// Do not allocate variable length arrays on the stack.
+		return "size is not constant"
+	}
+	if size := heapalloc.Operand(0).ZExtValue(); size > maxStackAlloc {
+		// The maximum size for a stack allocation.
+		return fmt.Sprintf("object size %d exceeds maximum stack allocation size %d", size, maxStackAlloc)
+	}
+	return ""
+}
+
+// allocBitcast returns the instruction that creates the value of the given
+// runtime.alloc call.
+func allocBitcast(heapalloc llvm.Value) llvm.Value {
+	// In general the pattern is:
+	//     %0 = call i8* @runtime.alloc(i32 %size, i8* null)
+	//     %1 = bitcast i8* %0 to type*
+	//     (use %1 only)
+	// But the bitcast might sometimes be dropped when allocating an *i8.
+	// The returned value is thus usually a bitcast of the heapalloc but not
+	// always.
+	if uses := getUses(heapalloc); len(uses) == 1 && !uses[0].IsABitCastInst().IsNil() {
+		// getting only bitcast use
+		return uses[0]
+	}
+	return heapalloc
+}
+
+// escapeReason describes where a value escapes, for use in a report.
+func escapeReason(at llvm.Value) string {
+	atPos := getPosition(at)
+	if atPos.Line == 0 {
+		return "escapes at unknown line"
+	}
+	return fmt.Sprintf("escapes at line %d", atPos.Line)
+}
+
+// ReportAllocs returns all heap allocations in the module with the reason why
+// they are heap allocated, as far as it can be determined. It should be run
+// after OptimizeAllocs, and before inlining so that allocations are reported in
+// the function in which they appear in the source code.
+func ReportAllocs(mod llvm.Module) []diagnostics.Alloc {
+	allocator := mod.NamedFunction("runtime.alloc")
+	if allocator.IsNil() {
+		return nil
+	}
+
+	var allocs []diagnostics.Alloc
+	for _, heapalloc := range getUses(allocator) {
+		if heapalloc.IsACallInst().IsNil() {
+			continue
+		}
+		var size uint64
+		if !heapalloc.Operand(0).IsAConstantInt().IsNil() {
+			size = heapalloc.Operand(0).ZExtValue()
+			if size == 0 {
+				// Zero-sized allocations don't allocate any memory.
+				continue
+			}
+		}
+		fn := heapalloc.InstructionParent().Parent()
+		alloc := diagnostics.Alloc{
+			Pos:      diagnostics.NewPosition(getPosition(heapalloc)),
+			Function: fn.Name(),
+			Package:  functionPackage(fn),
+			Size:     size,
+			Reason:   allocSizeReason(heapalloc),
+		}
+		if alloc.Reason == "" {
+			if at := valueEscapesAt(allocBitcast(heapalloc)); !at.IsNil() {
+				alloc.Reason = escapeReason(at)
+				alloc.EscapePos = diagnostics.NewPosition(getPosition(at))
+			} else {
+				// This happens when optimizations are disabled.
+				alloc.Reason = "not converted to a stack allocation"
+			}
+		}
+		allocs = append(allocs, alloc)
+	}
+	return allocs
+}
+
+// functionPackage returns the package path of the given function, as set by
+// the compiler in the "tinygo-pkgpath" attribute. It returns "" for functions
+// without this attribute, for example functions written in C.
+func functionPackage(fn llvm.Value) string {
+	attr := fn.GetStringAttributeAtIndex(-1, "tinygo-pkgpath")
+	if attr.IsNil() {
+		return ""
+	}
+	return attr.GetStringValue()
+}
+
 // valueEscapesAt returns the instruction where the given value may escape and a
 // nil llvm.Value if it definitely doesn't. The value must be an instruction.
 func valueEscapesAt(value llvm.Value) llvm.Value {
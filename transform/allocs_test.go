@@ -78,3 +78,40 @@ func TestAllocs2(t *testing.T) {
 		t.Errorf("output does not match expected output:\n%s", testOutput)
 	}
 }
+
+// Test that the allocation report lists the same heap allocations (with the
+// same reasons) as -print-allocs.
+func TestReportAllocs(t *testing.T) {
+	t.Parallel()
+
+	mod := compileGoFileForTesting(t, "./testdata/allocs2.go")
+
+	pm := llvm.NewPassManager()
+	defer pm.Dispose()
+	pm.AddInstructionCombiningPass()
+	pm.AddFunctionAttrsPass()
+	pm.Run(mod)
+
+	var printed []string
+	transform.OptimizeAllocs(mod, regexp.MustCompile("."), func(pos token.Position, msg string) {
+		printed = append(printed, filepath.Base(pos.Filename)+":"+strconv.Itoa(pos.Line)+": "+strings.TrimPrefix(msg, "object allocated on the heap: "))
+	})
+	sort.Strings(printed)
+
+	var reported []string
+	for _, alloc := range transform.ReportAllocs(mod) {
+		if alloc.Pos == nil {
+			t.Errorf("allocation in %s has no position", alloc.Function)
+			continue
+		}
+		if alloc.Package != "main" || !strings.HasPrefix(alloc.Function, "main.") {
+			t.Errorf("unexpected function %s in package %s", alloc.Function, alloc.Package)
+		}
+		reported = append(reported, filepath.Base(alloc.Pos.Filename)+":"+strconv.Itoa(alloc.Pos.Line)+": "+alloc.Reason)
+	}
+	sort.Strings(reported)
+
+	if strings.Join(reported, "\n") != strings.Join(printed, "\n") {
+		t.Errorf("allocation report does not match printed allocations:\n%s\n\nexpected:\n%s", strings.Join(reported, "\n"), strings.Join(printed, "\n"))
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/compiler/ircheck"
+	"github.com/tinygo-org/tinygo/diagnostics"
 	"tinygo.org/x/go-llvm"
 )
 
@@ -117,6 +118,18 @@ func Optimize(mod llvm.Module, config *compileopts.Config, optLevel, sizeLevel i
 
 		// Run TinyGo-specific interprocedural optimizations.
 		OptimizeAllocs(mod, config.Options.PrintAllocs, func(pos token.Position, msg string) {
+			if config.Options.Events != nil {
+				config.Options.Events.Emit(diagnostics.Event{
+					Action: "diagnostic",
+					Diagnostic: &diagnostics.Diagnostic{
+						Kind:     "alloc",
+						Pos:      diagnostics.NewPosition(pos),
+						Message:  msg,
+						Severity: "info",
+					},
+				})
+				return
+			}
 			fmt.Fprintln(os.Stderr, pos.String()+": "+msg)
 		})
 		OptimizeStringToBytes(mod)
@@ -160,6 +173,21 @@ func Optimize(mod llvm.Module, config *compileopts.Config, optLevel, sizeLevel i
 		return []error{errors.New("optimizations caused a verification failure")}
 	}
 
+	// Report the remaining heap allocations now, before the inliner moves
+	// them into other functions.
+	if config.Options.AllocReport != "" || len(config.Options.MaxAllocs) != 0 {
+		allocs := ReportAllocs(mod)
+		if config.Options.AllocReport != "" {
+			err := diagnostics.WriteAllocReport(config.Options.AllocReport, allocs)
+			if err != nil {
+				return []error{err}
+			}
+		}
+		if errs := diagnostics.CheckAllocBudget(allocs, config.Options.MaxAllocs); len(errs) != 0 {
+			return errs
+		}
+	}
+
 	// After TinyGo-specific transforms have finished, undo exporting these functions.
 	for _, name := range functionsUsedInTransforms {
 		fn := mod.NamedFunction(name)